@@ -1286,6 +1286,7 @@ func CancelAppointment(c *gin.Context) {
 			UPDATE follow_ups 
 			SET status = 'active', 
 			    follow_up_logic_status = 'new',
+			    free_visits_used = GREATEST(free_visits_used - 1, 0),
 			    used_at = NULL, 
 			    used_appointment_id = NULL, 
 			    logic_notes = COALESCE(logic_notes || '\n', '') || 'Restored: follow-up appointment was cancelled',
@@ -1808,7 +1809,7 @@ func CreatePatientWithAppointment(c *gin.Context) {
 		_ = tx.QueryRowContext(ctx, "SELECT id FROM clinic_patients WHERE global_patient_id = $1 AND clinic_id = $2 AND is_active = true", patientID, input.ClinicID).Scan(&clinicPatientID)
 		if clinicPatientID != "" {
 			fm := &utils.FollowUpManager{DB: config.DB}
-			_ = fm.CreateFollowUp(clinicPatientID, input.ClinicID, docID, input.DepartmentID, appointment.ID, appointmentDate)
+			_ = fm.CreateFollowUpForType(clinicPatientID, input.ClinicID, docID, input.DepartmentID, appointment.ID, appointmentDate, input.ConsultationType)
 		}
 	}
 
@@ -6,10 +6,13 @@ import (
 	"appointment-service/utils"
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"shared-followup"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -86,18 +89,13 @@ func CreateSimpleAppointment(c *gin.Context) {
 
 	// Step 2: Merged Validation & Data Fetching (Reduces 5+ queries into 1)
 	var (
-		patientID, patientClinicID, patientName                           sql.NullString
-		doctorID, doctorCode, doctorFirst, doctorLast                     sql.NullString
-		consultFee, followupFee                                           *float64
-		clinicCode, deptName                                              sql.NullString
-		slotClinicID, slotStatus                                          sql.NullString
-		slotAvailableCount                                                sql.NullInt64
-		activeFollowupID, activeFollowupStatus, activeFollowupLogicStatus sql.NullString
-		activeFollowupIsFree                                              sql.NullBool
-		activeFollowupValidFrom, activeFollowupValidUntil                 *time.Time
-		activeFollowupSourceID, activeFollowupRenewedBy                   sql.NullString
-		activeFollowupCreatedAt, activeFollowupUpdatedAt                  *time.Time
-		hasPreviousAppointment                                            bool
+		patientID, patientClinicID, patientName       sql.NullString
+		doctorID, doctorCode, doctorFirst, doctorLast sql.NullString
+		consultFee, followupFee                       *float64
+		clinicCode, deptName                          sql.NullString
+		slotClinicID, slotStatus                      sql.NullString
+		slotAvailableCount                            sql.NullInt64
+		hasPreviousAppointment                        bool
 	)
 
 	err = config.DB.QueryRowContext(ctx, `
@@ -108,8 +106,6 @@ func CreateSimpleAppointment(c *gin.Context) {
 			COALESCE(cdl.follow_up_fee, d.follow_up_fee),
 			c.clinic_code, dept.name,
 			s.clinic_id, s.status, s.available_count,
-			f.id, f.status, f.is_free, f.valid_from, f.valid_until, f.source_appointment_id, f.renewed_by_appointment_id,
-            f.follow_up_logic_status, f.created_at, f.updated_at,
 			EXISTS(SELECT 1 FROM appointments WHERE clinic_patient_id = $1 AND doctor_id = $2 AND status IN ('completed', 'confirmed')) as has_prev
 		FROM (SELECT 1) dummy
 		LEFT JOIN clinic_patients p ON p.id = $1 AND p.is_active = true
@@ -119,21 +115,12 @@ func CreateSimpleAppointment(c *gin.Context) {
 		LEFT JOIN clinic_doctor_links cdl ON cdl.doctor_id = d.id AND cdl.clinic_id = $3
 		LEFT JOIN departments dept ON dept.id = $4
 		LEFT JOIN doctor_individual_slots s ON s.id = $5
-		LEFT JOIN (
-			SELECT * FROM follow_ups 
-			WHERE clinic_patient_id = $1 AND doctor_id = $2 
-			AND (department_id = $4 OR (department_id IS NULL AND $4 IS NULL))
-			AND status = 'active' AND valid_until >= CURRENT_DATE
-			ORDER BY created_at DESC LIMIT 1
-		) f ON true
 	`, input.ClinicPatientID, input.DoctorID, input.ClinicID, input.DepartmentID, input.IndividualSlotID).Scan(
 		&patientID, &patientClinicID, &patientName,
 		&doctorID, &doctorCode, &doctorFirst, &doctorLast,
 		&consultFee, &followupFee,
 		&clinicCode, &deptName,
 		&slotClinicID, &slotStatus, &slotAvailableCount,
-		&activeFollowupID, &activeFollowupStatus, &activeFollowupIsFree, &activeFollowupValidFrom, &activeFollowupValidUntil, &activeFollowupSourceID, &activeFollowupRenewedBy,
-		&activeFollowupLogicStatus, &activeFollowupCreatedAt, &activeFollowupUpdatedAt,
 		&hasPreviousAppointment,
 	)
 
@@ -150,13 +137,31 @@ func CreateSimpleAppointment(c *gin.Context) {
 		return
 	}
 
-	// Step 3: Business Logic Validation
+	// Step 3: Business Logic Validation (follow-up rules come from the resolved policy)
+	fm := &utils.FollowUpManager{DB: config.DB}
+	policy := fm.LoadPolicy(ctx, input.ClinicID, input.DoctorID, input.DepartmentID)
+
+	var followUpDecision followup.Decision
+	var followUpWindow *followup.Window // the window a free follow-up is consumed from
 	isFreeFollowUp := false
 	if input.IsFollowUp {
-		if activeFollowupID.Valid && activeFollowupIsFree.Bool {
-			isFreeFollowUp = true
-		} else if !hasPreviousAppointment {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Not eligible for follow-up", "message": "No previous appointment found with this doctor"})
+		req := followup.Request{
+			Policy:           policy,
+			HasPreviousVisit: hasPreviousAppointment,
+			ViaVideo:         input.ConsultationType == followup.TypeFollowUpVideo,
+			Now:              time.Now(),
+		}
+		req.Latest, req.LatestAnyDepartment, err = followup.LoadWindows(ctx, config.DB, input.ClinicPatientID, input.ClinicID, input.DoctorID, input.DepartmentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check follow-up eligibility"})
+			return
+		}
+		followUpDecision = followup.Evaluate(req)
+		followUpWindow = req.Window()
+		isFreeFollowUp = followUpDecision.IsFree && followUpWindow != nil
+
+		if !followUpDecision.Eligible {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Not eligible for follow-up", "message": followUpDecision.Message})
 			return
 		}
 	}
@@ -204,8 +209,8 @@ func CreateSimpleAppointment(c *gin.Context) {
 
 	// Fee calculation
 	feeAmount := 0.0
-	if input.IsFollowUp && isFreeFollowUp {
-		feeAmount = 0.0
+	if input.IsFollowUp && (isFreeFollowUp || followUpDecision.IsDiscounted) {
+		feeAmount = followUpDecision.Fee(nil)
 	} else if input.ConsultationType == "follow_up" && followupFee != nil {
 		feeAmount = *followupFee
 	} else if consultFee != nil {
@@ -287,23 +292,27 @@ func CreateSimpleAppointment(c *gin.Context) {
 	var followUpID *string
 	newPatientFollowupStatus := ""
 
-	if input.ConsultationType == "clinic_visit" || input.ConsultationType == "video_consultation" {
+	_, followUpValidUntil := followup.WindowFor(policy, appointmentDate)
+
+	if followup.GrantsWindow(policy, input.ConsultationType) {
 		// New follow-up eligibility
 		newPatientFollowupStatus = "active"
-		// Mark existing ones as renewed
+		// Mark existing ones as renewed (every department when the policy resets across departments)
 		tx.ExecContext(ctx, `
 			UPDATE follow_ups SET status = 'renewed', renewed_at = CURRENT_TIMESTAMP, renewed_by_appointment_id = $1, follow_up_logic_status = 'renewed', updated_at = CURRENT_TIMESTAMP
 			WHERE clinic_patient_id = $2 AND clinic_id = $3 AND doctor_id = $4 AND status IN ('active', 'expired')
-			AND (department_id = $5 OR (department_id IS NULL AND $5 IS NULL))
-		`, appointment.ID, input.ClinicPatientID, input.ClinicID, input.DoctorID, input.DepartmentID)
+			AND ($6 OR department_id = $5 OR (department_id IS NULL AND $5 IS NULL))
+		`, appointment.ID, input.ClinicPatientID, input.ClinicID, input.DoctorID, input.DepartmentID, policy.CrossDepartmentReset)
 
 		// Insert new follow-up
 		err = tx.QueryRowContext(ctx, `
 			INSERT INTO follow_ups (
-				clinic_patient_id, clinic_id, doctor_id, department_id, source_appointment_id, status, is_free, valid_from, valid_until, follow_up_logic_status, created_at, updated_at
-			) VALUES ($1, $2, $3, $4, $5, 'active', true, $6, $7, 'new', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+				clinic_patient_id, clinic_id, doctor_id, department_id, source_appointment_id, status, is_free, valid_from, valid_until,
+				policy_id, free_visits_total, free_visits_used, follow_up_logic_status, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, $5, 'active', $6, $7, $8, $9, $10, 0, 'new', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 			RETURNING id
-		`, input.ClinicPatientID, input.ClinicID, input.DoctorID, input.DepartmentID, appointment.ID, appointmentDate, appointmentDate.AddDate(0, 0, 5)).Scan(&followUpID)
+		`, input.ClinicPatientID, input.ClinicID, input.DoctorID, input.DepartmentID, appointment.ID, policy.FreeVisits > 0,
+			appointmentDate, followUpValidUntil, policy.ID, policy.FreeVisits).Scan(&followUpID)
 
 		// Update patient info
 		tx.ExecContext(ctx, `
@@ -311,19 +320,25 @@ func CreateSimpleAppointment(c *gin.Context) {
 			WHERE id = $4
 		`, "active", appointment.ID, followUpID, input.ClinicPatientID)
 	} else if input.IsFollowUp && isFreeFollowUp {
-		// Use free follow-up
+		// Use one free visit; the window is only "used" once all free visits are gone
+		used, exhausted := followup.Consume(*followUpWindow)
+		newPatientFollowupStatus = followup.StatusActive
+		if exhausted {
+			newPatientFollowupStatus = followup.StatusUsed
+		}
+
 		tx.ExecContext(ctx, `
-			UPDATE follow_ups SET status = 'used', used_at = CURRENT_TIMESTAMP, used_appointment_id = $1, follow_up_logic_status = 'used', updated_at = CURRENT_TIMESTAMP
+			UPDATE follow_ups SET status = $3, free_visits_used = $4, used_at = CURRENT_TIMESTAMP, used_appointment_id = $1,
+			       follow_up_logic_status = CASE WHEN $3 = 'used' THEN 'used' ELSE follow_up_logic_status END, updated_at = CURRENT_TIMESTAMP
 			WHERE id = $2
-		`, appointment.ID, activeFollowupID.String)
+		`, appointment.ID, followUpWindow.ID, newPatientFollowupStatus, used)
 
 		tx.ExecContext(ctx, `
-			UPDATE clinic_patients SET current_followup_status = 'used', last_appointment_id = $1, last_followup_id = $2, updated_at = CURRENT_TIMESTAMP
+			UPDATE clinic_patients SET current_followup_status = $4, last_appointment_id = $1, last_followup_id = $2, updated_at = CURRENT_TIMESTAMP
 			WHERE id = $3
-		`, appointment.ID, activeFollowupID.String, input.ClinicPatientID)
+		`, appointment.ID, followUpWindow.ID, input.ClinicPatientID, newPatientFollowupStatus)
 
-		followUpID = &activeFollowupID.String
-		newPatientFollowupStatus = "used"
+		followUpID = &followUpWindow.ID
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -338,19 +353,23 @@ func CreateSimpleAppointment(c *gin.Context) {
 	}
 
 	// Efficiently build follow-up response if needed
-	if newPatientFollowupStatus == "active" && followUpID != nil {
+	if !input.IsFollowUp && newPatientFollowupStatus == "active" && followUpID != nil {
 		response["follow_up"] = gin.H{
 			"id": *followUpID, "patient_name": patientName.String, "doctor_name": "Dr. " + doctorFirst.String + " " + doctorLast.String,
-			"department_name": deptName.String, "is_free": true, "valid_until": appointmentDate.AddDate(0, 0, 5).Format(time.RFC3339),
-			"days_remaining": 5, "status": "active",
+			"department_name": deptName.String, "is_free": policy.FreeVisits > 0, "valid_until": followUpValidUntil.Format(time.RFC3339),
+			"days_remaining": policy.ValidityDays, "free_visits": policy.FreeVisits, "status": "active",
 		}
 		response["followup_granted"] = true
-		response["followup_message"] = "Free follow-up eligibility granted (valid for 5 days)"
+		response["followup_message"] = fmt.Sprintf("Free follow-up eligibility granted (%d visit(s), valid for %d days)", policy.FreeVisits, policy.ValidityDays)
 	} else if input.IsFollowUp {
+		message := map[bool]string{true: "This is a FREE follow-up", false: "This is a PAID follow-up"}[isFreeFollowUp]
+		if followUpDecision.IsDiscounted {
+			message = "This is a DISCOUNTED follow-up"
+		}
 		response["is_free_followup"] = isFreeFollowUp
 		response["follow_up_info"] = gin.H{
-			"is_followup": true, "is_free": isFreeFollowUp, "follow_up_status": "used",
-			"message": map[bool]string{true: "This is a FREE follow-up", false: "This is a PAID follow-up"}[isFreeFollowUp],
+			"is_followup": true, "is_free": isFreeFollowUp, "is_discounted": followUpDecision.IsDiscounted,
+			"follow_up_status": "used", "message": message,
 		}
 	}
 
@@ -605,3 +624,4 @@ func RescheduleSimpleAppointment(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, response)
 }
+
@@ -0,0 +1,561 @@
+package controllers
+
+import (
+	"appointment-service/config"
+	"appointment-service/middleware"
+	"appointment-service/models"
+	"appointment-service/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"shared-prescriptions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// =====================================================
+// CONSULTATION NOTES & E-PRESCRIPTIONS
+// One consultation per appointment. Drafts can be saved repeatedly;
+// finalizing locks the record and publishes the prescribed medicines
+// as an e-prescription into a linked pharmacy's queue
+// (sales_schema.prescriptions), where the pharmacy bills it through
+// POST /pharmacy/sales/draft/:rxId.
+// =====================================================
+
+type ConsultationMedicineInput struct {
+	MedicineID    *string  `json:"medicine_id" binding:"omitempty,uuid"`
+	MedicineName  string   `json:"medicine_name" binding:"required"`
+	MedicineBrand *string  `json:"medicine_brand"`
+	Dosage        *string  `json:"dosage"`
+	Frequency     *string  `json:"frequency"` // e.g. "1-0-1" (morning-noon-night)
+	Morning       *float64 `json:"morning" binding:"omitempty,min=0"`
+	Noon          *float64 `json:"noon" binding:"omitempty,min=0"`
+	Night         *float64 `json:"night" binding:"omitempty,min=0"`
+	DurationDays  int      `json:"duration_days" binding:"min=0"`
+	Quantity      int      `json:"quantity" binding:"min=0"` // auto-calculated from frequency x duration when 0
+	Instructions  *string  `json:"instructions"`
+}
+
+type SaveConsultationInput struct {
+	ChiefComplaint *string                     `json:"chief_complaint"`
+	DiagnosisCodes []string                    `json:"diagnosis_codes"`
+	Notes          *string                     `json:"notes"`
+	Advice         *string                     `json:"advice"`
+	Medicines      []ConsultationMedicineInput `json:"medicines" binding:"dive"`
+}
+
+type FinalizeConsultationInput struct {
+	PharmacyID *string `json:"pharmacy_id" binding:"omitempty,uuid"`
+}
+
+const consultationColumns = `
+	id, appointment_id, clinic_id, doctor_id, clinic_patient_id, chief_complaint,
+	diagnosis_codes, notes, advice, status, pharmacy_id, prescription_id,
+	created_by, finalized_by, finalized_at, created_at, updated_at
+`
+
+func scanConsultation(scan func(dest ...interface{}) error) (models.Consultation, error) {
+	var cons models.Consultation
+	err := scan(
+		&cons.ID, &cons.AppointmentID, &cons.ClinicID, &cons.DoctorID, &cons.ClinicPatientID, &cons.ChiefComplaint,
+		pq.Array(&cons.DiagnosisCodes), &cons.Notes, &cons.Advice, &cons.Status, &cons.PharmacyID, &cons.PrescriptionID,
+		&cons.CreatedBy, &cons.FinalizedBy, &cons.FinalizedAt, &cons.CreatedAt, &cons.UpdatedAt,
+	)
+	if cons.DiagnosisCodes == nil {
+		cons.DiagnosisCodes = []string{}
+	}
+	return cons, err
+}
+
+type rowQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func loadConsultationMedicines(ctx context.Context, q rowQuerier, consultationID string) ([]models.ConsultationMedicine, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, consultation_id, medicine_id, medicine_name, medicine_brand, dosage, frequency,
+		       morning, noon, night, duration_days, quantity, instructions, sort_order
+		FROM consultation_medicines
+		WHERE consultation_id = $1
+		ORDER BY sort_order
+	`, consultationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	medicines := make([]models.ConsultationMedicine, 0)
+	for rows.Next() {
+		var m models.ConsultationMedicine
+		if err := rows.Scan(&m.ID, &m.ConsultationID, &m.MedicineID, &m.MedicineName, &m.MedicineBrand, &m.Dosage, &m.Frequency,
+			&m.Morning, &m.Noon, &m.Night, &m.DurationDays, &m.Quantity, &m.Instructions, &m.SortOrder); err != nil {
+			return nil, err
+		}
+		medicines = append(medicines, m)
+	}
+	return medicines, rows.Err()
+}
+
+// parseFrequency reads "1-0-1" style frequencies into morning/noon/night doses
+func parseFrequency(freq string) (morning, noon, night float64, ok bool) {
+	parts := strings.Split(strings.TrimSpace(freq), "-")
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+	var doses [3]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v < 0 {
+			return 0, 0, 0, false
+		}
+		doses[i] = v
+	}
+	return doses[0], doses[1], doses[2], true
+}
+
+func buildConsultationMedicine(in ConsultationMedicineInput, order int) models.ConsultationMedicine {
+	m := models.ConsultationMedicine{
+		MedicineID:    in.MedicineID,
+		MedicineName:  strings.TrimSpace(in.MedicineName),
+		MedicineBrand: in.MedicineBrand,
+		Dosage:        in.Dosage,
+		Frequency:     in.Frequency,
+		DurationDays:  in.DurationDays,
+		Quantity:      in.Quantity,
+		Instructions:  in.Instructions,
+		SortOrder:     order,
+	}
+
+	if in.Morning != nil || in.Noon != nil || in.Night != nil {
+		if in.Morning != nil {
+			m.Morning = *in.Morning
+		}
+		if in.Noon != nil {
+			m.Noon = *in.Noon
+		}
+		if in.Night != nil {
+			m.Night = *in.Night
+		}
+	} else if in.Frequency != nil {
+		m.Morning, m.Noon, m.Night, _ = parseFrequency(*in.Frequency)
+	}
+
+	// Same rounding as the pharmacy's manual prescription entry
+	if m.Quantity == 0 && m.DurationDays > 0 {
+		perDay := m.Morning + m.Noon + m.Night
+		m.Quantity = int(math.Ceil(perDay * float64(m.DurationDays)))
+	}
+	return m
+}
+
+// GetConsultation - Get the consultation record of an appointment
+// GET /consultations/appointment/:appointment_id
+func GetConsultation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cons, err := scanConsultation(config.DB.QueryRowContext(ctx, `
+		SELECT `+consultationColumns+` FROM consultations WHERE appointment_id = $1
+	`, c.Param("appointment_id")).Scan)
+	if err == sql.ErrNoRows {
+		middleware.SendNotFoundError(c, "consultation")
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch consultation")
+		return
+	}
+
+	cons.Medicines, err = loadConsultationMedicines(ctx, config.DB, cons.ID)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch prescribed medicines")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consultation": cons})
+}
+
+// SaveConsultation - Create or update the draft consultation of an appointment.
+// Medicines are replaced as a whole on every save.
+// PUT /consultations/appointment/:appointment_id
+func SaveConsultation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	appointmentID := c.Param("appointment_id")
+
+	var input SaveConsultationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.SendValidationError(c, "Invalid input data", err.Error())
+		return
+	}
+
+	var clinicID, doctorID sql.NullString
+	var clinicPatientID sql.NullString
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT clinic_id, doctor_id, clinic_patient_id FROM appointments WHERE id = $1
+	`, appointmentID).Scan(&clinicID, &doctorID, &clinicPatientID)
+	if err == sql.ErrNoRows {
+		middleware.SendNotFoundError(c, "appointment")
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch appointment")
+		return
+	}
+	if !clinicID.Valid || !doctorID.Valid {
+		middleware.SendValidationError(c, "Appointment has no clinic or doctor assigned", nil)
+		return
+	}
+
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var consultationID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, status FROM consultations WHERE appointment_id = $1 FOR UPDATE
+	`, appointmentID).Scan(&consultationID, &status)
+	if err != nil && err != sql.ErrNoRows {
+		middleware.SendDatabaseError(c, "Failed to fetch consultation")
+		return
+	}
+	if status == models.ConsultationStatusFinalized {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Consultation finalized",
+			"message": "A finalized consultation cannot be edited",
+		})
+		return
+	}
+
+	codes, unknown, err := utils.ValidateDiagnosisCodes(ctx, tx, input.DiagnosisCodes)
+	if errors.Is(err, utils.ErrUnknownDiagnosisCodes) {
+		middleware.SendValidationError(c, "Diagnosis codes not found in the ICD-10 catalog", gin.H{"unknown_codes": unknown})
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to validate diagnosis codes")
+		return
+	}
+
+	userID := c.GetString("user_id")
+	var createdBy interface{}
+	if userID != "" {
+		createdBy = userID
+	}
+
+	cons, err := scanConsultation(tx.QueryRowContext(ctx, `
+		INSERT INTO consultations (
+			appointment_id, clinic_id, doctor_id, clinic_patient_id,
+			chief_complaint, diagnosis_codes, notes, advice, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (appointment_id) DO UPDATE
+		SET chief_complaint = EXCLUDED.chief_complaint,
+		    diagnosis_codes = EXCLUDED.diagnosis_codes,
+		    notes = EXCLUDED.notes,
+		    advice = EXCLUDED.advice,
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING `+consultationColumns,
+		appointmentID, clinicID.String, doctorID.String, clinicPatientID,
+		input.ChiefComplaint, pq.Array(codes), input.Notes, input.Advice, createdBy).Scan)
+	if err != nil {
+		log.Printf("ERROR: SaveConsultation failed: %v", err)
+		middleware.SendDatabaseError(c, "Failed to save consultation")
+		return
+	}
+
+	if err := utils.SetAppointmentDiagnoses(ctx, tx, appointmentID, &cons.ID, codes); err != nil {
+		middleware.SendDatabaseError(c, "Failed to save coded diagnoses")
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM consultation_medicines WHERE consultation_id = $1`, cons.ID); err != nil {
+		middleware.SendDatabaseError(c, "Failed to save prescribed medicines")
+		return
+	}
+
+	cons.Medicines = make([]models.ConsultationMedicine, 0, len(input.Medicines))
+	for i, in := range input.Medicines {
+		m := buildConsultationMedicine(in, i)
+		m.ConsultationID = cons.ID
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO consultation_medicines (
+				consultation_id, medicine_id, medicine_name, medicine_brand, dosage, frequency,
+				morning, noon, night, duration_days, quantity, instructions, sort_order
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id
+		`, cons.ID, m.MedicineID, m.MedicineName, m.MedicineBrand, m.Dosage, m.Frequency,
+			m.Morning, m.Noon, m.Night, m.DurationDays, m.Quantity, m.Instructions, m.SortOrder).Scan(&m.ID)
+		if err != nil {
+			log.Printf("ERROR: SaveConsultation medicine insert failed: %v", err)
+			middleware.SendDatabaseError(c, "Failed to save prescribed medicines")
+			return
+		}
+		cons.Medicines = append(cons.Medicines, m)
+	}
+
+	if err := tx.Commit(); err != nil {
+		middleware.SendDatabaseError(c, "Failed to save consultation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Consultation saved",
+		"consultation": cons,
+	})
+}
+
+// FinalizeConsultation - Lock a consultation and publish its e-prescription to a linked pharmacy.
+// Without pharmacy_id the clinic's first active linked pharmacy is used.
+// POST /consultations/:id/finalize
+func FinalizeConsultation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	var input FinalizeConsultationInput
+	// Body is optional
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		middleware.SendValidationError(c, "Invalid input data", err.Error())
+		return
+	}
+
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	cons, err := scanConsultation(tx.QueryRowContext(ctx, `
+		SELECT `+consultationColumns+` FROM consultations WHERE id = $1 FOR UPDATE
+	`, c.Param("id")).Scan)
+	if err == sql.ErrNoRows {
+		middleware.SendNotFoundError(c, "consultation")
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch consultation")
+		return
+	}
+	if cons.Status == models.ConsultationStatusFinalized {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Consultation finalized",
+			"message": "This consultation has already been finalized",
+		})
+		return
+	}
+
+	cons.Medicines, err = loadConsultationMedicines(ctx, tx, cons.ID)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch prescribed medicines")
+		return
+	}
+
+	// Resolve the pharmacy that receives the e-prescription. The pharmacy tables belong to
+	// organization-service; shared/prescriptions holds the contract for reading and writing them
+	var pharmacyID sql.NullString
+	if len(cons.Medicines) > 0 {
+		id, ok, err := prescriptions.ResolvePharmacy(ctx, tx, cons.ClinicID, input.PharmacyID)
+		if err != nil {
+			middleware.SendDatabaseError(c, "Failed to resolve linked pharmacy")
+			return
+		}
+		if input.PharmacyID != nil && !ok {
+			middleware.SendValidationError(c, "Pharmacy is not linked to this clinic or is inactive", nil)
+			return
+		}
+		pharmacyID = sql.NullString{String: id, Valid: ok}
+	}
+
+	var prescriptionID sql.NullString
+	unmatched := make([]string, 0)
+	published := 0
+
+	if pharmacyID.Valid {
+		// Match each medicine against the pharmacy's catalog; unmatched lines stay on the
+		// consultation but cannot be billed from the pharmacy queue.
+		rx := &prescriptions.Prescription{
+			PharmacyID:     pharmacyID.String,
+			Source:         prescriptions.SourceConsultation,
+			ClinicID:       &cons.ClinicID,
+			AppointmentID:  &cons.AppointmentID,
+			ConsultationID: &cons.ID,
+		}
+		matched := make([]models.ConsultationMedicine, 0, len(cons.Medicines))
+		for _, m := range cons.Medicines {
+			productID, ok, err := prescriptions.MatchProduct(ctx, tx, pharmacyID.String, m.MedicineID, m.MedicineName, m.MedicineBrand)
+			if err != nil {
+				middleware.SendDatabaseError(c, "Failed to match medicines with pharmacy inventory")
+				return
+			}
+			if !ok {
+				unmatched = append(unmatched, m.MedicineName)
+				continue
+			}
+			rx.Items = append(rx.Items, prescriptions.Item{
+				ProductID:     productID,
+				MedicineName:  m.MedicineName,
+				MedicineBrand: stringValue(m.MedicineBrand),
+				Quantity:      m.Quantity,
+				DurationDays:  m.DurationDays,
+				Dosage:        stringValue(m.Dosage),
+				Morning:       m.Morning,
+				Noon:          m.Noon,
+				Night:         m.Night,
+				Instructions:  stringValue(m.Instructions),
+			})
+			matched = append(matched, m)
+		}
+
+		if len(rx.Items) > 0 {
+			var tokenNo, patientName, patientPhone, doctorName, allergies sql.NullString
+			err := tx.QueryRowContext(ctx, `
+				SELECT
+					COALESCE(a.display_token, a.token_number::text),
+					COALESCE(cp.first_name || ' ' || cp.last_name, cp.first_name, 'Unknown'),
+					cp.phone,
+					COALESCE(u.first_name || ' ' || u.last_name, u.first_name, 'Unknown Doctor'),
+					NULLIF(TRIM(cp.allergies), '')
+				FROM appointments a
+				LEFT JOIN clinic_patients cp ON cp.id = a.clinic_patient_id
+				LEFT JOIN doctors d ON d.id = a.doctor_id
+				LEFT JOIN users u ON u.id = d.user_id
+				WHERE a.id = $1
+			`, cons.AppointmentID).Scan(&tokenNo, &patientName, &patientPhone, &doctorName, &allergies)
+			if err != nil {
+				middleware.SendDatabaseError(c, "Failed to fetch appointment details")
+				return
+			}
+
+			// Published through the same insert as prescriptions entered at the pharmacy. Allergies
+			// travel with the e-prescription so the pharmacy's drug safety checks run when it is billed.
+			rx.TokenNo, rx.PatientName, rx.PatientPhone = tokenNo.String, patientName.String, patientPhone.String
+			rx.DoctorName, rx.PatientAllergies = doctorName.String, allergies.String
+			if err := prescriptions.Insert(ctx, tx, rx); err != nil {
+				log.Printf("ERROR: FinalizeConsultation prescription insert failed: %v", err)
+				middleware.SendDatabaseError(c, "Failed to publish e-prescription")
+				return
+			}
+			prescriptionID = sql.NullString{String: rx.ID, Valid: true}
+
+			for i, m := range matched {
+				if _, err := tx.ExecContext(ctx, `
+					UPDATE consultation_medicines SET medicine_id = $1 WHERE id = $2
+				`, rx.Items[i].ProductID, m.ID); err != nil {
+					middleware.SendDatabaseError(c, "Failed to publish e-prescription")
+					return
+				}
+			}
+			published = len(rx.Items)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	var finalizedBy interface{}
+	if userID != "" {
+		finalizedBy = userID
+	}
+
+	cons, err = scanConsultation(tx.QueryRowContext(ctx, `
+		UPDATE consultations
+		SET status = $1, pharmacy_id = $2, prescription_id = $3,
+		    finalized_by = $4, finalized_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+		RETURNING `+consultationColumns,
+		models.ConsultationStatusFinalized, pharmacyID, prescriptionID, finalizedBy, cons.ID).Scan)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to finalize consultation")
+		return
+	}
+
+	cons.Medicines, err = loadConsultationMedicines(ctx, tx, cons.ID)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch prescribed medicines")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		middleware.SendDatabaseError(c, "Failed to finalize consultation")
+		return
+	}
+
+	response := gin.H{
+		"message":      "Consultation finalized",
+		"consultation": cons,
+	}
+	if len(cons.Medicines) > 0 {
+		response["prescription"] = gin.H{
+			"published":           prescriptionID.Valid,
+			"prescription_id":     cons.PrescriptionID,
+			"pharmacy_id":         cons.PharmacyID,
+			"items_published":     published,
+			"unmatched_medicines": unmatched,
+		}
+		if !pharmacyID.Valid {
+			response["message"] = "Consultation finalized; no linked pharmacy, e-prescription not published"
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListPatientConsultations - Consultation history of a clinic patient, newest first
+// GET /consultations/patient/:clinic_patient_id
+func ListPatientConsultations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT `+consultationColumns+`
+		FROM consultations
+		WHERE clinic_patient_id = $1
+		ORDER BY created_at DESC
+		LIMIT 50
+	`, c.Param("clinic_patient_id"))
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch consultations")
+		return
+	}
+	defer rows.Close()
+
+	consultations := make([]models.Consultation, 0)
+	for rows.Next() {
+		cons, err := scanConsultation(rows.Scan)
+		if err != nil {
+			middleware.SendDatabaseError(c, "Failed to read consultations")
+			return
+		}
+		consultations = append(consultations, cons)
+	}
+	rows.Close()
+
+	for i := range consultations {
+		consultations[i].Medicines, err = loadConsultationMedicines(ctx, config.DB, consultations[i].ID)
+		if err != nil {
+			middleware.SendDatabaseError(c, "Failed to fetch prescribed medicines")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": len(consultations), "consultations": consultations})
+}
+
+// stringValue returns the pointed-to string, or "" for nil
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
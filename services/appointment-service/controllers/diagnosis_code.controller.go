@@ -0,0 +1,421 @@
+package controllers
+
+import (
+	"appointment-service/config"
+	"appointment-service/middleware"
+	"appointment-service/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =====================================================
+// ICD-10 DIAGNOSIS CODE APIs
+// Catalog import, prefix/fuzzy search, clinic favourites and
+// coded diagnoses on appointments
+// =====================================================
+
+type FavouriteDiagnosisInput struct {
+	ClinicID string `json:"clinic_id" binding:"required,uuid"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type SetAppointmentDiagnosesInput struct {
+	Codes []string `json:"codes"` // first code is the primary diagnosis
+}
+
+type diagnosisSearchResult struct {
+	utils.DiagnosisCode
+	IsFavourite bool `json:"is_favourite"`
+}
+
+// ImportDiagnosisCodes - Load or refresh the ICD-10 catalog from an uploaded CSV
+// POST /diagnosis-codes/import (multipart form field "file")
+func ImportDiagnosisCodes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+	defer cancel()
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		middleware.SendValidationError(c, "CSV file is required in form field 'file'", nil)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		middleware.SendValidationError(c, "Unable to read uploaded file", err.Error())
+		return
+	}
+	defer file.Close()
+
+	codes, skipped, err := utils.ParseDiagnosisCSV(file)
+	if err != nil {
+		middleware.SendValidationError(c, "Invalid CSV file", err.Error())
+		return
+	}
+	if len(codes) == 0 {
+		middleware.SendValidationError(c, "No valid ICD-10 codes found in file", gin.H{"skipped": skipped})
+		return
+	}
+
+	imported, err := utils.ImportDiagnosisCodes(ctx, config.DB, codes)
+	if err != nil {
+		log.Printf("ERROR: ImportDiagnosisCodes failed: %v", err)
+		middleware.SendDatabaseError(c, "Failed to import diagnosis codes")
+		return
+	}
+
+	// Keep the response small for full catalog imports
+	if len(skipped) > 50 {
+		skipped = skipped[:50]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Diagnosis codes imported",
+		"parsed":   len(codes),
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
+
+// SearchDiagnosisCodes - Search the catalog by code prefix or description.
+// Queries shaped like a code ("J06", "j06.9") match by prefix; anything else matches
+// descriptions by substring and trigram similarity. Clinic favourites rank first.
+// GET /diagnosis-codes/search?q=fever&clinic_id=xxx&limit=20
+func SearchDiagnosisCodes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	q := strings.TrimSpace(c.Query("q"))
+	if len(q) < 2 {
+		middleware.SendValidationError(c, "q must be at least 2 characters", nil)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var clinicID interface{}
+	if id := c.Query("clinic_id"); id != "" {
+		clinicID = id
+	}
+
+	var rows *sql.Rows
+	if prefix, ok := diagnosisCodePrefix(q); ok {
+		rows, err = config.DB.QueryContext(ctx, `
+			SELECT d.code, d.description, d.category_code, d.category_description, d.is_billable,
+			       (f.code IS NOT NULL) AS is_favourite
+			FROM diagnosis_codes d
+			LEFT JOIN clinic_diagnosis_favourites f ON f.code = d.code AND f.clinic_id = $2
+			WHERE d.is_active = true AND d.code LIKE $1 || '%'
+			ORDER BY (f.code IS NOT NULL) DESC, length(d.code), d.code
+			LIMIT $3
+		`, prefix, clinicID, limit)
+	} else {
+		rows, err = config.DB.QueryContext(ctx, `
+			SELECT d.code, d.description, d.category_code, d.category_description, d.is_billable,
+			       (f.code IS NOT NULL) AS is_favourite
+			FROM diagnosis_codes d
+			LEFT JOIN clinic_diagnosis_favourites f ON f.code = d.code AND f.clinic_id = $2
+			WHERE d.is_active = true
+			  AND (d.description ILIKE '%' || $1 || '%' OR d.description % $1)
+			ORDER BY (f.code IS NOT NULL) DESC,
+			         (d.description ILIKE $1 || '%') DESC,
+			         similarity(d.description, $1) DESC,
+			         d.is_billable DESC,
+			         d.code
+			LIMIT $3
+		`, q, clinicID, limit)
+	}
+	if err != nil {
+		log.Printf("ERROR: SearchDiagnosisCodes failed: %v", err)
+		middleware.SendDatabaseError(c, "Failed to search diagnosis codes")
+		return
+	}
+	defer rows.Close()
+
+	results, err := scanDiagnosisResults(rows)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to read diagnosis codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": q, "total": len(results), "codes": results})
+}
+
+// diagnosisCodePrefix returns the dotted prefix for code-shaped queries ("j0" -> "J0", "J069" -> "J06.9")
+func diagnosisCodePrefix(q string) (string, bool) {
+	compact := strings.ToUpper(strings.Replace(q, ".", "", 1))
+	if len(compact) < 2 || compact[0] < 'A' || compact[0] > 'Z' || compact[1] < '0' || compact[1] > '9' {
+		return "", false
+	}
+	for _, r := range compact[2:] {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z') {
+			return "", false
+		}
+	}
+	if len(compact) <= 3 {
+		return compact, true
+	}
+	return compact[:3] + "." + compact[3:], true
+}
+
+func scanDiagnosisResults(rows *sql.Rows) ([]diagnosisSearchResult, error) {
+	results := make([]diagnosisSearchResult, 0)
+	for rows.Next() {
+		var r diagnosisSearchResult
+		if err := rows.Scan(&r.Code, &r.Description, &r.CategoryCode, &r.CategoryDescription, &r.IsBillable, &r.IsFavourite); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// GetDiagnosisCode - Get one catalog entry
+// GET /diagnosis-codes/:code
+func GetDiagnosisCode(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	code, ok := utils.NormalizeDiagnosisCode(c.Param("code"))
+	if !ok {
+		middleware.SendValidationError(c, "Invalid ICD-10 code", nil)
+		return
+	}
+
+	var d utils.DiagnosisCode
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT code, description, category_code, category_description, is_billable
+		FROM diagnosis_codes WHERE code = $1
+	`, code).Scan(&d.Code, &d.Description, &d.CategoryCode, &d.CategoryDescription, &d.IsBillable)
+	if err == sql.ErrNoRows {
+		middleware.SendNotFoundError(c, "diagnosis code")
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch diagnosis code")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": d})
+}
+
+// ListFavouriteDiagnoses - A clinic's favourite diagnosis codes
+// GET /diagnosis-codes/favourites?clinic_id=xxx
+func ListFavouriteDiagnoses(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	clinicID := c.Query("clinic_id")
+	if clinicID == "" {
+		middleware.SendValidationError(c, "clinic_id is required", nil)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT d.code, d.description, d.category_code, d.category_description, d.is_billable, true
+		FROM clinic_diagnosis_favourites f
+		JOIN diagnosis_codes d ON d.code = f.code
+		WHERE f.clinic_id = $1
+		ORDER BY d.code
+	`, clinicID)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch favourite diagnoses")
+		return
+	}
+	defer rows.Close()
+
+	results, err := scanDiagnosisResults(rows)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to read favourite diagnoses")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": len(results), "codes": results})
+}
+
+// AddFavouriteDiagnosis - Add a code to a clinic's favourites
+// POST /diagnosis-codes/favourites
+func AddFavouriteDiagnosis(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	var input FavouriteDiagnosisInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.SendValidationError(c, "Invalid input data", err.Error())
+		return
+	}
+	code, ok := utils.NormalizeDiagnosisCode(input.Code)
+	if !ok {
+		middleware.SendValidationError(c, "Invalid ICD-10 code", nil)
+		return
+	}
+
+	var createdBy interface{}
+	if userID := c.GetString("user_id"); userID != "" {
+		createdBy = userID
+	}
+
+	res, err := config.DB.ExecContext(ctx, `
+		INSERT INTO clinic_diagnosis_favourites (clinic_id, code, created_by)
+		SELECT $1, code, $3 FROM diagnosis_codes WHERE code = $2 AND is_active = true
+		ON CONFLICT DO NOTHING
+	`, input.ClinicID, code, createdBy)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to add favourite diagnosis")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		config.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM diagnosis_codes WHERE code = $1 AND is_active = true)`, code).Scan(&exists)
+		if !exists {
+			middleware.SendNotFoundError(c, "diagnosis code")
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Favourite diagnosis added", "code": code})
+}
+
+// RemoveFavouriteDiagnosis - Remove a code from a clinic's favourites
+// DELETE /diagnosis-codes/favourites/:code?clinic_id=xxx
+func RemoveFavouriteDiagnosis(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	clinicID := c.Query("clinic_id")
+	if clinicID == "" {
+		middleware.SendValidationError(c, "clinic_id is required", nil)
+		return
+	}
+	code, ok := utils.NormalizeDiagnosisCode(c.Param("code"))
+	if !ok {
+		middleware.SendValidationError(c, "Invalid ICD-10 code", nil)
+		return
+	}
+
+	res, err := config.DB.ExecContext(ctx, `
+		DELETE FROM clinic_diagnosis_favourites WHERE clinic_id = $1 AND code = $2
+	`, clinicID, code)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to remove favourite diagnosis")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		middleware.SendNotFoundError(c, "favourite diagnosis")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Favourite diagnosis removed"})
+}
+
+// GetAppointmentDiagnoses - Coded diagnoses of an appointment
+// GET /appointments/:id/diagnoses
+func GetAppointmentDiagnoses(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT d.code, d.description, d.category_code, d.category_description, d.is_billable, ad.is_primary
+		FROM appointment_diagnoses ad
+		JOIN diagnosis_codes d ON d.code = ad.code
+		WHERE ad.appointment_id = $1
+		ORDER BY ad.is_primary DESC, ad.created_at
+	`, c.Param("id"))
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch appointment diagnoses")
+		return
+	}
+	defer rows.Close()
+
+	diagnoses := make([]gin.H, 0)
+	for rows.Next() {
+		var d utils.DiagnosisCode
+		var isPrimary bool
+		if err := rows.Scan(&d.Code, &d.Description, &d.CategoryCode, &d.CategoryDescription, &d.IsBillable, &isPrimary); err != nil {
+			middleware.SendDatabaseError(c, "Failed to read appointment diagnoses")
+			return
+		}
+		diagnoses = append(diagnoses, gin.H{
+			"code":                 d.Code,
+			"description":          d.Description,
+			"category_code":        d.CategoryCode,
+			"category_description": d.CategoryDescription,
+			"is_primary":           isPrimary,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"appointment_id": c.Param("id"), "diagnoses": diagnoses})
+}
+
+// SetAppointmentDiagnoses - Code the diagnoses of an appointment that has no consultation record.
+// Appointments with a consultation take their codes from it.
+// PUT /appointments/:id/diagnoses
+func SetAppointmentDiagnoses(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	appointmentID := c.Param("id")
+
+	var input SetAppointmentDiagnosesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.SendValidationError(c, "Invalid input data", err.Error())
+		return
+	}
+
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	var appointmentExists, hasConsultation bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM appointments WHERE id = $1),
+			EXISTS(SELECT 1 FROM consultations WHERE appointment_id = $1)
+	`, appointmentID).Scan(&appointmentExists, &hasConsultation); err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch appointment")
+		return
+	}
+	if !appointmentExists {
+		middleware.SendNotFoundError(c, "appointment")
+		return
+	}
+	if hasConsultation {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Consultation exists",
+			"message": "This appointment has a consultation record; update diagnoses there",
+		})
+		return
+	}
+
+	codes, unknown, err := utils.ValidateDiagnosisCodes(ctx, tx, input.Codes)
+	if errors.Is(err, utils.ErrUnknownDiagnosisCodes) {
+		middleware.SendValidationError(c, "Diagnosis codes not found in the ICD-10 catalog", gin.H{"unknown_codes": unknown})
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to validate diagnosis codes")
+		return
+	}
+
+	if err := utils.SetAppointmentDiagnoses(ctx, tx, appointmentID, nil, codes); err != nil {
+		middleware.SendDatabaseError(c, "Failed to save appointment diagnoses")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		middleware.SendDatabaseError(c, "Failed to save appointment diagnoses")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Appointment diagnoses saved", "codes": codes})
+}
@@ -2,14 +2,18 @@ package controllers
 
 import (
 	"appointment-service/config"
+	"appointment-service/scheduler"
 	"appointment-service/utils"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"shared-followup"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -30,13 +34,17 @@ func init() {
 
 // FollowUpEligibilityResponse represents the response structure
 type FollowUpEligibilityResponse struct {
-	Eligible       bool    `json:"eligible"`
-	IsFree         bool    `json:"is_free"`
-	Message        string  `json:"message"`
-	ValidUntil     *string `json:"valid_until,omitempty"`
-	DaysRemaining  *int    `json:"days_remaining,omitempty"`
-	DoctorName     *string `json:"doctor_name,omitempty"`
-	DepartmentName *string `json:"department_name,omitempty"`
+	Eligible       bool     `json:"eligible"`
+	IsFree         bool     `json:"is_free"`
+	IsDiscounted   bool     `json:"is_discounted"`
+	DiscountedFee  *float64 `json:"discounted_fee,omitempty"`
+	FreeVisitsLeft int      `json:"free_visits_left"`
+	Message        string   `json:"message"`
+	ValidUntil     *string  `json:"valid_until,omitempty"`
+	DaysRemaining  *int     `json:"days_remaining,omitempty"`
+	DoctorName     *string  `json:"doctor_name,omitempty"`
+	DepartmentName *string  `json:"department_name,omitempty"`
+	PolicyScope    string   `json:"policy_scope"`
 }
 
 // ActiveFollowUpItem represents a single active follow-up
@@ -47,6 +55,7 @@ type ActiveFollowUpItem struct {
 	DepartmentID   *string `json:"department_id,omitempty"`
 	DepartmentName *string `json:"department_name,omitempty"`
 	IsFree         bool    `json:"is_free"`
+	FreeVisitsLeft int     `json:"free_visits_left"`
 	ValidFrom      string  `json:"valid_from"`
 	ValidUntil     string  `json:"valid_until"`
 	DaysRemaining  int     `json:"days_remaining"`
@@ -54,7 +63,7 @@ type ActiveFollowUpItem struct {
 }
 
 // CheckFollowUpEligibility - Check if patient is eligible for follow-up with specific doctor+department
-// GET /appointments/followup-eligibility?clinic_patient_id=xxx&clinic_id=xxx&doctor_id=xxx&department_id=xxx
+// GET /appointments/followup-eligibility?clinic_patient_id=xxx&clinic_id=xxx&doctor_id=xxx&department_id=xxx&consultation_type=xxx
 func CheckFollowUpEligibility(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
@@ -69,106 +78,91 @@ func CheckFollowUpEligibility(c *gin.Context) {
 		return
 	}
 
+	var deptID *string
+	if departmentID != "" {
+		deptID = &departmentID
+	}
+
 	// 1. Follow-up Eligibility Logic
 	// Expiration is handled by a background worker/cron job to keep the API fast.
 	followUpMgr := &utils.FollowUpManager{DB: config.DB}
-	_ = followUpMgr // keep for future use in transactional context if needed
+	policy := followUpMgr.LoadPolicy(ctx, clinicID, doctorID, deptID)
 
-	var response FollowUpEligibilityResponse
-	response.Eligible = false
-	response.IsFree = false
-	response.Message = "No previous appointment found with this doctor"
+	req := followup.Request{
+		Policy:   policy,
+		ViaVideo: c.Query("consultation_type") == followup.TypeFollowUpVideo,
+		Now:      time.Now().In(locISTFollowUp),
+	}
 
-	// 2. Check for active free follow-up WITH doctor/department details in one query
+	// 2. Latest follow-up windows with the doctor; the policy decides whether
+	// windows from other departments count
 	var (
-		fid, status string
-		isFree      bool
-		validUntil  time.Time
-		docName     sql.NullString
-		deptName    sql.NullString
+		docName  sql.NullString
+		deptName sql.NullString
+		err      error
 	)
-
-	query := `
-		SELECT 
-			f.id, f.status, f.is_free, f.valid_until,
-			COALESCE(u.first_name || ' ' || u.last_name, u.first_name) as doctor_name,
-			dept.name as department_name
-		FROM follow_ups f
-		JOIN doctors d ON d.id = f.doctor_id
-		JOIN users u ON u.id = d.user_id
-		LEFT JOIN departments dept ON dept.id = f.department_id
-		WHERE f.clinic_patient_id = $1 AND f.clinic_id = $2 AND f.doctor_id = $3
-	`
-	args := []interface{}{clinicPatientID, clinicID, doctorID}
-	argIdx := 4
-	if departmentID != "" {
-		query += fmt.Sprintf(" AND f.department_id = $%d", argIdx)
-		args = append(args, departmentID)
-		argIdx++
-	} else {
-		query += ` AND f.department_id IS NULL`
+	req.Latest, req.LatestAnyDepartment, err = followup.LoadWindows(ctx, config.DB, clinicPatientID, clinicID, doctorID, deptID)
+	if err != nil {
+		log.Printf("ERROR: CheckFollowUpEligibility lookup failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check follow-up eligibility"})
+		return
 	}
-	query += ` ORDER BY f.created_at DESC LIMIT 1`
-
-	now := time.Now().In(locISTFollowUp)
-	err := config.DB.QueryRowContext(ctx, query, args...).Scan(&fid, &status, &isFree, &validUntil, &docName, &deptName)
-
-	if err == nil {
-		// Found a follow-up record
-		if status == "active" && validUntil.After(now) {
-			response.Eligible = true
-			response.IsFree = isFree
-			if isFree {
-				daysRemaining := int(validUntil.Sub(now).Hours() / 24)
-				if daysRemaining < 0 {
-					daysRemaining = 0
-				}
-				response.Message = fmt.Sprintf("Free follow-up available (%d days remaining)", daysRemaining)
-				vUntil := validUntil.Format("2006-01-02")
-				response.ValidUntil = &vUntil
-				response.DaysRemaining = &daysRemaining
-			} else {
-				response.Message = "Follow-up available (payment required)"
-			}
-		} else if status == "expired" || (status == "active" && validUntil.Before(now)) {
-			response.Eligible = true
-			response.Message = "Free follow-up expired. This follow-up requires payment."
-		} else if status == "used" {
-			response.Eligible = true
-			response.Message = "Free follow-up already used. This follow-up requires payment."
+	if req.Window() != nil {
+		err = config.DB.QueryRowContext(ctx, `
+			SELECT COALESCE(u.first_name || ' ' || u.last_name, u.first_name),
+			       (SELECT name FROM departments WHERE id = $2)
+			FROM doctors d
+			JOIN users u ON u.id = d.user_id
+			WHERE d.id = $1
+		`, doctorID, deptID).Scan(&docName, &deptName)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("ERROR: CheckFollowUpEligibility lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check follow-up eligibility"})
+			return
 		}
+	}
 
-		if docName.Valid {
-			response.DoctorName = &docName.String
-		}
-		if deptName.Valid {
-			response.DepartmentName = &deptName.String
+	// 3. Without a follow-up record, ANY completed appointment allows a paid follow-up
+	if req.Window() == nil {
+		checkQuery := `
+			SELECT EXISTS(
+				SELECT 1 FROM appointments
+				WHERE clinic_patient_id = $1 AND clinic_id = $2 AND doctor_id = $3
+				AND consultation_type IN ('clinic_visit', 'video_consultation')
+				AND status IN ('completed', 'confirmed')
+		`
+		checkArgs := []interface{}{clinicPatientID, clinicID, doctorID}
+		if departmentID != "" {
+			checkQuery += ` AND department_id = $4`
+			checkArgs = append(checkArgs, departmentID)
 		}
+		checkQuery += `)`
 
-		c.JSON(http.StatusOK, gin.H{"eligibility": response})
-		return
+		_ = config.DB.QueryRowContext(ctx, checkQuery, checkArgs...).Scan(&req.HasPreviousVisit)
 	}
 
-	// 3. If no follow-up record found, check for ANY completed appointment to allow paid follow-up
-	var exists bool
-	checkQuery := `
-		SELECT EXISTS(
-			SELECT 1 FROM appointments
-			WHERE clinic_patient_id = $1 AND clinic_id = $2 AND doctor_id = $3
-			AND consultation_type IN ('clinic_visit', 'video_consultation')
-			AND status IN ('completed', 'confirmed')
-	`
-	checkArgs := []interface{}{clinicPatientID, clinicID, doctorID}
-	if departmentID != "" {
-		checkQuery += ` AND department_id = $4`
-		checkArgs = append(checkArgs, departmentID)
-	}
-	checkQuery += `)`
+	decision := followup.Evaluate(req)
 
-	err = config.DB.QueryRowContext(ctx, checkQuery, checkArgs...).Scan(&exists)
-	if err == nil && exists {
-		response.Eligible = true
-		response.Message = "Follow-up available (payment required)"
+	response := FollowUpEligibilityResponse{
+		Eligible:       decision.Eligible,
+		IsFree:         decision.IsFree,
+		IsDiscounted:   decision.IsDiscounted,
+		DiscountedFee:  decision.DiscountedFee,
+		FreeVisitsLeft: decision.FreeVisitsLeft,
+		Message:        decision.Message,
+		PolicyScope:    policy.Scope(),
+	}
+	if decision.ValidUntil != nil && (decision.IsFree || decision.IsDiscounted) {
+		vUntil := decision.ValidUntil.Format("2006-01-02")
+		daysRemaining := decision.DaysRemaining
+		response.ValidUntil = &vUntil
+		response.DaysRemaining = &daysRemaining
+	}
+	if docName.Valid {
+		response.DoctorName = &docName.String
+	}
+	if deptName.Valid {
+		response.DepartmentName = &deptName.String
 	}
 
 	c.JSON(http.StatusOK, gin.H{"eligibility": response})
@@ -194,7 +188,7 @@ func ListActiveFollowUps(c *gin.Context) {
 			f.id, f.doctor_id, 
 			COALESCE(u.first_name || ' ' || u.last_name, u.first_name) as doctor_name,
 			f.department_id, dept.name as department_name,
-			f.is_free, f.valid_from, f.valid_until
+			f.is_free, GREATEST(f.free_visits_total - f.free_visits_used, 0), f.valid_from, f.valid_until
 		FROM follow_ups f
 		JOIN doctors d ON d.id = f.doctor_id
 		JOIN users u ON u.id = d.user_id
@@ -220,7 +214,7 @@ func ListActiveFollowUps(c *gin.Context) {
 		if err := rows.Scan(
 			&item.FollowUpID, &item.DoctorID, &item.DoctorName,
 			&item.DepartmentID, &item.DepartmentName,
-			&item.IsFree, &validFrom, &validUntil,
+			&item.IsFree, &item.FreeVisitsLeft, &validFrom, &validUntil,
 		); err != nil {
 			continue
 		}
@@ -234,6 +228,9 @@ func ListActiveFollowUps(c *gin.Context) {
 		item.ValidUntil = validUntil.Format("2006-01-02")
 		item.DaysRemaining = daysRemaining
 		item.Message = "Free follow-up available"
+		if item.FreeVisitsLeft > 1 {
+			item.Message = fmt.Sprintf("%d free follow-ups available", item.FreeVisitsLeft)
+		}
 		if !item.IsFree {
 			item.Message = "Follow-up available (payment required)"
 		}
@@ -251,13 +248,28 @@ func ListActiveFollowUps(c *gin.Context) {
 	})
 }
 
-// ExpireOldFollowUps - Manually trigger expiration of old follow-ups
+// ExpireOldFollowUps - Manually trigger expiration of old follow-ups.
+// Expiry normally runs as the followup-expiry scheduled job; this runs it now and records the run.
 func ExpireOldFollowUps(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 	defer cancel()
 
-	followUpMgr := &utils.FollowUpManager{DB: config.DB}
-	count, err := followUpMgr.ExpireOldFollowUpsContext(ctx)
+	var count int64
+	var err error
+	if jobScheduler != nil {
+		var run *scheduler.JobRun
+		run, err = jobScheduler.Trigger(ctx, scheduler.JobFollowUpExpiry)
+		if run != nil {
+			count = run.AffectedRows
+		}
+	} else {
+		followUpMgr := &utils.FollowUpManager{DB: config.DB}
+		count, err = followUpMgr.ExpireOldFollowUpsContext(ctx)
+	}
+	if errors.Is(err, scheduler.ErrJobRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Follow-up expiry is already running"})
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR: ExpireOldFollowUps failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire old follow-ups"})
@@ -268,5 +280,4 @@ func ExpireOldFollowUps(c *gin.Context) {
 		"message":       "Successfully expired old follow-ups",
 		"expired_count": count,
 	})
-	_ = ctx // avoid unused
 }
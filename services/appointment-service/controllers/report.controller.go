@@ -386,3 +386,114 @@ func HealthCheck(c *gin.Context) {
 		"time":    time.Now(),
 	})
 }
+
+// GetDiagnosisCategoryReport - Visits per ICD-10 category, broken down by doctor or department.
+// Counts distinct appointments per category; only the primary diagnosis is counted unless all=true.
+// GET /reports/diagnosis-categories?clinic_id=xxx&group_by=doctor|department&start_date=...&end_date=...
+func GetDiagnosisCategoryReport(c *gin.Context) {
+	clinicID := c.Query("clinic_id")
+	if clinicID == "" {
+		clinicID = c.GetString("clinic_id")
+	}
+	if clinicID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "clinic_id is required"})
+		return
+	}
+
+	groupBy := c.DefaultQuery("group_by", "doctor")
+	if groupBy != "doctor" && groupBy != "department" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be doctor or department"})
+		return
+	}
+	allDiagnoses := c.Query("all") == "true"
+
+	startDateStr := c.DefaultQuery("start_date", time.Now().AddDate(0, 0, -30).Format("2006-01-02"))
+	endDateStr := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD"})
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	groupSelect := `a.doctor_id::text, COALESCE(du.first_name || ' ' || du.last_name, du.first_name, 'Unknown Doctor')`
+	groupJoin := `LEFT JOIN doctors d ON d.id = a.doctor_id LEFT JOIN users du ON du.id = d.user_id`
+	groupCols := `a.doctor_id, du.first_name, du.last_name`
+	if groupBy == "department" {
+		groupSelect = `COALESCE(a.department_id::text, ''), COALESCE(dept.name, 'No Department')`
+		groupJoin = `LEFT JOIN departments dept ON dept.id = a.department_id`
+		groupCols = `a.department_id, dept.name`
+	}
+
+	query := fmt.Sprintf(`
+        SELECT %s,
+               dc.category_code,
+               COALESCE(dc.category_description, MIN(dc.description)) AS category_description,
+               COUNT(DISTINCT a.id) AS visits
+        FROM appointment_diagnoses ad
+        JOIN appointments a ON a.id = ad.appointment_id
+        JOIN diagnosis_codes dc ON dc.code = ad.code
+        %s
+        WHERE a.clinic_id = $1
+          AND a.appointment_date BETWEEN $2 AND $3
+          AND a.status NOT IN ('cancelled', 'no_show')
+          AND ($4 OR ad.is_primary)
+        GROUP BY %s, dc.category_code, dc.category_description
+        ORDER BY 2, visits DESC, dc.category_code
+    `, groupSelect, groupJoin, groupCols)
+
+	rows, err := config.DB.Query(query, clinicID, startDate, endDate, allDiagnoses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	groups := make([]gin.H, 0)
+	index := make(map[string]int)
+	totalVisits := 0
+	for rows.Next() {
+		var groupID, groupName, categoryCode string
+		var categoryDescription *string
+		var visits int
+		if err := rows.Scan(&groupID, &groupName, &categoryCode, &categoryDescription, &visits); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		i, ok := index[groupID]
+		if !ok {
+			i = len(groups)
+			index[groupID] = i
+			groups = append(groups, gin.H{
+				groupBy + "_id":   groupID,
+				groupBy + "_name": groupName,
+				"total_visits":    0,
+				"categories":      []gin.H{},
+			})
+		}
+		groups[i]["total_visits"] = groups[i]["total_visits"].(int) + visits
+		groups[i]["categories"] = append(groups[i]["categories"].([]gin.H), gin.H{
+			"category_code":        categoryCode,
+			"category_description": categoryDescription,
+			"visits":               visits,
+		})
+		totalVisits += visits
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report_type":  "diagnosis_categories",
+		"clinic_id":    clinicID,
+		"group_by":     groupBy,
+		"start_date":   startDateStr,
+		"end_date":     endDateStr,
+		"primary_only": !allDiagnoses,
+		"groups":       groups,
+		"count":        len(groups),
+		"total_visits": totalVisits,
+	})
+}
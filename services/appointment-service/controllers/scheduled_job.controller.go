@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"appointment-service/middleware"
+	"appointment-service/scheduler"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =====================================================
+// SCHEDULED JOB ADMIN APIs
+// List, trigger, pause and resume the in-process background jobs
+// =====================================================
+
+var jobScheduler *scheduler.Scheduler
+
+// SetScheduler wires the running scheduler into the job admin endpoints
+func SetScheduler(s *scheduler.Scheduler) {
+	jobScheduler = s
+}
+
+func requireScheduler(c *gin.Context) bool {
+	if jobScheduler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Scheduler disabled",
+			"message": "Background job scheduler is not running on this instance",
+		})
+		return false
+	}
+	return true
+}
+
+func sendJobError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		middleware.SendNotFoundError(c, "scheduled job")
+	case errors.Is(err, scheduler.ErrJobRunning):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Job running",
+			"message": "This job is already running; try again once it finishes",
+		})
+	default:
+		middleware.SendDatabaseError(c, message)
+	}
+}
+
+// ListScheduledJobs - List background jobs with schedule, pause state and last/next run
+// GET /admin/jobs
+func ListScheduledJobs(c *gin.Context) {
+	if !requireScheduler(c) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	jobs, err := jobScheduler.States(ctx)
+	if err != nil {
+		sendJobError(c, err, "Failed to fetch scheduled jobs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     len(jobs),
+		"jobs":      jobs,
+		"instance":  jobScheduler.InstanceID(),
+		"is_leader": jobScheduler.IsLeader(),
+	})
+}
+
+// GetScheduledJobRuns - Run history of a background job
+// GET /admin/jobs/:name/runs?limit=20
+func GetScheduledJobRuns(c *gin.Context) {
+	if !requireScheduler(c) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 200 {
+		middleware.SendValidationError(c, "limit must be between 1 and 200", nil)
+		return
+	}
+
+	runs, err := jobScheduler.Runs(ctx, c.Param("name"), limit)
+	if err != nil {
+		sendJobError(c, err, "Failed to fetch job runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": len(runs), "runs": runs})
+}
+
+// TriggerScheduledJob - Run a background job now on this instance
+// POST /admin/jobs/:name/trigger
+func TriggerScheduledJob(c *gin.Context) {
+	if !requireScheduler(c) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+	defer cancel()
+
+	run, err := jobScheduler.Trigger(ctx, c.Param("name"))
+	if err != nil && run == nil {
+		sendJobError(c, err, "Failed to trigger job")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Job failed",
+			"message": err.Error(),
+			"run":     run,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Job completed", "run": run})
+}
+
+// PauseScheduledJob - Stop scheduled runs of a job on every instance (manual triggers still work)
+// POST /admin/jobs/:name/pause
+func PauseScheduledJob(c *gin.Context) {
+	setScheduledJobPaused(c, true)
+}
+
+// ResumeScheduledJob - Resume scheduled runs of a paused job
+// POST /admin/jobs/:name/resume
+func ResumeScheduledJob(c *gin.Context) {
+	setScheduledJobPaused(c, false)
+}
+
+func setScheduledJobPaused(c *gin.Context, paused bool) {
+	if !requireScheduler(c) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	job, err := jobScheduler.SetPaused(ctx, c.Param("name"), paused)
+	if err != nil {
+		sendJobError(c, err, "Failed to update job")
+		return
+	}
+
+	message := "Job resumed"
+	if paused {
+		message = "Job paused"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "job": job})
+}
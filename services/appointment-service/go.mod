@@ -7,6 +7,9 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
+	shared-followup v0.0.0
+	shared-prescriptions v0.0.0
+	shared-scheduler v0.0.0
 )
 
 require (
@@ -38,3 +41,9 @@ require (
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace shared-followup => ../../shared/followup
+
+replace shared-prescriptions => ../../shared/prescriptions
+
+replace shared-scheduler => ../../shared/scheduler
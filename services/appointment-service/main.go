@@ -2,7 +2,9 @@ package main
 
 import (
 	"appointment-service/config"
+	"appointment-service/controllers"
 	"appointment-service/routes"
+	"appointment-service/scheduler"
 	"context"
 	"log"
 	"net/http"
@@ -29,6 +31,23 @@ func main() {
 	// Add CORS middleware
 	r.Use(middleware.CORSMiddleware())
 
+	// Background jobs (follow-up expiry, no-shows, token resets, report snapshots).
+	// Every replica runs the scheduler; only the advisory-lock leader fires schedules.
+	var jobs *scheduler.Scheduler
+	if os.Getenv("SCHEDULER_ENABLED") != "false" {
+		loc, err := time.LoadLocation("Asia/Kolkata")
+		if err != nil {
+			loc = time.FixedZone("IST", 5*3600+30*60)
+		}
+		jobs = scheduler.New(config.DB, loc)
+		scheduler.RegisterDefaultJobs(jobs)
+		if err := jobs.Start(context.Background()); err != nil {
+			log.Printf("⚠️ Scheduler not started: %v", err)
+			jobs = nil
+		}
+	}
+	controllers.SetScheduler(jobs)
+
 	api := r.Group("/api/v1")
 	routes.AppointmentRoutes(api)
 
@@ -64,5 +83,9 @@ func main() {
 		log.Fatal("Appointment service forced to shutdown:", err)
 	}
 
+	if jobs != nil {
+		jobs.Stop()
+	}
+
 	log.Println("Appointment service exited")
 }
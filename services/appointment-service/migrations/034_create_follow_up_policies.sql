@@ -0,0 +1,45 @@
+-- Migration 034: Configurable follow-up policies
+-- Replaces the hardcoded "one free follow-up valid for 5 days" rule.
+-- A policy can be set clinic-wide, per department, per doctor, or per doctor+department.
+-- The most specific active policy wins; clinics without a policy keep the old defaults.
+
+CREATE TABLE IF NOT EXISTS follow_up_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    clinic_id UUID NOT NULL REFERENCES clinics(id) ON DELETE CASCADE,
+    department_id UUID REFERENCES departments(id) ON DELETE CASCADE,
+    doctor_id UUID REFERENCES doctors(id) ON DELETE CASCADE,
+
+    validity_days INTEGER NOT NULL DEFAULT 5 CHECK (validity_days BETWEEN 1 AND 60),
+    free_visits INTEGER NOT NULL DEFAULT 1 CHECK (free_visits >= 0),
+    discounted_fee DECIMAL(10,2) CHECK (discounted_fee IS NULL OR discounted_fee >= 0),
+    video_counts BOOLEAN NOT NULL DEFAULT true,
+    cross_department_reset BOOLEAN NOT NULL DEFAULT false,
+
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One policy per scope (NULL department/doctor means "any")
+CREATE UNIQUE INDEX IF NOT EXISTS uq_follow_up_policies_scope ON follow_up_policies (
+    clinic_id,
+    COALESCE(department_id, '00000000-0000-0000-0000-000000000000'::uuid),
+    COALESCE(doctor_id, '00000000-0000-0000-0000-000000000000'::uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_up_policies_lookup ON follow_up_policies (clinic_id, is_active);
+
+-- Track how many free visits a window grants and how many were consumed
+ALTER TABLE follow_ups ADD COLUMN IF NOT EXISTS policy_id UUID REFERENCES follow_up_policies(id) ON DELETE SET NULL;
+ALTER TABLE follow_ups ADD COLUMN IF NOT EXISTS free_visits_total INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE follow_ups ADD COLUMN IF NOT EXISTS free_visits_used INTEGER NOT NULL DEFAULT 0;
+
+-- Existing used follow-ups consumed their single free visit
+UPDATE follow_ups SET free_visits_used = 1 WHERE status = 'used' AND free_visits_used = 0;
+
+COMMENT ON TABLE follow_up_policies IS 'Follow-up rules per clinic, department, doctor or doctor+department (most specific wins)';
+COMMENT ON COLUMN follow_up_policies.discounted_fee IS 'Fee charged for follow-ups inside the window once free visits are used up (NULL = regular follow-up fee)';
+COMMENT ON COLUMN follow_up_policies.video_counts IS 'Whether video consultations grant follow-up windows and video follow-ups can use free visits';
+COMMENT ON COLUMN follow_up_policies.cross_department_reset IS 'Whether a regular visit with the doctor in another department renews the window';
+COMMENT ON COLUMN follow_ups.free_visits_total IS 'Free visits granted by the policy when the window opened';
+COMMENT ON COLUMN follow_ups.free_visits_used IS 'Free visits consumed; the window becomes used once this reaches free_visits_total';
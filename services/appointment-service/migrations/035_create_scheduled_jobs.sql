@@ -0,0 +1,34 @@
+-- Migration 035: Background job scheduler
+-- The appointment service runs housekeeping jobs (follow-up expiry, no-show marking,
+-- token resets, report snapshots) in-process. One replica is elected leader through a
+-- Postgres advisory lock; job state is shared here so pause/resume applies cluster-wide.
+
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT,
+    schedule VARCHAR(100) NOT NULL,
+    is_paused BOOLEAN NOT NULL DEFAULT false,
+    last_run_at TIMESTAMPTZ,
+    last_status VARCHAR(20),
+    next_run_at TIMESTAMPTZ,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_job_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL REFERENCES scheduled_jobs(name) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    instance_id VARCHAR(255) NOT NULL,
+    affected_rows BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_job_runs_job_started
+ON scheduled_job_runs(job_name, started_at DESC);
+
+COMMENT ON TABLE scheduled_jobs IS 'Registered background jobs with cron schedule, pause flag and next run';
+COMMENT ON TABLE scheduled_job_runs IS 'Run history of background jobs (scheduled and manual triggers)';
@@ -0,0 +1,52 @@
+-- Migration 036: Consultation notes and e-prescriptions
+-- One consultation record per appointment: chief complaint, diagnosis codes, clinical notes,
+-- advice and prescribed medicines. Finalizing a consultation locks it and publishes an
+-- e-prescription into a linked pharmacy's queue (sales_schema.prescriptions).
+
+CREATE TABLE IF NOT EXISTS consultations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    appointment_id UUID NOT NULL UNIQUE REFERENCES appointments(id) ON DELETE CASCADE,
+    clinic_id UUID NOT NULL,
+    doctor_id UUID NOT NULL,
+    clinic_patient_id UUID REFERENCES clinic_patients(id) ON DELETE SET NULL,
+
+    chief_complaint TEXT,
+    diagnosis_codes TEXT[] NOT NULL DEFAULT '{}',
+    notes TEXT,
+    advice TEXT,
+
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'finalized')),
+    pharmacy_id UUID,
+    prescription_id VARCHAR(50),
+
+    created_by UUID,
+    finalized_by UUID,
+    finalized_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_consultations_clinic_patient ON consultations(clinic_patient_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_consultations_doctor ON consultations(doctor_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS consultation_medicines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    consultation_id UUID NOT NULL REFERENCES consultations(id) ON DELETE CASCADE,
+    medicine_id UUID, -- inventory.medicines(id) of the publishing pharmacy, resolved at finalize
+    medicine_name VARCHAR(255) NOT NULL,
+    medicine_brand VARCHAR(255),
+    dosage VARCHAR(100),
+    frequency VARCHAR(50),
+    morning DECIMAL(10,2) NOT NULL DEFAULT 0,
+    noon DECIMAL(10,2) NOT NULL DEFAULT 0,
+    night DECIMAL(10,2) NOT NULL DEFAULT 0,
+    duration_days INTEGER NOT NULL DEFAULT 0,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    instructions TEXT,
+    sort_order INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_consultation_medicines_consultation ON consultation_medicines(consultation_id, sort_order);
+
+COMMENT ON TABLE consultations IS 'Doctor consultation record per appointment; finalized records are immutable';
+COMMENT ON COLUMN consultations.prescription_id IS 'sales_schema.prescriptions(id) published to the pharmacy on finalize';
@@ -0,0 +1,42 @@
+-- Migration 037: ICD-10 diagnosis coding
+-- Code catalog imported offline from an ICD-10 CSV, per-clinic favourites, and coded
+-- diagnoses per appointment (synced from the consultation record when one exists).
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS diagnosis_codes (
+    code VARCHAR(10) PRIMARY KEY,           -- dotted form, e.g. "J06.9"
+    description TEXT NOT NULL,
+    category_code VARCHAR(3) NOT NULL,      -- 3-character ICD-10 category, e.g. "J06"
+    category_description TEXT,
+    is_billable BOOLEAN NOT NULL DEFAULT true,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_diagnosis_codes_code_prefix ON diagnosis_codes(code varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_diagnosis_codes_category ON diagnosis_codes(category_code);
+CREATE INDEX IF NOT EXISTS idx_diagnosis_codes_description_trgm ON diagnosis_codes USING GIN (description gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS clinic_diagnosis_favourites (
+    clinic_id UUID NOT NULL REFERENCES clinics(id) ON DELETE CASCADE,
+    code VARCHAR(10) NOT NULL REFERENCES diagnosis_codes(code) ON DELETE CASCADE,
+    created_by UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (clinic_id, code)
+);
+
+CREATE TABLE IF NOT EXISTS appointment_diagnoses (
+    appointment_id UUID NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    code VARCHAR(10) NOT NULL REFERENCES diagnosis_codes(code),
+    is_primary BOOLEAN NOT NULL DEFAULT false,
+    consultation_id UUID REFERENCES consultations(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (appointment_id, code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_diagnoses_code ON appointment_diagnoses(code);
+
+COMMENT ON TABLE diagnosis_codes IS 'ICD-10 code catalog, loaded through POST /diagnosis-codes/import';
+COMMENT ON TABLE appointment_diagnoses IS 'Coded diagnoses per appointment; first consultation code is primary';
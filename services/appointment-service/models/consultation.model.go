@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Consultation statuses
+const (
+	ConsultationStatusDraft     = "draft"
+	ConsultationStatusFinalized = "finalized"
+)
+
+// Consultation is the doctor's clinical record for one appointment
+type Consultation struct {
+	ID              string                 `json:"id" db:"id"`
+	AppointmentID   string                 `json:"appointment_id" db:"appointment_id"`
+	ClinicID        string                 `json:"clinic_id" db:"clinic_id"`
+	DoctorID        string                 `json:"doctor_id" db:"doctor_id"`
+	ClinicPatientID *string                `json:"clinic_patient_id" db:"clinic_patient_id"`
+	ChiefComplaint  *string                `json:"chief_complaint" db:"chief_complaint"`
+	DiagnosisCodes  []string               `json:"diagnosis_codes" db:"diagnosis_codes"`
+	Notes           *string                `json:"notes" db:"notes"`
+	Advice          *string                `json:"advice" db:"advice"`
+	Status          string                 `json:"status" db:"status"`
+	PharmacyID      *string                `json:"pharmacy_id" db:"pharmacy_id"`
+	PrescriptionID  *string                `json:"prescription_id" db:"prescription_id"`
+	CreatedBy       *string                `json:"created_by" db:"created_by"`
+	FinalizedBy     *string                `json:"finalized_by" db:"finalized_by"`
+	FinalizedAt     *time.Time             `json:"finalized_at" db:"finalized_at"`
+	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at" db:"updated_at"`
+	Medicines       []ConsultationMedicine `json:"medicines"`
+}
+
+// ConsultationMedicine is one prescribed medicine line
+type ConsultationMedicine struct {
+	ID             string  `json:"id" db:"id"`
+	ConsultationID string  `json:"consultation_id" db:"consultation_id"`
+	MedicineID     *string `json:"medicine_id" db:"medicine_id"`
+	MedicineName   string  `json:"medicine_name" db:"medicine_name"`
+	MedicineBrand  *string `json:"medicine_brand" db:"medicine_brand"`
+	Dosage         *string `json:"dosage" db:"dosage"`
+	Frequency      *string `json:"frequency" db:"frequency"`
+	Morning        float64 `json:"morning" db:"morning"`
+	Noon           float64 `json:"noon" db:"noon"`
+	Night          float64 `json:"night" db:"night"`
+	DurationDays   int     `json:"duration_days" db:"duration_days"`
+	Quantity       int     `json:"quantity" db:"quantity"`
+	Instructions   *string `json:"instructions" db:"instructions"`
+	SortOrder      int     `json:"sort_order" db:"sort_order"`
+}
@@ -32,6 +32,8 @@ func AppointmentRoutes(rg *gin.RouterGroup) {
 		appointments.POST("/:id/reschedule", middleware.RequireRole(config.DB, "clinic_admin", "receptionist"), controllers.RescheduleAppointment)
 		appointments.POST("/:id/cancel", middleware.RequireRole(config.DB, "clinic_admin", "receptionist"), controllers.CancelAppointment)
 		appointments.POST("/:id/payment", middleware.RequireRole(config.DB, "clinic_admin", "receptionist"), controllers.RecordAppointmentPayment)
+		appointments.GET("/:id/diagnoses", middleware.RequireRole(config.DB, "clinic_admin", "doctor", "receptionist"), controllers.GetAppointmentDiagnoses)
+		appointments.PUT("/:id/diagnoses", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.SetAppointmentDiagnoses)
 		appointments.POST("/:id/record-payment", middleware.RequireRole(config.DB, "clinic_admin", "receptionist"), controllers.RecordPayment)
 		appointments.GET("/slots/available", middleware.RequireRole(config.DB, "clinic_admin", "receptionist"), controllers.GetAvailableTimeSlots)
 		appointments.GET("/dashboard", middleware.RequireRole(config.DB, "clinic_admin", "receptionist", "doctor"), controllers.GetDashboardStats)
@@ -59,11 +61,39 @@ func AppointmentRoutes(rg *gin.RouterGroup) {
 		vitals.GET("/clinic-patient/:patient_id", middleware.RequireRole(config.DB, "clinic_admin", "doctor", "receptionist"), controllers.GetPatientVitalsHistory)
 	}
 
+	consultations := rg.Group("/consultations")
+	{
+		consultations.GET("/appointment/:appointment_id", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.GetConsultation)
+		consultations.PUT("/appointment/:appointment_id", middleware.RequireRole(config.DB, "doctor"), controllers.SaveConsultation)
+		consultations.POST("/:id/finalize", middleware.RequireRole(config.DB, "doctor"), controllers.FinalizeConsultation)
+		consultations.GET("/patient/:clinic_patient_id", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.ListPatientConsultations)
+	}
+
+	diagnosisCodes := rg.Group("/diagnosis-codes")
+	{
+		diagnosisCodes.GET("/search", middleware.RequireRole(config.DB, "clinic_admin", "doctor", "receptionist"), controllers.SearchDiagnosisCodes)
+		diagnosisCodes.GET("/favourites", middleware.RequireRole(config.DB, "clinic_admin", "doctor", "receptionist"), controllers.ListFavouriteDiagnoses)
+		diagnosisCodes.POST("/favourites", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.AddFavouriteDiagnosis)
+		diagnosisCodes.DELETE("/favourites/:code", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.RemoveFavouriteDiagnosis)
+		diagnosisCodes.POST("/import", middleware.RequireRole(config.DB, "super_admin"), controllers.ImportDiagnosisCodes)
+		diagnosisCodes.GET("/:code", middleware.RequireRole(config.DB, "clinic_admin", "doctor", "receptionist"), controllers.GetDiagnosisCode)
+	}
+
 	reports := rg.Group("/reports")
 	{
 		reports.GET("/daily-collection", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.GetDailyCollectionReport)
 		reports.GET("/pending-payments", middleware.RequireRole(config.DB, "clinic_admin", "receptionist"), controllers.GetPendingPaymentsReport)
 		reports.GET("/utilization", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.GetUtilizationReport)
 		reports.GET("/no-show", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.GetNoShowReport)
+		reports.GET("/diagnosis-categories", middleware.RequireRole(config.DB, "clinic_admin", "doctor"), controllers.GetDiagnosisCategoryReport)
+	}
+
+	jobs := rg.Group("/admin/jobs")
+	{
+		jobs.GET("", middleware.RequireRole(config.DB, "super_admin"), controllers.ListScheduledJobs)
+		jobs.GET("/:name/runs", middleware.RequireRole(config.DB, "super_admin"), controllers.GetScheduledJobRuns)
+		jobs.POST("/:name/trigger", middleware.RequireRole(config.DB, "super_admin"), controllers.TriggerScheduledJob)
+		jobs.POST("/:name/pause", middleware.RequireRole(config.DB, "super_admin"), controllers.PauseScheduledJob)
+		jobs.POST("/:name/resume", middleware.RequireRole(config.DB, "super_admin"), controllers.ResumeScheduledJob)
 	}
 }
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"appointment-service/utils"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Built-in job names
+const (
+	JobFollowUpExpiry  = "followup-expiry"
+	JobNoShowMarking   = "no-show-marking"
+	JobTokenReset      = "token-reset"
+	JobReportSnapshots = "report-snapshots"
+)
+
+// tokenRetentionDays is how long daily token counters are kept after their date
+const tokenRetentionDays = 7
+
+// RegisterDefaultJobs registers the appointment-service housekeeping jobs.
+// Schedules are evaluated in the scheduler's location (IST).
+func RegisterDefaultJobs(s *Scheduler) {
+	s.Register(&Job{
+		Name:        JobFollowUpExpiry,
+		Description: "Expire follow-up windows past their policy validity",
+		Schedule:    MustParseSchedule("5 0 * * *"),
+		Run:         expireFollowUps,
+	})
+	s.Register(&Job{
+		Name:        JobNoShowMarking,
+		Description: "Mark past booked appointments without a check-in as no-show",
+		Schedule:    MustParseSchedule("15 0 * * *"),
+		Run:         markNoShows,
+	})
+	s.Register(&Job{
+		Name:        JobTokenReset,
+		Description: "Purge daily doctor token counters older than the retention window",
+		Schedule:    MustParseSchedule("30 0 * * *"),
+		Run:         resetTokens,
+	})
+	s.Register(&Job{
+		Name:        JobReportSnapshots,
+		Description: "Snapshot yesterday's clinic and doctor stats into the analytics tables",
+		Schedule:    MustParseSchedule("45 0 * * *"),
+		Run:         snapshotReports,
+	})
+}
+
+func expireFollowUps(ctx context.Context, db *sql.DB) (int64, error) {
+	fm := &utils.FollowUpManager{DB: db}
+	return fm.ExpireOldFollowUpsContext(ctx)
+}
+
+func markNoShows(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		UPDATE appointments a
+		SET status = 'no_show',
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE a.status IN ('booked', 'confirmed')
+		  AND a.appointment_date < (CURRENT_TIMESTAMP AT TIME ZONE 'Asia/Kolkata')::date
+		  AND NOT EXISTS (SELECT 1 FROM patient_checkins pc WHERE pc.appointment_id = a.id)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark no-shows: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// resetTokens drops stale daily counters; today's and future counters are untouched,
+// so a new day always starts numbering from 1.
+func resetTokens(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM doctor_tokens
+		WHERE token_date < (CURRENT_TIMESTAMP AT TIME ZONE 'Asia/Kolkata')::date - $1::int
+	`, tokenRetentionDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset doctor tokens: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// snapshotReports upserts yesterday's figures, so re-running the job is safe
+func snapshotReports(ctx context.Context, db *sql.DB) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	clinicRes, err := tx.ExecContext(ctx, `
+		WITH day AS (
+			SELECT (CURRENT_TIMESTAMP AT TIME ZONE 'Asia/Kolkata')::date - 1 AS d
+		)
+		INSERT INTO analytics_daily_stats (
+			clinic_id, stat_date, total_patients, new_patients, total_appointments,
+			completed_appointments, cancelled_appointments, total_revenue, consultation_revenue,
+			avg_wait_time_minutes
+		)
+		SELECT
+			a.clinic_id,
+			day.d,
+			COUNT(DISTINCT COALESCE(a.clinic_patient_id, a.patient_id)),
+			COUNT(DISTINCT a.clinic_patient_id) FILTER (WHERE cp.created_at::date = day.d),
+			COUNT(*),
+			COUNT(*) FILTER (WHERE a.status = 'completed'),
+			COUNT(*) FILTER (WHERE a.status = 'cancelled'),
+			COALESCE(SUM(a.fee_amount) FILTER (WHERE a.payment_status IN ('paid', 'completed', 'success')), 0),
+			COALESCE(SUM(a.fee_amount) FILTER (WHERE a.payment_status IN ('paid', 'completed', 'success')), 0),
+			COALESCE(AVG(EXTRACT(EPOCH FROM (pc.checkin_time - a.appointment_time)) / 60)
+				FILTER (WHERE pc.checkin_time > a.appointment_time), 0)::int
+		FROM appointments a
+		CROSS JOIN day
+		LEFT JOIN clinic_patients cp ON cp.id = a.clinic_patient_id
+		LEFT JOIN LATERAL (
+			SELECT MIN(checkin_time) AS checkin_time FROM patient_checkins WHERE appointment_id = a.id
+		) pc ON true
+		WHERE a.appointment_date = day.d AND a.clinic_id IS NOT NULL
+		GROUP BY a.clinic_id, day.d
+		ON CONFLICT (clinic_id, stat_date) DO UPDATE
+		SET total_patients = EXCLUDED.total_patients,
+		    new_patients = EXCLUDED.new_patients,
+		    total_appointments = EXCLUDED.total_appointments,
+		    completed_appointments = EXCLUDED.completed_appointments,
+		    cancelled_appointments = EXCLUDED.cancelled_appointments,
+		    total_revenue = EXCLUDED.total_revenue,
+		    consultation_revenue = EXCLUDED.consultation_revenue,
+		    avg_wait_time_minutes = EXCLUDED.avg_wait_time_minutes
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to snapshot clinic stats: %w", err)
+	}
+
+	doctorRes, err := tx.ExecContext(ctx, `
+		WITH day AS (
+			SELECT (CURRENT_TIMESTAMP AT TIME ZONE 'Asia/Kolkata')::date - 1 AS d
+		)
+		INSERT INTO analytics_doctor_stats (
+			clinic_id, doctor_id, stat_date, total_appointments, completed_appointments, total_revenue
+		)
+		SELECT
+			a.clinic_id,
+			a.doctor_id,
+			day.d,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE a.status = 'completed'),
+			COALESCE(SUM(a.fee_amount) FILTER (WHERE a.payment_status IN ('paid', 'completed', 'success')), 0)
+		FROM appointments a
+		CROSS JOIN day
+		WHERE a.appointment_date = day.d AND a.clinic_id IS NOT NULL AND a.doctor_id IS NOT NULL
+		GROUP BY a.clinic_id, a.doctor_id, day.d
+		ON CONFLICT (clinic_id, doctor_id, stat_date) DO UPDATE
+		SET total_appointments = EXCLUDED.total_appointments,
+		    completed_appointments = EXCLUDED.completed_appointments,
+		    total_revenue = EXCLUDED.total_revenue
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to snapshot doctor stats: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	clinicRows, _ := clinicRes.RowsAffected()
+	doctorRows, _ := doctorRes.RowsAffected()
+	return clinicRows + doctorRows, nil
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"database/sql"
+	"time"
+
+	shared "shared-scheduler"
+)
+
+// The scheduler itself lives in shared-scheduler, which organization-service
+// runs too; this package keeps the appointment-service jobs.
+type (
+	Scheduler = shared.Scheduler
+	Job       = shared.Job
+	JobRun    = shared.JobRun
+)
+
+var (
+	ErrJobNotFound    = shared.ErrJobNotFound
+	ErrJobRunning     = shared.ErrJobRunning
+	MustParseSchedule = shared.MustParseSchedule
+)
+
+// New creates the appointment-service scheduler; schedules are evaluated in loc
+func New(db *sql.DB, loc *time.Location) *Scheduler {
+	return shared.New(db, loc, "appointment-service")
+}
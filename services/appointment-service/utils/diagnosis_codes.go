@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// =====================================================
+// ICD-10 DIAGNOSIS CODES
+// Codes are stored in dotted form ("J06.9"); input with or without
+// the dot is accepted everywhere.
+// =====================================================
+
+// DiagnosisCode is one catalog entry
+type DiagnosisCode struct {
+	Code                string  `json:"code"`
+	Description         string  `json:"description"`
+	CategoryCode        string  `json:"category_code"`
+	CategoryDescription *string `json:"category_description"`
+	IsBillable          bool    `json:"is_billable"`
+}
+
+var icd10Pattern = regexp.MustCompile(`^[A-Z][0-9][0-9A-Z]{1,5}$`)
+
+const diagnosisImportBatchSize = 500
+
+// NormalizeDiagnosisCode converts "j069", "J06.9" or " j06.9 " to "J06.9".
+// Returns false if the input is not shaped like an ICD-10 code.
+func NormalizeDiagnosisCode(raw string) (string, bool) {
+	compact := strings.ToUpper(strings.NewReplacer(".", "", " ", "").Replace(strings.TrimSpace(raw)))
+	if !icd10Pattern.MatchString(compact) {
+		return "", false
+	}
+	if len(compact) == 3 {
+		return compact, true
+	}
+	return compact[:3] + "." + compact[3:], true
+}
+
+// ParseDiagnosisCSV reads an ICD-10 CSV. A header row is optional; when present the
+// code column is the one named like "code" and the description the one named like
+// "description", "title" or "name". Without a header the first two columns are used.
+// Codes that have more specific children in the file are marked non-billable.
+func ParseDiagnosisCSV(r io.Reader) ([]DiagnosisCode, []string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	codeCol, descCol := 0, 1
+	first := true
+	seen := make(map[string]int)
+	codes := make([]DiagnosisCode, 0)
+	skipped := make([]string, 0)
+	line := 0
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if first {
+			first = false
+			if cc, dc, ok := diagnosisCSVHeader(record); ok {
+				codeCol, descCol = cc, dc
+				continue
+			}
+		}
+
+		if len(record) <= codeCol || len(record) <= descCol {
+			skipped = append(skipped, fmt.Sprintf("line %d: missing columns", line))
+			continue
+		}
+
+		code, ok := NormalizeDiagnosisCode(record[codeCol])
+		description := strings.TrimSpace(record[descCol])
+		if !ok || description == "" {
+			skipped = append(skipped, fmt.Sprintf("line %d: invalid code %q", line, record[codeCol]))
+			continue
+		}
+
+		entry := DiagnosisCode{
+			Code:         code,
+			Description:  description,
+			CategoryCode: code[:3],
+			IsBillable:   true,
+		}
+		if i, dup := seen[code]; dup {
+			codes[i] = entry
+			continue
+		}
+		seen[code] = len(codes)
+		codes = append(codes, entry)
+	}
+
+	// A code is a header (non-billable) when a longer code in the file extends it
+	compact := func(code string) string { return strings.Replace(code, ".", "", 1) }
+	prefixes := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		cc := compact(c.Code)
+		for n := 3; n < len(cc); n++ {
+			prefixes[cc[:n]] = true
+		}
+	}
+	categoryNames := make(map[string]string)
+	for i := range codes {
+		if prefixes[compact(codes[i].Code)] {
+			codes[i].IsBillable = false
+		}
+		if len(codes[i].Code) == 3 {
+			categoryNames[codes[i].Code] = codes[i].Description
+		}
+	}
+	for i := range codes {
+		if name, ok := categoryNames[codes[i].CategoryCode]; ok {
+			codes[i].CategoryDescription = &name
+		}
+	}
+
+	return codes, skipped, nil
+}
+
+func diagnosisCSVHeader(record []string) (codeCol, descCol int, ok bool) {
+	codeCol, descCol = -1, -1
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		switch {
+		case codeCol == -1 && strings.Contains(name, "code") && !strings.Contains(name, "category"):
+			codeCol = i
+		case descCol == -1 && (strings.Contains(name, "desc") || strings.Contains(name, "title") || name == "name"):
+			descCol = i
+		}
+	}
+	if codeCol == -1 || descCol == -1 {
+		return 0, 1, false
+	}
+	return codeCol, descCol, true
+}
+
+// ImportDiagnosisCodes upserts the catalog in batches inside one transaction
+func ImportDiagnosisCodes(ctx context.Context, db *sql.DB, codes []DiagnosisCode) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var total int64
+	for start := 0; start < len(codes); start += diagnosisImportBatchSize {
+		end := start + diagnosisImportBatchSize
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		var sb strings.Builder
+		args := make([]interface{}, 0, (end-start)*5)
+		sb.WriteString(`INSERT INTO diagnosis_codes (code, description, category_code, category_description, is_billable) VALUES `)
+		for i, c := range codes[start:end] {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+			args = append(args, c.Code, c.Description, c.CategoryCode, c.CategoryDescription, c.IsBillable)
+		}
+		sb.WriteString(`
+			ON CONFLICT (code) DO UPDATE
+			SET description = EXCLUDED.description,
+			    category_code = EXCLUDED.category_code,
+			    category_description = COALESCE(EXCLUDED.category_description, diagnosis_codes.category_description),
+			    is_billable = EXCLUDED.is_billable,
+			    is_active = true,
+			    updated_at = CURRENT_TIMESTAMP`)
+
+		res, err := tx.ExecContext(ctx, sb.String(), args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import codes %d-%d: %w", start+1, end, err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+
+	// Fill category names for codes imported before their category row existed
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE diagnosis_codes d
+		SET category_description = c.description
+		FROM diagnosis_codes c
+		WHERE c.code = d.category_code AND d.category_description IS NULL
+	`); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// ErrUnknownDiagnosisCodes is returned when codes are not in the catalog
+var ErrUnknownDiagnosisCodes = errors.New("unknown diagnosis codes")
+
+// ValidateDiagnosisCodes normalizes codes, drops duplicates and checks them against the
+// catalog. Unknown or malformed codes are returned alongside ErrUnknownDiagnosisCodes.
+func ValidateDiagnosisCodes(ctx context.Context, q *sql.Tx, raw []string) ([]string, []string, error) {
+	codes := make([]string, 0, len(raw))
+	invalid := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, r := range raw {
+		if strings.TrimSpace(r) == "" {
+			continue
+		}
+		code, ok := NormalizeDiagnosisCode(r)
+		if !ok {
+			invalid = append(invalid, r)
+			continue
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		if len(invalid) > 0 {
+			return codes, invalid, ErrUnknownDiagnosisCodes
+		}
+		return codes, invalid, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT c FROM unnest($1::text[]) AS c
+		WHERE NOT EXISTS (SELECT 1 FROM diagnosis_codes d WHERE d.code = c AND d.is_active = true)
+	`, pq.Array(codes))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, nil, err
+		}
+		invalid = append(invalid, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(invalid) > 0 {
+		return codes, invalid, ErrUnknownDiagnosisCodes
+	}
+	return codes, invalid, nil
+}
+
+// SetAppointmentDiagnoses replaces the coded diagnoses of an appointment; the first code is primary
+func SetAppointmentDiagnoses(ctx context.Context, tx *sql.Tx, appointmentID string, consultationID *string, codes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM appointment_diagnoses WHERE appointment_id = $1`, appointmentID); err != nil {
+		return err
+	}
+	for i, code := range codes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO appointment_diagnoses (appointment_id, code, is_primary, consultation_id)
+			VALUES ($1, $2, $3, $4)
+		`, appointmentID, code, i == 0, consultationID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDiagnosisCode(t *testing.T) {
+	tests := []struct {
+		raw    string
+		want   string
+		wantOK bool
+	}{
+		{"J06.9", "J06.9", true},
+		{"j069", "J06.9", true},
+		{" j06.9 ", "J06.9", true},
+		{"E11", "E11", true},
+		{"S72.001A", "S72.001A", true},
+		{"E1165", "E11.65", true},
+		{"J0", "", false},
+		{"106.9", "", false},
+		{"JJ6.9", "", false},
+		{"J06.9-", "", false},
+		{"S72.001AB", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, ok := NormalizeDiagnosisCode(tt.raw)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizeDiagnosisCode(%q) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseDiagnosisCSV(t *testing.T) {
+	type entry struct {
+		code     string
+		billable bool
+		category string // category description, "" when the file has no three-character row for it
+	}
+
+	tests := []struct {
+		name        string
+		csv         string
+		want        []entry
+		wantSkipped int
+	}{
+		{
+			name: "no header uses the first two columns",
+			csv:  "J06.9,Acute upper respiratory infection\nR51,Headache\n",
+			want: []entry{{"J06.9", true, ""}, {"R51", true, "Headache"}},
+		},
+		{
+			name: "header picks code and description columns",
+			csv:  "category_code,title,code\nJ06,Acute URI,J069\n",
+			want: []entry{{"J06.9", true, ""}},
+		},
+		{
+			name: "codes with children are not billable",
+			csv:  "code,description\nE11,Type 2 diabetes mellitus\nE11.6,With other complications\nE11.65,With hyperglycemia\n",
+			want: []entry{
+				{"E11", false, "Type 2 diabetes mellitus"},
+				{"E11.6", false, "Type 2 diabetes mellitus"},
+				{"E11.65", true, "Type 2 diabetes mellitus"},
+			},
+		},
+		{
+			name:        "invalid and incomplete rows are skipped",
+			csv:         "code,description\nnot-a-code,Something\nR51,\nR52\nR51,Headache\n",
+			want:        []entry{{"R51", true, "Headache"}},
+			wantSkipped: 3,
+		},
+		{
+			name: "later duplicates replace earlier ones",
+			csv:  "R51,Head ache\nr51,Headache\n",
+			want: []entry{{"R51", true, "Headache"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes, skipped, err := ParseDiagnosisCSV(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("ParseDiagnosisCSV() error = %v", err)
+			}
+			if len(skipped) != tt.wantSkipped {
+				t.Errorf("skipped = %v, want %d", skipped, tt.wantSkipped)
+			}
+			if len(codes) != len(tt.want) {
+				t.Fatalf("got %d codes, want %d: %+v", len(codes), len(tt.want), codes)
+			}
+			for i, w := range tt.want {
+				got := codes[i]
+				category := ""
+				if got.CategoryDescription != nil {
+					category = *got.CategoryDescription
+				}
+				if got.Code != w.code || got.IsBillable != w.billable || category != w.category {
+					t.Errorf("codes[%d] = %s billable=%v category=%q, want %s billable=%v category=%q",
+						i, got.Code, got.IsBillable, category, w.code, w.billable, w.category)
+				}
+			}
+		})
+	}
+}
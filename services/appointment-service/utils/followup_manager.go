@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"shared-followup"
 )
 
 // FollowUpManager handles all follow-up related operations
@@ -29,43 +31,69 @@ type FollowUpRecord struct {
 	UsedAppointmentID      *string
 	RenewedAt              *time.Time
 	RenewedByAppointmentID *string
+	FreeVisitsTotal        int
+	FreeVisitsUsed         int
 	FollowUpLogicStatus    string // new, expired, used, renewed
 	LogicNotes             *string
 	CreatedAt              time.Time
 	UpdatedAt              time.Time
 }
 
+// LoadPolicy resolves the follow-up policy for a doctor+department in a clinic.
+// Falls back to the default policy (one free visit, 5 days) if loading fails.
+func (fm *FollowUpManager) LoadPolicy(ctx context.Context, clinicID, doctorID string, departmentID *string) followup.Policy {
+	policy, err := followup.LoadPolicy(ctx, fm.DB, clinicID, doctorID, departmentID)
+	if err != nil {
+		log.Printf("⚠️ Warning: Using default follow-up policy: %v", err)
+	}
+	return policy
+}
+
 // CreateFollowUp creates a new follow-up eligibility record
 // Called when a regular appointment (clinic_visit or video_consultation) is created
 func (fm *FollowUpManager) CreateFollowUp(clinicPatientID, clinicID, doctorID string, departmentID *string, appointmentID string, appointmentDate time.Time) error {
+	return fm.CreateFollowUpForType(clinicPatientID, clinicID, doctorID, departmentID, appointmentID, appointmentDate, followup.TypeClinicVisit)
+}
+
+// CreateFollowUpForType creates a follow-up eligibility record if the resolved policy
+// lets this consultation type open a window
+func (fm *FollowUpManager) CreateFollowUpForType(clinicPatientID, clinicID, doctorID string, departmentID *string, appointmentID string, appointmentDate time.Time, consultationType string) error {
 	log.Printf("🔄 CreateFollowUp called: Patient=%s, Doctor=%s, Dept=%v, AppointmentID=%s, Date=%s",
 		clinicPatientID, doctorID, departmentID, appointmentID, appointmentDate.Format("2006-01-02"))
 
-	validFrom := appointmentDate
-	validUntil := appointmentDate.AddDate(0, 0, 5) // 5 days validity
+	policy := fm.LoadPolicy(context.Background(), clinicID, doctorID, departmentID)
+	if !followup.GrantsWindow(policy, consultationType) {
+		log.Printf("ℹ️ Follow-up policy (%s) does not grant a window for %s", policy.Scope(), consultationType)
+		return nil
+	}
+
+	validFrom, validUntil := followup.WindowFor(policy, appointmentDate)
 
 	log.Printf("📅 Follow-up validity: From=%s, Until=%s", validFrom.Format("2006-01-02"), validUntil.Format("2006-01-02"))
 
 	// First, check if there's an existing active or expired follow-up for this doctor+department
 	// If yes, mark it as "renewed"
-	err := fm.RenewExistingFollowUps(clinicPatientID, clinicID, doctorID, departmentID, appointmentID)
+	err := fm.renewFollowUps(clinicPatientID, clinicID, doctorID, departmentID, appointmentID, policy.CrossDepartmentReset)
 	if err != nil {
 		log.Printf("⚠️ Warning: Failed to renew existing follow-ups: %v", err)
 		// Don't fail - continue creating new follow-up
 	}
 
 	// Create new follow-up record
-	logicNotes := fmt.Sprintf("Patient gets one free follow-up valid for 5 days. If used, it expires. If not used after 5 days, it also expires. Subsequent regular appointments with same doctor+department generate new free follow-up.")
+	logicNotes := fmt.Sprintf("Patient gets %d free follow-up(s) valid for %d days under the %s policy. Once used or past validity it expires. Subsequent regular appointments with same doctor+department generate a new window.",
+		policy.FreeVisits, policy.ValidityDays, policy.Scope())
 
 	_, err = fm.DB.Exec(`
 		INSERT INTO follow_ups (
 			clinic_patient_id, clinic_id, doctor_id, department_id,
 			source_appointment_id, status, is_free, valid_from, valid_until,
+			policy_id, free_visits_total, free_visits_used,
 			follow_up_logic_status, logic_notes,
 			created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, 'active', true, $6, $7, 'new', $8, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, clinicPatientID, clinicID, doctorID, departmentID, appointmentID, validFrom, validUntil, logicNotes)
+		VALUES ($1, $2, $3, $4, $5, 'active', $6, $7, $8, $9, $10, 0, 'new', $11, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, clinicPatientID, clinicID, doctorID, departmentID, appointmentID, policy.FreeVisits > 0, validFrom, validUntil,
+		policy.ID, policy.FreeVisits, logicNotes)
 
 	if err != nil {
 		log.Printf("❌ Failed to create follow-up record: %v", err)
@@ -80,6 +108,12 @@ func (fm *FollowUpManager) CreateFollowUp(clinicPatientID, clinicID, doctorID st
 
 // RenewExistingFollowUps marks existing follow-ups as "renewed" for this doctor+department combination
 func (fm *FollowUpManager) RenewExistingFollowUps(clinicPatientID, clinicID, doctorID string, departmentID *string, newAppointmentID string) error {
+	return fm.renewFollowUps(clinicPatientID, clinicID, doctorID, departmentID, newAppointmentID, false)
+}
+
+// renewFollowUps marks existing follow-ups as "renewed"; with allDepartments set,
+// windows with the doctor in every department are renewed (cross-department reset)
+func (fm *FollowUpManager) renewFollowUps(clinicPatientID, clinicID, doctorID string, departmentID *string, newAppointmentID string, allDepartments bool) error {
 	log.Printf("🔄 RenewExistingFollowUps called: Patient=%s, Doctor=%s, Dept=%v, NewAppointment=%s",
 		clinicPatientID, doctorID, departmentID, newAppointmentID)
 
@@ -99,12 +133,14 @@ func (fm *FollowUpManager) RenewExistingFollowUps(clinicPatientID, clinicID, doc
 
 	args := []interface{}{newAppointmentID, clinicPatientID, clinicID, doctorID}
 
-	// Add department filter if provided
-	if departmentID != nil {
-		query += ` AND department_id = $5`
-		args = append(args, *departmentID)
-	} else {
-		query += ` AND department_id IS NULL`
+	// Add department filter unless any window with this doctor is replaced (cross-department reset)
+	if !allDepartments {
+		if departmentID != nil {
+			query += ` AND department_id = $5`
+			args = append(args, *departmentID)
+		} else {
+			query += ` AND department_id IS NULL`
+		}
 	}
 
 	log.Printf("🔄 Executing renewal query: %s with args: %v", query, args)
@@ -132,10 +168,11 @@ func (fm *FollowUpManager) MarkFollowUpAsUsed(clinicPatientID, clinicID, doctorI
 	log.Printf("🔧 MarkFollowUpAsUsed called with: Patient=%s, Clinic=%s, Doctor=%s, Dept=%v, Appointment=%s",
 		clinicPatientID, clinicID, doctorID, departmentID, followUpAppointmentID)
 
-	// First, get the follow-up ID that will be marked as used
+	// First, get the follow-up that will have a free visit consumed
 	var followUpID string
+	var window followup.Window
 	getQuery := `
-		SELECT id
+		SELECT id, free_visits_total, free_visits_used
 		FROM follow_ups
 		WHERE clinic_patient_id = $1
 		  AND clinic_id = $2
@@ -157,27 +194,35 @@ func (fm *FollowUpManager) MarkFollowUpAsUsed(clinicPatientID, clinicID, doctorI
 
 	getQuery += ` ORDER BY created_at DESC LIMIT 1`
 
-	err := fm.DB.QueryRow(getQuery, getArgs...).Scan(&followUpID)
+	err := fm.DB.QueryRow(getQuery, getArgs...).Scan(&followUpID, &window.FreeVisitsTotal, &window.FreeVisitsUsed)
 	if err != nil {
 		log.Printf("⚠️ No active free follow-up found: %v", err)
 		return fmt.Errorf("no active free follow-up found: %w", err)
 	}
 
-	log.Printf("✅ Found follow-up to mark as used: %s", followUpID)
+	log.Printf("✅ Found follow-up to mark as used: %s (%d/%d free visits used)", followUpID, window.FreeVisitsUsed, window.FreeVisitsTotal)
+
+	// Consume one free visit; the window is only "used" once all free visits are gone
+	used, exhausted := followup.Consume(window)
+	status, logicNotes := followup.StatusActive, fmt.Sprintf("Free follow-up %d of %d used.", used, window.FreeVisitsTotal)
+	if exhausted {
+		status, logicNotes = followup.StatusUsed, "All free follow-ups were used. Patient can book follow-up again but next one is PAID (or discounted if the policy allows)."
+	}
 
-	// Now update the follow-up status
 	updateQuery := `
 		UPDATE follow_ups
-		SET status = 'used',
+		SET status = $1,
+		    free_visits_used = $2,
 		    used_at = CURRENT_TIMESTAMP,
-		    used_appointment_id = $1,
-		    follow_up_logic_status = 'used',
-		    logic_notes = 'Free follow-up was used. Patient can book follow-up again but next one is PAID.',
+		    used_appointment_id = $3,
+		    follow_up_logic_status = CASE WHEN $1 = 'used' THEN 'used' ELSE follow_up_logic_status END,
+		    logic_notes = $4,
 		    updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2
+		WHERE id = $5
+		  AND free_visits_used = $6
 	`
 
-	result, err := fm.DB.Exec(updateQuery, followUpAppointmentID, followUpID)
+	result, err := fm.DB.Exec(updateQuery, status, used, followUpAppointmentID, logicNotes, followUpID, window.FreeVisitsUsed)
 	if err != nil {
 		log.Printf("❌ Failed to update follow-up: %v", err)
 		return fmt.Errorf("failed to mark follow-up as used: %w", err)
@@ -185,24 +230,24 @@ func (fm *FollowUpManager) MarkFollowUpAsUsed(clinicPatientID, clinicID, doctorI
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected > 0 {
-		log.Printf("✅ Marked follow-up as used: FollowUpID=%s, AppointmentID=%s",
-			followUpID, followUpAppointmentID)
+		log.Printf("✅ Marked follow-up visit as used: FollowUpID=%s, AppointmentID=%s, Status=%s",
+			followUpID, followUpAppointmentID, status)
 
-		// ✅ ALSO UPDATE clinic_patient status to 'used'
+		// ✅ ALSO UPDATE clinic_patient status
 		_, err = fm.DB.Exec(`
 			UPDATE clinic_patients
-			SET current_followup_status = 'used',
-			    last_appointment_id = $1,
-			    last_followup_id = $2,
+			SET current_followup_status = $1,
+			    last_appointment_id = $2,
+			    last_followup_id = $3,
 			    updated_at = CURRENT_TIMESTAMP
-			WHERE id = $3
-			  AND clinic_id = $4
-		`, followUpAppointmentID, followUpID, clinicPatientID, clinicID)
+			WHERE id = $4
+			  AND clinic_id = $5
+		`, status, followUpAppointmentID, followUpID, clinicPatientID, clinicID)
 
 		if err != nil {
-			log.Printf("⚠️ Warning: Failed to update clinic_patient status to 'used': %v", err)
+			log.Printf("⚠️ Warning: Failed to update clinic_patient status to '%s': %v", status, err)
 		} else {
-			log.Printf("✅ Updated clinic_patient status to 'used' for patient=%s", clinicPatientID)
+			log.Printf("✅ Updated clinic_patient status to '%s' for patient=%s", status, clinicPatientID)
 		}
 	}
 
@@ -218,6 +263,7 @@ func (fm *FollowUpManager) GetActiveFollowUp(clinicPatientID, clinicID, doctorID
 		SELECT id, clinic_patient_id, clinic_id, doctor_id, department_id,
 		       source_appointment_id, status, is_free, valid_from, valid_until,
 		       used_at, used_appointment_id, renewed_at, renewed_by_appointment_id,
+		       free_visits_total, free_visits_used,
 		       follow_up_logic_status, logic_notes,
 		       created_at, updated_at
 		FROM follow_ups
@@ -247,6 +293,7 @@ func (fm *FollowUpManager) GetActiveFollowUp(clinicPatientID, clinicID, doctorID
 		&record.ID, &record.ClinicPatientID, &record.ClinicID, &record.DoctorID, &record.DepartmentID,
 		&record.SourceAppointmentID, &record.Status, &record.IsFree, &record.ValidFrom, &record.ValidUntil,
 		&record.UsedAt, &record.UsedAppointmentID, &record.RenewedAt, &record.RenewedByAppointmentID,
+		&record.FreeVisitsTotal, &record.FreeVisitsUsed,
 		&record.FollowUpLogicStatus, &record.LogicNotes,
 		&record.CreatedAt, &record.UpdatedAt,
 	)
@@ -269,70 +316,30 @@ func (fm *FollowUpManager) CheckFollowUpEligibility(clinicPatientID, clinicID, d
 	// ✅ FIRST: Auto-expire any old follow-ups that have passed their valid_until date
 	fm.ExpireOldFollowUps()
 
-	// Check if there's an active free follow-up
-	log.Printf("🔍 CheckFollowUpEligibility: Patient=%s, Clinic=%s, Doctor=%s, Dept=%v",
-		clinicPatientID, clinicID, doctorID, departmentID)
-
-	// Get active follow-up (only returns if valid_until >= CURRENT_DATE)
-	activeFollowUp, err := fm.GetActiveFollowUp(clinicPatientID, clinicID, doctorID, departmentID)
+	decision, _, err := fm.EvaluateFollowUp(context.Background(), clinicPatientID, clinicID, doctorID, departmentID, false)
 	if err != nil {
-		log.Printf("❌ GetActiveFollowUp error: %v", err)
 		return false, false, "", err
 	}
 
-	log.Printf("🔍 GetActiveFollowUp result: %+v", activeFollowUp)
-
-	// ✅ Found active free follow-up
-	if activeFollowUp != nil && activeFollowUp.IsFree {
-		daysRemaining := int(time.Until(activeFollowUp.ValidUntil).Hours() / 24)
-		if daysRemaining < 0 {
-			daysRemaining = 0
-		}
-		log.Printf("✅ Found active free follow-up: %d days remaining", daysRemaining)
-		return true, true, fmt.Sprintf("Free follow-up available (%d days remaining)", daysRemaining), nil
-	}
-
-	// ✅ Check if patient has any expired or used follow-ups for this doctor
-	checkQuery := `
-		SELECT status, is_free, valid_until
-		FROM follow_ups
-		WHERE clinic_patient_id = $1
-		  AND clinic_id = $2
-		  AND doctor_id = $3
-	`
-	checkArgs := []interface{}{clinicPatientID, clinicID, doctorID}
-
-	if departmentID != nil {
-		checkQuery += ` AND department_id = $4`
-		checkArgs = append(checkArgs, *departmentID)
-	} else {
-		checkQuery += ` AND department_id IS NULL`
-	}
-
-	checkQuery += ` ORDER BY created_at DESC LIMIT 1`
+	return decision.IsFree, decision.Eligible, decision.Message, nil
+}
 
-	var followUpStatus string
-	var isFree bool
-	var validUntil time.Time
+// EvaluateFollowUp resolves the follow-up policy for the doctor+department and applies it
+// to the patient's latest follow-up window and visit history
+func (fm *FollowUpManager) EvaluateFollowUp(ctx context.Context, clinicPatientID, clinicID, doctorID string, departmentID *string, viaVideo bool) (followup.Decision, followup.Policy, error) {
+	log.Printf("🔍 EvaluateFollowUp: Patient=%s, Clinic=%s, Doctor=%s, Dept=%v, Video=%v",
+		clinicPatientID, clinicID, doctorID, departmentID, viaVideo)
 
-	err = fm.DB.QueryRow(checkQuery, checkArgs...).Scan(&followUpStatus, &isFree, &validUntil)
+	policy := fm.LoadPolicy(ctx, clinicID, doctorID, departmentID)
 
-	if err == nil {
-		// Found a follow-up record (even if expired/used)
-		if followUpStatus == "expired" {
-			log.Printf("⏰ Follow-up expired on %s", validUntil.Format("2006-01-02"))
-			return false, true, "Free follow-up expired. This follow-up requires payment.", nil
-		}
-		if followUpStatus == "used" {
-			log.Printf("✅ Follow-up already used")
-			return false, true, "Free follow-up already used. This follow-up requires payment.", nil
-		}
-		// If status is "active" but not returned by GetActiveFollowUp, it might be expired but not marked
-		if followUpStatus == "active" && validUntil.Before(time.Now()) {
-			log.Printf("⏰ Follow-up active but expired (should be marked as expired)")
-			return false, true, "Free follow-up expired. This follow-up requires payment.", nil
-		}
+	// Latest follow-up windows for this doctor, whatever their status; the
+	// policy decides whether windows from other departments count
+	req := followup.Request{Policy: policy, ViaVideo: viaVideo, Now: time.Now()}
+	latest, latestAnyDepartment, err := followup.LoadWindows(ctx, fm.DB, clinicPatientID, clinicID, doctorID, departmentID)
+	if err != nil {
+		return followup.Decision{}, policy, err
 	}
+	req.Latest, req.LatestAnyDepartment = latest, latestAnyDepartment
 
 	// Check if patient has ANY appointment with this doctor+department (even if expired)
 	// This determines if they can book a PAID follow-up
@@ -355,17 +362,15 @@ func (fm *FollowUpManager) CheckFollowUpEligibility(clinicPatientID, clinicID, d
 
 	query += `)`
 
-	var hasPreviousAppointment bool
-	err = fm.DB.QueryRow(query, args...).Scan(&hasPreviousAppointment)
+	err = fm.DB.QueryRowContext(ctx, query, args...).Scan(&req.HasPreviousVisit)
 	if err != nil {
-		return false, false, "", fmt.Errorf("failed to check previous appointments: %w", err)
+		return followup.Decision{}, policy, fmt.Errorf("failed to check previous appointments: %w", err)
 	}
 
-	if hasPreviousAppointment {
-		return false, true, "Follow-up available (payment required)", nil
-	}
+	decision := followup.Evaluate(req)
+	log.Printf("🔍 Follow-up decision (%s policy): %+v", policy.Scope(), decision)
 
-	return false, false, "No previous appointment found with this doctor", nil
+	return decision, policy, nil
 }
 
 // ExpireOldFollowUps marks follow-ups as expired if they're past their validity date
@@ -407,7 +412,7 @@ func (fm *FollowUpManager) ExpireOldFollowUpsContext(ctx context.Context) (int64
 		UPDATE follow_ups
 		SET status = 'expired',
 		    follow_up_logic_status = 'expired',
-		    logic_notes = 'Follow-up expired after 5 days. Patient can book follow-up again but next one is PAID.',
+		    logic_notes = 'Follow-up expired after its policy validity period. Patient can book follow-up again but next one is PAID.',
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE status = 'active' AND valid_until < CURRENT_DATE
 	`)
@@ -438,6 +443,7 @@ func (fm *FollowUpManager) GetAllActiveFollowUps(clinicPatientID, clinicID strin
 		SELECT id, clinic_patient_id, clinic_id, doctor_id, department_id,
 		       source_appointment_id, status, is_free, valid_from, valid_until,
 		       used_at, used_appointment_id, renewed_at, renewed_by_appointment_id,
+		       free_visits_total, free_visits_used,
 		       follow_up_logic_status, logic_notes,
 		       created_at, updated_at
 		FROM follow_ups
@@ -460,6 +466,7 @@ func (fm *FollowUpManager) GetAllActiveFollowUps(clinicPatientID, clinicID strin
 			&record.ID, &record.ClinicPatientID, &record.ClinicID, &record.DoctorID, &record.DepartmentID,
 			&record.SourceAppointmentID, &record.Status, &record.IsFree, &record.ValidFrom, &record.ValidUntil,
 			&record.UsedAt, &record.UsedAppointmentID, &record.RenewedAt, &record.RenewedByAppointmentID,
+			&record.FreeVisitsTotal, &record.FreeVisitsUsed,
 			&record.FollowUpLogicStatus, &record.LogicNotes,
 			&record.CreatedAt, &record.UpdatedAt,
 		)
@@ -1257,7 +1257,8 @@ func populateAppointmentHistory(ctx context.Context, patient *ClinicPatientRespo
 			checkDoctorID = lastAppt.DoctorID
 		}
 
-		isFree, isEligible, message, err := followUpHelper.CheckFollowUpEligibility(
+		decision, err := followUpHelper.EvaluateFollowUp(
+			ctx,
 			patient.ID,
 			patient.ClinicID,
 			checkDoctorID,
@@ -1265,15 +1266,13 @@ func populateAppointmentHistory(ctx context.Context, patient *ClinicPatientRespo
 		)
 
 		if err == nil {
-			eligibility.Eligible = isEligible
-			eligibility.IsFree = isFree
-			eligibility.Message = message
-
-			if isFree && isEligible {
-				// Calculate days remaining from follow_ups table
-				if daysSince <= 5 {
-					eligibility.DaysRemaining = 5 - daysSince
-				}
+			eligibility.Eligible = decision.Eligible
+			eligibility.IsFree = decision.IsFree
+			eligibility.Message = decision.Message
+
+			if decision.IsFree && decision.Eligible {
+				// Days remaining come from the follow-up window set by the clinic's policy
+				eligibility.DaysRemaining = decision.DaysRemaining
 			}
 		} else {
 			// Fallback to default message if query fails
@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"organization-service/config"
+	"organization-service/middleware"
+
+	"shared-followup"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =====================================================
+// FOLLOW-UP POLICY APIs
+// Policies are resolved most-specific-first:
+// doctor+department > doctor > department > clinic > default
+// =====================================================
+
+type FollowUpPolicyInput struct {
+	ClinicID             string   `json:"clinic_id" binding:"required,uuid"`
+	DepartmentID         *string  `json:"department_id" binding:"omitempty,uuid"`
+	DoctorID             *string  `json:"doctor_id" binding:"omitempty,uuid"`
+	ValidityDays         int      `json:"validity_days" binding:"required"`
+	FreeVisits           *int     `json:"free_visits"`
+	DiscountedFee        *float64 `json:"discounted_fee"`
+	VideoCounts          *bool    `json:"video_counts"`
+	CrossDepartmentReset bool     `json:"cross_department_reset"`
+}
+
+type UpdateFollowUpPolicyInput struct {
+	ValidityDays         *int     `json:"validity_days"`
+	FreeVisits           *int     `json:"free_visits"`
+	DiscountedFee        *float64 `json:"discounted_fee"`
+	ClearDiscountedFee   bool     `json:"clear_discounted_fee"`
+	VideoCounts          *bool    `json:"video_counts"`
+	CrossDepartmentReset *bool    `json:"cross_department_reset"`
+	IsActive             *bool    `json:"is_active"`
+}
+
+type followUpPolicyResponse struct {
+	followup.Policy
+	Scope string `json:"scope"`
+}
+
+func toFollowUpPolicyResponse(p followup.Policy) followUpPolicyResponse {
+	return followUpPolicyResponse{Policy: p, Scope: p.Scope()}
+}
+
+// CreateFollowUpPolicy - Create a follow-up policy for a clinic, department, doctor or doctor+department
+// POST /followup-policies
+func CreateFollowUpPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var input FollowUpPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.SendValidationError(c, "Invalid input data", err.Error())
+		return
+	}
+
+	policy := followup.DefaultPolicy(input.ClinicID)
+	policy.DepartmentID = input.DepartmentID
+	policy.DoctorID = input.DoctorID
+	policy.ValidityDays = input.ValidityDays
+	policy.DiscountedFee = input.DiscountedFee
+	policy.CrossDepartmentReset = input.CrossDepartmentReset
+	if input.FreeVisits != nil {
+		policy.FreeVisits = *input.FreeVisits
+	}
+	if input.VideoCounts != nil {
+		policy.VideoCounts = *input.VideoCounts
+	}
+
+	if err := policy.Validate(); err != nil {
+		middleware.SendValidationError(c, err.Error(), nil)
+		return
+	}
+
+	// Department and doctor must belong to the clinic
+	var clinicExists, departmentOK, doctorOK bool
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM clinics WHERE id = $1 AND is_active = true),
+			($2::uuid IS NULL OR EXISTS(SELECT 1 FROM departments WHERE id = $2 AND clinic_id = $1)),
+			($3::uuid IS NULL OR EXISTS(SELECT 1 FROM clinic_doctor_links WHERE doctor_id = $3 AND clinic_id = $1 AND is_active = true))
+	`, input.ClinicID, input.DepartmentID, input.DoctorID).Scan(&clinicExists, &departmentOK, &doctorOK)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to validate follow-up policy scope")
+		return
+	}
+	if !clinicExists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Clinic not found", "message": "Clinic not found or is inactive"})
+		return
+	}
+	if !departmentOK {
+		middleware.SendValidationError(c, "Department does not belong to this clinic", nil)
+		return
+	}
+	if !doctorOK {
+		middleware.SendValidationError(c, "Doctor is not linked to this clinic", nil)
+		return
+	}
+
+	row := config.DB.QueryRowContext(ctx, `
+		INSERT INTO follow_up_policies (
+			clinic_id, department_id, doctor_id, validity_days, free_visits,
+			discounted_fee, video_counts, cross_department_reset
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING
+		RETURNING `+followup.PolicyColumns,
+		policy.ClinicID, policy.DepartmentID, policy.DoctorID, policy.ValidityDays, policy.FreeVisits,
+		policy.DiscountedFee, policy.VideoCounts, policy.CrossDepartmentReset)
+
+	created, err := followup.ScanPolicy(row.Scan)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Policy exists",
+			"message": "A follow-up policy already exists for this scope; update it instead",
+		})
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to create follow-up policy")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Follow-up policy created successfully",
+		"policy":  toFollowUpPolicyResponse(created),
+	})
+}
+
+// ListFollowUpPolicies - List follow-up policies for a clinic
+// GET /followup-policies?clinic_id=xxx
+func ListFollowUpPolicies(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	clinicID := c.Query("clinic_id")
+	if clinicID == "" {
+		clinicID = c.GetString("clinic_id")
+	}
+	if clinicID == "" {
+		middleware.SendValidationError(c, "clinic_id is required", nil)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT `+followup.PolicyColumns+`
+		FROM follow_up_policies
+		WHERE clinic_id = $1
+		ORDER BY (doctor_id IS NOT NULL), (department_id IS NOT NULL), created_at
+	`, clinicID)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch follow-up policies")
+		return
+	}
+	defer rows.Close()
+
+	policies := make([]followUpPolicyResponse, 0)
+	for rows.Next() {
+		p, err := followup.ScanPolicy(rows.Scan)
+		if err != nil {
+			middleware.SendDatabaseError(c, "Failed to read follow-up policies")
+			return
+		}
+		policies = append(policies, toFollowUpPolicyResponse(p))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":    len(policies),
+		"policies": policies,
+		"default":  toFollowUpPolicyResponse(followup.DefaultPolicy(clinicID)),
+	})
+}
+
+// ResolveFollowUpPolicy - Show which policy applies to a doctor+department
+// GET /followup-policies/resolve?clinic_id=xxx&doctor_id=xxx&department_id=xxx
+func ResolveFollowUpPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	clinicID := c.Query("clinic_id")
+	doctorID := c.Query("doctor_id")
+	if clinicID == "" || doctorID == "" {
+		middleware.SendValidationError(c, "clinic_id and doctor_id are required", nil)
+		return
+	}
+
+	var departmentID *string
+	if dept := c.Query("department_id"); dept != "" {
+		departmentID = &dept
+	}
+
+	policy, err := followup.LoadPolicy(ctx, config.DB, clinicID, doctorID, departmentID)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to resolve follow-up policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": toFollowUpPolicyResponse(policy)})
+}
+
+// UpdateFollowUpPolicy - Update a follow-up policy
+// PUT /followup-policies/:id
+func UpdateFollowUpPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	policyID := c.Param("id")
+
+	var input UpdateFollowUpPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		middleware.SendValidationError(c, "Invalid input data", err.Error())
+		return
+	}
+
+	current, err := followup.ScanPolicy(config.DB.QueryRowContext(ctx, `
+		SELECT `+followup.PolicyColumns+` FROM follow_up_policies WHERE id = $1
+	`, policyID).Scan)
+	if err == sql.ErrNoRows {
+		middleware.SendNotFoundError(c, "follow-up policy")
+		return
+	}
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to fetch follow-up policy")
+		return
+	}
+
+	if input.ValidityDays != nil {
+		current.ValidityDays = *input.ValidityDays
+	}
+	if input.FreeVisits != nil {
+		current.FreeVisits = *input.FreeVisits
+	}
+	if input.DiscountedFee != nil {
+		current.DiscountedFee = input.DiscountedFee
+	}
+	if input.ClearDiscountedFee {
+		current.DiscountedFee = nil
+	}
+	if input.VideoCounts != nil {
+		current.VideoCounts = *input.VideoCounts
+	}
+	if input.CrossDepartmentReset != nil {
+		current.CrossDepartmentReset = *input.CrossDepartmentReset
+	}
+	if input.IsActive != nil {
+		current.IsActive = *input.IsActive
+	}
+
+	if err := current.Validate(); err != nil {
+		middleware.SendValidationError(c, err.Error(), nil)
+		return
+	}
+
+	updated, err := followup.ScanPolicy(config.DB.QueryRowContext(ctx, `
+		UPDATE follow_up_policies
+		SET validity_days = $1,
+		    free_visits = $2,
+		    discounted_fee = $3,
+		    video_counts = $4,
+		    cross_department_reset = $5,
+		    is_active = $6,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
+		RETURNING `+followup.PolicyColumns,
+		current.ValidityDays, current.FreeVisits, current.DiscountedFee, current.VideoCounts,
+		current.CrossDepartmentReset, current.IsActive, policyID).Scan)
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to update follow-up policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Follow-up policy updated successfully",
+		"policy":  toFollowUpPolicyResponse(updated),
+	})
+}
+
+// DeleteFollowUpPolicy - Remove a follow-up policy (the next less specific policy applies)
+// DELETE /followup-policies/:id
+func DeleteFollowUpPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := config.DB.ExecContext(ctx, `DELETE FROM follow_up_policies WHERE id = $1`, c.Param("id"))
+	if err != nil {
+		middleware.SendDatabaseError(c, "Failed to delete follow-up policy")
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		middleware.SendNotFoundError(c, "follow-up policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Follow-up policy deleted successfully"})
+}
@@ -0,0 +1,20 @@
+// Package clock is the pharmacy's business calendar, which runs on India Standard Time
+package clock
+
+import "time"
+
+// IST is the zone pharmacies trade in; the fixed offset stands in where the
+// zone database is missing
+var IST = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		loc = time.FixedZone("IST", 5*3600+1800)
+	}
+	return loc
+}()
+
+// Today is the current business date, as a UTC midnight like scanned DATE columns
+func Today() time.Time {
+	now := time.Now().In(IST)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
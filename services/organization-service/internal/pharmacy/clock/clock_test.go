@@ -0,0 +1,29 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToday(t *testing.T) {
+	before := time.Now().In(IST)
+	got := Today()
+	after := time.Now().In(IST)
+
+	if got.Location() != time.UTC || !got.Equal(got.Truncate(24*time.Hour)) {
+		t.Fatalf("Today() = %v, want a UTC midnight", got)
+	}
+	// The IST date may turn between the reads
+	sameDay := func(t time.Time) bool {
+		return got.Year() == t.Year() && got.Month() == t.Month() && got.Day() == t.Day()
+	}
+	if !sameDay(before) && !sameDay(after) {
+		t.Errorf("Today() = %v, IST date is %v", got, after)
+	}
+}
+
+func TestIST(t *testing.T) {
+	if _, offset := time.Date(2026, time.January, 1, 0, 0, 0, 0, IST).Zone(); offset != 5*3600+1800 {
+		t.Errorf("IST offset = %ds, want 19800", offset)
+	}
+}
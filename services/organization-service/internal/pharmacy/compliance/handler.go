@@ -0,0 +1,129 @@
+package compliance
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"organization-service/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// ListRegister returns register entries; ?schedule=H1|X&from=&to=&search=&limit=&offset=
+func (h *Handler) ListRegister(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, offset := 10, 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := strconv.Atoi(o); err == nil {
+			offset = val
+		}
+	}
+
+	entries, total, err := h.svc.ListRegister(c.Request.Context(), pharmacyID, filter, limit, offset)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+		"meta": gin.H{
+			"total":  total,
+			"limit":  limit,
+			"offset": offset,
+		},
+	})
+}
+
+// ExportRegister downloads the Schedule H1 or X register as CSV; ?schedule=H1|X&from=&to=
+func (h *Handler) ExportRegister(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Search = ""
+
+	data, filename, err := h.svc.ExportRegisterCSV(c.Request.Context(), pharmacyID, filter)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, "text/csv", data)
+}
+
+func parseFilter(c *gin.Context) (RegisterFilter, error) {
+	filter := RegisterFilter{
+		ScheduleType: NormalizeSchedule(c.Query("schedule")),
+		Search:       c.Query("search"),
+	}
+	if filter.ScheduleType != "" && filter.ScheduleType != ScheduleH1 && filter.ScheduleType != ScheduleX {
+		return filter, fmt.Errorf("schedule must be H1 or X")
+	}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse("2006-01-02", from); err != nil {
+			return filter, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse("2006-01-02", to); err != nil {
+			return filter, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, fmt.Errorf("to date cannot be before from date")
+	}
+	return filter, nil
+}
+
+// RespondRequirementsNotMet reports unmet requirements together with what the sale still needs
+func RespondRequirementsNotMet(c *gin.Context, err *RequirementsError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"data":    err.Requirements,
+	})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"success": false, "error": message})
+}
@@ -0,0 +1,186 @@
+package compliance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScheduleH  = "H"
+	ScheduleH1 = "H1"
+	ScheduleX  = "X"
+)
+
+// RequiredSignOffs is the number of distinct pharmacists who must sign off a Schedule X sale
+const RequiredSignOffs = 2
+
+type EntryType string
+
+const (
+	EntryDispense EntryType = "DISPENSE"
+	EntryReturn   EntryType = "RETURN"
+)
+
+// NormalizeSchedule maps free-text schedule values ("Schedule H1", "sch-x", "h 1") to H, H1, X, ...
+func NormalizeSchedule(raw string) string {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimPrefix(s, "SCHEDULE")
+	s = strings.TrimPrefix(s, "SCH")
+	return strings.NewReplacer(" ", "", "-", "", "_", "", ".", "").Replace(s)
+}
+
+type Product struct {
+	ID           uuid.UUID `json:"product_id"`
+	Name         string    `json:"name"`
+	BrandName    string    `json:"brand_name"`
+	ScheduleType string    `json:"schedule_type"`
+	IsRxRequired bool      `json:"is_rx_required"`
+}
+
+func (p Product) RequiresRx() bool {
+	switch p.ScheduleType {
+	case ScheduleH, ScheduleH1, ScheduleX:
+		return true
+	}
+	return p.IsRxRequired
+}
+
+// Registered reports whether dispensing the product must be entered in the register
+func (p Product) Registered() bool {
+	return p.ScheduleType == ScheduleH1 || p.ScheduleType == ScheduleX
+}
+
+type PrescriberDetails struct {
+	SaleID            uuid.UUID  `json:"sale_id"`
+	PrescriptionRef   string     `json:"prescription_ref"`
+	PrescriberName    string     `json:"prescriber_name"`
+	PrescriberRegNo   string     `json:"prescriber_reg_no"`
+	PrescriberAddress string     `json:"prescriber_address,omitempty"`
+	PrescriptionDate  *time.Time `json:"prescription_date,omitempty"`
+	PatientAddress    string     `json:"patient_address,omitempty"`
+	RecordedByName    string     `json:"recorded_by_name,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type SignOff struct {
+	ID       uuid.UUID `json:"id"`
+	SaleID   uuid.UUID `json:"sale_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	UserName string    `json:"user_name"`
+	SignedAt time.Time `json:"signed_at"`
+}
+
+// Requirements is what a sale still needs before it can be finalized
+type Requirements struct {
+	RxRequired        bool               `json:"rx_required"`
+	RxProducts        []string           `json:"rx_products"`
+	RegisterProducts  []string           `json:"register_products"`
+	ScheduleXProducts []string           `json:"schedule_x_products"`
+	Prescriber        *PrescriberDetails `json:"prescriber,omitempty"`
+	SignOffs          []SignOff          `json:"sign_offs"`
+	SignOffsRequired  int                `json:"sign_offs_required"`
+	Missing           []string           `json:"missing"`
+	Satisfied         bool               `json:"satisfied"`
+}
+
+// Patient identifies who the controlled items are dispensed to
+type Patient struct {
+	ID      *uuid.UUID
+	Name    string
+	Phone   string
+	Address string
+}
+
+// DispenseLine is one batch line of a completed sale
+type DispenseLine struct {
+	ProductID     uuid.UUID
+	MedicineName  string
+	MedicineBrand string
+	BatchID       uuid.UUID
+	BatchNo       string
+	ExpiryDate    time.Time
+	Quantity      int
+}
+
+type DispenseInput struct {
+	SaleID          uuid.UUID
+	InvoiceNumber   string
+	Patient         Patient
+	Lines           []DispenseLine
+	DispensedBy     uuid.UUID
+	DispensedByName string
+}
+
+type ReturnLine struct {
+	ProductID uuid.UUID
+	BatchID   uuid.UUID
+	Quantity  int
+}
+
+type ReturnInput struct {
+	SaleID       uuid.UUID
+	ReturnNumber string
+	Lines        []ReturnLine
+	HandledBy    string
+}
+
+type RegisterEntry struct {
+	ID                uuid.UUID  `json:"id"`
+	PharmacyID        uuid.UUID  `json:"pharmacy_id"`
+	ScheduleType      string     `json:"schedule_type"`
+	SerialNo          int        `json:"serial_no"`
+	EntryType         EntryType  `json:"entry_type"`
+	EntryDate         time.Time  `json:"entry_date"`
+	SaleID            uuid.UUID  `json:"sale_id"`
+	DocumentNo        string     `json:"document_no"`
+	MedicineID        uuid.UUID  `json:"medicine_id"`
+	MedicineName      string     `json:"medicine_name"`
+	MedicineBrand     string     `json:"medicine_brand,omitempty"`
+	BatchID           uuid.UUID  `json:"batch_id"`
+	BatchNo           string     `json:"batch_no"`
+	ExpiryDate        *time.Time `json:"expiry_date,omitempty"`
+	Quantity          int        `json:"quantity"`
+	PatientID         *uuid.UUID `json:"patient_id,omitempty"`
+	PatientName       string     `json:"patient_name"`
+	PatientPhone      string     `json:"patient_phone,omitempty"`
+	PatientAddress    string     `json:"patient_address,omitempty"`
+	PrescriberName    string     `json:"prescriber_name"`
+	PrescriberRegNo   string     `json:"prescriber_reg_no"`
+	PrescriberAddress string     `json:"prescriber_address,omitempty"`
+	PrescriptionRef   string     `json:"prescription_ref"`
+	PrescriptionDate  *time.Time `json:"prescription_date,omitempty"`
+	DispensedBy       *uuid.UUID `json:"dispensed_by,omitempty"`
+	DispensedByName   string     `json:"dispensed_by_name,omitempty"`
+	SignedOffBy       []string   `json:"signed_off_by"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+type RegisterFilter struct {
+	ScheduleType string
+	From         time.Time
+	To           time.Time
+	Search       string
+}
+
+// RequirementsError is returned when a sale is finalized without its compliance requirements met
+type RequirementsError struct {
+	Requirements *Requirements
+}
+
+func (e *RequirementsError) Error() string {
+	return fmt.Sprintf("controlled drug requirements not met: %s", strings.Join(e.Requirements.Missing, "; "))
+}
+
+// Request Structs
+
+type SetPrescriberRequest struct {
+	PrescriptionRef   string `json:"prescription_ref" validate:"max=100"`
+	PrescriberName    string `json:"prescriber_name" validate:"max=255"`
+	PrescriberRegNo   string `json:"prescriber_reg_no" validate:"required,max=100"`
+	PrescriberAddress string `json:"prescriber_address" validate:"max=500"`
+	PrescriptionDate  string `json:"prescription_date" validate:"omitempty,datetime=2006-01-02"`
+	PatientAddress    string `json:"patient_address" validate:"max=500"`
+}
@@ -0,0 +1,317 @@
+package compliance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	GetProducts(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) ([]Product, error)
+
+	GetPrescriber(ctx context.Context, pharmacyID, saleID uuid.UUID) (*PrescriberDetails, error)
+	UpsertPrescriber(ctx context.Context, pharmacyID uuid.UUID, d *PrescriberDetails, userID uuid.UUID) error
+
+	// AddSignOff returns false when the user has already signed the sale
+	AddSignOff(ctx context.Context, pharmacyID uuid.UUID, s *SignOff) (bool, error)
+	ListSignOffs(ctx context.Context, pharmacyID, saleID uuid.UUID) ([]SignOff, error)
+	ClearSignOffs(ctx context.Context, pharmacyID, saleID uuid.UUID) error
+
+	// InsertEntries appends entries to the register, numbering them per schedule.
+	// With tx the entries commit with the caller's transaction, otherwise on their own.
+	InsertEntries(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, entries []RegisterEntry) error
+	ListSaleEntries(ctx context.Context, pharmacyID, saleID uuid.UUID, entryType EntryType) ([]RegisterEntry, error)
+	ListEntries(ctx context.Context, pharmacyID uuid.UUID, filter RegisterFilter, limit, offset int) ([]RegisterEntry, int, error)
+	GetPharmacyDetails(ctx context.Context, pharmacyID uuid.UUID) (name, address, license string, err error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) GetProducts(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) ([]Product, error) {
+	query := `
+		SELECT id, name, COALESCE(brand_name, ''), COALESCE(schedule_type, ''), COALESCE(is_rx_required, false)
+		FROM inventory.medicines
+		WHERE pharmacy_id = $1 AND id = ANY($2)
+	`
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, query, pharmacyID, pq.Array(strIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.BrandName, &p.ScheduleType, &p.IsRxRequired); err != nil {
+			return nil, err
+		}
+		p.ScheduleType = NormalizeSchedule(p.ScheduleType)
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+func (r *postgresRepository) GetPrescriber(ctx context.Context, pharmacyID, saleID uuid.UUID) (*PrescriberDetails, error) {
+	d := &PrescriberDetails{}
+	var address, patientAddress, recordedBy sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT sale_id, prescription_ref, prescriber_name, prescriber_reg_no, prescriber_address,
+		       prescription_date, patient_address, recorded_by_name, updated_at
+		FROM sales_schema.sale_prescribers
+		WHERE pharmacy_id = $1 AND sale_id = $2
+	`, pharmacyID, saleID).Scan(
+		&d.SaleID, &d.PrescriptionRef, &d.PrescriberName, &d.PrescriberRegNo, &address,
+		&d.PrescriptionDate, &patientAddress, &recordedBy, &d.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prescriber details: %w", err)
+	}
+	d.PrescriberAddress = address.String
+	d.PatientAddress = patientAddress.String
+	d.RecordedByName = recordedBy.String
+	return d, nil
+}
+
+func (r *postgresRepository) UpsertPrescriber(ctx context.Context, pharmacyID uuid.UUID, d *PrescriberDetails, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.sale_prescribers (
+			sale_id, pharmacy_id, prescription_ref, prescriber_name, prescriber_reg_no, prescriber_address,
+			prescription_date, patient_address, recorded_by, recorded_by_name, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+		ON CONFLICT (sale_id) DO UPDATE SET
+			prescription_ref = EXCLUDED.prescription_ref,
+			prescriber_name = EXCLUDED.prescriber_name,
+			prescriber_reg_no = EXCLUDED.prescriber_reg_no,
+			prescriber_address = EXCLUDED.prescriber_address,
+			prescription_date = EXCLUDED.prescription_date,
+			patient_address = EXCLUDED.patient_address,
+			recorded_by = EXCLUDED.recorded_by,
+			recorded_by_name = EXCLUDED.recorded_by_name,
+			updated_at = EXCLUDED.updated_at
+	`, d.SaleID, pharmacyID, d.PrescriptionRef, d.PrescriberName, d.PrescriberRegNo, d.PrescriberAddress,
+		d.PrescriptionDate, d.PatientAddress, userID, d.RecordedByName, d.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save prescriber details: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) AddSignOff(ctx context.Context, pharmacyID uuid.UUID, s *SignOff) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.sale_signoffs (id, sale_id, pharmacy_id, user_id, user_name, signed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (sale_id, user_id) DO NOTHING
+	`, s.ID, s.SaleID, pharmacyID, s.UserID, s.UserName, s.SignedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record sign-off: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *postgresRepository) ListSignOffs(ctx context.Context, pharmacyID, saleID uuid.UUID) ([]SignOff, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, sale_id, user_id, COALESCE(user_name, ''), signed_at
+		FROM sales_schema.sale_signoffs
+		WHERE pharmacy_id = $1 AND sale_id = $2
+		ORDER BY signed_at
+	`, pharmacyID, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sign-offs: %w", err)
+	}
+	defer rows.Close()
+
+	signOffs := []SignOff{}
+	for rows.Next() {
+		var s SignOff
+		if err := rows.Scan(&s.ID, &s.SaleID, &s.UserID, &s.UserName, &s.SignedAt); err != nil {
+			return nil, err
+		}
+		signOffs = append(signOffs, s)
+	}
+	return signOffs, rows.Err()
+}
+
+func (r *postgresRepository) ClearSignOffs(ctx context.Context, pharmacyID, saleID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sales_schema.sale_signoffs WHERE pharmacy_id = $1 AND sale_id = $2`, pharmacyID, saleID)
+	return err
+}
+
+func (r *postgresRepository) InsertEntries(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, entries []RegisterEntry) error {
+	if tx == nil {
+		own, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer own.Rollback()
+		if err := r.InsertEntries(ctx, own, pharmacyID, entries); err != nil {
+			return err
+		}
+		return own.Commit()
+	}
+
+	// Each schedule keeps its own unbroken serial; serialise writers per pharmacy
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('controlled_drug_register:' || $1::text))`, pharmacyID); err != nil {
+		return fmt.Errorf("failed to lock register: %w", err)
+	}
+
+	serials := make(map[string]int)
+	for i := range entries {
+		e := &entries[i]
+		if _, ok := serials[e.ScheduleType]; !ok {
+			var last int
+			if err := tx.QueryRowContext(ctx, `
+				SELECT COALESCE(MAX(serial_no), 0) FROM sales_schema.controlled_drug_register
+				WHERE pharmacy_id = $1 AND schedule_type = $2
+			`, pharmacyID, e.ScheduleType).Scan(&last); err != nil {
+				return fmt.Errorf("failed to read register serial: %w", err)
+			}
+			serials[e.ScheduleType] = last
+		}
+		serials[e.ScheduleType]++
+		e.SerialNo = serials[e.ScheduleType]
+		e.PharmacyID = pharmacyID
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO sales_schema.controlled_drug_register (
+				id, pharmacy_id, schedule_type, serial_no, entry_type, entry_date, sale_id, document_no,
+				medicine_id, medicine_name, medicine_brand, batch_id, batch_no, expiry_date, quantity,
+				patient_id, patient_name, patient_phone, patient_address,
+				prescriber_name, prescriber_reg_no, prescriber_address, prescription_ref, prescription_date,
+				dispensed_by, dispensed_by_name, signed_off_by, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+				$20, $21, $22, $23, $24, $25, $26, $27, $28)
+		`, e.ID, pharmacyID, e.ScheduleType, e.SerialNo, e.EntryType, e.EntryDate, e.SaleID, e.DocumentNo,
+			e.MedicineID, e.MedicineName, e.MedicineBrand, e.BatchID, e.BatchNo, e.ExpiryDate, e.Quantity,
+			e.PatientID, e.PatientName, e.PatientPhone, e.PatientAddress,
+			e.PrescriberName, e.PrescriberRegNo, e.PrescriberAddress, e.PrescriptionRef, e.PrescriptionDate,
+			e.DispensedBy, e.DispensedByName, pq.Array(e.SignedOffBy), e.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to write register entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+const entryColumns = `
+	id, pharmacy_id, schedule_type, serial_no, entry_type, entry_date, sale_id, document_no,
+	medicine_id, medicine_name, COALESCE(medicine_brand, ''), batch_id, COALESCE(batch_no, ''), expiry_date, quantity,
+	patient_id, patient_name, COALESCE(patient_phone, ''), COALESCE(patient_address, ''),
+	prescriber_name, prescriber_reg_no, COALESCE(prescriber_address, ''), prescription_ref, prescription_date,
+	dispensed_by, COALESCE(dispensed_by_name, ''), signed_off_by, created_at
+`
+
+func scanEntry(rows *sql.Rows) (RegisterEntry, error) {
+	var e RegisterEntry
+	err := rows.Scan(
+		&e.ID, &e.PharmacyID, &e.ScheduleType, &e.SerialNo, &e.EntryType, &e.EntryDate, &e.SaleID, &e.DocumentNo,
+		&e.MedicineID, &e.MedicineName, &e.MedicineBrand, &e.BatchID, &e.BatchNo, &e.ExpiryDate, &e.Quantity,
+		&e.PatientID, &e.PatientName, &e.PatientPhone, &e.PatientAddress,
+		&e.PrescriberName, &e.PrescriberRegNo, &e.PrescriberAddress, &e.PrescriptionRef, &e.PrescriptionDate,
+		&e.DispensedBy, &e.DispensedByName, pq.Array(&e.SignedOffBy), &e.CreatedAt,
+	)
+	return e, err
+}
+
+func (r *postgresRepository) ListSaleEntries(ctx context.Context, pharmacyID, saleID uuid.UUID, entryType EntryType) ([]RegisterEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+entryColumns+`
+		FROM sales_schema.controlled_drug_register
+		WHERE pharmacy_id = $1 AND sale_id = $2 AND entry_type = $3
+		ORDER BY schedule_type, serial_no
+	`, pharmacyID, saleID, entryType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list register entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []RegisterEntry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *postgresRepository) ListEntries(ctx context.Context, pharmacyID uuid.UUID, filter RegisterFilter, limit, offset int) ([]RegisterEntry, int, error) {
+	where := " WHERE pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+
+	if filter.ScheduleType != "" {
+		args = append(args, filter.ScheduleType)
+		where += fmt.Sprintf(" AND schedule_type = $%d", len(args))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		where += fmt.Sprintf(" AND entry_date >= $%d", len(args))
+	}
+	if !filter.To.IsZero() {
+		// To is inclusive of the whole day
+		args = append(args, filter.To.Add(24*time.Hour))
+		where += fmt.Sprintf(" AND entry_date < $%d", len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		where += fmt.Sprintf(" AND (patient_name ILIKE $%d OR medicine_name ILIKE $%d OR prescriber_name ILIKE $%d OR document_no ILIKE $%d)",
+			len(args), len(args), len(args), len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sales_schema.controlled_drug_register"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count register entries: %w", err)
+	}
+
+	query := "SELECT " + entryColumns + " FROM sales_schema.controlled_drug_register" + where + " ORDER BY schedule_type, serial_no"
+	if limit > 0 {
+		args = append(args, limit, offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list register entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []RegisterEntry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+func (r *postgresRepository) GetPharmacyDetails(ctx context.Context, pharmacyID uuid.UUID) (string, string, string, error) {
+	var name, address, license string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT name, COALESCE(address, ''), COALESCE(license_number, '')
+		FROM public.pharmacies WHERE id = $1
+	`, pharmacyID).Scan(&name, &address, &license)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get pharmacy details: %w", err)
+	}
+	return name, address, license, nil
+}
@@ -0,0 +1,388 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	// Evaluate reports which prescription, register and sign-off requirements the products trigger and which are still missing
+	Evaluate(ctx context.Context, pharmacyID, saleID uuid.UUID, productIDs []uuid.UUID, patient Patient) (*Requirements, error)
+	SavePrescriber(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, d PrescriberDetails) (*PrescriberDetails, error)
+	SignOff(ctx context.Context, pharmacyID, saleID, userID uuid.UUID, userName string) ([]SignOff, error)
+	// ClearSignOffs voids sign-offs once the bill they attested to has changed
+	ClearSignOffs(ctx context.Context, pharmacyID, saleID uuid.UUID) error
+	// RecordDispense enters a sale's Schedule H1/X lines in the register inside tx, the checkout transaction
+	RecordDispense(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in DispenseInput) (int, error)
+	// RecordReturn enters returned register lines against the original dispense inside tx, the return's transaction
+	RecordReturn(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in ReturnInput) (int, error)
+	ListRegister(ctx context.Context, pharmacyID uuid.UUID, filter RegisterFilter, limit, offset int) ([]RegisterEntry, int, error)
+	// ExportRegisterCSV renders the register for one schedule in the statutory column layout
+	ExportRegisterCSV(ctx context.Context, pharmacyID uuid.UUID, filter RegisterFilter) ([]byte, string, error)
+}
+
+type complianceService struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &complianceService{repo: repo}
+}
+
+func (s *complianceService) Evaluate(ctx context.Context, pharmacyID, saleID uuid.UUID, productIDs []uuid.UUID, patient Patient) (*Requirements, error) {
+	req := &Requirements{
+		RxProducts:        []string{},
+		RegisterProducts:  []string{},
+		ScheduleXProducts: []string{},
+		SignOffs:          []SignOff{},
+		Missing:           []string{},
+	}
+	if len(productIDs) == 0 {
+		req.Satisfied = true
+		return req, nil
+	}
+
+	products, err := s.repo.GetProducts(ctx, pharmacyID, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load medicines: %w", err)
+	}
+	seen := make(map[uuid.UUID]bool)
+	for _, p := range products {
+		if seen[p.ID] {
+			continue
+		}
+		seen[p.ID] = true
+		if p.RequiresRx() {
+			req.RxProducts = append(req.RxProducts, p.Name)
+		}
+		if p.Registered() {
+			req.RegisterProducts = append(req.RegisterProducts, p.Name)
+		}
+		if p.ScheduleType == ScheduleX {
+			req.ScheduleXProducts = append(req.ScheduleXProducts, p.Name)
+		}
+	}
+	req.RxRequired = len(req.RxProducts) > 0
+
+	if req.RxRequired {
+		if req.Prescriber, err = s.repo.GetPrescriber(ctx, pharmacyID, saleID); err != nil {
+			return nil, err
+		}
+		p := req.Prescriber
+		if p == nil || p.PrescriptionRef == "" || p.PrescriberName == "" || p.PrescriberRegNo == "" {
+			req.Missing = append(req.Missing, fmt.Sprintf("a prescription with prescriber name and registration number is required for %s", strings.Join(req.RxProducts, ", ")))
+		}
+	}
+
+	if len(req.RegisterProducts) > 0 && strings.TrimSpace(patient.Name) == "" {
+		req.Missing = append(req.Missing, "patient name is required for Schedule H1/X items")
+	}
+
+	if len(req.ScheduleXProducts) > 0 {
+		req.SignOffsRequired = RequiredSignOffs
+		if patientAddress(req.Prescriber, patient) == "" {
+			req.Missing = append(req.Missing, "patient address is required for Schedule X items")
+		}
+		if req.SignOffs, err = s.repo.ListSignOffs(ctx, pharmacyID, saleID); err != nil {
+			return nil, err
+		}
+		if len(req.SignOffs) < RequiredSignOffs {
+			req.Missing = append(req.Missing, fmt.Sprintf("Schedule X items need sign-off by %d pharmacists (%d recorded)", RequiredSignOffs, len(req.SignOffs)))
+		}
+	}
+
+	req.Satisfied = len(req.Missing) == 0
+	return req, nil
+}
+
+func patientAddress(p *PrescriberDetails, patient Patient) string {
+	if p != nil && strings.TrimSpace(p.PatientAddress) != "" {
+		return strings.TrimSpace(p.PatientAddress)
+	}
+	return strings.TrimSpace(patient.Address)
+}
+
+func (s *complianceService) SavePrescriber(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, d PrescriberDetails) (*PrescriberDetails, error) {
+	d.PrescriptionRef = strings.TrimSpace(d.PrescriptionRef)
+	d.PrescriberName = strings.TrimSpace(d.PrescriberName)
+	d.PrescriberRegNo = strings.TrimSpace(d.PrescriberRegNo)
+	if d.PrescriptionRef == "" {
+		return nil, fmt.Errorf("prescription_ref is required")
+	}
+	if d.PrescriberName == "" {
+		return nil, fmt.Errorf("prescriber_name is required")
+	}
+	if d.PrescriberRegNo == "" {
+		return nil, fmt.Errorf("prescriber_reg_no is required")
+	}
+	if d.PrescriptionDate != nil && d.PrescriptionDate.After(time.Now()) {
+		return nil, fmt.Errorf("prescription_date cannot be in the future")
+	}
+	d.RecordedByName = userName
+	d.UpdatedAt = time.Now()
+
+	if err := s.repo.UpsertPrescriber(ctx, pharmacyID, &d, userID); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (s *complianceService) SignOff(ctx context.Context, pharmacyID, saleID, userID uuid.UUID, userName string) ([]SignOff, error) {
+	added, err := s.repo.AddSignOff(ctx, pharmacyID, &SignOff{
+		ID:       uuid.New(),
+		SaleID:   saleID,
+		UserID:   userID,
+		UserName: userName,
+		SignedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !added {
+		return nil, fmt.Errorf("you have already signed off this sale; a second pharmacist must sign")
+	}
+	return s.repo.ListSignOffs(ctx, pharmacyID, saleID)
+}
+
+func (s *complianceService) ClearSignOffs(ctx context.Context, pharmacyID, saleID uuid.UUID) error {
+	return s.repo.ClearSignOffs(ctx, pharmacyID, saleID)
+}
+
+func (s *complianceService) RecordDispense(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in DispenseInput) (int, error) {
+	ids := make([]uuid.UUID, 0, len(in.Lines))
+	for _, l := range in.Lines {
+		ids = append(ids, l.ProductID)
+	}
+	products, err := s.repo.GetProducts(ctx, pharmacyID, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load medicines: %w", err)
+	}
+	byID := make(map[uuid.UUID]Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	var prescriber *PrescriberDetails
+	var signedOffBy []string
+	var entries []RegisterEntry
+	now := time.Now()
+	for _, l := range in.Lines {
+		p, ok := byID[l.ProductID]
+		if !ok || !p.Registered() {
+			continue
+		}
+		if prescriber == nil {
+			if prescriber, err = s.repo.GetPrescriber(ctx, pharmacyID, in.SaleID); err != nil {
+				return 0, err
+			}
+			if prescriber == nil {
+				return 0, fmt.Errorf("no prescriber details recorded for sale")
+			}
+			signOffs, err := s.repo.ListSignOffs(ctx, pharmacyID, in.SaleID)
+			if err != nil {
+				return 0, err
+			}
+			signedOffBy = make([]string, 0, len(signOffs))
+			for _, so := range signOffs {
+				signedOffBy = append(signedOffBy, so.UserName)
+			}
+		}
+
+		e := RegisterEntry{
+			ID:                uuid.New(),
+			ScheduleType:      p.ScheduleType,
+			EntryType:         EntryDispense,
+			EntryDate:         now,
+			SaleID:            in.SaleID,
+			DocumentNo:        in.InvoiceNumber,
+			MedicineID:        l.ProductID,
+			MedicineName:      l.MedicineName,
+			MedicineBrand:     l.MedicineBrand,
+			BatchID:           l.BatchID,
+			BatchNo:           l.BatchNo,
+			Quantity:          l.Quantity,
+			PatientID:         in.Patient.ID,
+			PatientName:       in.Patient.Name,
+			PatientPhone:      in.Patient.Phone,
+			PatientAddress:    patientAddress(prescriber, in.Patient),
+			PrescriberName:    prescriber.PrescriberName,
+			PrescriberRegNo:   prescriber.PrescriberRegNo,
+			PrescriberAddress: prescriber.PrescriberAddress,
+			PrescriptionRef:   prescriber.PrescriptionRef,
+			PrescriptionDate:  prescriber.PrescriptionDate,
+			DispensedByName:   in.DispensedByName,
+			SignedOffBy:       []string{},
+			CreatedAt:         now,
+		}
+		if !l.ExpiryDate.IsZero() {
+			expiry := l.ExpiryDate
+			e.ExpiryDate = &expiry
+		}
+		if in.DispensedBy != uuid.Nil {
+			by := in.DispensedBy
+			e.DispensedBy = &by
+		}
+		if p.ScheduleType == ScheduleX {
+			e.SignedOffBy = signedOffBy
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if err := s.repo.InsertEntries(ctx, tx, pharmacyID, entries); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func (s *complianceService) RecordReturn(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in ReturnInput) (int, error) {
+	dispensed, err := s.repo.ListSaleEntries(ctx, pharmacyID, in.SaleID, EntryDispense)
+	if err != nil || len(dispensed) == 0 {
+		return 0, err
+	}
+	type lineKey struct{ product, batch uuid.UUID }
+	original := make(map[lineKey]RegisterEntry, len(dispensed))
+	for _, e := range dispensed {
+		original[lineKey{e.MedicineID, e.BatchID}] = e
+	}
+
+	var entries []RegisterEntry
+	now := time.Now()
+	for _, l := range in.Lines {
+		e, ok := original[lineKey{l.ProductID, l.BatchID}]
+		if !ok {
+			continue
+		}
+		// The return carries the original dispense details so the register reads on its own
+		e.ID = uuid.New()
+		e.EntryType = EntryReturn
+		e.EntryDate = now
+		e.DocumentNo = in.ReturnNumber
+		e.Quantity = l.Quantity
+		e.DispensedBy = nil
+		e.DispensedByName = in.HandledBy
+		e.SignedOffBy = []string{}
+		e.CreatedAt = now
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if err := s.repo.InsertEntries(ctx, tx, pharmacyID, entries); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func (s *complianceService) ListRegister(ctx context.Context, pharmacyID uuid.UUID, filter RegisterFilter, limit, offset int) ([]RegisterEntry, int, error) {
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListEntries(ctx, pharmacyID, filter, limit, offset)
+}
+
+func (s *complianceService) ExportRegisterCSV(ctx context.Context, pharmacyID uuid.UUID, filter RegisterFilter) ([]byte, string, error) {
+	if filter.ScheduleType != ScheduleH1 && filter.ScheduleType != ScheduleX {
+		return nil, "", fmt.Errorf("schedule must be H1 or X")
+	}
+	entries, _, err := s.repo.ListEntries(ctx, pharmacyID, filter, 0, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	name, address, license, err := s.repo.GetPharmacyDetails(ctx, pharmacyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	period := "All dates"
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		period = fmt.Sprintf("%s to %s", formatDay(filter.From), formatDay(filter.To))
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := [][]string{
+		{"Register", "Schedule " + filter.ScheduleType + " Drugs"},
+		{"Pharmacy", name},
+		{"Address", address},
+		{"Drug Licence No", license},
+		{"Period", period},
+		{},
+	}
+	columns := []string{
+		"Sr. No", "Date", "Entry", "Bill / Return No",
+		"Patient Name", "Patient Address", "Prescriber Name", "Prescriber Reg. No", "Prescriber Address",
+		"Prescription Ref", "Prescription Date",
+		"Drug Name", "Brand", "Batch No", "Expiry", "Quantity", "Dispensed By",
+	}
+	if filter.ScheduleType == ScheduleX {
+		columns = append(columns, "Signed Off By")
+	}
+	header = append(header, columns)
+	if err := w.WriteAll(header); err != nil {
+		return nil, "", err
+	}
+
+	for _, e := range entries {
+		row := []string{
+			strconv.Itoa(e.SerialNo),
+			e.EntryDate.Format("2006-01-02"),
+			string(e.EntryType),
+			e.DocumentNo,
+			e.PatientName,
+			e.PatientAddress,
+			e.PrescriberName,
+			e.PrescriberRegNo,
+			e.PrescriberAddress,
+			e.PrescriptionRef,
+			formatDatePtr(e.PrescriptionDate),
+			e.MedicineName,
+			e.MedicineBrand,
+			e.BatchNo,
+			formatDatePtr(e.ExpiryDate),
+			strconv.Itoa(e.Quantity),
+			e.DispensedByName,
+		}
+		if filter.ScheduleType == ScheduleX {
+			row = append(row, strings.Join(e.SignedOffBy, " / "))
+		}
+		if err := w.Write(row); err != nil {
+			return nil, "", err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, "", err
+	}
+
+	filename := fmt.Sprintf("schedule-%s-register-%s.csv", strings.ToLower(filter.ScheduleType), time.Now().Format("20060102"))
+	return buf.Bytes(), filename, nil
+}
+
+func formatDay(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
+
+func formatDatePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
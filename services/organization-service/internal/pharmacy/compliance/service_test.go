@@ -0,0 +1,273 @@
+package compliance
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeSchedule(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"H1", ScheduleH1},
+		{"Schedule H1", ScheduleH1},
+		{"h 1", ScheduleH1},
+		{"sch-x", ScheduleX},
+		{" Schedule.X ", ScheduleX},
+		{"schedule_h", ScheduleH},
+		{"G", "G"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeSchedule(tt.raw); got != tt.want {
+			t.Errorf("NormalizeSchedule(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestProductRules(t *testing.T) {
+	tests := []struct {
+		product        Product
+		wantRx         bool
+		wantRegistered bool
+	}{
+		{Product{ScheduleType: ""}, false, false},
+		{Product{ScheduleType: "G"}, false, false},
+		{Product{ScheduleType: "", IsRxRequired: true}, true, false},
+		{Product{ScheduleType: ScheduleH}, true, false},
+		{Product{ScheduleType: ScheduleH1}, true, true},
+		{Product{ScheduleType: ScheduleX}, true, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.product.RequiresRx(); got != tt.wantRx {
+			t.Errorf("RequiresRx() for %+v = %v, want %v", tt.product, got, tt.wantRx)
+		}
+		if got := tt.product.Registered(); got != tt.wantRegistered {
+			t.Errorf("Registered() for %+v = %v, want %v", tt.product, got, tt.wantRegistered)
+		}
+	}
+}
+
+// fakeRepository serves products, prescriber details and sign-offs from memory
+// and keeps the register entries it is asked to insert
+type fakeRepository struct {
+	Repository
+	products   []Product
+	prescriber *PrescriberDetails
+	signOffs   []SignOff
+	dispensed  []RegisterEntry
+	inserted   []RegisterEntry
+}
+
+func (f *fakeRepository) GetProducts(_ context.Context, _ uuid.UUID, ids []uuid.UUID) ([]Product, error) {
+	var out []Product
+	for _, id := range ids {
+		for _, p := range f.products {
+			if p.ID == id {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepository) GetPrescriber(context.Context, uuid.UUID, uuid.UUID) (*PrescriberDetails, error) {
+	return f.prescriber, nil
+}
+
+func (f *fakeRepository) ListSignOffs(context.Context, uuid.UUID, uuid.UUID) ([]SignOff, error) {
+	return f.signOffs, nil
+}
+
+func (f *fakeRepository) InsertEntries(_ context.Context, _ *sql.Tx, _ uuid.UUID, entries []RegisterEntry) error {
+	f.inserted = append(f.inserted, entries...)
+	return nil
+}
+
+func (f *fakeRepository) ListSaleEntries(context.Context, uuid.UUID, uuid.UUID, EntryType) ([]RegisterEntry, error) {
+	return f.dispensed, nil
+}
+
+var (
+	paracetamol = Product{ID: uuid.New(), Name: "Paracetamol 500mg"}
+	azithro     = Product{ID: uuid.New(), Name: "Azithromycin 500mg", ScheduleType: ScheduleH}
+	alprazolam  = Product{ID: uuid.New(), Name: "Alprazolam 0.5mg", ScheduleType: ScheduleH1}
+	morphine    = Product{ID: uuid.New(), Name: "Morphine 10mg", ScheduleType: ScheduleX}
+)
+
+func TestEvaluate(t *testing.T) {
+	prescriber := &PrescriberDetails{PrescriptionRef: "RX-12", PrescriberName: "Dr. Rao", PrescriberRegNo: "KMC-4411"}
+	withAddress := &PrescriberDetails{PrescriptionRef: "RX-12", PrescriberName: "Dr. Rao", PrescriberRegNo: "KMC-4411", PatientAddress: "12 MG Road"}
+	twoSignOffs := []SignOff{{UserName: "Asha"}, {UserName: "Ravi"}}
+
+	tests := []struct {
+		name        string
+		products    []uuid.UUID
+		prescriber  *PrescriberDetails
+		signOffs    []SignOff
+		patient     Patient
+		wantMissing int
+		wantRx      bool
+		wantSignOff int
+	}{
+		{name: "empty sale"},
+		{name: "over the counter", products: []uuid.UUID{paracetamol.ID}},
+		{name: "schedule H without prescription", products: []uuid.UUID{azithro.ID}, wantMissing: 1, wantRx: true},
+		{name: "schedule H with prescription", products: []uuid.UUID{azithro.ID}, prescriber: prescriber, wantRx: true},
+		{
+			name: "schedule H1 needs the patient's name", products: []uuid.UUID{alprazolam.ID}, prescriber: prescriber,
+			wantMissing: 1, wantRx: true,
+		},
+		{
+			name: "schedule H1 complete", products: []uuid.UUID{alprazolam.ID}, prescriber: prescriber,
+			patient: Patient{Name: "Meena"}, wantRx: true,
+		},
+		{
+			name: "schedule X needs address and two sign-offs", products: []uuid.UUID{morphine.ID}, prescriber: prescriber,
+			signOffs: []SignOff{{UserName: "Asha"}}, patient: Patient{Name: "Meena"},
+			wantMissing: 2, wantRx: true, wantSignOff: RequiredSignOffs,
+		},
+		{
+			name: "schedule X address from the prescription", products: []uuid.UUID{morphine.ID, paracetamol.ID}, prescriber: withAddress,
+			signOffs: twoSignOffs, patient: Patient{Name: "Meena"}, wantRx: true, wantSignOff: RequiredSignOffs,
+		},
+		{
+			name: "schedule X address from the patient", products: []uuid.UUID{morphine.ID}, prescriber: prescriber,
+			signOffs: twoSignOffs, patient: Patient{Name: "Meena", Address: "4 Park Street"}, wantRx: true, wantSignOff: RequiredSignOffs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{
+				products:   []Product{paracetamol, azithro, alprazolam, morphine},
+				prescriber: tt.prescriber,
+				signOffs:   tt.signOffs,
+			}
+			svc := NewService(repo)
+			got, err := svc.Evaluate(context.Background(), uuid.New(), uuid.New(), tt.products, tt.patient)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if len(got.Missing) != tt.wantMissing {
+				t.Errorf("Missing = %q, want %d entries", got.Missing, tt.wantMissing)
+			}
+			if got.Satisfied != (tt.wantMissing == 0) {
+				t.Errorf("Satisfied = %v with %d missing", got.Satisfied, len(got.Missing))
+			}
+			if got.RxRequired != tt.wantRx {
+				t.Errorf("RxRequired = %v, want %v", got.RxRequired, tt.wantRx)
+			}
+			if got.SignOffsRequired != tt.wantSignOff {
+				t.Errorf("SignOffsRequired = %d, want %d", got.SignOffsRequired, tt.wantSignOff)
+			}
+		})
+	}
+}
+
+func TestRecordDispense(t *testing.T) {
+	prescriber := &PrescriberDetails{PrescriptionRef: "RX-12", PrescriberName: "Dr. Rao", PrescriberRegNo: "KMC-4411"}
+	repo := &fakeRepository{
+		products:   []Product{paracetamol, azithro, alprazolam, morphine},
+		prescriber: prescriber,
+		signOffs:   []SignOff{{UserName: "Asha"}, {UserName: "Ravi"}},
+	}
+	svc := NewService(repo)
+
+	n, err := svc.RecordDispense(context.Background(), nil, uuid.New(), DispenseInput{
+		SaleID:        uuid.New(),
+		InvoiceNumber: "INV/25-26/000001",
+		Patient:       Patient{Name: "Meena", Address: "4 Park Street"},
+		Lines: []DispenseLine{
+			{ProductID: paracetamol.ID, Quantity: 10},
+			{ProductID: azithro.ID, Quantity: 3},
+			{ProductID: alprazolam.ID, Quantity: 15},
+			{ProductID: morphine.ID, Quantity: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RecordDispense() error = %v", err)
+	}
+	if n != 2 || len(repo.inserted) != 2 {
+		t.Fatalf("recorded %d entries (%d inserted), want only the H1 and X lines", n, len(repo.inserted))
+	}
+
+	tests := []struct {
+		entry       RegisterEntry
+		schedule    string
+		signedOffBy []string
+	}{
+		{repo.inserted[0], ScheduleH1, []string{}},
+		{repo.inserted[1], ScheduleX, []string{"Asha", "Ravi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			e := tt.entry
+			if e.ScheduleType != tt.schedule || e.EntryType != EntryDispense {
+				t.Errorf("entry is %s %s, want %s %s", e.ScheduleType, e.EntryType, tt.schedule, EntryDispense)
+			}
+			if e.PrescriberRegNo != "KMC-4411" || e.PatientAddress != "4 Park Street" {
+				t.Errorf("prescriber/address = %q/%q, want the sale's details", e.PrescriberRegNo, e.PatientAddress)
+			}
+			if !reflect.DeepEqual(e.SignedOffBy, tt.signedOffBy) {
+				t.Errorf("SignedOffBy = %q, want %q", e.SignedOffBy, tt.signedOffBy)
+			}
+		})
+	}
+}
+
+func TestRecordDispenseWithoutPrescriber(t *testing.T) {
+	svc := NewService(&fakeRepository{products: []Product{alprazolam}})
+	_, err := svc.RecordDispense(context.Background(), nil, uuid.New(), DispenseInput{
+		Lines: []DispenseLine{{ProductID: alprazolam.ID, Quantity: 1}},
+	})
+	if err == nil {
+		t.Fatalf("RecordDispense() without prescriber details succeeded, want an error")
+	}
+}
+
+func TestRecordReturn(t *testing.T) {
+	batch := uuid.New()
+	dispensed := RegisterEntry{
+		ID:              uuid.New(),
+		ScheduleType:    ScheduleH1,
+		EntryType:       EntryDispense,
+		DocumentNo:      "INV/25-26/000001",
+		MedicineID:      alprazolam.ID,
+		BatchID:         batch,
+		Quantity:        15,
+		PatientName:     "Meena",
+		PrescriberRegNo: "KMC-4411",
+		SignedOffBy:     []string{},
+	}
+	repo := &fakeRepository{dispensed: []RegisterEntry{dispensed}}
+	svc := NewService(repo)
+
+	n, err := svc.RecordReturn(context.Background(), nil, uuid.New(), ReturnInput{
+		ReturnNumber: "CN/25-26/000001",
+		HandledBy:    "Ravi",
+		Lines: []ReturnLine{
+			{ProductID: alprazolam.ID, BatchID: batch, Quantity: 5},
+			{ProductID: paracetamol.ID, BatchID: uuid.New(), Quantity: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RecordReturn() error = %v", err)
+	}
+	if n != 1 || len(repo.inserted) != 1 {
+		t.Fatalf("recorded %d entries, want only the dispensed H1 line", n)
+	}
+	e := repo.inserted[0]
+	if e.ID == dispensed.ID || e.EntryType != EntryReturn || e.DocumentNo != "CN/25-26/000001" || e.Quantity != 5 {
+		t.Errorf("return entry = %+v, want a new RETURN of 5 against CN/25-26/000001", e)
+	}
+	if e.PatientName != "Meena" || e.PrescriberRegNo != "KMC-4411" || e.DispensedByName != "Ravi" {
+		t.Errorf("return entry lost the dispense details: %+v", e)
+	}
+}
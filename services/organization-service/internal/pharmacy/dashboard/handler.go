@@ -93,6 +93,7 @@ func (h *Handler) GetSummary(c *gin.Context) {
 			resp.RecurringPatients = int(val)
 		}
 		resp.RecurringSales, _ = d["recurring_sales"].(float64)
+		resp.PaymentSplit, _ = d["payment_split"].([]interface{})
 
 		// Map Trend
 		if amounts, ok := d["trend_amounts"].([]interface{}); ok {
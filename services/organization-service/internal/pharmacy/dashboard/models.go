@@ -9,6 +9,7 @@ type SummaryResponse struct {
 	RecurringSales    float64       `json:"recurring_sales"`
 	TrendAmounts      []float64     `json:"trend_amounts"`
 	TrendDates        []string      `json:"trend_dates"`
+	PaymentSplit      []interface{} `json:"payment_split"`
 	TotalMedicines    int           `json:"total_medicines"`
 	TotalStockValue   float64       `json:"total_stock_value"`
 	ExpiredStockCount int           `json:"expired_stock_count"`
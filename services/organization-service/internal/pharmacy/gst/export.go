@@ -0,0 +1,531 @@
+package gst
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+// The JSON below follows the GST portal's return file layout (short keys,
+// dd-mm-yyyy dates, state codes for place of supply). CSV sections follow the
+// offline tool's templates so accountants can paste them in directly.
+
+type ItemDetail struct {
+	Rate    float64 `json:"rt"`
+	Taxable float64 `json:"txval"`
+	IGST    float64 `json:"iamt"`
+	CGST    float64 `json:"camt"`
+	SGST    float64 `json:"samt"`
+	Cess    float64 `json:"csamt"`
+}
+
+type Item struct {
+	Num    int        `json:"num"`
+	Detail ItemDetail `json:"itm_det"`
+}
+
+type Invoice struct {
+	Number        string  `json:"inum"`
+	Date          string  `json:"idt"`
+	Value         float64 `json:"val"`
+	POS           string  `json:"pos"`
+	ReverseCharge string  `json:"rchrg"`
+	InvoiceType   string  `json:"inv_typ,omitempty"`
+	Items         []Item  `json:"itms"`
+}
+
+type Note struct {
+	NoteType      string  `json:"ntty"` // C (credit) or D (debit)
+	Number        string  `json:"nt_num"`
+	Date          string  `json:"nt_dt"`
+	Value         float64 `json:"val"`
+	POS           string  `json:"pos"`
+	ReverseCharge string  `json:"rchrg"`
+	InvoiceType   string  `json:"inv_typ,omitempty"`
+	Items         []Item  `json:"itms"`
+}
+
+type B2BEntry struct {
+	CTIN      string    `json:"ctin"`
+	TradeName string    `json:"trdnm,omitempty"`
+	Invoices  []Invoice `json:"inv"`
+}
+
+type B2CLEntry struct {
+	POS      string    `json:"pos"`
+	Invoices []Invoice `json:"inv"`
+}
+
+type B2CSEntry struct {
+	SupplyType SupplyType `json:"sply_ty"`
+	POS        string     `json:"pos"`
+	Type       string     `json:"typ"`
+	Rate       float64    `json:"rt"`
+	Taxable    float64    `json:"txval"`
+	IGST       float64    `json:"iamt"`
+	CGST       float64    `json:"camt"`
+	SGST       float64    `json:"samt"`
+	Cess       float64    `json:"csamt"`
+}
+
+type CDNREntry struct {
+	CTIN      string `json:"ctin"`
+	TradeName string `json:"trdnm,omitempty"`
+	Notes     []Note `json:"nt"`
+}
+
+type CDNUREntry struct {
+	Type string `json:"typ"`
+	Note
+}
+
+type HSNRow struct {
+	Num         int     `json:"num"`
+	HSNCode     string  `json:"hsn_sc"`
+	Description string  `json:"desc"`
+	UQC         string  `json:"uqc"`
+	Quantity    int     `json:"qty"`
+	Rate        float64 `json:"rt"`
+	Value       float64 `json:"val"`
+	Taxable     float64 `json:"txval"`
+	IGST        float64 `json:"iamt"`
+	CGST        float64 `json:"camt"`
+	SGST        float64 `json:"samt"`
+	Cess        float64 `json:"csamt"`
+}
+
+type HSNSection struct {
+	Data []HSNRow `json:"data"`
+}
+
+type OutwardReturn struct {
+	GSTIN string       `json:"gstin"`
+	FP    string       `json:"fp"`
+	B2B   []B2BEntry   `json:"b2b,omitempty"`
+	B2CL  []B2CLEntry  `json:"b2cl,omitempty"`
+	B2CS  []B2CSEntry  `json:"b2cs,omitempty"`
+	CDNR  []CDNREntry  `json:"cdnr,omitempty"`
+	CDNUR []CDNUREntry `json:"cdnur,omitempty"`
+	HSN   HSNSection   `json:"hsn"`
+}
+
+type InwardReturn struct {
+	GSTIN string      `json:"gstin"`
+	FP    string      `json:"fp"`
+	B2B   []B2BEntry  `json:"b2b,omitempty"`
+	B2BUR []B2BEntry  `json:"b2bur,omitempty"`
+	CDN   []CDNREntry `json:"cdn,omitempty"`
+}
+
+var OutwardSections = []string{"b2b", "b2cl", "b2cs", "cdnr", "cdnur", "hsn"}
+var InwardSections = []string{"b2b", "b2bur", "cdn"}
+
+func (s *service) OutwardReturn(ctx context.Context, pharmacyID uuid.UUID, period string) (*OutwardReturn, error) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.GetProfile(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.repo.ListDocuments(ctx, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &OutwardReturn{GSTIN: profile.GSTIN, FP: from.Format("012006")}
+	b2b := make(map[string]int)
+	b2cl := make(map[string]int)
+	cdnr := make(map[string]int)
+	b2cs := make(map[string]*B2CSEntry)
+	var b2csKeys []string
+	var hsnLines []TaxLine
+	invoiceValues := make(map[uuid.UUID]float64)
+	for _, d := range docs {
+		if d.DocumentType == DocInvoice {
+			invoiceValues[d.SaleID] = d.TotalValue
+		}
+	}
+
+	addB2CS := func(d TaxDocument, sign float64) {
+		for _, it := range rateItems(d.Lines) {
+			key := fmt.Sprintf("%s|%s|%.2f", d.SupplyType, d.PlaceOfSupply, it.Detail.Rate)
+			e, ok := b2cs[key]
+			if !ok {
+				e = &B2CSEntry{SupplyType: d.SupplyType, POS: d.PlaceOfSupply, Type: "OE", Rate: it.Detail.Rate}
+				b2cs[key] = e
+				b2csKeys = append(b2csKeys, key)
+			}
+			e.Taxable = money.Round2(e.Taxable + sign*it.Detail.Taxable)
+			e.IGST = money.Round2(e.IGST + sign*it.Detail.IGST)
+			e.CGST = money.Round2(e.CGST + sign*it.Detail.CGST)
+			e.SGST = money.Round2(e.SGST + sign*it.Detail.SGST)
+		}
+	}
+
+	for _, d := range docs {
+		if d.DocumentType == DocInvoice {
+			hsnLines = append(hsnLines, d.Lines...)
+			switch {
+			case d.BuyerGSTIN != "":
+				inv := portalInvoice(d)
+				inv.InvoiceType = "R"
+				i, ok := b2b[d.BuyerGSTIN]
+				if !ok {
+					i = len(out.B2B)
+					b2b[d.BuyerGSTIN] = i
+					out.B2B = append(out.B2B, B2BEntry{CTIN: d.BuyerGSTIN, TradeName: d.BuyerName})
+				}
+				out.B2B[i].Invoices = append(out.B2B[i].Invoices, inv)
+			case d.SupplyType == SupplyInter && d.TotalValue > B2CLThreshold:
+				i, ok := b2cl[d.PlaceOfSupply]
+				if !ok {
+					i = len(out.B2CL)
+					b2cl[d.PlaceOfSupply] = i
+					out.B2CL = append(out.B2CL, B2CLEntry{POS: d.PlaceOfSupply})
+				}
+				out.B2CL[i].Invoices = append(out.B2CL[i].Invoices, portalInvoice(d))
+			default:
+				addB2CS(d, 1)
+			}
+			continue
+		}
+
+		// Credit notes reduce the HSN summary and go to the section of the invoice they reverse
+		for _, l := range d.Lines {
+			hsnLines = append(hsnLines, negateLine(l))
+		}
+		switch {
+		case d.BuyerGSTIN != "":
+			note := portalNote(d, "C")
+			note.InvoiceType = "R"
+			i, ok := cdnr[d.BuyerGSTIN]
+			if !ok {
+				i = len(out.CDNR)
+				cdnr[d.BuyerGSTIN] = i
+				out.CDNR = append(out.CDNR, CDNREntry{CTIN: d.BuyerGSTIN, TradeName: d.BuyerName})
+			}
+			out.CDNR[i].Notes = append(out.CDNR[i].Notes, note)
+		case d.SupplyType == SupplyInter:
+			value, ok := invoiceValues[d.SaleID]
+			if !ok {
+				invoice, err := s.repo.GetSaleInvoice(ctx, pharmacyID, d.SaleID)
+				if err != nil {
+					return nil, err
+				}
+				if invoice != nil {
+					value = invoice.TotalValue
+				}
+			}
+			if value > B2CLThreshold {
+				out.CDNUR = append(out.CDNUR, CDNUREntry{Type: "B2CL", Note: portalNote(d, "C")})
+			} else {
+				addB2CS(d, -1)
+			}
+		default:
+			addB2CS(d, -1)
+		}
+	}
+
+	for _, k := range b2csKeys {
+		out.B2CS = append(out.B2CS, *b2cs[k])
+	}
+	for i, h := range summariseHSN(hsnLines) {
+		out.HSN.Data = append(out.HSN.Data, HSNRow{
+			Num: i + 1, HSNCode: h.HSNCode, Description: h.Description, UQC: h.UQC, Quantity: h.Quantity, Rate: h.GSTRate,
+			Value: h.TotalValue, Taxable: h.TaxableValue, IGST: h.IGSTAmount, CGST: h.CGSTAmount, SGST: h.SGSTAmount,
+		})
+	}
+	return out, nil
+}
+
+func (s *service) InwardReturn(ctx context.Context, pharmacyID uuid.UUID, period string) (*InwardReturn, error) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.GetProfile(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.repo.ListInward(ctx, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &InwardReturn{GSTIN: profile.GSTIN, FP: from.Format("012006")}
+	b2b := make(map[string]int)
+	b2bur := make(map[uuid.UUID]int)
+	cdn := make(map[uuid.UUID]int)
+	for _, d := range docs {
+		gstin := strings.ToUpper(strings.TrimSpace(d.SupplierGSTIN))
+		supplierState := ""
+		if len(gstin) >= 2 {
+			supplierState = gstin[:2]
+		}
+		doc := TaxDocument{
+			DocumentNo:    d.DocumentNo,
+			DocumentDate:  d.DocumentDate,
+			PlaceOfSupply: profile.StateCode,
+			SupplyType:    supplyType(supplierState, profile.StateCode),
+		}
+		for i, l := range d.Lines {
+			// Supplier amounts are tax-inclusive; back the tax out at the line's rate
+			taxable := money.Round2(l.Amount / (1 + l.GSTRate/100))
+			doc.Lines = append(doc.Lines, newLine(i+1, uuid.Nil, "", "", l.Quantity, l.GSTRate, taxable, doc.SupplyType,
+				ProductTax{HSNCode: l.HSNCode, UnitType: l.UnitType}))
+		}
+		totalDocument(&doc)
+
+		if d.DocumentType == "DEBIT_NOTE" {
+			i, ok := cdn[d.SupplierID]
+			if !ok {
+				i = len(out.CDN)
+				cdn[d.SupplierID] = i
+				out.CDN = append(out.CDN, CDNREntry{CTIN: gstin, TradeName: d.SupplierName})
+			}
+			out.CDN[i].Notes = append(out.CDN[i].Notes, portalNote(doc, "D"))
+			continue
+		}
+
+		inv := portalInvoice(doc)
+		if gstin == "" {
+			i, ok := b2bur[d.SupplierID]
+			if !ok {
+				i = len(out.B2BUR)
+				b2bur[d.SupplierID] = i
+				out.B2BUR = append(out.B2BUR, B2BEntry{TradeName: d.SupplierName})
+			}
+			out.B2BUR[i].Invoices = append(out.B2BUR[i].Invoices, inv)
+			continue
+		}
+		inv.InvoiceType = "R"
+		i, ok := b2b[gstin]
+		if !ok {
+			i = len(out.B2B)
+			b2b[gstin] = i
+			out.B2B = append(out.B2B, B2BEntry{CTIN: gstin, TradeName: d.SupplierName})
+		}
+		out.B2B[i].Invoices = append(out.B2B[i].Invoices, inv)
+	}
+	return out, nil
+}
+
+func portalInvoice(d TaxDocument) Invoice {
+	return Invoice{
+		Number:        d.DocumentNo,
+		Date:          d.DocumentDate.Format("02-01-2006"),
+		Value:         d.TotalValue,
+		POS:           d.PlaceOfSupply,
+		ReverseCharge: "N",
+		Items:         rateItems(d.Lines),
+	}
+}
+
+func portalNote(d TaxDocument, noteType string) Note {
+	return Note{
+		NoteType:      noteType,
+		Number:        d.DocumentNo,
+		Date:          d.DocumentDate.Format("02-01-2006"),
+		Value:         d.TotalValue,
+		POS:           d.PlaceOfSupply,
+		ReverseCharge: "N",
+		Items:         rateItems(d.Lines),
+	}
+}
+
+// rateItems collapses document lines into one item per tax rate
+func rateItems(lines []TaxLine) []Item {
+	byRate := make(map[float64]*ItemDetail)
+	var rates []float64
+	for _, l := range lines {
+		d, ok := byRate[l.GSTRate]
+		if !ok {
+			d = &ItemDetail{Rate: l.GSTRate}
+			byRate[l.GSTRate] = d
+			rates = append(rates, l.GSTRate)
+		}
+		d.Taxable = money.Round2(d.Taxable + l.TaxableValue)
+		d.IGST = money.Round2(d.IGST + l.IGSTAmount)
+		d.CGST = money.Round2(d.CGST + l.CGSTAmount)
+		d.SGST = money.Round2(d.SGST + l.SGSTAmount)
+	}
+	sort.Float64s(rates)
+	items := make([]Item, 0, len(rates))
+	for i, r := range rates {
+		items = append(items, Item{Num: i + 1, Detail: *byRate[r]})
+	}
+	return items
+}
+
+func negateLine(l TaxLine) TaxLine {
+	l.Quantity = -l.Quantity
+	l.TaxableValue = -l.TaxableValue
+	l.CGSTAmount = -l.CGSTAmount
+	l.SGSTAmount = -l.SGSTAmount
+	l.IGSTAmount = -l.IGSTAmount
+	l.TotalValue = -l.TotalValue
+	return l
+}
+
+// OutwardCSV renders one section of an outward return as the offline tool's CSV
+func OutwardCSV(r *OutwardReturn, section string) ([]byte, error) {
+	var rows [][]string
+	switch section {
+	case "b2b":
+		rows = append(rows, []string{"GSTIN/UIN of Recipient", "Receiver Name", "Invoice Number", "Invoice date", "Invoice Value",
+			"Place Of Supply", "Reverse Charge", "Applicable % of Tax Rate", "Invoice Type", "E-Commerce GSTIN", "Rate", "Taxable Value", "Cess Amount"})
+		for _, e := range r.B2B {
+			for _, inv := range e.Invoices {
+				for _, it := range inv.Items {
+					rows = append(rows, []string{e.CTIN, e.TradeName, inv.Number, csvDate(inv.Date), csvAmount(inv.Value),
+						StateName(inv.POS), inv.ReverseCharge, "", "Regular B2B", "", csvAmount(it.Detail.Rate), csvAmount(it.Detail.Taxable), csvAmount(it.Detail.Cess)})
+				}
+			}
+		}
+	case "b2cl":
+		rows = append(rows, []string{"Invoice Number", "Invoice date", "Invoice Value", "Place Of Supply",
+			"Applicable % of Tax Rate", "Rate", "Taxable Value", "Cess Amount", "E-Commerce GSTIN"})
+		for _, e := range r.B2CL {
+			for _, inv := range e.Invoices {
+				for _, it := range inv.Items {
+					rows = append(rows, []string{inv.Number, csvDate(inv.Date), csvAmount(inv.Value), StateName(e.POS),
+						"", csvAmount(it.Detail.Rate), csvAmount(it.Detail.Taxable), csvAmount(it.Detail.Cess), ""})
+				}
+			}
+		}
+	case "b2cs":
+		rows = append(rows, []string{"Type", "Place Of Supply", "Applicable % of Tax Rate", "Rate", "Taxable Value", "Cess Amount", "E-Commerce GSTIN"})
+		for _, e := range r.B2CS {
+			rows = append(rows, []string{e.Type, StateName(e.POS), "", csvAmount(e.Rate), csvAmount(e.Taxable), csvAmount(e.Cess), ""})
+		}
+	case "cdnr":
+		rows = append(rows, []string{"GSTIN/UIN of Recipient", "Receiver Name", "Note Number", "Note Date", "Note Type",
+			"Place Of Supply", "Reverse Charge", "Note Supply Type", "Note Value", "Applicable % of Tax Rate", "Rate", "Taxable Value", "Cess Amount"})
+		for _, e := range r.CDNR {
+			for _, n := range e.Notes {
+				for _, it := range n.Items {
+					rows = append(rows, []string{e.CTIN, e.TradeName, n.Number, csvDate(n.Date), n.NoteType,
+						StateName(n.POS), n.ReverseCharge, "Regular B2B", csvAmount(n.Value), "", csvAmount(it.Detail.Rate), csvAmount(it.Detail.Taxable), csvAmount(it.Detail.Cess)})
+				}
+			}
+		}
+	case "cdnur":
+		rows = append(rows, []string{"UR Type", "Note Number", "Note Date", "Note Type", "Place Of Supply", "Note Value",
+			"Applicable % of Tax Rate", "Rate", "Taxable Value", "Cess Amount"})
+		for _, e := range r.CDNUR {
+			for _, it := range e.Items {
+				rows = append(rows, []string{e.Type, e.Number, csvDate(e.Date), e.NoteType, StateName(e.POS), csvAmount(e.Value),
+					"", csvAmount(it.Detail.Rate), csvAmount(it.Detail.Taxable), csvAmount(it.Detail.Cess)})
+			}
+		}
+	case "hsn":
+		rows = append(rows, hsnHeader())
+		for _, h := range r.HSN.Data {
+			rows = append(rows, []string{h.HSNCode, h.Description, h.UQC, strconv.Itoa(h.Quantity), csvAmount(h.Value), csvAmount(h.Rate),
+				csvAmount(h.Taxable), csvAmount(h.IGST), csvAmount(h.CGST), csvAmount(h.SGST), csvAmount(h.Cess)})
+		}
+	default:
+		return nil, fmt.Errorf("unknown section %q, expected one of %s", section, strings.Join(OutwardSections, ", "))
+	}
+	return writeCSV(rows)
+}
+
+// InwardCSV renders one section of an inward return as CSV
+func InwardCSV(r *InwardReturn, section string) ([]byte, error) {
+	var rows [][]string
+	switch section {
+	case "b2b", "b2bur":
+		entries := r.B2B
+		if section == "b2bur" {
+			entries = r.B2BUR
+		}
+		rows = append(rows, []string{"GSTIN of Supplier", "Supplier Name", "Invoice Number", "Invoice date", "Invoice Value",
+			"Place Of Supply", "Reverse Charge", "Rate", "Taxable Value", "Integrated Tax Paid", "Central Tax Paid", "State/UT Tax Paid", "Cess Amount"})
+		for _, e := range entries {
+			for _, inv := range e.Invoices {
+				for _, it := range inv.Items {
+					rows = append(rows, []string{e.CTIN, e.TradeName, inv.Number, csvDate(inv.Date), csvAmount(inv.Value),
+						StateName(inv.POS), inv.ReverseCharge, csvAmount(it.Detail.Rate), csvAmount(it.Detail.Taxable),
+						csvAmount(it.Detail.IGST), csvAmount(it.Detail.CGST), csvAmount(it.Detail.SGST), csvAmount(it.Detail.Cess)})
+				}
+			}
+		}
+	case "cdn":
+		rows = append(rows, []string{"GSTIN of Supplier", "Supplier Name", "Note Number", "Note Date", "Note Type",
+			"Place Of Supply", "Note Value", "Rate", "Taxable Value", "Integrated Tax Paid", "Central Tax Paid", "State/UT Tax Paid", "Cess Amount"})
+		for _, e := range r.CDN {
+			for _, n := range e.Notes {
+				for _, it := range n.Items {
+					rows = append(rows, []string{e.CTIN, e.TradeName, n.Number, csvDate(n.Date), n.NoteType,
+						StateName(n.POS), csvAmount(n.Value), csvAmount(it.Detail.Rate), csvAmount(it.Detail.Taxable),
+						csvAmount(it.Detail.IGST), csvAmount(it.Detail.CGST), csvAmount(it.Detail.SGST), csvAmount(it.Detail.Cess)})
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown section %q, expected one of %s", section, strings.Join(InwardSections, ", "))
+	}
+	return writeCSV(rows)
+}
+
+func hsnHeader() []string {
+	return []string{"HSN", "Description", "UQC", "Total Quantity", "Total Value", "Rate", "Taxable Value",
+		"Integrated Tax Amount", "Central Tax Amount", "State/UT Tax Amount", "Cess Amount"}
+}
+
+func writeCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// csvAmount writes an amount the way the offline tool expects it, to two places
+func csvAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// csvDate converts the portal's dd-mm-yyyy into the offline tool's dd-Mon-yyyy
+func csvDate(d string) string {
+	parts := strings.Split(d, "-")
+	if len(parts) != 3 {
+		return d
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 1 || m > 12 {
+		return d
+	}
+	months := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	return parts[0] + "-" + months[m-1] + "-" + parts[2]
+}
+
+var stateNames = map[string]string{
+	"01": "Jammu & Kashmir", "02": "Himachal Pradesh", "03": "Punjab", "04": "Chandigarh", "05": "Uttarakhand",
+	"06": "Haryana", "07": "Delhi", "08": "Rajasthan", "09": "Uttar Pradesh", "10": "Bihar",
+	"11": "Sikkim", "12": "Arunachal Pradesh", "13": "Nagaland", "14": "Manipur", "15": "Mizoram",
+	"16": "Tripura", "17": "Meghalaya", "18": "Assam", "19": "West Bengal", "20": "Jharkhand",
+	"21": "Odisha", "22": "Chhattisgarh", "23": "Madhya Pradesh", "24": "Gujarat",
+	"26": "Dadra & Nagar Haveli & Daman & Diu", "27": "Maharashtra", "29": "Karnataka", "30": "Goa",
+	"31": "Lakshadweep", "32": "Kerala", "33": "Tamil Nadu", "34": "Puducherry", "35": "Andaman & Nicobar Islands",
+	"36": "Telangana", "37": "Andhra Pradesh", "38": "Ladakh", "97": "Other Territory",
+}
+
+// StateName formats a state code the way the offline tool expects, e.g. 27-Maharashtra
+func StateName(code string) string {
+	if name, ok := stateNames[code]; ok {
+		return code + "-" + name
+	}
+	return code
+}
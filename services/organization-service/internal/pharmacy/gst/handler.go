@@ -0,0 +1,154 @@
+package gst
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"organization-service/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+func (h *Handler) GetProfile(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	profile, err := h.svc.GetProfile(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, profile)
+}
+
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user context")
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := h.svc.UpdateProfile(c.Request.Context(), pharmacyID, &req, userID, userName)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, profile)
+}
+
+// Outward returns sales invoices and credit notes of a month;
+// ?period=YYYY-MM&format=json|csv&section=b2b|b2cl|b2cs|cdnr|cdnur|hsn (section is required for csv)
+func (h *Handler) Outward(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	period := c.Query("period")
+	ret, err := h.svc.OutwardReturn(c.Request.Context(), pharmacyID, period)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if strings.ToLower(c.DefaultQuery("format", "json")) != "csv" {
+		h.respondJSON(c, http.StatusOK, ret)
+		return
+	}
+	section := strings.ToLower(c.Query("section"))
+	data, err := OutwardCSV(ret, section)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.respondCSV(c, fmt.Sprintf("outward-%s-%s.csv", section, period), data)
+}
+
+// Inward returns purchases and supplier debit notes of a month;
+// ?period=YYYY-MM&format=json|csv&section=b2b|b2bur|cdn (section is required for csv)
+func (h *Handler) Inward(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	period := c.Query("period")
+	ret, err := h.svc.InwardReturn(c.Request.Context(), pharmacyID, period)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if strings.ToLower(c.DefaultQuery("format", "json")) != "csv" {
+		h.respondJSON(c, http.StatusOK, ret)
+		return
+	}
+	section := strings.ToLower(c.Query("section"))
+	data, err := InwardCSV(ret, section)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.respondCSV(c, fmt.Sprintf("inward-%s-%s.csv", section, period), data)
+}
+
+func (h *Handler) respondCSV(c *gin.Context, filename string, data []byte) {
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, "text/csv", data)
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   message,
+	})
+}
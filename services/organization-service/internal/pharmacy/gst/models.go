@@ -0,0 +1,175 @@
+package gst
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DocumentType string
+
+const (
+	DocInvoice    DocumentType = "INVOICE"
+	DocCreditNote DocumentType = "CREDIT_NOTE"
+)
+
+type SupplyType string
+
+const (
+	SupplyIntra SupplyType = "INTRA"
+	SupplyInter SupplyType = "INTER"
+)
+
+// B2CLThreshold is the invoice value above which an inter-state sale to an
+// unregistered buyer is reported invoice-wise (B2CL) rather than summarised (B2CS)
+const B2CLThreshold = 100000
+
+type Profile struct {
+	PharmacyID    uuid.UUID `json:"pharmacy_id"`
+	GSTIN         string    `json:"gstin"`
+	LegalName     string    `json:"legal_name"`
+	TradeName     string    `json:"trade_name,omitempty"`
+	StateCode     string    `json:"state_code"`
+	Address       string    `json:"address,omitempty"`
+	UpdatedByName string    `json:"updated_by_name,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type TaxDocument struct {
+	ID                   uuid.UUID    `json:"id"`
+	PharmacyID           uuid.UUID    `json:"pharmacy_id"`
+	DocumentType         DocumentType `json:"document_type"`
+	DocumentNo           string       `json:"document_no"`
+	DocumentDate         time.Time    `json:"document_date"`
+	SaleID               uuid.UUID    `json:"sale_id"`
+	ReturnID             *uuid.UUID   `json:"return_id,omitempty"`
+	OriginalDocumentNo   string       `json:"original_document_no,omitempty"`
+	OriginalDocumentDate *time.Time   `json:"original_document_date,omitempty"`
+	LegacyNumber         bool         `json:"legacy_number,omitempty"` // Numbered before the series, past GST's length limit
+	SellerGSTIN          string       `json:"seller_gstin"`
+	SellerName           string       `json:"seller_name"`
+	SellerAddress        string       `json:"seller_address,omitempty"`
+	SellerStateCode      string       `json:"seller_state_code"`
+	BuyerName            string       `json:"buyer_name,omitempty"`
+	BuyerGSTIN           string       `json:"buyer_gstin,omitempty"`
+	PlaceOfSupply        string       `json:"place_of_supply"`
+	SupplyType           SupplyType   `json:"supply_type"`
+	TaxableValue         float64      `json:"taxable_value"`
+	CGSTAmount           float64      `json:"cgst_amount"`
+	SGSTAmount           float64      `json:"sgst_amount"`
+	IGSTAmount           float64      `json:"igst_amount"`
+	TotalValue           float64      `json:"total_value"`
+	CreatedAt            time.Time    `json:"created_at"`
+	Lines                []TaxLine    `json:"lines,omitempty"`
+	HSNSummary           []HSNSummary `json:"hsn_summary,omitempty"`
+}
+
+type TaxLine struct {
+	ID           uuid.UUID `json:"id"`
+	LineNo       int       `json:"line_no"`
+	MedicineID   uuid.UUID `json:"medicine_id"`
+	Description  string    `json:"description"`
+	HSNCode      string    `json:"hsn_code"`
+	UQC          string    `json:"uqc"`
+	BatchNo      string    `json:"batch_no,omitempty"`
+	Quantity     int       `json:"quantity"`
+	GSTRate      float64   `json:"gst_rate"`
+	TaxableValue float64   `json:"taxable_value"`
+	CGSTAmount   float64   `json:"cgst_amount"`
+	SGSTAmount   float64   `json:"sgst_amount"`
+	IGSTAmount   float64   `json:"igst_amount"`
+	TotalValue   float64   `json:"total_value"`
+}
+
+// HSNSummary groups document lines by HSN code and rate
+type HSNSummary struct {
+	HSNCode      string  `json:"hsn_code"`
+	Description  string  `json:"description,omitempty"`
+	UQC          string  `json:"uqc"`
+	GSTRate      float64 `json:"gst_rate"`
+	Quantity     int     `json:"quantity"`
+	TaxableValue float64 `json:"taxable_value"`
+	CGSTAmount   float64 `json:"cgst_amount"`
+	SGSTAmount   float64 `json:"sgst_amount"`
+	IGSTAmount   float64 `json:"igst_amount"`
+	TotalValue   float64 `json:"total_value"`
+}
+
+// ProductTax is the catalogue data a tax line needs
+type ProductTax struct {
+	ID       uuid.UUID
+	HSNCode  string
+	UnitType string
+}
+
+// InvoiceLine is one sale item as billed; tax is charged on top of the discounted MRP
+type InvoiceLine struct {
+	ProductID          uuid.UUID
+	MedicineName       string
+	BatchNo            string
+	Quantity           int
+	MRP                float64
+	DiscountPercentage float64
+	TaxPercentage      float64
+}
+
+type InvoiceInput struct {
+	SaleID        uuid.UUID
+	InvoiceNo     string
+	InvoiceDate   time.Time
+	BuyerName     string
+	BuyerGSTIN    string
+	PlaceOfSupply string
+	Lines         []InvoiceLine
+}
+
+// CreditNoteLine is one returned item; Amount is the tax-inclusive refund
+type CreditNoteLine struct {
+	ProductID     uuid.UUID
+	MedicineName  string
+	BatchNo       string
+	Quantity      int
+	Amount        float64
+	TaxPercentage float64
+}
+
+type CreditNoteInput struct {
+	SaleID         uuid.UUID
+	ReturnID       uuid.UUID
+	CreditNoteNo   string // The return's number from the credit note series; numbered on save when empty
+	CreditNoteDate time.Time
+	InvoiceNo      string
+	InvoiceDate    time.Time
+	BuyerName      string
+	Lines          []CreditNoteLine
+}
+
+// Inward supplies are read from purchases and supplier debit notes
+
+type InwardDocument struct {
+	DocumentType  string       `json:"document_type"` // INVOICE, DEBIT_NOTE
+	DocumentNo    string       `json:"document_no"`
+	DocumentDate  time.Time    `json:"document_date"`
+	SupplierID    uuid.UUID    `json:"supplier_id"`
+	SupplierName  string       `json:"supplier_name"`
+	SupplierGSTIN string       `json:"supplier_gstin"`
+	Lines         []InwardLine `json:"-"`
+}
+
+type InwardLine struct {
+	HSNCode  string
+	UnitType string
+	Quantity int
+	GSTRate  float64
+	// Amount is tax-inclusive, as entered from the supplier's invoice
+	Amount float64
+}
+
+// Request Structs
+
+type UpdateProfileRequest struct {
+	GSTIN     string `json:"gstin" validate:"required,len=15,alphanum"`
+	LegalName string `json:"legal_name" validate:"required,max=255"`
+	TradeName string `json:"trade_name" validate:"max=255"`
+	Address   string `json:"address" validate:"max=500"`
+}
@@ -0,0 +1,343 @@
+package gst
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	GetProfile(ctx context.Context, pharmacyID uuid.UUID) (*Profile, error)
+	UpsertProfile(ctx context.Context, p *Profile, userID uuid.UUID) error
+	GetPharmacyDetails(ctx context.Context, pharmacyID uuid.UUID) (name, address string, err error)
+	GetProductTax(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]ProductTax, error)
+
+	// CreateDocument stores a document with its lines; an unnumbered credit note is numbered here.
+	// With tx the document commits with the caller's transaction, otherwise on its own.
+	CreateDocument(ctx context.Context, tx *sql.Tx, doc *TaxDocument) error
+	GetSaleInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (*TaxDocument, error)
+	GetReturnCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (*TaxDocument, error)
+	ListDocuments(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]TaxDocument, error)
+
+	ListInward(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]InwardDocument, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) GetProfile(ctx context.Context, pharmacyID uuid.UUID) (*Profile, error) {
+	p := &Profile{}
+	var tradeName, address, updatedBy sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT pharmacy_id, gstin, legal_name, trade_name, state_code, address, updated_by_name, updated_at
+		FROM sales_schema.gst_profiles
+		WHERE pharmacy_id = $1
+	`, pharmacyID).Scan(&p.PharmacyID, &p.GSTIN, &p.LegalName, &tradeName, &p.StateCode, &address, &updatedBy, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GST profile: %w", err)
+	}
+	p.TradeName = tradeName.String
+	p.Address = address.String
+	p.UpdatedByName = updatedBy.String
+	return p, nil
+}
+
+func (r *postgresRepository) UpsertProfile(ctx context.Context, p *Profile, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.gst_profiles (
+			pharmacy_id, gstin, legal_name, trade_name, state_code, address, updated_by, updated_by_name, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (pharmacy_id) DO UPDATE SET
+			gstin = EXCLUDED.gstin,
+			legal_name = EXCLUDED.legal_name,
+			trade_name = EXCLUDED.trade_name,
+			state_code = EXCLUDED.state_code,
+			address = EXCLUDED.address,
+			updated_by = EXCLUDED.updated_by,
+			updated_by_name = EXCLUDED.updated_by_name,
+			updated_at = EXCLUDED.updated_at
+	`, p.PharmacyID, p.GSTIN, p.LegalName, p.TradeName, p.StateCode, p.Address, userID, p.UpdatedByName, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save GST profile: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetPharmacyDetails(ctx context.Context, pharmacyID uuid.UUID) (string, string, error) {
+	var name, address string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT name, COALESCE(address, '') FROM public.pharmacies WHERE id = $1
+	`, pharmacyID).Scan(&name, &address)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get pharmacy details: %w", err)
+	}
+	return name, address, nil
+}
+
+func (r *postgresRepository) GetProductTax(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]ProductTax, error) {
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(hsn_code, ''), COALESCE(unit_type, '')
+		FROM inventory.medicines
+		WHERE pharmacy_id = $1 AND id = ANY($2)
+	`, pharmacyID, pq.Array(strIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make(map[uuid.UUID]ProductTax)
+	for rows.Next() {
+		var p ProductTax
+		if err := rows.Scan(&p.ID, &p.HSNCode, &p.UnitType); err != nil {
+			return nil, err
+		}
+		products[p.ID] = p
+	}
+	return products, rows.Err()
+}
+
+func (r *postgresRepository) CreateDocument(ctx context.Context, tx *sql.Tx, doc *TaxDocument) error {
+	if tx == nil {
+		own, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer own.Rollback()
+		if err := r.CreateDocument(ctx, own, doc); err != nil {
+			return err
+		}
+		return own.Commit()
+	}
+
+	// A credit note not numbered with its return takes the next one from the credit note series
+	if doc.DocumentType == DocCreditNote && doc.DocumentNo == "" {
+		var err error
+		if doc.DocumentNo, err = numbering.Next(ctx, tx, doc.PharmacyID, numbering.DocCreditNote, doc.DocumentDate); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sales_schema.tax_documents (
+			id, pharmacy_id, document_type, document_no, document_date, sale_id, return_id,
+			original_document_no, original_document_date, seller_gstin, seller_name, seller_address, seller_state_code,
+			buyer_name, buyer_gstin, place_of_supply, supply_type,
+			taxable_value, cgst_amount, sgst_amount, igst_amount, total_value, legacy_number, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+	`, doc.ID, doc.PharmacyID, doc.DocumentType, doc.DocumentNo, doc.DocumentDate, doc.SaleID, doc.ReturnID,
+		nullString(doc.OriginalDocumentNo), doc.OriginalDocumentDate, nullString(doc.SellerGSTIN), doc.SellerName,
+		nullString(doc.SellerAddress), nullString(doc.SellerStateCode),
+		nullString(doc.BuyerName), nullString(doc.BuyerGSTIN), nullString(doc.PlaceOfSupply), doc.SupplyType,
+		doc.TaxableValue, doc.CGSTAmount, doc.SGSTAmount, doc.IGSTAmount, doc.TotalValue, doc.LegacyNumber, doc.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert tax document: %w", err)
+	}
+
+	for _, l := range doc.Lines {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO sales_schema.tax_document_lines (
+				id, document_id, line_no, medicine_id, description, hsn_code, uqc, batch_no, quantity, gst_rate,
+				taxable_value, cgst_amount, sgst_amount, igst_amount, total_value
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		`, l.ID, doc.ID, l.LineNo, l.MedicineID, l.Description, l.HSNCode, l.UQC, l.BatchNo, l.Quantity, l.GSTRate,
+			l.TaxableValue, l.CGSTAmount, l.SGSTAmount, l.IGSTAmount, l.TotalValue); err != nil {
+			return fmt.Errorf("failed to insert tax document line %d: %w", l.LineNo, err)
+		}
+	}
+
+	return nil
+}
+
+const documentColumns = `
+	id, pharmacy_id, document_type, document_no, document_date, sale_id, return_id,
+	COALESCE(original_document_no, ''), original_document_date, COALESCE(seller_gstin, ''), COALESCE(seller_name, ''),
+	COALESCE(seller_address, ''), COALESCE(seller_state_code, ''), COALESCE(buyer_name, ''), COALESCE(buyer_gstin, ''),
+	COALESCE(place_of_supply, ''), supply_type, taxable_value, cgst_amount, sgst_amount, igst_amount, total_value, legacy_number, created_at
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDocument(row rowScanner) (TaxDocument, error) {
+	var d TaxDocument
+	var returnID uuid.NullUUID
+	var originalDate sql.NullTime
+	err := row.Scan(
+		&d.ID, &d.PharmacyID, &d.DocumentType, &d.DocumentNo, &d.DocumentDate, &d.SaleID, &returnID,
+		&d.OriginalDocumentNo, &originalDate, &d.SellerGSTIN, &d.SellerName,
+		&d.SellerAddress, &d.SellerStateCode, &d.BuyerName, &d.BuyerGSTIN,
+		&d.PlaceOfSupply, &d.SupplyType, &d.TaxableValue, &d.CGSTAmount, &d.SGSTAmount, &d.IGSTAmount, &d.TotalValue, &d.LegacyNumber, &d.CreatedAt,
+	)
+	if returnID.Valid {
+		d.ReturnID = &returnID.UUID
+	}
+	if originalDate.Valid {
+		d.OriginalDocumentDate = &originalDate.Time
+	}
+	return d, err
+}
+
+func (r *postgresRepository) getDocument(ctx context.Context, where string, args ...interface{}) (*TaxDocument, error) {
+	d, err := scanDocument(r.db.QueryRowContext(ctx, "SELECT "+documentColumns+" FROM sales_schema.tax_documents WHERE "+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax document: %w", err)
+	}
+	lines, err := r.listLines(ctx, []uuid.UUID{d.ID})
+	if err != nil {
+		return nil, err
+	}
+	d.Lines = lines[d.ID]
+	return &d, nil
+}
+
+func (r *postgresRepository) GetSaleInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (*TaxDocument, error) {
+	return r.getDocument(ctx, "pharmacy_id = $1 AND sale_id = $2 AND document_type = $3", pharmacyID, saleID, DocInvoice)
+}
+
+func (r *postgresRepository) GetReturnCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (*TaxDocument, error) {
+	return r.getDocument(ctx, "pharmacy_id = $1 AND return_id = $2", pharmacyID, returnID)
+}
+
+func (r *postgresRepository) ListDocuments(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]TaxDocument, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+documentColumns+`
+		FROM sales_schema.tax_documents
+		WHERE pharmacy_id = $1 AND document_date >= $2 AND document_date <= $3
+		ORDER BY document_date ASC, document_no ASC
+	`, pharmacyID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tax documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []TaxDocument
+	var ids []uuid.UUID
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	lines, err := r.listLines(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range docs {
+		docs[i].Lines = lines[docs[i].ID]
+	}
+	return docs, nil
+}
+
+func (r *postgresRepository) listLines(ctx context.Context, documentIDs []uuid.UUID) (map[uuid.UUID][]TaxLine, error) {
+	strIDs := make([]string, len(documentIDs))
+	for i, id := range documentIDs {
+		strIDs[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT document_id, id, line_no, medicine_id, description, COALESCE(hsn_code, ''), uqc, COALESCE(batch_no, ''),
+		       quantity, gst_rate, taxable_value, cgst_amount, sgst_amount, igst_amount, total_value
+		FROM sales_schema.tax_document_lines
+		WHERE document_id = ANY($1)
+		ORDER BY document_id, line_no
+	`, pq.Array(strIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tax document lines: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[uuid.UUID][]TaxLine)
+	for rows.Next() {
+		var docID uuid.UUID
+		var l TaxLine
+		if err := rows.Scan(&docID, &l.ID, &l.LineNo, &l.MedicineID, &l.Description, &l.HSNCode, &l.UQC, &l.BatchNo,
+			&l.Quantity, &l.GSTRate, &l.TaxableValue, &l.CGSTAmount, &l.SGSTAmount, &l.IGSTAmount, &l.TotalValue); err != nil {
+			return nil, err
+		}
+		lines[docID] = append(lines[docID], l)
+	}
+	return lines, rows.Err()
+}
+
+func (r *postgresRepository) ListInward(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]InwardDocument, error) {
+	// Purchase invoices and debit notes share one shape: a header keyed by
+	// document and a line per medicine with the rate taken from the catalogue
+	// for debit notes (they carry no rate of their own)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 'INVOICE', p.id, p.invoice_no, p.purchase_date, s.id, s.name, COALESCE(s.gst_number, ''),
+		       COALESCE(m.hsn_code, ''), COALESCE(m.unit_type, ''), pi.total_qty_units,
+		       COALESCE(pi.cgst_rate, 0) + COALESCE(pi.sgst_rate, 0), pi.item_total_amount
+		FROM inventory.purchases p
+		JOIN inventory.purchase_items pi ON pi.purchase_id = p.id
+		JOIN inventory.medicines m ON m.id = pi.medicine_id
+		JOIN supplier_schema.suppliers s ON s.id = p.supplier_id
+		WHERE p.pharmacy_id = $1 AND p.purchase_date >= $2 AND p.purchase_date <= $3
+		UNION ALL
+		SELECT 'DEBIT_NOTE', d.id, d.debit_note_no, timezone('Asia/Kolkata', d.created_at)::date, s.id, s.name, COALESCE(s.gst_number, ''),
+		       COALESCE(m.hsn_code, ''), COALESCE(m.unit_type, ''), di.quantity,
+		       COALESCE(m.cgst_rate, 0) + COALESCE(m.sgst_rate, 0), di.amount
+		FROM inventory.debit_notes d
+		JOIN inventory.debit_note_items di ON di.debit_note_id = d.id
+		JOIN inventory.medicines m ON m.id = di.medicine_id
+		JOIN supplier_schema.suppliers s ON s.id = d.supplier_id
+		WHERE d.pharmacy_id = $1 AND timezone('Asia/Kolkata', d.created_at)::date >= $2
+		  AND timezone('Asia/Kolkata', d.created_at)::date <= $3
+		ORDER BY 4, 3
+	`, pharmacyID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inward supplies: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []InwardDocument
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var d InwardDocument
+		var id uuid.UUID
+		var l InwardLine
+		if err := rows.Scan(&d.DocumentType, &id, &d.DocumentNo, &d.DocumentDate, &d.SupplierID, &d.SupplierName, &d.SupplierGSTIN,
+			&l.HSNCode, &l.UnitType, &l.Quantity, &l.GSTRate, &l.Amount); err != nil {
+			return nil, err
+		}
+		i, ok := index[id]
+		if !ok {
+			i = len(docs)
+			index[id] = i
+			docs = append(docs, d)
+		}
+		docs[i].Lines = append(docs[i].Lines, l)
+	}
+	return docs, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
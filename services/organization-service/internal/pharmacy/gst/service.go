@@ -0,0 +1,424 @@
+package gst
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+)
+
+// ErrDocumentNotFound is returned when a sale or return has no tax document yet
+var ErrDocumentNotFound = errors.New("tax document not found")
+
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+type Service interface {
+	GetProfile(ctx context.Context, pharmacyID uuid.UUID) (*Profile, error)
+	UpdateProfile(ctx context.Context, pharmacyID uuid.UUID, req *UpdateProfileRequest, userID uuid.UUID, userName string) (*Profile, error)
+
+	// IssueInvoice creates the tax invoice for a completed sale; a sale already invoiced returns its invoice.
+	// At checkout tx is the sale's transaction, so the sale and its invoice commit together.
+	IssueInvoice(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in InvoiceInput) (*TaxDocument, error)
+	// IssueCreditNote creates the credit note for a sales return against the sale's invoice.
+	// With tx, the return's transaction, the return and its credit note commit together.
+	IssueCreditNote(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in CreditNoteInput) (*TaxDocument, error)
+	GetSaleInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (*TaxDocument, error)
+	GetCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (*TaxDocument, error)
+
+	// OutwardReturn summarises invoices and credit notes of a month (YYYY-MM) in GSTR-1 layout
+	OutwardReturn(ctx context.Context, pharmacyID uuid.UUID, period string) (*OutwardReturn, error)
+	// InwardReturn summarises purchases and supplier debit notes of a month (YYYY-MM)
+	InwardReturn(ctx context.Context, pharmacyID uuid.UUID, period string) (*InwardReturn, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) GetProfile(ctx context.Context, pharmacyID uuid.UUID) (*Profile, error) {
+	p, err := s.repo.GetProfile(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("GST profile is not set up for this pharmacy")
+	}
+	return p, nil
+}
+
+func (s *service) UpdateProfile(ctx context.Context, pharmacyID uuid.UUID, req *UpdateProfileRequest, userID uuid.UUID, userName string) (*Profile, error) {
+	gstin := strings.ToUpper(strings.TrimSpace(req.GSTIN))
+	if !gstinPattern.MatchString(gstin) {
+		return nil, fmt.Errorf("invalid GSTIN %s", req.GSTIN)
+	}
+	if _, ok := stateNames[gstin[:2]]; !ok {
+		return nil, fmt.Errorf("GSTIN %s has unknown state code %s", gstin, gstin[:2])
+	}
+
+	p := &Profile{
+		PharmacyID:    pharmacyID,
+		GSTIN:         gstin,
+		LegalName:     strings.TrimSpace(req.LegalName),
+		TradeName:     strings.TrimSpace(req.TradeName),
+		StateCode:     gstin[:2],
+		Address:       strings.TrimSpace(req.Address),
+		UpdatedByName: userName,
+		UpdatedAt:     time.Now(),
+	}
+	if err := s.repo.UpsertProfile(ctx, p, userID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// seller fills the supplier block of a document from the GST profile, falling
+// back to the pharmacy record when the pharmacy has not registered one yet
+func (s *service) seller(ctx context.Context, pharmacyID uuid.UUID, doc *TaxDocument) error {
+	profile, err := s.repo.GetProfile(ctx, pharmacyID)
+	if err != nil {
+		return err
+	}
+	if profile != nil {
+		doc.SellerGSTIN = profile.GSTIN
+		doc.SellerName = profile.LegalName
+		if profile.TradeName != "" {
+			doc.SellerName = profile.TradeName
+		}
+		doc.SellerAddress = profile.Address
+		doc.SellerStateCode = profile.StateCode
+		return nil
+	}
+	name, address, err := s.repo.GetPharmacyDetails(ctx, pharmacyID)
+	if err != nil {
+		return err
+	}
+	doc.SellerName = name
+	doc.SellerAddress = address
+	return nil
+}
+
+func (s *service) IssueInvoice(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in InvoiceInput) (*TaxDocument, error) {
+	existing, err := s.repo.GetSaleInvoice(ctx, pharmacyID, in.SaleID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.HSNSummary = summariseHSN(existing.Lines)
+		return existing, nil
+	}
+	if in.InvoiceNo == "" {
+		return nil, fmt.Errorf("sale %s has no invoice number", in.SaleID)
+	}
+
+	now := time.Now()
+	doc := &TaxDocument{
+		ID:           uuid.New(),
+		PharmacyID:   pharmacyID,
+		DocumentType: DocInvoice,
+		DocumentNo:   in.InvoiceNo,
+		DocumentDate: in.InvoiceDate,
+		SaleID:       in.SaleID,
+		BuyerName:    in.BuyerName,
+		BuyerGSTIN:   strings.ToUpper(strings.TrimSpace(in.BuyerGSTIN)),
+		LegacyNumber: !numbering.FitsGST(in.InvoiceNo),
+		CreatedAt:    now,
+	}
+	if doc.DocumentDate.IsZero() {
+		doc.DocumentDate = now
+	}
+	if doc.BuyerGSTIN != "" && !gstinPattern.MatchString(doc.BuyerGSTIN) {
+		return nil, fmt.Errorf("invalid buyer GSTIN %s", in.BuyerGSTIN)
+	}
+	if err := s.seller(ctx, pharmacyID, doc); err != nil {
+		return nil, err
+	}
+
+	// A registered buyer's state decides the place of supply; otherwise the
+	// counter sale is taken to happen in the pharmacy's own state
+	switch {
+	case doc.BuyerGSTIN != "":
+		doc.PlaceOfSupply = doc.BuyerGSTIN[:2]
+	case in.PlaceOfSupply != "":
+		if _, ok := stateNames[in.PlaceOfSupply]; !ok {
+			return nil, fmt.Errorf("unknown place of supply state code %s", in.PlaceOfSupply)
+		}
+		doc.PlaceOfSupply = in.PlaceOfSupply
+	default:
+		doc.PlaceOfSupply = doc.SellerStateCode
+	}
+	doc.SupplyType = supplyType(doc.SellerStateCode, doc.PlaceOfSupply)
+
+	products, err := s.products(ctx, pharmacyID, invoiceProductIDs(in.Lines))
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range in.Lines {
+		taxable := money.Round2(l.MRP * (1 - l.DiscountPercentage/100) * float64(l.Quantity))
+		line := newLine(i+1, l.ProductID, l.MedicineName, l.BatchNo, l.Quantity, l.TaxPercentage, taxable, doc.SupplyType, products[l.ProductID])
+		doc.Lines = append(doc.Lines, line)
+	}
+	totalDocument(doc)
+
+	if err := s.repo.CreateDocument(ctx, tx, doc); err != nil {
+		return nil, err
+	}
+	doc.HSNSummary = summariseHSN(doc.Lines)
+	return doc, nil
+}
+
+func (s *service) IssueCreditNote(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in CreditNoteInput) (*TaxDocument, error) {
+	existing, err := s.repo.GetReturnCreditNote(ctx, pharmacyID, in.ReturnID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.HSNSummary = summariseHSN(existing.Lines)
+		return existing, nil
+	}
+
+	now := time.Now()
+	returnID := in.ReturnID
+	doc := &TaxDocument{
+		ID:           uuid.New(),
+		PharmacyID:   pharmacyID,
+		DocumentType: DocCreditNote,
+		DocumentNo:   in.CreditNoteNo,
+		DocumentDate: in.CreditNoteDate,
+		SaleID:       in.SaleID,
+		ReturnID:     &returnID,
+		BuyerName:    in.BuyerName,
+		LegacyNumber: !numbering.FitsGST(in.CreditNoteNo),
+		CreatedAt:    now,
+	}
+	if doc.DocumentDate.IsZero() {
+		doc.DocumentDate = now
+	}
+	if err := s.seller(ctx, pharmacyID, doc); err != nil {
+		return nil, err
+	}
+
+	// The credit note follows the invoice it reverses: same buyer, place of supply and tax split
+	invoice, err := s.repo.GetSaleInvoice(ctx, pharmacyID, in.SaleID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice != nil {
+		invoiceDate := invoice.DocumentDate
+		doc.OriginalDocumentNo = invoice.DocumentNo
+		doc.OriginalDocumentDate = &invoiceDate
+		doc.BuyerGSTIN = invoice.BuyerGSTIN
+		if doc.BuyerName == "" {
+			doc.BuyerName = invoice.BuyerName
+		}
+		doc.PlaceOfSupply = invoice.PlaceOfSupply
+		doc.SupplyType = invoice.SupplyType
+	} else {
+		doc.OriginalDocumentNo = in.InvoiceNo
+		if !in.InvoiceDate.IsZero() {
+			invoiceDate := in.InvoiceDate
+			doc.OriginalDocumentDate = &invoiceDate
+		}
+		doc.PlaceOfSupply = doc.SellerStateCode
+		doc.SupplyType = SupplyIntra
+	}
+
+	ids := make([]uuid.UUID, 0, len(in.Lines))
+	for _, l := range in.Lines {
+		ids = append(ids, l.ProductID)
+	}
+	products, err := s.products(ctx, pharmacyID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range in.Lines {
+		// Refunds are tax-inclusive; back the tax out at the billed rate
+		taxable := money.Round2(l.Amount / (1 + l.TaxPercentage/100))
+		line := newLine(i+1, l.ProductID, l.MedicineName, l.BatchNo, l.Quantity, l.TaxPercentage, taxable, doc.SupplyType, products[l.ProductID])
+		doc.Lines = append(doc.Lines, line)
+	}
+	totalDocument(doc)
+
+	if err := s.repo.CreateDocument(ctx, tx, doc); err != nil {
+		return nil, err
+	}
+	doc.HSNSummary = summariseHSN(doc.Lines)
+	return doc, nil
+}
+
+func (s *service) GetSaleInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (*TaxDocument, error) {
+	doc, err := s.repo.GetSaleInvoice(ctx, pharmacyID, saleID)
+	if err != nil || doc == nil {
+		return doc, err
+	}
+	doc.HSNSummary = summariseHSN(doc.Lines)
+	return doc, nil
+}
+
+func (s *service) GetCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (*TaxDocument, error) {
+	doc, err := s.repo.GetReturnCreditNote(ctx, pharmacyID, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w for return %s", ErrDocumentNotFound, returnID)
+	}
+	doc.HSNSummary = summariseHSN(doc.Lines)
+	return doc, nil
+}
+
+func (s *service) products(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]ProductTax, error) {
+	if len(ids) == 0 {
+		return map[uuid.UUID]ProductTax{}, nil
+	}
+	products, err := s.repo.GetProductTax(ctx, pharmacyID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HSN codes: %w", err)
+	}
+	return products, nil
+}
+
+func invoiceProductIDs(lines []InvoiceLine) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(lines))
+	for _, l := range lines {
+		ids = append(ids, l.ProductID)
+	}
+	return ids
+}
+
+func newLine(lineNo int, productID uuid.UUID, name, batchNo string, qty int, rate, taxable float64, st SupplyType, product ProductTax) TaxLine {
+	line := TaxLine{
+		ID:           uuid.New(),
+		LineNo:       lineNo,
+		MedicineID:   productID,
+		Description:  name,
+		HSNCode:      product.HSNCode,
+		UQC:          UQC(product.UnitType),
+		BatchNo:      batchNo,
+		Quantity:     qty,
+		GSTRate:      rate,
+		TaxableValue: taxable,
+	}
+	line.CGSTAmount, line.SGSTAmount, line.IGSTAmount = splitTax(taxable, rate, st)
+	line.TotalValue = money.Round2(taxable + line.CGSTAmount + line.SGSTAmount + line.IGSTAmount)
+	return line
+}
+
+func totalDocument(doc *TaxDocument) {
+	doc.TaxableValue, doc.CGSTAmount, doc.SGSTAmount, doc.IGSTAmount, doc.TotalValue = 0, 0, 0, 0, 0
+	for _, l := range doc.Lines {
+		doc.TaxableValue += l.TaxableValue
+		doc.CGSTAmount += l.CGSTAmount
+		doc.SGSTAmount += l.SGSTAmount
+		doc.IGSTAmount += l.IGSTAmount
+		doc.TotalValue += l.TotalValue
+	}
+	doc.TaxableValue = money.Round2(doc.TaxableValue)
+	doc.CGSTAmount = money.Round2(doc.CGSTAmount)
+	doc.SGSTAmount = money.Round2(doc.SGSTAmount)
+	doc.IGSTAmount = money.Round2(doc.IGSTAmount)
+	doc.TotalValue = money.Round2(doc.TotalValue)
+}
+
+// supplyType is intra-state unless both states are known and differ
+func supplyType(sellerState, placeOfSupply string) SupplyType {
+	if sellerState != "" && placeOfSupply != "" && sellerState != placeOfSupply {
+		return SupplyInter
+	}
+	return SupplyIntra
+}
+
+// splitTax charges IGST on inter-state supplies and halves the rate into CGST
+// and SGST otherwise; SGST takes the rounding difference
+func splitTax(taxable, rate float64, st SupplyType) (cgst, sgst, igst float64) {
+	tax := money.Round2(taxable * rate / 100)
+	if st == SupplyInter {
+		return 0, 0, tax
+	}
+	cgst = money.Round2(tax / 2)
+	return cgst, money.Round2(tax - cgst), 0
+}
+
+// UQC maps a catalogue unit type to the GST unit quantity code
+func UQC(unitType string) string {
+	switch strings.ToUpper(strings.TrimSpace(unitType)) {
+	case "TABLET", "TABLETS", "TAB", "CAPSULE", "CAPSULES", "CAP":
+		return "TBS"
+	case "STRIP", "STRIPS":
+		return "STR"
+	case "BOTTLE", "BOTTLES", "BTL":
+		return "BTL"
+	case "BOX", "BOXES":
+		return "BOX"
+	case "PACK", "PACKS", "PACKET":
+		return "PAC"
+	case "TUBE", "TUBES":
+		return "TUB"
+	case "VIAL", "VIALS", "AMPOULE", "AMPOULES":
+		return "VLS"
+	case "ML":
+		return "MLT"
+	case "GM", "GRAM", "GRAMS", "G":
+		return "GMS"
+	case "KG":
+		return "KGS"
+	case "LITRE", "LITER", "L":
+		return "LTR"
+	default:
+		return "NOS"
+	}
+}
+
+func summariseHSN(lines []TaxLine) []HSNSummary {
+	type key struct {
+		hsn  string
+		uqc  string
+		rate float64
+	}
+	index := make(map[key]int)
+	var out []HSNSummary
+	for _, l := range lines {
+		k := key{l.HSNCode, l.UQC, l.GSTRate}
+		i, ok := index[k]
+		if !ok {
+			i = len(out)
+			index[k] = i
+			out = append(out, HSNSummary{HSNCode: l.HSNCode, Description: l.Description, UQC: l.UQC, GSTRate: l.GSTRate})
+		}
+		h := &out[i]
+		h.Quantity += l.Quantity
+		h.TaxableValue = money.Round2(h.TaxableValue + l.TaxableValue)
+		h.CGSTAmount = money.Round2(h.CGSTAmount + l.CGSTAmount)
+		h.SGSTAmount = money.Round2(h.SGSTAmount + l.SGSTAmount)
+		h.IGSTAmount = money.Round2(h.IGSTAmount + l.IGSTAmount)
+		h.TotalValue = money.Round2(h.TotalValue + l.TotalValue)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].HSNCode != out[j].HSNCode {
+			return out[i].HSNCode < out[j].HSNCode
+		}
+		return out[i].GSTRate < out[j].GSTRate
+	})
+	return out
+}
+
+// parsePeriod turns YYYY-MM into the first and last day of that month
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q, expected YYYY-MM", period)
+	}
+	return start, start.AddDate(0, 1, -1), nil
+}
@@ -0,0 +1,395 @@
+package gst
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+func TestSplitTax(t *testing.T) {
+	tests := []struct {
+		name                string
+		taxable, rate       float64
+		st                  SupplyType
+		wantC, wantS, wantI float64
+	}{
+		{"intra-state halves the rate", 100, 12, SupplyIntra, 6, 6, 0},
+		{"inter-state is all IGST", 100, 12, SupplyInter, 0, 0, 12},
+		{"SGST takes the rounding difference", 10.1, 5, SupplyIntra, 0.26, 0.25, 0},
+		{"exempt", 250, 0, SupplyIntra, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, s, i := splitTax(tt.taxable, tt.rate, tt.st)
+			if c != tt.wantC || s != tt.wantS || i != tt.wantI {
+				t.Errorf("splitTax(%v, %v, %s) = %v/%v/%v, want %v/%v/%v", tt.taxable, tt.rate, tt.st, c, s, i, tt.wantC, tt.wantS, tt.wantI)
+			}
+		})
+	}
+}
+
+func TestSupplyType(t *testing.T) {
+	tests := []struct {
+		seller, pos string
+		want        SupplyType
+	}{
+		{"29", "29", SupplyIntra},
+		{"29", "27", SupplyInter},
+		{"", "27", SupplyIntra},
+		{"29", "", SupplyIntra},
+	}
+
+	for _, tt := range tests {
+		if got := supplyType(tt.seller, tt.pos); got != tt.want {
+			t.Errorf("supplyType(%q, %q) = %s, want %s", tt.seller, tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestUQC(t *testing.T) {
+	tests := []struct {
+		unit, want string
+	}{
+		{"Tablet", "TBS"},
+		{" caps ", "NOS"},
+		{"CAPSULE", "TBS"},
+		{"strip", "STR"},
+		{"Bottle", "BTL"},
+		{"ml", "MLT"},
+		{"Ampoule", "VLS"},
+		{"", "NOS"},
+	}
+
+	for _, tt := range tests {
+		if got := UQC(tt.unit); got != tt.want {
+			t.Errorf("UQC(%q) = %q, want %q", tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestSummariseHSN(t *testing.T) {
+	lines := []TaxLine{
+		{HSNCode: "3004", UQC: "TBS", GSTRate: 12, Quantity: 10, TaxableValue: 100, CGSTAmount: 6, SGSTAmount: 6, TotalValue: 112},
+		{HSNCode: "3004", UQC: "TBS", GSTRate: 5, Quantity: 2, TaxableValue: 40, CGSTAmount: 1, SGSTAmount: 1, TotalValue: 42},
+		{HSNCode: "3004", UQC: "TBS", GSTRate: 12, Quantity: 5, TaxableValue: 50.5, CGSTAmount: 3.03, SGSTAmount: 3.03, TotalValue: 56.56},
+		{HSNCode: "3003", UQC: "BTL", GSTRate: 12, Quantity: -1, TaxableValue: -80, IGSTAmount: -9.6, TotalValue: -89.6},
+	}
+
+	tests := []struct {
+		hsn     string
+		rate    float64
+		qty     int
+		taxable float64
+		total   float64
+	}{
+		{"3003", 12, -1, -80, -89.6},
+		{"3004", 5, 2, 40, 42},
+		{"3004", 12, 15, 150.5, 168.56},
+	}
+
+	got := summariseHSN(lines)
+	if len(got) != len(tests) {
+		t.Fatalf("got %d HSN rows, want %d: %+v", len(got), len(tests), got)
+	}
+	for i, tt := range tests {
+		h := got[i]
+		if h.HSNCode != tt.hsn || h.GSTRate != tt.rate || h.Quantity != tt.qty || h.TaxableValue != tt.taxable || h.TotalValue != tt.total {
+			t.Errorf("row %d = %s@%v qty %d taxable %v total %v, want %s@%v qty %d taxable %v total %v",
+				i, h.HSNCode, h.GSTRate, h.Quantity, h.TaxableValue, h.TotalValue, tt.hsn, tt.rate, tt.qty, tt.taxable, tt.total)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		period   string
+		from, to string
+		wantErr  bool
+	}{
+		{"2026-02", "2026-02-01", "2026-02-28", false},
+		{"2024-02", "2024-02-01", "2024-02-29", false},
+		{"2026-12", "2026-12-01", "2026-12-31", false},
+		{"2026-13", "", "", true},
+		{"02-2026", "", "", true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := parsePeriod(tt.period)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parsePeriod(%q) error = %v, wantErr %v", tt.period, err, tt.wantErr)
+		}
+		if err == nil && (from.Format("2006-01-02") != tt.from || to.Format("2006-01-02") != tt.to) {
+			t.Errorf("parsePeriod(%q) = %s..%s, want %s..%s", tt.period, from.Format("2006-01-02"), to.Format("2006-01-02"), tt.from, tt.to)
+		}
+	}
+}
+
+// fakeRepository keeps tax documents in memory
+type fakeRepository struct {
+	Repository
+	profile  *Profile
+	products map[uuid.UUID]ProductTax
+	invoice  *TaxDocument
+	docs     []TaxDocument
+	created  []*TaxDocument
+	createTx []*sql.Tx
+}
+
+func (f *fakeRepository) GetProfile(context.Context, uuid.UUID) (*Profile, error) {
+	return f.profile, nil
+}
+
+func (f *fakeRepository) GetPharmacyDetails(context.Context, uuid.UUID) (string, string, error) {
+	return "City Pharmacy", "MG Road", nil
+}
+
+func (f *fakeRepository) GetProductTax(context.Context, uuid.UUID, []uuid.UUID) (map[uuid.UUID]ProductTax, error) {
+	return f.products, nil
+}
+
+func (f *fakeRepository) GetSaleInvoice(context.Context, uuid.UUID, uuid.UUID) (*TaxDocument, error) {
+	return f.invoice, nil
+}
+
+func (f *fakeRepository) GetReturnCreditNote(context.Context, uuid.UUID, uuid.UUID) (*TaxDocument, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) CreateDocument(_ context.Context, tx *sql.Tx, doc *TaxDocument) error {
+	f.created = append(f.created, doc)
+	f.createTx = append(f.createTx, tx)
+	return nil
+}
+
+func (f *fakeRepository) ListDocuments(context.Context, uuid.UUID, time.Time, time.Time) ([]TaxDocument, error) {
+	return f.docs, nil
+}
+
+var karnataka = &Profile{GSTIN: "29ABCDE1234F1Z5", LegalName: "City Pharmacy LLP", TradeName: "City Pharmacy", StateCode: "29"}
+
+func TestIssueInvoice(t *testing.T) {
+	product := uuid.New()
+	line := InvoiceLine{ProductID: product, MedicineName: "Amoxicillin 500mg", Quantity: 2, MRP: 100, DiscountPercentage: 10, TaxPercentage: 12}
+
+	tests := []struct {
+		name        string
+		profile     *Profile
+		in          InvoiceInput
+		wantPOS     string
+		wantSupply  SupplyType
+		wantSeller  string
+		wantCGST    float64
+		wantIGST    float64
+		wantLegacy  bool
+		wantErr     bool
+		wantCreated bool
+	}{
+		{
+			name:    "counter sale in the pharmacy's state",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV/25-26/000001", Lines: []InvoiceLine{line}},
+			wantPOS: "29", wantSupply: SupplyIntra, wantSeller: "City Pharmacy", wantCGST: 10.8, wantCreated: true,
+		},
+		{
+			name:    "registered buyer in another state",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV/25-26/000002", BuyerGSTIN: "27aaacm1234k1z2", Lines: []InvoiceLine{line}},
+			wantPOS: "27", wantSupply: SupplyInter, wantSeller: "City Pharmacy", wantIGST: 21.6, wantCreated: true,
+		},
+		{
+			name:    "explicit place of supply",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV/25-26/000003", PlaceOfSupply: "30", Lines: []InvoiceLine{line}},
+			wantPOS: "30", wantSupply: SupplyInter, wantSeller: "City Pharmacy", wantIGST: 21.6, wantCreated: true,
+		},
+		{
+			name:    "without a GST profile",
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV/25-26/000004", Lines: []InvoiceLine{line}},
+			wantPOS: "", wantSupply: SupplyIntra, wantSeller: "City Pharmacy", wantCGST: 10.8, wantCreated: true,
+		},
+		{
+			name:    "sale numbered before the series",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV-20250301-1a2b3c4d", Lines: []InvoiceLine{line}},
+			wantPOS: "29", wantSupply: SupplyIntra, wantSeller: "City Pharmacy", wantCGST: 10.8, wantLegacy: true, wantCreated: true,
+		},
+		{
+			name:    "malformed buyer GSTIN",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV/25-26/000005", BuyerGSTIN: "27AAACM1234", Lines: []InvoiceLine{line}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown place of supply",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), InvoiceNo: "INV/25-26/000006", PlaceOfSupply: "99", Lines: []InvoiceLine{line}},
+			wantErr: true,
+		},
+		{
+			name:    "sale without an invoice number",
+			profile: karnataka,
+			in:      InvoiceInput{SaleID: uuid.New(), Lines: []InvoiceLine{line}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{profile: tt.profile, products: map[uuid.UUID]ProductTax{product: {ID: product, HSNCode: "3004", UnitType: "Strip"}}}
+			doc, err := NewService(repo).IssueInvoice(context.Background(), nil, uuid.New(), tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IssueInvoice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (len(repo.created) == 1) != tt.wantCreated {
+				t.Fatalf("created %d documents, want created %v", len(repo.created), tt.wantCreated)
+			}
+			if err != nil {
+				return
+			}
+			if doc.PlaceOfSupply != tt.wantPOS || doc.SupplyType != tt.wantSupply || doc.SellerName != tt.wantSeller {
+				t.Errorf("pos/supply/seller = %q/%s/%q, want %q/%s/%q", doc.PlaceOfSupply, doc.SupplyType, doc.SellerName, tt.wantPOS, tt.wantSupply, tt.wantSeller)
+			}
+			if doc.DocumentNo != tt.in.InvoiceNo || doc.LegacyNumber != tt.wantLegacy {
+				t.Errorf("number = %s (legacy %v), want %s (legacy %v)", doc.DocumentNo, doc.LegacyNumber, tt.in.InvoiceNo, tt.wantLegacy)
+			}
+			if doc.TaxableValue != 180 || doc.CGSTAmount != tt.wantCGST || doc.SGSTAmount != tt.wantCGST || doc.IGSTAmount != tt.wantIGST {
+				t.Errorf("taxable/cgst/sgst/igst = %v/%v/%v/%v, want 180/%v/%v/%v",
+					doc.TaxableValue, doc.CGSTAmount, doc.SGSTAmount, doc.IGSTAmount, tt.wantCGST, tt.wantCGST, tt.wantIGST)
+			}
+			if doc.TotalValue != 201.6 {
+				t.Errorf("TotalValue = %v, want 201.6", doc.TotalValue)
+			}
+			if len(doc.HSNSummary) != 1 || doc.HSNSummary[0].UQC != "STR" {
+				t.Errorf("HSNSummary = %+v, want one STR row", doc.HSNSummary)
+			}
+		})
+	}
+}
+
+func TestIssueCreditNote(t *testing.T) {
+	product := uuid.New()
+	invoiceDate := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	interState := &TaxDocument{
+		DocumentNo: "INV/25-26/000002", DocumentDate: invoiceDate, BuyerName: "Medicare Clinic",
+		BuyerGSTIN: "27AAACM1234K1Z2", PlaceOfSupply: "27", SupplyType: SupplyInter,
+	}
+	in := CreditNoteInput{
+		SaleID:         uuid.New(),
+		ReturnID:       uuid.New(),
+		CreditNoteNo:   "CN/25-26/000001",
+		CreditNoteDate: time.Date(2026, 3, 20, 16, 0, 0, 0, time.UTC),
+		InvoiceNo:      "INV-20250301-1a2b3c4d",
+		InvoiceDate:    invoiceDate,
+		Lines:          []CreditNoteLine{{ProductID: product, Quantity: 1, Amount: 112, TaxPercentage: 12}},
+	}
+
+	tests := []struct {
+		name         string
+		invoice      *TaxDocument
+		tx           *sql.Tx
+		wantOriginal string
+		wantSupply   SupplyType
+		wantBuyer    string
+		wantIGST     float64
+		wantCGST     float64
+	}{
+		{"follows the invoice it reverses", interState, &sql.Tx{}, "INV/25-26/000002", SupplyInter, "Medicare Clinic", 12, 0},
+		{"sale invoiced before tax documents", nil, nil, "INV-20250301-1a2b3c4d", SupplyIntra, "", 0, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{profile: karnataka, invoice: tt.invoice, products: map[uuid.UUID]ProductTax{}}
+			doc, err := NewService(repo).IssueCreditNote(context.Background(), tt.tx, uuid.New(), in)
+			if err != nil {
+				t.Fatalf("IssueCreditNote() error = %v", err)
+			}
+			if len(repo.created) != 1 || repo.createTx[0] != tt.tx {
+				t.Fatalf("credit note was not created in the caller's transaction")
+			}
+			if doc.DocumentType != DocCreditNote || doc.DocumentNo != in.CreditNoteNo || *doc.ReturnID != in.ReturnID {
+				t.Errorf("document = %s %s for return %v, want %s %s for %s", doc.DocumentType, doc.DocumentNo, doc.ReturnID, DocCreditNote, in.CreditNoteNo, in.ReturnID)
+			}
+			if !doc.DocumentDate.Equal(in.CreditNoteDate) {
+				t.Errorf("credit note date = %s, want the return's date %s", doc.DocumentDate, in.CreditNoteDate)
+			}
+			if doc.OriginalDocumentNo != tt.wantOriginal || doc.OriginalDocumentDate == nil || !doc.OriginalDocumentDate.Equal(invoiceDate) {
+				t.Errorf("original = %s %v, want %s %s", doc.OriginalDocumentNo, doc.OriginalDocumentDate, tt.wantOriginal, invoiceDate)
+			}
+			if doc.SupplyType != tt.wantSupply || doc.BuyerName != tt.wantBuyer {
+				t.Errorf("supply/buyer = %s/%q, want %s/%q", doc.SupplyType, doc.BuyerName, tt.wantSupply, tt.wantBuyer)
+			}
+			if doc.TaxableValue != 100 || doc.IGSTAmount != tt.wantIGST || doc.CGSTAmount != tt.wantCGST || doc.TotalValue != 112 {
+				t.Errorf("taxable/igst/cgst/total = %v/%v/%v/%v, want 100/%v/%v/112", doc.TaxableValue, doc.IGSTAmount, doc.CGSTAmount, doc.TotalValue, tt.wantIGST, tt.wantCGST)
+			}
+		})
+	}
+}
+
+func TestOutwardReturnSections(t *testing.T) {
+	sale := func() uuid.UUID { return uuid.New() }
+	line := func(rate, taxable float64, st SupplyType) TaxLine {
+		l := TaxLine{HSNCode: "3004", UQC: "TBS", GSTRate: rate, Quantity: 1, TaxableValue: taxable}
+		l.CGSTAmount, l.SGSTAmount, l.IGSTAmount = splitTax(taxable, rate, st)
+		l.TotalValue = money.Round2(taxable + l.CGSTAmount + l.SGSTAmount + l.IGSTAmount)
+		return l
+	}
+	doc := func(typ DocumentType, saleID uuid.UUID, gstin, pos string, st SupplyType, taxable float64) TaxDocument {
+		d := TaxDocument{DocumentType: typ, DocumentNo: "X", SaleID: saleID, BuyerGSTIN: gstin, PlaceOfSupply: pos, SupplyType: st}
+		d.Lines = []TaxLine{line(12, taxable, st)}
+		totalDocument(&d)
+		return d
+	}
+	large := sale()
+
+	repo := &fakeRepository{
+		profile: karnataka,
+		docs: []TaxDocument{
+			doc(DocInvoice, sale(), "27AAACM1234K1Z2", "27", SupplyInter, 1000),
+			doc(DocInvoice, large, "", "27", SupplyInter, 200000),
+			doc(DocInvoice, sale(), "", "29", SupplyIntra, 500),
+			doc(DocInvoice, sale(), "", "29", SupplyIntra, 300),
+			doc(DocCreditNote, sale(), "27AAACM1234K1Z2", "27", SupplyInter, 100),
+			doc(DocCreditNote, large, "", "27", SupplyInter, 1000),
+			doc(DocCreditNote, sale(), "", "29", SupplyIntra, 200),
+		},
+	}
+
+	out, err := NewService(repo).OutwardReturn(context.Background(), uuid.New(), "2026-03")
+	if err != nil {
+		t.Fatalf("OutwardReturn() error = %v", err)
+	}
+	if out.FP != "032026" || out.GSTIN != karnataka.GSTIN {
+		t.Errorf("GSTIN/FP = %s/%s, want %s/032026", out.GSTIN, out.FP, karnataka.GSTIN)
+	}
+
+	tests := []struct {
+		section string
+		got     int
+		want    int
+	}{
+		{"b2b", len(out.B2B), 1},
+		{"b2cl", len(out.B2CL), 1},
+		{"b2cs", len(out.B2CS), 1},
+		{"cdnr", len(out.CDNR), 1},
+		{"cdnur", len(out.CDNUR), 1},
+		{"hsn", len(out.HSN.Data), 1},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s has %d entries, want %d", tt.section, tt.got, tt.want)
+		}
+	}
+	if len(out.B2CS) == 1 && out.B2CS[0].Taxable != 600 {
+		t.Errorf("B2CS taxable = %v, want 600 (800 invoiced less 200 credited)", out.B2CS[0].Taxable)
+	}
+	if len(out.HSN.Data) == 1 && out.HSN.Data[0].Quantity != 1 {
+		t.Errorf("HSN quantity = %d, want 1 (4 sold less 3 returned)", out.HSN.Data[0].Quantity)
+	}
+}
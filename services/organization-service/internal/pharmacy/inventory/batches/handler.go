@@ -115,6 +115,33 @@ func (h *Handler) ListSellable(c *gin.Context) {
 	})
 }
 
+// Resolve returns the batch behind a scanned internal label; ?code=PB3F9A2C01D4 or the full QR payload
+func (h *Handler) Resolve(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid pharmacy ID"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	batch, err := h.svc.ResolveLabel(c.Request.Context(), pharmacyID, code)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    batch,
+	})
+}
+
 func (h *Handler) GetHistory(c *gin.Context) {
 	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
 	pharmacyID, err := uuid.Parse(pharmacyIDStr)
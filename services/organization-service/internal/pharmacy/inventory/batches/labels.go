@@ -0,0 +1,23 @@
+package batches
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LabelCodePrefix marks internal batch codes; the rest is the first ten hex
+// digits of the batch id, e.g. PB3F9A2C01D4
+const LabelCodePrefix = "PB"
+
+var labelCodePattern = regexp.MustCompile(`^PB[0-9A-F]{10}$`)
+
+// ParseLabelScan extracts the internal code from a scan. QR labels carry
+// "code|medicine|batch|expiry"; Code128 labels carry the code alone.
+func ParseLabelScan(scan string) (string, bool) {
+	code := strings.TrimSpace(scan)
+	if i := strings.IndexByte(code, '|'); i >= 0 {
+		code = code[:i]
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, labelCodePattern.MatchString(code)
+}
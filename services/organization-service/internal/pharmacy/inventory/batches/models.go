@@ -17,6 +17,7 @@ type Batch struct {
 	MfgDate       time.Time `json:"mfg_date"`
 	ExpiryDate    time.Time `json:"expiry_date"`
 	RackNo        string    `json:"rack_no,omitempty"`
+	LabelCode     string    `json:"label_code,omitempty"`
 
 	QuantityAvailable int `json:"quantity_available"`
 
@@ -72,6 +73,19 @@ type UpdateBatchDTO struct {
 	Notes           string
 }
 
+// MovementDTO changes the quantity of an existing batch and records it in the stock ledger
+type MovementDTO struct {
+	PharmacyID      uuid.UUID
+	MedicineID      uuid.UUID
+	BatchID         uuid.UUID
+	QuantityChange  int
+	TransactionType string
+	ReferenceType   string
+	ReferenceID     *uuid.UUID
+	PerformedBy     *uuid.UUID
+	Notes           string
+}
+
 type BatchStats struct {
 	TotalStocks       int     `json:"total_stocks"`
 	TotalStockValue   float64 `json:"total_stock_value"`
@@ -18,7 +18,10 @@ type Repository interface {
 	GetBatchAuditLogs(ctx context.Context, pharmacyID, batchID uuid.UUID) ([]BatchAuditLog, error)
 	Update(ctx context.Context, tx *sql.Tx, pharmacyID, batchID uuid.UUID, req EditBatchRequest) error
 	GetBatch(ctx context.Context, pharmacyID, batchID uuid.UUID) (*Batch, error)
+	GetBatchByLabelCode(ctx context.Context, pharmacyID uuid.UUID, code string) (*Batch, error)
 	UpdateBatchQuantity(ctx context.Context, tx *sql.Tx, pharmacyID, batchID uuid.UUID, quantityChange int) error
+	// RecordMovement applies a quantity change inside tx and writes the matching ledger entry
+	RecordMovement(ctx context.Context, tx *sql.Tx, dto MovementDTO) (int, error)
 	AddReturnStock(ctx context.Context, tx *sql.Tx, dto UpdateBatchDTO, batchID uuid.UUID) error
 	BeginTx(ctx context.Context) (*sql.Tx, error)
 }
@@ -257,6 +260,7 @@ func (r *postgresRepository) ListSellableBatches(ctx context.Context, pharmacyID
 	query := `
 		SELECT 
 			b.id, b.pharmacy_id, b.medicine_id, m.name as medicine_name, m.brand_name as medicine_brand, b.batch_no, b.mfg_date, b.expiry_date, b.rack_no,
+			COALESCE(b.label_code, ''),
 			b.quantity_available, b.cost_price, b.mrp, b.unit_price,
 			b.cgst_rate, b.sgst_rate, b.total_tax_percentage,
 			b.retail_disc_perc, b.staff_disc_perc, b.special_disc_perc, b.max_disc_perc,
@@ -271,10 +275,15 @@ func (r *postgresRepository) ListSellableBatches(ctx context.Context, pharmacyID
 	args := []interface{}{pharmacyID}
 	placeholderID := 2
 
-	if search != "" {
-		query += fmt.Sprintf(" AND (m.name ILIKE $%d OR b.batch_no ILIKE $%d)", placeholderID, placeholderID)
-		args = append(args, "%"+search+"%")
+	// A scanned internal label pins the exact batch; otherwise match names, batch numbers and manufacturer barcodes
+	if code, ok := ParseLabelScan(search); ok {
+		query += fmt.Sprintf(" AND b.label_code = $%d", placeholderID)
+		args = append(args, code)
 		placeholderID++
+	} else if search != "" {
+		query += fmt.Sprintf(" AND (m.name ILIKE $%d OR b.batch_no ILIKE $%d OR m.barcode = $%d)", placeholderID, placeholderID, placeholderID+1)
+		args = append(args, "%"+search+"%", search)
+		placeholderID += 2
 	}
 
 	// Always prioritize batches expiring soonest for sales (FEFO)
@@ -295,6 +304,7 @@ func (r *postgresRepository) ListSellableBatches(ctx context.Context, pharmacyID
 		var supplierName sql.NullString
 		err := rows.Scan(
 			&b.ID, &b.PharmacyID, &b.MedicineID, &medicineName, &medicineBrand, &b.BatchNo, &b.MfgDate, &b.ExpiryDate, &b.RackNo,
+			&b.LabelCode,
 			&b.QuantityAvailable, &b.CostPrice, &b.MRP, &b.UnitPrice,
 			&b.CGSTRate, &b.SGSTRate, &b.TotalTaxPercentage,
 			&b.RetailDiscPerc, &b.StaffDiscPerc, &b.SpecialDiscPerc, &b.MaxDiscPerc,
@@ -466,6 +476,34 @@ func (r *postgresRepository) GetBatch(ctx context.Context, pharmacyID, batchID u
 	return b, err
 }
 
+func (r *postgresRepository) GetBatchByLabelCode(ctx context.Context, pharmacyID uuid.UUID, code string) (*Batch, error) {
+	query := `
+		SELECT 
+			b.id, b.pharmacy_id, b.medicine_id, COALESCE(m.name, ''), COALESCE(m.brand_name, ''), b.batch_no, b.mfg_date, b.expiry_date,
+			COALESCE(b.rack_no, ''), COALESCE(b.label_code, ''),
+			b.quantity_available, b.cost_price, b.mrp, b.unit_price,
+			b.cgst_rate, b.sgst_rate, b.total_tax_percentage,
+			b.retail_disc_perc, b.staff_disc_perc, b.special_disc_perc, b.max_disc_perc,
+			b.supplier_id, b.created_at, b.updated_at
+		FROM inventory.batches b
+		LEFT JOIN inventory.medicines m ON b.medicine_id = m.id
+		WHERE b.pharmacy_id = $1 AND b.label_code = $2
+	`
+	b := &Batch{}
+	err := r.db.QueryRowContext(ctx, query, pharmacyID, code).Scan(
+		&b.ID, &b.PharmacyID, &b.MedicineID, &b.MedicineName, &b.MedicineBrand, &b.BatchNo, &b.MfgDate, &b.ExpiryDate,
+		&b.RackNo, &b.LabelCode,
+		&b.QuantityAvailable, &b.CostPrice, &b.MRP, &b.UnitPrice,
+		&b.CGSTRate, &b.SGSTRate, &b.TotalTaxPercentage,
+		&b.RetailDiscPerc, &b.StaffDiscPerc, &b.SpecialDiscPerc, &b.MaxDiscPerc,
+		&b.SupplierID, &b.CreatedAt, &b.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no batch carries label %s", code)
+	}
+	return b, err
+}
+
 func (r *postgresRepository) UpdateBatchQuantity(ctx context.Context, tx *sql.Tx, pharmacyID, batchID uuid.UUID, quantityChange int) error {
 	query := `
 		UPDATE inventory.batches
@@ -481,6 +519,39 @@ func (r *postgresRepository) UpdateBatchQuantity(ctx context.Context, tx *sql.Tx
 	return err
 }
 
+func (r *postgresRepository) RecordMovement(ctx context.Context, tx *sql.Tx, dto MovementDTO) (int, error) {
+	var balanceAfter int
+	err := tx.QueryRowContext(ctx, `
+		UPDATE inventory.batches
+		SET quantity_available = quantity_available + $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND pharmacy_id = $3
+		RETURNING quantity_available
+	`, dto.QuantityChange, dto.BatchID, dto.PharmacyID).Scan(&balanceAfter)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("batch not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update batch quantity: %w", err)
+	}
+	if balanceAfter < 0 {
+		return 0, fmt.Errorf("insufficient stock: balance would be %d", balanceAfter)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO inventory.stock_ledger (
+			pharmacy_id, medicine_id, batch_id, transaction_type,
+			quantity_change, balance_after, reference_type,
+			reference_id, performed_by, notes
+		) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, NULLIF($10, ''))
+	`, dto.PharmacyID, dto.MedicineID, dto.BatchID, dto.TransactionType,
+		dto.QuantityChange, balanceAfter, dto.ReferenceType,
+		dto.ReferenceID, dto.PerformedBy, dto.Notes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record stock ledger: %w", err)
+	}
+	return balanceAfter, nil
+}
+
 func (r *postgresRepository) AddReturnStock(ctx context.Context, tx *sql.Tx, dto UpdateBatchDTO, batchID uuid.UUID) error {
 	// 1. Update ONLY quantity
 	query := `
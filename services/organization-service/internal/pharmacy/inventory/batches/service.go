@@ -2,6 +2,7 @@ package batches
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -12,10 +13,15 @@ type Service interface {
 	Repo() Repository // Internal use
 	ListBatches(ctx context.Context, pharmacyID uuid.UUID, medicineID *uuid.UUID, limit, offset int, search, supplierID, filter string) ([]Batch, int, error)
 	ListSellableBatches(ctx context.Context, pharmacyID uuid.UUID, search string, limit int) ([]Batch, error)
+	// ResolveLabel turns a scanned internal label (Code128 or QR) into its batch
+	ResolveLabel(ctx context.Context, pharmacyID uuid.UUID, scan string) (*Batch, error)
 	GetStats(ctx context.Context, pharmacyID uuid.UUID) (BatchStats, error)
 	GetBatchAuditLogs(ctx context.Context, pharmacyID, batchID uuid.UUID) ([]BatchAuditLog, error)
 	UpdateBatch(ctx context.Context, pharmacyID, batchID, changedBy uuid.UUID, changedByName string, req EditBatchRequest) error
 	ProcessReturn(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req BatchReturnRequest) error
+	// ProcessReturnTx puts returned stock back inside a caller-owned transaction,
+	// so a sale return restocks together with its credit note and refund
+	ProcessReturnTx(ctx context.Context, tx *sql.Tx, pharmacyID, userID uuid.UUID, userName string, req BatchReturnRequest) error
 }
 
 type service struct {
@@ -33,6 +39,14 @@ func (s *service) ListSellableBatches(ctx context.Context, pharmacyID uuid.UUID,
 	return s.repo.ListSellableBatches(ctx, pharmacyID, search, limit)
 }
 
+func (s *service) ResolveLabel(ctx context.Context, pharmacyID uuid.UUID, scan string) (*Batch, error) {
+	code, ok := ParseLabelScan(scan)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an internal batch label", scan)
+	}
+	return s.repo.GetBatchByLabelCode(ctx, pharmacyID, code)
+}
+
 func (s *service) GetStats(ctx context.Context, pharmacyID uuid.UUID) (BatchStats, error) {
 	return s.repo.GetStats(ctx, pharmacyID)
 }
@@ -77,6 +91,14 @@ func (s *service) ProcessReturn(ctx context.Context, pharmacyID, userID uuid.UUI
 	}
 	defer tx.Rollback()
 
+	if err := s.ProcessReturnTx(ctx, tx, pharmacyID, userID, userName, req); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) ProcessReturnTx(ctx context.Context, tx *sql.Tx, pharmacyID, userID uuid.UUID, userName string, req BatchReturnRequest) error {
 	for _, item := range req.Items {
 		// 1. Fetch batch to ensure it exists and get medicine_id
 		batch, err := s.repo.GetBatch(ctx, pharmacyID, item.BatchID)
@@ -136,7 +158,7 @@ func (s *service) ProcessReturn(ctx context.Context, pharmacyID, userID uuid.UUI
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 func (s *service) Repo() Repository {
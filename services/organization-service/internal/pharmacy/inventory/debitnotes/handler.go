@@ -0,0 +1,213 @@
+package debitnotes
+
+import (
+	"fmt"
+	"net/http"
+	"organization-service/middleware"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+}
+
+type PaginationMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// ListCandidates returns expired and near-expiry batches of a supplier (?supplier_id=&days=)
+func (h *Handler) ListCandidates(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	supplierID, err := uuid.Parse(c.Query("supplier_id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "supplier_id is required")
+		return
+	}
+
+	days, _ := strconv.Atoi(c.Query("days"))
+	candidates, err := h.svc.ListCandidates(c.Request.Context(), pharmacyID, supplierID, days)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, candidates)
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req CreateDebitNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	note, err := h.svc.Create(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, note)
+}
+
+func (h *Handler) GetByID(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid debit note ID")
+		return
+	}
+
+	note, err := h.svc.Get(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, note)
+}
+
+func (h *Handler) List(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+
+	var supplierID *uuid.UUID
+	if s := c.Query("supplier_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid supplier ID")
+			return
+		}
+		supplierID = &id
+	}
+
+	notes, total, err := h.svc.List(c.Request.Context(), pharmacyID, supplierID, c.Query("status"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    notes,
+		Meta: PaginationMeta{
+			Total:  total,
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		},
+	})
+}
+
+func (h *Handler) RecordCredit(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid debit note ID")
+		return
+	}
+
+	var req RecordCreditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	note, err := h.svc.RecordCredit(c.Request.Context(), pharmacyID, userID, userName, id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, note)
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
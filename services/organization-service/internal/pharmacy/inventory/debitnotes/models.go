@@ -0,0 +1,162 @@
+package debitnotes
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusIssued           Status = "ISSUED"
+	StatusPartiallySettled Status = "PARTIALLY_SETTLED"
+	StatusSettled          Status = "SETTLED"
+)
+
+// ReturnReason explains why a batch line went back to the supplier
+type ReturnReason string
+
+const (
+	ReasonExpired    ReturnReason = "EXPIRED"
+	ReasonNearExpiry ReturnReason = "NEAR_EXPIRY"
+	ReasonDamaged    ReturnReason = "DAMAGED"
+	ReasonOther      ReturnReason = "OTHER"
+)
+
+// CreditMode is how the supplier settles a debit note
+type CreditMode string
+
+const (
+	// CreditAdjust sets the credit off against outstanding purchase invoices
+	CreditAdjust CreditMode = "ADJUST"
+	// CreditRefund is money paid back by the supplier
+	CreditRefund CreditMode = "REFUND"
+)
+
+// DefaultNearExpiryDays is the window used when listing return candidates
+const DefaultNearExpiryDays = 90
+
+type DebitNote struct {
+	ID             uuid.UUID       `json:"id"`
+	PharmacyID     uuid.UUID       `json:"pharmacy_id"`
+	SupplierID     uuid.UUID       `json:"supplier_id"`
+	SupplierName   string          `json:"supplier_name"`
+	DebitNoteNo    string          `json:"debit_note_no"`
+	Status         Status          `json:"status"`
+	Reason         string          `json:"reason"`
+	TotalAmount    float64         `json:"total_amount"`
+	CreditedAmount float64         `json:"credited_amount"`
+	PendingAmount  float64         `json:"pending_amount"`
+	Notes          string          `json:"notes"`
+	CreatedBy      uuid.UUID       `json:"created_by"`
+	CreatedByName  string          `json:"created_by_name"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Items          []DebitNoteItem `json:"items,omitempty"`
+	Credits        []Credit        `json:"credits,omitempty"`
+}
+
+type DebitNoteItem struct {
+	ID           uuid.UUID    `json:"id"`
+	DebitNoteID  uuid.UUID    `json:"debit_note_id"`
+	MedicineID   uuid.UUID    `json:"medicine_id"`
+	MedicineName string       `json:"medicine_name"`
+	BatchID      uuid.UUID    `json:"batch_id"`
+	BatchNo      string       `json:"batch_no"`
+	ExpiryDate   time.Time    `json:"expiry_date"`
+	Quantity     int          `json:"quantity"` // base units
+	UnitCost     float64      `json:"unit_cost"`
+	Amount       float64      `json:"amount"`
+	ReturnReason ReturnReason `json:"return_reason"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// Credit is one settlement received from the supplier against a debit note
+type Credit struct {
+	ID                   uuid.UUID    `json:"id"`
+	DebitNoteID          uuid.UUID    `json:"debit_note_id"`
+	PharmacyID           uuid.UUID    `json:"pharmacy_id"`
+	SupplierCreditNoteNo string       `json:"supplier_credit_note_no"`
+	Mode                 CreditMode   `json:"mode"`
+	Amount               float64      `json:"amount"`
+	CreatedBy            uuid.UUID    `json:"created_by"`
+	CreatedByName        string       `json:"created_by_name"`
+	CreatedAt            time.Time    `json:"created_at"`
+	Allocations          []Allocation `json:"allocations,omitempty"`
+}
+
+// Allocation is the part of an ADJUST credit set off against one purchase invoice
+type Allocation struct {
+	ID         uuid.UUID `json:"id"`
+	CreditID   uuid.UUID `json:"credit_id"`
+	PurchaseID uuid.UUID `json:"purchase_id"`
+	InvoiceNo  string    `json:"invoice_no"`
+	Amount     float64   `json:"amount"`
+}
+
+// ReturnCandidate is a supplier batch that is expired or close to expiry
+type ReturnCandidate struct {
+	BatchID           uuid.UUID    `json:"batch_id"`
+	MedicineID        uuid.UUID    `json:"medicine_id"`
+	MedicineName      string       `json:"medicine_name"`
+	MedicineBrand     string       `json:"medicine_brand"`
+	BatchNo           string       `json:"batch_no"`
+	ExpiryDate        time.Time    `json:"expiry_date"`
+	DaysToExpiry      int          `json:"days_to_expiry"`
+	QuantityAvailable int          `json:"quantity_available"`
+	UnitCost          float64      `json:"unit_cost"`
+	Value             float64      `json:"value"`
+	SuggestedReason   ReturnReason `json:"suggested_reason"`
+}
+
+// returnBatch is the batch data needed to validate and cost a return line
+type returnBatch struct {
+	ID                uuid.UUID
+	MedicineID        uuid.UUID
+	MedicineName      string
+	BatchNo           string
+	ExpiryDate        time.Time
+	QuantityAvailable int
+	CostPrice         float64
+	SupplierID        *uuid.UUID
+}
+
+// outstandingPurchase is a supplier invoice with an unpaid balance
+type outstandingPurchase struct {
+	ID           uuid.UUID
+	InvoiceNo    string
+	PurchaseDate time.Time
+	PaidAmount   float64
+	DueAmount    float64
+}
+
+// Request Structs
+
+type CreateDebitNoteRequest struct {
+	SupplierID uuid.UUID             `json:"supplier_id" validate:"required"`
+	Reason     string                `json:"reason" validate:"max=500"`
+	Notes      string                `json:"notes" validate:"max=500"`
+	Items      []CreateDebitNoteItem `json:"items" validate:"required,min=1,dive"`
+}
+
+type CreateDebitNoteItem struct {
+	BatchID      uuid.UUID    `json:"batch_id" validate:"required"`
+	Quantity     int          `json:"quantity" validate:"required,gt=0"`
+	ReturnReason ReturnReason `json:"return_reason" validate:"omitempty,oneof=EXPIRED NEAR_EXPIRY DAMAGED OTHER"`
+}
+
+// RecordCreditRequest records credit from the supplier. For ADJUST credits,
+// allocations pick the invoices to set off; when omitted the oldest
+// outstanding invoices of the supplier are used first.
+type RecordCreditRequest struct {
+	SupplierCreditNoteNo string              `json:"supplier_credit_note_no" validate:"max=100"`
+	Mode                 CreditMode          `json:"mode" validate:"required,oneof=ADJUST REFUND"`
+	Amount               float64             `json:"amount" validate:"required,gt=0"`
+	Allocations          []AllocationRequest `json:"allocations" validate:"omitempty,dive"`
+}
+
+type AllocationRequest struct {
+	PurchaseID uuid.UUID `json:"purchase_id" validate:"required"`
+	Amount     float64   `json:"amount" validate:"required,gt=0"`
+}
@@ -0,0 +1,391 @@
+package debitnotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	// CreateDebitNote inserts the note and its items; onTx runs in the same transaction
+	// so stock movements commit or roll back with the document
+	CreateDebitNote(ctx context.Context, note *DebitNote, onTx func(tx *sql.Tx) error) error
+	GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*DebitNote, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, status string, limit, offset int) ([]DebitNote, int, error)
+	// CreateCredit stores a settlement and updates the note's credited amount and status
+	CreateCredit(ctx context.Context, note *DebitNote, credit *Credit) error
+	ListCandidates(ctx context.Context, pharmacyID, supplierID uuid.UUID, withinDays int) ([]ReturnCandidate, error)
+	GetBatch(ctx context.Context, pharmacyID, batchID uuid.UUID) (*returnBatch, error)
+	ListOutstandingPurchases(ctx context.Context, pharmacyID, supplierID uuid.UUID) ([]outstandingPurchase, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) CreateDebitNote(ctx context.Context, note *DebitNote, onTx func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Debit note numbers come from the pharmacy's debit note series: DN/26-27/00001
+	if note.DebitNoteNo, err = numbering.Next(ctx, tx, note.PharmacyID, numbering.DocDebitNote, note.CreatedAt); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.debit_notes (
+			id, pharmacy_id, supplier_id, debit_note_no, status, reason, total_amount, credited_amount,
+			notes, created_by, created_by_name, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, note.ID, note.PharmacyID, note.SupplierID, note.DebitNoteNo, note.Status, note.Reason, note.TotalAmount, note.CreditedAmount,
+		note.Notes, note.CreatedBy, note.CreatedByName, note.CreatedAt, note.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert debit note: %w", err)
+	}
+
+	for _, item := range note.Items {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO inventory.debit_note_items (
+				id, debit_note_id, medicine_id, batch_id, batch_no, expiry_date, quantity, unit_cost, amount, return_reason, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`, item.ID, note.ID, item.MedicineID, item.BatchID, item.BatchNo, item.ExpiryDate, item.Quantity,
+			item.UnitCost, item.Amount, item.ReturnReason, item.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert debit note item (%s): %w", item.BatchNo, err)
+		}
+	}
+
+	if err := insertSupplierLog(ctx, tx, note, "DEBIT_NOTE_ISSUED", note.CreatedBy, note.CreatedByName, note.CreatedAt,
+		fmt.Sprintf("%s issued for %.2f (%d items)", note.DebitNoteNo, note.TotalAmount, len(note.Items))); err != nil {
+		return err
+	}
+
+	if onTx != nil {
+		if err := onTx(tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertSupplierLog records the document event in the supplier history
+func insertSupplierLog(ctx context.Context, tx *sql.Tx, note *DebitNote, action string, userID uuid.UUID, userName string, at time.Time, notes string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO supplier_schema.supplier_audit_logs (
+			id, pharmacy_id, supplier_id, action_type, changed_by, changed_by_name, changed_at,
+			reference_type, reference_id, notes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, 'DEBIT_NOTE', $8, $9)
+	`, uuid.New(), note.PharmacyID, note.SupplierID, action, userID, userName, at, note.ID, notes)
+	if err != nil {
+		return fmt.Errorf("failed to write supplier history: %w", err)
+	}
+	return nil
+}
+
+const selectNote = `
+	SELECT d.id, d.pharmacy_id, d.supplier_id, COALESCE(s.name, ''), d.debit_note_no, d.status, COALESCE(d.reason, ''),
+	       d.total_amount, d.credited_amount, COALESCE(d.notes, ''), d.created_by, COALESCE(d.created_by_name, ''),
+	       d.created_at, d.updated_at
+	FROM inventory.debit_notes d
+	LEFT JOIN supplier_schema.suppliers s ON s.id = d.supplier_id
+`
+
+func scanNote(row interface{ Scan(...interface{}) error }) (*DebitNote, error) {
+	var n DebitNote
+	var createdBy uuid.NullUUID
+	if err := row.Scan(
+		&n.ID, &n.PharmacyID, &n.SupplierID, &n.SupplierName, &n.DebitNoteNo, &n.Status, &n.Reason,
+		&n.TotalAmount, &n.CreditedAmount, &n.Notes, &createdBy, &n.CreatedByName,
+		&n.CreatedAt, &n.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	n.CreatedBy = createdBy.UUID
+	n.PendingAmount = money.Round2(n.TotalAmount - n.CreditedAmount)
+	return &n, nil
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*DebitNote, error) {
+	note, err := scanNote(r.db.QueryRowContext(ctx, selectNote+" WHERE d.id = $1 AND d.pharmacy_id = $2", id, pharmacyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("debit note not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT i.id, i.debit_note_id, i.medicine_id, m.name, i.batch_id, COALESCE(i.batch_no, ''), i.expiry_date,
+		       i.quantity, i.unit_cost, i.amount, i.return_reason, i.created_at
+		FROM inventory.debit_note_items i
+		JOIN inventory.medicines m ON m.id = i.medicine_id
+		WHERE i.debit_note_id = $1
+		ORDER BY m.name, i.expiry_date
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item DebitNoteItem
+		if err := rows.Scan(
+			&item.ID, &item.DebitNoteID, &item.MedicineID, &item.MedicineName, &item.BatchID, &item.BatchNo, &item.ExpiryDate,
+			&item.Quantity, &item.UnitCost, &item.Amount, &item.ReturnReason, &item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		note.Items = append(note.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	credits, err := r.listCredits(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	note.Credits = credits
+	return note, nil
+}
+
+func (r *postgresRepository) listCredits(ctx context.Context, noteID uuid.UUID) ([]Credit, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, debit_note_id, pharmacy_id, COALESCE(supplier_credit_note_no, ''), mode, amount,
+		       created_by, COALESCE(created_by_name, ''), created_at
+		FROM inventory.debit_note_credits
+		WHERE debit_note_id = $1
+		ORDER BY created_at
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credits []Credit
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var c Credit
+		var createdBy uuid.NullUUID
+		if err := rows.Scan(
+			&c.ID, &c.DebitNoteID, &c.PharmacyID, &c.SupplierCreditNoteNo, &c.Mode, &c.Amount,
+			&createdBy, &c.CreatedByName, &c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		c.CreatedBy = createdBy.UUID
+		index[c.ID] = len(credits)
+		credits = append(credits, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(credits) == 0 {
+		return credits, nil
+	}
+
+	allocRows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.credit_id, a.purchase_id, COALESCE(p.invoice_no, ''), a.amount
+		FROM inventory.debit_note_allocations a
+		JOIN inventory.debit_note_credits c ON c.id = a.credit_id
+		LEFT JOIN inventory.purchases p ON p.id = a.purchase_id
+		WHERE c.debit_note_id = $1
+		ORDER BY a.created_at
+	`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer allocRows.Close()
+	for allocRows.Next() {
+		var a Allocation
+		if err := allocRows.Scan(&a.ID, &a.CreditID, &a.PurchaseID, &a.InvoiceNo, &a.Amount); err != nil {
+			return nil, err
+		}
+		if i, ok := index[a.CreditID]; ok {
+			credits[i].Allocations = append(credits[i].Allocations, a)
+		}
+	}
+	return credits, allocRows.Err()
+}
+
+func (r *postgresRepository) List(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, status string, limit, offset int) ([]DebitNote, int, error) {
+	where := " WHERE d.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if supplierID != nil {
+		args = append(args, *supplierID)
+		where += fmt.Sprintf(" AND d.supplier_id = $%d", len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND d.status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.debit_notes d"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := selectNote + where + fmt.Sprintf(" ORDER BY d.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var notes []DebitNote
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		notes = append(notes, *n)
+	}
+	return notes, total, rows.Err()
+}
+
+func (r *postgresRepository) CreateCredit(ctx context.Context, note *DebitNote, credit *Credit) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard against concurrent settlements pushing the note past its total
+	var total, credited float64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT total_amount, credited_amount FROM inventory.debit_notes WHERE id = $1 AND pharmacy_id = $2 FOR UPDATE
+	`, note.ID, note.PharmacyID).Scan(&total, &credited); err != nil {
+		return fmt.Errorf("failed to lock debit note: %w", err)
+	}
+	newCredited := money.Round2(credited + credit.Amount)
+	if newCredited > total+0.005 {
+		return fmt.Errorf("credit of %.2f exceeds pending amount %.2f", credit.Amount, money.Round2(total-credited))
+	}
+	status := StatusPartiallySettled
+	if newCredited >= total-0.005 {
+		status = StatusSettled
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.debit_note_credits (
+			id, debit_note_id, pharmacy_id, supplier_credit_note_no, mode, amount, created_by, created_by_name, created_at
+		) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+	`, credit.ID, note.ID, note.PharmacyID, credit.SupplierCreditNoteNo, credit.Mode, credit.Amount,
+		credit.CreatedBy, credit.CreatedByName, credit.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert credit: %w", err)
+	}
+	for _, a := range credit.Allocations {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO inventory.debit_note_allocations (id, credit_id, purchase_id, amount, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, a.ID, credit.ID, a.PurchaseID, a.Amount, credit.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert credit allocation: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE inventory.debit_notes SET credited_amount = $1, status = $2, updated_at = $3 WHERE id = $4
+	`, newCredited, status, credit.CreatedAt, note.ID); err != nil {
+		return fmt.Errorf("failed to update debit note: %w", err)
+	}
+
+	summary := fmt.Sprintf("%s credit of %.2f (%s)", note.DebitNoteNo, credit.Amount, credit.Mode)
+	if credit.SupplierCreditNoteNo != "" {
+		summary += ", supplier credit note " + credit.SupplierCreditNoteNo
+	}
+	if err := insertSupplierLog(ctx, tx, note, "DEBIT_NOTE_CREDIT", credit.CreatedBy, credit.CreatedByName, credit.CreatedAt, summary); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) ListCandidates(ctx context.Context, pharmacyID, supplierID uuid.UUID, withinDays int) ([]ReturnCandidate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT b.id, b.medicine_id, m.name, COALESCE(m.brand_name, ''), b.batch_no, b.expiry_date,
+		       (b.expiry_date - CURRENT_DATE) AS days_to_expiry, b.quantity_available, b.cost_price
+		FROM inventory.batches b
+		JOIN inventory.medicines m ON m.id = b.medicine_id
+		WHERE b.pharmacy_id = $1
+		  AND b.supplier_id = $2
+		  AND b.quantity_available > 0
+		  AND b.expiry_date < CURRENT_DATE + $3::int
+		ORDER BY b.expiry_date ASC, m.name
+	`, pharmacyID, supplierID, withinDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list return candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []ReturnCandidate
+	for rows.Next() {
+		var c ReturnCandidate
+		if err := rows.Scan(
+			&c.BatchID, &c.MedicineID, &c.MedicineName, &c.MedicineBrand, &c.BatchNo, &c.ExpiryDate,
+			&c.DaysToExpiry, &c.QuantityAvailable, &c.UnitCost,
+		); err != nil {
+			return nil, err
+		}
+		c.Value = money.Round2(float64(c.QuantityAvailable) * c.UnitCost)
+		c.SuggestedReason = ReasonNearExpiry
+		if c.DaysToExpiry < 0 {
+			c.SuggestedReason = ReasonExpired
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+func (r *postgresRepository) GetBatch(ctx context.Context, pharmacyID, batchID uuid.UUID) (*returnBatch, error) {
+	b := &returnBatch{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT b.id, b.medicine_id, m.name, b.batch_no, b.expiry_date, b.quantity_available, b.cost_price, b.supplier_id
+		FROM inventory.batches b
+		JOIN inventory.medicines m ON m.id = b.medicine_id
+		WHERE b.id = $1 AND b.pharmacy_id = $2
+	`, batchID, pharmacyID).Scan(
+		&b.ID, &b.MedicineID, &b.MedicineName, &b.BatchNo, &b.ExpiryDate, &b.QuantityAvailable, &b.CostPrice, &b.SupplierID,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("batch %s not found", batchID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *postgresRepository) ListOutstandingPurchases(ctx context.Context, pharmacyID, supplierID uuid.UUID) ([]outstandingPurchase, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, invoice_no, purchase_date, paid_amount, due_amount
+		FROM inventory.purchases
+		WHERE pharmacy_id = $1 AND supplier_id = $2 AND due_amount > 0
+		ORDER BY purchase_date ASC, created_at ASC
+	`, pharmacyID, supplierID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outstanding purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []outstandingPurchase
+	for rows.Next() {
+		var p outstandingPurchase
+		if err := rows.Scan(&p.ID, &p.InvoiceNo, &p.PurchaseDate, &p.PaidAmount, &p.DueAmount); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases, rows.Err()
+}
@@ -0,0 +1,266 @@
+package debitnotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"organization-service/internal/pharmacy/inventory/batches"
+	"organization-service/internal/pharmacy/inventory/medicines"
+	"organization-service/internal/pharmacy/inventory/stockin"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	ListCandidates(ctx context.Context, pharmacyID, supplierID uuid.UUID, withinDays int) ([]ReturnCandidate, error)
+	Create(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreateDebitNoteRequest) (*DebitNote, error)
+	Get(ctx context.Context, pharmacyID, id uuid.UUID) (*DebitNote, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, status string, limit, offset int) ([]DebitNote, int, error)
+	// RecordCredit books credit received from the supplier; ADJUST credits are
+	// applied as payments on outstanding purchases through stock-in
+	RecordCredit(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req RecordCreditRequest) (*DebitNote, error)
+}
+
+type service struct {
+	repo       Repository
+	medRepo    medicines.Repository
+	batchRepo  batches.Repository
+	stockInSvc stockin.Service
+}
+
+func NewService(repo Repository, medRepo medicines.Repository, batchRepo batches.Repository, stockInSvc stockin.Service) Service {
+	return &service{
+		repo:       repo,
+		medRepo:    medRepo,
+		batchRepo:  batchRepo,
+		stockInSvc: stockInSvc,
+	}
+}
+
+func (s *service) ListCandidates(ctx context.Context, pharmacyID, supplierID uuid.UUID, withinDays int) ([]ReturnCandidate, error) {
+	if withinDays <= 0 {
+		withinDays = DefaultNearExpiryDays
+	}
+	return s.repo.ListCandidates(ctx, pharmacyID, supplierID, withinDays)
+}
+
+func (s *service) Create(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreateDebitNoteRequest) (*DebitNote, error) {
+	ok, err := s.medRepo.ValidateSuppliers(ctx, pharmacyID, []uuid.UUID{req.SupplierID})
+	if err != nil {
+		return nil, fmt.Errorf("error validating supplier: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid or inactive supplier for this pharmacy")
+	}
+
+	now := time.Now()
+	note := &DebitNote{
+		ID:            uuid.New(),
+		PharmacyID:    pharmacyID,
+		SupplierID:    req.SupplierID,
+		Status:        StatusIssued,
+		Reason:        req.Reason,
+		Notes:         req.Notes,
+		CreatedBy:     userID,
+		CreatedByName: userName,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	requested := make(map[uuid.UUID]int)
+	for _, reqItem := range req.Items {
+		batch, err := s.repo.GetBatch(ctx, pharmacyID, reqItem.BatchID)
+		if err != nil {
+			return nil, err
+		}
+		if batch.SupplierID == nil || *batch.SupplierID != req.SupplierID {
+			return nil, fmt.Errorf("batch %s of %s was not supplied by this supplier", batch.BatchNo, batch.MedicineName)
+		}
+		requested[batch.ID] += reqItem.Quantity
+		if requested[batch.ID] > batch.QuantityAvailable {
+			return nil, fmt.Errorf("cannot return %d of batch %s (%s): only %d in stock",
+				requested[batch.ID], batch.BatchNo, batch.MedicineName, batch.QuantityAvailable)
+		}
+
+		reason := reqItem.ReturnReason
+		if reason == "" {
+			reason = reasonForExpiry(batch.ExpiryDate, now)
+		}
+
+		amount := money.Round2(float64(reqItem.Quantity) * batch.CostPrice)
+		note.TotalAmount = money.Round2(note.TotalAmount + amount)
+		note.Items = append(note.Items, DebitNoteItem{
+			ID:           uuid.New(),
+			DebitNoteID:  note.ID,
+			MedicineID:   batch.MedicineID,
+			MedicineName: batch.MedicineName,
+			BatchID:      batch.ID,
+			BatchNo:      batch.BatchNo,
+			ExpiryDate:   batch.ExpiryDate,
+			Quantity:     reqItem.Quantity,
+			UnitCost:     batch.CostPrice,
+			Amount:       amount,
+			ReturnReason: reason,
+			CreatedAt:    now,
+		})
+	}
+	note.PendingAmount = note.TotalAmount
+
+	err = s.repo.CreateDebitNote(ctx, note, func(tx *sql.Tx) error {
+		for _, item := range note.Items {
+			logNote := fmt.Sprintf("Returned to supplier via debit note %s (%s)", note.DebitNoteNo, item.ReturnReason)
+			if _, err := s.batchRepo.RecordMovement(ctx, tx, batches.MovementDTO{
+				PharmacyID:      pharmacyID,
+				MedicineID:      item.MedicineID,
+				BatchID:         item.BatchID,
+				QuantityChange:  -item.Quantity,
+				TransactionType: "PURCHASE_RETURN",
+				ReferenceType:   "DEBIT_NOTE",
+				ReferenceID:     &note.ID,
+				PerformedBy:     &userID,
+				Notes:           logNote,
+			}); err != nil {
+				return fmt.Errorf("batch %s: %w", item.BatchNo, err)
+			}
+			if err := s.batchRepo.CreateBatchLog(ctx, tx, batches.BatchAuditLog{
+				ID:            uuid.New(),
+				PharmacyID:    pharmacyID,
+				BatchID:       item.BatchID,
+				ActionType:    "PURCHASE_RETURN",
+				ChangedBy:     userID,
+				ChangedByName: userName,
+				Notes:         logNote,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// reasonForExpiry classifies a batch by how close it is to expiry
+func reasonForExpiry(expiry, now time.Time) ReturnReason {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, expiry.Location())
+	if expiry.Before(today) {
+		return ReasonExpired
+	}
+	if expiry.Before(today.AddDate(0, 0, DefaultNearExpiryDays)) {
+		return ReasonNearExpiry
+	}
+	return ReasonOther
+}
+
+func (s *service) Get(ctx context.Context, pharmacyID, id uuid.UUID) (*DebitNote, error) {
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) List(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, status string, limit, offset int) ([]DebitNote, int, error) {
+	return s.repo.List(ctx, pharmacyID, supplierID, status, limit, offset)
+}
+
+func (s *service) RecordCredit(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req RecordCreditRequest) (*DebitNote, error) {
+	note, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	amount := money.Round2(req.Amount)
+	if amount > note.PendingAmount+0.005 {
+		return nil, fmt.Errorf("credit of %.2f exceeds pending amount %.2f on %s", amount, note.PendingAmount, note.DebitNoteNo)
+	}
+
+	credit := &Credit{
+		ID:                   uuid.New(),
+		DebitNoteID:          note.ID,
+		PharmacyID:           pharmacyID,
+		SupplierCreditNoteNo: req.SupplierCreditNoteNo,
+		Mode:                 req.Mode,
+		Amount:               amount,
+		CreatedBy:            userID,
+		CreatedByName:        userName,
+		CreatedAt:            time.Now(),
+	}
+
+	if req.Mode == CreditAdjust {
+		allocations, err := s.planAllocations(ctx, pharmacyID, note.SupplierID, amount, req.Allocations)
+		if err != nil {
+			return nil, err
+		}
+		// Each set-off is recorded on the invoice exactly like a supplier payment
+		for i := range allocations {
+			a := &allocations[i]
+			purchase, _, err := s.stockInSvc.GetStockInDetails(ctx, pharmacyID, a.PurchaseID)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := s.stockInSvc.UpdateStockInPayment(ctx, pharmacyID, a.PurchaseID, userID, userName, stockin.UpdateStockInPaymentRequest{
+				PaidAmount: money.Round2(purchase.PaidAmount + a.Amount),
+			}); err != nil {
+				return nil, fmt.Errorf("failed to set off %.2f against invoice %s: %w", a.Amount, a.InvoiceNo, err)
+			}
+			a.ID = uuid.New()
+			a.CreditID = credit.ID
+		}
+		credit.Allocations = allocations
+	}
+
+	if err := s.repo.CreateCredit(ctx, note, credit); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+// planAllocations validates explicit allocations, or spreads the amount over
+// the supplier's oldest outstanding invoices first.
+func (s *service) planAllocations(ctx context.Context, pharmacyID, supplierID uuid.UUID, amount float64, requested []AllocationRequest) ([]Allocation, error) {
+	outstanding, err := s.repo.ListOutstandingPurchases(ctx, pharmacyID, supplierID)
+	if err != nil {
+		return nil, err
+	}
+	due := make(map[uuid.UUID]outstandingPurchase, len(outstanding))
+	for _, p := range outstanding {
+		due[p.ID] = p
+	}
+
+	var allocations []Allocation
+	remaining := amount
+	if len(requested) > 0 {
+		for _, r := range requested {
+			p, ok := due[r.PurchaseID]
+			if !ok {
+				return nil, fmt.Errorf("purchase %s is not an outstanding invoice of this supplier", r.PurchaseID)
+			}
+			if r.Amount > p.DueAmount+0.005 {
+				return nil, fmt.Errorf("allocation of %.2f exceeds amount due %.2f on invoice %s", r.Amount, p.DueAmount, p.InvoiceNo)
+			}
+			p.DueAmount = money.Round2(p.DueAmount - r.Amount)
+			due[r.PurchaseID] = p
+			allocations = append(allocations, Allocation{PurchaseID: p.ID, InvoiceNo: p.InvoiceNo, Amount: money.Round2(r.Amount)})
+			remaining = money.Round2(remaining - r.Amount)
+		}
+		if math.Abs(remaining) > 0.005 {
+			return nil, fmt.Errorf("allocations must add up to the credit amount %.2f", amount)
+		}
+		return allocations, nil
+	}
+
+	for _, p := range outstanding {
+		if remaining <= 0.005 {
+			break
+		}
+		part := math.Min(remaining, p.DueAmount)
+		allocations = append(allocations, Allocation{PurchaseID: p.ID, InvoiceNo: p.InvoiceNo, Amount: money.Round2(part)})
+		remaining = money.Round2(remaining - part)
+	}
+	if remaining > 0.005 {
+		return nil, fmt.Errorf("supplier has only %.2f outstanding; record the remaining %.2f as a refund", money.Round2(amount-remaining), remaining)
+	}
+	return allocations, nil
+}
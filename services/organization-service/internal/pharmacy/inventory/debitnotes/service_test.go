@@ -0,0 +1,114 @@
+package debitnotes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReasonForExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	day := func(offset int) time.Time { return time.Date(2026, 3, 10+offset, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name   string
+		expiry time.Time
+		want   ReturnReason
+	}{
+		{"expired yesterday", day(-1), ReasonExpired},
+		{"expires today", day(0), ReasonNearExpiry},
+		{"inside the near-expiry window", day(DefaultNearExpiryDays - 1), ReasonNearExpiry},
+		{"at the window's end", day(DefaultNearExpiryDays), ReasonOther},
+		{"long dated", day(365), ReasonOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reasonForExpiry(tt.expiry, now); got != tt.want {
+				t.Errorf("reasonForExpiry(%s) = %s, want %s", tt.expiry.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRepository serves the supplier's outstanding invoices, oldest first
+type fakeRepository struct {
+	Repository
+	outstanding []outstandingPurchase
+}
+
+func (f *fakeRepository) ListOutstandingPurchases(context.Context, uuid.UUID, uuid.UUID) ([]outstandingPurchase, error) {
+	return f.outstanding, nil
+}
+
+func TestPlanAllocations(t *testing.T) {
+	older := outstandingPurchase{ID: uuid.New(), InvoiceNo: "INV-1", DueAmount: 300}
+	newer := outstandingPurchase{ID: uuid.New(), InvoiceNo: "INV-2", DueAmount: 500}
+	svc := &service{repo: &fakeRepository{outstanding: []outstandingPurchase{older, newer}}}
+
+	type alloc struct {
+		invoice string
+		amount  float64
+	}
+	tests := []struct {
+		name      string
+		amount    float64
+		requested []AllocationRequest
+		want      []alloc
+		wantErr   bool
+	}{
+		{"oldest invoice first", 200, nil, []alloc{{"INV-1", 200}}, false},
+		{"spills into the next invoice", 450, nil, []alloc{{"INV-1", 300}, {"INV-2", 150}}, false},
+		{"everything outstanding", 800, nil, []alloc{{"INV-1", 300}, {"INV-2", 500}}, false},
+		{"more than is outstanding", 800.5, nil, nil, true},
+		{
+			name:      "explicit allocations",
+			amount:    250,
+			requested: []AllocationRequest{{PurchaseID: newer.ID, Amount: 200}, {PurchaseID: older.ID, Amount: 50}},
+			want:      []alloc{{"INV-2", 200}, {"INV-1", 50}},
+		},
+		{
+			name:      "explicit allocations must add up",
+			amount:    250,
+			requested: []AllocationRequest{{PurchaseID: newer.ID, Amount: 200}},
+			wantErr:   true,
+		},
+		{
+			name:      "explicit allocation above the amount due",
+			amount:    350,
+			requested: []AllocationRequest{{PurchaseID: older.ID, Amount: 350}},
+			wantErr:   true,
+		},
+		{
+			name:      "repeated invoice counts against its due amount",
+			amount:    400,
+			requested: []AllocationRequest{{PurchaseID: older.ID, Amount: 200}, {PurchaseID: older.ID, Amount: 200}},
+			wantErr:   true,
+		},
+		{
+			name:      "invoice of another supplier",
+			amount:    100,
+			requested: []AllocationRequest{{PurchaseID: uuid.New(), Amount: 100}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.planAllocations(context.Background(), uuid.New(), uuid.New(), tt.amount, tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("planAllocations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d allocations, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				if got[i].InvoiceNo != w.invoice || got[i].Amount != w.amount {
+					t.Errorf("allocation[%d] = %s %.2f, want %s %.2f", i, got[i].InvoiceNo, got[i].Amount, w.invoice, w.amount)
+				}
+			}
+		})
+	}
+}
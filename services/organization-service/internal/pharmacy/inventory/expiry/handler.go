@@ -0,0 +1,328 @@
+package expiry
+
+import (
+	"fmt"
+	"net/http"
+	"organization-service/middleware"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+}
+
+type PaginationMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+func (h *Handler) GetSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	settings, err := h.svc.GetSettings(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	settings, err := h.svc.UpdateSettings(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+// Run triggers the daily expiry pass for the caller's pharmacy immediately
+func (h *Handler) Run(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	summary, err := h.svc.Run(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, summary)
+}
+
+func (h *Handler) ListAlerts(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	page, pageSize := pagination(c)
+	alerts, total, err := h.svc.ListAlerts(c.Request.Context(), pharmacyID, c.Query("status"), page, pageSize)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondPage(c, alerts, total, page, pageSize)
+}
+
+func (h *Handler) AcknowledgeAlert(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid alert ID")
+		return
+	}
+
+	if err := h.svc.AcknowledgeAlert(c.Request.Context(), pharmacyID, id, userID, userName); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, gin.H{"message": "Alert acknowledged"})
+}
+
+func (h *Handler) ListQuarantined(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	batches, err := h.svc.ListQuarantined(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, batches)
+}
+
+func (h *Handler) ListProposals(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	page, pageSize := pagination(c)
+	proposals, total, err := h.svc.ListProposals(c.Request.Context(), pharmacyID, c.Query("status"), page, pageSize)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondPage(c, proposals, total, page, pageSize)
+}
+
+func (h *Handler) GetProposal(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid proposal ID")
+		return
+	}
+
+	proposal, err := h.svc.GetProposal(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, proposal)
+}
+
+func (h *Handler) ApproveProposal(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid proposal ID")
+		return
+	}
+
+	var req ApproveProposalRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	proposal, err := h.svc.ApproveProposal(c.Request.Context(), pharmacyID, userID, userName, id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, proposal)
+}
+
+func (h *Handler) RejectProposal(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid proposal ID")
+		return
+	}
+
+	var req RejectProposalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	proposal, err := h.svc.RejectProposal(c.Request.Context(), pharmacyID, userID, userName, id, req.Reason)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, proposal)
+}
+
+func pagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
+
+func (h *Handler) respondPage(c *gin.Context, data interface{}, total, page, pageSize int) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    data,
+		Meta: PaginationMeta{
+			Total:  total,
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		},
+	})
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
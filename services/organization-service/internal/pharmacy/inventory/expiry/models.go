@@ -0,0 +1,132 @@
+package expiry
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultAlertHorizons are the days-before-expiry at which alerts are raised
+// for pharmacies that have not configured their own
+var DefaultAlertHorizons = []int{90, 60, 30}
+
+type AlertStatus string
+
+const (
+	AlertOpen         AlertStatus = "OPEN"
+	AlertAcknowledged AlertStatus = "ACKNOWLEDGED"
+)
+
+type ProposalAction string
+
+const (
+	ActionReturnToSupplier ProposalAction = "RETURN_TO_SUPPLIER"
+	ActionWriteOff         ProposalAction = "WRITE_OFF"
+)
+
+type ProposalStatus string
+
+const (
+	ProposalDraft    ProposalStatus = "DRAFT"
+	ProposalApproved ProposalStatus = "APPROVED"
+	ProposalRejected ProposalStatus = "REJECTED"
+)
+
+type Settings struct {
+	PharmacyID     uuid.UUID `json:"pharmacy_id"`
+	AlertHorizons  []int     `json:"alert_horizons"`
+	AutoQuarantine bool      `json:"auto_quarantine"`
+	DraftProposals bool      `json:"draft_proposals"`
+	UpdatedByName  string    `json:"updated_by_name,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Alert struct {
+	ID                 uuid.UUID   `json:"id"`
+	BatchID            uuid.UUID   `json:"batch_id"`
+	MedicineID         uuid.UUID   `json:"medicine_id"`
+	MedicineName       string      `json:"medicine_name"`
+	BatchNo            string      `json:"batch_no"`
+	ExpiryDate         time.Time   `json:"expiry_date"`
+	DaysToExpiry       int         `json:"days_to_expiry"`
+	HorizonDays        int         `json:"horizon_days"`
+	Quantity           int         `json:"quantity"`
+	StockValue         float64     `json:"stock_value"`
+	Status             AlertStatus `json:"status"`
+	AcknowledgedByName string      `json:"acknowledged_by_name,omitempty"`
+	AcknowledgedAt     *time.Time  `json:"acknowledged_at,omitempty"`
+	CreatedAt          time.Time   `json:"created_at"`
+}
+
+type QuarantinedBatch struct {
+	BatchID          uuid.UUID  `json:"batch_id"`
+	MedicineID       uuid.UUID  `json:"medicine_id"`
+	MedicineName     string     `json:"medicine_name"`
+	BatchNo          string     `json:"batch_no"`
+	ExpiryDate       time.Time  `json:"expiry_date"`
+	Quantity         int        `json:"quantity"`
+	UnitCost         float64    `json:"unit_cost"`
+	StockValue       float64    `json:"stock_value"`
+	SupplierID       *uuid.UUID `json:"supplier_id,omitempty"`
+	SupplierName     string     `json:"supplier_name,omitempty"`
+	QuarantinedAt    time.Time  `json:"quarantined_at"`
+	QuarantineReason string     `json:"quarantine_reason"`
+	// ProposalNo is the open proposal that covers the batch, if any
+	ProposalNo string `json:"proposal_no,omitempty"`
+}
+
+type Proposal struct {
+	ID             uuid.UUID      `json:"id"`
+	ProposalNo     string         `json:"proposal_no"`
+	Action         ProposalAction `json:"action"`
+	SupplierID     *uuid.UUID     `json:"supplier_id,omitempty"`
+	SupplierName   string         `json:"supplier_name,omitempty"`
+	Status         ProposalStatus `json:"status"`
+	TotalValue     float64        `json:"total_value"`
+	DocumentType   string         `json:"document_type,omitempty"`
+	DocumentID     *uuid.UUID     `json:"document_id,omitempty"`
+	Notes          string         `json:"notes,omitempty"`
+	ReviewedByName string         `json:"reviewed_by_name,omitempty"`
+	ReviewedAt     *time.Time     `json:"reviewed_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Items          []ProposalItem `json:"items,omitempty"`
+}
+
+type ProposalItem struct {
+	ID           uuid.UUID `json:"id"`
+	BatchID      uuid.UUID `json:"batch_id"`
+	MedicineID   uuid.UUID `json:"medicine_id"`
+	MedicineName string    `json:"medicine_name"`
+	UnitType     string    `json:"unit_type,omitempty"`
+	BatchNo      string    `json:"batch_no"`
+	ExpiryDate   time.Time `json:"expiry_date"`
+	Quantity     int       `json:"quantity"`
+	UnitCost     float64   `json:"unit_cost"`
+}
+
+// RunSummary reports what one pass of the worker did for a pharmacy
+type RunSummary struct {
+	PharmacyID       uuid.UUID `json:"pharmacy_id"`
+	Quarantined      int       `json:"quarantined"`
+	AlertsRaised     int       `json:"alerts_raised"`
+	ProposalsDrafted int       `json:"proposals_drafted"`
+}
+
+// Request Structs
+
+type UpdateSettingsRequest struct {
+	AlertHorizons  []int `json:"alert_horizons" validate:"required,min=1,max=6,dive,gt=0,lte=365"`
+	AutoQuarantine *bool `json:"auto_quarantine"`
+	DraftProposals *bool `json:"draft_proposals"`
+}
+
+// ApproveProposalRequest may switch the action, e.g. write off stock the supplier refused to take back
+type ApproveProposalRequest struct {
+	Action ProposalAction `json:"action" validate:"omitempty,oneof=RETURN_TO_SUPPLIER WRITE_OFF"`
+	Notes  string         `json:"notes" validate:"max=500"`
+}
+
+type RejectProposalRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
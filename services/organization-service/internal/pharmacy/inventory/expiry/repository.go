@@ -0,0 +1,485 @@
+package expiry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+	// ListPharmaciesWithStock returns every pharmacy holding stock, for the worker
+	ListPharmaciesWithStock(ctx context.Context) ([]uuid.UUID, error)
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpsertSettings(ctx context.Context, s *Settings, userID uuid.UUID) error
+
+	// QuarantineExpired flags expired batches that still hold stock and returns them
+	QuarantineExpired(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID) ([]QuarantinedBatch, error)
+	ListQuarantined(ctx context.Context, pharmacyID uuid.UUID) ([]QuarantinedBatch, error)
+	// RaiseAlerts records one alert per batch for the tightest horizon it has entered
+	RaiseAlerts(ctx context.Context, pharmacyID uuid.UUID, horizons []int) (int64, error)
+	ListAlerts(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Alert, int, error)
+	AcknowledgeAlert(ctx context.Context, pharmacyID, id, userID uuid.UUID, userName string) error
+
+	// ListProposalCandidates returns quarantined batches not covered by a draft or
+	// rejected proposal; rejected stock is left for the pharmacist to handle manually
+	ListProposalCandidates(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID) ([]QuarantinedBatch, map[uuid.UUID]string, error)
+	InsertProposal(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, p *Proposal) error
+	GetProposal(ctx context.Context, pharmacyID, id uuid.UUID) (*Proposal, error)
+	ListProposals(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Proposal, int, error)
+	// ClaimProposal moves a draft to the given status; it fails when the proposal is no longer a draft
+	ClaimProposal(ctx context.Context, pharmacyID, id uuid.UUID, status ProposalStatus, userID uuid.UUID, userName, notes string) error
+	ReleaseProposal(ctx context.Context, id uuid.UUID) error
+	SetProposalDocument(ctx context.Context, id uuid.UUID, action ProposalAction, documentType string, documentID uuid.UUID) error
+	// GetBatchQuantities returns the current stock of the given batches
+	GetBatchQuantities(ctx context.Context, pharmacyID uuid.UUID, batchIDs []uuid.UUID) (map[uuid.UUID]int, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
+func (r *postgresRepository) ListPharmaciesWithStock(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT pharmacy_id FROM inventory.batches WHERE quantity_available > 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *postgresRepository) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	s := &Settings{PharmacyID: pharmacyID}
+	var horizons pq.Int64Array
+	err := r.db.QueryRowContext(ctx, `
+		SELECT alert_horizons, auto_quarantine, draft_proposals, COALESCE(updated_by_name, ''), updated_at
+		FROM inventory.expiry_settings
+		WHERE pharmacy_id = $1
+	`, pharmacyID).Scan(&horizons, &s.AutoQuarantine, &s.DraftProposals, &s.UpdatedByName, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		s.AlertHorizons = append([]int(nil), DefaultAlertHorizons...)
+		s.AutoQuarantine = true
+		s.DraftProposals = true
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range horizons {
+		s.AlertHorizons = append(s.AlertHorizons, int(h))
+	}
+	return s, nil
+}
+
+func (r *postgresRepository) UpsertSettings(ctx context.Context, s *Settings, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO inventory.expiry_settings (pharmacy_id, alert_horizons, auto_quarantine, draft_proposals, updated_by, updated_by_name, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (pharmacy_id) DO UPDATE SET
+			alert_horizons = EXCLUDED.alert_horizons,
+			auto_quarantine = EXCLUDED.auto_quarantine,
+			draft_proposals = EXCLUDED.draft_proposals,
+			updated_by = EXCLUDED.updated_by,
+			updated_by_name = EXCLUDED.updated_by_name,
+			updated_at = EXCLUDED.updated_at
+	`, s.PharmacyID, pq.Array(s.AlertHorizons), s.AutoQuarantine, s.DraftProposals, userID, s.UpdatedByName, s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save expiry settings: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) QuarantineExpired(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID) ([]QuarantinedBatch, error) {
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE inventory.batches b
+		SET quarantined_at = CURRENT_TIMESTAMP, quarantine_reason = 'EXPIRED', updated_at = CURRENT_TIMESTAMP
+		FROM inventory.medicines m
+		WHERE m.id = b.medicine_id
+		  AND b.pharmacy_id = $1
+		  AND b.quantity_available > 0
+		  AND b.quarantined_at IS NULL
+		  AND b.expiry_date < timezone('Asia/Kolkata', now())::date
+		RETURNING b.id, b.medicine_id, m.name, b.batch_no, b.expiry_date, b.quantity_available, COALESCE(b.cost_price, 0), b.quarantined_at
+	`, pharmacyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quarantine expired batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []QuarantinedBatch
+	for rows.Next() {
+		var b QuarantinedBatch
+		if err := rows.Scan(&b.BatchID, &b.MedicineID, &b.MedicineName, &b.BatchNo, &b.ExpiryDate, &b.Quantity, &b.UnitCost, &b.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		b.QuarantineReason = "EXPIRED"
+		b.StockValue = money.Round2(float64(b.Quantity) * b.UnitCost)
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+const selectQuarantined = `
+	SELECT b.id, b.medicine_id, m.name, COALESCE(m.unit_type, ''), b.batch_no, b.expiry_date, b.quantity_available,
+	       COALESCE(b.cost_price, 0), b.supplier_id, COALESCE(s.name, ''), b.quarantined_at, COALESCE(b.quarantine_reason, ''),
+	       COALESCE((
+	           SELECT p.proposal_no
+	           FROM inventory.expiry_proposal_items pi
+	           JOIN inventory.expiry_proposals p ON p.id = pi.proposal_id AND p.status = 'DRAFT'
+	           WHERE pi.batch_id = b.id
+	           LIMIT 1
+	       ), '')
+	FROM inventory.batches b
+	JOIN inventory.medicines m ON m.id = b.medicine_id
+	LEFT JOIN supplier_schema.suppliers s ON s.id = b.supplier_id
+	WHERE b.pharmacy_id = $1 AND b.quarantined_at IS NOT NULL AND b.quantity_available > 0
+`
+
+func scanQuarantined(rows *sql.Rows) ([]QuarantinedBatch, map[uuid.UUID]string, error) {
+	batches := []QuarantinedBatch{}
+	unitTypes := make(map[uuid.UUID]string)
+	for rows.Next() {
+		var b QuarantinedBatch
+		var unitType string
+		var supplierID uuid.NullUUID
+		if err := rows.Scan(
+			&b.BatchID, &b.MedicineID, &b.MedicineName, &unitType, &b.BatchNo, &b.ExpiryDate, &b.Quantity,
+			&b.UnitCost, &supplierID, &b.SupplierName, &b.QuarantinedAt, &b.QuarantineReason, &b.ProposalNo,
+		); err != nil {
+			return nil, nil, err
+		}
+		if supplierID.Valid {
+			b.SupplierID = &supplierID.UUID
+		}
+		b.StockValue = money.Round2(float64(b.Quantity) * b.UnitCost)
+		unitTypes[b.BatchID] = unitType
+		batches = append(batches, b)
+	}
+	return batches, unitTypes, rows.Err()
+}
+
+func (r *postgresRepository) ListQuarantined(ctx context.Context, pharmacyID uuid.UUID) ([]QuarantinedBatch, error) {
+	rows, err := r.db.QueryContext(ctx, selectQuarantined+" ORDER BY b.expiry_date, m.name", pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches, _, err := scanQuarantined(rows)
+	return batches, err
+}
+
+func (r *postgresRepository) ListProposalCandidates(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID) ([]QuarantinedBatch, map[uuid.UUID]string, error) {
+	// A manual run and the worker drafting at once would both propose the same batches
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "expiry_proposals:"+pharmacyID.String()); err != nil {
+		return nil, nil, err
+	}
+	rows, err := tx.QueryContext(ctx, selectQuarantined+`
+		AND NOT EXISTS (
+			SELECT 1 FROM inventory.expiry_proposal_items pi
+			JOIN inventory.expiry_proposals p ON p.id = pi.proposal_id AND p.status IN ('DRAFT', 'REJECTED')
+			WHERE pi.batch_id = b.id
+		)
+		ORDER BY b.supplier_id NULLS LAST, m.name, b.expiry_date
+	`, pharmacyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	return scanQuarantined(rows)
+}
+
+func (r *postgresRepository) RaiseAlerts(ctx context.Context, pharmacyID uuid.UUID, horizons []int) (int64, error) {
+	// A batch 20 days from expiry with horizons {90,60,30} gets the 30-day alert only;
+	// the unique (batch, horizon) key keeps reruns from repeating it
+	res, err := r.db.ExecContext(ctx, `
+		WITH today AS (SELECT timezone('Asia/Kolkata', now())::date AS d),
+		candidates AS (
+			SELECT b.id, b.pharmacy_id, b.medicine_id, m.name, b.batch_no, b.expiry_date, b.quantity_available,
+			       ROUND(b.quantity_available * COALESCE(b.cost_price, 0), 2) AS stock_value,
+			       (SELECT MIN(h) FROM unnest($2::int[]) h WHERE h >= b.expiry_date - today.d) AS horizon
+			FROM inventory.batches b
+			JOIN inventory.medicines m ON m.id = b.medicine_id
+			CROSS JOIN today
+			WHERE b.pharmacy_id = $1
+			  AND b.quantity_available > 0
+			  AND b.expiry_date >= today.d
+		)
+		INSERT INTO inventory.expiry_alerts (
+			id, pharmacy_id, batch_id, medicine_id, medicine_name, batch_no, expiry_date, horizon_days, quantity, stock_value
+		)
+		SELECT gen_random_uuid(), pharmacy_id, id, medicine_id, name, batch_no, expiry_date, horizon, quantity_available, stock_value
+		FROM candidates
+		WHERE horizon IS NOT NULL
+		ON CONFLICT (batch_id, horizon_days) DO NOTHING
+	`, pharmacyID, pq.Array(horizons))
+	if err != nil {
+		return 0, fmt.Errorf("failed to raise expiry alerts: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (r *postgresRepository) ListAlerts(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Alert, int, error) {
+	where := " WHERE a.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND a.status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.expiry_alerts a"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.batch_id, a.medicine_id, a.medicine_name, a.batch_no, a.expiry_date,
+		       a.expiry_date - timezone('Asia/Kolkata', now())::date,
+		       a.horizon_days, a.quantity, a.stock_value, a.status,
+		       COALESCE(a.acknowledged_by_name, ''), a.acknowledged_at, a.created_at
+		FROM inventory.expiry_alerts a`+where+fmt.Sprintf(`
+		ORDER BY a.expiry_date, a.medicine_name
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var a Alert
+		var ackAt sql.NullTime
+		if err := rows.Scan(
+			&a.ID, &a.BatchID, &a.MedicineID, &a.MedicineName, &a.BatchNo, &a.ExpiryDate,
+			&a.DaysToExpiry, &a.HorizonDays, &a.Quantity, &a.StockValue, &a.Status,
+			&a.AcknowledgedByName, &ackAt, &a.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		if ackAt.Valid {
+			a.AcknowledgedAt = &ackAt.Time
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, total, rows.Err()
+}
+
+func (r *postgresRepository) AcknowledgeAlert(ctx context.Context, pharmacyID, id, userID uuid.UUID, userName string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.expiry_alerts
+		SET status = 'ACKNOWLEDGED', acknowledged_by = $1, acknowledged_by_name = $2, acknowledged_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND pharmacy_id = $4 AND status = 'OPEN'
+	`, userID, userName, id, pharmacyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("alert not found or already acknowledged")
+	}
+	return nil
+}
+
+func (r *postgresRepository) InsertProposal(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, p *Proposal) error {
+	// Proposal numbers come from the pharmacy's expiry proposal series: EXP/26-27/00001
+	proposalNo, err := numbering.Next(ctx, tx, pharmacyID, numbering.DocExpiryProposal, p.CreatedAt)
+	if err != nil {
+		return err
+	}
+	p.ProposalNo = proposalNo
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.expiry_proposals (
+			id, pharmacy_id, proposal_no, action, supplier_id, status, total_value, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, p.ID, pharmacyID, p.ProposalNo, p.Action, p.SupplierID, p.Status, p.TotalValue, p.CreatedAt, p.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert expiry proposal: %w", err)
+	}
+
+	for _, item := range p.Items {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO inventory.expiry_proposal_items (
+				id, proposal_id, batch_id, medicine_id, medicine_name, unit_type, batch_no, expiry_date, quantity, unit_cost
+			) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10)
+		`, item.ID, p.ID, item.BatchID, item.MedicineID, item.MedicineName, item.UnitType, item.BatchNo,
+			item.ExpiryDate, item.Quantity, item.UnitCost); err != nil {
+			return fmt.Errorf("failed to insert proposal item (%s): %w", item.BatchNo, err)
+		}
+	}
+	return nil
+}
+
+const selectProposal = `
+	SELECT p.id, p.proposal_no, p.action, p.supplier_id, COALESCE(s.name, ''), p.status, p.total_value,
+	       COALESCE(p.document_type, ''), p.document_id, COALESCE(p.notes, ''),
+	       COALESCE(p.reviewed_by_name, ''), p.reviewed_at, p.created_at, p.updated_at
+	FROM inventory.expiry_proposals p
+	LEFT JOIN supplier_schema.suppliers s ON s.id = p.supplier_id
+`
+
+func scanProposal(row interface{ Scan(...interface{}) error }) (*Proposal, error) {
+	var p Proposal
+	var supplierID, documentID uuid.NullUUID
+	var reviewedAt sql.NullTime
+	if err := row.Scan(
+		&p.ID, &p.ProposalNo, &p.Action, &supplierID, &p.SupplierName, &p.Status, &p.TotalValue,
+		&p.DocumentType, &documentID, &p.Notes,
+		&p.ReviewedByName, &reviewedAt, &p.CreatedAt, &p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if supplierID.Valid {
+		p.SupplierID = &supplierID.UUID
+	}
+	if documentID.Valid {
+		p.DocumentID = &documentID.UUID
+	}
+	if reviewedAt.Valid {
+		p.ReviewedAt = &reviewedAt.Time
+	}
+	return &p, nil
+}
+
+func (r *postgresRepository) GetProposal(ctx context.Context, pharmacyID, id uuid.UUID) (*Proposal, error) {
+	p, err := scanProposal(r.db.QueryRowContext(ctx, selectProposal+" WHERE p.id = $1 AND p.pharmacy_id = $2", id, pharmacyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("expiry proposal not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, batch_id, medicine_id, medicine_name, COALESCE(unit_type, ''), batch_no, expiry_date, quantity, unit_cost
+		FROM inventory.expiry_proposal_items
+		WHERE proposal_id = $1
+		ORDER BY medicine_name, expiry_date
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i ProposalItem
+		if err := rows.Scan(&i.ID, &i.BatchID, &i.MedicineID, &i.MedicineName, &i.UnitType, &i.BatchNo, &i.ExpiryDate, &i.Quantity, &i.UnitCost); err != nil {
+			return nil, err
+		}
+		p.Items = append(p.Items, i)
+	}
+	return p, rows.Err()
+}
+
+func (r *postgresRepository) ListProposals(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Proposal, int, error) {
+	where := " WHERE p.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND p.status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.expiry_proposals p"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, selectProposal+where+fmt.Sprintf(" ORDER BY p.created_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	proposals := []Proposal{}
+	for rows.Next() {
+		p, err := scanProposal(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		proposals = append(proposals, *p)
+	}
+	return proposals, total, rows.Err()
+}
+
+func (r *postgresRepository) ClaimProposal(ctx context.Context, pharmacyID, id uuid.UUID, status ProposalStatus, userID uuid.UUID, userName, notes string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.expiry_proposals
+		SET status = $1, reviewed_by = $2, reviewed_by_name = $3, reviewed_at = $4, notes = NULLIF($5, ''), updated_at = $4
+		WHERE id = $6 AND pharmacy_id = $7 AND status = 'DRAFT'
+	`, status, userID, userName, time.Now(), notes, id, pharmacyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("proposal not found or already reviewed")
+	}
+	return nil
+}
+
+func (r *postgresRepository) ReleaseProposal(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.expiry_proposals
+		SET status = 'DRAFT', reviewed_by = NULL, reviewed_by_name = NULL, reviewed_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+func (r *postgresRepository) SetProposalDocument(ctx context.Context, id uuid.UUID, action ProposalAction, documentType string, documentID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.expiry_proposals
+		SET action = $1, document_type = $2, document_id = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, action, documentType, documentID, id)
+	return err
+}
+
+func (r *postgresRepository) GetBatchQuantities(ctx context.Context, pharmacyID uuid.UUID, batchIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	ids := make([]string, len(batchIDs))
+	for i, id := range batchIDs {
+		ids[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, quantity_available FROM inventory.batches WHERE pharmacy_id = $1 AND id = ANY($2::uuid[])
+	`, pharmacyID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var id uuid.UUID
+		var qty int
+		if err := rows.Scan(&id, &qty); err != nil {
+			return nil, err
+		}
+		quantities[id] = qty
+	}
+	return quantities, rows.Err()
+}
@@ -0,0 +1,375 @@
+package expiry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"organization-service/internal/pharmacy/inventory/batches"
+	"organization-service/internal/pharmacy/inventory/debitnotes"
+	"organization-service/internal/pharmacy/inventory/stockouts"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+	"shared-scheduler"
+)
+
+type Service interface {
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error)
+	// Run quarantines, alerts and drafts proposals for one pharmacy
+	Run(ctx context.Context, pharmacyID uuid.UUID) (*RunSummary, error)
+	ListAlerts(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Alert, int, error)
+	AcknowledgeAlert(ctx context.Context, pharmacyID, id, userID uuid.UUID, userName string) error
+	ListQuarantined(ctx context.Context, pharmacyID uuid.UUID) ([]QuarantinedBatch, error)
+	ListProposals(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Proposal, int, error)
+	GetProposal(ctx context.Context, pharmacyID, id uuid.UUID) (*Proposal, error)
+	// ApproveProposal issues a debit note (supplier return) or an EXPIRED stock-out (write-off)
+	ApproveProposal(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ApproveProposalRequest) (*Proposal, error)
+	RejectProposal(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, reason string) (*Proposal, error)
+	RegisterJobs(jobs *scheduler.Scheduler) // Daily quarantine, alert and proposal run
+}
+
+type service struct {
+	repo         Repository
+	batchRepo    batches.Repository
+	debitNoteSvc debitnotes.Service
+	stockOutSvc  stockouts.Service
+}
+
+func NewService(repo Repository, batchRepo batches.Repository, debitNoteSvc debitnotes.Service, stockOutSvc stockouts.Service) Service {
+	return &service{
+		repo:         repo,
+		batchRepo:    batchRepo,
+		debitNoteSvc: debitNoteSvc,
+		stockOutSvc:  stockOutSvc,
+	}
+}
+
+func (s *service) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	return s.repo.GetSettings(ctx, pharmacyID)
+}
+
+func (s *service) UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep horizons unique and widest first
+	seen := make(map[int]bool)
+	settings.AlertHorizons = settings.AlertHorizons[:0]
+	for _, h := range req.AlertHorizons {
+		if !seen[h] {
+			seen[h] = true
+			settings.AlertHorizons = append(settings.AlertHorizons, h)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(settings.AlertHorizons)))
+
+	if req.AutoQuarantine != nil {
+		settings.AutoQuarantine = *req.AutoQuarantine
+	}
+	if req.DraftProposals != nil {
+		settings.DraftProposals = *req.DraftProposals
+	}
+	settings.UpdatedByName = userName
+	settings.UpdatedAt = time.Now()
+
+	if err := s.repo.UpsertSettings(ctx, settings, userID); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// RegisterJobs schedules the expiry run for every pharmacy shortly after
+// midnight; the scheduler fires it on one replica at a time
+func (s *service) RegisterJobs(jobs *scheduler.Scheduler) {
+	jobs.Register(&scheduler.Job{
+		Name:        "pharmacy-expiry",
+		Description: "Quarantine expired batches, raise near-expiry alerts and draft return/write-off proposals",
+		Schedule:    scheduler.MustParseSchedule("10 0 * * *"),
+		Timeout:     30 * time.Minute,
+		Run:         s.runAll,
+	})
+}
+
+// runAll runs every pharmacy with stock; one pharmacy failing does not stop the rest
+func (s *service) runAll(ctx context.Context, _ *sql.DB) (int64, error) {
+	pharmacyIDs, err := s.repo.ListPharmaciesWithStock(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for _, pharmacyID := range pharmacyIDs {
+		summary, err := s.Run(ctx, pharmacyID)
+		if err != nil {
+			fmt.Printf("[Expiry-Worker] Pharmacy %s: %v\n", pharmacyID, err)
+			continue
+		}
+		if summary.Quarantined > 0 || summary.AlertsRaised > 0 || summary.ProposalsDrafted > 0 {
+			fmt.Printf("[Expiry-Worker] Pharmacy %s: quarantined %d batches, raised %d alerts, drafted %d proposals\n",
+				pharmacyID, summary.Quarantined, summary.AlertsRaised, summary.ProposalsDrafted)
+		}
+		affected += int64(summary.Quarantined + summary.AlertsRaised + summary.ProposalsDrafted)
+	}
+	return affected, nil
+}
+
+func (s *service) Run(ctx context.Context, pharmacyID uuid.UUID) (*RunSummary, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	summary := &RunSummary{PharmacyID: pharmacyID}
+
+	if settings.AutoQuarantine {
+		if summary.Quarantined, err = s.quarantine(ctx, pharmacyID); err != nil {
+			return nil, err
+		}
+	}
+
+	raised, err := s.repo.RaiseAlerts(ctx, pharmacyID, settings.AlertHorizons)
+	if err != nil {
+		return nil, err
+	}
+	summary.AlertsRaised = int(raised)
+
+	if settings.DraftProposals {
+		if summary.ProposalsDrafted, err = s.draftProposals(ctx, pharmacyID); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+func (s *service) quarantine(ctx context.Context, pharmacyID uuid.UUID) (int, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	quarantined, err := s.repo.QuarantineExpired(ctx, tx, pharmacyID)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range quarantined {
+		if err := s.batchRepo.CreateBatchLog(ctx, tx, batches.BatchAuditLog{
+			ID:            uuid.New(),
+			PharmacyID:    pharmacyID,
+			BatchID:       b.BatchID,
+			ActionType:    "QUARANTINE",
+			ChangedByName: "System",
+			Notes:         fmt.Sprintf("Quarantined: expired on %s with %d in stock", b.ExpiryDate.Format("2006-01-02"), b.Quantity),
+			ChangedAt:     time.Now(),
+		}); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(quarantined), nil
+}
+
+// draftProposals groups quarantined stock not yet proposed into one return per
+// supplier, and a single write-off for batches with no known supplier
+func (s *service) draftProposals(ctx context.Context, pharmacyID uuid.UUID) (int, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	candidates, unitTypes, err := s.repo.ListProposalCandidates(ctx, tx, pharmacyID)
+	if err != nil {
+		return 0, err
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	bySupplier := make(map[uuid.UUID]*Proposal)
+	var order []*Proposal
+	for _, c := range candidates {
+		key := uuid.Nil
+		if c.SupplierID != nil {
+			key = *c.SupplierID
+		}
+		p, ok := bySupplier[key]
+		if !ok {
+			p = &Proposal{
+				ID:         uuid.New(),
+				Action:     ActionWriteOff,
+				SupplierID: c.SupplierID,
+				Status:     ProposalDraft,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			if c.SupplierID != nil {
+				p.Action = ActionReturnToSupplier
+			}
+			bySupplier[key] = p
+			order = append(order, p)
+		}
+		p.Items = append(p.Items, ProposalItem{
+			ID:           uuid.New(),
+			BatchID:      c.BatchID,
+			MedicineID:   c.MedicineID,
+			MedicineName: c.MedicineName,
+			UnitType:     unitTypes[c.BatchID],
+			BatchNo:      c.BatchNo,
+			ExpiryDate:   c.ExpiryDate,
+			Quantity:     c.Quantity,
+			UnitCost:     c.UnitCost,
+		})
+		p.TotalValue = money.Round2(p.TotalValue + float64(c.Quantity)*c.UnitCost)
+	}
+
+	for _, p := range order {
+		if err := s.repo.InsertProposal(ctx, tx, pharmacyID, p); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(order), nil
+}
+
+func (s *service) ListAlerts(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Alert, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	return s.repo.ListAlerts(ctx, pharmacyID, status, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) AcknowledgeAlert(ctx context.Context, pharmacyID, id, userID uuid.UUID, userName string) error {
+	return s.repo.AcknowledgeAlert(ctx, pharmacyID, id, userID, userName)
+}
+
+func (s *service) ListQuarantined(ctx context.Context, pharmacyID uuid.UUID) ([]QuarantinedBatch, error) {
+	return s.repo.ListQuarantined(ctx, pharmacyID)
+}
+
+func (s *service) ListProposals(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Proposal, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	return s.repo.ListProposals(ctx, pharmacyID, status, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) GetProposal(ctx context.Context, pharmacyID, id uuid.UUID) (*Proposal, error) {
+	return s.repo.GetProposal(ctx, pharmacyID, id)
+}
+
+func (s *service) ApproveProposal(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ApproveProposalRequest) (*Proposal, error) {
+	p, err := s.repo.GetProposal(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != ProposalDraft {
+		return nil, fmt.Errorf("proposal is already %s", p.Status)
+	}
+
+	action := p.Action
+	if req.Action != "" {
+		action = req.Action
+	}
+	if action == ActionReturnToSupplier && p.SupplierID == nil {
+		return nil, fmt.Errorf("no supplier is known for this stock; approve it as a write-off")
+	}
+
+	// Stock may have moved since the proposal was drafted; take what is left
+	batchIDs := make([]uuid.UUID, len(p.Items))
+	for i, item := range p.Items {
+		batchIDs[i] = item.BatchID
+	}
+	quantities, err := s.repo.GetBatchQuantities(ctx, pharmacyID, batchIDs)
+	if err != nil {
+		return nil, err
+	}
+	var items []ProposalItem
+	for _, item := range p.Items {
+		if q := quantities[item.BatchID]; q < item.Quantity {
+			item.Quantity = q
+		}
+		if item.Quantity > 0 {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("none of the proposed batches have stock left; reject the proposal instead")
+	}
+
+	// Claim the draft first so a second approval cannot issue a second document
+	if err := s.repo.ClaimProposal(ctx, pharmacyID, id, ProposalApproved, userID, userName, req.Notes); err != nil {
+		return nil, err
+	}
+
+	documentType, documentID, err := s.issueDocument(ctx, pharmacyID, userID, userName, p, action, items)
+	if err != nil {
+		_ = s.repo.ReleaseProposal(ctx, id)
+		return nil, err
+	}
+	if err := s.repo.SetProposalDocument(ctx, id, action, documentType, documentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetProposal(ctx, pharmacyID, id)
+}
+
+func (s *service) issueDocument(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, p *Proposal, action ProposalAction, items []ProposalItem) (string, uuid.UUID, error) {
+	if action == ActionReturnToSupplier {
+		req := debitnotes.CreateDebitNoteRequest{
+			SupplierID: *p.SupplierID,
+			Reason:     "Expired stock",
+			Notes:      fmt.Sprintf("Raised from expiry proposal %s", p.ProposalNo),
+		}
+		for _, item := range items {
+			req.Items = append(req.Items, debitnotes.CreateDebitNoteItem{
+				BatchID:      item.BatchID,
+				Quantity:     item.Quantity,
+				ReturnReason: debitnotes.ReasonExpired,
+			})
+		}
+		note, err := s.debitNoteSvc.Create(ctx, pharmacyID, userID, userName, req)
+		if err != nil {
+			return "", uuid.Nil, fmt.Errorf("failed to issue debit note: %w", err)
+		}
+		return "DEBIT_NOTE", note.ID, nil
+	}
+
+	req := stockouts.CreateStockOutRequest{
+		Type:            stockouts.TypeExpired,
+		Reason:          fmt.Sprintf("Expired stock write-off (%s)", p.ProposalNo),
+		DestinationType: "DISPOSAL",
+		DestinationName: "Expired stock write-off",
+	}
+	for _, item := range items {
+		req.Items = append(req.Items, stockouts.CreateStockOutItem{
+			BatchID:    item.BatchID,
+			MedicineID: item.MedicineID,
+			Quantity:   item.Quantity,
+			ExpiryDate: item.ExpiryDate,
+			UnitType:   item.UnitType,
+		})
+	}
+	stockOut, err := s.stockOutSvc.CreateStockOut(ctx, pharmacyID, userID, userName, req)
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("failed to write off stock: %w", err)
+	}
+	return "STOCK_OUT", stockOut.ID, nil
+}
+
+func (s *service) RejectProposal(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, reason string) (*Proposal, error) {
+	if err := s.repo.ClaimProposal(ctx, pharmacyID, id, ProposalRejected, userID, userName, reason); err != nil {
+		return nil, err
+	}
+	return s.repo.GetProposal(ctx, pharmacyID, id)
+}
@@ -0,0 +1,237 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"organization-service/internal/pharmacy/inventory/debitnotes"
+	"organization-service/internal/pharmacy/inventory/stockouts"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepository keeps settings and one proposal in memory
+type fakeRepository struct {
+	Repository
+	settings   *Settings
+	proposal   *Proposal
+	quantities map[uuid.UUID]int
+	claimed    bool
+	released   bool
+	document   string
+}
+
+func (f *fakeRepository) GetSettings(context.Context, uuid.UUID) (*Settings, error) {
+	return f.settings, nil
+}
+
+func (f *fakeRepository) UpsertSettings(_ context.Context, s *Settings, _ uuid.UUID) error {
+	f.settings = s
+	return nil
+}
+
+func (f *fakeRepository) GetProposal(context.Context, uuid.UUID, uuid.UUID) (*Proposal, error) {
+	return f.proposal, nil
+}
+
+func (f *fakeRepository) GetBatchQuantities(context.Context, uuid.UUID, []uuid.UUID) (map[uuid.UUID]int, error) {
+	return f.quantities, nil
+}
+
+func (f *fakeRepository) ClaimProposal(context.Context, uuid.UUID, uuid.UUID, ProposalStatus, uuid.UUID, string, string) error {
+	f.claimed = true
+	return nil
+}
+
+func (f *fakeRepository) ReleaseProposal(context.Context, uuid.UUID) error {
+	f.released = true
+	return nil
+}
+
+func (f *fakeRepository) SetProposalDocument(_ context.Context, _ uuid.UUID, _ ProposalAction, documentType string, _ uuid.UUID) error {
+	f.document = documentType
+	return nil
+}
+
+// fakeDebitNotes records the supplier return it was asked to raise
+type fakeDebitNotes struct {
+	debitnotes.Service
+	req debitnotes.CreateDebitNoteRequest
+	err error
+}
+
+func (f *fakeDebitNotes) Create(_ context.Context, _, _ uuid.UUID, _ string, req debitnotes.CreateDebitNoteRequest) (*debitnotes.DebitNote, error) {
+	f.req = req
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &debitnotes.DebitNote{ID: uuid.New()}, nil
+}
+
+// fakeStockOuts records the write-off it was asked to raise
+type fakeStockOuts struct {
+	stockouts.Service
+	req stockouts.CreateStockOutRequest
+}
+
+func (f *fakeStockOuts) CreateStockOut(_ context.Context, _, _ uuid.UUID, _ string, req stockouts.CreateStockOutRequest) (*stockouts.StockOut, error) {
+	f.req = req
+	return &stockouts.StockOut{ID: uuid.New()}, nil
+}
+
+func TestUpdateSettingsHorizons(t *testing.T) {
+	tests := []struct {
+		name     string
+		horizons []int
+		want     []int
+	}{
+		{"sorted widest first", []int{30, 90, 60}, []int{90, 60, 30}},
+		{"duplicates dropped", []int{30, 30, 7, 30}, []int{30, 7}},
+		{"single horizon", []int{45}, []int{45}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{settings: &Settings{AlertHorizons: []int{90, 60, 30}, AutoQuarantine: true}}
+			svc := &service{repo: repo}
+			got, err := svc.UpdateSettings(context.Background(), uuid.New(), uuid.New(), "Asha", UpdateSettingsRequest{AlertHorizons: tt.horizons})
+			if err != nil {
+				t.Fatalf("UpdateSettings() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.AlertHorizons, tt.want) {
+				t.Errorf("AlertHorizons = %v, want %v", got.AlertHorizons, tt.want)
+			}
+			if !got.AutoQuarantine {
+				t.Errorf("AutoQuarantine was reset without being requested")
+			}
+		})
+	}
+}
+
+func TestApproveProposal(t *testing.T) {
+	supplier := uuid.New()
+	full, partial, empty := uuid.New(), uuid.New(), uuid.New()
+	proposal := func(supplierID *uuid.UUID, action ProposalAction) *Proposal {
+		return &Proposal{
+			ID:         uuid.New(),
+			ProposalNo: "EXP-0001",
+			Action:     action,
+			SupplierID: supplierID,
+			Status:     ProposalDraft,
+			Items: []ProposalItem{
+				{BatchID: full, Quantity: 10},
+				{BatchID: partial, Quantity: 10},
+				{BatchID: empty, Quantity: 5},
+			},
+		}
+	}
+	left := map[uuid.UUID]int{full: 12, partial: 4}
+
+	tests := []struct {
+		name         string
+		proposal     *Proposal
+		quantities   map[uuid.UUID]int
+		req          ApproveProposalRequest
+		issueErr     error
+		wantDocument string
+		wantQty      []int
+		wantErr      bool
+		wantClaimed  bool
+		wantReleased bool
+	}{
+		{
+			name:         "supplier return takes the stock that is left",
+			proposal:     proposal(&supplier, ActionReturnToSupplier),
+			quantities:   left,
+			wantDocument: "DEBIT_NOTE",
+			wantQty:      []int{10, 4},
+			wantClaimed:  true,
+		},
+		{
+			name:         "write-off",
+			proposal:     proposal(nil, ActionWriteOff),
+			quantities:   left,
+			wantDocument: "STOCK_OUT",
+			wantQty:      []int{10, 4},
+			wantClaimed:  true,
+		},
+		{
+			name:         "supplier stock approved as a write-off",
+			proposal:     proposal(&supplier, ActionReturnToSupplier),
+			quantities:   left,
+			req:          ApproveProposalRequest{Action: ActionWriteOff},
+			wantDocument: "STOCK_OUT",
+			wantQty:      []int{10, 4},
+			wantClaimed:  true,
+		},
+		{
+			name:       "return without a known supplier",
+			proposal:   proposal(nil, ActionWriteOff),
+			quantities: left,
+			req:        ApproveProposalRequest{Action: ActionReturnToSupplier},
+			wantErr:    true,
+		},
+		{
+			name:       "no stock left",
+			proposal:   proposal(nil, ActionWriteOff),
+			quantities: map[uuid.UUID]int{},
+			wantErr:    true,
+		},
+		{
+			name: "already approved",
+			proposal: func() *Proposal {
+				p := proposal(nil, ActionWriteOff)
+				p.Status = ProposalApproved
+				return p
+			}(),
+			quantities: left,
+			wantErr:    true,
+		},
+		{
+			name:         "failed document releases the claim",
+			proposal:     proposal(&supplier, ActionReturnToSupplier),
+			quantities:   left,
+			issueErr:     errors.New("supplier is inactive"),
+			wantErr:      true,
+			wantClaimed:  true,
+			wantReleased: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{proposal: tt.proposal, quantities: tt.quantities}
+			notes := &fakeDebitNotes{err: tt.issueErr}
+			stockOuts := &fakeStockOuts{}
+			svc := &service{repo: repo, debitNoteSvc: notes, stockOutSvc: stockOuts}
+
+			_, err := svc.ApproveProposal(context.Background(), uuid.New(), uuid.New(), "Asha", tt.proposal.ID, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApproveProposal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if repo.claimed != tt.wantClaimed || repo.released != tt.wantReleased {
+				t.Errorf("claimed/released = %v/%v, want %v/%v", repo.claimed, repo.released, tt.wantClaimed, tt.wantReleased)
+			}
+			if repo.document != tt.wantDocument {
+				t.Errorf("document = %q, want %q", repo.document, tt.wantDocument)
+			}
+
+			var got []int
+			switch tt.wantDocument {
+			case "DEBIT_NOTE":
+				for _, item := range notes.req.Items {
+					got = append(got, item.Quantity)
+				}
+			case "STOCK_OUT":
+				for _, item := range stockOuts.req.Items {
+					got = append(got, item.Quantity)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantQty) {
+				t.Errorf("issued quantities = %v, want %v", got, tt.wantQty)
+			}
+		})
+	}
+}
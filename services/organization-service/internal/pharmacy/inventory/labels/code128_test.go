@@ -0,0 +1,91 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCode128Patterns(t *testing.T) {
+	for v, p := range code128Patterns {
+		want := 11
+		if v == code128Stop {
+			want = 13
+		}
+		sum := 0
+		for _, w := range p {
+			sum += int(w - '0')
+		}
+		if sum != want {
+			t.Errorf("pattern %d (%s) spans %d modules, want %d", v, p, sum, want)
+		}
+	}
+}
+
+func TestEncodeCode128(t *testing.T) {
+	tests := []struct {
+		data         string
+		wantChecksum int
+		wantErr      bool
+	}{
+		{"A", 34, false},
+		{"AB", 102, false},
+		{"BT-000123", 28, false},
+		{"rk-a12", 4, false},
+		{"", 0, true},
+		{"tab\tstop", 0, true},
+		{"café", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			widths, err := encodeCode128(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encodeCode128(%q) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// start, one symbol per character, checksum, stop (7 elements)
+			if want := 6*(len(tt.data)+2) + 7; len(widths) != want {
+				t.Fatalf("got %d bars and spaces, want %d", len(widths), want)
+			}
+			symbol := func(at int) string {
+				var b strings.Builder
+				for _, w := range widths[at : at+6] {
+					b.WriteByte(byte('0' + w))
+				}
+				return b.String()
+			}
+			if got := symbol(0); got != code128Patterns[code128StartB] {
+				t.Errorf("start symbol = %s, want %s", got, code128Patterns[code128StartB])
+			}
+			for i, ch := range tt.data {
+				if got := symbol(6 * (i + 1)); got != code128Patterns[int(ch)-32] {
+					t.Errorf("symbol for %q = %s, want %s", ch, got, code128Patterns[int(ch)-32])
+				}
+			}
+			if got := symbol(len(widths) - 13); got != code128Patterns[tt.wantChecksum] {
+				t.Errorf("checksum symbol = %s, want value %d (%s)", got, tt.wantChecksum, code128Patterns[tt.wantChecksum])
+			}
+		})
+	}
+}
+
+func TestCode128SVG(t *testing.T) {
+	svg, err := Code128SVG("A", 50, 12)
+	if err != nil {
+		t.Fatalf("Code128SVG() error = %v", err)
+	}
+	// 3 symbols of 11 modules, the 13-module stop and a 10-module quiet zone either side
+	if !strings.Contains(svg, `width="50.0mm" height="12.0mm" viewBox="0 0 66 1"`) {
+		t.Errorf("unexpected SVG header: %s", svg)
+	}
+	// Each symbol has 3 bars; the stop pattern has 4
+	if got := strings.Count(svg, "<rect "); got != 13 {
+		t.Errorf("drew %d bars, want 13", got)
+	}
+	if !strings.Contains(svg, `<rect x="10" y="0" width="2" height="1"/>`) {
+		t.Errorf("first bar does not start after the quiet zone: %s", svg)
+	}
+}
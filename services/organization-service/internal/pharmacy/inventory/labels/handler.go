@@ -0,0 +1,171 @@
+package labels
+
+import (
+	"fmt"
+	"net/http"
+	"organization-service/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+}
+
+func (h *Handler) BatchLabels(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	var req BatchLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	out, err := h.svc.BatchLabels(c.Request.Context(), pharmacyID, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondOutput(c, out)
+}
+
+// PurchaseLabels prints labels for a received purchase; options may come as a
+// JSON body or as ?format=&symbology=&template=&copies= for one-click printing
+func (h *Handler) PurchaseLabels(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+	purchaseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "invalid purchase id")
+		return
+	}
+
+	req := PurchaseLabelsRequest{
+		Options: Options{
+			Format:    Format(c.Query("format")),
+			Symbology: Symbology(c.Query("symbology")),
+			Template:  c.Query("template"),
+		},
+		Copies: c.Query("copies"),
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	out, err := h.svc.PurchaseLabels(c.Request.Context(), pharmacyID, purchaseID, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondOutput(c, out)
+}
+
+func (h *Handler) RackLabels(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	var req RackLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	out, err := h.svc.RackLabels(c.Request.Context(), pharmacyID, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondOutput(c, out)
+}
+
+func (h *Handler) ListRacks(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	racks, err := h.svc.ListRacks(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, racks)
+}
+
+// respondOutput sends printer/sheet data as a download, or the label list for format=json
+func (h *Handler) respondOutput(c *gin.Context, out *Output) {
+	if out.Data == nil {
+		h.respondJSON(c, http.StatusOK, out.Labels)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, out.Filename))
+	c.Header("X-Label-Count", fmt.Sprintf("%d", countLabels(out.Labels)))
+	c.Data(http.StatusOK, out.ContentType, out.Data)
+}
+
+func countLabels(labels []Label) int {
+	n := 0
+	for _, l := range labels {
+		n += l.Copies
+	}
+	return n
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
@@ -0,0 +1,98 @@
+package labels
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Format string
+
+const (
+	// FormatSheet is an HTML page of labels laid out for A4 label stock
+	FormatSheet  Format = "sheet"
+	FormatZPL    Format = "zpl"
+	FormatESCPOS Format = "escpos"
+	// FormatJSON returns the label data for the client to render
+	FormatJSON Format = "json"
+)
+
+type Symbology string
+
+const (
+	Code128 Symbology = "code128"
+	QR      Symbology = "qr"
+)
+
+// Template describes a sheet of self-adhesive labels
+type Template struct {
+	Name     string  `json:"name"`
+	Columns  int     `json:"columns"`
+	Rows     int     `json:"rows"`
+	WidthMM  float64 `json:"width_mm"`
+	HeightMM float64 `json:"height_mm"`
+}
+
+var Templates = map[string]Template{
+	"a4-24": {Name: "a4-24", Columns: 3, Rows: 8, WidthMM: 70, HeightMM: 37},
+	"a4-40": {Name: "a4-40", Columns: 4, Rows: 10, WidthMM: 52.5, HeightMM: 29.7},
+	"a4-65": {Name: "a4-65", Columns: 5, Rows: 13, WidthMM: 38.1, HeightMM: 21.2},
+}
+
+const DefaultTemplate = "a4-24"
+
+// Label is one printed label; batch labels carry medicine details, rack labels only the rack
+type Label struct {
+	Code         string     `json:"code"`
+	Payload      string     `json:"payload"`
+	BatchID      *uuid.UUID `json:"batch_id,omitempty"`
+	MedicineName string     `json:"medicine_name,omitempty"`
+	BatchNo      string     `json:"batch_no,omitempty"`
+	ExpiryDate   *time.Time `json:"expiry_date,omitempty"`
+	MRP          float64    `json:"mrp,omitempty"`
+	MRPUnit      string     `json:"mrp_unit,omitempty"`
+	RackNo       string     `json:"rack_no,omitempty"`
+	Copies       int        `json:"copies"`
+}
+
+type Rack struct {
+	RackNo     string `json:"rack_no"`
+	Code       string `json:"code"`
+	BatchCount int    `json:"batch_count"`
+}
+
+// Output is rendered label data ready to be sent to a browser or printer
+type Output struct {
+	ContentType string
+	Filename    string
+	Data        []byte
+	Labels      []Label
+}
+
+// Options controls how labels are rendered
+type Options struct {
+	Format    Format    `json:"format" validate:"omitempty,oneof=sheet zpl escpos json"`
+	Symbology Symbology `json:"symbology" validate:"omitempty,oneof=code128 qr"`
+	Template  string    `json:"template" validate:"omitempty,oneof=a4-24 a4-40 a4-65"`
+}
+
+// Request Structs
+
+type BatchLabelsRequest struct {
+	Options
+	BatchIDs []uuid.UUID `json:"batch_ids" validate:"required,min=1,max=500"`
+	Copies   int         `json:"copies" validate:"omitempty,min=1,max=100"`
+}
+
+// PurchaseLabelsRequest prints labels for everything received on a purchase;
+// copies is per pack received (packs), per base unit (units) or one per line (one)
+type PurchaseLabelsRequest struct {
+	Options
+	Copies string `json:"copies" validate:"omitempty,oneof=packs units one"`
+}
+
+type RackLabelsRequest struct {
+	Options
+	RackNos []string `json:"rack_nos" validate:"required,min=1,max=200,dive,required,max=50"`
+	Copies  int      `json:"copies" validate:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,256 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+func render(labels []Label, opts Options) (*Output, error) {
+	if total := countLabels(labels); total > MaxLabels {
+		return nil, fmt.Errorf("print job of %d labels exceeds the limit of %d; print fewer copies", total, MaxLabels)
+	}
+
+	symbology := opts.Symbology
+	if symbology == "" {
+		symbology = Code128
+	}
+	stamp := time.Now().Format("20060102-1504")
+
+	switch opts.Format {
+	case FormatJSON:
+		return &Output{Labels: labels}, nil
+	case FormatZPL:
+		data, err := renderZPL(labels, symbology)
+		if err != nil {
+			return nil, err
+		}
+		return &Output{ContentType: "application/vnd.zebra.zpl", Filename: "labels-" + stamp + ".zpl", Data: data, Labels: labels}, nil
+	case FormatESCPOS:
+		data, err := renderESCPOS(labels, symbology)
+		if err != nil {
+			return nil, err
+		}
+		return &Output{ContentType: "application/octet-stream", Filename: "labels-" + stamp + ".bin", Data: data, Labels: labels}, nil
+	default:
+		// Sheets draw Code128 themselves; QR sheets are left to the client (format=json)
+		if symbology == QR {
+			return nil, fmt.Errorf("QR label sheets are rendered by the client; request format=json, zpl or escpos")
+		}
+		name := opts.Template
+		if name == "" {
+			name = DefaultTemplate
+		}
+		data, err := renderSheet(labels, Templates[name])
+		if err != nil {
+			return nil, err
+		}
+		return &Output{ContentType: "text/html; charset=utf-8", Filename: "labels-" + stamp + ".html", Data: data, Labels: labels}, nil
+	}
+}
+
+// labelLines is the human-readable text printed above the barcode
+func labelLines(l Label) []string {
+	if l.BatchID == nil {
+		return []string{"RACK " + l.RackNo}
+	}
+	lines := []string{l.MedicineName}
+	detail := "B: " + l.BatchNo
+	if l.ExpiryDate != nil {
+		detail += "  EXP: " + l.ExpiryDate.Format("01/2006")
+	}
+	lines = append(lines, detail)
+	if l.MRP > 0 {
+		mrp := fmt.Sprintf("MRP: %.2f", l.MRP)
+		if l.MRPUnit != "" {
+			mrp += "/" + strings.ToLower(l.MRPUnit)
+		}
+		if l.RackNo != "" {
+			mrp += "  R: " + l.RackNo
+		}
+		lines = append(lines, mrp)
+	}
+	return lines
+}
+
+func renderSheet(labels []Label, t Template) ([]byte, error) {
+	perPage := t.Columns * t.Rows
+	barWidth := t.WidthMM - 6
+	barHeight := t.HeightMM * 0.35
+
+	var cells []string
+	for _, l := range labels {
+		svg, err := Code128SVG(l.Code, barWidth, barHeight)
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", l.Code, err)
+		}
+		var b strings.Builder
+		b.WriteString(`<div class="label">`)
+		for i, line := range labelLines(l) {
+			class := "line"
+			if i == 0 {
+				class = "title"
+			}
+			fmt.Fprintf(&b, `<div class="%s">%s</div>`, class, html.EscapeString(line))
+		}
+		b.WriteString(svg)
+		fmt.Fprintf(&b, `<div class="code">%s</div></div>`, html.EscapeString(l.Code))
+		for i := 0; i < l.Copies; i++ {
+			cells = append(cells, b.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Labels</title>
+<style>
+@page { size: A4; margin: 0; }
+body { margin: 0; font-family: Arial, sans-serif; }
+.page { width: 210mm; height: 297mm; display: grid; grid-template-columns: repeat(%d, %.1fmm); grid-auto-rows: %.1fmm;
+        justify-content: center; align-content: center; page-break-after: always; }
+.label { box-sizing: border-box; padding: 1.5mm 3mm; overflow: hidden; text-align: center; }
+.title { font-size: 8pt; font-weight: bold; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+.line { font-size: 6.5pt; white-space: nowrap; }
+.code { font-family: monospace; font-size: 6.5pt; }
+svg { display: block; margin: 0.5mm auto 0; }
+</style></head><body>
+`, t.Columns, t.WidthMM, t.HeightMM)
+	for start := 0; start < len(cells); start += perPage {
+		end := start + perPage
+		if end > len(cells) {
+			end = len(cells)
+		}
+		buf.WriteString(`<div class="page">`)
+		for _, cell := range cells[start:end] {
+			buf.WriteString(cell)
+		}
+		buf.WriteString("</div>\n")
+	}
+	buf.WriteString("</body></html>\n")
+	return buf.Bytes(), nil
+}
+
+// renderZPL targets 50x25mm labels on 203dpi Zebra printers; the printer
+// draws the barcode itself and ^PQ repeats each label
+func renderZPL(labels []Label, symbology Symbology) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, l := range labels {
+		buf.WriteString("^XA^CI28^PW400^LL200\n")
+		y := 10
+		for i, line := range labelLines(l) {
+			size := 20
+			if i == 0 {
+				size = 24
+			}
+			fmt.Fprintf(&buf, "^FO15,%d^A0N,%d,%d^FB370,1,0,L^FD%s^FS\n", y, size, size, zplText(truncate(line, 32)))
+			y += size + 4
+		}
+		if symbology == QR {
+			fmt.Fprintf(&buf, "^FO290,%d^BQN,2,3^FDMA,%s^FS\n", y-10, zplText(l.Payload))
+			fmt.Fprintf(&buf, "^FO15,%d^A0N,20,20^FD%s^FS\n", y+10, zplText(l.Code))
+		} else {
+			fmt.Fprintf(&buf, "^FO15,%d^BY2^BCN,%d,Y,N,N^FD%s^FS\n", y, 170-y, zplText(l.Code))
+		}
+		fmt.Fprintf(&buf, "^PQ%d\n^XZ\n", l.Copies)
+	}
+	return buf.Bytes(), nil
+}
+
+// zplText strips the characters ZPL reserves for commands
+func zplText(s string) string {
+	return strings.NewReplacer("^", " ", "~", " ").Replace(s)
+}
+
+// ESC/POS command bytes
+var (
+	escInit      = []byte{0x1b, 0x40}
+	escCenter    = []byte{0x1b, 0x61, 0x01}
+	escBoldOn    = []byte{0x1b, 0x45, 0x01}
+	escBoldOff   = []byte{0x1b, 0x45, 0x00}
+	escHRIBelow  = []byte{0x1d, 0x48, 0x02}
+	escBarHeight = []byte{0x1d, 0x68, 0x50}
+	escBarWidth  = []byte{0x1d, 0x77, 0x02}
+	escFeedCut   = []byte{0x1b, 0x64, 0x03, 0x1d, 0x56, 0x42, 0x00}
+)
+
+// renderESCPOS prints each copy as its own slip on a receipt/label thermal printer
+func renderESCPOS(labels []Label, symbology Symbology) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(escInit)
+	for _, l := range labels {
+		var slip bytes.Buffer
+		slip.Write(escCenter)
+		for i, line := range labelLines(l) {
+			if i == 0 {
+				slip.Write(escBoldOn)
+			}
+			slip.WriteString(asciiText(truncate(line, 32)))
+			slip.WriteByte('\n')
+			if i == 0 {
+				slip.Write(escBoldOff)
+			}
+		}
+		if symbology == QR {
+			if err := escposQR(&slip, l.Payload); err != nil {
+				return nil, fmt.Errorf("label %s: %w", l.Code, err)
+			}
+			slip.WriteString(l.Code + "\n")
+		} else {
+			data := "{B" + l.Code
+			if len(data) > 255 {
+				return nil, fmt.Errorf("label %s is too long for Code128", l.Code)
+			}
+			slip.Write(escHRIBelow)
+			slip.Write(escBarHeight)
+			slip.Write(escBarWidth)
+			slip.Write([]byte{0x1d, 0x6b, 0x49, byte(len(data))})
+			slip.WriteString(data)
+			slip.WriteByte('\n')
+		}
+		slip.Write(escFeedCut)
+		for i := 0; i < l.Copies; i++ {
+			buf.Write(slip.Bytes())
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// escposQR emits the GS ( k sequence: model 2, module size 4, error level M, store, print
+func escposQR(buf *bytes.Buffer, payload string) error {
+	data := []byte(asciiText(payload))
+	n := len(data) + 3
+	if n > 7089 {
+		return fmt.Errorf("QR payload too long")
+	}
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00})
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x43, 0x04})
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x45, 0x31})
+	buf.Write([]byte{0x1d, 0x28, 0x6b, byte(n % 256), byte(n / 256), 0x31, 0x50, 0x30})
+	buf.Write(data)
+	buf.Write([]byte{0x1d, 0x28, 0x6b, 0x03, 0x00, 0x31, 0x51, 0x30})
+	buf.WriteByte('\n')
+	return nil
+}
+
+// asciiText keeps thermal output printable on printers without a UTF-8 code page
+func asciiText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 32 && r < 127 {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "."
+}
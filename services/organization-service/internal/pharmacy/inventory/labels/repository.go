@@ -0,0 +1,143 @@
+package labels
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	// AssignCodes gives every listed batch without one its permanent internal code
+	AssignCodes(ctx context.Context, pharmacyID uuid.UUID, batchIDs []uuid.UUID) error
+	GetBatchLabels(ctx context.Context, pharmacyID uuid.UUID, batchIDs []uuid.UUID) ([]Label, error)
+	// GetPurchaseLines returns one label per purchase line with the batch it was booked into
+	GetPurchaseLines(ctx context.Context, pharmacyID, purchaseID uuid.UUID) ([]PurchaseLine, error)
+	ListRacks(ctx context.Context, pharmacyID uuid.UUID) ([]Rack, error)
+}
+
+// PurchaseLine is a received purchase item with the quantities label copies are derived from
+type PurchaseLine struct {
+	Label
+	BatchID    uuid.UUID
+	Packs      int
+	TotalUnits int
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
+
+func (r *postgresRepository) AssignCodes(ctx context.Context, pharmacyID uuid.UUID, batchIDs []uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.batches
+		SET label_code = 'PB' || UPPER(SUBSTRING(REPLACE(id::text, '-', '') FROM 1 FOR 10))
+		WHERE pharmacy_id = $1 AND id = ANY($2) AND label_code IS NULL
+	`, pharmacyID, pq.Array(uuidStrings(batchIDs)))
+	if err != nil {
+		return fmt.Errorf("failed to assign label codes: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetBatchLabels(ctx context.Context, pharmacyID uuid.UUID, batchIDs []uuid.UUID) ([]Label, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT b.id, COALESCE(b.label_code, ''), COALESCE(m.name, ''), b.batch_no, b.expiry_date,
+		       COALESCE(b.mrp, 0), COALESCE(m.unit_type, ''), COALESCE(b.rack_no, '')
+		FROM inventory.batches b
+		LEFT JOIN inventory.medicines m ON m.id = b.medicine_id
+		WHERE b.pharmacy_id = $1 AND b.id = ANY($2)
+		ORDER BY COALESCE(b.rack_no, ''), m.name, b.expiry_date
+	`, pharmacyID, pq.Array(uuidStrings(batchIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load batch labels: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Label
+	for rows.Next() {
+		var l Label
+		var batchID uuid.UUID
+		var expiry time.Time
+		if err := rows.Scan(&batchID, &l.Code, &l.MedicineName, &l.BatchNo, &expiry, &l.MRP, &l.MRPUnit, &l.RackNo); err != nil {
+			return nil, err
+		}
+		l.BatchID = &batchID
+		l.ExpiryDate = &expiry
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) GetPurchaseLines(ctx context.Context, pharmacyID, purchaseID uuid.UUID) ([]PurchaseLine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT b.id, COALESCE(b.label_code, ''), COALESCE(m.name, ''), pi.batch_no, pi.expiry_date,
+		       pi.mrp_per_mode, pi.unit_mode, COALESCE(NULLIF(pi.rack_no, ''), b.rack_no, ''),
+		       pi.received_qty + COALESCE(pi.bonus_qty, 0), pi.total_qty_units
+		FROM inventory.purchase_items pi
+		JOIN inventory.purchases p ON p.id = pi.purchase_id
+		JOIN inventory.batches b ON b.pharmacy_id = p.pharmacy_id AND b.medicine_id = pi.medicine_id AND b.batch_no = pi.batch_no
+		LEFT JOIN inventory.medicines m ON m.id = pi.medicine_id
+		WHERE p.pharmacy_id = $1 AND p.id = $2
+		ORDER BY pi.created_at
+	`, pharmacyID, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load purchase lines: %w", err)
+	}
+	defer rows.Close()
+
+	var out []PurchaseLine
+	for rows.Next() {
+		var l PurchaseLine
+		var expiry time.Time
+		if err := rows.Scan(&l.BatchID, &l.Code, &l.MedicineName, &l.BatchNo, &expiry,
+			&l.MRP, &l.MRPUnit, &l.RackNo, &l.Packs, &l.TotalUnits); err != nil {
+			return nil, err
+		}
+		batchID := l.BatchID
+		l.Label.BatchID = &batchID
+		l.ExpiryDate = &expiry
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) ListRacks(ctx context.Context, pharmacyID uuid.UUID) ([]Rack, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rack_no, COUNT(*)
+		FROM inventory.batches
+		WHERE pharmacy_id = $1 AND COALESCE(rack_no, '') <> '' AND quantity_available > 0
+		GROUP BY rack_no
+		ORDER BY rack_no
+	`, pharmacyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list racks: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Rack
+	for rows.Next() {
+		var rk Rack
+		if err := rows.Scan(&rk.RackNo, &rk.BatchCount); err != nil {
+			return nil, err
+		}
+		rk.Code = RackCode(rk.RackNo)
+		out = append(out, rk)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,132 @@
+package labels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxLabels caps a single print job; "units" copies on a large purchase add up quickly
+const MaxLabels = 2000
+
+type Service interface {
+	BatchLabels(ctx context.Context, pharmacyID uuid.UUID, req BatchLabelsRequest) (*Output, error)
+	PurchaseLabels(ctx context.Context, pharmacyID, purchaseID uuid.UUID, req PurchaseLabelsRequest) (*Output, error)
+	RackLabels(ctx context.Context, pharmacyID uuid.UUID, req RackLabelsRequest) (*Output, error)
+	ListRacks(ctx context.Context, pharmacyID uuid.UUID) ([]Rack, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) BatchLabels(ctx context.Context, pharmacyID uuid.UUID, req BatchLabelsRequest) (*Output, error) {
+	if err := s.repo.AssignCodes(ctx, pharmacyID, req.BatchIDs); err != nil {
+		return nil, err
+	}
+	labels, err := s.repo.GetBatchLabels(ctx, pharmacyID, req.BatchIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("no batches found")
+	}
+
+	copies := req.Copies
+	if copies == 0 {
+		copies = 1
+	}
+	for i := range labels {
+		labels[i].Copies = copies
+		labels[i].Payload = batchPayload(labels[i])
+	}
+	return render(labels, req.Options)
+}
+
+func (s *service) PurchaseLabels(ctx context.Context, pharmacyID, purchaseID uuid.UUID, req PurchaseLabelsRequest) (*Output, error) {
+	lines, err := s.repo.GetPurchaseLines(ctx, pharmacyID, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("purchase %s not found or has no received items", purchaseID)
+	}
+
+	// Codes are assigned on first print, so reload the lines once every batch has one
+	var missing []uuid.UUID
+	for _, l := range lines {
+		if l.Code == "" {
+			missing = append(missing, l.BatchID)
+		}
+	}
+	if len(missing) > 0 {
+		if err := s.repo.AssignCodes(ctx, pharmacyID, missing); err != nil {
+			return nil, err
+		}
+		if lines, err = s.repo.GetPurchaseLines(ctx, pharmacyID, purchaseID); err != nil {
+			return nil, err
+		}
+	}
+
+	labels := make([]Label, 0, len(lines))
+	for _, l := range lines {
+		label := l.Label
+		switch req.Copies {
+		case "units":
+			label.Copies = l.TotalUnits
+		case "one":
+			label.Copies = 1
+		default:
+			label.Copies = l.Packs
+		}
+		if label.Copies < 1 {
+			label.Copies = 1
+		}
+		label.Payload = batchPayload(label)
+		labels = append(labels, label)
+	}
+	return render(labels, req.Options)
+}
+
+func (s *service) RackLabels(ctx context.Context, pharmacyID uuid.UUID, req RackLabelsRequest) (*Output, error) {
+	copies := req.Copies
+	if copies == 0 {
+		copies = 1
+	}
+	labels := make([]Label, 0, len(req.RackNos))
+	for _, rackNo := range req.RackNos {
+		rackNo = strings.TrimSpace(rackNo)
+		code := RackCode(rackNo)
+		labels = append(labels, Label{Code: code, Payload: code, RackNo: rackNo, Copies: copies})
+	}
+	return render(labels, req.Options)
+}
+
+func (s *service) ListRacks(ctx context.Context, pharmacyID uuid.UUID) ([]Rack, error) {
+	return s.repo.ListRacks(ctx, pharmacyID)
+}
+
+// RackCode is the code printed on a rack label, e.g. RK-A12
+func RackCode(rackNo string) string {
+	return "RK-" + strings.ToUpper(strings.TrimSpace(rackNo))
+}
+
+// batchPayload is what a QR label encodes: the code first so any scanner
+// resolves it, followed by human-readable details separated by '|'
+func batchPayload(l Label) string {
+	parts := []string{l.Code, clean(l.MedicineName), clean(l.BatchNo)}
+	if l.ExpiryDate != nil {
+		parts = append(parts, l.ExpiryDate.Format("2006-01"))
+	}
+	return strings.Join(parts, "|")
+}
+
+func clean(s string) string {
+	return strings.TrimSpace(strings.ReplaceAll(s, "|", "/"))
+}
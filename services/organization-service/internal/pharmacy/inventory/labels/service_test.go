@@ -0,0 +1,174 @@
+package labels
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func batchLabel(copies int) Label {
+	id := uuid.New()
+	expiry := time.Date(2027, 8, 31, 0, 0, 0, 0, time.UTC)
+	l := Label{
+		Code:         "BT-000123",
+		BatchID:      &id,
+		MedicineName: "Paracetamol 500mg",
+		BatchNo:      "PCM|2291",
+		ExpiryDate:   &expiry,
+		MRP:          32.5,
+		MRPUnit:      "Strip",
+		RackNo:       "A12",
+		Copies:       copies,
+	}
+	l.Payload = batchPayload(l)
+	return l
+}
+
+func TestBatchPayload(t *testing.T) {
+	l := batchLabel(1)
+	if want := "BT-000123|Paracetamol 500mg|PCM/2291|2027-08"; l.Payload != want {
+		t.Errorf("batchPayload() = %q, want %q", l.Payload, want)
+	}
+	l.ExpiryDate = nil
+	if want := "BT-000123|Paracetamol 500mg|PCM/2291"; batchPayload(l) != want {
+		t.Errorf("batchPayload() without expiry = %q, want %q", batchPayload(l), want)
+	}
+}
+
+func TestRackCode(t *testing.T) {
+	tests := []struct{ rack, want string }{
+		{"A12", "RK-A12"},
+		{" b3 ", "RK-B3"},
+	}
+	for _, tt := range tests {
+		if got := RackCode(tt.rack); got != tt.want {
+			t.Errorf("RackCode(%q) = %q, want %q", tt.rack, got, tt.want)
+		}
+	}
+}
+
+func TestLabelLines(t *testing.T) {
+	noMRP := batchLabel(1)
+	noMRP.MRP = 0
+
+	tests := []struct {
+		name  string
+		label Label
+		want  []string
+	}{
+		{"batch", batchLabel(1), []string{"Paracetamol 500mg", "B: PCM|2291  EXP: 08/2027", "MRP: 32.50/strip  R: A12"}},
+		{"batch without MRP", noMRP, []string{"Paracetamol 500mg", "B: PCM|2291  EXP: 08/2027"}},
+		{"rack", Label{Code: "RK-A12", RackNo: "A12"}, []string{"RACK A12"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labelLines(tt.label); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labelLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextHelpers(t *testing.T) {
+	tests := []struct {
+		name, got, want string
+	}{
+		{"short text is kept", truncate("Crocin", 10), "Crocin"},
+		{"long text is cut", truncate("Amoxicillin Clavulanate", 10), "Amoxicill."},
+		{"runes are counted, not bytes", truncate("Névralgine forte", 10), "Névralgin."},
+		{"non-ASCII is replaced", asciiText("Névralgine"), "N?vralgine"},
+		{"ZPL control characters are blanked", zplText("A^B~C"), "A B C"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      []Label
+		opts        Options
+		wantType    string
+		wantErr     bool
+		wantContain []string
+	}{
+		{
+			name:        "sheet with Code128",
+			labels:      []Label{batchLabel(2)},
+			opts:        Options{Format: FormatSheet},
+			wantType:    "text/html; charset=utf-8",
+			wantContain: []string{"<svg", "Paracetamol 500mg"},
+		},
+		{
+			name:    "QR sheets are left to the client",
+			labels:  []Label{batchLabel(1)},
+			opts:    Options{Format: FormatSheet, Symbology: QR},
+			wantErr: true,
+		},
+		{
+			name:        "ZPL repeats the label with ^PQ",
+			labels:      []Label{batchLabel(3)},
+			opts:        Options{Format: FormatZPL},
+			wantType:    "application/vnd.zebra.zpl",
+			wantContain: []string{"^BCN,", "^FDBT-000123^FS", "^PQ3"},
+		},
+		{
+			name:        "ZPL QR carries the payload",
+			labels:      []Label{batchLabel(1)},
+			opts:        Options{Format: FormatZPL, Symbology: QR},
+			wantType:    "application/vnd.zebra.zpl",
+			wantContain: []string{"^BQN,2,3^FDMA,BT-000123|Paracetamol 500mg|PCM/2291|2027-08^FS"},
+		},
+		{
+			name:        "ESC/POS prints Code128 set B",
+			labels:      []Label{batchLabel(1)},
+			opts:        Options{Format: FormatESCPOS},
+			wantType:    "application/octet-stream",
+			wantContain: []string{"\x1dkI\x0b{BBT-000123"},
+		},
+		{
+			name:    "job over the label limit",
+			labels:  []Label{batchLabel(MaxLabels), batchLabel(1)},
+			opts:    Options{Format: FormatZPL},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := render(tt.labels, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if out.ContentType != tt.wantType {
+				t.Errorf("ContentType = %q, want %q", out.ContentType, tt.wantType)
+			}
+			for _, s := range tt.wantContain {
+				if !bytes.Contains(out.Data, []byte(s)) {
+					t.Errorf("output does not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderESCPOSCopies(t *testing.T) {
+	out, err := renderESCPOS([]Label{batchLabel(3)}, Code128)
+	if err != nil {
+		t.Fatalf("renderESCPOS() error = %v", err)
+	}
+	if got := strings.Count(string(out), "{BBT-000123"); got != 3 {
+		t.Errorf("printed %d slips, want 3", got)
+	}
+}
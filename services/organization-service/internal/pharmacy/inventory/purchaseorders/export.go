@@ -0,0 +1,176 @@
+package purchaseorders
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"organization-service/utils"
+
+	"github.com/google/uuid"
+)
+
+func (s *service) loadDocument(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, *DocumentParties, error) {
+	po, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if po.Status == StatusCancelled {
+		return nil, nil, fmt.Errorf("purchase order %s is cancelled", po.PONumber)
+	}
+	parties, err := s.repo.GetDocumentParties(ctx, pharmacyID, po.SupplierID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return po, parties, nil
+}
+
+// ExportCSV renders the order as a CSV the supplier can import: a short header
+// block followed by one row per line item.
+func (s *service) ExportCSV(ctx context.Context, pharmacyID, id uuid.UUID) ([]byte, string, error) {
+	po, parties, err := s.loadDocument(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := [][]string{
+		{"PO Number", po.PONumber},
+		{"PO Date", po.CreatedAt.Format("2006-01-02")},
+		{"Expected Date", formatDate(po)},
+		{"Buyer", parties.PharmacyName},
+		{"Supplier", parties.SupplierName},
+		{"Supplier GSTIN", parties.SupplierGSTIN},
+		{},
+		{"S.No", "Medicine", "Brand", "Quantity", "Expected Unit Price", "Line Total"},
+	}
+	if err := w.WriteAll(header); err != nil {
+		return nil, "", err
+	}
+	for i, item := range po.Items {
+		if err := w.Write([]string{
+			strconv.Itoa(i + 1),
+			item.MedicineName,
+			item.MedicineBrand,
+			strconv.Itoa(item.Quantity),
+			strconv.FormatFloat(item.ExpectedUnitPrice, 'f', 2, 64),
+			strconv.FormatFloat(item.LineTotal, 'f', 2, 64),
+		}); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Write([]string{"", "", "", "", "Total", strconv.FormatFloat(po.TotalAmount, 'f', 2, 64)}); err != nil {
+		return nil, "", err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), po.PONumber + ".csv", nil
+}
+
+// ExportPDF renders a printable purchase order for sending to the supplier
+func (s *service) ExportPDF(ctx context.Context, pharmacyID, id uuid.UUID) ([]byte, string, error) {
+	po, parties, err := s.loadDocument(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	doc := utils.NewPDFDocument()
+	doc.Text(utils.FontBold, 16, parties.PharmacyName)
+	for _, line := range []string{
+		parties.PharmacyAddress,
+		joinNonEmpty("Phone: ", parties.PharmacyPhone, "  Email: ", parties.PharmacyEmail),
+		joinNonEmpty("Drug Licence: ", parties.PharmacyLicense),
+	} {
+		if line != "" {
+			doc.Text(utils.FontRegular, 9, line)
+		}
+	}
+	doc.Rule()
+
+	doc.Text(utils.FontBold, 13, "PURCHASE ORDER")
+	doc.Text(utils.FontRegular, 10, fmt.Sprintf("PO Number: %s    Date: %s    Expected: %s",
+		po.PONumber, po.CreatedAt.Format("02 Jan 2006"), formatDate(po)))
+	doc.Gap(6)
+
+	doc.Text(utils.FontBold, 10, "To: "+parties.SupplierName)
+	for _, line := range []string{
+		parties.SupplierAddress,
+		joinNonEmpty("Attn: ", parties.SupplierContact, "  Phone: ", parties.SupplierPhone),
+		joinNonEmpty("Email: ", parties.SupplierEmail),
+		joinNonEmpty("GSTIN: ", parties.SupplierGSTIN),
+	} {
+		if line != "" {
+			doc.Text(utils.FontRegular, 9, line)
+		}
+	}
+	if parties.CreditPeriodDays > 0 {
+		doc.Text(utils.FontRegular, 9, fmt.Sprintf("Payment terms: %d days credit", parties.CreditPeriodDays))
+	}
+	doc.Rule()
+
+	const row = "%-4s %-34s %9s %12s %13s"
+	doc.Text(utils.FontMono, 9, fmt.Sprintf(row, "#", "Medicine", "Qty", "Unit Price", "Amount"))
+	doc.Rule()
+	for i, item := range po.Items {
+		name := item.MedicineName
+		if item.MedicineBrand != "" && item.MedicineBrand != item.MedicineName {
+			name += " (" + item.MedicineBrand + ")"
+		}
+		doc.Text(utils.FontMono, 9, fmt.Sprintf(row,
+			strconv.Itoa(i+1), truncate(name, 34), strconv.Itoa(item.Quantity),
+			strconv.FormatFloat(item.ExpectedUnitPrice, 'f', 2, 64),
+			strconv.FormatFloat(item.LineTotal, 'f', 2, 64)))
+	}
+	doc.Rule()
+	doc.Text(utils.FontMono, 10, fmt.Sprintf("%60s %13s", "Total (Rs.)", strconv.FormatFloat(po.TotalAmount, 'f', 2, 64)))
+
+	if po.Notes != "" {
+		doc.Gap(10)
+		doc.Text(utils.FontBold, 9, "Notes")
+		doc.Text(utils.FontRegular, 9, po.Notes)
+	}
+	doc.Gap(10)
+	doc.Text(utils.FontRegular, 8, "Quantities are in base units (tablets, bottles, pieces).")
+	doc.Gap(30)
+	doc.Text(utils.FontRegular, 9, "Authorised by: "+po.CreatedByName)
+
+	return doc.Bytes(), po.PONumber + ".pdf", nil
+}
+
+func formatDate(po *PurchaseOrder) string {
+	if po.ExpectedDate == nil {
+		return "-"
+	}
+	return po.ExpectedDate.Format("02 Jan 2006")
+}
+
+// joinNonEmpty pairs labels with values and skips pairs whose value is empty
+func joinNonEmpty(parts ...string) string {
+	out := ""
+	for i := 0; i+1 < len(parts); i += 2 {
+		if parts[i+1] == "" {
+			continue
+		}
+		label := parts[i]
+		if out == "" {
+			label = strings.TrimLeft(label, " ")
+		}
+		out += label + parts[i+1]
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "~"
+}
@@ -0,0 +1,381 @@
+package purchaseorders
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"organization-service/middleware"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+}
+
+type PaginationMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req CreatePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	po, err := h.svc.Create(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, po)
+}
+
+func (h *Handler) GetByID(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	po, err := h.svc.Get(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, po)
+}
+
+func (h *Handler) List(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+
+	var supplierID *uuid.UUID
+	if s := c.Query("supplier_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid supplier ID")
+			return
+		}
+		supplierID = &id
+	}
+
+	orders, total, err := h.svc.List(c.Request.Context(), pharmacyID, c.Query("status"), supplierID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    orders,
+		Meta: PaginationMeta{
+			Total:  total,
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		},
+	})
+}
+
+func (h *Handler) Update(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	var req UpdatePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	po, err := h.svc.Update(c.Request.Context(), pharmacyID, id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, po)
+}
+
+// Send marks a draft as sent to the supplier; only sent orders can be received against
+func (h *Handler) Send(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	po, err := h.svc.Send(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, po)
+}
+
+// Receive records a goods-received note for one delivery against the order
+func (h *Handler) Receive(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	var req ReceivePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	grn, po, err := h.svc.Receive(c.Request.Context(), pharmacyID, userID, userName, id, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, gin.H{
+		"goods_received_note": grn,
+		"purchase_order":      po,
+	})
+}
+
+func (h *Handler) Cancel(c *gin.Context) {
+	h.finish(c, h.svc.Cancel)
+}
+
+func (h *Handler) Close(c *gin.Context) {
+	h.finish(c, h.svc.Close)
+}
+
+// finish handles the cancel/close endpoints, which share an optional reason body
+func (h *Handler) finish(c *gin.Context, action func(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*PurchaseOrder, error)) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	var req ClosePurchaseOrderRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if err := h.validate.Struct(req); err != nil {
+			h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+			return
+		}
+	}
+
+	po, err := action(c.Request.Context(), pharmacyID, id, req.Reason)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, po)
+}
+
+func (h *Handler) ListGRNs(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	grns, err := h.svc.ListGRNs(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, grns)
+}
+
+func (h *Handler) GetVariance(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	report, err := h.svc.GetVariance(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, report)
+}
+
+// Export downloads the order document; ?format=pdf (default) or csv
+func (h *Handler) Export(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	var (
+		data        []byte
+		filename    string
+		contentType string
+	)
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		data, filename, err = h.svc.ExportPDF(c.Request.Context(), pharmacyID, id)
+		contentType = "application/pdf"
+	case "csv":
+		data, filename, err = h.svc.ExportCSV(c.Request.Context(), pharmacyID, id)
+		contentType = "text/csv"
+	default:
+		h.respondError(c, http.StatusBadRequest, "format must be pdf or csv")
+		return
+	}
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
@@ -0,0 +1,192 @@
+package purchaseorders
+
+import (
+	"organization-service/internal/pharmacy/inventory/stockin"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+// Purchase order lifecycle:
+//
+//	DRAFT -> SENT -> PARTIALLY_RECEIVED -> CLOSED
+//	DRAFT / SENT -> CANCELLED
+//
+// An order closes on its own once every line is fully received, or can be
+// closed short when the supplier will not deliver the rest.
+const (
+	StatusDraft             Status = "DRAFT"
+	StatusSent              Status = "SENT"
+	StatusPartiallyReceived Status = "PARTIALLY_RECEIVED"
+	StatusClosed            Status = "CLOSED"
+	StatusCancelled         Status = "CANCELLED"
+)
+
+// openStatuses are orders whose unreceived quantity still counts as on order
+var openStatuses = []Status{StatusDraft, StatusSent, StatusPartiallyReceived}
+
+const (
+	SourceManual  = "MANUAL"
+	SourceReorder = "REORDER"
+)
+
+type PurchaseOrder struct {
+	ID            uuid.UUID           `json:"id"`
+	PharmacyID    uuid.UUID           `json:"pharmacy_id"`
+	SupplierID    uuid.UUID           `json:"supplier_id"`
+	SupplierName  string              `json:"supplier_name"`
+	PONumber      string              `json:"po_number"`
+	Status        Status              `json:"status"`
+	Source        string              `json:"source"` // MANUAL, REORDER
+	ExpectedDate  *time.Time          `json:"expected_date,omitempty"`
+	TotalAmount   float64             `json:"total_amount"`
+	Notes         string              `json:"notes"`
+	SentAt        *time.Time          `json:"sent_at,omitempty"`
+	ClosedAt      *time.Time          `json:"closed_at,omitempty"`
+	CloseReason   string              `json:"close_reason,omitempty"`
+	CreatedBy     uuid.UUID           `json:"created_by"`
+	CreatedByName string              `json:"created_by_name"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	Items         []PurchaseOrderItem `json:"items,omitempty"`
+}
+
+// PurchaseOrderItem quantities are in base units, matching batch stock
+type PurchaseOrderItem struct {
+	ID                uuid.UUID `json:"id"`
+	PurchaseOrderID   uuid.UUID `json:"purchase_order_id"`
+	MedicineID        uuid.UUID `json:"medicine_id"`
+	MedicineName      string    `json:"medicine_name"`
+	MedicineBrand     string    `json:"medicine_brand"`
+	Quantity          int       `json:"quantity"`
+	ExpectedUnitPrice float64   `json:"expected_unit_price"`
+	ReceivedQty       int       `json:"received_qty"`
+	LineTotal         float64   `json:"line_total"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// PendingQty is the base-unit quantity still expected from the supplier
+func (i PurchaseOrderItem) PendingQty() int {
+	if i.ReceivedQty >= i.Quantity {
+		return 0
+	}
+	return i.Quantity - i.ReceivedQty
+}
+
+// GoodsReceivedNote is one delivery against a purchase order, booked as a stock-in purchase
+type GoodsReceivedNote struct {
+	ID              uuid.UUID               `json:"id"`
+	PharmacyID      uuid.UUID               `json:"pharmacy_id"`
+	PurchaseOrderID uuid.UUID               `json:"purchase_order_id"`
+	PurchaseID      uuid.UUID               `json:"purchase_id"`
+	InvoiceNo       string                  `json:"invoice_no"`
+	GRNNumber       string                  `json:"grn_number"`
+	ReceivedBy      string                  `json:"received_by"`
+	Notes           string                  `json:"notes"`
+	CreatedBy       uuid.UUID               `json:"created_by"`
+	CreatedByName   string                  `json:"created_by_name"`
+	CreatedAt       time.Time               `json:"created_at"`
+	Items           []GoodsReceivedNoteItem `json:"items,omitempty"`
+}
+
+type GoodsReceivedNoteItem struct {
+	ID                  uuid.UUID `json:"id"`
+	GRNID               uuid.UUID `json:"grn_id"`
+	PurchaseOrderItemID uuid.UUID `json:"purchase_order_item_id"`
+	MedicineID          uuid.UUID `json:"medicine_id"`
+	MedicineName        string    `json:"medicine_name"`
+	ReceivedQty         int       `json:"received_qty"` // base units including bonus
+	BilledQty           int       `json:"billed_qty"`   // base units on the invoice
+	UnitCost            float64   `json:"unit_cost"`    // per billed base unit
+	LineTotal           float64   `json:"line_total"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// VarianceLine compares what was ordered with what was received and billed.
+// Positive variances mean more units or a higher price than ordered.
+type VarianceLine struct {
+	MedicineID        uuid.UUID `json:"medicine_id"`
+	MedicineName      string    `json:"medicine_name"`
+	OrderedQty        int       `json:"ordered_qty"`
+	ReceivedQty       int       `json:"received_qty"`
+	BilledQty         int       `json:"billed_qty"`
+	QtyVariance       int       `json:"qty_variance"`
+	ExpectedUnitPrice float64   `json:"expected_unit_price"`
+	ActualUnitPrice   float64   `json:"actual_unit_price"`
+	PriceVariance     float64   `json:"price_variance"`
+	PriceVariancePct  float64   `json:"price_variance_pct"`
+	ExpectedAmount    float64   `json:"expected_amount"` // billed qty at the expected price
+	ActualAmount      float64   `json:"actual_amount"`
+	ValueVariance     float64   `json:"value_variance"`
+}
+
+type VarianceReport struct {
+	PurchaseOrderID uuid.UUID      `json:"purchase_order_id"`
+	PONumber        string         `json:"po_number"`
+	SupplierName    string         `json:"supplier_name"`
+	Status          Status         `json:"status"`
+	Lines           []VarianceLine `json:"lines"`
+	OrderedAmount   float64        `json:"ordered_amount"`
+	ReceivedAmount  float64        `json:"received_amount"`
+	ValueVariance   float64        `json:"value_variance"`
+	ShortLines      int            `json:"short_lines"`
+	OverLines       int            `json:"over_lines"`
+	PriceUpLines    int            `json:"price_up_lines"`
+	PriceDownLines  int            `json:"price_down_lines"`
+}
+
+// DocumentParties are the letterhead details printed on the exported order
+type DocumentParties struct {
+	PharmacyName     string
+	PharmacyAddress  string
+	PharmacyPhone    string
+	PharmacyEmail    string
+	PharmacyLicense  string
+	SupplierName     string
+	SupplierAddress  string
+	SupplierContact  string
+	SupplierPhone    string
+	SupplierEmail    string
+	SupplierGSTIN    string
+	CreditPeriodDays int
+}
+
+// Request/Response Structs
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID   uuid.UUID                 `json:"supplier_id" validate:"required"`
+	ExpectedDate *time.Time                `json:"expected_date"`
+	Notes        string                    `json:"notes" validate:"max=500"`
+	Source       string                    `json:"-"`
+	Items        []CreatePurchaseOrderItem `json:"items" validate:"required,min=1,dive"`
+}
+
+type CreatePurchaseOrderItem struct {
+	MedicineID        uuid.UUID `json:"medicine_id" validate:"required"`
+	Quantity          int       `json:"quantity" validate:"required,gt=0"`
+	ExpectedUnitPrice float64   `json:"expected_unit_price" validate:"gte=0"`
+}
+
+type UpdatePurchaseOrderRequest struct {
+	ExpectedDate *time.Time                `json:"expected_date"`
+	Notes        *string                   `json:"notes" validate:"omitempty,max=500"`
+	Items        []CreatePurchaseOrderItem `json:"items" validate:"omitempty,min=1,dive"`
+}
+
+type ClosePurchaseOrderRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// ReceivePurchaseOrderRequest is the supplier invoice for one delivery against the order.
+// The supplier is taken from the purchase order; items may cover part of the order.
+type ReceivePurchaseOrderRequest struct {
+	InvoiceNo    string                       `json:"invoice_no" validate:"required,max=100"`
+	PurchaseDate time.Time                    `json:"purchase_date" validate:"required"`
+	ReceivedBy   string                       `json:"received_by" validate:"required,max=255"`
+	GrandTotal   float64                      `json:"grand_total" validate:"required,gte=0"`
+	PaidAmount   float64                      `json:"paid_amount" validate:"gte=0"`
+	Notes        string                       `json:"notes" validate:"max=500"`
+	Items        []stockin.CreatePurchaseItem `json:"items" validate:"required,min=1,dive"`
+}
@@ -0,0 +1,430 @@
+package purchaseorders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Create(ctx context.Context, po *PurchaseOrder) error
+	GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, status string, supplierID *uuid.UUID, limit, offset int) ([]PurchaseOrder, int, error)
+	// UpdateDraft rewrites the header and replaces all items of a DRAFT order
+	UpdateDraft(ctx context.Context, po *PurchaseOrder) error
+	// Transition moves an order to status `to` only if it is currently in one of `from`
+	Transition(ctx context.Context, pharmacyID, id uuid.UUID, from []Status, to Status, reason string) error
+	// CreateGRN stores a goods-received note, adds its quantities to the order
+	// lines and moves the order to PARTIALLY_RECEIVED or CLOSED
+	CreateGRN(ctx context.Context, grn *GoodsReceivedNote) error
+	ListGRNs(ctx context.Context, pharmacyID, purchaseOrderID uuid.UUID) ([]GoodsReceivedNote, error)
+	// GetOnOrderQuantities returns open (not yet received) base units per medicine
+	GetOnOrderQuantities(ctx context.Context, pharmacyID uuid.UUID) (map[uuid.UUID]int, error)
+	GetDocumentParties(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*DocumentParties, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) Create(ctx context.Context, po *PurchaseOrder) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// PO numbers come from the pharmacy's purchase order series: PO/26-27/00001
+	po.PONumber, err = numbering.Next(ctx, tx, po.PharmacyID, numbering.DocPurchaseOrder, po.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO inventory.purchase_orders (
+			id, pharmacy_id, supplier_id, po_number, status, source, expected_date,
+			total_amount, notes, created_by, created_by_name, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, po.ID, po.PharmacyID, po.SupplierID, po.PONumber, po.Status, po.Source, po.ExpectedDate,
+		po.TotalAmount, po.Notes, po.CreatedBy, po.CreatedByName, po.CreatedAt, po.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert purchase order: %w", err)
+	}
+
+	if err := insertItems(ctx, tx, po); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertItems(ctx context.Context, tx *sql.Tx, po *PurchaseOrder) error {
+	itemQuery := `
+		INSERT INTO inventory.purchase_order_items (
+			id, purchase_order_id, medicine_id, quantity, expected_unit_price, received_qty, line_total, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for _, item := range po.Items {
+		if _, err := tx.ExecContext(ctx, itemQuery,
+			item.ID, po.ID, item.MedicineID, item.Quantity, item.ExpectedUnitPrice, item.ReceivedQty, item.LineTotal, item.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to insert purchase order item (%s): %w", item.MedicineID, err)
+		}
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, error) {
+	query := `
+		SELECT po.id, po.pharmacy_id, po.supplier_id, COALESCE(s.name, ''), po.po_number, po.status, po.source,
+		       po.expected_date, po.total_amount, COALESCE(po.notes, ''),
+		       po.sent_at, po.closed_at, COALESCE(po.close_reason, ''),
+		       po.created_by, COALESCE(po.created_by_name, ''), po.created_at, po.updated_at
+		FROM inventory.purchase_orders po
+		LEFT JOIN supplier_schema.suppliers s ON s.id = po.supplier_id
+		WHERE po.id = $1 AND po.pharmacy_id = $2
+	`
+	po := &PurchaseOrder{}
+	var createdBy uuid.NullUUID
+	err := r.db.QueryRowContext(ctx, query, id, pharmacyID).Scan(
+		&po.ID, &po.PharmacyID, &po.SupplierID, &po.SupplierName, &po.PONumber, &po.Status, &po.Source,
+		&po.ExpectedDate, &po.TotalAmount, &po.Notes,
+		&po.SentAt, &po.ClosedAt, &po.CloseReason,
+		&createdBy, &po.CreatedByName, &po.CreatedAt, &po.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("purchase order not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	po.CreatedBy = createdBy.UUID
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT i.id, i.purchase_order_id, i.medicine_id, m.name, COALESCE(m.brand_name, ''),
+		       i.quantity, i.expected_unit_price, i.received_qty, i.line_total, i.created_at
+		FROM inventory.purchase_order_items i
+		JOIN inventory.medicines m ON m.id = i.medicine_id
+		WHERE i.purchase_order_id = $1
+		ORDER BY m.name
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item PurchaseOrderItem
+		if err := rows.Scan(
+			&item.ID, &item.PurchaseOrderID, &item.MedicineID, &item.MedicineName, &item.MedicineBrand,
+			&item.Quantity, &item.ExpectedUnitPrice, &item.ReceivedQty, &item.LineTotal, &item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		po.Items = append(po.Items, item)
+	}
+	return po, rows.Err()
+}
+
+func (r *postgresRepository) List(ctx context.Context, pharmacyID uuid.UUID, status string, supplierID *uuid.UUID, limit, offset int) ([]PurchaseOrder, int, error) {
+	where := "WHERE po.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND po.status = $%d", len(args))
+	}
+	if supplierID != nil {
+		args = append(args, *supplierID)
+		where += fmt.Sprintf(" AND po.supplier_id = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.purchase_orders po "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT po.id, po.pharmacy_id, po.supplier_id, COALESCE(s.name, ''), po.po_number, po.status, po.source,
+		       po.expected_date, po.total_amount, COALESCE(po.notes, ''),
+		       po.sent_at, po.closed_at, COALESCE(po.close_reason, ''),
+		       po.created_by, COALESCE(po.created_by_name, ''), po.created_at, po.updated_at
+		FROM inventory.purchase_orders po
+		LEFT JOIN supplier_schema.suppliers s ON s.id = po.supplier_id
+		%s
+		ORDER BY po.created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var orders []PurchaseOrder
+	for rows.Next() {
+		var po PurchaseOrder
+		var createdBy uuid.NullUUID
+		if err := rows.Scan(
+			&po.ID, &po.PharmacyID, &po.SupplierID, &po.SupplierName, &po.PONumber, &po.Status, &po.Source,
+			&po.ExpectedDate, &po.TotalAmount, &po.Notes,
+			&po.SentAt, &po.ClosedAt, &po.CloseReason,
+			&createdBy, &po.CreatedByName, &po.CreatedAt, &po.UpdatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		po.CreatedBy = createdBy.UUID
+		orders = append(orders, po)
+	}
+	return orders, total, rows.Err()
+}
+
+func (r *postgresRepository) UpdateDraft(ctx context.Context, po *PurchaseOrder) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE inventory.purchase_orders SET expected_date = $1, notes = $2, total_amount = $3, updated_at = $4
+		WHERE id = $5 AND pharmacy_id = $6 AND status = $7
+	`, po.ExpectedDate, po.Notes, po.TotalAmount, po.UpdatedAt, po.ID, po.PharmacyID, StatusDraft)
+	if err != nil {
+		return fmt.Errorf("failed to update purchase order: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("only draft purchase orders can be edited")
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM inventory.purchase_order_items WHERE purchase_order_id = $1`, po.ID); err != nil {
+		return fmt.Errorf("failed to replace purchase order items: %w", err)
+	}
+	if err := insertItems(ctx, tx, po); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) Transition(ctx context.Context, pharmacyID, id uuid.UUID, from []Status, to Status, reason string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.purchase_orders SET
+			status = $1,
+			sent_at = CASE WHEN $7 THEN $2 ELSE sent_at END,
+			closed_at = CASE WHEN $8 THEN $2 ELSE closed_at END,
+			close_reason = COALESCE(NULLIF($3, ''), close_reason),
+			updated_at = $2
+		WHERE id = $4 AND pharmacy_id = $5 AND status = ANY($6)
+	`, to, time.Now(), reason, id, pharmacyID, pq.Array(statusStrings(from)),
+		to == StatusSent, to == StatusClosed || to == StatusCancelled)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("purchase order not found or cannot move to %s", to)
+	}
+	return nil
+}
+
+func (r *postgresRepository) CreateGRN(ctx context.Context, grn *GoodsReceivedNote) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the order so concurrent deliveries cannot both close it
+	var status Status
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM inventory.purchase_orders WHERE id = $1 AND pharmacy_id = $2 FOR UPDATE
+	`, grn.PurchaseOrderID, grn.PharmacyID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("purchase order not found")
+	}
+	if err != nil {
+		return err
+	}
+	if status != StatusSent && status != StatusPartiallyReceived {
+		return fmt.Errorf("cannot receive goods against a purchase order that is %s", status)
+	}
+
+	// GRN numbers come from the pharmacy's goods receipt series: GRN/26-27/00001
+	grn.GRNNumber, err = numbering.Next(ctx, tx, grn.PharmacyID, numbering.DocGoodsReceipt, grn.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.goods_received_notes (
+			id, pharmacy_id, purchase_order_id, purchase_id, grn_number, received_by, notes,
+			created_by, created_by_name, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, grn.ID, grn.PharmacyID, grn.PurchaseOrderID, grn.PurchaseID, grn.GRNNumber, grn.ReceivedBy, grn.Notes,
+		grn.CreatedBy, grn.CreatedByName, grn.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert goods received note: %w", err)
+	}
+
+	for _, item := range grn.Items {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO inventory.goods_received_note_items (
+				id, grn_id, purchase_order_item_id, medicine_id, received_qty, billed_qty, unit_cost, line_total, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, item.ID, grn.ID, item.PurchaseOrderItemID, item.MedicineID, item.ReceivedQty, item.BilledQty,
+			item.UnitCost, item.LineTotal, item.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert goods received note item (%s): %w", item.MedicineID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE inventory.purchase_order_items SET received_qty = received_qty + $1 WHERE id = $2
+		`, item.ReceivedQty, item.PurchaseOrderItemID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE inventory.purchase_orders po SET
+			status = CASE WHEN pending.qty = 0 THEN 'CLOSED' ELSE 'PARTIALLY_RECEIVED' END,
+			closed_at = CASE WHEN pending.qty = 0 THEN $2 ELSE po.closed_at END,
+			updated_at = $2
+		FROM (
+			SELECT COALESCE(SUM(GREATEST(quantity - received_qty, 0)), 0) AS qty
+			FROM inventory.purchase_order_items WHERE purchase_order_id = $1
+		) pending
+		WHERE po.id = $1
+	`, grn.PurchaseOrderID, grn.CreatedAt); err != nil {
+		return fmt.Errorf("failed to update purchase order status: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) ListGRNs(ctx context.Context, pharmacyID, purchaseOrderID uuid.UUID) ([]GoodsReceivedNote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT g.id, g.pharmacy_id, g.purchase_order_id, g.purchase_id, COALESCE(p.invoice_no, ''), g.grn_number,
+		       COALESCE(g.received_by, ''), COALESCE(g.notes, ''), g.created_by, COALESCE(g.created_by_name, ''), g.created_at
+		FROM inventory.goods_received_notes g
+		LEFT JOIN inventory.purchases p ON p.id = g.purchase_id
+		WHERE g.purchase_order_id = $1 AND g.pharmacy_id = $2
+		ORDER BY g.created_at
+	`, purchaseOrderID, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grns []GoodsReceivedNote
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var g GoodsReceivedNote
+		var createdBy uuid.NullUUID
+		if err := rows.Scan(
+			&g.ID, &g.PharmacyID, &g.PurchaseOrderID, &g.PurchaseID, &g.InvoiceNo, &g.GRNNumber,
+			&g.ReceivedBy, &g.Notes, &createdBy, &g.CreatedByName, &g.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		g.CreatedBy = createdBy.UUID
+		index[g.ID] = len(grns)
+		grns = append(grns, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(grns) == 0 {
+		return grns, nil
+	}
+
+	itemRows, err := r.db.QueryContext(ctx, `
+		SELECT i.id, i.grn_id, i.purchase_order_item_id, i.medicine_id, m.name,
+		       i.received_qty, i.billed_qty, i.unit_cost, i.line_total, i.created_at
+		FROM inventory.goods_received_note_items i
+		JOIN inventory.goods_received_notes g ON g.id = i.grn_id
+		JOIN inventory.medicines m ON m.id = i.medicine_id
+		WHERE g.purchase_order_id = $1
+		ORDER BY m.name
+	`, purchaseOrderID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item GoodsReceivedNoteItem
+		if err := itemRows.Scan(
+			&item.ID, &item.GRNID, &item.PurchaseOrderItemID, &item.MedicineID, &item.MedicineName,
+			&item.ReceivedQty, &item.BilledQty, &item.UnitCost, &item.LineTotal, &item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if i, ok := index[item.GRNID]; ok {
+			grns[i].Items = append(grns[i].Items, item)
+		}
+	}
+	return grns, itemRows.Err()
+}
+
+func (r *postgresRepository) GetDocumentParties(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*DocumentParties, error) {
+	d := &DocumentParties{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT ph.name, COALESCE(ph.address, ''), COALESCE(ph.phone, ''), COALESCE(ph.email, ''), COALESCE(ph.license_number, ''),
+		       s.name, COALESCE(s.address, ''), COALESCE(s.contact_person, ''), COALESCE(s.contact_number, ''),
+		       COALESCE(s.email, ''), COALESCE(s.gst_number, ''), COALESCE(s.credit_period_days, 0)
+		FROM public.pharmacies ph, supplier_schema.suppliers s
+		WHERE ph.id = $1 AND s.id = $2
+	`, pharmacyID, supplierID).Scan(
+		&d.PharmacyName, &d.PharmacyAddress, &d.PharmacyPhone, &d.PharmacyEmail, &d.PharmacyLicense,
+		&d.SupplierName, &d.SupplierAddress, &d.SupplierContact, &d.SupplierPhone,
+		&d.SupplierEmail, &d.SupplierGSTIN, &d.CreditPeriodDays,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("pharmacy or supplier not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *postgresRepository) GetOnOrderQuantities(ctx context.Context, pharmacyID uuid.UUID) (map[uuid.UUID]int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT i.medicine_id, SUM(GREATEST(i.quantity - i.received_qty, 0))
+		FROM inventory.purchase_order_items i
+		JOIN inventory.purchase_orders po ON po.id = i.purchase_order_id
+		WHERE po.pharmacy_id = $1 AND po.status = ANY($2)
+		GROUP BY i.medicine_id
+	`, pharmacyID, pq.Array(statusStrings(openStatuses)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	onOrder := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var id uuid.UUID
+		var qty int
+		if err := rows.Scan(&id, &qty); err != nil {
+			return nil, err
+		}
+		onOrder[id] = qty
+	}
+	return onOrder, rows.Err()
+}
+
+func statusStrings(statuses []Status) []string {
+	out := make([]string, len(statuses))
+	for i, st := range statuses {
+		out[i] = string(st)
+	}
+	return out
+}
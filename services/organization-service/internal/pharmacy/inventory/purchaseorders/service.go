@@ -0,0 +1,377 @@
+package purchaseorders
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"organization-service/internal/pharmacy/inventory/medicines"
+	"organization-service/internal/pharmacy/inventory/stockin"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	Create(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreatePurchaseOrderRequest) (*PurchaseOrder, error)
+	Update(ctx context.Context, pharmacyID, id uuid.UUID, req UpdatePurchaseOrderRequest) (*PurchaseOrder, error)
+	Get(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, status string, supplierID *uuid.UUID, limit, offset int) ([]PurchaseOrder, int, error)
+	Send(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, error)
+	Cancel(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*PurchaseOrder, error)
+	// Close ends a partially received order when the rest will not be delivered
+	Close(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*PurchaseOrder, error)
+	// Receive books one delivery through stock-in and records it as a goods-received note
+	Receive(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ReceivePurchaseOrderRequest) (*GoodsReceivedNote, *PurchaseOrder, error)
+	ListGRNs(ctx context.Context, pharmacyID, id uuid.UUID) ([]GoodsReceivedNote, error)
+	GetVariance(ctx context.Context, pharmacyID, id uuid.UUID) (*VarianceReport, error)
+	ExportCSV(ctx context.Context, pharmacyID, id uuid.UUID) ([]byte, string, error)
+	ExportPDF(ctx context.Context, pharmacyID, id uuid.UUID) ([]byte, string, error)
+	GetOnOrderQuantities(ctx context.Context, pharmacyID uuid.UUID) (map[uuid.UUID]int, error)
+}
+
+type service struct {
+	repo       Repository
+	medRepo    medicines.Repository
+	stockInSvc stockin.Service
+}
+
+func NewService(repo Repository, medRepo medicines.Repository, stockInSvc stockin.Service) Service {
+	return &service{
+		repo:       repo,
+		medRepo:    medRepo,
+		stockInSvc: stockInSvc,
+	}
+}
+
+func (s *service) Create(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreatePurchaseOrderRequest) (*PurchaseOrder, error) {
+	ok, err := s.medRepo.ValidateSuppliers(ctx, pharmacyID, []uuid.UUID{req.SupplierID})
+	if err != nil {
+		return nil, fmt.Errorf("error validating supplier: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid or inactive supplier for this pharmacy")
+	}
+
+	source := req.Source
+	if source == "" {
+		source = SourceManual
+	}
+
+	now := time.Now()
+	po := &PurchaseOrder{
+		ID:            uuid.New(),
+		PharmacyID:    pharmacyID,
+		SupplierID:    req.SupplierID,
+		Status:        StatusDraft,
+		Source:        source,
+		ExpectedDate:  req.ExpectedDate,
+		Notes:         req.Notes,
+		CreatedBy:     userID,
+		CreatedByName: userName,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	items, total, err := s.buildItems(ctx, pharmacyID, po.ID, req.Items, now)
+	if err != nil {
+		return nil, err
+	}
+	po.Items = items
+	po.TotalAmount = total
+
+	if err := s.repo.Create(ctx, po); err != nil {
+		return nil, err
+	}
+	return po, nil
+}
+
+func (s *service) buildItems(ctx context.Context, pharmacyID, poID uuid.UUID, reqItems []CreatePurchaseOrderItem, now time.Time) ([]PurchaseOrderItem, float64, error) {
+	var items []PurchaseOrderItem
+	var total float64
+	seen := make(map[uuid.UUID]bool)
+	for _, reqItem := range reqItems {
+		if seen[reqItem.MedicineID] {
+			return nil, 0, fmt.Errorf("medicine %s is listed more than once", reqItem.MedicineID)
+		}
+		seen[reqItem.MedicineID] = true
+
+		med, err := s.medRepo.GetByID(ctx, reqItem.MedicineID, pharmacyID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to fetch/validate medicine (%s): %w", reqItem.MedicineID, err)
+		}
+		if !med.IsActive {
+			return nil, 0, fmt.Errorf("medicine %s is inactive", med.Name)
+		}
+
+		lineTotal := money.Round2(float64(reqItem.Quantity) * reqItem.ExpectedUnitPrice)
+		total += lineTotal
+		items = append(items, PurchaseOrderItem{
+			ID:                uuid.New(),
+			PurchaseOrderID:   poID,
+			MedicineID:        med.ID,
+			MedicineName:      med.Name,
+			MedicineBrand:     med.BrandName,
+			Quantity:          reqItem.Quantity,
+			ExpectedUnitPrice: reqItem.ExpectedUnitPrice,
+			LineTotal:         lineTotal,
+			CreatedAt:         now,
+		})
+	}
+	return items, money.Round2(total), nil
+}
+
+func (s *service) Update(ctx context.Context, pharmacyID, id uuid.UUID, req UpdatePurchaseOrderRequest) (*PurchaseOrder, error) {
+	po, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if po.Status != StatusDraft {
+		return nil, fmt.Errorf("only draft purchase orders can be edited")
+	}
+
+	now := time.Now()
+	if req.ExpectedDate != nil {
+		po.ExpectedDate = req.ExpectedDate
+	}
+	if req.Notes != nil {
+		po.Notes = *req.Notes
+	}
+	if len(req.Items) > 0 {
+		items, total, err := s.buildItems(ctx, pharmacyID, po.ID, req.Items, now)
+		if err != nil {
+			return nil, err
+		}
+		po.Items = items
+		po.TotalAmount = total
+	}
+	po.UpdatedAt = now
+
+	if err := s.repo.UpdateDraft(ctx, po); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) Get(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, error) {
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) List(ctx context.Context, pharmacyID uuid.UUID, status string, supplierID *uuid.UUID, limit, offset int) ([]PurchaseOrder, int, error) {
+	return s.repo.List(ctx, pharmacyID, status, supplierID, limit, offset)
+}
+
+func (s *service) Send(ctx context.Context, pharmacyID, id uuid.UUID) (*PurchaseOrder, error) {
+	if err := s.repo.Transition(ctx, pharmacyID, id, []Status{StatusDraft}, StatusSent, ""); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) Cancel(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*PurchaseOrder, error) {
+	// Once goods have arrived the order can only be closed short, not cancelled
+	if err := s.repo.Transition(ctx, pharmacyID, id, []Status{StatusDraft, StatusSent}, StatusCancelled, reason); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) Close(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*PurchaseOrder, error) {
+	if err := s.repo.Transition(ctx, pharmacyID, id, []Status{StatusPartiallyReceived}, StatusClosed, reason); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) Receive(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ReceivePurchaseOrderRequest) (*GoodsReceivedNote, *PurchaseOrder, error) {
+	po, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if po.Status != StatusSent && po.Status != StatusPartiallyReceived {
+		return nil, nil, fmt.Errorf("cannot receive goods against a purchase order that is %s", po.Status)
+	}
+
+	lines := make(map[uuid.UUID]PurchaseOrderItem, len(po.Items))
+	for _, item := range po.Items {
+		lines[item.MedicineID] = item
+	}
+	for _, item := range req.Items {
+		if _, ok := lines[item.MedicineID]; !ok {
+			return nil, nil, fmt.Errorf("medicine %s is not on purchase order %s", item.MedicineID, po.PONumber)
+		}
+	}
+
+	notes := req.Notes
+	if notes == "" {
+		notes = fmt.Sprintf("Received against %s", po.PONumber)
+	}
+	purchase, err := s.stockInSvc.AddStockIn(ctx, pharmacyID, userID, userName, stockin.CreatePurchaseRequest{
+		SupplierID:   po.SupplierID,
+		InvoiceNo:    req.InvoiceNo,
+		PurchaseDate: req.PurchaseDate,
+		ReceivedBy:   req.ReceivedBy,
+		GrandTotal:   req.GrandTotal,
+		PaidAmount:   req.PaidAmount,
+		Notes:        notes,
+		Items:        req.Items,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Stock-in normalizes units per mode, so read back the base units it actually booked.
+	// Several batches of one medicine collapse into a single GRN line.
+	_, purchaseItems, err := s.stockInSvc.GetStockInDetails(ctx, pharmacyID, purchase.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stock received but failed to load purchase %s: %w", purchase.InvoiceNo, err)
+	}
+
+	now := time.Now()
+	grn := &GoodsReceivedNote{
+		ID:              uuid.New(),
+		PharmacyID:      pharmacyID,
+		PurchaseOrderID: po.ID,
+		PurchaseID:      purchase.ID,
+		InvoiceNo:       purchase.InvoiceNo,
+		ReceivedBy:      req.ReceivedBy,
+		Notes:           req.Notes,
+		CreatedBy:       userID,
+		CreatedByName:   userName,
+		CreatedAt:       now,
+	}
+	grnLines := make(map[uuid.UUID]*GoodsReceivedNoteItem)
+	var order []uuid.UUID
+	for _, pi := range purchaseItems {
+		line, ok := grnLines[pi.MedicineID]
+		if !ok {
+			poItem := lines[pi.MedicineID]
+			line = &GoodsReceivedNoteItem{
+				ID:                  uuid.New(),
+				GRNID:               grn.ID,
+				PurchaseOrderItemID: poItem.ID,
+				MedicineID:          pi.MedicineID,
+				MedicineName:        poItem.MedicineName,
+				CreatedAt:           now,
+			}
+			grnLines[pi.MedicineID] = line
+			order = append(order, pi.MedicineID)
+		}
+		line.ReceivedQty += pi.TotalQtyUnits
+		line.BilledQty += pi.ReceivedQty * pi.UnitsPerMode
+		line.LineTotal = money.Round2(line.LineTotal + pi.ItemTotalAmount)
+	}
+	for _, medicineID := range order {
+		line := grnLines[medicineID]
+		if line.BilledQty > 0 {
+			line.UnitCost = math.Round(line.LineTotal/float64(line.BilledQty)*10000) / 10000
+		}
+		grn.Items = append(grn.Items, *line)
+	}
+
+	if err := s.repo.CreateGRN(ctx, grn); err != nil {
+		return nil, nil, fmt.Errorf("stock received on invoice %s but failed to record goods received note: %w", purchase.InvoiceNo, err)
+	}
+
+	po, err = s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return grn, po, nil
+}
+
+func (s *service) ListGRNs(ctx context.Context, pharmacyID, id uuid.UUID) ([]GoodsReceivedNote, error) {
+	if _, err := s.repo.GetByID(ctx, pharmacyID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListGRNs(ctx, pharmacyID, id)
+}
+
+func (s *service) GetVariance(ctx context.Context, pharmacyID, id uuid.UUID) (*VarianceReport, error) {
+	po, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	grns, err := s.repo.ListGRNs(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	return buildVariance(po, grns), nil
+}
+
+// buildVariance compares each order line with everything received against it.
+// Price variance is measured per billed unit so bonus units do not distort it.
+func buildVariance(po *PurchaseOrder, grns []GoodsReceivedNote) *VarianceReport {
+	type received struct {
+		qty, billed int
+		amount      float64
+	}
+	byLine := make(map[uuid.UUID]*received)
+	for _, g := range grns {
+		for _, item := range g.Items {
+			r, ok := byLine[item.PurchaseOrderItemID]
+			if !ok {
+				r = &received{}
+				byLine[item.PurchaseOrderItemID] = r
+			}
+			r.qty += item.ReceivedQty
+			r.billed += item.BilledQty
+			r.amount += item.LineTotal
+		}
+	}
+
+	report := &VarianceReport{
+		PurchaseOrderID: po.ID,
+		PONumber:        po.PONumber,
+		SupplierName:    po.SupplierName,
+		Status:          po.Status,
+		OrderedAmount:   po.TotalAmount,
+	}
+	for _, item := range po.Items {
+		r := byLine[item.ID]
+		if r == nil {
+			r = &received{}
+		}
+		line := VarianceLine{
+			MedicineID:        item.MedicineID,
+			MedicineName:      item.MedicineName,
+			OrderedQty:        item.Quantity,
+			ReceivedQty:       r.qty,
+			BilledQty:         r.billed,
+			QtyVariance:       r.qty - item.Quantity,
+			ExpectedUnitPrice: item.ExpectedUnitPrice,
+			ExpectedAmount:    money.Round2(float64(r.billed) * item.ExpectedUnitPrice),
+			ActualAmount:      money.Round2(r.amount),
+		}
+		if r.billed > 0 {
+			line.ActualUnitPrice = math.Round(r.amount/float64(r.billed)*10000) / 10000
+			line.PriceVariance = math.Round((line.ActualUnitPrice-item.ExpectedUnitPrice)*10000) / 10000
+			if item.ExpectedUnitPrice > 0 {
+				line.PriceVariancePct = money.Round2(line.PriceVariance / item.ExpectedUnitPrice * 100)
+			}
+		}
+		line.ValueVariance = money.Round2(line.ActualAmount - line.ExpectedAmount)
+
+		switch {
+		case line.QtyVariance < 0:
+			report.ShortLines++
+		case line.QtyVariance > 0:
+			report.OverLines++
+		}
+		switch {
+		case line.PriceVariance > 0:
+			report.PriceUpLines++
+		case line.PriceVariance < 0:
+			report.PriceDownLines++
+		}
+		report.ReceivedAmount = money.Round2(report.ReceivedAmount + line.ActualAmount)
+		report.ValueVariance = money.Round2(report.ValueVariance + line.ValueVariance)
+		report.Lines = append(report.Lines, line)
+	}
+	return report
+}
+
+func (s *service) GetOnOrderQuantities(ctx context.Context, pharmacyID uuid.UUID) (map[uuid.UUID]int, error) {
+	return s.repo.GetOnOrderQuantities(ctx, pharmacyID)
+}
@@ -0,0 +1,131 @@
+package purchaseorders
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildVariance(t *testing.T) {
+	line := PurchaseOrderItem{ID: uuid.New(), MedicineName: "Paracetamol 500mg", Quantity: 100, ExpectedUnitPrice: 2}
+	po := &PurchaseOrder{ID: uuid.New(), PONumber: "PO/25-26/00001", Status: StatusPartiallyReceived, TotalAmount: 200, Items: []PurchaseOrderItem{line}}
+	grn := func(items ...GoodsReceivedNoteItem) GoodsReceivedNote {
+		for i := range items {
+			items[i].PurchaseOrderItemID = line.ID
+		}
+		return GoodsReceivedNote{Items: items}
+	}
+
+	tests := []struct {
+		name          string
+		grns          []GoodsReceivedNote
+		wantQty       int
+		wantBilled    int
+		wantQtyVar    int
+		wantUnitPrice float64
+		wantPriceVar  float64
+		wantPricePct  float64
+		wantValueVar  float64
+		wantShort     int
+		wantOver      int
+		wantPriceUp   int
+		wantPriceDown int
+	}{
+		{
+			name:       "nothing received",
+			wantQtyVar: -100, wantShort: 1,
+		},
+		{
+			name:    "received in full at the ordered price",
+			grns:    []GoodsReceivedNote{grn(GoodsReceivedNoteItem{ReceivedQty: 100, BilledQty: 100, LineTotal: 200})},
+			wantQty: 100, wantBilled: 100, wantUnitPrice: 2,
+		},
+		{
+			name: "two short deliveries",
+			grns: []GoodsReceivedNote{
+				grn(GoodsReceivedNoteItem{ReceivedQty: 40, BilledQty: 40, LineTotal: 80}),
+				grn(GoodsReceivedNoteItem{ReceivedQty: 30, BilledQty: 30, LineTotal: 60}),
+			},
+			wantQty: 70, wantBilled: 70, wantQtyVar: -30, wantUnitPrice: 2, wantShort: 1,
+		},
+		{
+			name:    "bonus units do not lower the unit price",
+			grns:    []GoodsReceivedNote{grn(GoodsReceivedNoteItem{ReceivedQty: 110, BilledQty: 100, LineTotal: 200})},
+			wantQty: 110, wantBilled: 100, wantQtyVar: 10, wantUnitPrice: 2, wantOver: 1,
+		},
+		{
+			name:    "price went up",
+			grns:    []GoodsReceivedNote{grn(GoodsReceivedNoteItem{ReceivedQty: 100, BilledQty: 100, LineTotal: 230})},
+			wantQty: 100, wantBilled: 100, wantUnitPrice: 2.3, wantPriceVar: 0.3, wantPricePct: 15, wantValueVar: 30, wantPriceUp: 1,
+		},
+		{
+			name:    "price went down",
+			grns:    []GoodsReceivedNote{grn(GoodsReceivedNoteItem{ReceivedQty: 100, BilledQty: 100, LineTotal: 190})},
+			wantQty: 100, wantBilled: 100, wantUnitPrice: 1.9, wantPriceVar: -0.1, wantPricePct: -5, wantValueVar: -10, wantPriceDown: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := buildVariance(po, tt.grns)
+			if len(r.Lines) != 1 {
+				t.Fatalf("got %d lines, want 1", len(r.Lines))
+			}
+			l := r.Lines[0]
+			if l.ReceivedQty != tt.wantQty || l.BilledQty != tt.wantBilled || l.QtyVariance != tt.wantQtyVar {
+				t.Errorf("received/billed/variance = %d/%d/%d, want %d/%d/%d",
+					l.ReceivedQty, l.BilledQty, l.QtyVariance, tt.wantQty, tt.wantBilled, tt.wantQtyVar)
+			}
+			if l.ActualUnitPrice != tt.wantUnitPrice || l.PriceVariance != tt.wantPriceVar || l.PriceVariancePct != tt.wantPricePct {
+				t.Errorf("unit price/variance/pct = %v/%v/%v, want %v/%v/%v",
+					l.ActualUnitPrice, l.PriceVariance, l.PriceVariancePct, tt.wantUnitPrice, tt.wantPriceVar, tt.wantPricePct)
+			}
+			if l.ValueVariance != tt.wantValueVar || r.ValueVariance != tt.wantValueVar {
+				t.Errorf("value variance = %v (report %v), want %v", l.ValueVariance, r.ValueVariance, tt.wantValueVar)
+			}
+			if r.ShortLines != tt.wantShort || r.OverLines != tt.wantOver || r.PriceUpLines != tt.wantPriceUp || r.PriceDownLines != tt.wantPriceDown {
+				t.Errorf("short/over/up/down = %d/%d/%d/%d, want %d/%d/%d/%d",
+					r.ShortLines, r.OverLines, r.PriceUpLines, r.PriceDownLines, tt.wantShort, tt.wantOver, tt.wantPriceUp, tt.wantPriceDown)
+			}
+		})
+	}
+}
+
+func TestPendingQty(t *testing.T) {
+	tests := []struct {
+		ordered, received, want int
+	}{
+		{100, 0, 100},
+		{100, 60, 40},
+		{100, 100, 0},
+		{100, 120, 0},
+	}
+
+	for _, tt := range tests {
+		item := PurchaseOrderItem{Quantity: tt.ordered, ReceivedQty: tt.received}
+		if got := item.PendingQty(); got != tt.want {
+			t.Errorf("PendingQty() with %d of %d received = %d, want %d", tt.received, tt.ordered, got, tt.want)
+		}
+	}
+}
+
+func TestJoinNonEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{"all present", []string{"GSTIN: ", "29ABCDE1234F1Z5", "  DL: ", "KA-123"}, "GSTIN: 29ABCDE1234F1Z5  DL: KA-123"},
+		{"leading pair empty", []string{"GSTIN: ", "", "  DL: ", "KA-123"}, "DL: KA-123"},
+		{"all empty", []string{"GSTIN: ", "", "  DL: ", ""}, ""},
+		{"odd label ignored", []string{"Phone: ", "98450", "  Email: "}, "Phone: 98450"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinNonEmpty(tt.parts...); got != tt.want {
+				t.Errorf("joinNonEmpty() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
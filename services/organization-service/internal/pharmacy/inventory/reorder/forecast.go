@@ -0,0 +1,170 @@
+package reorder
+
+import (
+	"math"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+)
+
+const (
+	// baseWindowDays is the moving-average window for the demand level
+	baseWindowDays = 28
+	// weekdayWindowDays is how far back day-of-week patterns are measured
+	weekdayWindowDays = 84
+	// historyDays is how much ledger history is loaded; enough for a year-ago comparison
+	historyDays = 400
+	// yearLagDays compares against the same weekdays one year back
+	yearLagDays = 364
+
+	minSeasonalFactor = 0.5
+	maxSeasonalFactor = 2.0
+)
+
+// demandSeries is a dense day-by-day series ending the day before "today"
+type demandSeries struct {
+	end  time.Time // exclusive
+	days []float64 // days[len-1] is yesterday
+	// observed is the number of trailing days since the first recorded movement
+	observed int
+}
+
+func newDemandSeries(points []DemandPoint, today time.Time, length int) demandSeries {
+	end := truncateDay(today)
+	start := end.AddDate(0, 0, -length)
+	s := demandSeries{end: end, days: make([]float64, length)}
+
+	first := -1
+	for _, p := range points {
+		idx := int(truncateDay(p.Date).Sub(start).Hours() / 24)
+		if idx < 0 || idx >= length {
+			continue
+		}
+		s.days[idx] += p.Quantity
+		if p.Quantity != 0 && (first == -1 || idx < first) {
+			first = idx
+		}
+	}
+	if first >= 0 {
+		s.observed = length - first
+	}
+	return s
+}
+
+// sum adds demand for the n days ending `lag` days before the series end
+func (s demandSeries) sum(lag, n int) float64 {
+	total := 0.0
+	for i := 0; i < n; i++ {
+		idx := len(s.days) - 1 - lag - i
+		if idx < 0 {
+			break
+		}
+		total += s.days[idx]
+	}
+	return total
+}
+
+func (s demandSeries) dateAt(idx int) time.Time {
+	return s.end.AddDate(0, 0, idx-len(s.days))
+}
+
+// baseLevel is the moving average over the last baseWindowDays, or over the
+// observed history when the medicine is newer than that.
+func (s demandSeries) baseLevel() float64 {
+	window := baseWindowDays
+	if s.observed < window {
+		window = s.observed
+	}
+	if window == 0 {
+		return 0
+	}
+	return math.Max(s.sum(0, window)/float64(window), 0)
+}
+
+// weekdayIndex is demand per weekday relative to the overall average (mean 1).
+// Short histories get a flat index.
+func (s demandSeries) weekdayIndex() [7]float64 {
+	idx := [7]float64{1, 1, 1, 1, 1, 1, 1}
+	window := weekdayWindowDays
+	if s.observed < window {
+		window = s.observed
+	}
+	if window < 2*7 {
+		return idx
+	}
+
+	var totals [7]float64
+	var counts [7]int
+	for i := len(s.days) - window; i < len(s.days); i++ {
+		wd := s.dateAt(i).Weekday()
+		totals[wd] += s.days[i]
+		counts[wd]++
+	}
+
+	var means [7]float64
+	overall := 0.0
+	for wd := 0; wd < 7; wd++ {
+		if counts[wd] > 0 {
+			means[wd] = totals[wd] / float64(counts[wd])
+		}
+		overall += means[wd]
+	}
+	overall /= 7
+	if overall <= 0 {
+		return idx
+	}
+	for wd := 0; wd < 7; wd++ {
+		idx[wd] = math.Max(means[wd], 0) / overall
+	}
+	return idx
+}
+
+// seasonalFactor compares last year's demand over the coming horizon with the
+// weeks leading up to it. Without a full year of history the factor is 1.
+func (s demandSeries) seasonalFactor(horizon int) float64 {
+	if horizon < 1 || s.observed < yearLagDays+baseWindowDays {
+		return 1
+	}
+	// Last year's horizon window starts yearLagDays ago; its lag from the end is yearLagDays-horizon
+	upcomingLag := yearLagDays - horizon
+	if upcomingLag < 0 {
+		upcomingLag = 0
+		horizon = yearLagDays
+	}
+	upcoming := s.sum(upcomingLag, horizon) / float64(horizon)
+	before := s.sum(yearLagDays, baseWindowDays) / float64(baseWindowDays)
+	if before <= 0 {
+		return 1
+	}
+	return math.Min(math.Max(upcoming/before, minSeasonalFactor), maxSeasonalFactor)
+}
+
+// buildForecast projects daily demand for the next horizon days starting today
+func buildForecast(points []DemandPoint, today time.Time, horizon int) Forecast {
+	s := newDemandSeries(points, today, historyDays)
+	base := s.baseLevel()
+	weekday := s.weekdayIndex()
+	seasonal := s.seasonalFactor(horizon)
+
+	f := Forecast{
+		HistoryDays:    s.observed,
+		AvgDailyDemand: money.Round2(base * seasonal),
+		WeekdayIndex:   weekday,
+		SeasonalFactor: money.Round2(seasonal),
+	}
+	for i := 0; i < horizon; i++ {
+		day := s.end.AddDate(0, 0, i)
+		qty := base * weekday[day.Weekday()] * seasonal
+		f.TotalDemand += qty
+		f.Daily = append(f.Daily, DailyForecast{Date: day, Quantity: money.Round2(qty)})
+	}
+	f.TotalDemand = money.Round2(f.TotalDemand)
+	for i := range f.WeekdayIndex {
+		f.WeekdayIndex[i] = money.Round2(f.WeekdayIndex[i])
+	}
+	return f
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,196 @@
+package reorder
+
+import (
+	"testing"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+)
+
+// today is a Tuesday
+var today = time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+// dailyDemand builds one point per day for the given number of days before today
+func dailyDemand(days int, qty func(day time.Time) float64) []DemandPoint {
+	points := make([]DemandPoint, 0, days)
+	for i := days; i >= 1; i-- {
+		day := today.AddDate(0, 0, -i)
+		points = append(points, DemandPoint{Date: day, Quantity: qty(day)})
+	}
+	return points
+}
+
+func flat(q float64) func(time.Time) float64 { return func(time.Time) float64 { return q } }
+
+func TestBuildForecast(t *testing.T) {
+	weekdays := func(day time.Time) float64 {
+		if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			return 2
+		}
+		return 12
+	}
+	// Demand over the same fortnight last year ran 50% above the weeks before it
+	lastYearPeak := func(day time.Time) float64 {
+		start := today.AddDate(0, 0, -yearLagDays)
+		if !day.Before(start) && day.Before(start.AddDate(0, 0, 14)) {
+			return 15
+		}
+		return 10
+	}
+
+	tests := []struct {
+		name         string
+		points       []DemandPoint
+		horizon      int
+		wantHistory  int
+		wantAvg      float64
+		wantSeasonal float64
+		wantTotal    float64
+		wantWeekday  [7]float64
+	}{
+		{
+			name:         "no history",
+			horizon:      7,
+			wantSeasonal: 1,
+			wantWeekday:  [7]float64{1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:         "steady demand",
+			points:       dailyDemand(60, flat(10)),
+			horizon:      7,
+			wantHistory:  60,
+			wantAvg:      10,
+			wantSeasonal: 1,
+			wantTotal:    70,
+			wantWeekday:  [7]float64{1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:         "new medicine averages over its own history",
+			points:       dailyDemand(5, flat(14)),
+			horizon:      3,
+			wantHistory:  5,
+			wantAvg:      14,
+			wantSeasonal: 1,
+			wantTotal:    42,
+			wantWeekday:  [7]float64{1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:         "weekend dip",
+			points:       dailyDemand(84, weekdays),
+			horizon:      7,
+			wantHistory:  84,
+			wantAvg:      9.14,
+			wantSeasonal: 1,
+			wantTotal:    64,
+			wantWeekday:  [7]float64{0.22, 1.31, 1.31, 1.31, 1.31, 1.31, 0.22},
+		},
+		{
+			name:         "last year's season lifts the forecast",
+			points:       dailyDemand(historyDays, lastYearPeak),
+			horizon:      14,
+			wantHistory:  historyDays,
+			wantAvg:      15,
+			wantSeasonal: 1.5,
+			wantTotal:    210,
+			wantWeekday:  [7]float64{1, 1, 1, 1, 1, 1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := buildForecast(tt.points, today, tt.horizon)
+			if f.HistoryDays != tt.wantHistory {
+				t.Errorf("HistoryDays = %d, want %d", f.HistoryDays, tt.wantHistory)
+			}
+			if f.AvgDailyDemand != tt.wantAvg {
+				t.Errorf("AvgDailyDemand = %v, want %v", f.AvgDailyDemand, tt.wantAvg)
+			}
+			if f.SeasonalFactor != tt.wantSeasonal {
+				t.Errorf("SeasonalFactor = %v, want %v", f.SeasonalFactor, tt.wantSeasonal)
+			}
+			if f.TotalDemand != tt.wantTotal {
+				t.Errorf("TotalDemand = %v, want %v", f.TotalDemand, tt.wantTotal)
+			}
+			if f.WeekdayIndex != tt.wantWeekday {
+				t.Errorf("WeekdayIndex = %v, want %v", f.WeekdayIndex, tt.wantWeekday)
+			}
+			if len(f.Daily) != tt.horizon || (tt.horizon > 0 && !f.Daily[0].Date.Equal(today)) {
+				t.Errorf("Daily = %v, want %d days from %s", f.Daily, tt.horizon, today)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	steady := dailyDemand(60, flat(10))
+	med := func(stock, level, minQty int) medicineInfo {
+		return medicineInfo{
+			ReorderSettings: ReorderSettings{ReorderLevel: level, ReorderQuantity: minQty, LeadTimeDays: 7, SafetyStockDays: 3},
+			CurrentStock:    stock,
+			LastUnitCost:    2.5,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		med        medicineInfo
+		history    []DemandPoint
+		onOrder    int
+		wantOK     bool
+		wantPoint  int
+		wantQty    int
+		wantCover  float64
+		wantNoRate bool
+	}{
+		{name: "well stocked", med: med(500, 0, 0), history: steady},
+		{name: "stock on order covers the reorder point", med: med(50, 0, 0), history: steady, onOrder: 60},
+		{name: "no demand and no reorder level", med: med(0, 0, 0)},
+		{
+			name: "below lead-time demand plus safety stock", med: med(50, 0, 0), history: steady,
+			wantOK: true, wantPoint: 100, wantQty: 190, wantCover: 5,
+		},
+		{
+			name: "exactly at the reorder point", med: med(100, 0, 0), history: steady,
+			wantOK: true, wantPoint: 100, wantQty: 140, wantCover: 10,
+		},
+		{
+			name: "configured reorder level raises the point", med: med(120, 150, 0), history: steady,
+			wantOK: true, wantPoint: 150, wantQty: 120, wantCover: 12,
+		},
+		{
+			name: "minimum order quantity", med: med(95, 0, 500), history: steady,
+			wantOK: true, wantPoint: 100, wantQty: 500, wantCover: 9.5,
+		},
+		{
+			name: "reorder level without demand history", med: med(5, 20, 0),
+			wantOK: true, wantPoint: 20, wantQty: 15, wantNoRate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sg, ok := suggest(tt.med, tt.history, tt.onOrder, today, 14)
+			if ok != tt.wantOK {
+				t.Fatalf("suggest() ok = %v, want %v (%+v)", ok, tt.wantOK, sg)
+			}
+			if !ok {
+				return
+			}
+			if sg.ReorderPoint != tt.wantPoint {
+				t.Errorf("ReorderPoint = %d, want %d", sg.ReorderPoint, tt.wantPoint)
+			}
+			if sg.SuggestedQty != tt.wantQty {
+				t.Errorf("SuggestedQty = %d, want %d", sg.SuggestedQty, tt.wantQty)
+			}
+			if want := money.Round2(float64(tt.wantQty) * 2.5); sg.EstimatedCost != want {
+				t.Errorf("EstimatedCost = %v, want %v", sg.EstimatedCost, want)
+			}
+			switch {
+			case tt.wantNoRate && sg.DaysOfCover != nil:
+				t.Errorf("DaysOfCover = %v, want nil", *sg.DaysOfCover)
+			case !tt.wantNoRate && (sg.DaysOfCover == nil || *sg.DaysOfCover != tt.wantCover):
+				t.Errorf("DaysOfCover = %v, want %v", sg.DaysOfCover, tt.wantCover)
+			}
+		})
+	}
+}
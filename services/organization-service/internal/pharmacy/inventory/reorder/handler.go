@@ -0,0 +1,177 @@
+package reorder
+
+import (
+	"fmt"
+	"net/http"
+	"organization-service/middleware"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// GetSuggestions returns the suggested-reorder report grouped by supplier
+func (h *Handler) GetSuggestions(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	coverDays, _ := strconv.Atoi(c.Query("cover_days"))
+	report, err := h.svc.GetSuggestions(c.Request.Context(), pharmacyID, coverDays)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, report)
+}
+
+func (h *Handler) GetForecast(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	medicineID, err := uuid.Parse(c.Param("medicineId"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid medicine ID")
+		return
+	}
+
+	days, _ := strconv.Atoi(c.Query("days"))
+	if days > 365 {
+		days = 365
+	}
+	forecast, err := h.svc.GetForecast(c.Request.Context(), pharmacyID, medicineID, days)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, forecast)
+}
+
+func (h *Handler) GetSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	medicineID, err := uuid.Parse(c.Param("medicineId"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid medicine ID")
+		return
+	}
+
+	settings, err := h.svc.GetSettings(c.Request.Context(), pharmacyID, medicineID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	medicineID, err := uuid.Parse(c.Param("medicineId"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid medicine ID")
+		return
+	}
+
+	var req UpdateReorderSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	settings, err := h.svc.UpdateSettings(c.Request.Context(), pharmacyID, medicineID, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+// CreatePurchaseOrders converts the current suggestions into draft purchase orders
+func (h *Handler) CreatePurchaseOrders(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req CreateOrdersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	orders, err := h.svc.CreatePurchaseOrders(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, orders)
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
@@ -0,0 +1,106 @@
+package reorder
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReorderSettings are the per-medicine knobs stored on inventory.medicines.
+// All quantities are in base units.
+type ReorderSettings struct {
+	MedicineID      uuid.UUID `json:"medicine_id"`
+	MedicineName    string    `json:"medicine_name"`
+	ReorderLevel    int       `json:"reorder_level"`
+	ReorderQuantity int       `json:"reorder_quantity"`
+	LeadTimeDays    int       `json:"lead_time_days"`
+	SafetyStockDays int       `json:"safety_stock_days"`
+}
+
+type UpdateReorderSettingsRequest struct {
+	ReorderLevel    *int `json:"reorder_level" validate:"omitempty,gte=0"`
+	ReorderQuantity *int `json:"reorder_quantity" validate:"omitempty,gte=0"`
+	LeadTimeDays    *int `json:"lead_time_days" validate:"omitempty,gte=0,lte=365"`
+	SafetyStockDays *int `json:"safety_stock_days" validate:"omitempty,gte=0,lte=365"`
+}
+
+// DemandPoint is the net quantity sold (sales minus sale returns) on one day
+type DemandPoint struct {
+	Date     time.Time `json:"date"`
+	Quantity float64   `json:"quantity"`
+}
+
+type DailyForecast struct {
+	Date     time.Time `json:"date"`
+	Quantity float64   `json:"quantity"`
+}
+
+type Forecast struct {
+	MedicineID     uuid.UUID       `json:"medicine_id"`
+	MedicineName   string          `json:"medicine_name"`
+	HistoryDays    int             `json:"history_days"`
+	AvgDailyDemand float64         `json:"avg_daily_demand"`
+	WeekdayIndex   [7]float64      `json:"weekday_index"` // Sunday first
+	SeasonalFactor float64         `json:"seasonal_factor"`
+	TotalDemand    float64         `json:"total_demand"`
+	Daily          []DailyForecast `json:"daily"`
+}
+
+// medicineInfo is the reorder view of a medicine row with its current position
+type medicineInfo struct {
+	ReorderSettings
+	BrandName    string
+	UnitType     string
+	SupplierID   uuid.UUID
+	SupplierName string
+	CurrentStock int
+	LastUnitCost float64
+}
+
+type Suggestion struct {
+	MedicineID       uuid.UUID `json:"medicine_id"`
+	MedicineName     string    `json:"medicine_name"`
+	MedicineBrand    string    `json:"medicine_brand"`
+	UnitType         string    `json:"unit_type"`
+	CurrentStock     int       `json:"current_stock"`
+	OnOrder          int       `json:"on_order"`
+	AvgDailyDemand   float64   `json:"avg_daily_demand"`
+	LeadTimeDays     int       `json:"lead_time_days"`
+	LeadTimeDemand   float64   `json:"lead_time_demand"`
+	ReorderLevel     int       `json:"reorder_level"`
+	ReorderPoint     int       `json:"reorder_point"`
+	SuggestedQty     int       `json:"suggested_qty"`
+	ExpectedUnitCost float64   `json:"expected_unit_cost"`
+	EstimatedCost    float64   `json:"estimated_cost"`
+	DaysOfCover      *float64  `json:"days_of_cover,omitempty"` // nil when there is no demand
+}
+
+type SupplierSuggestions struct {
+	SupplierID     uuid.UUID    `json:"supplier_id"`
+	SupplierName   string       `json:"supplier_name"`
+	Items          []Suggestion `json:"items"`
+	EstimatedTotal float64      `json:"estimated_total"`
+}
+
+type SuggestionReport struct {
+	GeneratedAt time.Time             `json:"generated_at"`
+	CoverDays   int                   `json:"cover_days"`
+	Suppliers   []SupplierSuggestions `json:"suppliers"`
+	TotalItems  int                   `json:"total_items"`
+	TotalCost   float64               `json:"total_cost"`
+}
+
+// CreateOrdersRequest turns the current suggestions into draft purchase orders.
+// SupplierIDs limits which supplier groups are ordered (all when empty); Items
+// overrides or removes individual suggested quantities.
+type CreateOrdersRequest struct {
+	CoverDays    int             `json:"cover_days" validate:"omitempty,gte=1,lte=365"`
+	SupplierIDs  []uuid.UUID     `json:"supplier_ids"`
+	Items        []OrderOverride `json:"items" validate:"omitempty,dive"`
+	ExpectedDate *time.Time      `json:"expected_date"`
+}
+
+type OrderOverride struct {
+	MedicineID uuid.UUID `json:"medicine_id" validate:"required"`
+	Quantity   int       `json:"quantity" validate:"gte=0"` // 0 drops the item
+}
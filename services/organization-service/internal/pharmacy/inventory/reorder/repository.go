@@ -0,0 +1,149 @@
+package reorder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	// ListMedicines returns active medicines with reorder settings, sellable stock and last cost.
+	// medicineIDs narrows the result when non-empty.
+	ListMedicines(ctx context.Context, pharmacyID uuid.UUID, medicineIDs []uuid.UUID) ([]medicineInfo, error)
+	// GetDailyDemand returns net units sold per IST day since the given date, per medicine
+	GetDailyDemand(ctx context.Context, pharmacyID uuid.UUID, medicineIDs []uuid.UUID, since time.Time) (map[uuid.UUID][]DemandPoint, error)
+	GetSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID) (*ReorderSettings, error)
+	UpdateSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID, req UpdateReorderSettingsRequest) error
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) ListMedicines(ctx context.Context, pharmacyID uuid.UUID, medicineIDs []uuid.UUID) ([]medicineInfo, error) {
+	query := `
+		SELECT m.id, m.name, COALESCE(m.brand_name, ''), m.unit_type, m.supplier_id, COALESCE(s.name, ''),
+		       m.reorder_level, m.reorder_quantity, m.lead_time_days, m.safety_stock_days,
+		       COALESCE(stock.qty, 0), COALESCE(cost.cost_price_per_unit, 0)
+		FROM inventory.medicines m
+		LEFT JOIN supplier_schema.suppliers s ON s.id = m.supplier_id
+		LEFT JOIN (
+			SELECT medicine_id, SUM(quantity_available) AS qty
+			FROM inventory.batches
+			WHERE pharmacy_id = $1 AND expiry_date > CURRENT_DATE AND quantity_available > 0
+			GROUP BY medicine_id
+		) stock ON stock.medicine_id = m.id
+		LEFT JOIN (
+			SELECT DISTINCT ON (pi.medicine_id) pi.medicine_id, pi.cost_price_per_unit
+			FROM inventory.purchase_items pi
+			WHERE pi.pharmacy_id = $1
+			ORDER BY pi.medicine_id, pi.created_at DESC
+		) cost ON cost.medicine_id = m.id
+		WHERE m.pharmacy_id = $1 AND m.is_active = true
+	`
+	args := []interface{}{pharmacyID}
+	if len(medicineIDs) > 0 {
+		query += " AND m.id = ANY($2)"
+		args = append(args, pq.Array(medicineIDs))
+	}
+	query += " ORDER BY m.name"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list medicines for reorder: %w", err)
+	}
+	defer rows.Close()
+
+	var meds []medicineInfo
+	for rows.Next() {
+		var m medicineInfo
+		if err := rows.Scan(
+			&m.MedicineID, &m.MedicineName, &m.BrandName, &m.UnitType, &m.SupplierID, &m.SupplierName,
+			&m.ReorderLevel, &m.ReorderQuantity, &m.LeadTimeDays, &m.SafetyStockDays,
+			&m.CurrentStock, &m.LastUnitCost,
+		); err != nil {
+			return nil, err
+		}
+		meds = append(meds, m)
+	}
+	return meds, rows.Err()
+}
+
+func (r *postgresRepository) GetDailyDemand(ctx context.Context, pharmacyID uuid.UUID, medicineIDs []uuid.UUID, since time.Time) (map[uuid.UUID][]DemandPoint, error) {
+	// Sales are negative movements and returns positive, so the negated sum is net demand
+	query := `
+		SELECT medicine_id, timezone('Asia/Kolkata', created_at)::date AS day, -SUM(quantity_change)
+		FROM inventory.stock_ledger
+		WHERE pharmacy_id = $1
+		  AND transaction_type IN ('SALE', 'SALE_RETURN')
+		  AND created_at >= $2
+	`
+	args := []interface{}{pharmacyID, since}
+	if len(medicineIDs) > 0 {
+		query += " AND medicine_id = ANY($3)"
+		args = append(args, pq.Array(medicineIDs))
+	}
+	query += " GROUP BY medicine_id, day ORDER BY medicine_id, day"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sales history: %w", err)
+	}
+	defer rows.Close()
+
+	demand := make(map[uuid.UUID][]DemandPoint)
+	for rows.Next() {
+		var id uuid.UUID
+		var p DemandPoint
+		if err := rows.Scan(&id, &p.Date, &p.Quantity); err != nil {
+			return nil, err
+		}
+		demand[id] = append(demand[id], p)
+	}
+	return demand, rows.Err()
+}
+
+func (r *postgresRepository) GetSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID) (*ReorderSettings, error) {
+	s := &ReorderSettings{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, reorder_level, reorder_quantity, lead_time_days, safety_stock_days
+		FROM inventory.medicines
+		WHERE id = $1 AND pharmacy_id = $2
+	`, medicineID, pharmacyID).Scan(
+		&s.MedicineID, &s.MedicineName, &s.ReorderLevel, &s.ReorderQuantity, &s.LeadTimeDays, &s.SafetyStockDays,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("medicine not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *postgresRepository) UpdateSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID, req UpdateReorderSettingsRequest) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE inventory.medicines SET
+			reorder_level = COALESCE($1, reorder_level),
+			reorder_quantity = COALESCE($2, reorder_quantity),
+			lead_time_days = COALESCE($3, lead_time_days),
+			safety_stock_days = COALESCE($4, safety_stock_days),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5 AND pharmacy_id = $6
+	`, req.ReorderLevel, req.ReorderQuantity, req.LeadTimeDays, req.SafetyStockDays, medicineID, pharmacyID)
+	if err != nil {
+		return fmt.Errorf("failed to update reorder settings: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("medicine not found")
+	}
+	return nil
+}
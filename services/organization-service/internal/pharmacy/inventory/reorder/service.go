@@ -0,0 +1,234 @@
+package reorder
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+	"organization-service/internal/pharmacy/inventory/purchaseorders"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+// DefaultCoverDays is how many days of demand a suggested order should cover beyond lead time
+const DefaultCoverDays = 30
+
+type Service interface {
+	GetSuggestions(ctx context.Context, pharmacyID uuid.UUID, coverDays int) (*SuggestionReport, error)
+	GetForecast(ctx context.Context, pharmacyID, medicineID uuid.UUID, days int) (*Forecast, error)
+	GetSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID) (*ReorderSettings, error)
+	UpdateSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID, req UpdateReorderSettingsRequest) (*ReorderSettings, error)
+	// CreatePurchaseOrders converts suggestions into one draft purchase order per supplier
+	CreatePurchaseOrders(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreateOrdersRequest) ([]*purchaseorders.PurchaseOrder, error)
+}
+
+type service struct {
+	repo  Repository
+	poSvc purchaseorders.Service
+}
+
+func NewService(repo Repository, poSvc purchaseorders.Service) Service {
+	return &service{
+		repo:  repo,
+		poSvc: poSvc,
+	}
+}
+
+func (s *service) GetSuggestions(ctx context.Context, pharmacyID uuid.UUID, coverDays int) (*SuggestionReport, error) {
+	if coverDays <= 0 {
+		coverDays = DefaultCoverDays
+	}
+
+	meds, err := s.repo.ListMedicines(ctx, pharmacyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	today := clock.Today()
+	demand, err := s.repo.GetDailyDemand(ctx, pharmacyID, nil, today.AddDate(0, 0, -historyDays))
+	if err != nil {
+		return nil, err
+	}
+	onOrder, err := s.poSvc.GetOnOrderQuantities(ctx, pharmacyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open purchase orders: %w", err)
+	}
+
+	report := &SuggestionReport{GeneratedAt: time.Now(), CoverDays: coverDays}
+	groups := make(map[uuid.UUID]*SupplierSuggestions)
+	for _, med := range meds {
+		sg, ok := suggest(med, demand[med.MedicineID], onOrder[med.MedicineID], today, coverDays)
+		if !ok {
+			continue
+		}
+		group, exists := groups[med.SupplierID]
+		if !exists {
+			group = &SupplierSuggestions{SupplierID: med.SupplierID, SupplierName: med.SupplierName}
+			groups[med.SupplierID] = group
+		}
+		group.Items = append(group.Items, sg)
+		group.EstimatedTotal = money.Round2(group.EstimatedTotal + sg.EstimatedCost)
+		report.TotalItems++
+		report.TotalCost = money.Round2(report.TotalCost + sg.EstimatedCost)
+	}
+
+	for _, group := range groups {
+		report.Suppliers = append(report.Suppliers, *group)
+	}
+	sort.Slice(report.Suppliers, func(i, j int) bool {
+		return report.Suppliers[i].SupplierName < report.Suppliers[j].SupplierName
+	})
+	return report, nil
+}
+
+// suggest decides whether a medicine needs reordering and how much to order.
+// The reorder point is lead-time demand plus safety stock, never below the
+// configured reorder level; the order tops stock up to cover lead time and
+// coverDays more, never below the minimum order quantity.
+func suggest(med medicineInfo, history []DemandPoint, onOrder int, today time.Time, coverDays int) (Suggestion, bool) {
+	f := buildForecast(history, today, med.LeadTimeDays+coverDays)
+	avg := f.AvgDailyDemand
+
+	leadTimeDemand := 0.0
+	for i := 0; i < med.LeadTimeDays && i < len(f.Daily); i++ {
+		leadTimeDemand += f.Daily[i].Quantity
+	}
+	safetyStock := avg * float64(med.SafetyStockDays)
+
+	reorderPoint := int(math.Ceil(leadTimeDemand + safetyStock))
+	if med.ReorderLevel > reorderPoint {
+		reorderPoint = med.ReorderLevel
+	}
+
+	position := med.CurrentStock + onOrder
+	if reorderPoint <= 0 || position > reorderPoint {
+		return Suggestion{}, false
+	}
+
+	target := int(math.Ceil(f.TotalDemand + safetyStock))
+	if target < reorderPoint {
+		target = reorderPoint
+	}
+	qty := target - position
+	if qty < med.ReorderQuantity {
+		qty = med.ReorderQuantity
+	}
+	if qty <= 0 {
+		return Suggestion{}, false
+	}
+
+	sg := Suggestion{
+		MedicineID:       med.MedicineID,
+		MedicineName:     med.MedicineName,
+		MedicineBrand:    med.BrandName,
+		UnitType:         med.UnitType,
+		CurrentStock:     med.CurrentStock,
+		OnOrder:          onOrder,
+		AvgDailyDemand:   avg,
+		LeadTimeDays:     med.LeadTimeDays,
+		LeadTimeDemand:   money.Round2(leadTimeDemand),
+		ReorderLevel:     med.ReorderLevel,
+		ReorderPoint:     reorderPoint,
+		SuggestedQty:     qty,
+		ExpectedUnitCost: med.LastUnitCost,
+		EstimatedCost:    money.Round2(float64(qty) * med.LastUnitCost),
+	}
+	if avg > 0 {
+		cover := money.Round2(float64(med.CurrentStock) / avg)
+		sg.DaysOfCover = &cover
+	}
+	return sg, true
+}
+
+func (s *service) GetForecast(ctx context.Context, pharmacyID, medicineID uuid.UUID, days int) (*Forecast, error) {
+	if days <= 0 {
+		days = DefaultCoverDays
+	}
+	settings, err := s.repo.GetSettings(ctx, pharmacyID, medicineID)
+	if err != nil {
+		return nil, err
+	}
+
+	today := clock.Today()
+	demand, err := s.repo.GetDailyDemand(ctx, pharmacyID, []uuid.UUID{medicineID}, today.AddDate(0, 0, -historyDays))
+	if err != nil {
+		return nil, err
+	}
+
+	f := buildForecast(demand[medicineID], today, days)
+	f.MedicineID = settings.MedicineID
+	f.MedicineName = settings.MedicineName
+	return &f, nil
+}
+
+func (s *service) GetSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID) (*ReorderSettings, error) {
+	return s.repo.GetSettings(ctx, pharmacyID, medicineID)
+}
+
+func (s *service) UpdateSettings(ctx context.Context, pharmacyID, medicineID uuid.UUID, req UpdateReorderSettingsRequest) (*ReorderSettings, error) {
+	if err := s.repo.UpdateSettings(ctx, pharmacyID, medicineID, req); err != nil {
+		return nil, err
+	}
+	return s.repo.GetSettings(ctx, pharmacyID, medicineID)
+}
+
+func (s *service) CreatePurchaseOrders(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreateOrdersRequest) ([]*purchaseorders.PurchaseOrder, error) {
+	report, err := s.GetSuggestions(ctx, pharmacyID, req.CoverDays)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[uuid.UUID]bool, len(req.SupplierIDs))
+	for _, id := range req.SupplierIDs {
+		wanted[id] = true
+	}
+	overrides := make(map[uuid.UUID]int, len(req.Items))
+	for _, item := range req.Items {
+		overrides[item.MedicineID] = item.Quantity
+	}
+
+	var orders []*purchaseorders.PurchaseOrder
+	for _, group := range report.Suppliers {
+		if len(wanted) > 0 && !wanted[group.SupplierID] {
+			continue
+		}
+
+		poReq := purchaseorders.CreatePurchaseOrderRequest{
+			SupplierID:   group.SupplierID,
+			ExpectedDate: req.ExpectedDate,
+			Notes:        fmt.Sprintf("Generated from reorder suggestions (%d days cover)", report.CoverDays),
+			Source:       purchaseorders.SourceReorder,
+		}
+		for _, item := range group.Items {
+			qty := item.SuggestedQty
+			if override, ok := overrides[item.MedicineID]; ok {
+				qty = override
+			}
+			if qty <= 0 {
+				continue
+			}
+			poReq.Items = append(poReq.Items, purchaseorders.CreatePurchaseOrderItem{
+				MedicineID:        item.MedicineID,
+				Quantity:          qty,
+				ExpectedUnitPrice: item.ExpectedUnitCost,
+			})
+		}
+		if len(poReq.Items) == 0 {
+			continue
+		}
+
+		po, err := s.poSvc.Create(ctx, pharmacyID, userID, userName, poReq)
+		if err != nil {
+			return orders, fmt.Errorf("failed to create purchase order for %s: %w", group.SupplierName, err)
+		}
+		orders = append(orders, po)
+	}
+
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("no items to order")
+	}
+	return orders, nil
+}
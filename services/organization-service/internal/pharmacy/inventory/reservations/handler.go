@@ -1,6 +1,7 @@
 package reservations
 
 import (
+	"errors"
 	"net/http"
 	"organization-service/middleware"
 
@@ -36,6 +37,10 @@ func (h *Handler) Create(c *gin.Context) {
 	}
 
 	res, err := h.svc.Reserve(c.Request.Context(), pharmacyID, req)
+	if errors.Is(err, ErrInsufficientStock) {
+		h.respondError(c, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		h.respondError(c, http.StatusBadRequest, err.Error())
 		return
@@ -101,6 +106,87 @@ func (h *Handler) Cancel(c *gin.Context) {
 	h.respondJSON(c, http.StatusOK, map[string]string{"message": "cancelled"})
 }
 
+// Extend keeps the holds of an active bill alive; the response lists the ids still held
+func (h *Handler) Extend(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	var req ExtendReservationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	held, err := h.svc.Extend(c.Request.Context(), pharmacyID, req.IDs)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if held == nil {
+		held = []uuid.UUID{}
+	}
+
+	h.respondJSON(c, http.StatusOK, map[string]interface{}{"held": held})
+}
+
+func (h *Handler) GetSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	settings, err := h.svc.GetSettings(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.svc.UpdateSettings(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
 func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
 	c.JSON(status, gin.H{"success": true, "data": data})
 }
@@ -27,6 +27,18 @@ type Reservation struct {
 	UpdatedAt time.Time         `json:"updated_at"`
 }
 
+// DefaultHoldMinutes applies until a pharmacy configures its own hold time
+const DefaultHoldMinutes = 60
+
+// Settings controls how long stock stays held for an untouched draft bill
+type Settings struct {
+	PharmacyID    uuid.UUID  `json:"pharmacy_id"`
+	HoldMinutes   int        `json:"hold_minutes"`
+	UpdatedBy     *uuid.UUID `json:"updated_by,omitempty"`
+	UpdatedByName string     `json:"updated_by_name,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
 type CreateReservationRequest struct {
 	ProductID uuid.UUID `json:"product_id" validate:"required"`
 	BatchID   uuid.UUID `json:"batch_id" validate:"required"`
@@ -36,3 +48,12 @@ type CreateReservationRequest struct {
 type UpdateReservationRequest struct {
 	Quantity int `json:"quantity" validate:"required,min=1"`
 }
+
+type UpdateSettingsRequest struct {
+	HoldMinutes int `json:"hold_minutes" validate:"required,min=5,max=1440"`
+}
+
+// ExtendReservationsRequest pushes the expiry of live holds out by the hold time
+type ExtendReservationsRequest struct {
+	IDs []uuid.UUID `json:"ids" validate:"required,min=1,max=500"`
+}
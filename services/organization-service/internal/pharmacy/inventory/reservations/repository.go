@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Repository interface {
@@ -14,10 +15,29 @@ type Repository interface {
 	GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Reservation, error)
 	Update(ctx context.Context, r *Reservation) error
 	Delete(ctx context.Context, pharmacyID, id uuid.UUID) error
+
+	// GetForUpdate loads a reservation inside tx and locks it until the tx ends
+	GetForUpdate(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID) (*Reservation, error)
+	// UpdateStatus changes a reservation's status inside tx
+	UpdateStatus(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID, status ReservationStatus) error
 	
 	// GetReservedQuantity returns the sum of all pending reservations for a batch
 	GetReservedQuantity(ctx context.Context, pharmacyID, batchID uuid.UUID) (int, error)
 
+	// GetOpenStockTake returns the number of the open stock-take session counting the batch, "" when none.
+	// With tx the batch row is locked first, so no session can freeze the batch until tx ends.
+	GetOpenStockTake(ctx context.Context, tx *sql.Tx, pharmacyID, batchID uuid.UUID) (string, error)
+
+	// ExtendPending moves the expiry of still-live pending reservations to expiresAt and returns their ids
+	ExtendPending(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID, expiresAt time.Time) ([]uuid.UUID, error)
+
+	// ExpireLapsed marks pending reservations past their expiry as EXPIRED
+	ExpireLapsed(ctx context.Context) (int64, error)
+
+	// GetSettings returns nil when the pharmacy has not configured a hold time
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpsertSettings(ctx context.Context, s *Settings) error
+
 	// PurgeOldReservations removes confirmed/cancelled reservations older than given duration
 	PurgeOldReservations(ctx context.Context, olderThan time.Duration) (int64, error)
 }
@@ -58,10 +78,37 @@ func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID, id uuid.UU
 func (r *postgresRepository) Update(ctx context.Context, res *Reservation) error {
 	query := `
 		UPDATE inventory.reservations
-		SET quantity = $1, status = $2, updated_at = $3
-		WHERE id = $4 AND pharmacy_id = $5
+		SET quantity = $1, status = $2, expires_at = $3, updated_at = $4
+		WHERE id = $5 AND pharmacy_id = $6
 	`
-	_, err := r.db.ExecContext(ctx, query, res.Quantity, res.Status, time.Now(), res.ID, res.PharmacyID)
+	_, err := r.db.ExecContext(ctx, query, res.Quantity, res.Status, res.ExpiresAt, time.Now(), res.ID, res.PharmacyID)
+	return err
+}
+
+func (r *postgresRepository) GetForUpdate(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID) (*Reservation, error) {
+	query := `
+		SELECT id, pharmacy_id, product_id, batch_id, quantity, status, expires_at, created_at, updated_at
+		FROM inventory.reservations
+		WHERE id = $1 AND pharmacy_id = $2
+		FOR UPDATE
+	`
+	res := &Reservation{}
+	err := tx.QueryRowContext(ctx, query, id, pharmacyID).Scan(
+		&res.ID, &res.PharmacyID, &res.ProductID, &res.BatchID, &res.Quantity, &res.Status, &res.ExpiresAt, &res.CreatedAt, &res.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("reservation not found")
+	}
+	return res, err
+}
+
+func (r *postgresRepository) UpdateStatus(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID, status ReservationStatus) error {
+	query := `
+		UPDATE inventory.reservations
+		SET status = $1, updated_at = $2
+		WHERE id = $3 AND pharmacy_id = $4
+	`
+	_, err := tx.ExecContext(ctx, query, status, time.Now(), id, pharmacyID)
 	return err
 }
 
@@ -82,6 +129,104 @@ func (r *postgresRepository) GetReservedQuantity(ctx context.Context, pharmacyID
 	return total, err
 }
 
+func (r *postgresRepository) GetOpenStockTake(ctx context.Context, tx *sql.Tx, pharmacyID, batchID uuid.UUID) (string, error) {
+	query := `
+		SELECT s.session_no
+		FROM inventory.stock_take_items i
+		JOIN inventory.stock_take_sessions s ON s.id = i.session_id
+		WHERE i.batch_id = $1 AND i.pharmacy_id = $2 AND s.status IN ('IN_PROGRESS', 'UNDER_REVIEW')
+		LIMIT 1
+	`
+	var sessionNo string
+	var err error
+	if tx != nil {
+		// Stock-take snapshots take the batch rows FOR SHARE, so this waits for a
+		// session being started and holds off any new one until tx ends
+		if _, err := tx.ExecContext(ctx, `
+			SELECT 1 FROM inventory.batches WHERE id = $1 AND pharmacy_id = $2 FOR UPDATE
+		`, batchID, pharmacyID); err != nil {
+			return "", fmt.Errorf("failed to lock batch: %w", err)
+		}
+		err = tx.QueryRowContext(ctx, query, batchID, pharmacyID).Scan(&sessionNo)
+	} else {
+		err = r.db.QueryRowContext(ctx, query, batchID, pharmacyID).Scan(&sessionNo)
+	}
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return sessionNo, err
+}
+
+func (r *postgresRepository) ExtendPending(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID, expiresAt time.Time) ([]uuid.UUID, error) {
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = id.String()
+	}
+	// A hold that has already lapsed may have been taken by another bill, so it is not revived
+	query := `
+		UPDATE inventory.reservations
+		SET expires_at = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE pharmacy_id = $2 AND id = ANY($3::uuid[]) AND status = 'PENDING' AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id
+	`
+	rows, err := r.db.QueryContext(ctx, query, expiresAt, pharmacyID, pq.Array(strIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var extended []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		extended = append(extended, id)
+	}
+	return extended, rows.Err()
+}
+
+func (r *postgresRepository) ExpireLapsed(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE inventory.reservations
+		SET status = 'EXPIRED', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'PENDING' AND expires_at <= CURRENT_TIMESTAMP
+	`
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *postgresRepository) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	query := `
+		SELECT pharmacy_id, hold_minutes, updated_by, COALESCE(updated_by_name, ''), updated_at
+		FROM inventory.reservation_settings
+		WHERE pharmacy_id = $1
+	`
+	s := &Settings{}
+	err := r.db.QueryRowContext(ctx, query, pharmacyID).Scan(&s.PharmacyID, &s.HoldMinutes, &s.UpdatedBy, &s.UpdatedByName, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+func (r *postgresRepository) UpsertSettings(ctx context.Context, s *Settings) error {
+	query := `
+		INSERT INTO inventory.reservation_settings (pharmacy_id, hold_minutes, updated_by, updated_by_name, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (pharmacy_id) DO UPDATE SET
+			hold_minutes = EXCLUDED.hold_minutes,
+			updated_by = EXCLUDED.updated_by,
+			updated_by_name = EXCLUDED.updated_by_name,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+	return r.db.QueryRowContext(ctx, query, s.PharmacyID, s.HoldMinutes, s.UpdatedBy, s.UpdatedByName).Scan(&s.UpdatedAt)
+}
+
 func (r *postgresRepository) PurgeOldReservations(ctx context.Context, olderThan time.Duration) (int64, error) {
 	query := `
 		DELETE FROM inventory.reservations
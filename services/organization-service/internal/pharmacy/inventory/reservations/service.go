@@ -2,19 +2,33 @@ package reservations
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"organization-service/internal/pharmacy/inventory/batches"
+	"shared-scheduler"
 )
 
+// ErrInsufficientStock is returned when a batch cannot cover the quantity to hold
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 type Service interface {
 	Reserve(ctx context.Context, pharmacyID uuid.UUID, req CreateReservationRequest) (*Reservation, error)
 	Update(ctx context.Context, pharmacyID, id uuid.UUID, req UpdateReservationRequest) error
 	Confirm(ctx context.Context, pharmacyID, id uuid.UUID) error
+	// ConfirmTx deducts the reserved stock inside a caller-owned transaction,
+	// so a sale can confirm all of its lines atomically
+	ConfirmTx(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID) error
 	Cancel(ctx context.Context, pharmacyID, id uuid.UUID) error
+	// Extend pushes live holds out by the pharmacy's hold time and returns the ids still held
+	Extend(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error)
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error)
 	StartPurgeWorker(ctx context.Context) // Production-grade background cleanup
+	RegisterJobs(jobs *scheduler.Scheduler) // Releases lapsed holds back to sale every minute
 }
 
 type reservationsService struct {
@@ -30,12 +44,21 @@ func NewService(repo Repository, batchRepo batches.Repository) Service {
 }
 
 func (s *reservationsService) Reserve(ctx context.Context, pharmacyID uuid.UUID, req CreateReservationRequest) (*Reservation, error) {
+	if err := s.checkNotCounting(ctx, nil, pharmacyID, req.BatchID); err != nil {
+		return nil, err
+	}
+
 	// 1. Get Batch and check availability
 	batch, err := s.batchRepo.GetBatch(ctx, pharmacyID, req.BatchID)
 	if err != nil {
 		return nil, err
 	}
 
+	// Expired stock sits in quarantine until it is returned or written off
+	if batch.ExpiryDate.Before(time.Now().Truncate(24 * time.Hour)) {
+		return nil, fmt.Errorf("batch %s expired on %s and cannot be sold", batch.BatchNo, batch.ExpiryDate.Format("2006-01-02"))
+	}
+
 	// Calculate net available = Current in batch - existing active reservations
 	reserved, err := s.repo.GetReservedQuantity(ctx, pharmacyID, req.BatchID)
 	if err != nil {
@@ -44,7 +67,12 @@ func (s *reservationsService) Reserve(ctx context.Context, pharmacyID uuid.UUID,
 
 	available := batch.QuantityAvailable - reserved
 	if available < req.Quantity {
-		return nil, fmt.Errorf("insufficient stock: %d available, %d requested", available, req.Quantity)
+		return nil, fmt.Errorf("%w: %d available, %d requested", ErrInsufficientStock, available, req.Quantity)
+	}
+
+	hold, err := s.holdTime(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
 	}
 
 	res := &Reservation{
@@ -54,7 +82,7 @@ func (s *reservationsService) Reserve(ctx context.Context, pharmacyID uuid.UUID,
 		BatchID:    req.BatchID,
 		Quantity:   req.Quantity,
 		Status:     StatusPending,
-		ExpiresAt:  time.Now().Add(1 * time.Hour), // TTL for reservation
+		ExpiresAt:  time.Now().Add(hold),
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
@@ -76,6 +104,12 @@ func (s *reservationsService) Update(ctx context.Context, pharmacyID, id uuid.UU
 		return fmt.Errorf("cannot update non-pending reservation")
 	}
 
+	if req.Quantity > res.Quantity {
+		if err := s.checkNotCounting(ctx, nil, pharmacyID, res.BatchID); err != nil {
+			return err
+		}
+	}
+
 	// Check if new quantity is available
 	batch, err := s.batchRepo.GetBatch(ctx, pharmacyID, res.BatchID)
 	if err != nil {
@@ -87,23 +121,60 @@ func (s *reservationsService) Update(ctx context.Context, pharmacyID, id uuid.UU
 	headroom := batch.QuantityAvailable - (reserved - res.Quantity)
 
 	if headroom < req.Quantity {
-		return fmt.Errorf("insufficient stock for updated quantity")
+		return fmt.Errorf("%w for updated quantity", ErrInsufficientStock)
 	}
 
+	// Editing the line counts as activity on the bill
+	hold, err := s.holdTime(ctx, pharmacyID)
+	if err != nil {
+		return err
+	}
 	res.Quantity = req.Quantity
+	res.ExpiresAt = time.Now().Add(hold)
 	return s.repo.Update(ctx, res)
 }
 
-func (s *reservationsService) Confirm(ctx context.Context, pharmacyID, id uuid.UUID) error {
-	res, err := s.repo.GetByID(ctx, pharmacyID, id)
+func (s *reservationsService) Extend(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error) {
+	hold, err := s.holdTime(ctx, pharmacyID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return s.repo.ExtendPending(ctx, pharmacyID, ids, time.Now().Add(hold))
+}
 
-	if res.Status != StatusPending {
-		return fmt.Errorf("reservation is already %s", res.Status)
+func (s *reservationsService) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		settings = &Settings{PharmacyID: pharmacyID, HoldMinutes: DefaultHoldMinutes}
+	}
+	return settings, nil
+}
+
+func (s *reservationsService) UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error) {
+	settings := &Settings{
+		PharmacyID:    pharmacyID,
+		HoldMinutes:   req.HoldMinutes,
+		UpdatedBy:     &userID,
+		UpdatedByName: userName,
+	}
+	if err := s.repo.UpsertSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *reservationsService) holdTime(ctx context.Context, pharmacyID uuid.UUID) (time.Duration, error) {
+	settings, err := s.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return 0, err
 	}
+	return time.Duration(settings.HoldMinutes) * time.Minute, nil
+}
 
+func (s *reservationsService) Confirm(ctx context.Context, pharmacyID, id uuid.UUID) error {
 	// Start Transaction to deduct stock for real
 	tx, err := s.batchRepo.BeginTx(ctx)
 	if err != nil {
@@ -111,19 +182,63 @@ func (s *reservationsService) Confirm(ctx context.Context, pharmacyID, id uuid.U
 	}
 	defer tx.Rollback()
 
-	// Deduct stock from batch
-	err = s.batchRepo.UpdateBatchQuantity(ctx, tx, pharmacyID, res.BatchID, -res.Quantity)
+	if err := s.ConfirmTx(ctx, tx, pharmacyID, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *reservationsService) ConfirmTx(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID) error {
+	// Lock the reservation so two checkouts cannot confirm it twice
+	res, err := s.repo.GetForUpdate(ctx, tx, pharmacyID, id)
 	if err != nil {
 		return err
 	}
 
-	// Mark reservation as confirmed
-	res.Status = StatusConfirmed
-	if err := s.repo.Update(ctx, res); err != nil {
+	if res.Status != StatusPending {
+		return fmt.Errorf("reservation is already %s", res.Status)
+	}
+
+	// A lapsed hold no longer counts against stock, so another bill may have taken it
+	if !res.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("stock hold expired at %s; resume the bill to reserve it again", res.ExpiresAt.Format("15:04"))
+	}
+
+	// Checked inside tx with the batch locked, so a stock-take cannot freeze the
+	// batch between the check and the deduction below
+	if err := s.checkNotCounting(ctx, tx, pharmacyID, res.BatchID); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	// Deduct stock from batch; the SALE ledger entry feeds demand forecasting
+	_, err = s.batchRepo.RecordMovement(ctx, tx, batches.MovementDTO{
+		PharmacyID:      pharmacyID,
+		MedicineID:      res.ProductID,
+		BatchID:         res.BatchID,
+		QuantityChange:  -res.Quantity,
+		TransactionType: "SALE",
+		ReferenceType:   "RESERVATION",
+		ReferenceID:     &res.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Mark reservation as confirmed
+	return s.repo.UpdateStatus(ctx, tx, pharmacyID, res.ID, StatusConfirmed)
+}
+
+// checkNotCounting blocks sales from a batch while a stock-take is counting it
+func (s *reservationsService) checkNotCounting(ctx context.Context, tx *sql.Tx, pharmacyID, batchID uuid.UUID) error {
+	sessionNo, err := s.repo.GetOpenStockTake(ctx, tx, pharmacyID, batchID)
+	if err != nil {
+		return err
+	}
+	if sessionNo != "" {
+		return fmt.Errorf("batch is under stock-take %s and cannot be sold until the count is posted or cancelled", sessionNo)
+	}
+	return nil
 }
 
 func (s *reservationsService) Cancel(ctx context.Context, pharmacyID, id uuid.UUID) error {
@@ -157,6 +272,19 @@ func (s *reservationsService) StartPurgeWorker(ctx context.Context) {
 	}()
 }
 
+// RegisterJobs schedules the hold sweeper, which marks lapsed holds EXPIRED so
+// abandoned carts stop showing as reserved
+func (s *reservationsService) RegisterJobs(jobs *scheduler.Scheduler) {
+	jobs.Register(&scheduler.Job{
+		Name:        "pharmacy-hold-sweeper",
+		Description: "Release stock held by idle draft bills once their holds lapse",
+		Schedule:    scheduler.MustParseSchedule("* * * * *"),
+		Run: func(ctx context.Context, _ *sql.DB) (int64, error) {
+			return s.repo.ExpireLapsed(ctx)
+		},
+	})
+}
+
 func (s *reservationsService) runPurge(ctx context.Context) {
 	// We keep data for 7 days as discussed for audit/safety
 	count, err := s.repo.PurgeOldReservations(ctx, 7*24*time.Hour)
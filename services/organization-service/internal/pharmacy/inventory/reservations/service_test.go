@@ -0,0 +1,216 @@
+package reservations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"organization-service/internal/pharmacy/inventory/batches"
+)
+
+// fakeRepository holds one reservation and records what the service asks of it
+type fakeRepository struct {
+	Repository
+	res           *Reservation
+	reserved      int
+	settings      *Settings
+	openStockTake string
+	checkedInTx   *sql.Tx
+	status        ReservationStatus
+	saved         *Reservation
+}
+
+func (f *fakeRepository) Create(_ context.Context, res *Reservation) error {
+	f.saved = res
+	return nil
+}
+
+func (f *fakeRepository) GetByID(context.Context, uuid.UUID, uuid.UUID) (*Reservation, error) {
+	r := *f.res
+	return &r, nil
+}
+
+func (f *fakeRepository) Update(_ context.Context, res *Reservation) error {
+	f.saved = res
+	return nil
+}
+
+func (f *fakeRepository) GetReservedQuantity(context.Context, uuid.UUID, uuid.UUID) (int, error) {
+	return f.reserved, nil
+}
+
+func (f *fakeRepository) GetSettings(context.Context, uuid.UUID) (*Settings, error) {
+	return f.settings, nil
+}
+
+func (f *fakeRepository) GetForUpdate(context.Context, *sql.Tx, uuid.UUID, uuid.UUID) (*Reservation, error) {
+	r := *f.res
+	return &r, nil
+}
+
+func (f *fakeRepository) GetOpenStockTake(_ context.Context, tx *sql.Tx, _, _ uuid.UUID) (string, error) {
+	f.checkedInTx = tx
+	return f.openStockTake, nil
+}
+
+func (f *fakeRepository) UpdateStatus(_ context.Context, _ *sql.Tx, _, _ uuid.UUID, status ReservationStatus) error {
+	f.status = status
+	return nil
+}
+
+// fakeBatches records stock movements
+type fakeBatches struct {
+	batches.Repository
+	batch *batches.Batch
+	moves []batches.MovementDTO
+}
+
+func (f *fakeBatches) GetBatch(context.Context, uuid.UUID, uuid.UUID) (*batches.Batch, error) {
+	b := *f.batch
+	return &b, nil
+}
+
+func (f *fakeBatches) RecordMovement(_ context.Context, _ *sql.Tx, dto batches.MovementDTO) (int, error) {
+	f.moves = append(f.moves, dto)
+	return 0, nil
+}
+
+func TestConfirmTx(t *testing.T) {
+	pending := func(expiresIn time.Duration) *Reservation {
+		return &Reservation{ID: uuid.New(), ProductID: uuid.New(), BatchID: uuid.New(), Quantity: 4, Status: StatusPending, ExpiresAt: time.Now().Add(expiresIn)}
+	}
+	confirmed := pending(time.Hour)
+	confirmed.Status = StatusConfirmed
+
+	tests := []struct {
+		name      string
+		res       *Reservation
+		stockTake string
+		wantErr   bool
+	}{
+		{"live hold", pending(time.Hour), "", false},
+		{"already confirmed", confirmed, "", true},
+		{"lapsed hold", pending(-time.Minute), "", true},
+		{"batch under stock-take", pending(time.Hour), "ST/26-27/00003", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{res: tt.res, openStockTake: tt.stockTake}
+			batchRepo := &fakeBatches{}
+			svc := NewService(repo, batchRepo)
+			tx := &sql.Tx{}
+
+			err := svc.ConfirmTx(context.Background(), tx, uuid.New(), tt.res.ID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfirmTx() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.res.Status == StatusPending && !tt.res.ExpiresAt.Before(time.Now()) && repo.checkedInTx != tx {
+				t.Errorf("stock-take check ran outside the confirm transaction")
+			}
+			if tt.wantErr {
+				if len(batchRepo.moves) != 0 || repo.status != "" {
+					t.Errorf("failed confirm still moved stock (%v) or set status %q", batchRepo.moves, repo.status)
+				}
+				return
+			}
+			if len(batchRepo.moves) != 1 || batchRepo.moves[0].QuantityChange != -4 || batchRepo.moves[0].TransactionType != "SALE" {
+				t.Errorf("moves = %+v, want one SALE of -4", batchRepo.moves)
+			}
+			if repo.status != StatusConfirmed {
+				t.Errorf("status = %q, want %q", repo.status, StatusConfirmed)
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	today := time.Now().Truncate(24 * time.Hour)
+	batch := func(qty int, expiry time.Time) *batches.Batch {
+		return &batches.Batch{ID: uuid.New(), BatchNo: "B-17", ExpiryDate: expiry, QuantityAvailable: qty}
+	}
+
+	tests := []struct {
+		name      string
+		batch     *batches.Batch
+		reserved  int
+		settings  *Settings
+		stockTake string
+		qty       int
+		wantHold  time.Duration
+		wantErr   bool
+		wantShort bool
+	}{
+		{name: "default hold time", batch: batch(10, today.AddDate(1, 0, 0)), qty: 10, wantHold: DefaultHoldMinutes * time.Minute},
+		{name: "pharmacy hold time", batch: batch(10, today.AddDate(1, 0, 0)), settings: &Settings{HoldMinutes: 15}, qty: 2, wantHold: 15 * time.Minute},
+		{name: "expires today is still sellable", batch: batch(10, today), qty: 1, wantHold: DefaultHoldMinutes * time.Minute},
+		{name: "expired batch", batch: batch(10, today.AddDate(0, 0, -1)), qty: 1, wantErr: true},
+		{name: "stock held by other bills", batch: batch(10, today.AddDate(1, 0, 0)), reserved: 7, qty: 4, wantErr: true, wantShort: true},
+		{name: "batch under stock-take", batch: batch(10, today.AddDate(1, 0, 0)), stockTake: "ST/26-27/00003", qty: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{reserved: tt.reserved, settings: tt.settings, openStockTake: tt.stockTake}
+			svc := NewService(repo, &fakeBatches{batch: tt.batch})
+
+			start := time.Now()
+			res, err := svc.Reserve(context.Background(), uuid.New(), CreateReservationRequest{ProductID: uuid.New(), BatchID: tt.batch.ID, Quantity: tt.qty})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reserve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrInsufficientStock) != tt.wantShort {
+				t.Errorf("Reserve() error = %v, want insufficient stock %v", err, tt.wantShort)
+			}
+			if err != nil {
+				if repo.saved != nil {
+					t.Errorf("failed reservation was saved: %+v", repo.saved)
+				}
+				return
+			}
+			if res.Status != StatusPending || repo.saved != res {
+				t.Errorf("reservation = %+v, want a saved PENDING hold", res)
+			}
+			if hold := res.ExpiresAt.Sub(start); hold < tt.wantHold || hold > tt.wantHold+time.Second {
+				t.Errorf("hold = %s, want %s", hold, tt.wantHold)
+			}
+		})
+	}
+}
+
+func TestUpdateHeadroom(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    ReservationStatus
+		newQty    int
+		stockTake string
+		wantErr   bool
+	}{
+		{"shrink", StatusPending, 2, "", false},
+		{"grow into free stock", StatusPending, 7, "", false},
+		{"grow past free stock", StatusPending, 8, "", true},
+		{"shrink during a stock-take", StatusPending, 2, "ST/26-27/00003", false},
+		{"grow during a stock-take", StatusPending, 5, "ST/26-27/00003", true},
+		{"lapsed hold", StatusExpired, 2, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 10 in stock, 4 held by this bill and 3 by another
+			res := &Reservation{ID: uuid.New(), BatchID: uuid.New(), Quantity: 4, Status: tt.status}
+			repo := &fakeRepository{res: res, reserved: 7, openStockTake: tt.stockTake}
+			svc := NewService(repo, &fakeBatches{batch: &batches.Batch{QuantityAvailable: 10}})
+
+			err := svc.Update(context.Background(), uuid.New(), res.ID, UpdateReservationRequest{Quantity: tt.newQty})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (repo.saved == nil || repo.saved.Quantity != tt.newQty || !repo.saved.ExpiresAt.After(time.Now())) {
+				t.Errorf("saved = %+v, want quantity %d with a renewed hold", repo.saved, tt.newQty)
+			}
+		})
+	}
+}
@@ -29,6 +29,7 @@ const (
 type StockOut struct {
 	ID             uuid.UUID      `json:"id"`
 	PharmacyID     uuid.UUID      `json:"pharmacy_id"`
+	StockOutNo     string         `json:"stock_out_no"` // From the pharmacy's stock-out series: SO/26-27/00001
 	Status         StockOutStatus `json:"status"`
 	Type           StockOutType   `json:"type"`
 	Reason          string         `json:"reason"`
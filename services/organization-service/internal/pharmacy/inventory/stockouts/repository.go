@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"organization-service/internal/pharmacy/numbering"
+
 	"github.com/google/uuid"
 )
 
@@ -33,15 +35,22 @@ func (r *postgresRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
 }
 
 func (r *postgresRepository) CreateStockOut(ctx context.Context, tx *sql.Tx, stockOut *StockOut, items []StockOutItem) error {
-	// 1. Insert Master Record
+	// 1. Number the stock-out from the pharmacy's series
+	stockOutNo, err := numbering.Next(ctx, tx, stockOut.PharmacyID, numbering.DocStockOut, stockOut.CreatedAt)
+	if err != nil {
+		return err
+	}
+	stockOut.StockOutNo = stockOutNo
+
+	// 2. Insert Master Record
 	query := `
 		INSERT INTO inventory.stock_outs (
-			id, pharmacy_id, status, type, reason, destination_type, destination_name, destination_id,
+			id, pharmacy_id, stock_out_no, status, type, reason, destination_type, destination_name, destination_id,
 			total_loss_value, created_by_id, created_by_name, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
-	_, err := tx.ExecContext(ctx, query,
-		stockOut.ID, stockOut.PharmacyID, stockOut.Status, stockOut.Type, stockOut.Reason,
+	_, err = tx.ExecContext(ctx, query,
+		stockOut.ID, stockOut.PharmacyID, stockOut.StockOutNo, stockOut.Status, stockOut.Type, stockOut.Reason,
 		stockOut.DestinationType, stockOut.DestinationName, stockOut.DestinationID, stockOut.TotalLossValue,
 		stockOut.CreatedByID, stockOut.CreatedByName, stockOut.CreatedAt, stockOut.UpdatedAt,
 	)
@@ -49,7 +58,7 @@ func (r *postgresRepository) CreateStockOut(ctx context.Context, tx *sql.Tx, sto
 		return fmt.Errorf("failed to insert stock_out master: %w", err)
 	}
 
-	// 2. Insert Items & Update Batches
+	// 3. Insert Items & Update Batches
 	itemQuery := `
 		INSERT INTO inventory.stock_out_items (
 			id, stock_out_id, pharmacy_id, medicine_id, medicine_name, 
@@ -111,13 +120,13 @@ func (r *postgresRepository) CreateStockOut(ctx context.Context, tx *sql.Tx, sto
 
 func (r *postgresRepository) GetStockOutByID(ctx context.Context, pharmacyID, id uuid.UUID) (*StockOut, []StockOutItem, error) {
 	masterQuery := `
-		SELECT id, pharmacy_id, status, type, reason, destination_type, destination_name, destination_id, total_loss_value, created_by_id, created_by_name, created_at, updated_at
+		SELECT id, pharmacy_id, COALESCE(stock_out_no, ''), status, type, reason, destination_type, destination_name, destination_id, total_loss_value, created_by_id, created_by_name, created_at, updated_at
 		FROM inventory.stock_outs
 		WHERE id = $1 AND pharmacy_id = $2
 	`
 	var so StockOut
 	err := r.db.QueryRowContext(ctx, masterQuery, id, pharmacyID).Scan(
-		&so.ID, &so.PharmacyID, &so.Status, &so.Type, &so.Reason, &so.DestinationType, &so.DestinationName, &so.DestinationID,
+		&so.ID, &so.PharmacyID, &so.StockOutNo, &so.Status, &so.Type, &so.Reason, &so.DestinationType, &so.DestinationName, &so.DestinationID,
 		&so.TotalLossValue, &so.CreatedByID, &so.CreatedByName, &so.CreatedAt, &so.UpdatedAt,
 	)
 	if err != nil {
@@ -161,7 +170,7 @@ func (r *postgresRepository) ListStockOuts(ctx context.Context, pharmacyID uuid.
 	}
 
 	query := `
-		SELECT id, pharmacy_id, status, type, reason, destination_type, destination_name, total_loss_value, created_by_id, created_by_name, created_at, updated_at
+		SELECT id, pharmacy_id, COALESCE(stock_out_no, ''), status, type, reason, destination_type, destination_name, total_loss_value, created_by_id, created_by_name, created_at, updated_at
 		FROM inventory.stock_outs
 		WHERE pharmacy_id = $1
 		ORDER BY created_at DESC
@@ -177,7 +186,7 @@ func (r *postgresRepository) ListStockOuts(ctx context.Context, pharmacyID uuid.
 	for rows.Next() {
 		var so StockOut
 		err := rows.Scan(
-			&so.ID, &so.PharmacyID, &so.Status, &so.Type, &so.Reason, &so.DestinationType, &so.DestinationName,
+			&so.ID, &so.PharmacyID, &so.StockOutNo, &so.Status, &so.Type, &so.Reason, &so.DestinationType, &so.DestinationName,
 			&so.TotalLossValue, &so.CreatedByID, &so.CreatedByName, &so.CreatedAt, &so.UpdatedAt,
 		)
 		if err != nil {
@@ -28,6 +28,11 @@ func (s *service) CreateStockOut(ctx context.Context, pharmacyID, userID uuid.UU
 	stockOutID := uuid.New()
 	now := time.Now().UTC()
 
+	// Pharmacy-to-pharmacy moves are tracked in transit and received at the other end
+	if req.Type == TypeTransfer && req.DestinationType == "PHARMACY" {
+		return nil, fmt.Errorf("transfers to another pharmacy must be dispatched as a stock transfer (/pharmacy/inventory/transfers)")
+	}
+
 	var items []StockOutItem
 	var totalLossValue float64
 
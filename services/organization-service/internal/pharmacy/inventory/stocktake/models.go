@@ -0,0 +1,227 @@
+package stocktake
+
+import (
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusInProgress  Status = "IN_PROGRESS"
+	StatusUnderReview Status = "UNDER_REVIEW"
+	StatusPosted      Status = "POSTED"
+	StatusCancelled   Status = "CANCELLED"
+)
+
+// Scope limits which batches a session counts
+type Scope string
+
+const (
+	ScopeAll      Scope = "ALL"
+	ScopeRack     Scope = "RACK"
+	ScopeCategory Scope = "CATEGORY"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewPending  ReviewStatus = "PENDING"
+	ReviewApproved ReviewStatus = "APPROVED"
+	ReviewRejected ReviewStatus = "REJECTED"
+)
+
+// CountMode says whether a count replaces the line quantity or adds to it
+type CountMode string
+
+const (
+	CountSet CountMode = "SET"
+	CountAdd CountMode = "ADD"
+)
+
+type Session struct {
+	ID            uuid.UUID  `json:"id"`
+	PharmacyID    uuid.UUID  `json:"pharmacy_id"`
+	SessionNo     string     `json:"session_no"`
+	Name          string     `json:"name"`
+	Scope         Scope      `json:"scope"`
+	ScopeValues   []string   `json:"scope_values"`
+	Status        Status     `json:"status"`
+	Notes         string     `json:"notes"`
+	StartedBy     uuid.UUID  `json:"started_by"`
+	StartedByName string     `json:"started_by_name"`
+	StartedAt     time.Time  `json:"started_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	PostedBy      *uuid.UUID `json:"posted_by,omitempty"`
+	PostedByName  string     `json:"posted_by_name,omitempty"`
+	PostedAt      *time.Time `json:"posted_at,omitempty"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty"`
+	CancelReason  string     `json:"cancel_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	TotalLines    int `json:"total_lines"`
+	CountedLines  int `json:"counted_lines"`
+	VarianceLines int `json:"variance_lines"`
+
+	Items []Item `json:"items,omitempty"`
+}
+
+// Item is one batch of the session with its frozen system quantity
+type Item struct {
+	ID                uuid.UUID    `json:"id"`
+	SessionID         uuid.UUID    `json:"session_id"`
+	MedicineID        uuid.UUID    `json:"medicine_id"`
+	BatchID           uuid.UUID    `json:"batch_id"`
+	MedicineName      string       `json:"medicine_name"`
+	Category          string       `json:"category"`
+	Barcode           string       `json:"barcode,omitempty"`
+	BatchNo           string       `json:"batch_no"`
+	RackNo            string       `json:"rack_no"`
+	ExpiryDate        *time.Time   `json:"expiry_date,omitempty"`
+	UnitCost          float64      `json:"unit_cost"`
+	MRP               float64      `json:"mrp"`
+	SystemQty         int          `json:"system_qty"`
+	CountedQty        *int         `json:"counted_qty"`
+	Variance          *int         `json:"variance"`
+	VarianceValue     float64      `json:"variance_value"`
+	LastCountedBy     *uuid.UUID   `json:"last_counted_by,omitempty"`
+	LastCountedByName string       `json:"last_counted_by_name,omitempty"`
+	LastCountedAt     *time.Time   `json:"last_counted_at,omitempty"`
+	ReviewStatus      ReviewStatus `json:"review_status"`
+	ReviewReason      string       `json:"review_reason,omitempty"`
+	PostedQty         int          `json:"posted_qty"`
+}
+
+// computeVariance fills Variance and VarianceValue (at cost) once the line is counted
+func (i *Item) computeVariance() {
+	if i.CountedQty == nil {
+		i.Variance = nil
+		i.VarianceValue = 0
+		return
+	}
+	v := *i.CountedQty - i.SystemQty
+	i.Variance = &v
+	i.VarianceValue = money.Round2(float64(v) * i.UnitCost)
+}
+
+type CountEntry struct {
+	ID              uuid.UUID `json:"id"`
+	ItemID          uuid.UUID `json:"item_id"`
+	Mode            CountMode `json:"mode"`
+	Quantity        int       `json:"quantity"`
+	CountedQtyAfter int       `json:"counted_qty_after"`
+	Source          string    `json:"source"`
+	CountedBy       uuid.UUID `json:"counted_by"`
+	CountedByName   string    `json:"counted_by_name"`
+	CountedAt       time.Time `json:"counted_at"`
+}
+
+// ValuationReport summarises the stock value impact of a session at cost
+type ValuationReport struct {
+	SessionID      uuid.UUID        `json:"session_id"`
+	SessionNo      string           `json:"session_no"`
+	Status         Status           `json:"status"`
+	TotalLines     int              `json:"total_lines"`
+	CountedLines   int              `json:"counted_lines"`
+	UncountedLines int              `json:"uncounted_lines"`
+	Summary        ValuationTotals  `json:"summary"`
+	ByCategory     []ValuationGroup `json:"by_category"`
+	ByRack         []ValuationGroup `json:"by_rack"`
+	TopVariances   []Item           `json:"top_variances"`
+}
+
+type ValuationTotals struct {
+	SystemValue   float64 `json:"system_value"`
+	CountedValue  float64 `json:"counted_value"`
+	ShortageQty   int     `json:"shortage_qty"`
+	ShortageValue float64 `json:"shortage_value"`
+	ExcessQty     int     `json:"excess_qty"`
+	ExcessValue   float64 `json:"excess_value"`
+	NetValue      float64 `json:"net_value"`
+	// PostedValue is the net value of approved variances written to the ledger
+	PostedValue float64 `json:"posted_value"`
+}
+
+func (t *ValuationTotals) add(item Item) {
+	t.SystemValue += float64(item.SystemQty) * item.UnitCost
+	if item.CountedQty == nil {
+		return
+	}
+	t.CountedValue += float64(*item.CountedQty) * item.UnitCost
+	v := *item.Variance
+	if v < 0 {
+		t.ShortageQty += -v
+		t.ShortageValue += float64(-v) * item.UnitCost
+	} else {
+		t.ExcessQty += v
+		t.ExcessValue += float64(v) * item.UnitCost
+	}
+	t.NetValue += item.VarianceValue
+	t.PostedValue += float64(item.PostedQty) * item.UnitCost
+}
+
+func (t *ValuationTotals) round() {
+	t.SystemValue = money.Round2(t.SystemValue)
+	t.CountedValue = money.Round2(t.CountedValue)
+	t.ShortageValue = money.Round2(t.ShortageValue)
+	t.ExcessValue = money.Round2(t.ExcessValue)
+	t.NetValue = money.Round2(t.NetValue)
+	t.PostedValue = money.Round2(t.PostedValue)
+}
+
+type ValuationGroup struct {
+	Key string `json:"key"`
+	ValuationTotals
+}
+
+// Request Structs
+
+type StartSessionRequest struct {
+	Name        string   `json:"name" validate:"max=255"`
+	Scope       Scope    `json:"scope" validate:"required,oneof=ALL RACK CATEGORY"`
+	ScopeValues []string `json:"scope_values" validate:"required_unless=Scope ALL,dive,required,max=100"`
+	Notes       string   `json:"notes" validate:"max=500"`
+}
+
+type CountRequest struct {
+	Mode     CountMode `json:"mode" validate:"required,oneof=SET ADD"`
+	Quantity int       `json:"quantity" validate:"gte=0"`
+}
+
+// ScanRequest adds Quantity (default 1) to the line whose medicine barcode matches;
+// BatchNo picks the batch when the medicine has more than one in the session
+type ScanRequest struct {
+	Barcode  string `json:"barcode" validate:"required,max=100"`
+	BatchNo  string `json:"batch_no" validate:"max=100"`
+	Quantity int    `json:"quantity" validate:"gte=0"`
+}
+
+// ReviewRequest approves or rejects variance lines before posting.
+// ApproveAll approves every counted line that is still pending.
+type ReviewRequest struct {
+	ApproveAll bool         `json:"approve_all"`
+	Items      []ReviewItem `json:"items" validate:"omitempty,dive"`
+}
+
+type ReviewItem struct {
+	ItemID   uuid.UUID    `json:"item_id" validate:"required"`
+	Decision ReviewStatus `json:"decision" validate:"required,oneof=APPROVED REJECTED"`
+	Reason   string       `json:"reason" validate:"max=500"`
+}
+
+type CancelSessionRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// ItemFilter narrows the lines returned with a session, e.g. one rack for one counter
+type ItemFilter struct {
+	RackNo   string
+	Category string
+	// State is one of counted, uncounted or variance
+	State  string
+	Search string
+}
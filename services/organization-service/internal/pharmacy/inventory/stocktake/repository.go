@@ -0,0 +1,424 @@
+package stocktake
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+	// Insert allocates the session number and snapshots every in-scope batch.
+	// It fails when a batch in scope is already part of another open session.
+	Insert(ctx context.Context, tx *sql.Tx, s *Session) error
+	GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Session, error)
+	// Lock locks the session row inside tx; shared locks let counters work in parallel
+	Lock(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID, shared bool) (*Session, error)
+	UpdateHeader(ctx context.Context, tx *sql.Tx, s *Session) error
+	List(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Session, int, error)
+
+	ListItems(ctx context.Context, sessionID uuid.UUID, filter ItemFilter) ([]Item, error)
+	ListItemsTx(ctx context.Context, tx *sql.Tx, sessionID uuid.UUID) ([]Item, error)
+	GetItem(ctx context.Context, sessionID, itemID uuid.UUID) (*Item, error)
+	FindItemsByBarcode(ctx context.Context, sessionID uuid.UUID, barcode, batchNo string) ([]Item, error)
+	// ApplyCount sets or adds to the counted quantity and keeps the entry for audit
+	ApplyCount(ctx context.Context, tx *sql.Tx, entry *CountEntry, sessionID uuid.UUID) error
+	ListCounts(ctx context.Context, sessionID, itemID uuid.UUID) ([]CountEntry, error)
+	SetReview(ctx context.Context, tx *sql.Tx, sessionID, itemID uuid.UUID, status ReviewStatus, reason string) error
+	ApprovePending(ctx context.Context, tx *sql.Tx, sessionID uuid.UUID) (int64, error)
+	SetPostedQty(ctx context.Context, tx *sql.Tx, itemID uuid.UUID, qty int) error
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
+func (r *postgresRepository) Insert(ctx context.Context, tx *sql.Tx, s *Session) error {
+	// Serialise session starts per pharmacy so two sessions cannot freeze the same batch
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "stock_take:"+s.PharmacyID.String()); err != nil {
+		return fmt.Errorf("failed to lock stock-take sessions: %w", err)
+	}
+
+	// $1 is the pharmacy and $2 the session; the scope values follow as $3
+	scopeFilter := ""
+	args := []interface{}{s.PharmacyID, s.ID}
+	switch s.Scope {
+	case ScopeRack:
+		scopeFilter = " AND LOWER(COALESCE(b.rack_no, '')) = ANY($3)"
+	case ScopeCategory:
+		scopeFilter = " AND LOWER(COALESCE(m.category, '')) = ANY($3)"
+	}
+	if scopeFilter != "" {
+		values := make([]string, len(s.ScopeValues))
+		for i, v := range s.ScopeValues {
+			values[i] = strings.ToLower(strings.TrimSpace(v))
+		}
+		args = append(args, pq.Array(values))
+	}
+
+	var busy int
+	var busySession string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(MIN(ss.session_no), '')
+		FROM inventory.batches b
+		JOIN inventory.medicines m ON m.id = b.medicine_id
+		JOIN inventory.stock_take_items si ON si.batch_id = b.id
+		JOIN inventory.stock_take_sessions ss ON ss.id = si.session_id AND ss.status IN ('IN_PROGRESS', 'UNDER_REVIEW')
+		WHERE b.pharmacy_id = $1 AND b.quantity_available > 0 AND ss.id <> $2`+scopeFilter,
+		args...).Scan(&busy, &busySession); err != nil {
+		return fmt.Errorf("failed to check open sessions: %w", err)
+	}
+	if busy > 0 {
+		return fmt.Errorf("%d batches in scope are already being counted in %s", busy, busySession)
+	}
+
+	// Session numbers come from the pharmacy's stock-take series: ST/26-27/00001
+	sessionNo, err := numbering.Next(ctx, tx, s.PharmacyID, numbering.DocStockTake, s.StartedAt)
+	if err != nil {
+		return err
+	}
+	s.SessionNo = sessionNo
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.stock_take_sessions (
+			id, pharmacy_id, session_no, name, scope, scope_values, status, notes,
+			started_by, started_by_name, started_at, created_at, updated_at
+		) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, NULLIF($8, ''), $9, $10, $11, $12, $13)
+	`, s.ID, s.PharmacyID, s.SessionNo, s.Name, s.Scope, pq.Array(s.ScopeValues), s.Status, s.Notes,
+		s.StartedBy, s.StartedByName, s.StartedAt, s.CreatedAt, s.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert stock-take session: %w", err)
+	}
+
+	// FOR SHARE waits out sales confirming from these batches and blocks new
+	// ones until the session commits, so system_qty matches what is on the shelf
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.stock_take_items (
+			id, session_id, pharmacy_id, medicine_id, batch_id, medicine_name, category, barcode,
+			batch_no, rack_no, expiry_date, unit_cost, mrp, system_qty
+		)
+		SELECT gen_random_uuid(), $2, b.pharmacy_id, b.medicine_id, b.id, m.name, m.category, NULLIF(m.barcode, ''),
+		       b.batch_no, NULLIF(b.rack_no, ''), b.expiry_date, COALESCE(b.cost_price, 0), COALESCE(b.mrp, 0), b.quantity_available
+		FROM inventory.batches b
+		JOIN inventory.medicines m ON m.id = b.medicine_id
+		WHERE b.pharmacy_id = $1 AND b.quantity_available > 0`+scopeFilter+`
+		FOR SHARE OF b`,
+		args...)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot batches: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("no batches with stock found in the selected scope")
+	}
+	return nil
+}
+
+const selectSession = `
+	SELECT s.id, s.pharmacy_id, s.session_no, COALESCE(s.name, ''), s.scope, s.scope_values, s.status, COALESCE(s.notes, ''),
+	       s.started_by, COALESCE(s.started_by_name, ''), s.started_at, s.completed_at,
+	       s.posted_by, COALESCE(s.posted_by_name, ''), s.posted_at, s.cancelled_at, COALESCE(s.cancel_reason, ''),
+	       s.created_at, s.updated_at,
+	       (SELECT COUNT(*) FROM inventory.stock_take_items i WHERE i.session_id = s.id),
+	       (SELECT COUNT(*) FROM inventory.stock_take_items i WHERE i.session_id = s.id AND i.counted_qty IS NOT NULL),
+	       (SELECT COUNT(*) FROM inventory.stock_take_items i WHERE i.session_id = s.id AND i.counted_qty <> i.system_qty)
+	FROM inventory.stock_take_sessions s
+`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var s Session
+	var startedBy, postedBy uuid.NullUUID
+	var completedAt, postedAt, cancelledAt sql.NullTime
+	var scopeValues pq.StringArray
+	if err := row.Scan(
+		&s.ID, &s.PharmacyID, &s.SessionNo, &s.Name, &s.Scope, &scopeValues, &s.Status, &s.Notes,
+		&startedBy, &s.StartedByName, &s.StartedAt, &completedAt,
+		&postedBy, &s.PostedByName, &postedAt, &cancelledAt, &s.CancelReason,
+		&s.CreatedAt, &s.UpdatedAt,
+		&s.TotalLines, &s.CountedLines, &s.VarianceLines,
+	); err != nil {
+		return nil, err
+	}
+	s.ScopeValues = []string(scopeValues)
+	s.StartedBy = startedBy.UUID
+	if completedAt.Valid {
+		s.CompletedAt = &completedAt.Time
+	}
+	if postedBy.Valid {
+		s.PostedBy = &postedBy.UUID
+	}
+	if postedAt.Valid {
+		s.PostedAt = &postedAt.Time
+	}
+	if cancelledAt.Valid {
+		s.CancelledAt = &cancelledAt.Time
+	}
+	return &s, nil
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Session, error) {
+	s, err := scanSession(r.db.QueryRowContext(ctx, selectSession+" WHERE s.id = $1 AND s.pharmacy_id = $2", id, pharmacyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("stock-take session not found")
+	}
+	return s, err
+}
+
+func (r *postgresRepository) Lock(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID, shared bool) (*Session, error) {
+	lock := "FOR UPDATE"
+	if shared {
+		lock = "FOR SHARE"
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM inventory.stock_take_sessions WHERE id = $1 AND pharmacy_id = $2 `+lock, id, pharmacyID); err != nil {
+		return nil, fmt.Errorf("failed to lock stock-take session: %w", err)
+	}
+	s, err := scanSession(tx.QueryRowContext(ctx, selectSession+" WHERE s.id = $1 AND s.pharmacy_id = $2", id, pharmacyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("stock-take session not found")
+	}
+	return s, err
+}
+
+func (r *postgresRepository) UpdateHeader(ctx context.Context, tx *sql.Tx, s *Session) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE inventory.stock_take_sessions SET
+			status = $1, completed_at = $2, posted_by = $3, posted_by_name = NULLIF($4, ''), posted_at = $5,
+			cancelled_at = $6, cancel_reason = NULLIF($7, ''), updated_at = $8
+		WHERE id = $9
+	`, s.Status, s.CompletedAt, s.PostedBy, s.PostedByName, s.PostedAt,
+		s.CancelledAt, s.CancelReason, s.UpdatedAt, s.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update stock-take session: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) List(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Session, int, error) {
+	where := " WHERE s.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND s.status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.stock_take_sessions s"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, selectSession+where+fmt.Sprintf(" ORDER BY s.started_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, total, rows.Err()
+}
+
+const selectItem = `
+	SELECT id, session_id, medicine_id, batch_id, medicine_name, COALESCE(category, ''), COALESCE(barcode, ''),
+	       batch_no, COALESCE(rack_no, ''), expiry_date, unit_cost, mrp, system_qty, counted_qty,
+	       last_counted_by, COALESCE(last_counted_by_name, ''), last_counted_at,
+	       review_status, COALESCE(review_reason, ''), posted_qty
+	FROM inventory.stock_take_items
+`
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryItems(ctx context.Context, q queryer, query string, args ...interface{}) ([]Item, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		var i Item
+		var expiry, countedAt sql.NullTime
+		var counted sql.NullInt64
+		var countedBy uuid.NullUUID
+		if err := rows.Scan(
+			&i.ID, &i.SessionID, &i.MedicineID, &i.BatchID, &i.MedicineName, &i.Category, &i.Barcode,
+			&i.BatchNo, &i.RackNo, &expiry, &i.UnitCost, &i.MRP, &i.SystemQty, &counted,
+			&countedBy, &i.LastCountedByName, &countedAt,
+			&i.ReviewStatus, &i.ReviewReason, &i.PostedQty,
+		); err != nil {
+			return nil, err
+		}
+		if expiry.Valid {
+			i.ExpiryDate = &expiry.Time
+		}
+		if counted.Valid {
+			c := int(counted.Int64)
+			i.CountedQty = &c
+		}
+		if countedBy.Valid {
+			i.LastCountedBy = &countedBy.UUID
+		}
+		if countedAt.Valid {
+			i.LastCountedAt = &countedAt.Time
+		}
+		i.computeVariance()
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func (r *postgresRepository) ListItems(ctx context.Context, sessionID uuid.UUID, filter ItemFilter) ([]Item, error) {
+	where := " WHERE session_id = $1"
+	args := []interface{}{sessionID}
+	if filter.RackNo != "" {
+		args = append(args, filter.RackNo)
+		where += fmt.Sprintf(" AND LOWER(COALESCE(rack_no, '')) = LOWER($%d)", len(args))
+	}
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		where += fmt.Sprintf(" AND LOWER(COALESCE(category, '')) = LOWER($%d)", len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		where += fmt.Sprintf(" AND (medicine_name ILIKE $%d OR batch_no ILIKE $%d OR barcode ILIKE $%d)", len(args), len(args), len(args))
+	}
+	switch filter.State {
+	case "counted":
+		where += " AND counted_qty IS NOT NULL"
+	case "uncounted":
+		where += " AND counted_qty IS NULL"
+	case "variance":
+		where += " AND counted_qty <> system_qty"
+	}
+	return queryItems(ctx, r.db, selectItem+where+" ORDER BY rack_no NULLS LAST, medicine_name, expiry_date", args...)
+}
+
+func (r *postgresRepository) ListItemsTx(ctx context.Context, tx *sql.Tx, sessionID uuid.UUID) ([]Item, error) {
+	return queryItems(ctx, tx, selectItem+" WHERE session_id = $1 ORDER BY medicine_name, expiry_date", sessionID)
+}
+
+func (r *postgresRepository) GetItem(ctx context.Context, sessionID, itemID uuid.UUID) (*Item, error) {
+	items, err := queryItems(ctx, r.db, selectItem+" WHERE session_id = $1 AND id = $2", sessionID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("stock-take line not found")
+	}
+	return &items[0], nil
+}
+
+func (r *postgresRepository) FindItemsByBarcode(ctx context.Context, sessionID uuid.UUID, barcode, batchNo string) ([]Item, error) {
+	query := selectItem + " WHERE session_id = $1 AND barcode = $2"
+	args := []interface{}{sessionID, barcode}
+	if batchNo != "" {
+		args = append(args, batchNo)
+		query += " AND LOWER(batch_no) = LOWER($3)"
+	}
+	return queryItems(ctx, r.db, query+" ORDER BY expiry_date", args...)
+}
+
+func (r *postgresRepository) ApplyCount(ctx context.Context, tx *sql.Tx, entry *CountEntry, sessionID uuid.UUID) error {
+	// A recount sends the line back for review
+	err := tx.QueryRowContext(ctx, `
+		UPDATE inventory.stock_take_items SET
+			counted_qty = CASE WHEN $1 = 'SET' THEN $2 ELSE COALESCE(counted_qty, 0) + $2 END,
+			last_counted_by = $3, last_counted_by_name = $4, last_counted_at = $5,
+			review_status = 'PENDING', review_reason = NULL
+		WHERE id = $6 AND session_id = $7
+		RETURNING counted_qty
+	`, string(entry.Mode), entry.Quantity, entry.CountedBy, entry.CountedByName, entry.CountedAt, entry.ItemID, sessionID).Scan(&entry.CountedQtyAfter)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("stock-take line not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record count: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.stock_take_counts (
+			id, session_id, item_id, mode, quantity, counted_qty_after, source, counted_by, counted_by_name, counted_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, entry.ID, sessionID, entry.ItemID, entry.Mode, entry.Quantity, entry.CountedQtyAfter, entry.Source,
+		entry.CountedBy, entry.CountedByName, entry.CountedAt); err != nil {
+		return fmt.Errorf("failed to record count entry: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListCounts(ctx context.Context, sessionID, itemID uuid.UUID) ([]CountEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, item_id, mode, quantity, counted_qty_after, source, counted_by, COALESCE(counted_by_name, ''), counted_at
+		FROM inventory.stock_take_counts
+		WHERE session_id = $1 AND item_id = $2
+		ORDER BY counted_at DESC
+	`, sessionID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []CountEntry{}
+	for rows.Next() {
+		var e CountEntry
+		var countedBy uuid.NullUUID
+		if err := rows.Scan(&e.ID, &e.ItemID, &e.Mode, &e.Quantity, &e.CountedQtyAfter, &e.Source, &countedBy, &e.CountedByName, &e.CountedAt); err != nil {
+			return nil, err
+		}
+		e.CountedBy = countedBy.UUID
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *postgresRepository) SetReview(ctx context.Context, tx *sql.Tx, sessionID, itemID uuid.UUID, status ReviewStatus, reason string) error {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE inventory.stock_take_items SET review_status = $1, review_reason = NULLIF($2, '')
+		WHERE id = $3 AND session_id = $4 AND counted_qty IS NOT NULL
+	`, status, reason, itemID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to review line: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("stock-take line %s not found or not counted yet", itemID)
+	}
+	return nil
+}
+
+func (r *postgresRepository) ApprovePending(ctx context.Context, tx *sql.Tx, sessionID uuid.UUID) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE inventory.stock_take_items SET review_status = 'APPROVED'
+		WHERE session_id = $1 AND counted_qty IS NOT NULL AND review_status = 'PENDING'
+	`, sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to approve lines: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (r *postgresRepository) SetPostedQty(ctx context.Context, tx *sql.Tx, itemID uuid.UUID, qty int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE inventory.stock_take_items SET posted_qty = $1 WHERE id = $2`, qty, itemID)
+	return err
+}
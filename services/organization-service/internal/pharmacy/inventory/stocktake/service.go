@@ -0,0 +1,445 @@
+package stocktake
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"organization-service/internal/pharmacy/inventory/batches"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	// Start freezes the in-scope batches and snapshots their system quantity
+	Start(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req StartSessionRequest) (*Session, error)
+	Get(ctx context.Context, pharmacyID, id uuid.UUID, filter ItemFilter) (*Session, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Session, int, error)
+	Count(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id, itemID uuid.UUID, req CountRequest) (*Item, error)
+	Scan(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ScanRequest) (*Item, error)
+	GetItemHistory(ctx context.Context, pharmacyID, id, itemID uuid.UUID) ([]CountEntry, error)
+	// Complete closes counting and moves the session to review
+	Complete(ctx context.Context, pharmacyID, id uuid.UUID) (*Session, error)
+	// Reopen sends a session under review back to counting, e.g. to recount rejected lines
+	Reopen(ctx context.Context, pharmacyID, id uuid.UUID) (*Session, error)
+	Review(ctx context.Context, pharmacyID, id uuid.UUID, req ReviewRequest) (*Session, error)
+	// Post writes approved variances to the stock ledger and releases the batches
+	Post(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID) (*Session, error)
+	Cancel(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*Session, error)
+	GetValuationReport(ctx context.Context, pharmacyID, id uuid.UUID) (*ValuationReport, error)
+}
+
+type service struct {
+	repo      Repository
+	batchRepo batches.Repository
+}
+
+func NewService(repo Repository, batchRepo batches.Repository) Service {
+	return &service{
+		repo:      repo,
+		batchRepo: batchRepo,
+	}
+}
+
+func (s *service) Start(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req StartSessionRequest) (*Session, error) {
+	if req.Scope == ScopeAll {
+		req.ScopeValues = nil
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:            uuid.New(),
+		PharmacyID:    pharmacyID,
+		Name:          req.Name,
+		Scope:         req.Scope,
+		ScopeValues:   req.ScopeValues,
+		Status:        StatusInProgress,
+		Notes:         req.Notes,
+		StartedBy:     userID,
+		StartedByName: userName,
+		StartedAt:     now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if session.ScopeValues == nil {
+		session.ScopeValues = []string{}
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.repo.Insert(ctx, tx, session); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByID(ctx, pharmacyID, session.ID)
+}
+
+func (s *service) Get(ctx context.Context, pharmacyID, id uuid.UUID, filter ItemFilter) (*Session, error) {
+	session, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Items, err = s.repo.ListItems(ctx, id, filter); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *service) List(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Session, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	return s.repo.List(ctx, pharmacyID, status, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) Count(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id, itemID uuid.UUID, req CountRequest) (*Item, error) {
+	if req.Mode == CountAdd && req.Quantity == 0 {
+		return nil, fmt.Errorf("quantity must be greater than zero when adding to a count")
+	}
+	return s.applyCount(ctx, pharmacyID, userID, userName, id, itemID, req.Mode, req.Quantity, "MANUAL")
+}
+
+func (s *service) Scan(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ScanRequest) (*Item, error) {
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	if _, err := s.repo.GetByID(ctx, pharmacyID, id); err != nil {
+		return nil, err
+	}
+	matches, err := s.repo.FindItemsByBarcode(ctx, id, strings.TrimSpace(req.Barcode), strings.TrimSpace(req.BatchNo))
+	if err != nil {
+		return nil, err
+	}
+	switch len(matches) {
+	case 0:
+		if req.BatchNo != "" {
+			return nil, fmt.Errorf("no line in this session for barcode %s and batch %s", req.Barcode, req.BatchNo)
+		}
+		return nil, fmt.Errorf("no line in this session for barcode %s", req.Barcode)
+	case 1:
+		return s.applyCount(ctx, pharmacyID, userID, userName, id, matches[0].ID, CountAdd, req.Quantity, "SCAN")
+	default:
+		batchNos := make([]string, len(matches))
+		for i, m := range matches {
+			batchNos[i] = m.BatchNo
+		}
+		return nil, fmt.Errorf("barcode %s matches several batches (%s); pass batch_no", req.Barcode, strings.Join(batchNos, ", "))
+	}
+}
+
+func (s *service) applyCount(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id, itemID uuid.UUID, mode CountMode, qty int, source string) (*Item, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := s.repo.Lock(ctx, tx, pharmacyID, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != StatusInProgress {
+		return nil, fmt.Errorf("counting is closed: session is %s", session.Status)
+	}
+
+	entry := &CountEntry{
+		ID:            uuid.New(),
+		ItemID:        itemID,
+		Mode:          mode,
+		Quantity:      qty,
+		Source:        source,
+		CountedBy:     userID,
+		CountedByName: userName,
+		CountedAt:     time.Now(),
+	}
+	if err := s.repo.ApplyCount(ctx, tx, entry, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetItem(ctx, id, itemID)
+}
+
+func (s *service) GetItemHistory(ctx context.Context, pharmacyID, id, itemID uuid.UUID) ([]CountEntry, error) {
+	if _, err := s.repo.GetByID(ctx, pharmacyID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListCounts(ctx, id, itemID)
+}
+
+func (s *service) Complete(ctx context.Context, pharmacyID, id uuid.UUID) (*Session, error) {
+	return s.transition(ctx, pharmacyID, id, StatusInProgress, func(session *Session) error {
+		if session.CountedLines == 0 {
+			return fmt.Errorf("nothing has been counted yet")
+		}
+		now := time.Now()
+		session.Status = StatusUnderReview
+		session.CompletedAt = &now
+		return nil
+	})
+}
+
+func (s *service) Reopen(ctx context.Context, pharmacyID, id uuid.UUID) (*Session, error) {
+	return s.transition(ctx, pharmacyID, id, StatusUnderReview, func(session *Session) error {
+		session.Status = StatusInProgress
+		session.CompletedAt = nil
+		return nil
+	})
+}
+
+func (s *service) Cancel(ctx context.Context, pharmacyID, id uuid.UUID, reason string) (*Session, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := s.repo.Lock(ctx, tx, pharmacyID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != StatusInProgress && session.Status != StatusUnderReview {
+		return nil, fmt.Errorf("cannot cancel a session that is %s", session.Status)
+	}
+
+	now := time.Now()
+	session.Status = StatusCancelled
+	session.CancelledAt = &now
+	session.CancelReason = reason
+	session.UpdatedAt = now
+	if err := s.repo.UpdateHeader(ctx, tx, session); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+// transition locks the session, checks it is in the expected status and saves the change made by apply
+func (s *service) transition(ctx context.Context, pharmacyID, id uuid.UUID, from Status, apply func(*Session) error) (*Session, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := s.repo.Lock(ctx, tx, pharmacyID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != from {
+		return nil, fmt.Errorf("session is %s, expected %s", session.Status, from)
+	}
+	if err := apply(session); err != nil {
+		return nil, err
+	}
+	session.UpdatedAt = time.Now()
+	if err := s.repo.UpdateHeader(ctx, tx, session); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) Review(ctx context.Context, pharmacyID, id uuid.UUID, req ReviewRequest) (*Session, error) {
+	if !req.ApproveAll && len(req.Items) == 0 {
+		return nil, fmt.Errorf("nothing to review: pass items or approve_all")
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := s.repo.Lock(ctx, tx, pharmacyID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != StatusUnderReview {
+		return nil, fmt.Errorf("session must be completed before review (currently %s)", session.Status)
+	}
+
+	for _, item := range req.Items {
+		if item.Decision == ReviewRejected && strings.TrimSpace(item.Reason) == "" {
+			return nil, fmt.Errorf("a reason is required to reject line %s", item.ItemID)
+		}
+		if err := s.repo.SetReview(ctx, tx, id, item.ItemID, item.Decision, item.Reason); err != nil {
+			return nil, err
+		}
+	}
+	if req.ApproveAll {
+		if _, err := s.repo.ApprovePending(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, pharmacyID, id, ItemFilter{})
+}
+
+func (s *service) Post(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID) (*Session, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session, err := s.repo.Lock(ctx, tx, pharmacyID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != StatusUnderReview {
+		return nil, fmt.Errorf("only a completed session can be posted (currently %s)", session.Status)
+	}
+
+	items, err := s.repo.ListItemsTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, item := range items {
+		if item.CountedQty != nil && item.ReviewStatus == ReviewPending {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("%d counted lines are still pending review", pending)
+	}
+
+	// Variances are posted against the frozen snapshot so movements that are not
+	// blocked during the count (e.g. stock-in to the same batch) are preserved.
+	// Uncounted and rejected lines leave the batch untouched.
+	now := time.Now()
+	for _, item := range items {
+		if item.ReviewStatus != ReviewApproved || item.Variance == nil || *item.Variance == 0 {
+			continue
+		}
+		note := fmt.Sprintf("Stock-take %s: system %d, counted %d", session.SessionNo, item.SystemQty, *item.CountedQty)
+		if _, err := s.batchRepo.RecordMovement(ctx, tx, batches.MovementDTO{
+			PharmacyID:      pharmacyID,
+			MedicineID:      item.MedicineID,
+			BatchID:         item.BatchID,
+			QuantityChange:  *item.Variance,
+			TransactionType: "ADJUSTMENT",
+			ReferenceType:   "STOCK_TAKE",
+			ReferenceID:     &session.ID,
+			PerformedBy:     &userID,
+			Notes:           note,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to post variance for %s (%s): %w", item.MedicineName, item.BatchNo, err)
+		}
+		if err := s.batchRepo.CreateBatchLog(ctx, tx, batches.BatchAuditLog{
+			ID:            uuid.New(),
+			PharmacyID:    pharmacyID,
+			BatchID:       item.BatchID,
+			ActionType:    "STOCK_ADJUSTMENT",
+			ChangedBy:     userID,
+			ChangedByName: userName,
+			Notes:         note,
+			ChangedAt:     now,
+		}); err != nil {
+			return nil, err
+		}
+		if err := s.repo.SetPostedQty(ctx, tx, item.ID, *item.Variance); err != nil {
+			return nil, err
+		}
+	}
+
+	session.Status = StatusPosted
+	session.PostedBy = &userID
+	session.PostedByName = userName
+	session.PostedAt = &now
+	session.UpdatedAt = now
+	if err := s.repo.UpdateHeader(ctx, tx, session); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, pharmacyID, id, ItemFilter{State: "variance"})
+}
+
+func (s *service) GetValuationReport(ctx context.Context, pharmacyID, id uuid.UUID) (*ValuationReport, error) {
+	session, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.ListItems(ctx, id, ItemFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValuationReport{
+		SessionID:    session.ID,
+		SessionNo:    session.SessionNo,
+		Status:       session.Status,
+		TotalLines:   len(items),
+		TopVariances: []Item{},
+	}
+	byCategory := map[string]*ValuationGroup{}
+	byRack := map[string]*ValuationGroup{}
+	group := func(m map[string]*ValuationGroup, key string) *ValuationGroup {
+		if key == "" {
+			key = "Unassigned"
+		}
+		g, ok := m[key]
+		if !ok {
+			g = &ValuationGroup{Key: key}
+			m[key] = g
+		}
+		return g
+	}
+
+	for _, item := range items {
+		if item.CountedQty != nil {
+			report.CountedLines++
+			if *item.Variance != 0 {
+				report.TopVariances = append(report.TopVariances, item)
+			}
+		}
+		report.Summary.add(item)
+		group(byCategory, item.Category).add(item)
+		group(byRack, item.RackNo).add(item)
+	}
+	report.UncountedLines = report.TotalLines - report.CountedLines
+	report.Summary.round()
+	report.ByCategory = sortedGroups(byCategory)
+	report.ByRack = sortedGroups(byRack)
+
+	sort.Slice(report.TopVariances, func(i, j int) bool {
+		return math.Abs(report.TopVariances[i].VarianceValue) > math.Abs(report.TopVariances[j].VarianceValue)
+	})
+	if len(report.TopVariances) > 20 {
+		report.TopVariances = report.TopVariances[:20]
+	}
+	return report, nil
+}
+
+func sortedGroups(m map[string]*ValuationGroup) []ValuationGroup {
+	groups := make([]ValuationGroup, 0, len(m))
+	for _, g := range m {
+		g.round()
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
@@ -0,0 +1,124 @@
+package stocktake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestComputeVariance(t *testing.T) {
+	tests := []struct {
+		name         string
+		system       int
+		counted      *int
+		cost         float64
+		wantVariance *int
+		wantValue    float64
+	}{
+		{"not counted yet", 10, nil, 2.5, nil, 0},
+		{"matches the system", 10, intPtr(10), 2.5, intPtr(0), 0},
+		{"shortage", 10, intPtr(7), 2.5, intPtr(-3), -7.5},
+		{"excess", 10, intPtr(12), 1.115, intPtr(2), 2.23},
+		{"counted zero", 4, intPtr(0), 3, intPtr(-4), -12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := Item{SystemQty: tt.system, CountedQty: tt.counted, UnitCost: tt.cost, VarianceValue: 99}
+			item.computeVariance()
+			switch {
+			case tt.wantVariance == nil && item.Variance != nil:
+				t.Errorf("Variance = %d, want nil", *item.Variance)
+			case tt.wantVariance != nil && (item.Variance == nil || *item.Variance != *tt.wantVariance):
+				t.Errorf("Variance = %v, want %d", item.Variance, *tt.wantVariance)
+			}
+			if item.VarianceValue != tt.wantValue {
+				t.Errorf("VarianceValue = %v, want %v", item.VarianceValue, tt.wantValue)
+			}
+		})
+	}
+}
+
+// fakeRepository serves one session and its items from memory
+type fakeRepository struct {
+	Repository
+	session *Session
+	items   []Item
+}
+
+func (f *fakeRepository) GetByID(context.Context, uuid.UUID, uuid.UUID) (*Session, error) {
+	return f.session, nil
+}
+
+func (f *fakeRepository) ListItems(context.Context, uuid.UUID, ItemFilter) ([]Item, error) {
+	return f.items, nil
+}
+
+func TestGetValuationReport(t *testing.T) {
+	item := func(category, rack string, system int, counted *int, cost float64, posted int) Item {
+		i := Item{Category: category, RackNo: rack, SystemQty: system, CountedQty: counted, UnitCost: cost, PostedQty: posted}
+		i.computeVariance()
+		return i
+	}
+	session := &Session{ID: uuid.New(), SessionNo: "ST-0001", Status: StatusPosted}
+	repo := &fakeRepository{
+		session: session,
+		items: []Item{
+			item("Tablets", "A1", 100, intPtr(90), 2, -10),
+			item("Tablets", "A2", 50, intPtr(55), 1.5, 5),
+			item("Syrups", "", 20, intPtr(20), 40, 0),
+			item("Syrups", "B1", 10, nil, 30, 0),
+		},
+	}
+	svc := &service{repo: repo}
+
+	report, err := svc.GetValuationReport(context.Background(), uuid.New(), session.ID)
+	if err != nil {
+		t.Fatalf("GetValuationReport() error = %v", err)
+	}
+	if report.TotalLines != 4 || report.CountedLines != 3 || report.UncountedLines != 1 {
+		t.Errorf("total/counted/uncounted = %d/%d/%d, want 4/3/1", report.TotalLines, report.CountedLines, report.UncountedLines)
+	}
+
+	wantSummary := ValuationTotals{
+		SystemValue:   1375,
+		CountedValue:  1062.5,
+		ShortageQty:   10,
+		ShortageValue: 20,
+		ExcessQty:     5,
+		ExcessValue:   7.5,
+		NetValue:      -12.5,
+		PostedValue:   -12.5,
+	}
+	if report.Summary != wantSummary {
+		t.Errorf("Summary = %+v, want %+v", report.Summary, wantSummary)
+	}
+
+	tests := []struct {
+		name   string
+		groups []ValuationGroup
+		want   []string
+	}{
+		{"by category", report.ByCategory, []string{"Syrups", "Tablets"}},
+		{"by rack", report.ByRack, []string{"A1", "A2", "B1", "Unassigned"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.groups) != len(tt.want) {
+				t.Fatalf("got %d groups, want %d: %+v", len(tt.groups), len(tt.want), tt.groups)
+			}
+			for i, key := range tt.want {
+				if tt.groups[i].Key != key {
+					t.Errorf("group[%d] = %q, want %q", i, tt.groups[i].Key, key)
+				}
+			}
+		})
+	}
+
+	if len(report.TopVariances) != 2 || report.TopVariances[0].VarianceValue != -20 || report.TopVariances[1].VarianceValue != 7.5 {
+		t.Errorf("TopVariances = %+v, want the -20.00 shortage before the 7.50 excess", report.TopVariances)
+	}
+}
@@ -0,0 +1,150 @@
+package transfers
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusInTransit           Status = "IN_TRANSIT"
+	StatusReceived            Status = "RECEIVED"
+	StatusReceivedDiscrepancy Status = "RECEIVED_WITH_DISCREPANCY"
+	StatusResolved            Status = "DISCREPANCY_RESOLVED"
+	StatusCancelled           Status = "CANCELLED"
+)
+
+// Resolution is how the source pharmacy closes a receipt discrepancy
+type Resolution string
+
+const (
+	// ResolutionWriteOff accepts the missing and damaged quantity as a transit loss
+	ResolutionWriteOff Resolution = "WRITE_OFF"
+	// ResolutionReturnToSource puts the missing quantity back on the source batch
+	// (it never left); damaged quantity is always written off
+	ResolutionReturnToSource Resolution = "RETURN_TO_SOURCE"
+)
+
+// Direction filters the transfer list relative to the calling pharmacy
+type Direction string
+
+const (
+	DirectionOutgoing Direction = "outgoing"
+	DirectionIncoming Direction = "incoming"
+)
+
+type Transfer struct {
+	ID                      uuid.UUID      `json:"id"`
+	TransferNo              string         `json:"transfer_no"`
+	SourcePharmacyID        uuid.UUID      `json:"source_pharmacy_id"`
+	SourcePharmacyName      string         `json:"source_pharmacy_name"`
+	DestinationPharmacyID   uuid.UUID      `json:"destination_pharmacy_id"`
+	DestinationPharmacyName string         `json:"destination_pharmacy_name"`
+	Status                  Status         `json:"status"`
+	Notes                   string         `json:"notes"`
+	TotalValue              float64        `json:"total_value"`
+	ReceivedValue           float64        `json:"received_value"`
+	DiscrepancyValue        float64        `json:"discrepancy_value"`
+	DispatchedBy            uuid.UUID      `json:"dispatched_by"`
+	DispatchedByName        string         `json:"dispatched_by_name"`
+	DispatchedAt            time.Time      `json:"dispatched_at"`
+	ReceivedBy              *uuid.UUID     `json:"received_by,omitempty"`
+	ReceivedByName          string         `json:"received_by_name,omitempty"`
+	ReceivedAt              *time.Time     `json:"received_at,omitempty"`
+	ReceiveNotes            string         `json:"receive_notes,omitempty"`
+	CancelledAt             *time.Time     `json:"cancelled_at,omitempty"`
+	CancelReason            string         `json:"cancel_reason,omitempty"`
+	Resolution              Resolution     `json:"resolution,omitempty"`
+	ResolutionNotes         string         `json:"resolution_notes,omitempty"`
+	ResolvedBy              *uuid.UUID     `json:"resolved_by,omitempty"`
+	ResolvedByName          string         `json:"resolved_by_name,omitempty"`
+	ResolvedAt              *time.Time     `json:"resolved_at,omitempty"`
+	CreatedAt               time.Time      `json:"created_at"`
+	UpdatedAt               time.Time      `json:"updated_at"`
+	Items                   []TransferItem `json:"items,omitempty"`
+}
+
+// TransferItem carries a snapshot of the source batch so the destination batch
+// is created with the same batch number, expiry, cost and pricing
+type TransferItem struct {
+	ID                    uuid.UUID  `json:"id"`
+	TransferID            uuid.UUID  `json:"transfer_id"`
+	SourceMedicineID      uuid.UUID  `json:"source_medicine_id"`
+	SourceBatchID         uuid.UUID  `json:"source_batch_id"`
+	MedicineName          string     `json:"medicine_name"`
+	BatchNo               string     `json:"batch_no"`
+	MfgDate               time.Time  `json:"mfg_date"`
+	ExpiryDate            time.Time  `json:"expiry_date"`
+	DispatchedQty         int        `json:"dispatched_qty"`
+	UnitCost              float64    `json:"unit_cost"`
+	MRP                   float64    `json:"mrp"`
+	UnitPrice             float64    `json:"unit_price"`
+	CGSTRate              float64    `json:"cgst_rate"`
+	SGSTRate              float64    `json:"sgst_rate"`
+	TotalTaxPercentage    float64    `json:"total_tax_percentage"`
+	RetailDiscPerc        float64    `json:"retail_disc_perc"`
+	StaffDiscPerc         float64    `json:"staff_disc_perc"`
+	SpecialDiscPerc       float64    `json:"special_disc_perc"`
+	MaxDiscPerc           float64    `json:"max_disc_perc"`
+	SupplierID            *uuid.UUID `json:"supplier_id,omitempty"`
+	DestinationMedicineID *uuid.UUID `json:"destination_medicine_id,omitempty"`
+	DestinationBatchID    *uuid.UUID `json:"destination_batch_id,omitempty"`
+	ReceivedQty           int        `json:"received_qty"`
+	DamagedQty            int        `json:"damaged_qty"`
+	Remarks               string     `json:"remarks,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// MissingQty is what was dispatched but neither received nor reported damaged
+func (i TransferItem) MissingQty() int {
+	return i.DispatchedQty - i.ReceivedQty - i.DamagedQty
+}
+
+// PharmacyRef is a pharmacy of the same organization that can receive transfers
+type PharmacyRef struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	PharmacyCode string    `json:"pharmacy_code"`
+	Address      string    `json:"address"`
+}
+
+// Request Structs
+
+type DispatchTransferRequest struct {
+	DestinationPharmacyID uuid.UUID              `json:"destination_pharmacy_id" validate:"required"`
+	Notes                 string                 `json:"notes" validate:"max=500"`
+	Items                 []DispatchTransferItem `json:"items" validate:"required,min=1,dive"`
+}
+
+type DispatchTransferItem struct {
+	BatchID  uuid.UUID `json:"batch_id" validate:"required"`
+	Quantity int       `json:"quantity" validate:"required,gt=0"`
+}
+
+// ReceiveTransferRequest confirms arrival at the destination. Lines that are
+// not listed are taken as received in full.
+type ReceiveTransferRequest struct {
+	Notes string                `json:"notes" validate:"max=500"`
+	Items []ReceiveTransferItem `json:"items" validate:"omitempty,dive"`
+}
+
+type ReceiveTransferItem struct {
+	ItemID      uuid.UUID `json:"item_id" validate:"required"`
+	ReceivedQty int       `json:"received_qty" validate:"gte=0"`
+	DamagedQty  int       `json:"damaged_qty" validate:"gte=0"`
+	// DestinationMedicineID maps the line to a medicine of the receiving pharmacy
+	// when it cannot be matched automatically
+	DestinationMedicineID *uuid.UUID `json:"destination_medicine_id"`
+	Remarks               string     `json:"remarks" validate:"max=500"`
+}
+
+type CancelTransferRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type ResolveDiscrepancyRequest struct {
+	Resolution Resolution `json:"resolution" validate:"required,oneof=WRITE_OFF RETURN_TO_SOURCE"`
+	Notes      string     `json:"notes" validate:"max=500"`
+}
@@ -0,0 +1,363 @@
+package transfers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+	// GetOrganizationID returns the organization a pharmacy belongs to, nil when unassigned
+	GetOrganizationID(ctx context.Context, pharmacyID uuid.UUID) (*uuid.UUID, error)
+	ListSiblingPharmacies(ctx context.Context, pharmacyID uuid.UUID) ([]PharmacyRef, error)
+	// GetSourceBatch snapshots a batch for dispatch; QuantityAvailable is returned separately
+	GetSourceBatch(ctx context.Context, pharmacyID, batchID uuid.UUID) (*TransferItem, int, error)
+	// MatchMedicine finds the destination pharmacy's medicine for a source medicine,
+	// by barcode first and then by name, brand and manufacturer
+	MatchMedicine(ctx context.Context, destinationPharmacyID, sourceMedicineID uuid.UUID) (*uuid.UUID, error)
+	Insert(ctx context.Context, tx *sql.Tx, t *Transfer) error
+	GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Transfer, error)
+	// GetForUpdate locks the transfer inside tx and loads its items
+	GetForUpdate(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Transfer, error)
+	UpdateHeader(ctx context.Context, tx *sql.Tx, t *Transfer) error
+	UpdateItemReceipt(ctx context.Context, tx *sql.Tx, item *TransferItem) error
+	List(ctx context.Context, pharmacyID uuid.UUID, direction Direction, status string, limit, offset int) ([]Transfer, int, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
+func (r *postgresRepository) GetOrganizationID(ctx context.Context, pharmacyID uuid.UUID) (*uuid.UUID, error) {
+	var orgID uuid.NullUUID
+	var active bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT organization_id, COALESCE(is_active, true) FROM public.pharmacies WHERE id = $1
+	`, pharmacyID).Scan(&orgID, &active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		return nil, fmt.Errorf("pharmacy not found or inactive")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !orgID.Valid {
+		return nil, nil
+	}
+	return &orgID.UUID, nil
+}
+
+func (r *postgresRepository) ListSiblingPharmacies(ctx context.Context, pharmacyID uuid.UUID) ([]PharmacyRef, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT p.id, p.name, p.pharmacy_code, COALESCE(p.address, '')
+		FROM public.pharmacies p
+		JOIN public.pharmacies self ON self.id = $1
+		WHERE p.organization_id = self.organization_id
+		  AND p.id <> self.id
+		  AND COALESCE(p.is_active, true)
+		ORDER BY p.name
+	`, pharmacyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pharmacies: %w", err)
+	}
+	defer rows.Close()
+
+	refs := []PharmacyRef{}
+	for rows.Next() {
+		var p PharmacyRef
+		if err := rows.Scan(&p.ID, &p.Name, &p.PharmacyCode, &p.Address); err != nil {
+			return nil, err
+		}
+		refs = append(refs, p)
+	}
+	return refs, rows.Err()
+}
+
+func (r *postgresRepository) GetSourceBatch(ctx context.Context, pharmacyID, batchID uuid.UUID) (*TransferItem, int, error) {
+	item := &TransferItem{}
+	var available int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT b.medicine_id, b.id, m.name, b.batch_no, b.mfg_date, b.expiry_date, b.quantity_available,
+		       b.cost_price, b.mrp, b.unit_price, COALESCE(b.cgst_rate, 0), COALESCE(b.sgst_rate, 0),
+		       COALESCE(b.total_tax_percentage, 0), COALESCE(b.retail_disc_perc, 0), COALESCE(b.staff_disc_perc, 0),
+		       COALESCE(b.special_disc_perc, 0), COALESCE(b.max_disc_perc, 0), b.supplier_id
+		FROM inventory.batches b
+		JOIN inventory.medicines m ON m.id = b.medicine_id
+		WHERE b.id = $1 AND b.pharmacy_id = $2
+	`, batchID, pharmacyID).Scan(
+		&item.SourceMedicineID, &item.SourceBatchID, &item.MedicineName, &item.BatchNo, &item.MfgDate, &item.ExpiryDate, &available,
+		&item.UnitCost, &item.MRP, &item.UnitPrice, &item.CGSTRate, &item.SGSTRate,
+		&item.TotalTaxPercentage, &item.RetailDiscPerc, &item.StaffDiscPerc,
+		&item.SpecialDiscPerc, &item.MaxDiscPerc, &item.SupplierID,
+	)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("batch %s not found", batchID)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return item, available, nil
+}
+
+func (r *postgresRepository) MatchMedicine(ctx context.Context, destinationPharmacyID, sourceMedicineID uuid.UUID) (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRowContext(ctx, `
+		SELECT d.id
+		FROM inventory.medicines s
+		JOIN inventory.medicines d ON d.pharmacy_id = $2 AND COALESCE(d.is_active, true)
+		WHERE s.id = $1
+		  AND (
+		      (COALESCE(s.barcode, '') <> '' AND d.barcode = s.barcode)
+		      OR (
+		          LOWER(d.name) = LOWER(s.name)
+		          AND LOWER(COALESCE(d.brand_name, '')) = LOWER(COALESCE(s.brand_name, ''))
+		          AND LOWER(COALESCE(d.manufacturer, '')) = LOWER(COALESCE(s.manufacturer, ''))
+		      )
+		  )
+		ORDER BY (COALESCE(s.barcode, '') <> '' AND d.barcode = s.barcode) DESC, d.created_at
+		LIMIT 1
+	`, sourceMedicineID, destinationPharmacyID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to match medicine: %w", err)
+	}
+	return &id, nil
+}
+
+func (r *postgresRepository) Insert(ctx context.Context, tx *sql.Tx, t *Transfer) error {
+	// Transfer numbers come from the sending pharmacy's transfer series: TRF/26-27/00001
+	transferNo, err := numbering.Next(ctx, tx, t.SourcePharmacyID, numbering.DocStockTransfer, t.DispatchedAt)
+	if err != nil {
+		return err
+	}
+	t.TransferNo = transferNo
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory.stock_transfers (
+			id, transfer_no, source_pharmacy_id, destination_pharmacy_id, status, notes, total_value,
+			dispatched_by, dispatched_by_name, dispatched_at, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, t.ID, t.TransferNo, t.SourcePharmacyID, t.DestinationPharmacyID, t.Status, t.Notes, t.TotalValue,
+		t.DispatchedBy, t.DispatchedByName, t.DispatchedAt, t.CreatedAt, t.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert transfer: %w", err)
+	}
+
+	for _, item := range t.Items {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO inventory.stock_transfer_items (
+				id, transfer_id, source_medicine_id, source_batch_id, medicine_name, batch_no, mfg_date, expiry_date,
+				dispatched_qty, unit_cost, mrp, unit_price, cgst_rate, sgst_rate, total_tax_percentage,
+				retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc, supplier_id, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		`, item.ID, t.ID, item.SourceMedicineID, item.SourceBatchID, item.MedicineName, item.BatchNo, item.MfgDate, item.ExpiryDate,
+			item.DispatchedQty, item.UnitCost, item.MRP, item.UnitPrice, item.CGSTRate, item.SGSTRate, item.TotalTaxPercentage,
+			item.RetailDiscPerc, item.StaffDiscPerc, item.SpecialDiscPerc, item.MaxDiscPerc, item.SupplierID, item.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert transfer item (%s): %w", item.BatchNo, err)
+		}
+	}
+	return nil
+}
+
+const selectTransfer = `
+	SELECT t.id, t.transfer_no, t.source_pharmacy_id, COALESCE(sp.name, ''), t.destination_pharmacy_id, COALESCE(dp.name, ''),
+	       t.status, COALESCE(t.notes, ''), t.total_value, t.received_value, t.discrepancy_value,
+	       t.dispatched_by, COALESCE(t.dispatched_by_name, ''), t.dispatched_at,
+	       t.received_by, COALESCE(t.received_by_name, ''), t.received_at, COALESCE(t.receive_notes, ''),
+	       t.cancelled_at, COALESCE(t.cancel_reason, ''), COALESCE(t.resolution, ''), COALESCE(t.resolution_notes, ''),
+	       t.resolved_by, COALESCE(t.resolved_by_name, ''), t.resolved_at, t.created_at, t.updated_at
+	FROM inventory.stock_transfers t
+	LEFT JOIN public.pharmacies sp ON sp.id = t.source_pharmacy_id
+	LEFT JOIN public.pharmacies dp ON dp.id = t.destination_pharmacy_id
+`
+
+func scanTransfer(row interface{ Scan(...interface{}) error }) (*Transfer, error) {
+	var t Transfer
+	var dispatchedBy, receivedBy, resolvedBy uuid.NullUUID
+	var receivedAt, cancelledAt, resolvedAt sql.NullTime
+	if err := row.Scan(
+		&t.ID, &t.TransferNo, &t.SourcePharmacyID, &t.SourcePharmacyName, &t.DestinationPharmacyID, &t.DestinationPharmacyName,
+		&t.Status, &t.Notes, &t.TotalValue, &t.ReceivedValue, &t.DiscrepancyValue,
+		&dispatchedBy, &t.DispatchedByName, &t.DispatchedAt,
+		&receivedBy, &t.ReceivedByName, &receivedAt, &t.ReceiveNotes,
+		&cancelledAt, &t.CancelReason, &t.Resolution, &t.ResolutionNotes,
+		&resolvedBy, &t.ResolvedByName, &resolvedAt, &t.CreatedAt, &t.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	t.DispatchedBy = dispatchedBy.UUID
+	if receivedBy.Valid {
+		t.ReceivedBy = &receivedBy.UUID
+	}
+	if receivedAt.Valid {
+		t.ReceivedAt = &receivedAt.Time
+	}
+	if cancelledAt.Valid {
+		t.CancelledAt = &cancelledAt.Time
+	}
+	if resolvedBy.Valid {
+		t.ResolvedBy = &resolvedBy.UUID
+	}
+	if resolvedAt.Valid {
+		t.ResolvedAt = &resolvedAt.Time
+	}
+	return &t, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func loadItems(ctx context.Context, q queryer, transferID uuid.UUID) ([]TransferItem, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, transfer_id, source_medicine_id, source_batch_id, medicine_name, batch_no, mfg_date, expiry_date,
+		       dispatched_qty, unit_cost, mrp, unit_price, COALESCE(cgst_rate, 0), COALESCE(sgst_rate, 0),
+		       COALESCE(total_tax_percentage, 0), COALESCE(retail_disc_perc, 0), COALESCE(staff_disc_perc, 0),
+		       COALESCE(special_disc_perc, 0), COALESCE(max_disc_perc, 0), supplier_id,
+		       destination_medicine_id, destination_batch_id, received_qty, damaged_qty, COALESCE(remarks, ''), created_at
+		FROM inventory.stock_transfer_items
+		WHERE transfer_id = $1
+		ORDER BY medicine_name, expiry_date
+	`, transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TransferItem
+	for rows.Next() {
+		var i TransferItem
+		var mfg sql.NullTime
+		if err := rows.Scan(
+			&i.ID, &i.TransferID, &i.SourceMedicineID, &i.SourceBatchID, &i.MedicineName, &i.BatchNo, &mfg, &i.ExpiryDate,
+			&i.DispatchedQty, &i.UnitCost, &i.MRP, &i.UnitPrice, &i.CGSTRate, &i.SGSTRate,
+			&i.TotalTaxPercentage, &i.RetailDiscPerc, &i.StaffDiscPerc,
+			&i.SpecialDiscPerc, &i.MaxDiscPerc, &i.SupplierID,
+			&i.DestinationMedicineID, &i.DestinationBatchID, &i.ReceivedQty, &i.DamagedQty, &i.Remarks, &i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		i.MfgDate = mfg.Time
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Transfer, error) {
+	t, err := scanTransfer(r.db.QueryRowContext(ctx, selectTransfer+`
+		WHERE t.id = $1 AND (t.source_pharmacy_id = $2 OR t.destination_pharmacy_id = $2)
+	`, id, pharmacyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("transfer not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Items, err = loadItems(ctx, r.db, id); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *postgresRepository) GetForUpdate(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Transfer, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM inventory.stock_transfers WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, fmt.Errorf("failed to lock transfer: %w", err)
+	}
+	t, err := scanTransfer(tx.QueryRowContext(ctx, selectTransfer+" WHERE t.id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("transfer not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Items, err = loadItems(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *postgresRepository) UpdateHeader(ctx context.Context, tx *sql.Tx, t *Transfer) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE inventory.stock_transfers SET
+			status = $1, received_value = $2, discrepancy_value = $3,
+			received_by = $4, received_by_name = NULLIF($5, ''), received_at = $6, receive_notes = NULLIF($7, ''),
+			cancelled_at = $8, cancel_reason = NULLIF($9, ''),
+			resolution = NULLIF($10, ''), resolution_notes = NULLIF($11, ''), resolved_by = $12, resolved_by_name = NULLIF($13, ''),
+			resolved_at = $14, updated_at = $15
+		WHERE id = $16
+	`, t.Status, t.ReceivedValue, t.DiscrepancyValue,
+		t.ReceivedBy, t.ReceivedByName, t.ReceivedAt, t.ReceiveNotes,
+		t.CancelledAt, t.CancelReason,
+		string(t.Resolution), t.ResolutionNotes, t.ResolvedBy, t.ResolvedByName,
+		t.ResolvedAt,
+		t.UpdatedAt, t.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update transfer: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) UpdateItemReceipt(ctx context.Context, tx *sql.Tx, item *TransferItem) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE inventory.stock_transfer_items SET
+			destination_medicine_id = $1, destination_batch_id = $2, received_qty = $3, damaged_qty = $4, remarks = NULLIF($5, '')
+		WHERE id = $6
+	`, item.DestinationMedicineID, item.DestinationBatchID, item.ReceivedQty, item.DamagedQty, item.Remarks, item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update transfer item (%s): %w", item.BatchNo, err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) List(ctx context.Context, pharmacyID uuid.UUID, direction Direction, status string, limit, offset int) ([]Transfer, int, error) {
+	var where string
+	switch direction {
+	case DirectionOutgoing:
+		where = " WHERE t.source_pharmacy_id = $1"
+	case DirectionIncoming:
+		where = " WHERE t.destination_pharmacy_id = $1"
+	default:
+		where = " WHERE (t.source_pharmacy_id = $1 OR t.destination_pharmacy_id = $1)"
+	}
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND t.status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.stock_transfers t"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := selectTransfer + where + fmt.Sprintf(" ORDER BY t.dispatched_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var transfers []Transfer
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		transfers = append(transfers, *t)
+	}
+	return transfers, total, rows.Err()
+}
@@ -0,0 +1,410 @@
+package transfers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/inventory/batches"
+	"organization-service/internal/pharmacy/inventory/medicines"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	ListDestinations(ctx context.Context, pharmacyID uuid.UUID) ([]PharmacyRef, error)
+	// Dispatch takes stock off the source batches and leaves it in transit
+	Dispatch(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req DispatchTransferRequest) (*Transfer, error)
+	Get(ctx context.Context, pharmacyID, id uuid.UUID) (*Transfer, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, direction Direction, status string, page, pageSize int) ([]Transfer, int, error)
+	// Receive books the transfer into the destination pharmacy's batches
+	Receive(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ReceiveTransferRequest) (*Transfer, error)
+	// Cancel returns in-transit stock to the source batches
+	Cancel(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, reason string) (*Transfer, error)
+	ResolveDiscrepancy(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ResolveDiscrepancyRequest) (*Transfer, error)
+}
+
+type service struct {
+	repo      Repository
+	medRepo   medicines.Repository
+	batchRepo batches.Repository
+}
+
+func NewService(repo Repository, medRepo medicines.Repository, batchRepo batches.Repository) Service {
+	return &service{
+		repo:      repo,
+		medRepo:   medRepo,
+		batchRepo: batchRepo,
+	}
+}
+
+func (s *service) ListDestinations(ctx context.Context, pharmacyID uuid.UUID) ([]PharmacyRef, error) {
+	return s.repo.ListSiblingPharmacies(ctx, pharmacyID)
+}
+
+func (s *service) Dispatch(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req DispatchTransferRequest) (*Transfer, error) {
+	if req.DestinationPharmacyID == pharmacyID {
+		return nil, fmt.Errorf("destination must be a different pharmacy")
+	}
+	if err := s.checkSameOrganization(ctx, pharmacyID, req.DestinationPharmacyID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	t := &Transfer{
+		ID:                    uuid.New(),
+		SourcePharmacyID:      pharmacyID,
+		DestinationPharmacyID: req.DestinationPharmacyID,
+		Status:                StatusInTransit,
+		Notes:                 req.Notes,
+		DispatchedBy:          userID,
+		DispatchedByName:      userName,
+		DispatchedAt:          now,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+
+	requested := make(map[uuid.UUID]int)
+	for _, reqItem := range req.Items {
+		item, available, err := s.repo.GetSourceBatch(ctx, pharmacyID, reqItem.BatchID)
+		if err != nil {
+			return nil, err
+		}
+		if item.ExpiryDate.Before(now) {
+			return nil, fmt.Errorf("batch %s of %s has expired and cannot be transferred", item.BatchNo, item.MedicineName)
+		}
+		requested[reqItem.BatchID] += reqItem.Quantity
+		if requested[reqItem.BatchID] > available {
+			return nil, fmt.Errorf("cannot transfer %d of batch %s (%s): only %d in stock",
+				requested[reqItem.BatchID], item.BatchNo, item.MedicineName, available)
+		}
+		item.ID = uuid.New()
+		item.TransferID = t.ID
+		item.DispatchedQty = reqItem.Quantity
+		item.CreatedAt = now
+		t.TotalValue = money.Round2(t.TotalValue + float64(item.DispatchedQty)*item.UnitCost)
+		t.Items = append(t.Items, *item)
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.repo.Insert(ctx, tx, t); err != nil {
+		return nil, err
+	}
+	for _, item := range t.Items {
+		note := fmt.Sprintf("Dispatched on transfer %s", t.TransferNo)
+		if err := s.move(ctx, tx, pharmacyID, item.SourceMedicineID, item.SourceBatchID, -item.DispatchedQty,
+			"TRANSFER_OUT", t.ID, userID, userName, note); err != nil {
+			return nil, fmt.Errorf("batch %s: %w", item.BatchNo, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return s.repo.GetByID(ctx, pharmacyID, t.ID)
+}
+
+// checkSameOrganization only allows transfers between pharmacies of one organization
+func (s *service) checkSameOrganization(ctx context.Context, sourceID, destinationID uuid.UUID) error {
+	sourceOrg, err := s.repo.GetOrganizationID(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+	destOrg, err := s.repo.GetOrganizationID(ctx, destinationID)
+	if err != nil {
+		return fmt.Errorf("destination %w", err)
+	}
+	if sourceOrg == nil || destOrg == nil || *sourceOrg != *destOrg {
+		return fmt.Errorf("stock can only be transferred between pharmacies of the same organization")
+	}
+	return nil
+}
+
+// move applies a quantity change to an existing batch with its ledger and audit entries
+func (s *service) move(ctx context.Context, tx *sql.Tx, pharmacyID, medicineID, batchID uuid.UUID, qty int, txnType string, transferID, userID uuid.UUID, userName, note string) error {
+	if _, err := s.batchRepo.RecordMovement(ctx, tx, batches.MovementDTO{
+		PharmacyID:      pharmacyID,
+		MedicineID:      medicineID,
+		BatchID:         batchID,
+		QuantityChange:  qty,
+		TransactionType: txnType,
+		ReferenceType:   "STOCK_TRANSFER",
+		ReferenceID:     &transferID,
+		PerformedBy:     &userID,
+		Notes:           note,
+	}); err != nil {
+		return err
+	}
+	return s.batchRepo.CreateBatchLog(ctx, tx, batches.BatchAuditLog{
+		ID:            uuid.New(),
+		PharmacyID:    pharmacyID,
+		BatchID:       batchID,
+		ActionType:    txnType,
+		ChangedBy:     userID,
+		ChangedByName: userName,
+		Notes:         note,
+		ChangedAt:     time.Now(),
+	})
+}
+
+func (s *service) Get(ctx context.Context, pharmacyID, id uuid.UUID) (*Transfer, error) {
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) List(ctx context.Context, pharmacyID uuid.UUID, direction Direction, status string, page, pageSize int) ([]Transfer, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+	return s.repo.List(ctx, pharmacyID, direction, status, pageSize, offset)
+}
+
+func (s *service) Receive(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ReceiveTransferRequest) (*Transfer, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	t, err := s.repo.GetForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.DestinationPharmacyID != pharmacyID {
+		return nil, fmt.Errorf("only the destination pharmacy can receive this transfer")
+	}
+	if t.Status != StatusInTransit {
+		return nil, fmt.Errorf("transfer %s is %s, not in transit", t.TransferNo, t.Status)
+	}
+
+	lines := make(map[uuid.UUID]ReceiveTransferItem, len(req.Items))
+	for _, l := range req.Items {
+		lines[l.ItemID] = l
+	}
+	for itemID := range lines {
+		found := false
+		for _, item := range t.Items {
+			if item.ID == itemID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("item %s is not part of transfer %s", itemID, t.TransferNo)
+		}
+	}
+
+	now := time.Now()
+	note := fmt.Sprintf("Received on transfer %s from %s", t.TransferNo, t.SourcePharmacyName)
+	discrepancy := false
+	for i := range t.Items {
+		item := &t.Items[i]
+		item.ReceivedQty = item.DispatchedQty
+		line, listed := lines[item.ID]
+		if listed {
+			if line.ReceivedQty+line.DamagedQty > item.DispatchedQty {
+				return nil, fmt.Errorf("%s batch %s: received %d and damaged %d exceed the %d dispatched",
+					item.MedicineName, item.BatchNo, line.ReceivedQty, line.DamagedQty, item.DispatchedQty)
+			}
+			item.ReceivedQty = line.ReceivedQty
+			item.DamagedQty = line.DamagedQty
+			item.Remarks = line.Remarks
+		}
+		if item.DamagedQty > 0 || item.MissingQty() > 0 {
+			discrepancy = true
+		}
+
+		if item.ReceivedQty > 0 {
+			medicineID, err := s.destinationMedicine(ctx, pharmacyID, item, line.DestinationMedicineID)
+			if err != nil {
+				return nil, err
+			}
+			var supplierID uuid.UUID
+			if item.SupplierID != nil {
+				supplierID = *item.SupplierID
+			}
+			batchID, err := s.batchRepo.UpsertBatch(ctx, tx, batches.UpdateBatchDTO{
+				PharmacyID:         pharmacyID,
+				MedicineID:         medicineID,
+				BatchNo:            item.BatchNo,
+				MfgDate:            item.MfgDate,
+				ExpiryDate:         item.ExpiryDate,
+				QuantityToAdd:      item.ReceivedQty,
+				CostPrice:          item.UnitCost,
+				MRP:                item.MRP,
+				UnitPrice:          item.UnitPrice,
+				CGSTRate:           item.CGSTRate,
+				SGSTRate:           item.SGSTRate,
+				TotalTaxPercentage: item.TotalTaxPercentage,
+				RetailDiscPerc:     item.RetailDiscPerc,
+				StaffDiscPerc:      item.StaffDiscPerc,
+				SpecialDiscPerc:    item.SpecialDiscPerc,
+				MaxDiscPerc:        item.MaxDiscPerc,
+				SupplierID:         supplierID,
+				TransactionType:    "TRANSFER_IN",
+				ReferenceType:      "STOCK_TRANSFER",
+				ReferenceID:        &t.ID,
+				PerformedBy:        &userID,
+				Notes:              note,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("batch %s: %w", item.BatchNo, err)
+			}
+			if err := s.batchRepo.CreateBatchLog(ctx, tx, batches.BatchAuditLog{
+				ID:            uuid.New(),
+				PharmacyID:    pharmacyID,
+				BatchID:       batchID,
+				ActionType:    "TRANSFER_IN",
+				ChangedBy:     userID,
+				ChangedByName: userName,
+				Notes:         note,
+				ChangedAt:     now,
+			}); err != nil {
+				return nil, err
+			}
+			item.DestinationMedicineID = &medicineID
+			item.DestinationBatchID = &batchID
+		}
+
+		if err := s.repo.UpdateItemReceipt(ctx, tx, item); err != nil {
+			return nil, err
+		}
+		t.ReceivedValue = money.Round2(t.ReceivedValue + float64(item.ReceivedQty)*item.UnitCost)
+		t.DiscrepancyValue = money.Round2(t.DiscrepancyValue + float64(item.DamagedQty+item.MissingQty())*item.UnitCost)
+	}
+
+	t.Status = StatusReceived
+	if discrepancy {
+		t.Status = StatusReceivedDiscrepancy
+	}
+	t.ReceivedBy = &userID
+	t.ReceivedByName = userName
+	t.ReceivedAt = &now
+	t.ReceiveNotes = req.Notes
+	t.UpdatedAt = now
+	if err := s.repo.UpdateHeader(ctx, tx, t); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+// destinationMedicine resolves the receiving pharmacy's medicine for a line:
+// an explicit mapping wins, otherwise the catalogues are matched
+func (s *service) destinationMedicine(ctx context.Context, pharmacyID uuid.UUID, item *TransferItem, explicit *uuid.UUID) (uuid.UUID, error) {
+	if explicit != nil {
+		if _, err := s.medRepo.GetByID(ctx, *explicit, pharmacyID); err != nil {
+			return uuid.Nil, fmt.Errorf("destination medicine for %s not found in this pharmacy", item.MedicineName)
+		}
+		return *explicit, nil
+	}
+	matched, err := s.repo.MatchMedicine(ctx, pharmacyID, item.SourceMedicineID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if matched == nil {
+		return uuid.Nil, fmt.Errorf("%s is not in this pharmacy's medicine list; add it or set destination_medicine_id for item %s", item.MedicineName, item.ID)
+	}
+	return *matched, nil
+}
+
+func (s *service) Cancel(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, reason string) (*Transfer, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	t, err := s.repo.GetForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.SourcePharmacyID != pharmacyID {
+		return nil, fmt.Errorf("only the source pharmacy can cancel this transfer")
+	}
+	if t.Status != StatusInTransit {
+		return nil, fmt.Errorf("transfer %s is %s and can no longer be cancelled", t.TransferNo, t.Status)
+	}
+
+	note := fmt.Sprintf("Returned from cancelled transfer %s", t.TransferNo)
+	for _, item := range t.Items {
+		if err := s.move(ctx, tx, pharmacyID, item.SourceMedicineID, item.SourceBatchID, item.DispatchedQty,
+			"TRANSFER_RETURN", t.ID, userID, userName, note); err != nil {
+			return nil, fmt.Errorf("batch %s: %w", item.BatchNo, err)
+		}
+	}
+
+	now := time.Now()
+	t.Status = StatusCancelled
+	t.CancelledAt = &now
+	t.CancelReason = reason
+	t.UpdatedAt = now
+	if err := s.repo.UpdateHeader(ctx, tx, t); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) ResolveDiscrepancy(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, id uuid.UUID, req ResolveDiscrepancyRequest) (*Transfer, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	t, err := s.repo.GetForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.SourcePharmacyID != pharmacyID {
+		return nil, fmt.Errorf("only the source pharmacy can resolve this transfer")
+	}
+	if t.Status != StatusReceivedDiscrepancy {
+		return nil, fmt.Errorf("transfer %s has no open discrepancy", t.TransferNo)
+	}
+
+	if req.Resolution == ResolutionReturnToSource {
+		note := fmt.Sprintf("Short-shipped on transfer %s, returned to stock", t.TransferNo)
+		for _, item := range t.Items {
+			if item.MissingQty() <= 0 {
+				continue
+			}
+			if err := s.move(ctx, tx, pharmacyID, item.SourceMedicineID, item.SourceBatchID, item.MissingQty(),
+				"TRANSFER_RETURN", t.ID, userID, userName, note); err != nil {
+				return nil, fmt.Errorf("batch %s: %w", item.BatchNo, err)
+			}
+			t.DiscrepancyValue = money.Round2(t.DiscrepancyValue - float64(item.MissingQty())*item.UnitCost)
+		}
+	}
+
+	now := time.Now()
+	t.Status = StatusResolved
+	t.Resolution = req.Resolution
+	t.ResolutionNotes = req.Notes
+	t.ResolvedBy = &userID
+	t.ResolvedByName = userName
+	t.ResolvedAt = &now
+	t.UpdatedAt = now
+	if err := s.repo.UpdateHeader(ctx, tx, t); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
@@ -0,0 +1,101 @@
+package transfers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMissingQty(t *testing.T) {
+	tests := []struct {
+		dispatched, received, damaged, want int
+	}{
+		{10, 10, 0, 0},
+		{10, 8, 0, 2},
+		{10, 7, 2, 1},
+		{10, 0, 0, 10},
+		{10, 0, 10, 0},
+	}
+
+	for _, tt := range tests {
+		item := TransferItem{DispatchedQty: tt.dispatched, ReceivedQty: tt.received, DamagedQty: tt.damaged}
+		if got := item.MissingQty(); got != tt.want {
+			t.Errorf("MissingQty() with %d dispatched, %d received, %d damaged = %d, want %d",
+				tt.dispatched, tt.received, tt.damaged, got, tt.want)
+		}
+	}
+}
+
+var errNoTx = errors.New("no database in tests")
+
+// fakeRepository serves organizations and source batches from memory and
+// refuses to open a transaction, so Dispatch stops right after validation
+type fakeRepository struct {
+	Repository
+	orgs      map[uuid.UUID]*uuid.UUID
+	batches   map[uuid.UUID]TransferItem
+	available map[uuid.UUID]int
+}
+
+func (f *fakeRepository) GetOrganizationID(_ context.Context, pharmacyID uuid.UUID) (*uuid.UUID, error) {
+	return f.orgs[pharmacyID], nil
+}
+
+func (f *fakeRepository) GetSourceBatch(_ context.Context, _, batchID uuid.UUID) (*TransferItem, int, error) {
+	item, ok := f.batches[batchID]
+	if !ok {
+		return nil, 0, errors.New("batch not found")
+	}
+	return &item, f.available[batchID], nil
+}
+
+func (f *fakeRepository) BeginTx(context.Context) (*sql.Tx, error) {
+	return nil, errNoTx
+}
+
+func TestDispatchValidation(t *testing.T) {
+	org, otherOrg := uuid.New(), uuid.New()
+	source, sibling, outsider, unassigned := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	fresh, expired := uuid.New(), uuid.New()
+
+	repo := &fakeRepository{
+		orgs: map[uuid.UUID]*uuid.UUID{source: &org, sibling: &org, outsider: &otherOrg},
+		batches: map[uuid.UUID]TransferItem{
+			fresh:   {MedicineName: "Paracetamol 500mg", BatchNo: "B1", ExpiryDate: time.Now().AddDate(1, 0, 0)},
+			expired: {MedicineName: "Cetirizine 10mg", BatchNo: "B2", ExpiryDate: time.Now().AddDate(0, 0, -1)},
+		},
+		available: map[uuid.UUID]int{fresh: 50, expired: 50},
+	}
+	svc := &service{repo: repo}
+
+	tests := []struct {
+		name        string
+		destination uuid.UUID
+		items       []DispatchTransferItem
+		wantValid   bool
+	}{
+		{"to a sibling pharmacy", sibling, []DispatchTransferItem{{BatchID: fresh, Quantity: 50}}, true},
+		{"to itself", source, []DispatchTransferItem{{BatchID: fresh, Quantity: 5}}, false},
+		{"to another organization", outsider, []DispatchTransferItem{{BatchID: fresh, Quantity: 5}}, false},
+		{"to a pharmacy without an organization", unassigned, []DispatchTransferItem{{BatchID: fresh, Quantity: 5}}, false},
+		{"expired batch", sibling, []DispatchTransferItem{{BatchID: expired, Quantity: 5}}, false},
+		{"more than in stock", sibling, []DispatchTransferItem{{BatchID: fresh, Quantity: 51}}, false},
+		{"repeated batch adds up against stock", sibling, []DispatchTransferItem{{BatchID: fresh, Quantity: 30}, {BatchID: fresh, Quantity: 30}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Dispatch(context.Background(), source, uuid.New(), "Asha", DispatchTransferRequest{
+				DestinationPharmacyID: tt.destination,
+				Items:                 tt.items,
+			})
+			if valid := errors.Is(err, errNoTx); valid != tt.wantValid {
+				t.Errorf("Dispatch() error = %v, want valid %v", err, tt.wantValid)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Package money holds the rounding pharmacy ledgers, documents and reports share
+package money
+
+import "math"
+
+// Round2 rounds to two decimal places: the paisa for amounts, and the precision
+// reports show for rates and average quantities
+func Round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
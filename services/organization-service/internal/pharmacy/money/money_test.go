@@ -0,0 +1,21 @@
+package money
+
+import "testing"
+
+func TestRound2(t *testing.T) {
+	tests := []struct {
+		in, want float64
+	}{
+		{10, 10},
+		{10.004, 10},
+		{10.005, 10.01},
+		{-10.005, -10.01},
+		{1.0 / 3, 0.33},
+	}
+
+	for _, tt := range tests {
+		if got := Round2(tt.in); got != tt.want {
+			t.Errorf("Round2(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
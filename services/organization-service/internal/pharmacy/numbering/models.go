@@ -0,0 +1,116 @@
+package numbering
+
+import (
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+)
+
+type DocumentType string
+
+const (
+	DocSaleInvoice    DocumentType = "SALE_INVOICE"
+	DocCreditNote     DocumentType = "CREDIT_NOTE" // Sales returns
+	DocDueReceipt     DocumentType = "DUE_RECEIPT" // Dues collected from patients
+	DocStockOut       DocumentType = "STOCK_OUT"
+	DocPurchaseOrder  DocumentType = "PURCHASE_ORDER"
+	DocGoodsReceipt   DocumentType = "GOODS_RECEIPT"
+	DocDebitNote      DocumentType = "DEBIT_NOTE" // Purchase returns to suppliers
+	DocPaymentVoucher DocumentType = "PAYMENT_VOUCHER"
+	DocStockTransfer  DocumentType = "STOCK_TRANSFER" // Numbered by the sending pharmacy
+	DocStockTake      DocumentType = "STOCK_TAKE"
+	DocExpiryProposal DocumentType = "EXPIRY_PROPOSAL"
+)
+
+// DocumentTypes lists every numbered document, in the order series are shown
+var DocumentTypes = []DocumentType{
+	DocSaleInvoice, DocCreditNote, DocDueReceipt, DocStockOut, DocPurchaseOrder, DocGoodsReceipt,
+	DocDebitNote, DocPaymentVoucher, DocStockTransfer, DocStockTake, DocExpiryProposal,
+}
+
+type ResetPolicy string
+
+const (
+	// ResetFinancialYear restarts numbering at 1 each April and carries the year in the number
+	ResetFinancialYear ResetPolicy = "FINANCIAL_YEAR"
+	ResetNever         ResetPolicy = "NEVER"
+)
+
+// periodAll is the counter period of series that never reset
+const periodAll = "ALL"
+
+// Config is how a series formats its numbers
+type Config struct {
+	Prefix      string      `json:"prefix"`
+	ResetPolicy ResetPolicy `json:"reset_policy"`
+	Padding     int         `json:"padding"`
+}
+
+// Defaults apply until a pharmacy configures a series: INV/26-27/00001
+var defaults = map[DocumentType]Config{
+	DocSaleInvoice:    {Prefix: "INV/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocCreditNote:     {Prefix: "CN/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocDueReceipt:     {Prefix: "RCT/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocStockOut:       {Prefix: "SO/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocPurchaseOrder:  {Prefix: "PO/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocGoodsReceipt:   {Prefix: "GRN/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocDebitNote:      {Prefix: "DN/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocPaymentVoucher: {Prefix: "PV/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocStockTransfer:  {Prefix: "TRF/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocStockTake:      {Prefix: "ST/", ResetPolicy: ResetFinancialYear, Padding: 5},
+	DocExpiryProposal: {Prefix: "EXP/", ResetPolicy: ResetFinancialYear, Padding: 5},
+}
+
+// period is the counter the number at t is drawn from
+func (c Config) period(t time.Time) string {
+	if c.ResetPolicy == ResetNever {
+		return periodAll
+	}
+	return financialYear(t)
+}
+
+// format renders the nth number of a period; financial-year series carry the
+// short year (26-27) so numbers stay unique across years
+func (c Config) format(period string, n int) string {
+	if period == periodAll {
+		return fmt.Sprintf("%s%0*d", c.Prefix, c.Padding, n)
+	}
+	return fmt.Sprintf("%s%s/%0*d", c.Prefix, period[2:], c.Padding, n)
+}
+
+// financialYear is the Indian financial year (April to March) t falls in, by IST: 2026-27
+func financialYear(t time.Time) string {
+	t = t.In(clock.IST)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// Series is a document series as the admin sees it
+type Series struct {
+	DocumentType DocumentType `json:"document_type"`
+	Config
+	Customized     bool       `json:"customized"` // False while the defaults apply
+	Period         string     `json:"period"`     // Financial year numbering is in, or ALL
+	LastNumber     int        `json:"last_number"`
+	NextDocumentNo string     `json:"next_document_no"`
+	UpdatedByName  string     `json:"updated_by_name,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// Request Structs
+
+type UpdateSeriesRequest struct {
+	Prefix      string      `json:"prefix" validate:"max=10"`
+	ResetPolicy ResetPolicy `json:"reset_policy" validate:"required,oneof=FINANCIAL_YEAR NEVER"`
+	Padding     int         `json:"padding" validate:"required,min=1,max=10"`
+}
+
+// SeedSeriesRequest sets where the current period continues from, such as a
+// pharmacy moving over mid-year from another billing system
+type SeedSeriesRequest struct {
+	NextNumber int `json:"next_number" validate:"required,min=1"`
+}
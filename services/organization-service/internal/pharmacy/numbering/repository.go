@@ -0,0 +1,144 @@
+package numbering
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	ListSeries(ctx context.Context, pharmacyID uuid.UUID) (map[DocumentType]Series, error)
+	UpsertSeries(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, cfg Config, userID uuid.UUID, userName string) error
+	LastNumber(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, period string) (int, error)
+	// Seed moves the period's counter so the next number issued is last+1. It refuses to
+	// move below a number already issued, which would hand out duplicates.
+	Seed(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, period string, last int) error
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+// Next allocates the next number of the pharmacy's series for docType inside
+// tx, the transaction that saves the document. The counter row stays locked
+// until tx ends, so concurrent documents are numbered one after another, and a
+// rollback returns the number to the series.
+func Next(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, docType DocumentType, at time.Time) (string, error) {
+	cfg, ok := defaults[docType]
+	if !ok {
+		return "", fmt.Errorf("unknown document type %s", docType)
+	}
+	err := tx.QueryRowContext(ctx, `
+		SELECT prefix, reset_policy, padding FROM sales_schema.document_series
+		WHERE pharmacy_id = $1 AND document_type = $2`, pharmacyID, docType).Scan(&cfg.Prefix, &cfg.ResetPolicy, &cfg.Padding)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to load %s series: %w", docType, err)
+	}
+
+	period := cfg.period(at)
+	var n int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO sales_schema.document_series_counters (pharmacy_id, document_type, period, last_number, updated_at)
+		VALUES ($1, $2, $3, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (pharmacy_id, document_type, period)
+		DO UPDATE SET last_number = document_series_counters.last_number + 1, updated_at = CURRENT_TIMESTAMP
+		RETURNING last_number`, pharmacyID, docType, period).Scan(&n)
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate %s number: %w", docType, err)
+	}
+	// Refusing rolls tx back, so the counter does not move past the limit
+	if err := checkWidth(docType, cfg, period, n); err != nil {
+		return "", fmt.Errorf("%w; shorten the series prefix", err)
+	}
+	return cfg.format(period, n), nil
+}
+
+func (r *postgresRepository) ListSeries(ctx context.Context, pharmacyID uuid.UUID) (map[DocumentType]Series, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT document_type, prefix, reset_policy, padding, COALESCE(updated_by_name, ''), updated_at
+		FROM sales_schema.document_series
+		WHERE pharmacy_id = $1`, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := map[DocumentType]Series{}
+	for rows.Next() {
+		var s Series
+		var updatedAt time.Time
+		if err := rows.Scan(&s.DocumentType, &s.Prefix, &s.ResetPolicy, &s.Padding, &s.UpdatedByName, &updatedAt); err != nil {
+			return nil, err
+		}
+		s.Customized = true
+		s.UpdatedAt = &updatedAt
+		series[s.DocumentType] = s
+	}
+	return series, rows.Err()
+}
+
+func (r *postgresRepository) UpsertSeries(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, cfg Config, userID uuid.UUID, userName string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.document_series (pharmacy_id, document_type, prefix, reset_policy, padding, updated_by, updated_by_name, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+		ON CONFLICT (pharmacy_id, document_type) DO UPDATE SET
+			prefix = EXCLUDED.prefix, reset_policy = EXCLUDED.reset_policy, padding = EXCLUDED.padding,
+			updated_by = EXCLUDED.updated_by, updated_by_name = EXCLUDED.updated_by_name, updated_at = EXCLUDED.updated_at`,
+		pharmacyID, docType, cfg.Prefix, cfg.ResetPolicy, cfg.Padding, userID, userName)
+	if err != nil {
+		return fmt.Errorf("failed to save %s series: %w", docType, err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) LastNumber(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, period string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT last_number FROM sales_schema.document_series_counters
+		WHERE pharmacy_id = $1 AND document_type = $2 AND period = $3`, pharmacyID, docType, period).Scan(&n)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (r *postgresRepository) Seed(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, period string, last int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Taking the row lock first waits out any document being numbered right now
+	var issued int
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sales_schema.document_series_counters (pharmacy_id, document_type, period, last_number)
+		VALUES ($1, $2, $3, 0)
+		ON CONFLICT (pharmacy_id, document_type, period) DO NOTHING`, pharmacyID, docType, period)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT last_number FROM sales_schema.document_series_counters
+		WHERE pharmacy_id = $1 AND document_type = $2 AND period = $3
+		FOR UPDATE`, pharmacyID, docType, period).Scan(&issued); err != nil {
+		return err
+	}
+	if last < issued {
+		return fmt.Errorf("numbers up to %d are already issued in %s; the next number must be at least %d", issued, period, issued+1)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE sales_schema.document_series_counters SET last_number = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE pharmacy_id = $1 AND document_type = $2 AND period = $3`, pharmacyID, docType, period, last); err != nil {
+		return fmt.Errorf("failed to seed %s series: %w", docType, err)
+	}
+	return tx.Commit()
+}
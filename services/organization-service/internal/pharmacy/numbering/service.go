@@ -0,0 +1,140 @@
+package numbering
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GST allows at most 16 characters in invoice and credit note numbers
+const maxTaxDocumentNoLength = 16
+
+var prefixPattern = regexp.MustCompile(`^[A-Za-z0-9/-]*$`)
+
+// checkWidth keeps invoice and credit note numbers within GST's 16 characters.
+// Padding is only the minimum width: a sequence that outgrows it, as one that
+// never resets eventually does, makes the number longer, so the number itself
+// is measured.
+func checkWidth(docType DocumentType, cfg Config, period string, n int) error {
+	if docType != DocSaleInvoice && docType != DocCreditNote {
+		return nil
+	}
+	if no := cfg.format(period, n); len(no) > maxTaxDocumentNoLength {
+		return fmt.Errorf("%s number %s runs to %d characters; GST allows at most %d", docType, no, len(no), maxTaxDocumentNoLength)
+	}
+	return nil
+}
+
+// FitsGST reports whether an invoice or credit note number is short enough for
+// GST; numbers issued before the series existed are not
+func FitsGST(no string) bool {
+	return len(no) <= maxTaxDocumentNoLength
+}
+
+type Service interface {
+	// ListSeries returns every document series with the number it issues next
+	ListSeries(ctx context.Context, pharmacyID uuid.UUID) ([]Series, error)
+	UpdateSeries(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, docType DocumentType, req UpdateSeriesRequest) (*Series, error)
+	// SeedSeries sets the number the current period continues from
+	SeedSeries(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, req SeedSeriesRequest) (*Series, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+// ParseDocumentType checks a document type given in a request
+func ParseDocumentType(s string) (DocumentType, error) {
+	docType := DocumentType(s)
+	if _, ok := defaults[docType]; !ok {
+		return "", fmt.Errorf("unknown document type %s", s)
+	}
+	return docType, nil
+}
+
+func (s *service) ListSeries(ctx context.Context, pharmacyID uuid.UUID) ([]Series, error) {
+	stored, err := s.repo.ListSeries(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	list := make([]Series, 0, len(DocumentTypes))
+	for _, docType := range DocumentTypes {
+		series, ok := stored[docType]
+		if !ok {
+			series = Series{DocumentType: docType, Config: defaults[docType]}
+		}
+		if err := s.fillCounter(ctx, pharmacyID, &series, now); err != nil {
+			return nil, err
+		}
+		list = append(list, series)
+	}
+	return list, nil
+}
+
+func (s *service) series(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType) (*Series, error) {
+	list, err := s.ListSeries(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].DocumentType == docType {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown document type %s", docType)
+}
+
+func (s *service) fillCounter(ctx context.Context, pharmacyID uuid.UUID, series *Series, at time.Time) error {
+	series.Period = series.period(at)
+	last, err := s.repo.LastNumber(ctx, pharmacyID, series.DocumentType, series.Period)
+	if err != nil {
+		return err
+	}
+	series.LastNumber = last
+	series.NextDocumentNo = series.format(series.Period, last+1)
+	return nil
+}
+
+func (s *service) UpdateSeries(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, docType DocumentType, req UpdateSeriesRequest) (*Series, error) {
+	cfg := Config{Prefix: req.Prefix, ResetPolicy: req.ResetPolicy, Padding: req.Padding}
+	if !prefixPattern.MatchString(cfg.Prefix) {
+		return nil, fmt.Errorf("prefix may only contain letters, digits, / and -")
+	}
+	// The series carries on from its counter, which may already be wider than the padding
+	period := cfg.period(time.Now())
+	last, err := s.repo.LastNumber(ctx, pharmacyID, docType, period)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWidth(docType, cfg, period, last+1); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpsertSeries(ctx, pharmacyID, docType, cfg, userID, userName); err != nil {
+		return nil, err
+	}
+	return s.series(ctx, pharmacyID, docType)
+}
+
+func (s *service) SeedSeries(ctx context.Context, pharmacyID uuid.UUID, docType DocumentType, req SeedSeriesRequest) (*Series, error) {
+	current, err := s.series(ctx, pharmacyID, docType)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWidth(docType, current.Config, current.Period, req.NextNumber); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Seed(ctx, pharmacyID, docType, current.Period, req.NextNumber-1); err != nil {
+		return nil, err
+	}
+	return s.series(ctx, pharmacyID, docType)
+}
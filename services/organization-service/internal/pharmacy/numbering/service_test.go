@@ -0,0 +1,214 @@
+package numbering
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepository serves stored series and counters and records what is saved
+type fakeRepository struct {
+	stored   map[DocumentType]Series
+	last     int
+	upserted *Config
+	seeded   *int
+}
+
+func (f *fakeRepository) ListSeries(context.Context, uuid.UUID) (map[DocumentType]Series, error) {
+	stored := make(map[DocumentType]Series)
+	for k, v := range f.stored {
+		stored[k] = v
+	}
+	if f.upserted != nil {
+		stored[DocSaleInvoice] = Series{DocumentType: DocSaleInvoice, Config: *f.upserted, Customized: true}
+	}
+	return stored, nil
+}
+
+func (f *fakeRepository) UpsertSeries(_ context.Context, _ uuid.UUID, _ DocumentType, cfg Config, _ uuid.UUID, _ string) error {
+	f.upserted = &cfg
+	return nil
+}
+
+func (f *fakeRepository) LastNumber(context.Context, uuid.UUID, DocumentType, string) (int, error) {
+	if f.seeded != nil {
+		return *f.seeded, nil
+	}
+	return f.last, nil
+}
+
+func (f *fakeRepository) Seed(_ context.Context, _ uuid.UUID, _ DocumentType, _ string, last int) error {
+	f.seeded = &last
+	return nil
+}
+
+func TestFinancialYear(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2026, time.April, 1, 0, 0, 0, 0, ist), "2026-27"},
+		{time.Date(2026, time.March, 31, 23, 59, 0, 0, ist), "2025-26"},
+		{time.Date(2027, time.January, 15, 12, 0, 0, 0, ist), "2026-27"},
+		// 31 March 19:00 UTC is already 1 April in India
+		{time.Date(2026, time.March, 31, 19, 0, 0, 0, time.UTC), "2026-27"},
+		{time.Date(2099, time.June, 1, 0, 0, 0, 0, ist), "2099-00"},
+	}
+
+	for _, tt := range tests {
+		if got := financialYear(tt.at); got != tt.want {
+			t.Errorf("financialYear(%v) = %s, want %s", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	at := time.Date(2026, time.May, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		cfg  Config
+		n    int
+		want string
+	}{
+		{"financial year default", defaults[DocSaleInvoice], 42, "INV/26-27/00042"},
+		{"never resets", Config{Prefix: "B-", ResetPolicy: ResetNever, Padding: 6}, 42, "B-000042"},
+		{"no prefix", Config{ResetPolicy: ResetFinancialYear, Padding: 3}, 7, "26-27/007"},
+		{"outgrows the padding", Config{Prefix: "INV/", ResetPolicy: ResetFinancialYear, Padding: 2}, 1234, "INV/26-27/1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.format(tt.cfg.period(at), tt.n); got != tt.want {
+				t.Errorf("format() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWidth(t *testing.T) {
+	long := Config{Prefix: "SHOPIN/", ResetPolicy: ResetFinancialYear, Padding: 3}
+
+	tests := []struct {
+		name    string
+		docType DocumentType
+		cfg     Config
+		period  string
+		n       int
+		wantErr bool
+	}{
+		{"default invoice", DocSaleInvoice, defaults[DocSaleInvoice], "2026-27", 1, false},
+		{"exactly 16", DocSaleInvoice, long, "2026-27", 999, false},
+		{"outgrown past 16", DocSaleInvoice, long, "2026-27", 1000, true},
+		{"credit note too long", DocCreditNote, Config{Prefix: "CREDITNOTE/", ResetPolicy: ResetFinancialYear, Padding: 5}, "2026-27", 1, true},
+		{"never-reset counter grows", DocSaleInvoice, Config{Prefix: "INVOICE-", ResetPolicy: ResetNever, Padding: 8}, periodAll, 123456789, true},
+		{"other documents are not limited", DocPurchaseOrder, Config{Prefix: "PURCHASE/", ResetPolicy: ResetFinancialYear, Padding: 8}, "2026-27", 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkWidth(tt.docType, tt.cfg, tt.period, tt.n); (err != nil) != tt.wantErr {
+				t.Errorf("checkWidth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFitsGST(t *testing.T) {
+	tests := []struct {
+		no   string
+		want bool
+	}{
+		{"INV/26-27/00042", true},
+		{"SHOPIN/26-27/999", true},
+		{"INV-20250604-1a2b3c4d", false},
+	}
+
+	for _, tt := range tests {
+		if got := FitsGST(tt.no); got != tt.want {
+			t.Errorf("FitsGST(%s) = %v, want %v", tt.no, got, tt.want)
+		}
+	}
+}
+
+func TestParseDocumentType(t *testing.T) {
+	for _, docType := range DocumentTypes {
+		if _, err := ParseDocumentType(string(docType)); err != nil {
+			t.Errorf("ParseDocumentType(%s) error = %v", docType, err)
+		}
+	}
+	if _, err := ParseDocumentType("sale_invoice"); err == nil {
+		t.Error("ParseDocumentType() accepted a lower-case type")
+	}
+}
+
+func TestUpdateSeries(t *testing.T) {
+	tests := []struct {
+		name    string
+		last    int
+		req     UpdateSeriesRequest
+		wantErr bool
+	}{
+		{"shorter prefix", 10, UpdateSeriesRequest{Prefix: "S/", ResetPolicy: ResetFinancialYear, Padding: 4}, false},
+		{"no prefix", 10, UpdateSeriesRequest{ResetPolicy: ResetNever, Padding: 6}, false},
+		{"prefix with spaces", 10, UpdateSeriesRequest{Prefix: "INV ", ResetPolicy: ResetFinancialYear, Padding: 5}, true},
+		{"too long for GST", 10, UpdateSeriesRequest{Prefix: "PHARMA/", ResetPolicy: ResetFinancialYear, Padding: 5}, true},
+		{"counter already wider than the padding", 99999, UpdateSeriesRequest{Prefix: "INV/", ResetPolicy: ResetFinancialYear, Padding: 3}, false},
+		{"counter too wide for the prefix", 99999, UpdateSeriesRequest{Prefix: "INVC/", ResetPolicy: ResetFinancialYear, Padding: 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{last: tt.last}
+			got, err := NewService(repo).UpdateSeries(context.Background(), uuid.New(), uuid.New(), "Owner", DocSaleInvoice, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateSeries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if repo.upserted != nil {
+					t.Error("series saved despite the error")
+				}
+				return
+			}
+			if !got.Customized || got.Prefix != tt.req.Prefix || got.LastNumber != tt.last {
+				t.Errorf("series = %+v", got)
+			}
+		})
+	}
+}
+
+func TestSeedSeries(t *testing.T) {
+	tests := []struct {
+		name     string
+		next     int
+		wantLast int
+		wantErr  bool
+	}{
+		{"continue from another system", 1501, 1500, false},
+		{"fits the default series", 999999, 999998, false},
+		{"past what GST allows", 1000000, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{}
+			got, err := NewService(repo).SeedSeries(context.Background(), uuid.New(), DocSaleInvoice, SeedSeriesRequest{NextNumber: tt.next})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SeedSeries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if repo.seeded != nil {
+					t.Error("counter moved despite the error")
+				}
+				return
+			}
+			if *repo.seeded != tt.wantLast || got.LastNumber != tt.wantLast {
+				t.Errorf("seeded %d (series shows %d), want %d", *repo.seeded, got.LastNumber, tt.wantLast)
+			}
+		})
+	}
+}
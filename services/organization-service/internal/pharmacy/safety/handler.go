@@ -0,0 +1,202 @@
+package safety
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"organization-service/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+// Check runs the rule engine without touching a prescription or sale
+func (h *Handler) Check(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	var req CheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	allergies := []string{req.Allergies}
+	if req.PatientID != nil {
+		recorded, err := h.svc.GetPatientAllergies(c.Request.Context(), pharmacyID, *req.PatientID)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		allergies = append(allergies, recorded)
+	}
+
+	result, err := h.svc.Check(c.Request.Context(), pharmacyID, CheckInput{
+		Products:  req.ProductIDs,
+		Existing:  req.ExistingProductIDs,
+		Allergies: allergies,
+	})
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, result)
+}
+
+// ImportInteractions accepts a CSV upload ("file") or a JSON array of interactions
+func (h *Handler) ImportInteractions(c *gin.Context) {
+	var items []InteractionInput
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "CSV file is required")
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "Unable to read uploaded file")
+			return
+		}
+		defer f.Close()
+		if items, err = ParseInteractionsCSV(f); err != nil {
+			h.respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if err := c.ShouldBindJSON(&items); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	if len(items) == 0 {
+		h.respondError(c, http.StatusBadRequest, "No interactions to import")
+		return
+	}
+
+	res, err := h.svc.ImportInteractions(c.Request.Context(), items)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, res)
+}
+
+// ImportAllergens accepts a CSV upload ("file") or a JSON array of allergen mappings
+func (h *Handler) ImportAllergens(c *gin.Context) {
+	var items []AllergenInput
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "CSV file is required")
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "Unable to read uploaded file")
+			return
+		}
+		defer f.Close()
+		if items, err = ParseAllergensCSV(f); err != nil {
+			h.respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if err := c.ShouldBindJSON(&items); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	if len(items) == 0 {
+		h.respondError(c, http.StatusBadRequest, "No allergen mappings to import")
+		return
+	}
+
+	res, err := h.svc.ImportAllergenIngredients(c.Request.Context(), items)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, res)
+}
+
+func (h *Handler) ListInteractions(c *gin.Context) {
+	limit := 50
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := strconv.Atoi(o); err == nil {
+			offset = val
+		}
+	}
+
+	items, total, err := h.svc.ListInteractions(c.Request.Context(), c.Query("search"), limit, offset)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    items,
+		"meta": gin.H{
+			"total":  total,
+			"limit":  limit,
+			"offset": offset,
+		},
+	})
+}
+
+func (h *Handler) ListAllergens(c *gin.Context) {
+	items, err := h.svc.ListAllergenIngredients(c.Request.Context(), c.Query("search"))
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, items)
+}
+
+// RespondOverrideRequired writes the 409 used by prescriptions and sales when
+// MAJOR warnings were raised without an override reason.
+func RespondOverrideRequired(c *gin.Context, err *OverrideRequiredError) {
+	c.JSON(http.StatusConflict, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"data":    err.Result,
+	})
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, gin.H{"success": true, "data": data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"success": false, "error": message})
+}
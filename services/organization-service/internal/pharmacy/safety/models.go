@@ -0,0 +1,141 @@
+package safety
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Severity string
+
+const (
+	SeverityMinor    Severity = "MINOR"
+	SeverityModerate Severity = "MODERATE"
+	SeverityMajor    Severity = "MAJOR"
+)
+
+// rank orders severities so the highest warning can be reported
+func (s Severity) rank() int {
+	switch s {
+	case SeverityMajor:
+		return 3
+	case SeverityModerate:
+		return 2
+	case SeverityMinor:
+		return 1
+	}
+	return 0
+}
+
+func ParseSeverity(raw string) (Severity, bool) {
+	switch s := Severity(normalizeUpper(raw)); s {
+	case SeverityMinor, SeverityModerate, SeverityMajor:
+		return s, true
+	}
+	return "", false
+}
+
+type WarningType string
+
+const (
+	WarningInteraction WarningType = "INTERACTION"
+	WarningAllergy     WarningType = "ALLERGY"
+)
+
+type Interaction struct {
+	ID          uuid.UUID `json:"id"`
+	GenericA    string    `json:"generic_a"`
+	GenericB    string    `json:"generic_b"`
+	Severity    Severity  `json:"severity"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type AllergenIngredient struct {
+	ID         uuid.UUID `json:"id"`
+	Allergen   string    `json:"allergen"`
+	Ingredient string    `json:"ingredient"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Product is a medicine resolved to its generic ingredients
+type Product struct {
+	ID          uuid.UUID `json:"product_id"`
+	Name        string    `json:"name"`
+	BrandName   string    `json:"brand_name"`
+	Ingredients []string  `json:"ingredients"`
+}
+
+type Warning struct {
+	Type            WarningType `json:"type"`
+	Severity        Severity    `json:"severity"`
+	ProductID       uuid.UUID   `json:"product_id"`
+	Medicine        string      `json:"medicine"`
+	Ingredient      string      `json:"ingredient"`
+	OtherID         *uuid.UUID  `json:"other_product_id,omitempty"`
+	Other           string      `json:"other_medicine,omitempty"`
+	OtherIngredient string      `json:"other_ingredient,omitempty"`
+	Allergen        string      `json:"allergen,omitempty"`
+	Description     string      `json:"description"`
+}
+
+type CheckResult struct {
+	Warnings         []Warning `json:"warnings"`
+	HighestSeverity  Severity  `json:"highest_severity,omitempty"`
+	RequiresOverride bool      `json:"requires_override"`
+}
+
+// CheckInput describes what is being added (Products) against what is already
+// on the prescription or bill (Existing). Pairs within Existing are not re-checked.
+type CheckInput struct {
+	Products  []uuid.UUID
+	Existing  []uuid.UUID
+	Allergies []string
+}
+
+// OverrideRequiredError is returned when MAJOR warnings were raised and no override reason was given
+type OverrideRequiredError struct {
+	Result *CheckResult
+}
+
+func (e *OverrideRequiredError) Error() string {
+	return fmt.Sprintf("%d major drug safety warning(s) require an override reason", e.MajorCount())
+}
+
+func (e *OverrideRequiredError) MajorCount() int {
+	n := 0
+	for _, w := range e.Result.Warnings {
+		if w.Severity == SeverityMajor {
+			n++
+		}
+	}
+	return n
+}
+
+// Request/Response Structs
+
+type CheckRequest struct {
+	ProductIDs         []uuid.UUID `json:"product_ids" validate:"required,min=1"`
+	ExistingProductIDs []uuid.UUID `json:"existing_product_ids"`
+	Allergies          string      `json:"allergies"`
+	PatientID          *uuid.UUID  `json:"patient_id"`
+}
+
+type InteractionInput struct {
+	GenericA    string `json:"generic_a" validate:"required"`
+	GenericB    string `json:"generic_b" validate:"required"`
+	Severity    string `json:"severity" validate:"required"`
+	Description string `json:"description"`
+}
+
+type AllergenInput struct {
+	Allergen   string `json:"allergen" validate:"required"`
+	Ingredient string `json:"ingredient" validate:"required"`
+}
+
+type ImportResult struct {
+	Imported int      `json:"imported"`
+	Skipped  []string `json:"skipped"`
+}
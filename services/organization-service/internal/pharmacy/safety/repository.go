@@ -0,0 +1,229 @@
+package safety
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	// GetProducts loads the generic names of the given medicines in a pharmacy
+	GetProducts(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) ([]Product, error)
+	GetPatientAllergies(ctx context.Context, pharmacyID, patientID uuid.UUID) (string, error)
+
+	// FindInteractions returns every known pair where both generics are in the given set
+	FindInteractions(ctx context.Context, generics []string) ([]Interaction, error)
+	// FindAllergenIngredients returns the ingredient mappings for the given allergens
+	FindAllergenIngredients(ctx context.Context, allergens []string) ([]AllergenIngredient, error)
+
+	UpsertInteractions(ctx context.Context, items []Interaction) (int, error)
+	UpsertAllergenIngredients(ctx context.Context, items []AllergenIngredient) (int, error)
+	ListInteractions(ctx context.Context, search string, limit, offset int) ([]Interaction, int, error)
+	ListAllergenIngredients(ctx context.Context, search string) ([]AllergenIngredient, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) GetProducts(ctx context.Context, pharmacyID uuid.UUID, ids []uuid.UUID) ([]Product, error) {
+	query := `
+		SELECT id, name, COALESCE(brand_name, '')
+		FROM inventory.medicines
+		WHERE pharmacy_id = $1 AND id = ANY($2)
+	`
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, query, pharmacyID, pq.Array(strIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.BrandName); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+func (r *postgresRepository) GetPatientAllergies(ctx context.Context, pharmacyID, patientID uuid.UUID) (string, error) {
+	var allergies string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(allergies, '') FROM sales_schema.patients WHERE id = $1 AND pharmacy_id = $2
+	`, patientID, pharmacyID).Scan(&allergies)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return allergies, err
+}
+
+func (r *postgresRepository) FindInteractions(ctx context.Context, generics []string) ([]Interaction, error) {
+	if len(generics) < 2 {
+		return nil, nil
+	}
+	query := `
+		SELECT id, generic_a, generic_b, severity, COALESCE(description, ''), created_at, updated_at
+		FROM inventory.drug_interactions
+		WHERE generic_a = ANY($1) AND generic_b = ANY($1)
+	`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(generics))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanInteractions(rows)
+}
+
+func (r *postgresRepository) FindAllergenIngredients(ctx context.Context, allergens []string) ([]AllergenIngredient, error) {
+	if len(allergens) == 0 {
+		return nil, nil
+	}
+	query := `
+		SELECT id, allergen, ingredient, created_at
+		FROM inventory.allergen_ingredients
+		WHERE allergen = ANY($1)
+	`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(allergens))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAllergenIngredients(rows)
+}
+
+func (r *postgresRepository) UpsertInteractions(ctx context.Context, items []Interaction) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO inventory.drug_interactions (id, generic_a, generic_b, severity, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (generic_a, generic_b) DO UPDATE
+		SET severity = EXCLUDED.severity,
+		    description = EXCLUDED.description,
+		    updated_at = NOW()
+	`
+	for i, it := range items {
+		if _, err := tx.ExecContext(ctx, query, uuid.New(), it.GenericA, it.GenericB, it.Severity, it.Description); err != nil {
+			return 0, fmt.Errorf("failed to import interaction %d (%s / %s): %w", i+1, it.GenericA, it.GenericB, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+func (r *postgresRepository) UpsertAllergenIngredients(ctx context.Context, items []AllergenIngredient) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO inventory.allergen_ingredients (id, allergen, ingredient, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (allergen, ingredient) DO NOTHING
+	`
+	imported := 0
+	for i, it := range items {
+		res, err := tx.ExecContext(ctx, query, uuid.New(), it.Allergen, it.Ingredient)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import allergen mapping %d (%s / %s): %w", i+1, it.Allergen, it.Ingredient, err)
+		}
+		n, _ := res.RowsAffected()
+		imported += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+func (r *postgresRepository) ListInteractions(ctx context.Context, search string, limit, offset int) ([]Interaction, int, error) {
+	where := ""
+	args := []interface{}{}
+	if search != "" {
+		where = "WHERE generic_a ILIKE $1 OR generic_b ILIKE $1"
+		args = append(args, "%"+search+"%")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory.drug_interactions "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, generic_a, generic_b, severity, COALESCE(description, ''), created_at, updated_at
+		FROM inventory.drug_interactions
+		%s
+		ORDER BY generic_a, generic_b
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items, err := scanInteractions(rows)
+	return items, total, err
+}
+
+func (r *postgresRepository) ListAllergenIngredients(ctx context.Context, search string) ([]AllergenIngredient, error) {
+	query := `
+		SELECT id, allergen, ingredient, created_at
+		FROM inventory.allergen_ingredients
+		WHERE $1 = '' OR allergen ILIKE '%' || $1 || '%' OR ingredient ILIKE '%' || $1 || '%'
+		ORDER BY allergen, ingredient
+	`
+	rows, err := r.db.QueryContext(ctx, query, search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAllergenIngredients(rows)
+}
+
+func scanInteractions(rows *sql.Rows) ([]Interaction, error) {
+	var items []Interaction
+	for rows.Next() {
+		var it Interaction
+		if err := rows.Scan(&it.ID, &it.GenericA, &it.GenericB, &it.Severity, &it.Description, &it.CreatedAt, &it.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func scanAllergenIngredients(rows *sql.Rows) ([]AllergenIngredient, error) {
+	var items []AllergenIngredient
+	for rows.Next() {
+		var it AllergenIngredient
+		if err := rows.Scan(&it.ID, &it.Allergen, &it.Ingredient, &it.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,386 @@
+package safety
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	// Check evaluates interactions and allergies for the products being added
+	Check(ctx context.Context, pharmacyID uuid.UUID, in CheckInput) (*CheckResult, error)
+	GetPatientAllergies(ctx context.Context, pharmacyID, patientID uuid.UUID) (string, error)
+	ImportInteractions(ctx context.Context, items []InteractionInput) (*ImportResult, error)
+	ImportAllergenIngredients(ctx context.Context, items []AllergenInput) (*ImportResult, error)
+	ListInteractions(ctx context.Context, search string, limit, offset int) ([]Interaction, int, error)
+	ListAllergenIngredients(ctx context.Context, search string) ([]AllergenIngredient, error)
+}
+
+type safetyService struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &safetyService{repo: repo}
+}
+
+// RequireOverride blocks MAJOR warnings unless a non-empty override reason is given
+func RequireOverride(result *CheckResult, reason string) error {
+	if result != nil && result.RequiresOverride && strings.TrimSpace(reason) == "" {
+		return &OverrideRequiredError{Result: result}
+	}
+	return nil
+}
+
+func (s *safetyService) Check(ctx context.Context, pharmacyID uuid.UUID, in CheckInput) (*CheckResult, error) {
+	result := &CheckResult{Warnings: []Warning{}}
+	if len(in.Products) == 0 {
+		return result, nil
+	}
+
+	ids := append(append([]uuid.UUID{}, in.Products...), in.Existing...)
+	products, err := s.repo.GetProducts(ctx, pharmacyID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load medicines: %w", err)
+	}
+	byID := make(map[uuid.UUID]Product, len(products))
+	genericSet := make(map[string]bool)
+	for _, p := range products {
+		p.Ingredients = Ingredients(p.Name)
+		byID[p.ID] = p
+		for _, g := range p.Ingredients {
+			genericSet[g] = true
+		}
+	}
+
+	// 1. Interactions: new x new and new x existing
+	generics := make([]string, 0, len(genericSet))
+	for g := range genericSet {
+		generics = append(generics, g)
+	}
+	interactions, err := s.repo.FindInteractions(ctx, generics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load interactions: %w", err)
+	}
+	if len(interactions) > 0 {
+		pairs := make(map[[2]string]Interaction, len(interactions))
+		for _, it := range interactions {
+			pairs[[2]string{it.GenericA, it.GenericB}] = it
+		}
+
+		seen := make(map[string]bool)
+		for i, pid := range in.Products {
+			p, ok := byID[pid]
+			if !ok {
+				continue
+			}
+			others := append(append([]uuid.UUID{}, in.Products[i+1:]...), in.Existing...)
+			for _, oid := range others {
+				o, ok := byID[oid]
+				if !ok || oid == pid {
+					continue
+				}
+				for _, a := range p.Ingredients {
+					for _, b := range o.Ingredients {
+						it, ok := pairs[orderedPair(a, b)]
+						if !ok {
+							continue
+						}
+						key := fmt.Sprintf("%s|%s|%s|%s", pid, oid, a, b)
+						if seen[key] {
+							continue
+						}
+						seen[key] = true
+						otherID := oid
+						result.Warnings = append(result.Warnings, Warning{
+							Type:            WarningInteraction,
+							Severity:        it.Severity,
+							ProductID:       pid,
+							Medicine:        p.Name,
+							Ingredient:      a,
+							OtherID:         &otherID,
+							Other:           o.Name,
+							OtherIngredient: b,
+							Description:     interactionDescription(it, a, b),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	// 2. Allergies: every new product against the patient's recorded allergies
+	allergens := ParseAllergies(strings.Join(in.Allergies, ","))
+	if len(allergens) > 0 {
+		mappings, err := s.repo.FindAllergenIngredients(ctx, allergens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load allergen mappings: %w", err)
+		}
+		triggers := make(map[string][]string) // ingredient -> allergens
+		for _, a := range allergens {
+			// An allergy recorded against a generic name matches it directly
+			triggers[a] = append(triggers[a], a)
+		}
+		for _, m := range mappings {
+			if m.Ingredient != m.Allergen {
+				triggers[m.Ingredient] = append(triggers[m.Ingredient], m.Allergen)
+			}
+		}
+
+		for _, pid := range in.Products {
+			p, ok := byID[pid]
+			if !ok {
+				continue
+			}
+			for _, ingr := range p.Ingredients {
+				for _, allergen := range triggers[ingr] {
+					result.Warnings = append(result.Warnings, Warning{
+						Type:        WarningAllergy,
+						Severity:    SeverityMajor,
+						ProductID:   pid,
+						Medicine:    p.Name,
+						Ingredient:  ingr,
+						Allergen:    allergen,
+						Description: fmt.Sprintf("Patient is allergic to %s; %s contains %s", allergen, p.Name, ingr),
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result.Warnings, func(i, j int) bool {
+		return result.Warnings[i].Severity.rank() > result.Warnings[j].Severity.rank()
+	})
+	if len(result.Warnings) > 0 {
+		result.HighestSeverity = result.Warnings[0].Severity
+		result.RequiresOverride = result.HighestSeverity == SeverityMajor
+	}
+	return result, nil
+}
+
+func (s *safetyService) GetPatientAllergies(ctx context.Context, pharmacyID, patientID uuid.UUID) (string, error) {
+	return s.repo.GetPatientAllergies(ctx, pharmacyID, patientID)
+}
+
+func (s *safetyService) ImportInteractions(ctx context.Context, items []InteractionInput) (*ImportResult, error) {
+	res := &ImportResult{Skipped: []string{}}
+	byPair := make(map[[2]string]int)
+	var rows []Interaction
+
+	for i, in := range items {
+		a, b := NormalizeGeneric(in.GenericA), NormalizeGeneric(in.GenericB)
+		sev, ok := ParseSeverity(in.Severity)
+		switch {
+		case a == "" || b == "":
+			res.Skipped = append(res.Skipped, fmt.Sprintf("row %d: both generics are required", i+1))
+			continue
+		case a == b:
+			res.Skipped = append(res.Skipped, fmt.Sprintf("row %d: %s cannot interact with itself", i+1, a))
+			continue
+		case !ok:
+			res.Skipped = append(res.Skipped, fmt.Sprintf("row %d: invalid severity %q", i+1, in.Severity))
+			continue
+		}
+
+		pair := orderedPair(a, b)
+		row := Interaction{GenericA: pair[0], GenericB: pair[1], Severity: sev, Description: strings.TrimSpace(in.Description)}
+		// Later rows win for duplicate pairs, same as the upsert
+		if idx, dup := byPair[pair]; dup {
+			rows[idx] = row
+			continue
+		}
+		byPair[pair] = len(rows)
+		rows = append(rows, row)
+	}
+
+	if len(rows) > 0 {
+		n, err := s.repo.UpsertInteractions(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		res.Imported = n
+	}
+	return res, nil
+}
+
+func (s *safetyService) ImportAllergenIngredients(ctx context.Context, items []AllergenInput) (*ImportResult, error) {
+	res := &ImportResult{Skipped: []string{}}
+	var rows []AllergenIngredient
+
+	for i, in := range items {
+		allergen, ingredient := NormalizeGeneric(in.Allergen), NormalizeGeneric(in.Ingredient)
+		if allergen == "" || ingredient == "" {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("row %d: allergen and ingredient are required", i+1))
+			continue
+		}
+		rows = append(rows, AllergenIngredient{Allergen: allergen, Ingredient: ingredient})
+	}
+
+	if len(rows) > 0 {
+		n, err := s.repo.UpsertAllergenIngredients(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		res.Imported = n
+	}
+	return res, nil
+}
+
+func (s *safetyService) ListInteractions(ctx context.Context, search string, limit, offset int) ([]Interaction, int, error) {
+	return s.repo.ListInteractions(ctx, NormalizeGeneric(search), limit, offset)
+}
+
+func (s *safetyService) ListAllergenIngredients(ctx context.Context, search string) ([]AllergenIngredient, error) {
+	return s.repo.ListAllergenIngredients(ctx, NormalizeGeneric(search))
+}
+
+// Name parsing
+
+var (
+	ingredientSeparators = regexp.MustCompile(`\s*(?:\+|&|,|/|;|\band\b|\bwith\b)\s*`)
+	strengthToken        = regexp.MustCompile(`(?i)^[0-9.]+\s*(mg|mcg|g|ml|iu|%|w/v|w/w)?$|^\(?[0-9]`)
+	allergySeparators    = regexp.MustCompile(`[,;\n]+|\band\b`)
+
+	// Units and dosage forms that often trail the generic name in inventory
+	nonIngredientWords = map[string]bool{
+		"mg": true, "mcg": true, "g": true, "ml": true, "iu": true, "%": true,
+		"tab": true, "tabs": true, "tablet": true, "tablets": true, "cap": true, "caps": true,
+		"capsule": true, "capsules": true, "syrup": true, "suspension": true, "injection": true,
+		"inj": true, "cream": true, "ointment": true, "gel": true, "drops": true, "sr": true,
+		"er": true, "xr": true, "cr": true, "ip": true, "bp": true, "usp": true,
+	}
+)
+
+// NormalizeGeneric lowercases and collapses whitespace so dataset and inventory names compare equal
+func NormalizeGeneric(raw string) string {
+	return strings.Join(strings.Fields(strings.ToLower(raw)), " ")
+}
+
+func normalizeUpper(raw string) string {
+	return strings.ToUpper(strings.TrimSpace(raw))
+}
+
+// Ingredients splits a generic name such as "Amoxicillin 500mg + Clavulanic Acid 125mg"
+// into its normalized ingredients ("amoxicillin", "clavulanic acid").
+func Ingredients(generic string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, part := range ingredientSeparators.Split(strings.ToLower(generic), -1) {
+		words := make([]string, 0)
+		for _, w := range strings.Fields(part) {
+			if strengthToken.MatchString(w) || nonIngredientWords[strings.Trim(w, "().")] {
+				continue
+			}
+			words = append(words, w)
+		}
+		name := strings.Join(words, " ")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// ParseAllergies splits free-text allergies ("Penicillin, sulfa drugs; aspirin") into normalized entries
+func ParseAllergies(text string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, part := range allergySeparators.Split(strings.ToLower(text), -1) {
+		a := NormalizeGeneric(strings.TrimSuffix(strings.TrimSpace(part), " allergy"))
+		switch a {
+		case "", "none", "nil", "na", "n/a", "no", "nka", "nkda", "no known allergies":
+			continue
+		}
+		if !seen[a] {
+			seen[a] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func orderedPair(a, b string) [2]string {
+	if a < b {
+		return [2]string{a, b}
+	}
+	return [2]string{b, a}
+}
+
+func interactionDescription(it Interaction, a, b string) string {
+	if it.Description != "" {
+		return it.Description
+	}
+	return fmt.Sprintf("%s interaction between %s and %s", it.Severity, a, b)
+}
+
+// CSV import
+
+// ParseInteractionsCSV reads "generic_a,generic_b,severity[,description]" rows; a header row is optional
+func ParseInteractionsCSV(r io.Reader) ([]InteractionInput, error) {
+	records, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var items []InteractionInput
+	for i, rec := range records {
+		if i == 0 && strings.Contains(strings.ToLower(strings.Join(rec, ",")), "severity") {
+			continue
+		}
+		item := InteractionInput{}
+		if len(rec) > 0 {
+			item.GenericA = rec[0]
+		}
+		if len(rec) > 1 {
+			item.GenericB = rec[1]
+		}
+		if len(rec) > 2 {
+			item.Severity = rec[2]
+		}
+		if len(rec) > 3 {
+			item.Description = rec[3]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ParseAllergensCSV reads "allergen,ingredient" rows; a header row is optional
+func ParseAllergensCSV(r io.Reader) ([]AllergenInput, error) {
+	records, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var items []AllergenInput
+	for i, rec := range records {
+		if i == 0 && len(rec) > 1 && strings.EqualFold(strings.TrimSpace(rec[0]), "allergen") {
+			continue
+		}
+		item := AllergenInput{}
+		if len(rec) > 0 {
+			item.Allergen = rec[0]
+		}
+		if len(rec) > 1 {
+			item.Ingredient = rec[1]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return records, nil
+}
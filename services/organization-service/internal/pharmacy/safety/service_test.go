@@ -0,0 +1,244 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestIngredients(t *testing.T) {
+	tests := []struct {
+		generic string
+		want    []string
+	}{
+		{"Paracetamol", []string{"paracetamol"}},
+		{"Paracetamol 500mg Tablet", []string{"paracetamol"}},
+		{"Amoxicillin 500mg + Clavulanic Acid 125mg", []string{"amoxicillin", "clavulanic acid"}},
+		{"Ibuprofen & Paracetamol", []string{"ibuprofen", "paracetamol"}},
+		{"Losartan/Hydrochlorothiazide", []string{"losartan", "hydrochlorothiazide"}},
+		{"Metformin SR (500 mg)", []string{"metformin"}},
+		{"Aspirin and aspirin", []string{"aspirin"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.generic, func(t *testing.T) {
+			if got := Ingredients(tt.generic); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ingredients(%q) = %q, want %q", tt.generic, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAllergies(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Penicillin, sulfa drugs; aspirin", []string{"penicillin", "sulfa drugs", "aspirin"}},
+		{"Penicillin allergy\nPENICILLIN", []string{"penicillin"}},
+		{"dust and  Peanuts", []string{"dust", "peanuts"}},
+		{"None", nil},
+		{"NKDA", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := ParseAllergies(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAllergies(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRepository serves the check lookups from memory
+type fakeRepository struct {
+	Repository
+	products     []Product
+	interactions []Interaction
+	allergens    []AllergenIngredient
+}
+
+func (f *fakeRepository) GetProducts(_ context.Context, _ uuid.UUID, ids []uuid.UUID) ([]Product, error) {
+	want := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	out := make([]Product, 0, len(ids))
+	for _, p := range f.products {
+		if want[p.ID] {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepository) FindInteractions(_ context.Context, generics []string) ([]Interaction, error) {
+	have := make(map[string]bool, len(generics))
+	for _, g := range generics {
+		have[g] = true
+	}
+	out := make([]Interaction, 0)
+	for _, it := range f.interactions {
+		if have[it.GenericA] && have[it.GenericB] {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepository) FindAllergenIngredients(_ context.Context, allergens []string) ([]AllergenIngredient, error) {
+	have := make(map[string]bool, len(allergens))
+	for _, a := range allergens {
+		have[a] = true
+	}
+	out := make([]AllergenIngredient, 0)
+	for _, m := range f.allergens {
+		if have[m.Allergen] {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func TestCheck(t *testing.T) {
+	warfarin := Product{ID: uuid.New(), Name: "Warfarin 5mg"}
+	aspirin := Product{ID: uuid.New(), Name: "Aspirin 75mg"}
+	ibuprofen := Product{ID: uuid.New(), Name: "Ibuprofen 400mg"}
+	augmentin := Product{ID: uuid.New(), Name: "Amoxicillin 500mg + Clavulanic Acid 125mg"}
+	paracetamol := Product{ID: uuid.New(), Name: "Paracetamol 500mg"}
+
+	repo := &fakeRepository{
+		products: []Product{warfarin, aspirin, ibuprofen, augmentin, paracetamol},
+		interactions: []Interaction{
+			{GenericA: "aspirin", GenericB: "warfarin", Severity: SeverityMajor, Description: "Bleeding risk"},
+			{GenericA: "aspirin", GenericB: "ibuprofen", Severity: SeverityModerate},
+		},
+		allergens: []AllergenIngredient{
+			{Allergen: "penicillin", Ingredient: "amoxicillin"},
+		},
+	}
+	svc := NewService(repo)
+
+	type warning struct {
+		typ      WarningType
+		severity Severity
+		medicine string
+	}
+	tests := []struct {
+		name         string
+		in           CheckInput
+		want         []warning
+		wantHighest  Severity
+		wantOverride bool
+	}{
+		{
+			name: "nothing to check",
+			in:   CheckInput{},
+		},
+		{
+			name: "no known interactions",
+			in:   CheckInput{Products: []uuid.UUID{paracetamol.ID, ibuprofen.ID}},
+		},
+		{
+			name:         "major interaction between new products",
+			in:           CheckInput{Products: []uuid.UUID{warfarin.ID, aspirin.ID}},
+			want:         []warning{{WarningInteraction, SeverityMajor, warfarin.Name}},
+			wantHighest:  SeverityMajor,
+			wantOverride: true,
+		},
+		{
+			name:        "new product against the existing bill",
+			in:          CheckInput{Products: []uuid.UUID{ibuprofen.ID}, Existing: []uuid.UUID{aspirin.ID}},
+			want:        []warning{{WarningInteraction, SeverityModerate, ibuprofen.Name}},
+			wantHighest: SeverityModerate,
+		},
+		{
+			name: "existing pairs are not re-checked",
+			in:   CheckInput{Products: []uuid.UUID{paracetamol.ID}, Existing: []uuid.UUID{warfarin.ID, aspirin.ID}},
+		},
+		{
+			name:         "allergy through a mapped ingredient",
+			in:           CheckInput{Products: []uuid.UUID{augmentin.ID}, Allergies: []string{"Penicillin"}},
+			want:         []warning{{WarningAllergy, SeverityMajor, augmentin.Name}},
+			wantHighest:  SeverityMajor,
+			wantOverride: true,
+		},
+		{
+			name:         "allergy recorded against the generic",
+			in:           CheckInput{Products: []uuid.UUID{paracetamol.ID}, Allergies: []string{"paracetamol"}},
+			want:         []warning{{WarningAllergy, SeverityMajor, paracetamol.Name}},
+			wantHighest:  SeverityMajor,
+			wantOverride: true,
+		},
+		{
+			name: "major warnings sort first",
+			in:   CheckInput{Products: []uuid.UUID{ibuprofen.ID, aspirin.ID, warfarin.ID}},
+			want: []warning{
+				{WarningInteraction, SeverityMajor, aspirin.Name},
+				{WarningInteraction, SeverityModerate, ibuprofen.Name},
+			},
+			wantHighest:  SeverityMajor,
+			wantOverride: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.Check(context.Background(), uuid.New(), tt.in)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if len(got.Warnings) != len(tt.want) {
+				t.Fatalf("got %d warnings, want %d: %+v", len(got.Warnings), len(tt.want), got.Warnings)
+			}
+			for i, w := range tt.want {
+				g := got.Warnings[i]
+				if g.Type != w.typ || g.Severity != w.severity || g.Medicine != w.medicine {
+					t.Errorf("warning[%d] = %s %s %s, want %s %s %s", i, g.Type, g.Severity, g.Medicine, w.typ, w.severity, w.medicine)
+				}
+			}
+			if got.HighestSeverity != tt.wantHighest {
+				t.Errorf("HighestSeverity = %q, want %q", got.HighestSeverity, tt.wantHighest)
+			}
+			if got.RequiresOverride != tt.wantOverride {
+				t.Errorf("RequiresOverride = %v, want %v", got.RequiresOverride, tt.wantOverride)
+			}
+		})
+	}
+}
+
+func TestRequireOverride(t *testing.T) {
+	major := &CheckResult{RequiresOverride: true, Warnings: []Warning{{Severity: SeverityMajor}, {Severity: SeverityMinor}}}
+	minor := &CheckResult{Warnings: []Warning{{Severity: SeverityMinor}}}
+
+	tests := []struct {
+		name    string
+		result  *CheckResult
+		reason  string
+		wantErr bool
+	}{
+		{"no result", nil, "", false},
+		{"minor warnings pass", minor, "", false},
+		{"major without reason", major, "", true},
+		{"major with blank reason", major, "   ", true},
+		{"major with reason", major, "Prescriber confirmed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RequireOverride(tt.result, tt.reason)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RequireOverride() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var override *OverrideRequiredError
+			if err != nil && (!errors.As(err, &override) || override.MajorCount() != 1) {
+				t.Errorf("RequireOverride() error = %v, want one major warning", err)
+			}
+		})
+	}
+}
@@ -3,11 +3,15 @@ package clients
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
+	"organization-service/internal/pharmacy/inventory/batches"
+	"organization-service/internal/pharmacy/inventory/reservations"
 	"organization-service/internal/pharmacy/sales/prescriptions"
 	"organization-service/middleware"
 
@@ -26,6 +30,7 @@ type ReturnItemRequest struct {
 
 type StockAvailability struct {
 	BatchID            uuid.UUID `json:"id"`
+	MedicineID         uuid.UUID `json:"medicine_id"`
 	BatchNo            string    `json:"batch_no"`
 	MedicineName       string    `json:"medicine_name"`
 	MedicineBrand      string    `json:"medicine_brand"`
@@ -43,15 +48,30 @@ type StockAvailability struct {
 	RackNo             string    `json:"rack_no"`
 }
 
+// ErrInsufficientStock is returned, wrapped, when a batch cannot cover the quantity to hold
+var ErrInsufficientStock = reservations.ErrInsufficientStock
+
 type InventoryClient interface {
 	GetAvailability(ctx context.Context, pharmacyID, productID uuid.UUID) ([]StockAvailability, error)
+	// ResolveLabel looks up the batch behind a scanned internal batch label
+	ResolveLabel(ctx context.Context, pharmacyID uuid.UUID, code string) (*StockAvailability, error)
 	ReserveStock(ctx context.Context, pharmacyID, productID, batchID uuid.UUID, quantity int) (string, error)
 	UpdateReservation(ctx context.Context, pharmacyID uuid.UUID, reservationID string, newQuantity int) error
+	// ExtendReservations keeps the holds of an active bill alive and returns the ids still held
+	ExtendReservations(ctx context.Context, pharmacyID uuid.UUID, reservationIDs []string) ([]string, error)
 	ConfirmStock(ctx context.Context, pharmacyID uuid.UUID, reservationID string) error
 	ReleaseStock(ctx context.Context, pharmacyID uuid.UUID, reservationID string) error
 	ReturnItems(ctx context.Context, pharmacyID uuid.UUID, items []ReturnItemRequest) error
 }
 
+// TxInventoryClient is implemented by clients that share the sales database;
+// FinalizeSale and ProcessReturn use it to move stock inside their own transaction
+type TxInventoryClient interface {
+	InventoryClient
+	ConfirmStockTx(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, reservationID string) error
+	ReturnItemsTx(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, items []ReturnItemRequest) error
+}
+
 type httpInventoryClient struct {
 	baseURL string
 	client  *http.Client
@@ -91,6 +111,34 @@ func (c *httpInventoryClient) GetAvailability(ctx context.Context, pharmacyID, p
 	return result.Data, nil
 }
 
+func (c *httpInventoryClient) ResolveLabel(ctx context.Context, pharmacyID uuid.UUID, code string) (*StockAvailability, error) {
+	endpoint := fmt.Sprintf("%s/batches/resolve?code=%s", c.baseURL, url.QueryEscape(code))
+	req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	req.Header.Set("X-Pharmacy-ID", pharmacyID.String())
+	req.Header.Set("Authorization", "Bearer "+middleware.GetRawToken(ctx))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("no batch found for label %s", code)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inventory service error: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data StockAvailability `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
 func (c *httpInventoryClient) ReserveStock(ctx context.Context, pharmacyID, productID, batchID uuid.UUID, quantity int) (string, error) {
 	url := fmt.Sprintf("%s/reservations", c.baseURL)
 	body, _ := json.Marshal(map[string]interface{}{
@@ -115,6 +163,9 @@ func (c *httpInventoryClient) ReserveStock(ctx context.Context, pharmacyID, prod
 			Error string `json:"error"`
 		}
 		json.NewDecoder(resp.Body).Decode(&errResp)
+		if resp.StatusCode == http.StatusConflict {
+			return "", fmt.Errorf("%w: %s", ErrInsufficientStock, errResp.Error)
+		}
 		if errResp.Error != "" {
 			return "", fmt.Errorf("inventory service error: %s", errResp.Error)
 		}
@@ -151,6 +202,37 @@ func (c *httpInventoryClient) UpdateReservation(ctx context.Context, pharmacyID
 	return nil
 }
 
+func (c *httpInventoryClient) ExtendReservations(ctx context.Context, pharmacyID uuid.UUID, reservationIDs []string) ([]string, error) {
+	url := fmt.Sprintf("%s/reservations/extend", c.baseURL)
+	body, _ := json.Marshal(map[string]interface{}{"ids": reservationIDs})
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Pharmacy-ID", pharmacyID.String())
+	req.Header.Set("Authorization", "Bearer "+middleware.GetRawToken(ctx))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inventory service error: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Held []string `json:"held"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Data.Held, nil
+}
+
+// ConfirmStock deducts the held stock at once, outside the sale's transaction;
+// FinalizeSale returns it through ReturnItems if the sale then fails to commit
 func (c *httpInventoryClient) ConfirmStock(ctx context.Context, pharmacyID uuid.UUID, reservationID string) error {
 	url := fmt.Sprintf("%s/reservations/%s/confirm", c.baseURL, reservationID)
 	req, _ := http.NewRequestWithContext(ctx, "POST", url, nil)
@@ -169,8 +251,8 @@ func (c *httpInventoryClient) ConfirmStock(ctx context.Context, pharmacyID uuid.
 }
 
 func (c *httpInventoryClient) ReleaseStock(ctx context.Context, pharmacyID uuid.UUID, reservationID string) error {
-	url := fmt.Sprintf("%s/reservations/%s", c.baseURL, reservationID)
-	req, _ := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	url := fmt.Sprintf("%s/reservations/%s/cancel", c.baseURL, reservationID)
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, nil)
 	req.Header.Set("X-Pharmacy-ID", pharmacyID.String())
 	req.Header.Set("Authorization", "Bearer "+middleware.GetRawToken(ctx))
 	resp, err := c.client.Do(req)
@@ -205,6 +287,151 @@ func (c *httpInventoryClient) ReturnItems(ctx context.Context, pharmacyID uuid.U
 	return nil
 }
 
+// LocalInventoryClient calls the inventory services in-process. The HTTP
+// client above remains for deployments that run inventory separately
+type LocalInventoryClient struct {
+	batches      batches.Service
+	reservations reservations.Service
+}
+
+func NewLocalInventoryClient(batchSvc batches.Service, resSvc reservations.Service) InventoryClient {
+	return &LocalInventoryClient{batches: batchSvc, reservations: resSvc}
+}
+
+func (l *LocalInventoryClient) GetAvailability(ctx context.Context, pharmacyID, productID uuid.UUID) ([]StockAvailability, error) {
+	// Same page the HTTP client gets from GET /batches?medicine_id=, soonest expiry first
+	list, _, err := l.batches.ListBatches(ctx, pharmacyID, &productID, 25, 0, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]StockAvailability, 0, len(list))
+	for _, b := range list {
+		out = append(out, toStockAvailability(b))
+	}
+	return out, nil
+}
+
+func (l *LocalInventoryClient) ResolveLabel(ctx context.Context, pharmacyID uuid.UUID, code string) (*StockAvailability, error) {
+	b, err := l.batches.ResolveLabel(ctx, pharmacyID, code)
+	if err != nil {
+		return nil, err
+	}
+	sa := toStockAvailability(*b)
+	return &sa, nil
+}
+
+func (l *LocalInventoryClient) ReserveStock(ctx context.Context, pharmacyID, productID, batchID uuid.UUID, quantity int) (string, error) {
+	res, err := l.reservations.Reserve(ctx, pharmacyID, reservations.CreateReservationRequest{
+		ProductID: productID,
+		BatchID:   batchID,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.ID.String(), nil
+}
+
+func (l *LocalInventoryClient) UpdateReservation(ctx context.Context, pharmacyID uuid.UUID, reservationID string, newQuantity int) error {
+	id, err := uuid.Parse(reservationID)
+	if err != nil {
+		return fmt.Errorf("invalid reservation id %q", reservationID)
+	}
+	return l.reservations.Update(ctx, pharmacyID, id, reservations.UpdateReservationRequest{Quantity: newQuantity})
+}
+
+func (l *LocalInventoryClient) ExtendReservations(ctx context.Context, pharmacyID uuid.UUID, reservationIDs []string) ([]string, error) {
+	ids := make([]uuid.UUID, 0, len(reservationIDs))
+	for _, rid := range reservationIDs {
+		id, err := uuid.Parse(rid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reservation id %q", rid)
+		}
+		ids = append(ids, id)
+	}
+	held, err := l.reservations.Extend(ctx, pharmacyID, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(held))
+	for i, id := range held {
+		out[i] = id.String()
+	}
+	return out, nil
+}
+
+func (l *LocalInventoryClient) ConfirmStock(ctx context.Context, pharmacyID uuid.UUID, reservationID string) error {
+	id, err := uuid.Parse(reservationID)
+	if err != nil {
+		return fmt.Errorf("invalid reservation id %q", reservationID)
+	}
+	return l.reservations.Confirm(ctx, pharmacyID, id)
+}
+
+func (l *LocalInventoryClient) ConfirmStockTx(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, reservationID string) error {
+	id, err := uuid.Parse(reservationID)
+	if err != nil {
+		return fmt.Errorf("invalid reservation id %q", reservationID)
+	}
+	return l.reservations.ConfirmTx(ctx, tx, pharmacyID, id)
+}
+
+func (l *LocalInventoryClient) ReleaseStock(ctx context.Context, pharmacyID uuid.UUID, reservationID string) error {
+	id, err := uuid.Parse(reservationID)
+	if err != nil {
+		return fmt.Errorf("invalid reservation id %q", reservationID)
+	}
+	return l.reservations.Cancel(ctx, pharmacyID, id)
+}
+
+func (l *LocalInventoryClient) ReturnItems(ctx context.Context, pharmacyID uuid.UUID, items []ReturnItemRequest) error {
+	userID, userName, req := batchReturn(ctx, items)
+	return l.batches.ProcessReturn(ctx, pharmacyID, userID, userName, req)
+}
+
+func (l *LocalInventoryClient) ReturnItemsTx(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, items []ReturnItemRequest) error {
+	userID, userName, req := batchReturn(ctx, items)
+	return l.batches.ProcessReturnTx(ctx, tx, pharmacyID, userID, userName, req)
+}
+
+// batchReturn builds the batches return request, credited to the signed-in user
+func batchReturn(ctx context.Context, items []ReturnItemRequest) (uuid.UUID, string, batches.BatchReturnRequest) {
+	userIDStr, userName, _ := middleware.GetUserInfo(ctx)
+	userID, _ := uuid.Parse(userIDStr)
+
+	req := batches.BatchReturnRequest{Items: make([]batches.ReturnItemRequest, 0, len(items))}
+	for _, item := range items {
+		req.Items = append(req.Items, batches.ReturnItemRequest{
+			BatchID:  item.BatchID,
+			Quantity: item.Quantity,
+			Reason:   item.Reason,
+		})
+	}
+	return userID, userName, req
+}
+
+func toStockAvailability(b batches.Batch) StockAvailability {
+	return StockAvailability{
+		BatchID:            b.ID,
+		MedicineID:         b.MedicineID,
+		BatchNo:            b.BatchNo,
+		MedicineName:       b.MedicineName,
+		MedicineBrand:      b.MedicineBrand,
+		Quantity:           b.QuantityAvailable,
+		MRP:                b.MRP,
+		UnitPrice:          b.UnitPrice,
+		ExpiryDate:         b.ExpiryDate,
+		CGSTRate:           b.CGSTRate,
+		SGSTRate:           b.SGSTRate,
+		TotalTaxPercentage: b.TotalTaxPercentage,
+		RetailDiscPerc:     b.RetailDiscPerc,
+		StaffDiscPerc:      b.StaffDiscPerc,
+		SpecialDiscPerc:    b.SpecialDiscPerc,
+		MaxDiscPerc:        b.MaxDiscPerc,
+		RackNo:             b.RackNo,
+	}
+}
+
 // Prescription Client
 
 type PrescriptionItem struct {
@@ -231,6 +458,7 @@ type PrescriptionData struct {
 	TotalMedicines int                `json:"total_medicines"`
 	Items          []PrescriptionItem `json:"items"`
 	LatestSaleID   *uuid.UUID         `json:"latest_sale_id"`
+	Allergies      string             `json:"patient_allergies,omitempty"`
 }
 
 type PrescriptionClient interface {
@@ -296,6 +524,7 @@ func (l *LocalPrescriptionClient) GetPrescription(ctx context.Context, pharmacyI
 		Date:           p.Date,
 		TotalMedicines: p.TotalMedicines,
 		LatestSaleID:   p.LatestSaleID,
+		Allergies:      p.PatientAllergies,
 	}
 
 	for _, item := range p.Items {
@@ -0,0 +1,239 @@
+package loyalty
+
+import (
+	"fmt"
+	"net/http"
+	"organization-service/middleware"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+}
+
+type PaginationMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+func (h *Handler) GetSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	settings, err := h.svc.GetSettings(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	settings, err := h.svc.UpdateSettings(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, settings)
+}
+
+func (h *Handler) GetMember(c *gin.Context) {
+	pharmacyID, patientID, ok := h.memberParams(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.svc.GetSummary(c.Request.Context(), pharmacyID, patientID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, summary)
+}
+
+// ListEntries returns the patient's points ledger, newest first
+func (h *Handler) ListEntries(c *gin.Context) {
+	pharmacyID, patientID, ok := h.memberParams(c)
+	if !ok {
+		return
+	}
+
+	page, pageSize := pagination(c)
+	entries, total, err := h.svc.ListEntries(c.Request.Context(), pharmacyID, patientID, page, pageSize)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondPage(c, entries, total, page, pageSize)
+}
+
+func (h *Handler) Adjust(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	patientID, err := uuid.Parse(c.Param("patientId"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var req AdjustPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	entry, err := h.svc.Adjust(c.Request.Context(), pharmacyID, patientID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, entry)
+}
+
+// Expire runs the daily points expiry for the caller's pharmacy immediately
+func (h *Handler) Expire(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	summary, err := h.svc.ExpirePoints(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, summary)
+}
+
+// memberParams reads the pharmacy and the patient path parameter and checks the patient is the pharmacy's
+func (h *Handler) memberParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	patientID, err := uuid.Parse(c.Param("patientId"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid patient ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	exists, err := h.svc.PatientExists(c.Request.Context(), pharmacyID, patientID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !exists {
+		h.respondError(c, http.StatusNotFound, "patient not found")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return pharmacyID, patientID, true
+}
+
+func pagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
+
+func (h *Handler) respondPage(c *gin.Context, data interface{}, total, page, pageSize int) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    data,
+		Meta: PaginationMeta{
+			Total:  total,
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		},
+	})
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
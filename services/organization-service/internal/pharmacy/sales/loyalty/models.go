@@ -0,0 +1,176 @@
+package loyalty
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPointsPer100     = 1
+	DefaultPointValue       = 1
+	DefaultMaxRedeemPercent = 100
+	DefaultExpiryMonths     = 12
+
+	// SpendWindowMonths is how far back purchases count towards a tier
+	SpendWindowMonths = 12
+	// ExpiringSoonDays is the window the member summary warns about
+	ExpiringSoonDays = 30
+)
+
+// DiscountColumn names the batch discount a tier gets by default at the counter
+type DiscountColumn string
+
+const (
+	DiscountRetail  DiscountColumn = "RETAIL"
+	DiscountSpecial DiscountColumn = "SPECIAL"
+	DiscountStaff   DiscountColumn = "STAFF"
+)
+
+type EntryType string
+
+const (
+	EntryEarn    EntryType = "EARN"
+	EntryRedeem  EntryType = "REDEEM"
+	EntryReverse EntryType = "REVERSE" // Earned points taken back on a return
+	EntryExpire  EntryType = "EXPIRE"
+	EntryAdjust  EntryType = "ADJUST"
+)
+
+type Tier struct {
+	Name           string         `json:"name"`
+	MinSpend       float64        `json:"min_spend"` // Purchases over the last 12 months to qualify
+	DiscountColumn DiscountColumn `json:"discount_column"`
+	EarnMultiplier float64        `json:"earn_multiplier"`
+}
+
+type Settings struct {
+	PharmacyID       uuid.UUID `json:"pharmacy_id"`
+	Enabled          bool      `json:"enabled"`
+	PointsPer100     float64   `json:"points_per_100"` // Points earned per ₹100 billed
+	PointValue       float64   `json:"point_value"`    // Rupees one point is worth when redeemed
+	MinRedeemPoints  int       `json:"min_redeem_points"`
+	MaxRedeemPercent int       `json:"max_redeem_percent"` // Share of a bill points may pay for
+	ExpiryMonths     int       `json:"expiry_months"`      // 0 when points never expire
+	Tiers            []Tier    `json:"tiers"`              // Ordered by MinSpend
+	UpdatedByName    string    `json:"updated_by_name,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// tierFor is the highest tier the spend qualifies for, nil below the lowest
+func (s *Settings) tierFor(spend float64) *Tier {
+	var tier *Tier
+	for i := range s.Tiers {
+		if spend+0.005 >= s.Tiers[i].MinSpend {
+			tier = &s.Tiers[i]
+		}
+	}
+	return tier
+}
+
+// expiryFrom is when points earned at the moment lapse; nil when they never do
+func (s *Settings) expiryFrom(at time.Time) *time.Time {
+	if s.ExpiryMonths <= 0 {
+		return nil
+	}
+	expires := at.AddDate(0, s.ExpiryMonths, 0)
+	return &expires
+}
+
+type PointsEntry struct {
+	ID            uuid.UUID  `json:"id"`
+	PatientID     uuid.UUID  `json:"patient_id"`
+	Type          EntryType  `json:"type"`
+	Points        int        `json:"points"` // Negative for redeemed, reversed and expired points
+	BaseAmount    float64    `json:"base_amount,omitempty"`
+	SaleID        *uuid.UUID `json:"sale_id,omitempty"`
+	ReturnID      *uuid.UUID `json:"return_id,omitempty"`
+	ReferenceNo   string     `json:"reference_no,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	CreatedBy     *uuid.UUID `json:"created_by,omitempty"`
+	CreatedByName string     `json:"created_by_name,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// pointsTotals is a patient's ledger position as of a moment
+type pointsTotals struct {
+	Balance int
+	// Spent is every point taken out (redeemed, reversed, expired, adjusted down);
+	// it is consumed oldest-earned first
+	Spent int
+	// EarnedDue is the points whose expiry falls on or before the moment
+	EarnedDue int
+}
+
+// expiring is how many points lapse by the moment once spending has eaten the oldest
+func (t pointsTotals) expiring() int {
+	if n := t.EarnedDue - t.Spent; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// MemberSummary is what the counter sees on a patient's profile
+type MemberSummary struct {
+	Enabled         bool           `json:"enabled"`
+	Points          int            `json:"points"`
+	PointsValue     float64        `json:"points_value"`
+	Tier            string         `json:"tier,omitempty"`
+	DiscountColumn  DiscountColumn `json:"discount_column"`
+	Spend12M        float64        `json:"spend_12m"`
+	NextTier        string         `json:"next_tier,omitempty"`
+	SpendToNextTier float64        `json:"spend_to_next_tier,omitempty"`
+	ExpiringPoints  int            `json:"expiring_points,omitempty"` // Lapsing within the next 30 days
+}
+
+// ExpirySummary reports one expiry pass for a pharmacy
+type ExpirySummary struct {
+	PharmacyID uuid.UUID `json:"pharmacy_id"`
+	Members    int       `json:"members"`
+	Points     int       `json:"points"`
+}
+
+// SaleSettlement is a finalized bill's effect on the patient's points
+type SaleSettlement struct {
+	PatientID     uuid.UUID
+	SaleID        uuid.UUID
+	InvoiceNumber string
+	BillAmount    float64 // The bill before wallet adjustments
+	RedeemAmount  float64 // Rupees paid with points
+	RedeemPoints  int
+	UserID        uuid.UUID
+	UserName      string
+}
+
+// SalePoints are the points a bill earned and spent, for the receipt
+type SalePoints struct {
+	Earned   int `json:"earned"`
+	Redeemed int `json:"redeemed"`
+	Reversed int `json:"reversed,omitempty"`
+}
+
+// Request Structs
+
+type TierRequest struct {
+	Name           string         `json:"name" validate:"required,max=50"`
+	MinSpend       float64        `json:"min_spend" validate:"gte=0"`
+	DiscountColumn DiscountColumn `json:"discount_column" validate:"required,oneof=RETAIL SPECIAL STAFF"`
+	EarnMultiplier float64        `json:"earn_multiplier" validate:"omitempty,gte=0,lte=10"` // Defaults to 1
+}
+
+type UpdateSettingsRequest struct {
+	Enabled          *bool    `json:"enabled"`
+	PointsPer100     *float64 `json:"points_per_100" validate:"omitempty,gte=0,lte=100"`
+	PointValue       *float64 `json:"point_value" validate:"omitempty,gt=0,lte=100"`
+	MinRedeemPoints  *int     `json:"min_redeem_points" validate:"omitempty,min=0"`
+	MaxRedeemPercent *int     `json:"max_redeem_percent" validate:"omitempty,min=1,max=100"`
+	ExpiryMonths     *int     `json:"expiry_months" validate:"omitempty,min=0,max=60"`
+	// Tiers replaces the pharmacy's tiers when sent; an empty list removes them
+	Tiers *[]TierRequest `json:"tiers" validate:"omitempty,max=10,dive"`
+}
+
+type AdjustPointsRequest struct {
+	Points int    `json:"points" validate:"required"` // Negative to take points away
+	Reason string `json:"reason" validate:"required,max=500"`
+}
@@ -0,0 +1,315 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	// SaveSettings upserts the program and replaces its tiers
+	SaveSettings(ctx context.Context, s *Settings, userID uuid.UUID) error
+	PatientExists(ctx context.Context, pharmacyID, patientID uuid.UUID) (bool, error)
+	// LockPatient serialises point postings for a patient within tx
+	LockPatient(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID) error
+
+	// GetSpend is the patient's net purchases (after returns) on completed sales since the given time
+	GetSpend(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID, since time.Time) (float64, error)
+	GetTotals(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID, asOf time.Time) (pointsTotals, error)
+	AddEntries(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, entries []PointsEntry) error
+	ListEntries(ctx context.Context, pharmacyID, patientID uuid.UUID, limit, offset int) ([]PointsEntry, int, error)
+	// GetSalePoints totals the entries posted against a sale, with the bill amount
+	// points were earned on and the refunds already reversed
+	GetSalePoints(ctx context.Context, tx *sql.Tx, pharmacyID, saleID uuid.UUID) (*SalePoints, float64, float64, error)
+
+	// ListPharmaciesWithLapsedPoints returns pharmacies with points past expiry not yet expired, for the worker
+	ListPharmaciesWithLapsedPoints(ctx context.Context, asOf time.Time) ([]uuid.UUID, error)
+	ListPatientsWithLapsedPoints(ctx context.Context, pharmacyID uuid.UUID, asOf time.Time) ([]uuid.UUID, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+// queryRow runs on tx when one is given
+func (r *postgresRepository) queryRow(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	if tx != nil {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	return r.db.QueryRowContext(ctx, query, args...)
+}
+
+func (r *postgresRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
+func (r *postgresRepository) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	s := &Settings{PharmacyID: pharmacyID, Tiers: []Tier{}}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT enabled, points_per_100, point_value, min_redeem_points, max_redeem_percent, expiry_months,
+		       COALESCE(updated_by_name, ''), updated_at
+		FROM sales_schema.loyalty_settings
+		WHERE pharmacy_id = $1
+	`, pharmacyID).Scan(&s.Enabled, &s.PointsPer100, &s.PointValue, &s.MinRedeemPoints, &s.MaxRedeemPercent,
+		&s.ExpiryMonths, &s.UpdatedByName, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		s.PointsPer100 = DefaultPointsPer100
+		s.PointValue = DefaultPointValue
+		s.MaxRedeemPercent = DefaultMaxRedeemPercent
+		s.ExpiryMonths = DefaultExpiryMonths
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT name, min_spend, discount_column, earn_multiplier
+		FROM sales_schema.loyalty_tiers
+		WHERE pharmacy_id = $1
+		ORDER BY min_spend, name`, pharmacyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load loyalty tiers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Tier
+		if err := rows.Scan(&t.Name, &t.MinSpend, &t.DiscountColumn, &t.EarnMultiplier); err != nil {
+			return nil, err
+		}
+		s.Tiers = append(s.Tiers, t)
+	}
+	return s, rows.Err()
+}
+
+func (r *postgresRepository) SaveSettings(ctx context.Context, s *Settings, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sales_schema.loyalty_settings (
+			pharmacy_id, enabled, points_per_100, point_value, min_redeem_points, max_redeem_percent, expiry_months,
+			updated_by, updated_by_name, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (pharmacy_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			points_per_100 = EXCLUDED.points_per_100,
+			point_value = EXCLUDED.point_value,
+			min_redeem_points = EXCLUDED.min_redeem_points,
+			max_redeem_percent = EXCLUDED.max_redeem_percent,
+			expiry_months = EXCLUDED.expiry_months,
+			updated_by = EXCLUDED.updated_by,
+			updated_by_name = EXCLUDED.updated_by_name,
+			updated_at = EXCLUDED.updated_at
+	`, s.PharmacyID, s.Enabled, s.PointsPer100, s.PointValue, s.MinRedeemPoints, s.MaxRedeemPercent, s.ExpiryMonths,
+		userID, s.UpdatedByName, s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save loyalty settings: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sales_schema.loyalty_tiers WHERE pharmacy_id = $1`, s.PharmacyID); err != nil {
+		return fmt.Errorf("failed to save loyalty tiers: %w", err)
+	}
+	for _, t := range s.Tiers {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO sales_schema.loyalty_tiers (id, pharmacy_id, name, min_spend, discount_column, earn_multiplier)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			uuid.New(), s.PharmacyID, t.Name, t.MinSpend, t.DiscountColumn, t.EarnMultiplier)
+		if err != nil {
+			return fmt.Errorf("failed to save loyalty tier %s: %w", t.Name, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) PatientExists(ctx context.Context, pharmacyID, patientID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM sales_schema.patients WHERE pharmacy_id = $1 AND id = $2)`,
+		pharmacyID, patientID).Scan(&exists)
+	return exists, err
+}
+
+func (r *postgresRepository) LockPatient(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID) error {
+	var id uuid.UUID
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM sales_schema.patients
+		WHERE pharmacy_id = $1 AND id = $2
+		FOR UPDATE`, pharmacyID, patientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("patient not found")
+	}
+	return err
+}
+
+func (r *postgresRepository) GetSpend(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID, since time.Time) (float64, error) {
+	var spend float64
+	err := r.queryRow(ctx, tx, `
+		SELECT COALESCE(SUM(si.subtotal * (si.quantity - si.returned_quantity) / NULLIF(si.quantity, 0)), 0)
+		FROM sales_schema.sale_items si
+		JOIN sales_schema.sales s ON s.id = si.sale_id
+		WHERE s.pharmacy_id = $1 AND s.patient_id = $2
+		  AND s.status IN ('COMPLETED', 'DISPATCHED') AND s.created_at >= $3
+	`, pharmacyID, patientID, since).Scan(&spend)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute patient spend: %w", err)
+	}
+	return spend, nil
+}
+
+func (r *postgresRepository) GetTotals(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID, asOf time.Time) (pointsTotals, error) {
+	var t pointsTotals
+	err := r.queryRow(ctx, tx, `
+		SELECT COALESCE(SUM(points), 0),
+		       COALESCE(-SUM(points) FILTER (WHERE points < 0), 0),
+		       COALESCE(SUM(points) FILTER (WHERE points > 0 AND expires_at <= $3), 0)
+		FROM sales_schema.loyalty_points_entries
+		WHERE pharmacy_id = $1 AND patient_id = $2
+	`, pharmacyID, patientID, asOf).Scan(&t.Balance, &t.Spent, &t.EarnedDue)
+	if err != nil {
+		return t, fmt.Errorf("failed to load loyalty points: %w", err)
+	}
+	return t, nil
+}
+
+func (r *postgresRepository) AddEntries(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, entries []PointsEntry) error {
+	for _, e := range entries {
+		query := `
+			INSERT INTO sales_schema.loyalty_points_entries (
+				id, pharmacy_id, patient_id, entry_type, points, base_amount, sale_id, return_id, reference_no,
+				expires_at, reason, created_by, created_by_name, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, NULLIF($11, ''), $12, NULLIF($13, ''), $14)`
+		args := []interface{}{
+			e.ID, pharmacyID, e.PatientID, e.Type, e.Points, e.BaseAmount, e.SaleID, e.ReturnID, e.ReferenceNo,
+			e.ExpiresAt, e.Reason, e.CreatedBy, e.CreatedByName, e.CreatedAt,
+		}
+		var err error
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, args...)
+		} else {
+			_, err = r.db.ExecContext(ctx, query, args...)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to post loyalty points: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListEntries(ctx context.Context, pharmacyID, patientID uuid.UUID, limit, offset int) ([]PointsEntry, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sales_schema.loyalty_points_entries WHERE pharmacy_id = $1 AND patient_id = $2`,
+		pharmacyID, patientID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, patient_id, entry_type, points, base_amount, sale_id, return_id, COALESCE(reference_no, ''),
+		       expires_at, COALESCE(reason, ''), created_by, COALESCE(created_by_name, ''), created_at
+		FROM sales_schema.loyalty_points_entries
+		WHERE pharmacy_id = $1 AND patient_id = $2
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4`, pharmacyID, patientID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load loyalty points: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []PointsEntry{}
+	for rows.Next() {
+		var e PointsEntry
+		var saleID, returnID, createdBy uuid.NullUUID
+		var expiresAt sql.NullTime
+		if err := rows.Scan(
+			&e.ID, &e.PatientID, &e.Type, &e.Points, &e.BaseAmount, &saleID, &returnID, &e.ReferenceNo,
+			&expiresAt, &e.Reason, &createdBy, &e.CreatedByName, &e.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		if saleID.Valid {
+			e.SaleID = &saleID.UUID
+		}
+		if returnID.Valid {
+			e.ReturnID = &returnID.UUID
+		}
+		if createdBy.Valid {
+			e.CreatedBy = &createdBy.UUID
+		}
+		if expiresAt.Valid {
+			e.ExpiresAt = &expiresAt.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+func (r *postgresRepository) GetSalePoints(ctx context.Context, tx *sql.Tx, pharmacyID, saleID uuid.UUID) (*SalePoints, float64, float64, error) {
+	sp := &SalePoints{}
+	var billAmount, refunded float64
+	err := r.queryRow(ctx, tx, `
+		SELECT COALESCE(SUM(points) FILTER (WHERE entry_type = 'EARN'), 0),
+		       COALESCE(-SUM(points) FILTER (WHERE entry_type = 'REDEEM'), 0),
+		       COALESCE(-SUM(points) FILTER (WHERE entry_type = 'REVERSE'), 0),
+		       COALESCE(SUM(base_amount) FILTER (WHERE entry_type = 'EARN'), 0),
+		       COALESCE(SUM(base_amount) FILTER (WHERE entry_type = 'REVERSE'), 0)
+		FROM sales_schema.loyalty_points_entries
+		WHERE pharmacy_id = $1 AND sale_id = $2
+	`, pharmacyID, saleID).Scan(&sp.Earned, &sp.Redeemed, &sp.Reversed, &billAmount, &refunded)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to load sale loyalty points: %w", err)
+	}
+	return sp, billAmount, refunded, nil
+}
+
+// Lapsed points are earned points past expiry that outweigh everything spent so far
+const lapsedHaving = `
+	HAVING COALESCE(SUM(points) FILTER (WHERE points > 0 AND expires_at <= $1), 0)
+	     > COALESCE(-SUM(points) FILTER (WHERE points < 0), 0)`
+
+func (r *postgresRepository) ListPharmaciesWithLapsedPoints(ctx context.Context, asOf time.Time) ([]uuid.UUID, error) {
+	return r.listIDs(ctx, `
+		SELECT DISTINCT pharmacy_id FROM (
+			SELECT pharmacy_id, patient_id
+			FROM sales_schema.loyalty_points_entries
+			GROUP BY pharmacy_id, patient_id`+lapsedHaving+`
+		) lapsed`, asOf)
+}
+
+func (r *postgresRepository) ListPatientsWithLapsedPoints(ctx context.Context, pharmacyID uuid.UUID, asOf time.Time) ([]uuid.UUID, error) {
+	return r.listIDs(ctx, `
+		SELECT patient_id
+		FROM sales_schema.loyalty_points_entries
+		WHERE pharmacy_id = $2
+		GROUP BY patient_id`+lapsedHaving, asOf, pharmacyID)
+}
+
+func (r *postgresRepository) listIDs(ctx context.Context, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
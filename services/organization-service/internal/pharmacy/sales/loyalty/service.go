@@ -0,0 +1,504 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+	"shared-scheduler"
+)
+
+type Service interface {
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error)
+	PatientExists(ctx context.Context, pharmacyID, patientID uuid.UUID) (bool, error)
+	GetSummary(ctx context.Context, pharmacyID, patientID uuid.UUID) (*MemberSummary, error)
+	ListEntries(ctx context.Context, pharmacyID, patientID uuid.UUID, page, pageSize int) ([]PointsEntry, int, error)
+	Adjust(ctx context.Context, pharmacyID, patientID, userID uuid.UUID, userName string, req AdjustPointsRequest) (*PointsEntry, error)
+
+	// DiscountColumn is the batch discount the patient's tier gets by default;
+	// RETAIL when the program is off or the patient is below every tier
+	DiscountColumn(ctx context.Context, pharmacyID, patientID uuid.UUID) (DiscountColumn, error)
+	// QuoteRedemption checks paying amount of a bill with points and returns the points it takes
+	QuoteRedemption(ctx context.Context, pharmacyID, patientID uuid.UUID, amount, billAmount float64) (int, error)
+	// SettleSale posts a finalized bill's redeemed and earned points; given a tx it
+	// joins the checkout transaction, otherwise it runs in its own
+	SettleSale(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in SaleSettlement) (*SalePoints, error)
+	// ReverseReturn takes back the points a sale earned in proportion to the refund; given
+	// a tx it joins the return's transaction, otherwise it runs in its own
+	ReverseReturn(ctx context.Context, tx *sql.Tx, pharmacyID, patientID, saleID, returnID uuid.UUID, returnNumber string, refund float64, userName string) (int, error)
+	GetSalePoints(ctx context.Context, pharmacyID, saleID uuid.UUID) (*SalePoints, error)
+
+	ExpirePoints(ctx context.Context, pharmacyID uuid.UUID) (*ExpirySummary, error)
+	RegisterJobs(jobs *scheduler.Scheduler) // Daily points expiry
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	return s.repo.GetSettings(ctx, pharmacyID)
+}
+
+func (s *service) UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.PointsPer100 != nil {
+		settings.PointsPer100 = *req.PointsPer100
+	}
+	if req.PointValue != nil {
+		settings.PointValue = *req.PointValue
+	}
+	if req.MinRedeemPoints != nil {
+		settings.MinRedeemPoints = *req.MinRedeemPoints
+	}
+	if req.MaxRedeemPercent != nil {
+		settings.MaxRedeemPercent = *req.MaxRedeemPercent
+	}
+	if req.ExpiryMonths != nil {
+		settings.ExpiryMonths = *req.ExpiryMonths
+	}
+	if req.Tiers != nil {
+		tiers := make([]Tier, 0, len(*req.Tiers))
+		seen := make(map[string]bool)
+		for _, t := range *req.Tiers {
+			name := strings.TrimSpace(t.Name)
+			if seen[strings.ToUpper(name)] {
+				return nil, fmt.Errorf("tier %s is listed twice", name)
+			}
+			seen[strings.ToUpper(name)] = true
+			multiplier := t.EarnMultiplier
+			if multiplier == 0 {
+				multiplier = 1
+			}
+			tiers = append(tiers, Tier{
+				Name:           name,
+				MinSpend:       money.Round2(t.MinSpend),
+				DiscountColumn: t.DiscountColumn,
+				EarnMultiplier: multiplier,
+			})
+		}
+		sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].MinSpend < tiers[j].MinSpend })
+		for i := 1; i < len(tiers); i++ {
+			if tiers[i].MinSpend == tiers[i-1].MinSpend {
+				return nil, fmt.Errorf("tiers %s and %s have the same minimum spend", tiers[i-1].Name, tiers[i].Name)
+			}
+		}
+		settings.Tiers = tiers
+	}
+	settings.UpdatedByName = userName
+	settings.UpdatedAt = time.Now()
+
+	if err := s.repo.SaveSettings(ctx, settings, userID); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *service) PatientExists(ctx context.Context, pharmacyID, patientID uuid.UUID) (bool, error) {
+	return s.repo.PatientExists(ctx, pharmacyID, patientID)
+}
+
+func (s *service) GetSummary(ctx context.Context, pharmacyID, patientID uuid.UUID) (*MemberSummary, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	spend, err := s.repo.GetSpend(ctx, nil, pharmacyID, patientID, now.AddDate(0, -SpendWindowMonths, 0))
+	if err != nil {
+		return nil, err
+	}
+	totals, err := s.repo.GetTotals(ctx, nil, pharmacyID, patientID, now.AddDate(0, 0, ExpiringSoonDays))
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &MemberSummary{
+		Enabled:        settings.Enabled,
+		Points:         totals.Balance,
+		DiscountColumn: DiscountRetail,
+		Spend12M:       money.Round2(spend),
+		ExpiringPoints: totals.expiring(),
+	}
+	if totals.Balance > 0 {
+		summary.PointsValue = money.Round2(float64(totals.Balance) * settings.PointValue)
+	}
+	if tier := settings.tierFor(spend); tier != nil {
+		summary.Tier = tier.Name
+		if settings.Enabled {
+			summary.DiscountColumn = tier.DiscountColumn
+		}
+	}
+	for _, t := range settings.Tiers {
+		if t.MinSpend > spend+0.005 {
+			summary.NextTier = t.Name
+			summary.SpendToNextTier = money.Round2(t.MinSpend - spend)
+			break
+		}
+	}
+	return summary, nil
+}
+
+func (s *service) ListEntries(ctx context.Context, pharmacyID, patientID uuid.UUID, page, pageSize int) ([]PointsEntry, int, error) {
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return s.repo.ListEntries(ctx, pharmacyID, patientID, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) Adjust(ctx context.Context, pharmacyID, patientID, userID uuid.UUID, userName string, req AdjustPointsRequest) (*PointsEntry, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.repo.LockPatient(ctx, tx, pharmacyID, patientID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if req.Points < 0 {
+		totals, err := s.repo.GetTotals(ctx, tx, pharmacyID, patientID, now)
+		if err != nil {
+			return nil, err
+		}
+		if totals.Balance+req.Points < 0 {
+			return nil, fmt.Errorf("the patient has only %d points", totals.Balance)
+		}
+	}
+
+	e := PointsEntry{
+		ID:            uuid.New(),
+		PatientID:     patientID,
+		Type:          EntryAdjust,
+		Points:        req.Points,
+		Reason:        strings.TrimSpace(req.Reason),
+		CreatedBy:     &userID,
+		CreatedByName: userName,
+		CreatedAt:     now,
+	}
+	if req.Points > 0 {
+		e.ExpiresAt = settings.expiryFrom(now)
+	}
+	if err := s.repo.AddEntries(ctx, tx, pharmacyID, []PointsEntry{e}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *service) DiscountColumn(ctx context.Context, pharmacyID, patientID uuid.UUID) (DiscountColumn, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return DiscountRetail, err
+	}
+	if !settings.Enabled || len(settings.Tiers) == 0 {
+		return DiscountRetail, nil
+	}
+	spend, err := s.repo.GetSpend(ctx, nil, pharmacyID, patientID, time.Now().AddDate(0, -SpendWindowMonths, 0))
+	if err != nil {
+		return DiscountRetail, err
+	}
+	if tier := settings.tierFor(spend); tier != nil {
+		return tier.DiscountColumn, nil
+	}
+	return DiscountRetail, nil
+}
+
+func (s *service) QuoteRedemption(ctx context.Context, pharmacyID, patientID uuid.UUID, amount, billAmount float64) (int, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return 0, err
+	}
+	if !settings.Enabled {
+		return 0, fmt.Errorf("the loyalty program is not enabled for this pharmacy")
+	}
+
+	points := int(math.Ceil(amount/settings.PointValue - 1e-9))
+	if points < settings.MinRedeemPoints {
+		return 0, fmt.Errorf("at least %d points must be redeemed at a time", settings.MinRedeemPoints)
+	}
+	if limit := billAmount * float64(settings.MaxRedeemPercent) / 100; amount > limit+0.005 {
+		return 0, fmt.Errorf("points can pay for at most %d%% of the bill (%.2f)", settings.MaxRedeemPercent, limit)
+	}
+
+	totals, err := s.repo.GetTotals(ctx, nil, pharmacyID, patientID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if available := totals.Balance - totals.expiring(); points > available {
+		return 0, fmt.Errorf("%.2f needs %d points; the patient has %d", amount, points, available)
+	}
+	return points, nil
+}
+
+func (s *service) SettleSale(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, in SaleSettlement) (*SalePoints, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	result := &SalePoints{}
+	if !settings.Enabled && in.RedeemPoints == 0 {
+		return result, nil
+	}
+
+	ownTx := tx == nil
+	if ownTx {
+		tx, err = s.repo.BeginTx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+
+	if err := s.repo.LockPatient(ctx, tx, pharmacyID, in.PatientID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var createdBy *uuid.UUID
+	if in.UserID != uuid.Nil {
+		createdBy = &in.UserID
+	}
+	var entries []PointsEntry
+
+	if in.RedeemPoints > 0 {
+		// Re-check under the lock; points may have been spent on another bill since the quote
+		totals, err := s.repo.GetTotals(ctx, tx, pharmacyID, in.PatientID, now)
+		if err != nil {
+			return nil, err
+		}
+		if available := totals.Balance - totals.expiring(); in.RedeemPoints > available {
+			return nil, fmt.Errorf("the patient has %d points, fewer than the %d redeemed on this bill", available, in.RedeemPoints)
+		}
+		entries = append(entries, PointsEntry{
+			ID:            uuid.New(),
+			PatientID:     in.PatientID,
+			Type:          EntryRedeem,
+			Points:        -in.RedeemPoints,
+			BaseAmount:    money.Round2(in.RedeemAmount),
+			SaleID:        &in.SaleID,
+			ReferenceNo:   in.InvoiceNumber,
+			CreatedBy:     createdBy,
+			CreatedByName: in.UserName,
+			CreatedAt:     now,
+		})
+		result.Redeemed = in.RedeemPoints
+	}
+
+	// The bill itself counts towards the tier, so the sale that lifts a patient
+	// into a tier already earns at its rate. Points pay for nothing that earns.
+	if settings.Enabled {
+		base := in.BillAmount - in.RedeemAmount
+		spend, err := s.repo.GetSpend(ctx, tx, pharmacyID, in.PatientID, now.AddDate(0, -SpendWindowMonths, 0))
+		if err != nil {
+			return nil, err
+		}
+		multiplier := 1.0
+		if tier := settings.tierFor(spend); tier != nil {
+			multiplier = tier.EarnMultiplier
+		}
+		if earned := int(math.Floor(base/100*settings.PointsPer100*multiplier + 1e-9)); earned > 0 {
+			entries = append(entries, PointsEntry{
+				ID:            uuid.New(),
+				PatientID:     in.PatientID,
+				Type:          EntryEarn,
+				Points:        earned,
+				BaseAmount:    money.Round2(in.BillAmount),
+				SaleID:        &in.SaleID,
+				ReferenceNo:   in.InvoiceNumber,
+				ExpiresAt:     settings.expiryFrom(now),
+				CreatedBy:     createdBy,
+				CreatedByName: in.UserName,
+				CreatedAt:     now,
+			})
+			result.Earned = earned
+		}
+	}
+
+	if err := s.repo.AddEntries(ctx, tx, pharmacyID, entries); err != nil {
+		return nil, err
+	}
+	if ownTx {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *service) ReverseReturn(ctx context.Context, tx *sql.Tx, pharmacyID, patientID, saleID, returnID uuid.UUID, returnNumber string, refund float64, userName string) (int, error) {
+	ownTx := tx == nil
+	if ownTx {
+		var err error
+		tx, err = s.repo.BeginTx(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+	}
+
+	if err := s.repo.LockPatient(ctx, tx, pharmacyID, patientID); err != nil {
+		return 0, err
+	}
+	sp, billAmount, refunded, err := s.repo.GetSalePoints(ctx, tx, pharmacyID, saleID)
+	if err != nil {
+		return 0, err
+	}
+	if sp.Earned <= 0 || billAmount <= 0 {
+		return 0, nil
+	}
+
+	// Refunds are a share of the bill the points were earned on; working from the
+	// refunds so far lets partial returns add up to exactly what was earned
+	share := math.Min((refunded+refund)/billAmount, 1)
+	points := int(math.Round(float64(sp.Earned)*share)) - sp.Reversed
+	if points <= 0 {
+		return 0, nil
+	}
+
+	err = s.repo.AddEntries(ctx, tx, pharmacyID, []PointsEntry{{
+		ID:            uuid.New(),
+		PatientID:     patientID,
+		Type:          EntryReverse,
+		Points:        -points,
+		BaseAmount:    money.Round2(refund),
+		SaleID:        &saleID,
+		ReturnID:      &returnID,
+		ReferenceNo:   returnNumber,
+		CreatedByName: userName,
+		CreatedAt:     time.Now(),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	if ownTx {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return points, nil
+}
+
+func (s *service) GetSalePoints(ctx context.Context, pharmacyID, saleID uuid.UUID) (*SalePoints, error) {
+	sp, _, _, err := s.repo.GetSalePoints(ctx, nil, pharmacyID, saleID)
+	return sp, err
+}
+
+// ExpirePoints posts an expiry for every patient whose oldest points have lapsed;
+// spending is taken to use up the oldest points first
+func (s *service) ExpirePoints(ctx context.Context, pharmacyID uuid.UUID) (*ExpirySummary, error) {
+	now := time.Now()
+	patients, err := s.repo.ListPatientsWithLapsedPoints(ctx, pharmacyID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ExpirySummary{PharmacyID: pharmacyID}
+	for _, patientID := range patients {
+		points, err := s.expirePatient(ctx, pharmacyID, patientID, now)
+		if err != nil {
+			return summary, err
+		}
+		if points > 0 {
+			summary.Members++
+			summary.Points += points
+		}
+	}
+	return summary, nil
+}
+
+func (s *service) expirePatient(ctx context.Context, pharmacyID, patientID uuid.UUID, now time.Time) (int, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The patient lock claims the expiry: a run that waited on it reads the
+	// totals after the first run's EXPIRE entry and finds nothing left to expire
+	if err := s.repo.LockPatient(ctx, tx, pharmacyID, patientID); err != nil {
+		return 0, err
+	}
+	totals, err := s.repo.GetTotals(ctx, tx, pharmacyID, patientID, now)
+	if err != nil {
+		return 0, err
+	}
+	points := totals.expiring()
+	if points <= 0 {
+		return 0, nil
+	}
+
+	err = s.repo.AddEntries(ctx, tx, pharmacyID, []PointsEntry{{
+		ID:        uuid.New(),
+		PatientID: patientID,
+		Type:      EntryExpire,
+		Points:    -points,
+		Reason:    "Points past their expiry date",
+		CreatedAt: now,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return points, tx.Commit()
+}
+
+// RegisterJobs schedules points expiry for every pharmacy shortly after
+// midnight; the scheduler fires it on one replica at a time
+func (s *service) RegisterJobs(jobs *scheduler.Scheduler) {
+	jobs.Register(&scheduler.Job{
+		Name:        "pharmacy-loyalty-expiry",
+		Description: "Expire loyalty points past each pharmacy's validity",
+		Schedule:    scheduler.MustParseSchedule("20 0 * * *"),
+		Timeout:     30 * time.Minute,
+		Run:         s.expireAll,
+	})
+}
+
+// expireAll expires lapsed points pharmacy by pharmacy; one failing does not stop the rest
+func (s *service) expireAll(ctx context.Context, _ *sql.DB) (int64, error) {
+	pharmacyIDs, err := s.repo.ListPharmaciesWithLapsedPoints(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for _, pharmacyID := range pharmacyIDs {
+		summary, err := s.ExpirePoints(ctx, pharmacyID)
+		if err != nil {
+			fmt.Printf("[Loyalty-Worker] Pharmacy %s: %v\n", pharmacyID, err)
+			continue
+		}
+		if summary.Points > 0 {
+			fmt.Printf("[Loyalty-Worker] Pharmacy %s: expired %d points across %d members\n", pharmacyID, summary.Points, summary.Members)
+		}
+		affected += int64(summary.Members)
+	}
+	return affected, nil
+}
@@ -0,0 +1,359 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var testTiers = []Tier{
+	{Name: "Silver", MinSpend: 5000, DiscountColumn: DiscountSpecial, EarnMultiplier: 1.5},
+	{Name: "Gold", MinSpend: 20000, DiscountColumn: DiscountStaff, EarnMultiplier: 2},
+}
+
+// fakeRepository serves one patient's spend and points and records postings
+type fakeRepository struct {
+	Repository
+	settings Settings
+	spend    float64
+	totals   pointsTotals
+	added    []PointsEntry
+	saved    *Settings
+
+	salePoints SalePoints
+	billAmount float64
+	refunded   float64
+}
+
+func (f *fakeRepository) GetSettings(context.Context, uuid.UUID) (*Settings, error) {
+	s := f.settings
+	return &s, nil
+}
+
+func (f *fakeRepository) SaveSettings(_ context.Context, s *Settings, _ uuid.UUID) error {
+	f.saved = s
+	return nil
+}
+
+func (f *fakeRepository) LockPatient(context.Context, *sql.Tx, uuid.UUID, uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeRepository) GetSpend(context.Context, *sql.Tx, uuid.UUID, uuid.UUID, time.Time) (float64, error) {
+	return f.spend, nil
+}
+
+func (f *fakeRepository) GetTotals(context.Context, *sql.Tx, uuid.UUID, uuid.UUID, time.Time) (pointsTotals, error) {
+	return f.totals, nil
+}
+
+func (f *fakeRepository) AddEntries(_ context.Context, _ *sql.Tx, _ uuid.UUID, entries []PointsEntry) error {
+	f.added = append(f.added, entries...)
+	return nil
+}
+
+func (f *fakeRepository) GetSalePoints(context.Context, *sql.Tx, uuid.UUID, uuid.UUID) (*SalePoints, float64, float64, error) {
+	sp := f.salePoints
+	return &sp, f.billAmount, f.refunded, nil
+}
+
+func TestTierFor(t *testing.T) {
+	s := &Settings{Tiers: testTiers}
+
+	tests := []struct {
+		spend float64
+		want  string
+	}{
+		{0, ""},
+		{4999.99, ""},
+		{4999.996, "Silver"},
+		{5000, "Silver"},
+		{19999, "Silver"},
+		{20000, "Gold"},
+		{100000, "Gold"},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if tier := s.tierFor(tt.spend); tier != nil {
+			got = tier.Name
+		}
+		if got != tt.want {
+			t.Errorf("tierFor(%.3f) = %q, want %q", tt.spend, got, tt.want)
+		}
+	}
+}
+
+func TestExpiring(t *testing.T) {
+	tests := []struct {
+		totals pointsTotals
+		want   int
+	}{
+		{pointsTotals{Balance: 100}, 0},
+		{pointsTotals{Balance: 100, EarnedDue: 40}, 40},
+		{pointsTotals{Balance: 70, Spent: 30, EarnedDue: 40}, 10},
+		{pointsTotals{Balance: 20, Spent: 80, EarnedDue: 40}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.totals.expiring(); got != tt.want {
+			t.Errorf("%+v.expiring() = %d, want %d", tt.totals, got, tt.want)
+		}
+	}
+}
+
+func TestExpiryFrom(t *testing.T) {
+	at := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+	if got := (&Settings{ExpiryMonths: 0}).expiryFrom(at); got != nil {
+		t.Errorf("expiryFrom() = %v for points that never expire", got)
+	}
+	got := (&Settings{ExpiryMonths: 12}).expiryFrom(at)
+	if want := at.AddDate(1, 0, 0); got == nil || !got.Equal(want) {
+		t.Errorf("expiryFrom() = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateSettingsTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		tiers   []TierRequest
+		want    []Tier
+		wantErr bool
+	}{
+		{
+			name: "sorted by spend with a default multiplier",
+			tiers: []TierRequest{
+				{Name: " Gold ", MinSpend: 20000, DiscountColumn: DiscountStaff, EarnMultiplier: 2},
+				{Name: "Silver", MinSpend: 5000, DiscountColumn: DiscountSpecial},
+			},
+			want: []Tier{
+				{Name: "Silver", MinSpend: 5000, DiscountColumn: DiscountSpecial, EarnMultiplier: 1},
+				{Name: "Gold", MinSpend: 20000, DiscountColumn: DiscountStaff, EarnMultiplier: 2},
+			},
+		},
+		{name: "cleared", tiers: []TierRequest{}, want: []Tier{}},
+		{
+			name: "same name twice",
+			tiers: []TierRequest{
+				{Name: "Gold", MinSpend: 20000, DiscountColumn: DiscountStaff},
+				{Name: "gold", MinSpend: 30000, DiscountColumn: DiscountStaff},
+			},
+			wantErr: true,
+		},
+		{
+			name: "same minimum spend",
+			tiers: []TierRequest{
+				{Name: "Silver", MinSpend: 5000, DiscountColumn: DiscountSpecial},
+				{Name: "Gold", MinSpend: 5000, DiscountColumn: DiscountStaff},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{settings: Settings{Tiers: testTiers}}
+			svc := NewService(repo)
+
+			got, err := svc.UpdateSettings(context.Background(), uuid.New(), uuid.New(), "Owner", UpdateSettingsRequest{Tiers: &tt.tiers})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if repo.saved != nil {
+					t.Error("invalid tiers were saved")
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Tiers, tt.want) {
+				t.Errorf("tiers = %+v, want %+v", got.Tiers, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		spend   float64
+		totals  pointsTotals
+		want    MemberSummary
+	}{
+		{
+			name:    "below the first tier",
+			enabled: true,
+			spend:   1200,
+			totals:  pointsTotals{Balance: 12},
+			want:    MemberSummary{Enabled: true, Points: 12, PointsValue: 6, DiscountColumn: DiscountRetail, Spend12M: 1200, NextTier: "Silver", SpendToNextTier: 3800},
+		},
+		{
+			name:    "silver with points lapsing soon",
+			enabled: true,
+			spend:   8000,
+			totals:  pointsTotals{Balance: 90, Spent: 10, EarnedDue: 30},
+			want:    MemberSummary{Enabled: true, Points: 90, PointsValue: 45, Tier: "Silver", DiscountColumn: DiscountSpecial, Spend12M: 8000, NextTier: "Gold", SpendToNextTier: 12000, ExpiringPoints: 20},
+		},
+		{
+			name:   "program off keeps the retail discount",
+			spend:  25000,
+			totals: pointsTotals{},
+			want:   MemberSummary{Tier: "Gold", DiscountColumn: DiscountRetail, Spend12M: 25000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{
+				settings: Settings{Enabled: tt.enabled, PointValue: 0.5, Tiers: testTiers},
+				spend:    tt.spend,
+				totals:   tt.totals,
+			}
+			got, err := NewService(repo).GetSummary(context.Background(), uuid.New(), uuid.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("summary = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteRedemption(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabled   bool
+		amount     float64
+		billAmount float64
+		totals     pointsTotals
+		want       int
+		wantErr    bool
+	}{
+		{name: "whole points", amount: 50, billAmount: 500, totals: pointsTotals{Balance: 200}, want: 100},
+		{name: "part point rounds up", amount: 50.25, billAmount: 500, totals: pointsTotals{Balance: 200}, want: 101},
+		{name: "program off", disabled: true, amount: 50, billAmount: 500, totals: pointsTotals{Balance: 200}, wantErr: true},
+		{name: "below the minimum", amount: 5, billAmount: 500, totals: pointsTotals{Balance: 200}, wantErr: true},
+		{name: "over the bill share", amount: 260, billAmount: 500, totals: pointsTotals{Balance: 1000}, wantErr: true},
+		{name: "not enough points", amount: 50, billAmount: 500, totals: pointsTotals{Balance: 99}, wantErr: true},
+		{name: "lapsing points not spendable", amount: 50, billAmount: 500, totals: pointsTotals{Balance: 120, EarnedDue: 30}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{
+				settings: Settings{Enabled: !tt.disabled, PointValue: 0.5, MinRedeemPoints: 20, MaxRedeemPercent: 50},
+				totals:   tt.totals,
+			}
+			got, err := NewService(repo).QuoteRedemption(context.Background(), uuid.New(), uuid.New(), tt.amount, tt.billAmount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QuoteRedemption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("QuoteRedemption() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettleSale(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+		spend    float64
+		in       SaleSettlement
+		want     SalePoints
+		wantErr  bool
+	}{
+		{name: "earns on the bill", in: SaleSettlement{BillAmount: 1299}, want: SalePoints{Earned: 12}},
+		{name: "tier multiplier", spend: 6000, in: SaleSettlement{BillAmount: 1000}, want: SalePoints{Earned: 15}},
+		{name: "points paid part of the bill", in: SaleSettlement{BillAmount: 1000, RedeemAmount: 300, RedeemPoints: 600}, want: SalePoints{Earned: 7, Redeemed: 600}},
+		{name: "under a point", in: SaleSettlement{BillAmount: 99}, want: SalePoints{}},
+		{name: "program off", disabled: true, in: SaleSettlement{BillAmount: 1000}, want: SalePoints{}},
+		{name: "points spent elsewhere since the quote", in: SaleSettlement{BillAmount: 1000, RedeemAmount: 600, RedeemPoints: 1200}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{
+				settings: Settings{Enabled: !tt.disabled, PointsPer100: 1, PointValue: 0.5, ExpiryMonths: 12, Tiers: testTiers},
+				spend:    tt.spend,
+				totals:   pointsTotals{Balance: 1000},
+			}
+			tt.in.PatientID, tt.in.SaleID = uuid.New(), uuid.New()
+
+			// A non-nil tx keeps the settlement on the caller's transaction
+			got, err := NewService(repo).SettleSale(context.Background(), &sql.Tx{}, uuid.New(), tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SettleSale() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(repo.added) != 0 {
+					t.Errorf("posted %d entries for a refused bill", len(repo.added))
+				}
+				return
+			}
+			if *got != tt.want {
+				t.Errorf("SettleSale() = %+v, want %+v", *got, tt.want)
+			}
+			total := 0
+			for _, e := range repo.added {
+				total += e.Points
+				if e.Type == EntryEarn && e.ExpiresAt == nil {
+					t.Error("earned points have no expiry")
+				}
+			}
+			if want := tt.want.Earned - tt.want.Redeemed; total != want {
+				t.Errorf("posted %d points net, want %d", total, want)
+			}
+		})
+	}
+}
+
+func TestReverseReturn(t *testing.T) {
+	tests := []struct {
+		name     string
+		earned   int
+		reversed int
+		refunded float64
+		refund   float64
+		want     int
+	}{
+		{name: "part of the bill", earned: 30, refund: 400, want: 12},
+		{name: "second return makes up the rest", earned: 30, reversed: 12, refunded: 400, refund: 600, want: 18},
+		{name: "rounding evens out over returns", earned: 10, reversed: 3, refunded: 333, refund: 333, want: 4},
+		{name: "refund past the bill", earned: 30, reversed: 30, refunded: 1000, refund: 50, want: 0},
+		{name: "bill earned nothing", earned: 0, refund: 400, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{
+				salePoints: SalePoints{Earned: tt.earned, Reversed: tt.reversed},
+				billAmount: 1000,
+				refunded:   tt.refunded,
+			}
+			// A non-nil tx keeps the reversal on the return's transaction
+			got, err := NewService(repo).ReverseReturn(context.Background(), &sql.Tx{}, uuid.New(), uuid.New(), uuid.New(), uuid.New(), "CN/25-26/00001", tt.refund, "Ravi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ReverseReturn() = %d, want %d", got, tt.want)
+			}
+			if tt.want == 0 {
+				if len(repo.added) != 0 {
+					t.Errorf("posted %+v for nothing to reverse", repo.added)
+				}
+				return
+			}
+			if len(repo.added) != 1 || repo.added[0].Type != EntryReverse || repo.added[0].Points != -tt.want || repo.added[0].BaseAmount != tt.refund {
+				t.Errorf("posted %+v, want one REVERSE of %d on %.2f", repo.added, tt.want, tt.refund)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"organization-service/internal/pharmacy/clock"
+	"organization-service/middleware"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	svc      Service
+	validate *validator.Validate
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{
+		svc:      svc,
+		validate: validator.New(),
+	}
+}
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+}
+
+type PaginationMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// GetSnapshot returns the catalog and stock for offline billing; pass the
+// token of the previous snapshot as ?since= to get only what changed
+func (h *Handler) GetSnapshot(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	snapshot, err := h.svc.GetSnapshot(c.Request.Context(), pharmacyID, c.Query("since"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			h.respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, snapshot)
+}
+
+// Upload books a batch of bills made while the counter was offline. Each bill's
+// outcome is in the result; a rejected bill does not fail the upload.
+func (h *Handler) Upload(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	var req UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	result, err := h.svc.Upload(c.Request.Context(), pharmacyID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, result)
+}
+
+func (h *Handler) ListBills(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	status := c.Query("status")
+	switch BillStatus(status) {
+	case "", BillProcessing, BillReconciled, BillRejected:
+	default:
+		h.respondError(c, http.StatusBadRequest, "status must be one of PROCESSING, RECONCILED, REJECTED")
+		return
+	}
+
+	page, pageSize := pagination(c)
+	bills, total, err := h.svc.ListBills(c.Request.Context(), pharmacyID, status, c.Query("device_id"), page, pageSize)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondPage(c, bills, total, page, pageSize)
+}
+
+// GetReport sums up reconciled and rejected offline bills billed between
+// ?from= and ?to= (YYYY-MM-DD, default the last 30 days)
+func (h *Handler) GetReport(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy")
+		return
+	}
+
+	to := clock.Today()
+	from := to.AddDate(0, 0, -30)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			h.respondError(c, http.StatusBadRequest, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			h.respondError(c, http.StatusBadRequest, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+	}
+
+	report, err := h.svc.GetReport(c.Request.Context(), pharmacyID, from, to)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, report)
+}
+
+func pagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
+
+func (h *Handler) respondPage(c *gin.Context, data interface{}, total, page, pageSize int) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    data,
+		Meta: PaginationMeta{
+			Total:  total,
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		},
+	})
+}
+
+func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, APIResponse{Success: true, Data: data})
+}
+
+func (h *Handler) respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, APIResponse{Success: false, Error: message})
+}
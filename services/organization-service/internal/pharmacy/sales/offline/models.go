@@ -0,0 +1,180 @@
+package offline
+
+import (
+	"time"
+
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/sales/promotions"
+
+	"github.com/google/uuid"
+)
+
+// CatalogMedicine is a medicine as the counter needs it to bill offline
+type CatalogMedicine struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Brand        string    `json:"brand_name,omitempty"`
+	Category     string    `json:"category"`
+	DosageForm   string    `json:"dosage_form"`
+	UnitType     string    `json:"unit_type"`
+	HSNCode      string    `json:"hsn_code"`
+	ScheduleType string    `json:"schedule_type,omitempty"`
+	IsRxRequired bool      `json:"is_rx_required"`
+	Barcode      string    `json:"barcode,omitempty"`
+	CGSTRate     float64   `json:"cgst_rate"`
+	SGSTRate     float64   `json:"sgst_rate"`
+	IsActive     bool      `json:"is_active"` // False tells the counter to drop the medicine
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// StockBatch is a batch with the stock the counter may sell from it
+type StockBatch struct {
+	ID                 uuid.UUID `json:"id"`
+	MedicineID         uuid.UUID `json:"medicine_id"`
+	BatchNo            string    `json:"batch_no"`
+	LabelCode          string    `json:"label_code,omitempty"`
+	ExpiryDate         time.Time `json:"expiry_date"`
+	RackNo             string    `json:"rack_no,omitempty"`
+	QuantityAvailable  int       `json:"quantity_available"`
+	Reserved           int       `json:"reserved"` // Held by open bills on other counters
+	Sellable           int       `json:"sellable"` // Zero once expired or quarantined
+	MRP                float64   `json:"mrp"`
+	UnitPrice          float64   `json:"unit_price"`
+	TotalTaxPercentage float64   `json:"total_tax_percentage"`
+	RetailDiscPerc     float64   `json:"retail_disc_perc"`
+	StaffDiscPerc      float64   `json:"staff_disc_perc"`
+	SpecialDiscPerc    float64   `json:"special_disc_perc"`
+	MaxDiscPerc        float64   `json:"max_disc_perc"`
+	Quarantined        bool      `json:"quarantined"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// Snapshot is the catalog, stock and promotions a counter bills from offline.
+// A full snapshot has every active medicine and every sellable batch; a delta
+// has only rows changed since the token it was asked with, and the counter
+// replaces its copies of those rows. Promotions are always sent in full.
+type Snapshot struct {
+	Token       string                 `json:"token"` // Pass as ?since= for the next delta
+	Full        bool                   `json:"full"`
+	GeneratedAt time.Time              `json:"generated_at"`
+	Medicines   []CatalogMedicine      `json:"medicines"`
+	Batches     []StockBatch           `json:"batches"`
+	Promotions  []promotions.Promotion `json:"promotions"`
+}
+
+type BillStatus string
+
+const (
+	// BillProcessing is a bill being booked; a replay while it lasts returns it as is
+	BillProcessing BillStatus = "PROCESSING"
+	BillReconciled BillStatus = "RECONCILED"
+	// BillRejected could not be booked; uploading it again retries it
+	BillRejected BillStatus = "REJECTED"
+)
+
+type ConflictType string
+
+const (
+	// ConflictReallocated means the billed batch was short and other batches of the product were used
+	ConflictReallocated ConflictType = "BATCH_REALLOCATED"
+	// ConflictOversold means the product no longer had the stock the bill sold
+	ConflictOversold ConflictType = "OVERSOLD"
+	// ConflictPriceMismatch means the server priced the bill differently from the counter
+	ConflictPriceMismatch ConflictType = "PRICE_MISMATCH"
+	// ConflictSafetyReview means a line raised a major drug safety warning that a pharmacist must override
+	ConflictSafetyReview ConflictType = "SAFETY_REVIEW"
+)
+
+type Conflict struct {
+	Type      ConflictType `json:"type"`
+	ProductID *uuid.UUID   `json:"product_id,omitempty"`
+	BatchID   *uuid.UUID   `json:"batch_id,omitempty"`
+	Quantity  int          `json:"quantity,omitempty"`
+	Detail    string       `json:"detail"`
+}
+
+// Bill is the server's record of one uploaded offline bill
+type Bill struct {
+	ID             uuid.UUID  `json:"id"`
+	PharmacyID     uuid.UUID  `json:"pharmacy_id"`
+	ClientBillID   string     `json:"client_bill_id"`
+	DeviceID       string     `json:"device_id"`
+	UploadID       uuid.UUID  `json:"upload_id"`
+	Status         BillStatus `json:"status"`
+	SaleID         *uuid.UUID `json:"sale_id,omitempty"`
+	InvoiceNumber  string     `json:"invoice_number,omitempty"`
+	BilledAt       time.Time  `json:"billed_at"`
+	CustomerName   string     `json:"customer_name,omitempty"`
+	CustomerPhone  string     `json:"customer_phone,omitempty"`
+	ClientTotal    float64    `json:"client_total"`
+	ServerTotal    *float64   `json:"server_total,omitempty"`
+	Conflicts      []Conflict `json:"conflicts"`
+	RejectReason   string     `json:"reject_reason,omitempty"`
+	Attempts       int        `json:"attempts"`
+	UploadedByName string     `json:"uploaded_by_name,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Replayed       bool       `json:"replayed,omitempty"` // Already on record; nothing was billed again
+}
+
+type UploadResult struct {
+	UploadID   uuid.UUID `json:"upload_id"`
+	Reconciled int       `json:"reconciled"`
+	Rejected   int       `json:"rejected"`
+	Replayed   int       `json:"replayed"`
+	Bills      []Bill    `json:"bills"`
+}
+
+type DeviceSummary struct {
+	DeviceID   string    `json:"device_id"`
+	Reconciled int       `json:"reconciled"`
+	Rejected   int       `json:"rejected"`
+	LastSyncAt time.Time `json:"last_sync_at"`
+}
+
+// Report sums up the offline bills billed in a period
+type Report struct {
+	From             time.Time       `json:"from"`
+	To               time.Time       `json:"to"`
+	Reconciled       int             `json:"reconciled"`
+	Rejected         int             `json:"rejected"`
+	Processing       int             `json:"processing"`
+	WithConflicts    int             `json:"with_conflicts"` // Reconciled, but not exactly as billed
+	ReconciledAmount float64         `json:"reconciled_amount"`
+	RejectedAmount   float64         `json:"rejected_amount"` // What the counter collected on bills not booked
+	Devices          []DeviceSummary `json:"devices"`
+	RejectedBills    []Bill          `json:"rejected_bills"`
+}
+
+// Request Structs
+
+type Tender struct {
+	Mode      string  `json:"mode" validate:"required,oneof=CASH UPI CARD CREDIT"`
+	Amount    float64 `json:"amount" validate:"required,gt=0"`
+	Reference string  `json:"reference,omitempty" validate:"omitempty,max=100"`
+}
+
+type BillItem struct {
+	ProductID          uuid.UUID `json:"product_id" validate:"required"`
+	BatchID            uuid.UUID `json:"batch_id" validate:"required"`
+	Quantity           int       `json:"quantity" validate:"required,min=1"`
+	DiscountPercentage *float64  `json:"discount_percentage,omitempty" validate:"omitempty,gte=0,lte=100"` // The counter's discount; the tier discount when omitted
+}
+
+type BillRequest struct {
+	ClientBillID   string                           `json:"client_bill_id" validate:"required,max=64"`
+	BilledAt       time.Time                        `json:"billed_at" validate:"required"`
+	CustomerName   string                           `json:"customer_name" validate:"required,max=255"`
+	CustomerPhone  string                           `json:"customer_phone" validate:"required,max=20"`
+	CustomerAge    int                              `json:"customer_age" validate:"min=0,max=150"`
+	CustomerGender string                           `json:"customer_gender" validate:"max=20"`
+	Items          []BillItem                       `json:"items" validate:"required,min=1,max=100,dive"`
+	Tenders        []Tender                         `json:"tenders" validate:"required,min=1,max=6,dive"`
+	TotalAmount    float64                          `json:"total_amount" validate:"required,gt=0"` // What the counter charged
+	Prescriber     *compliance.SetPrescriberRequest `json:"prescriber,omitempty" validate:"omitempty"`
+}
+
+type UploadRequest struct {
+	DeviceID string        `json:"device_id" validate:"required,max=64"`
+	Bills    []BillRequest `json:"bills" validate:"required,min=1,max=50,dive"`
+}
@@ -0,0 +1,341 @@
+package offline
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	// Now is the database clock, which delta tokens are measured against
+	Now(ctx context.Context) (time.Time, error)
+	// ListMedicines returns the active catalog, or every medicine changed after since
+	ListMedicines(ctx context.Context, pharmacyID uuid.UUID, since *time.Time) ([]CatalogMedicine, error)
+	// ListBatches returns the sellable batches, or every batch whose stock or holds changed after since
+	ListBatches(ctx context.Context, pharmacyID uuid.UUID, since *time.Time) ([]StockBatch, error)
+
+	// ClaimBill records the bill as PROCESSING for this upload and returns true. When the
+	// bill is already on record it returns the stored bill, claimed again only if it was
+	// rejected or its processing stalled for longer than staleAfter.
+	ClaimBill(ctx context.Context, b *Bill, userID uuid.UUID, payload []byte, staleAfter time.Duration) (bool, *Bill, error)
+	SetBillSale(ctx context.Context, id, saleID uuid.UUID) error
+	FinishBill(ctx context.Context, b *Bill) error
+	ListBills(ctx context.Context, pharmacyID uuid.UUID, status, deviceID string, limit, offset int) ([]Bill, int, error)
+	GetReport(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*Report, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) Now(ctx context.Context) (time.Time, error) {
+	var now time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT NOW()`).Scan(&now)
+	return now, err
+}
+
+func (r *postgresRepository) ListMedicines(ctx context.Context, pharmacyID uuid.UUID, since *time.Time) ([]CatalogMedicine, error) {
+	query := `
+		SELECT id, name, COALESCE(brand_name, ''), category, dosage_form, unit_type, hsn_code,
+		       COALESCE(schedule_type, ''), COALESCE(is_rx_required, FALSE), COALESCE(barcode, ''),
+		       COALESCE(cgst_rate, 0), COALESCE(sgst_rate, 0), COALESCE(is_active, TRUE), updated_at
+		FROM inventory.medicines
+		WHERE pharmacy_id = $1`
+	args := []interface{}{pharmacyID}
+	if since != nil {
+		query += ` AND updated_at > $2`
+		args = append(args, *since)
+	} else {
+		query += ` AND COALESCE(is_active, TRUE)`
+	}
+	query += ` ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalog: %w", err)
+	}
+	defer rows.Close()
+
+	medicines := []CatalogMedicine{}
+	for rows.Next() {
+		var m CatalogMedicine
+		if err := rows.Scan(
+			&m.ID, &m.Name, &m.Brand, &m.Category, &m.DosageForm, &m.UnitType, &m.HSNCode,
+			&m.ScheduleType, &m.IsRxRequired, &m.Barcode, &m.CGSTRate, &m.SGSTRate, &m.IsActive, &m.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		medicines = append(medicines, m)
+	}
+	return medicines, rows.Err()
+}
+
+func (r *postgresRepository) ListBatches(ctx context.Context, pharmacyID uuid.UUID, since *time.Time) ([]StockBatch, error) {
+	// A hold placed or released on another counter changes what is sellable
+	// without touching the batch row, so holds count as a change too
+	query := `
+		WITH held AS (
+			SELECT batch_id, SUM(quantity) AS reserved
+			FROM inventory.reservations
+			WHERE pharmacy_id = $1 AND status = 'PENDING' AND expires_at > NOW()
+			GROUP BY batch_id
+		)
+		SELECT b.id, b.medicine_id, b.batch_no, COALESCE(b.label_code, ''), b.expiry_date, COALESCE(b.rack_no, ''),
+		       b.quantity_available, COALESCE(h.reserved, 0), b.mrp, b.unit_price,
+		       COALESCE(b.cgst_rate, 0) + COALESCE(b.sgst_rate, 0),
+		       COALESCE(b.retail_disc_perc, 0), COALESCE(b.staff_disc_perc, 0),
+		       COALESCE(b.special_disc_perc, 0), COALESCE(b.max_disc_perc, 0),
+		       b.quarantined_at IS NOT NULL, b.updated_at
+		FROM inventory.batches b
+		LEFT JOIN held h ON h.batch_id = b.id
+		WHERE b.pharmacy_id = $1`
+	args := []interface{}{pharmacyID}
+	if since != nil {
+		query += ` AND (b.updated_at > $2 OR b.id IN (
+			SELECT batch_id FROM inventory.reservations WHERE pharmacy_id = $1 AND updated_at > $2
+		))`
+		args = append(args, *since)
+	} else {
+		query += ` AND b.quantity_available > 0 AND b.expiry_date >= CURRENT_DATE AND b.quarantined_at IS NULL`
+	}
+	query += ` ORDER BY b.medicine_id, b.expiry_date`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stock: %w", err)
+	}
+	defer rows.Close()
+
+	today := time.Now().Truncate(24 * time.Hour)
+	batches := []StockBatch{}
+	for rows.Next() {
+		var b StockBatch
+		if err := rows.Scan(
+			&b.ID, &b.MedicineID, &b.BatchNo, &b.LabelCode, &b.ExpiryDate, &b.RackNo,
+			&b.QuantityAvailable, &b.Reserved, &b.MRP, &b.UnitPrice, &b.TotalTaxPercentage,
+			&b.RetailDiscPerc, &b.StaffDiscPerc, &b.SpecialDiscPerc, &b.MaxDiscPerc,
+			&b.Quarantined, &b.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if !b.Quarantined && !b.ExpiryDate.Before(today) && b.QuantityAvailable > b.Reserved {
+			b.Sellable = b.QuantityAvailable - b.Reserved
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+const billColumns = `
+	id, pharmacy_id, client_bill_id, device_id, upload_id, status, sale_id, COALESCE(invoice_number, ''),
+	billed_at, COALESCE(customer_name, ''), COALESCE(customer_phone, ''), client_total, server_total,
+	conflicts, COALESCE(reject_reason, ''), attempts, COALESCE(uploaded_by_name, ''), created_at, updated_at`
+
+func (r *postgresRepository) ClaimBill(ctx context.Context, b *Bill, userID uuid.UUID, payload []byte, staleAfter time.Duration) (bool, *Bill, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO sales_schema.offline_bills (
+			id, pharmacy_id, client_bill_id, device_id, upload_id, status, billed_at, customer_name, customer_phone,
+			client_total, payload, uploaded_by, uploaded_by_name, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14)
+		ON CONFLICT (pharmacy_id, client_bill_id) DO NOTHING`,
+		b.ID, b.PharmacyID, b.ClientBillID, b.DeviceID, b.UploadID, BillProcessing, b.BilledAt, b.CustomerName, b.CustomerPhone,
+		b.ClientTotal, payload, userID, b.UploadedByName, b.CreatedAt)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to record offline bill: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		b.Status = BillProcessing
+		b.Attempts = 1
+		return true, nil, tx.Commit()
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+billColumns+`
+		FROM sales_schema.offline_bills
+		WHERE pharmacy_id = $1 AND client_bill_id = $2
+		FOR UPDATE`, b.PharmacyID, b.ClientBillID)
+	if err != nil {
+		return false, nil, err
+	}
+	bills, err := scanBills(rows)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(bills) == 0 {
+		return false, nil, fmt.Errorf("offline bill %s not found", b.ClientBillID)
+	}
+	prior := bills[0]
+
+	stalled := prior.Status == BillProcessing && time.Since(prior.UpdatedAt) > staleAfter
+	if prior.Status != BillRejected && !stalled {
+		return false, &prior, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sales_schema.offline_bills SET
+			status = $2, device_id = $3, upload_id = $4, billed_at = $5, customer_name = $6, customer_phone = $7,
+			client_total = $8, payload = $9, uploaded_by = $10, uploaded_by_name = $11,
+			sale_id = NULL, invoice_number = NULL, server_total = NULL, conflicts = '[]', reject_reason = NULL,
+			attempts = attempts + 1, updated_at = $12
+		WHERE id = $1`,
+		prior.ID, BillProcessing, b.DeviceID, b.UploadID, b.BilledAt, b.CustomerName, b.CustomerPhone,
+		b.ClientTotal, payload, userID, b.UploadedByName, time.Now())
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to retry offline bill: %w", err)
+	}
+	b.ID = prior.ID
+	b.Status = BillProcessing
+	b.Attempts = prior.Attempts + 1
+	b.CreatedAt = prior.CreatedAt
+	return true, &prior, tx.Commit()
+}
+
+func (r *postgresRepository) SetBillSale(ctx context.Context, id, saleID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sales_schema.offline_bills SET sale_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, saleID)
+	return err
+}
+
+func (r *postgresRepository) FinishBill(ctx context.Context, b *Bill) error {
+	conflicts, err := json.Marshal(b.Conflicts)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE sales_schema.offline_bills SET
+			status = $2, sale_id = $3, invoice_number = NULLIF($4, ''), server_total = $5,
+			conflicts = $6, reject_reason = NULLIF($7, ''), updated_at = $8
+		WHERE id = $1`,
+		b.ID, b.Status, b.SaleID, b.InvoiceNumber, b.ServerTotal, conflicts, b.RejectReason, b.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record offline bill outcome: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListBills(ctx context.Context, pharmacyID uuid.UUID, status, deviceID string, limit, offset int) ([]Bill, int, error) {
+	where := `WHERE pharmacy_id = $1`
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(` AND status = $%d`, len(args))
+	}
+	if deviceID != "" {
+		args = append(args, deviceID)
+		where += fmt.Sprintf(` AND device_id = $%d`, len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sales_schema.offline_bills `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`SELECT `+billColumns+`
+		FROM sales_schema.offline_bills `+where+`
+		ORDER BY billed_at DESC
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	bills, err := scanBills(rows)
+	return bills, total, err
+}
+
+func (r *postgresRepository) GetReport(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*Report, error) {
+	const period = `pharmacy_id = $1 AND timezone('Asia/Kolkata', billed_at)::date BETWEEN $2 AND $3`
+	report := &Report{From: from, To: to, Devices: []DeviceSummary{}}
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE status = 'RECONCILED'),
+			COUNT(*) FILTER (WHERE status = 'REJECTED'),
+			COUNT(*) FILTER (WHERE status = 'PROCESSING'),
+			COUNT(*) FILTER (WHERE status = 'RECONCILED' AND jsonb_array_length(conflicts) > 0),
+			COALESCE(SUM(server_total) FILTER (WHERE status = 'RECONCILED'), 0),
+			COALESCE(SUM(client_total) FILTER (WHERE status = 'REJECTED'), 0)
+		FROM sales_schema.offline_bills
+		WHERE `+period, pharmacyID, from, to).Scan(
+		&report.Reconciled, &report.Rejected, &report.Processing, &report.WithConflicts,
+		&report.ReconciledAmount, &report.RejectedAmount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT device_id,
+		       COUNT(*) FILTER (WHERE status = 'RECONCILED'),
+		       COUNT(*) FILTER (WHERE status = 'REJECTED'),
+		       MAX(updated_at)
+		FROM sales_schema.offline_bills
+		WHERE `+period+`
+		GROUP BY device_id
+		ORDER BY device_id`, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DeviceSummary
+		if err := rows.Scan(&d.DeviceID, &d.Reconciled, &d.Rejected, &d.LastSyncAt); err != nil {
+			return nil, err
+		}
+		report.Devices = append(report.Devices, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	billRows, err := r.db.QueryContext(ctx, `SELECT `+billColumns+`
+		FROM sales_schema.offline_bills
+		WHERE `+period+` AND status = 'REJECTED'
+		ORDER BY billed_at`, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.RejectedBills, err = scanBills(billRows)
+	return report, err
+}
+
+func scanBills(rows *sql.Rows) ([]Bill, error) {
+	defer rows.Close()
+
+	bills := []Bill{}
+	for rows.Next() {
+		var b Bill
+		var conflicts []byte
+		var serverTotal sql.NullFloat64
+		if err := rows.Scan(
+			&b.ID, &b.PharmacyID, &b.ClientBillID, &b.DeviceID, &b.UploadID, &b.Status, &b.SaleID, &b.InvoiceNumber,
+			&b.BilledAt, &b.CustomerName, &b.CustomerPhone, &b.ClientTotal, &serverTotal,
+			&conflicts, &b.RejectReason, &b.Attempts, &b.UploadedByName, &b.CreatedAt, &b.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if serverTotal.Valid {
+			b.ServerTotal = &serverTotal.Float64
+		}
+		b.Conflicts = []Conflict{}
+		if len(conflicts) > 0 {
+			if err := json.Unmarshal(conflicts, &b.Conflicts); err != nil {
+				return nil, err
+			}
+		}
+		bills = append(bills, b)
+	}
+	return bills, rows.Err()
+}
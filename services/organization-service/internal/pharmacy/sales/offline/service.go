@@ -0,0 +1,362 @@
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+	"organization-service/internal/pharmacy/safety"
+	"organization-service/internal/pharmacy/sales/clients"
+	"organization-service/internal/pharmacy/sales/promotions"
+	"organization-service/internal/pharmacy/sales/sales"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// tokenOverlap re-sends rows changed just before a token was issued, so a
+	// write committed while the snapshot was being read is not missed
+	tokenOverlap = time.Minute
+	// staleAfter is how long a bill may sit in PROCESSING before a replay takes it over
+	staleAfter = 10 * time.Minute
+	// priceTolerance absorbs float rounding between the counter and the server
+	priceTolerance = 0.01
+)
+
+// ErrInvalidToken is returned for a since token this service did not issue
+var ErrInvalidToken = errors.New("invalid sync token; fetch a full snapshot")
+
+type Service interface {
+	// GetSnapshot returns the full catalog and stock, or the delta since a token from an earlier snapshot
+	GetSnapshot(ctx context.Context, pharmacyID uuid.UUID, since string) (*Snapshot, error)
+	// Upload books offline bills through the regular sales flow, oldest first. A bill already
+	// on record is returned as stored, so a counter can safely upload the same batch again.
+	Upload(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UploadRequest) (*UploadResult, error)
+	ListBills(ctx context.Context, pharmacyID uuid.UUID, status, deviceID string, page, pageSize int) ([]Bill, int, error)
+	GetReport(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*Report, error)
+}
+
+type service struct {
+	repo       Repository
+	salesSvc   sales.Service
+	promotions promotions.Service
+}
+
+func NewService(repo Repository, salesSvc sales.Service, promotionsSvc promotions.Service) Service {
+	return &service{
+		repo:       repo,
+		salesSvc:   salesSvc,
+		promotions: promotionsSvc,
+	}
+}
+
+func (s *service) GetSnapshot(ctx context.Context, pharmacyID uuid.UUID, since string) (*Snapshot, error) {
+	var from *time.Time
+	if since != "" {
+		t, err := decodeToken(since)
+		if err != nil {
+			return nil, err
+		}
+		t = t.Add(-tokenOverlap)
+		from = &t
+	}
+
+	now, err := s.repo.Now(ctx)
+	if err != nil {
+		return nil, err
+	}
+	medicines, err := s.repo.ListMedicines(ctx, pharmacyID, from)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := s.repo.ListBatches(ctx, pharmacyID, from)
+	if err != nil {
+		return nil, err
+	}
+	promos, err := s.promotions.Runnable(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		Token:       encodeToken(now),
+		Full:        from == nil,
+		GeneratedAt: now,
+		Medicines:   medicines,
+		Batches:     batches,
+		Promotions:  promos,
+	}, nil
+}
+
+func encodeToken(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("v1:" + strconv.FormatInt(t.UnixMicro(), 10)))
+}
+
+func decodeToken(token string) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil && strings.HasPrefix(string(raw), "v1:") {
+		if micros, err := strconv.ParseInt(strings.TrimPrefix(string(raw), "v1:"), 10, 64); err == nil {
+			return time.UnixMicro(micros), nil
+		}
+	}
+	return time.Time{}, ErrInvalidToken
+}
+
+func (s *service) Upload(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UploadRequest) (*UploadResult, error) {
+	// Stock goes to the bills rung up first when the upload oversells a batch
+	sort.SliceStable(req.Bills, func(i, j int) bool { return req.Bills[i].BilledAt.Before(req.Bills[j].BilledAt) })
+
+	result := &UploadResult{UploadID: uuid.New(), Bills: make([]Bill, 0, len(req.Bills))}
+	for _, b := range req.Bills {
+		bill, err := s.syncBill(ctx, pharmacyID, userID, userName, req.DeviceID, result.UploadID, b)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case bill.Replayed:
+			result.Replayed++
+		case bill.Status == BillReconciled:
+			result.Reconciled++
+		case bill.Status == BillRejected:
+			result.Rejected++
+		}
+		result.Bills = append(result.Bills, *bill)
+	}
+	return result, nil
+}
+
+func (s *service) syncBill(ctx context.Context, pharmacyID, userID uuid.UUID, userName, deviceID string, uploadID uuid.UUID, req BillRequest) (*Bill, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	bill := &Bill{
+		ID:             uuid.New(),
+		PharmacyID:     pharmacyID,
+		ClientBillID:   req.ClientBillID,
+		DeviceID:       deviceID,
+		UploadID:       uploadID,
+		BilledAt:       req.BilledAt,
+		CustomerName:   req.CustomerName,
+		CustomerPhone:  req.CustomerPhone,
+		ClientTotal:    req.TotalAmount,
+		Conflicts:      []Conflict{},
+		UploadedByName: userName,
+		CreatedAt:      time.Now(),
+	}
+
+	claimed, prior, err := s.repo.ClaimBill(ctx, bill, userID, payload, staleAfter)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		prior.Replayed = true
+		return prior, nil
+	}
+
+	// An attempt that stalled may have booked the sale before it stopped
+	booked := false
+	if prior != nil && prior.SaleID != nil {
+		if sale, err := s.salesSvc.GetSaleWithDetails(ctx, pharmacyID, *prior.SaleID); err == nil {
+			switch sale.Status {
+			case sales.StatusCompleted, sales.StatusDispatched:
+				total := money.Round2(sale.TotalAmount)
+				bill.Status = BillReconciled
+				bill.SaleID = &sale.ID
+				bill.InvoiceNumber = sale.InvoiceNumber
+				bill.ServerTotal = &total
+				booked = true
+			case sales.StatusDraft, sales.StatusPending, sales.StatusAbandoned:
+				_ = s.salesSvc.DiscardDraft(ctx, pharmacyID, sale.ID)
+			}
+		}
+	}
+	if !booked {
+		s.book(ctx, pharmacyID, userID, userName, bill, req)
+	}
+
+	bill.UpdatedAt = time.Now()
+	if err := s.repo.FinishBill(ctx, bill); err != nil {
+		return nil, err
+	}
+	return bill, nil
+}
+
+// book rings the bill up as the counter did: a walk-in draft with the billed
+// batches and discounts, promotions priced as at the billing time, then checkout
+// with the tenders collected. The patient's wallet is left out of the settlement
+// since the counter could not see it. Anything that stops the sale rejects the bill.
+func (s *service) book(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, bill *Bill, req BillRequest) {
+	ctx = sales.WithPricingTime(ctx, req.BilledAt)
+
+	draft, err := s.salesSvc.CreateWalkInDraft(ctx, pharmacyID, sales.Patient{
+		Name:   req.CustomerName,
+		Phone:  req.CustomerPhone,
+		Age:    req.CustomerAge,
+		Gender: req.CustomerGender,
+	})
+	if err != nil {
+		bill.Status = BillRejected
+		bill.RejectReason = err.Error()
+		return
+	}
+	bill.SaleID = &draft.ID
+	_ = s.repo.SetBillSale(ctx, bill.ID, draft.ID)
+
+	reject := func(reason string) {
+		_ = s.salesSvc.DiscardDraft(ctx, pharmacyID, draft.ID)
+		bill.Status = BillRejected
+		bill.RejectReason = reason
+	}
+
+	for _, it := range req.Items {
+		productID, batchID := it.ProductID, it.BatchID
+		add := sales.AddItemRequest{
+			ProductID: it.ProductID,
+			BatchID:   it.BatchID,
+			Quantity:  it.Quantity,
+		}
+		items, err := s.salesSvc.AddItemToDraft(ctx, pharmacyID, draft.ID, add)
+		// A major safety warning needs a pharmacist's reason, which the counter never took
+		var overrideErr *safety.OverrideRequiredError
+		if errors.As(err, &overrideErr) {
+			bill.Conflicts = append(bill.Conflicts, Conflict{
+				Type:      ConflictSafetyReview,
+				ProductID: &productID,
+				BatchID:   &batchID,
+				Quantity:  it.Quantity,
+				Detail:    majorWarnings(overrideErr.Result),
+			})
+			reject("drug safety warnings need a pharmacist's review; bill it again at the counter with an override reason")
+			return
+		}
+		if err != nil {
+			// The billed batch may have sold out meanwhile; any other batch of the product will do
+			add.BatchID = uuid.Nil
+			var retryErr error
+			items, retryErr = s.salesSvc.AddItemToDraft(ctx, pharmacyID, draft.ID, add)
+			if retryErr != nil {
+				if errors.Is(retryErr, clients.ErrInsufficientStock) {
+					bill.Conflicts = append(bill.Conflicts, Conflict{
+						Type:      ConflictOversold,
+						ProductID: &productID,
+						BatchID:   &batchID,
+						Quantity:  it.Quantity,
+						Detail:    retryErr.Error(),
+					})
+					reject(fmt.Sprintf("oversold: %d units of product %s are no longer in stock", it.Quantity, it.ProductID))
+					return
+				}
+				reject(retryErr.Error())
+				return
+			}
+			batchNos := make([]string, 0, len(items))
+			for _, item := range items {
+				batchNos = append(batchNos, item.BatchNo)
+			}
+			bill.Conflicts = append(bill.Conflicts, Conflict{
+				Type:      ConflictReallocated,
+				ProductID: &productID,
+				BatchID:   &batchID,
+				Quantity:  it.Quantity,
+				Detail:    fmt.Sprintf("%v; billed from batch %s instead", err, strings.Join(batchNos, ", ")),
+			})
+		}
+
+		if it.DiscountPercentage == nil {
+			continue
+		}
+		for _, item := range items {
+			if math.Abs(item.DiscountPercentage-item.PromoDiscPerc-*it.DiscountPercentage) < 0.005 {
+				continue
+			}
+			if err := s.salesSvc.UpdateItem(ctx, pharmacyID, draft.ID, item.ID, sales.UpdateItemRequest{
+				Quantity:           item.Quantity,
+				DiscountPercentage: it.DiscountPercentage,
+			}); err != nil {
+				reject(err.Error())
+				return
+			}
+		}
+	}
+
+	if req.Prescriber != nil {
+		if _, err := s.salesSvc.SetPrescriber(ctx, pharmacyID, draft.ID, userID, userName, *req.Prescriber); err != nil {
+			reject(err.Error())
+			return
+		}
+	}
+
+	sale, err := s.salesSvc.GetSaleWithDetails(ctx, pharmacyID, draft.ID)
+	if err != nil {
+		reject(err.Error())
+		return
+	}
+	total := money.Round2(sale.TotalAmount)
+	bill.ServerTotal = &total
+	if math.Abs(total-req.TotalAmount) > priceTolerance {
+		bill.Conflicts = append(bill.Conflicts, Conflict{
+			Type:   ConflictPriceMismatch,
+			Detail: fmt.Sprintf("priced at %.2f on the server against %.2f at the counter", total, req.TotalAmount),
+		})
+		reject("the bill prices differently now; bill it again at the counter")
+		return
+	}
+
+	tenders := make([]sales.Tender, 0, len(req.Tenders))
+	for _, t := range req.Tenders {
+		tenders = append(tenders, sales.Tender{Mode: sales.PaymentMode(t.Mode), Amount: t.Amount, Reference: t.Reference})
+	}
+	finalized, err := s.salesSvc.FinalizeSale(ctx, pharmacyID, draft.ID, sales.FinalizeSaleRequest{
+		Tenders:         tenders,
+		BillOnly:        true,
+		DispensedBy:     userID,
+		DispensedByName: userName,
+	})
+	if err != nil {
+		reject(err.Error())
+		return
+	}
+
+	bill.Status = BillReconciled
+	bill.InvoiceNumber = finalized.InvoiceNumber
+}
+
+// majorWarnings describes the warnings that held a line back for review
+func majorWarnings(result *safety.CheckResult) string {
+	var descriptions []string
+	for _, w := range result.Warnings {
+		if w.Severity == safety.SeverityMajor {
+			descriptions = append(descriptions, fmt.Sprintf("%s: %s", w.Medicine, w.Description))
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+func (s *service) ListBills(ctx context.Context, pharmacyID uuid.UUID, status, deviceID string, page, pageSize int) ([]Bill, int, error) {
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return s.repo.ListBills(ctx, pharmacyID, status, deviceID, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) GetReport(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*Report, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("to is before from")
+	}
+	report, err := s.repo.GetReport(ctx, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.ReconciledAmount = money.Round2(report.ReconciledAmount)
+	report.RejectedAmount = money.Round2(report.RejectedAmount)
+	return report, nil
+}
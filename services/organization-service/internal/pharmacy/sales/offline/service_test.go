@@ -0,0 +1,400 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"organization-service/internal/pharmacy/safety"
+	"organization-service/internal/pharmacy/sales/clients"
+	"organization-service/internal/pharmacy/sales/promotions"
+	"organization-service/internal/pharmacy/sales/sales"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepository claims bills by client id and records what the upload wrote back
+type fakeRepository struct {
+	Repository
+	now      time.Time
+	since    []*time.Time
+	onRecord map[string]*Bill // Bills a replay returns as stored
+	stalled  map[string]*Bill // Bills claimed again after an earlier attempt stalled
+	finished []Bill
+}
+
+func (f *fakeRepository) Now(context.Context) (time.Time, error) {
+	return f.now, nil
+}
+
+func (f *fakeRepository) ListMedicines(_ context.Context, _ uuid.UUID, since *time.Time) ([]CatalogMedicine, error) {
+	f.since = append(f.since, since)
+	return nil, nil
+}
+
+func (f *fakeRepository) ListBatches(context.Context, uuid.UUID, *time.Time) ([]StockBatch, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) ClaimBill(_ context.Context, b *Bill, _ uuid.UUID, _ []byte, _ time.Duration) (bool, *Bill, error) {
+	if prior, ok := f.onRecord[b.ClientBillID]; ok {
+		return false, prior, nil
+	}
+	return true, f.stalled[b.ClientBillID], nil
+}
+
+func (f *fakeRepository) SetBillSale(context.Context, uuid.UUID, uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeRepository) FinishBill(_ context.Context, b *Bill) error {
+	f.finished = append(f.finished, *b)
+	return nil
+}
+
+// fakeSales rings bills up against batches that may have sold out since
+type fakeSales struct {
+	sales.Service
+	soldOutBatches  map[uuid.UUID]bool
+	soldOutProducts map[uuid.UUID]bool
+	unknownProducts map[uuid.UUID]bool
+	inventoryDown   bool
+	majorWarning    map[uuid.UUID]bool        // Products that interact with the bill and need an override
+	existing        map[uuid.UUID]*sales.Sale // Sales booked by earlier attempts
+	total           float64
+	finalizeErr     error
+
+	drafts    int
+	overrides []string
+	updated   []float64
+	discarded []uuid.UUID
+	finalized *sales.FinalizeSaleRequest
+}
+
+func (f *fakeSales) CreateWalkInDraft(context.Context, uuid.UUID, sales.Patient) (*sales.Sale, error) {
+	f.drafts++
+	return &sales.Sale{ID: uuid.New(), Status: sales.StatusDraft}, nil
+}
+
+func (f *fakeSales) AddItemToDraft(_ context.Context, _, _ uuid.UUID, req sales.AddItemRequest) ([]sales.SaleItem, error) {
+	f.overrides = append(f.overrides, req.OverrideReason)
+	switch {
+	case f.majorWarning[req.ProductID] && req.OverrideReason == "":
+		return nil, &safety.OverrideRequiredError{Result: &safety.CheckResult{
+			RequiresOverride: true,
+			Warnings:         []safety.Warning{{Severity: safety.SeverityMajor, Medicine: "Warfarin 5mg", Description: "raises bleeding risk with aspirin"}},
+		}}
+	case f.unknownProducts[req.ProductID]:
+		return nil, errors.New("medicine not found")
+	case f.inventoryDown:
+		return nil, errors.New("failed to get stock for product: connection refused")
+	case f.soldOutProducts[req.ProductID]:
+		return nil, fmt.Errorf("%w in batch. Needed %d more", clients.ErrInsufficientStock, req.Quantity)
+	case f.soldOutBatches[req.BatchID]:
+		return nil, fmt.Errorf("%w in batch %s: 0 available", clients.ErrInsufficientStock, req.BatchID)
+	}
+	batchNo := "B1"
+	if req.BatchID == uuid.Nil {
+		batchNo = "B2"
+	}
+	return []sales.SaleItem{{ID: uuid.New(), ProductID: req.ProductID, Quantity: req.Quantity, BatchNo: batchNo, DiscountPercentage: 5}}, nil
+}
+
+func (f *fakeSales) UpdateItem(_ context.Context, _, _, _ uuid.UUID, req sales.UpdateItemRequest) error {
+	f.updated = append(f.updated, *req.DiscountPercentage)
+	return nil
+}
+
+func (f *fakeSales) GetSaleWithDetails(_ context.Context, _, saleID uuid.UUID) (*sales.Sale, error) {
+	if s, ok := f.existing[saleID]; ok {
+		return s, nil
+	}
+	return &sales.Sale{ID: saleID, Status: sales.StatusDraft, TotalAmount: f.total}, nil
+}
+
+func (f *fakeSales) FinalizeSale(_ context.Context, _, saleID uuid.UUID, req sales.FinalizeSaleRequest) (*sales.Sale, error) {
+	if f.finalizeErr != nil {
+		return nil, f.finalizeErr
+	}
+	f.finalized = &req
+	return &sales.Sale{ID: saleID, Status: sales.StatusCompleted, InvoiceNumber: "INV/25-26/000001"}, nil
+}
+
+func (f *fakeSales) DiscardDraft(_ context.Context, _, saleID uuid.UUID) error {
+	f.discarded = append(f.discarded, saleID)
+	return nil
+}
+
+// fakePromotions has no promotions running
+type fakePromotions struct {
+	promotions.Service
+}
+
+func (fakePromotions) Runnable(context.Context, uuid.UUID) ([]promotions.Promotion, error) {
+	return nil, nil
+}
+
+func TestToken(t *testing.T) {
+	at := time.Date(2025, time.June, 4, 10, 30, 15, 123456000, time.UTC)
+	got, err := decodeToken(encodeToken(at))
+	if err != nil || !got.Equal(at) {
+		t.Fatalf("decodeToken(encodeToken(%v)) = %v, %v", at, got, err)
+	}
+
+	for _, token := range []string{"", "not-base64!", "djI6MTIz", "djE6YWJj"} {
+		if _, err := decodeToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("decodeToken(%q) error = %v, want ErrInvalidToken", token, err)
+		}
+	}
+}
+
+func TestGetSnapshot(t *testing.T) {
+	now := time.Date(2025, time.June, 4, 10, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	overlap := earlier.Add(-tokenOverlap)
+
+	tests := []struct {
+		name      string
+		since     string
+		wantFull  bool
+		wantSince *time.Time
+		wantErr   error
+	}{
+		{name: "full", wantFull: true},
+		{name: "delta re-sends the overlap", since: encodeToken(earlier), wantSince: &overlap},
+		{name: "token from elsewhere", since: "bogus", wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{now: now}
+			snap, err := NewService(repo, nil, fakePromotions{}).GetSnapshot(context.Background(), uuid.New(), tt.since)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetSnapshot() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if snap.Full != tt.wantFull {
+				t.Errorf("full = %v, want %v", snap.Full, tt.wantFull)
+			}
+			if got := repo.since[0]; (got == nil) != (tt.wantSince == nil) || (got != nil && !got.Equal(*tt.wantSince)) {
+				t.Errorf("listed since %v, want %v", got, tt.wantSince)
+			}
+			if next, _ := decodeToken(snap.Token); !next.Equal(now) {
+				t.Errorf("next token is for %v, want %v", next, now)
+			}
+		})
+	}
+}
+
+func TestUpload(t *testing.T) {
+	product, batch := uuid.New(), uuid.New()
+	tenPercent := 10.0
+	bookedSale := &sales.Sale{ID: uuid.New(), Status: sales.StatusCompleted, InvoiceNumber: "INV/25-26/000007", TotalAmount: 250}
+	leftDraft := &sales.Sale{ID: uuid.New(), Status: sales.StatusDraft}
+	bill := func(id string) BillRequest {
+		return BillRequest{
+			ClientBillID: id,
+			BilledAt:     time.Date(2025, time.June, 4, 9, 0, 0, 0, time.UTC),
+			Items:        []BillItem{{ProductID: product, BatchID: batch, Quantity: 2}},
+			Tenders:      []Tender{{Mode: "CASH", Amount: 250}},
+			TotalAmount:  250,
+		}
+	}
+	withDiscount := bill("c-1")
+	withDiscount.Items[0].DiscountPercentage = &tenPercent
+
+	tests := []struct {
+		name          string
+		req           BillRequest
+		sales         fakeSales
+		onRecord      map[string]*Bill
+		stalled       map[string]*Bill
+		wantStatus    BillStatus
+		wantConflicts []ConflictType
+		wantReplayed  bool
+		wantDrafts    int
+		wantDiscarded int
+		wantUpdated   []float64
+	}{
+		{
+			name:       "booked as billed",
+			req:        bill("c-1"),
+			sales:      fakeSales{total: 250},
+			wantStatus: BillReconciled,
+			wantDrafts: 1,
+		},
+		{
+			name:          "billed batch sold out, another used",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, soldOutBatches: map[uuid.UUID]bool{batch: true}},
+			wantStatus:    BillReconciled,
+			wantConflicts: []ConflictType{ConflictReallocated},
+			wantDrafts:    1,
+		},
+		{
+			name:          "product sold out",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, soldOutProducts: map[uuid.UUID]bool{product: true}},
+			wantStatus:    BillRejected,
+			wantConflicts: []ConflictType{ConflictOversold},
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+		{
+			name:          "product gone from the catalog",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, unknownProducts: map[uuid.UUID]bool{product: true}},
+			wantStatus:    BillRejected,
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+		{
+			name:          "major drug safety warning",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, majorWarning: map[uuid.UUID]bool{product: true}},
+			wantStatus:    BillRejected,
+			wantConflicts: []ConflictType{ConflictSafetyReview},
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+		{
+			name:          "stock could not be checked",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, inventoryDown: true},
+			wantStatus:    BillRejected,
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+		{
+			name:        "counter discount applied",
+			req:         withDiscount,
+			sales:       fakeSales{total: 250},
+			wantStatus:  BillReconciled,
+			wantDrafts:  1,
+			wantUpdated: []float64{10},
+		},
+		{
+			name:       "within rounding of the counter total",
+			req:        bill("c-1"),
+			sales:      fakeSales{total: 250.009},
+			wantStatus: BillReconciled,
+			wantDrafts: 1,
+		},
+		{
+			name:          "prices differently now",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 262.5},
+			wantStatus:    BillRejected,
+			wantConflicts: []ConflictType{ConflictPriceMismatch},
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+		{
+			name:          "checkout refused",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, finalizeErr: errors.New("prescriber details are required")},
+			wantStatus:    BillRejected,
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+		{
+			name:         "uploaded again",
+			req:          bill("c-1"),
+			onRecord:     map[string]*Bill{"c-1": {ClientBillID: "c-1", Status: BillReconciled}},
+			wantStatus:   BillReconciled,
+			wantReplayed: true,
+		},
+		{
+			name:       "stalled attempt had booked the sale",
+			req:        bill("c-1"),
+			sales:      fakeSales{existing: map[uuid.UUID]*sales.Sale{bookedSale.ID: bookedSale}},
+			stalled:    map[string]*Bill{"c-1": {ClientBillID: "c-1", Status: BillProcessing, SaleID: &bookedSale.ID}},
+			wantStatus: BillReconciled,
+		},
+		{
+			name:          "stalled attempt left a draft",
+			req:           bill("c-1"),
+			sales:         fakeSales{total: 250, existing: map[uuid.UUID]*sales.Sale{leftDraft.ID: leftDraft}},
+			stalled:       map[string]*Bill{"c-1": {ClientBillID: "c-1", Status: BillProcessing, SaleID: &leftDraft.ID}},
+			wantStatus:    BillReconciled,
+			wantDrafts:    1,
+			wantDiscarded: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{onRecord: tt.onRecord, stalled: tt.stalled}
+			salesSvc := &tt.sales
+			svc := NewService(repo, salesSvc, fakePromotions{})
+
+			result, err := svc.Upload(context.Background(), uuid.New(), uuid.New(), "Counter 1", UploadRequest{DeviceID: "till-1", Bills: []BillRequest{tt.req}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := result.Bills[0]
+			if got.Status != tt.wantStatus || got.Replayed != tt.wantReplayed {
+				t.Errorf("bill %s (replayed %v), want %s (replayed %v); reason %q", got.Status, got.Replayed, tt.wantStatus, tt.wantReplayed, got.RejectReason)
+			}
+			var conflicts []ConflictType
+			for _, c := range got.Conflicts {
+				conflicts = append(conflicts, c.Type)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+			if got.Status == BillReconciled && !got.Replayed && got.InvoiceNumber == "" {
+				t.Error("reconciled bill has no invoice number")
+			}
+			if salesSvc.drafts != tt.wantDrafts || len(salesSvc.discarded) != tt.wantDiscarded {
+				t.Errorf("drafts %d, discarded %d; want %d, %d", salesSvc.drafts, len(salesSvc.discarded), tt.wantDrafts, tt.wantDiscarded)
+			}
+			for _, reason := range salesSvc.overrides {
+				if reason != "" {
+					t.Errorf("line added with override reason %q; only a pharmacist may override", reason)
+				}
+			}
+			if !reflect.DeepEqual(salesSvc.updated, tt.wantUpdated) {
+				t.Errorf("discounts set = %v, want %v", salesSvc.updated, tt.wantUpdated)
+			}
+			if tt.wantReplayed && len(repo.finished) != 0 {
+				t.Error("replayed bill was written again")
+			}
+			if f := salesSvc.finalized; f != nil && (!f.BillOnly || f.WalletAction != "") {
+				t.Errorf("checkout settled the wallet: %+v", f)
+			}
+		})
+	}
+}
+
+func TestUploadOrder(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2025, time.June, 4, h, 0, 0, 0, time.UTC) }
+	req := UploadRequest{DeviceID: "till-1", Bills: []BillRequest{
+		{ClientBillID: "c-3", BilledAt: at(12)},
+		{ClientBillID: "c-1", BilledAt: at(9)},
+		{ClientBillID: "c-2", BilledAt: at(10)},
+	}}
+	repo := &fakeRepository{onRecord: map[string]*Bill{
+		"c-1": {ClientBillID: "c-1"}, "c-2": {ClientBillID: "c-2"}, "c-3": {ClientBillID: "c-3"},
+	}}
+
+	result, err := NewService(repo, &fakeSales{}, fakePromotions{}).Upload(context.Background(), uuid.New(), uuid.New(), "", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, b := range result.Bills {
+		order = append(order, b.ClientBillID)
+	}
+	if want := []string{"c-1", "c-2", "c-3"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("processed %v, want %v", order, want)
+	}
+	if result.Replayed != 3 {
+		t.Errorf("replayed = %d, want 3", result.Replayed)
+	}
+}
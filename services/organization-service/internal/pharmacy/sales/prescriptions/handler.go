@@ -1,10 +1,14 @@
 package prescriptions
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"organization-service/internal/pharmacy/safety"
 	"organization-service/middleware"
+	"organization-service/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -37,8 +41,15 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
+	_, req.OverrideBy, _ = middleware.GetUserInfo(c.Request.Context())
+
 	p, err := h.svc.Create(c.Request.Context(), pharmacyID, req)
 	if err != nil {
+		var overrideErr *safety.OverrideRequiredError
+		if errors.As(err, &overrideErr) {
+			safety.RespondOverrideRequired(c, overrideErr)
+			return
+		}
 		h.respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -109,6 +120,217 @@ func (h *Handler) Get(c *gin.Context) {
 	h.respondJSON(c, http.StatusOK, p)
 }
 
+// UploadAttachment takes a photo or PDF of a paper prescription as the multipart
+// "file" field, optionally linked through the prescription_id and sale_id fields
+func (h *Handler) UploadAttachment(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user")
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "A prescription image or PDF is required")
+		return
+	}
+	if err := utils.ValidateDocument(fileHeader); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	in := UploadAttachmentInput{
+		File:           fileHeader,
+		PrescriptionID: c.PostForm("prescription_id"),
+		UploadedBy:     userID,
+		UploadedByName: userName,
+	}
+	if v := c.PostForm("sale_id"); v != "" {
+		saleID, err := uuid.Parse(v)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid sale ID")
+			return
+		}
+		in.SaleID = &saleID
+	}
+
+	a, err := h.svc.UploadAttachment(c.Request.Context(), pharmacyID, in)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, a)
+}
+
+// ListAttachments lists the scans linked to ?prescription_id= and/or ?sale_id=
+func (h *Handler) ListAttachments(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	var saleID *uuid.UUID
+	if v := c.Query("sale_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid sale ID")
+			return
+		}
+		saleID = &id
+	}
+
+	attachments, err := h.svc.ListAttachments(c.Request.Context(), pharmacyID, c.Query("prescription_id"), saleID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, attachments)
+}
+
+func (h *Handler) GetAttachment(c *gin.Context) {
+	pharmacyID, id, ok := h.attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	a, err := h.svc.GetAttachment(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, a)
+}
+
+// GetAttachmentFile serves the stored image or PDF to the pharmacy it belongs to
+func (h *Handler) GetAttachmentFile(c *gin.Context) {
+	pharmacyID, id, ok := h.attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	a, err := h.svc.GetAttachment(c.Request.Context(), pharmacyID, id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	c.FileAttachment(a.FilePath, a.OriginalName)
+}
+
+func (h *Handler) LinkAttachment(c *gin.Context) {
+	pharmacyID, id, ok := h.attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	var req LinkAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	a, err := h.svc.LinkAttachment(c.Request.Context(), pharmacyID, id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, a)
+}
+
+// ReprocessAttachment reads the scan again; a "text" body matches a typed transcription instead
+func (h *Handler) ReprocessAttachment(c *gin.Context) {
+	pharmacyID, id, ok := h.attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	var req ReprocessAttachmentRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.respondError(c, http.StatusBadRequest, "Invalid payload")
+			return
+		}
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	a, err := h.svc.ReprocessAttachment(c.Request.Context(), pharmacyID, id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, a)
+}
+
+// ConfirmAttachment creates the prescription from the items the pharmacist confirmed off the scan
+func (h *Handler) ConfirmAttachment(c *gin.Context) {
+	pharmacyID, id, ok := h.attachmentParams(c)
+	if !ok {
+		return
+	}
+
+	var req CreatePrescriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, fmt.Sprintf("Validation failed: %v", err))
+		return
+	}
+
+	_, req.OverrideBy, _ = middleware.GetUserInfo(c.Request.Context())
+
+	p, err := h.svc.ConfirmAttachment(c.Request.Context(), pharmacyID, id, req)
+	if err != nil {
+		var overrideErr *safety.OverrideRequiredError
+		if errors.As(err, &overrideErr) {
+			safety.RespondOverrideRequired(c, overrideErr)
+			return
+		}
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, p)
+}
+
+func (h *Handler) attachmentParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid attachment ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return pharmacyID, id, true
+}
+
 func (h *Handler) respondJSON(c *gin.Context, status int, data interface{}) {
 	c.JSON(status, gin.H{"success": true, "data": data})
 }
@@ -0,0 +1,240 @@
+package prescriptions
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"organization-service/internal/pharmacy/money"
+)
+
+const (
+	// minMatchConfidence is the share of a medicine's name a line must carry to be proposed
+	minMatchConfidence = 0.75
+	maxAlternatives    = 3
+)
+
+var (
+	// Letters and digits split apart so 500mg and 500 mg read the same
+	tokenRe    = regexp.MustCompile(`[a-z]+|[0-9]+(?:\.[0-9]+)?`)
+	scheduleRe = regexp.MustCompile(`\b(\d(?:\.\d+)?)\s*-\s*(\d(?:\.\d+)?)\s*-\s*(\d(?:\.\d+)?)\b`)
+	durationRe = regexp.MustCompile(`(?i)\b(?:x|for)?\s*(\d{1,3})\s*(days?|d|weeks?|wks?|w|months?|m)\b`)
+	quantityRe = regexp.MustCompile(`(?i)(?:\bqty|\bno\.?s?|#)\s*[:.]?\s*(\d{1,4})\b`)
+)
+
+// Shorthand frequencies written in place of a morning-noon-night schedule
+var frequencies = map[string][3]float64{
+	"od":  {1, 0, 0},
+	"qd":  {1, 0, 0},
+	"hs":  {0, 0, 1},
+	"bd":  {1, 0, 1},
+	"bid": {1, 0, 1},
+	"tds": {1, 1, 1},
+	"tid": {1, 1, 1},
+}
+
+// Dosage-form words that prefix a line without being part of the medicine's name
+var formWords = map[string]bool{
+	"tab": true, "tabs": true, "tablet": true, "cap": true, "caps": true, "capsule": true,
+	"syp": true, "syrup": true, "inj": true, "injection": true, "oint": true, "rx": true,
+}
+
+// proposeItems reads each text line as a prescription line: the medicine is the
+// catalog entry whose name or brand the line carries most completely, and the
+// dosage schedule, duration and quantity are parsed from what is left
+func proposeItems(text string, catalog []CatalogMedicine) []ItemProposal {
+	type indexed struct {
+		med   CatalogMedicine
+		name  []string
+		brand []string
+	}
+	entries := make([]indexed, 0, len(catalog))
+	for _, m := range catalog {
+		entries = append(entries, indexed{med: m, name: tokens(m.Name), brand: tokens(m.Brand)})
+	}
+
+	proposals := []ItemProposal{}
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+		words := tokens(line)
+		if len(words) == 0 || !hasLetters(words) {
+			continue
+		}
+
+		var matches []MedicineMatch
+		matchedOn := map[int]string{}
+		for _, e := range entries {
+			score, on := tokenScore(e.name, words), "NAME"
+			if b := tokenScore(e.brand, words); b > score {
+				score, on = b, "BRAND"
+			}
+			if score < minMatchConfidence {
+				continue
+			}
+			matchedOn[len(matches)] = on
+			matches = append(matches, MedicineMatch{
+				ProductID:  e.med.ID,
+				Name:       e.med.Name,
+				Brand:      e.med.Brand,
+				DosageForm: e.med.DosageForm,
+				Confidence: money.Round2(score),
+			})
+		}
+		if len(matches) == 0 {
+			// Header and footer lines (clinic, doctor, date) are not proposed unless they look like a line item
+			if !looksLikeItem(line) {
+				continue
+			}
+		}
+
+		order := make([]int, len(matches))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ma, mb := matches[order[a]], matches[order[b]]
+			if ma.Confidence != mb.Confidence {
+				return ma.Confidence > mb.Confidence
+			}
+			// A longer name matched in full is the more specific match
+			return len(ma.Name)+len(ma.Brand) > len(mb.Name)+len(mb.Brand)
+		})
+
+		p := ItemProposal{Line: line, Item: parseDosage(line)}
+		if len(order) > 0 {
+			best := matches[order[0]]
+			p.Item.ProductID = best.ProductID
+			p.Item.MedicineName = best.Name
+			p.Item.MedicineBrand = best.Brand
+			p.MatchedOn = matchedOn[order[0]]
+			p.Confidence = best.Confidence
+			for _, i := range order[1:] {
+				if len(p.Alternatives) == maxAlternatives {
+					break
+				}
+				p.Alternatives = append(p.Alternatives, matches[i])
+			}
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals
+}
+
+func tokens(s string) []string {
+	words := tokenRe.FindAllString(strings.ToLower(s), -1)
+	out := words[:0]
+	for _, w := range words {
+		if !formWords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func hasLetters(words []string) bool {
+	for _, w := range words {
+		if strings.IndexFunc(w, func(r rune) bool { return r >= 'a' && r <= 'z' }) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeItem(line string) bool {
+	if scheduleRe.MatchString(line) || durationRe.MatchString(line) {
+		return true
+	}
+	for _, w := range strings.Fields(strings.ToLower(line)) {
+		if _, ok := frequencies[strings.Trim(w, ".,")]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenScore is the share of the medicine's words found in the line. OCR
+// misreads a letter or two, so words of five or more letters match within one
+// edit, and a word that matches only that way counts as 0.8 of a word.
+func tokenScore(want, line []string) float64 {
+	if len(want) == 0 {
+		return 0
+	}
+	var got float64
+	for _, w := range want {
+		best := 0.0
+		for _, l := range line {
+			if l == w {
+				best = 1
+				break
+			}
+			if len(w) >= 5 && len(l) >= 4 && editDistance(w, l) <= 1 {
+				best = 0.8
+			}
+		}
+		got += best
+	}
+	return got / float64(len(want))
+}
+
+func editDistance(a, b string) int {
+	if int(math.Abs(float64(len(a)-len(b)))) > 1 {
+		return 2
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// parseDosage reads a 1-0-1 style schedule or a shorthand frequency, a
+// duration and an explicit quantity. Create works the quantity out from the
+// schedule and duration when none is written.
+func parseDosage(line string) CreatePrescriptionItem {
+	item := CreatePrescriptionItem{Instructions: line}
+
+	if m := scheduleRe.FindStringSubmatch(line); m != nil {
+		item.Morning, _ = strconv.ParseFloat(m[1], 64)
+		item.Noon, _ = strconv.ParseFloat(m[2], 64)
+		item.Night, _ = strconv.ParseFloat(m[3], 64)
+		item.Dosage = m[0]
+	} else {
+		for _, w := range strings.Fields(strings.ToLower(line)) {
+			if f, ok := frequencies[strings.Trim(w, ".,")]; ok {
+				item.Morning, item.Noon, item.Night = f[0], f[1], f[2]
+				item.Dosage = strings.ToUpper(strings.Trim(w, ".,"))
+				break
+			}
+		}
+	}
+
+	if m := durationRe.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch unit := strings.ToLower(m[2]); {
+		case strings.HasPrefix(unit, "w"):
+			n *= 7
+		case strings.HasPrefix(unit, "m"):
+			n *= 30
+		}
+		item.DurationDays = n
+	}
+
+	if m := quantityRe.FindStringSubmatch(line); m != nil {
+		item.Quantity, _ = strconv.Atoi(m[1])
+	}
+	return item
+}
@@ -0,0 +1,163 @@
+package prescriptions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Tab. Dolo 650mg", []string{"dolo", "650", "mg"}},
+		{"Vit D3 0.5 mcg", []string{"vit", "d", "3", "0.5", "mcg"}},
+		{"SYP Ambroxol", []string{"ambroxol"}},
+		{"1-0-1", []string{"1", "0", "1"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		got := tokens(tt.in)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokenScore(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		line string
+		out  float64
+	}{
+		{"every word", "Pantoprazole 40", "Tab Pantoprazole 40 mg OD", 1},
+		{"half the words", "Paracetamol 650", "Paracetamol 500", 0.5},
+		{"one letter misread", "Paracetamol", "Paracetmol", 0.8},
+		{"short words must match exactly", "Dolo", "Dola", 0},
+		{"two letters misread", "Amoxicillin", "Amoxcilin", 0},
+		{"nothing to match", "", "Dolo 650", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenScore(tokens(tt.want), tokens(tt.line)); got != tt.out {
+				t.Errorf("tokenScore() = %v, want %v", got, tt.out)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"metformin", "metformin", 0},
+		{"metformin", "metfornin", 1},
+		{"metformin", "metformn", 1},
+		{"metformin", "metformins", 1},
+		{"metformin", "metfrmn", 2},
+		{"abc", "xyz", 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseDosage(t *testing.T) {
+	tests := []struct {
+		line                string
+		morning, noon, nite float64
+		dosage              string
+		days, qty           int
+	}{
+		{"Tab Metformin 500mg 1-0-1 x 30 days", 1, 0, 1, "1-0-1", 30, 0},
+		{"Amoxicillin 500 TDS for 1 week", 1, 1, 1, "TDS", 7, 0},
+		{"Pan 40 od. x 2w", 1, 0, 0, "OD", 14, 0},
+		{"Vit D3 60k weekly 2 months", 0, 0, 0, "", 60, 0},
+		{"Deriphyllin 0.5 - 0 - 0.5 5d", 0.5, 0, 0.5, "0.5 - 0 - 0.5", 5, 0},
+		{"Crocin 650 SOS qty: 10", 0, 0, 0, "", 0, 10},
+		{"Syp Ambroxol 5ml HS #1", 0, 0, 1, "HS", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := parseDosage(tt.line)
+			if got.Morning != tt.morning || got.Noon != tt.noon || got.Night != tt.nite || got.Dosage != tt.dosage {
+				t.Errorf("schedule = %v-%v-%v %q, want %v-%v-%v %q", got.Morning, got.Noon, got.Night, got.Dosage, tt.morning, tt.noon, tt.nite, tt.dosage)
+			}
+			if got.DurationDays != tt.days || got.Quantity != tt.qty {
+				t.Errorf("duration %d, quantity %d; want %d, %d", got.DurationDays, got.Quantity, tt.days, tt.qty)
+			}
+			if got.Instructions != tt.line {
+				t.Errorf("instructions = %q, want the line", got.Instructions)
+			}
+		})
+	}
+}
+
+func TestProposeItems(t *testing.T) {
+	dolo := CatalogMedicine{ID: uuid.New(), Name: "Paracetamol 650", Brand: "Dolo 650"}
+	crocin := CatalogMedicine{ID: uuid.New(), Name: "Paracetamol 500", Brand: "Crocin"}
+	pan := CatalogMedicine{ID: uuid.New(), Name: "Pantoprazole 40", Brand: "Pan 40"}
+	mox := CatalogMedicine{ID: uuid.New(), Name: "Amoxicillin 500", Brand: "Mox 500"}
+	novamox := CatalogMedicine{ID: uuid.New(), Name: "Amoxicillin", Brand: "Novamox"}
+	catalog := []CatalogMedicine{dolo, crocin, pan, novamox, mox}
+
+	text := `Dr. R. Sharma MBBS
+Date: 04/06/2025
+Tab Dolo 650 1-0-1 x 5 days
+  Paracetmol 500 SOS
+Pan 40 OD x 2w
+Amoxicillin 500 bd
+Syp Ambroxol 5ml TDS
+1 2 3`
+
+	type want struct {
+		productID    uuid.UUID
+		matchedOn    string
+		confidence   float64
+		alternatives []uuid.UUID
+		dosage       string
+		days         int
+	}
+	wants := []want{
+		{dolo.ID, "BRAND", 1, nil, "1-0-1", 5},
+		{crocin.ID, "NAME", 0.9, nil, "", 0},
+		{pan.ID, "BRAND", 1, nil, "OD", 14},
+		{mox.ID, "NAME", 1, []uuid.UUID{novamox.ID}, "BD", 0},
+		{uuid.Nil, "", 0, nil, "TDS", 0},
+	}
+
+	got := proposeItems(text, catalog)
+	if len(got) != len(wants) {
+		t.Fatalf("got %d proposals, want %d: %+v", len(got), len(wants), got)
+	}
+	for i, w := range wants {
+		p := got[i]
+		var alternatives []uuid.UUID
+		for _, a := range p.Alternatives {
+			alternatives = append(alternatives, a.ProductID)
+		}
+		if p.Item.ProductID != w.productID || p.MatchedOn != w.matchedOn || p.Confidence != w.confidence || !reflect.DeepEqual(alternatives, w.alternatives) {
+			t.Errorf("line %q matched %s on %q at %.2f with %v; want %s on %q at %.2f with %v",
+				p.Line, p.Item.MedicineName, p.MatchedOn, p.Confidence, alternatives, w.productID, w.matchedOn, w.confidence, w.alternatives)
+		}
+		if p.Item.Dosage != w.dosage || p.Item.DurationDays != w.days {
+			t.Errorf("line %q read as %q for %d days, want %q for %d days", p.Line, p.Item.Dosage, p.Item.DurationDays, w.dosage, w.days)
+		}
+	}
+	if got[1].Line != "Paracetmol 500 SOS" {
+		t.Errorf("line = %q, want it trimmed", got[1].Line)
+	}
+}
@@ -1,8 +1,11 @@
 package prescriptions
 
 import (
+	"mime/multipart"
 	"time"
 
+	"organization-service/internal/pharmacy/safety"
+
 	"github.com/google/uuid"
 )
 
@@ -14,23 +17,37 @@ type SalesHistoryStats struct {
 }
 
 type Prescription struct {
-	ID           string             `json:"id"`
-	PharmacyID   uuid.UUID          `json:"pharmacy_id"`
-	TokenNo      string             `json:"token_no"`
-	PatientName  string             `json:"patient_name"`
-	PatientPhone string             `json:"patient_phone"`
-	DoctorName   string             `json:"doctor_name"`
-	Date         time.Time          `json:"date"`
-	Status         string             `json:"status"` // PENDING, DISPENSED, CANCELLED
-	Items          []PrescriptionItem `json:"items"`
-	TotalMedicines int                `json:"total_medicines"`
-	BillAmount     *float64           `json:"bill_amount"`
-	PaymentMethod  *string            `json:"payment_method"`
-	HandledByName  *string            `json:"handled_by_name"`
-	LatestSaleID   *uuid.UUID         `json:"latest_sale_id"`
-	InvoiceNumber  *string            `json:"invoice_number"`
+	ID               string             `json:"id"`
+	PharmacyID       uuid.UUID          `json:"pharmacy_id"`
+	TokenNo          string             `json:"token_no"`
+	PatientName      string             `json:"patient_name"`
+	PatientPhone     string             `json:"patient_phone"`
+	DoctorName       string             `json:"doctor_name"`
+	Date             time.Time          `json:"date"`
+	Status           string             `json:"status"` // PENDING, DISPENSED, CANCELLED
+	Items            []PrescriptionItem `json:"items"`
+	TotalMedicines   int                `json:"total_medicines"`
+	BillAmount       *float64           `json:"bill_amount"`
+	PaymentMethod    *string            `json:"payment_method"`
+	HandledByName    *string            `json:"handled_by_name"`
+	LatestSaleID     *uuid.UUID         `json:"latest_sale_id"`
+	InvoiceNumber    *string            `json:"invoice_number"`
+	Source           string             `json:"source"` // MANUAL, CONSULTATION
+	ClinicID         *uuid.UUID         `json:"clinic_id,omitempty"`
+	AppointmentID    *uuid.UUID         `json:"appointment_id,omitempty"`
+	ConsultationID   *uuid.UUID         `json:"consultation_id,omitempty"`
+	PatientAllergies string             `json:"patient_allergies,omitempty"`
+	SafetyWarnings   []safety.Warning   `json:"safety_warnings"`
+	OverrideReason   *string            `json:"override_reason,omitempty"`
+	OverrideBy       *string            `json:"override_by,omitempty"`
+	Attachments      []Attachment       `json:"attachments,omitempty"` // Scans of the paper prescription
 }
 
+const (
+	SourceManual       = "MANUAL"
+	SourceConsultation = "CONSULTATION"
+)
+
 type PrescriptionItem struct {
 	ID             uuid.UUID `json:"id"`
 	PrescriptionID string    `json:"prescription_id"`
@@ -40,6 +57,7 @@ type PrescriptionItem struct {
 	Quantity       int       `json:"quantity"`
 	DurationDays   int       `json:"duration_days"`
 	DosagePerDay   float64   `json:"dosage_per_day"`
+	Dosage         string    `json:"dosage"`
 	Morning        float64   `json:"morning"`
 	Noon           float64   `json:"noon"`
 	Night          float64   `json:"night"`
@@ -47,11 +65,14 @@ type PrescriptionItem struct {
 }
 
 type CreatePrescriptionRequest struct {
-	TokenNo      string                   `json:"token_no"`
-	PatientName  string                   `json:"patient_name" validate:"required"`
-	PatientPhone string                   `json:"patient_phone"`
-	DoctorName   string                   `json:"doctor_name" validate:"required"`
-	Items        []CreatePrescriptionItem `json:"items" validate:"required,min=1"`
+	TokenNo        string                   `json:"token_no"`
+	PatientName    string                   `json:"patient_name" validate:"required"`
+	PatientPhone   string                   `json:"patient_phone"`
+	DoctorName     string                   `json:"doctor_name" validate:"required"`
+	Items          []CreatePrescriptionItem `json:"items" validate:"required,min=1"`
+	Allergies      string                   `json:"allergies"`
+	OverrideReason string                   `json:"override_reason"` // Required to proceed on MAJOR safety warnings
+	OverrideBy     string                   `json:"-"`
 }
 
 type CreatePrescriptionItem struct {
@@ -59,10 +80,94 @@ type CreatePrescriptionItem struct {
 	MedicineName  string    `json:"medicine_name" validate:"required"`
 	MedicineBrand string    `json:"medicine_brand"`
 	Quantity      int       `json:"quantity"` // Can be manually passed or auto-calculated
-	DurationDays int       `json:"duration_days"`
-	DosagePerDay float64   `json:"dosage_per_day"`
-	Morning      float64   `json:"morning"`
-	Noon         float64   `json:"noon"`
-	Night        float64   `json:"night"`
-	Instructions string    `json:"instructions"`
+	DurationDays  int       `json:"duration_days"`
+	DosagePerDay  float64   `json:"dosage_per_day"`
+	Dosage        string    `json:"dosage"`
+	Morning       float64   `json:"morning"`
+	Noon          float64   `json:"noon"`
+	Night         float64   `json:"night"`
+	Instructions  string    `json:"instructions"`
+}
+
+type FileType string
+
+const (
+	FileImage FileType = "IMAGE"
+	FilePDF   FileType = "PDF"
+)
+
+type OCRStatus string
+
+const (
+	OCRPending   OCRStatus = "PENDING"
+	OCRCompleted OCRStatus = "COMPLETED"
+	OCRFailed    OCRStatus = "FAILED"
+)
+
+// Attachment is a photo or PDF of a paper prescription, kept against the
+// prescription and/or the sale it was dispensed on
+type Attachment struct {
+	ID             uuid.UUID      `json:"id"`
+	PharmacyID     uuid.UUID      `json:"pharmacy_id"`
+	PrescriptionID *string        `json:"prescription_id,omitempty"`
+	SaleID         *uuid.UUID     `json:"sale_id,omitempty"`
+	FilePath       string         `json:"file_path"`
+	FileType       FileType       `json:"file_type"`
+	OriginalName   string         `json:"original_name"`
+	SizeBytes      int64          `json:"size_bytes"`
+	OCREngine      string         `json:"ocr_engine,omitempty"`
+	OCRStatus      OCRStatus      `json:"ocr_status"`
+	OCRText        string         `json:"ocr_text,omitempty"`
+	OCRError       string         `json:"ocr_error,omitempty"`
+	Proposals      []ItemProposal `json:"proposals"`
+	UploadedByName string         `json:"uploaded_by_name,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// ItemProposal is a prescription line read off a scan and matched against the
+// pharmacy's catalog. Item is prefilled for the pharmacist to correct and confirm;
+// it has no product when nothing in the catalog matched the line.
+type ItemProposal struct {
+	Line         string                 `json:"line"`
+	Item         CreatePrescriptionItem `json:"item"`
+	MatchedOn    string                 `json:"matched_on,omitempty"` // NAME or BRAND
+	Confidence   float64                `json:"confidence"`
+	Alternatives []MedicineMatch        `json:"alternatives,omitempty"`
+}
+
+type MedicineMatch struct {
+	ProductID  uuid.UUID `json:"product_id"`
+	Name       string    `json:"name"`
+	Brand      string    `json:"brand_name,omitempty"`
+	DosageForm string    `json:"dosage_form,omitempty"`
+	Confidence float64   `json:"confidence"`
+}
+
+// CatalogMedicine is a medicine OCR lines are matched against
+type CatalogMedicine struct {
+	ID         uuid.UUID
+	Name       string
+	Brand      string
+	DosageForm string
+}
+
+// UploadAttachmentInput carries an uploaded scan and what to link it to
+type UploadAttachmentInput struct {
+	File           *multipart.FileHeader
+	PrescriptionID string
+	SaleID         *uuid.UUID
+	UploadedBy     uuid.UUID
+	UploadedByName string
+}
+
+type LinkAttachmentRequest struct {
+	PrescriptionID string     `json:"prescription_id" validate:"required_without=SaleID,max=50"`
+	SaleID         *uuid.UUID `json:"sale_id" validate:"required_without=PrescriptionID"`
+}
+
+// ReprocessAttachmentRequest re-reads a scan; Text replaces the OCR output,
+// for a pharmacist transcribing a scan the engine could not read
+type ReprocessAttachmentRequest struct {
+	Text string `json:"text" validate:"max=20000"`
 }
@@ -0,0 +1,98 @@
+package prescriptions
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// OCREngine reads the text off a stored prescription scan. The local engine
+// ships with the service; a hosted engine plugs in behind the same interface.
+type OCREngine interface {
+	Name() string
+	Recognize(ctx context.Context, path string, fileType FileType) (string, error)
+}
+
+// localOCREngine is a stub that needs no OCR runtime. It reads the text layer
+// of PDFs produced by scanner apps and e-prescription systems; photos have no
+// text layer, so they come back empty for the pharmacist to transcribe.
+type localOCREngine struct{}
+
+func NewLocalOCREngine() OCREngine {
+	return &localOCREngine{}
+}
+
+func (e *localOCREngine) Name() string {
+	return "local"
+}
+
+var (
+	pdfStreamRe = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+	pdfTextRe   = regexp.MustCompile(`(?s)\((?:\\.|[^\\)])*\)\s*Tj|\[((?:\\.|[^\]])*)\]\s*TJ|(T\*|ET|Td|TD|')`)
+	pdfStringRe = regexp.MustCompile(`(?s)\(((?:\\.|[^\\)])*)\)`)
+)
+
+func (e *localOCREngine) Recognize(ctx context.Context, path string, fileType FileType) (string, error) {
+	if fileType != FilePDF {
+		return "", nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	for _, m := range pdfStreamRe.FindAllSubmatch(raw, -1) {
+		content := m[1]
+		// Most writers deflate page content; anything that does not inflate is read as is
+		if r, err := zlib.NewReader(bytes.NewReader(content)); err == nil {
+			if inflated, err := io.ReadAll(r); err == nil {
+				content = inflated
+			}
+		}
+		for _, op := range pdfTextRe.FindAll(content, -1) {
+			switch {
+			case bytes.HasSuffix(op, []byte("Tj")), bytes.HasSuffix(op, []byte("TJ")):
+				for _, s := range pdfStringRe.FindAllSubmatch(op, -1) {
+					line.WriteString(pdfUnescape(string(s[1])))
+				}
+			default:
+				// Text objects and line moves end the current line
+				flush()
+			}
+		}
+		flush()
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func pdfUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'r':
+			b.WriteByte(' ')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package prescriptions
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPDFUnescape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`Dolo 650`, "Dolo 650"},
+		{`1\(one\) tab`, "1(one) tab"},
+		{`a\\b`, `a\b`},
+		{`line\nbreak`, "line break"},
+		{`col\tcol`, "col\tcol"},
+		{`trailing\`, `trailing\`},
+	}
+
+	for _, tt := range tests {
+		if got := pdfUnescape(tt.in); got != tt.want {
+			t.Errorf("pdfUnescape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRecognize(t *testing.T) {
+	content := []byte(`BT /F1 12 Tf 72 720 Td (Dr. R. Sharma) Tj ET
+BT 72 700 Td (Tab Dolo 650 ) Tj (1-0-1) Tj T* [(x 5 ) -120 (days)] TJ ET
+BT 72 660 Td (Pan 40 OD \(before food\)) Tj ET`)
+	deflated := func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	pdf := func(stream []byte) []byte {
+		doc := []byte("%PDF-1.4\n4 0 obj << /Length 0 >>\nstream\n")
+		doc = append(doc, stream...)
+		return append(doc, "\nendstream\nendobj\n%%EOF\n"...)
+	}
+	want := "Dr. R. Sharma\nTab Dolo 650 1-0-1\nx 5 days\nPan 40 OD (before food)"
+
+	tests := []struct {
+		name     string
+		file     []byte
+		fileType FileType
+		want     string
+	}{
+		{"uncompressed page", pdf(content), FilePDF, want},
+		{"deflated page", pdf(deflated(content)), FilePDF, want},
+		{"no text layer", []byte("%PDF-1.4\n%%EOF\n"), FilePDF, ""},
+		{"photo", []byte{0xff, 0xd8, 0xff}, FileImage, ""},
+	}
+
+	engine := NewLocalOCREngine()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scan")
+			if err := os.WriteFile(path, tt.file, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := engine.Recognize(context.Background(), path, tt.fileType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Recognize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := engine.Recognize(context.Background(), filepath.Join(t.TempDir(), "missing.pdf"), FilePDF); err == nil {
+		t.Error("Recognize() read a missing file")
+	}
+}
@@ -3,9 +3,11 @@ package prescriptions
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
 	"github.com/google/uuid"
+	shared "shared-prescriptions"
 )
 
 type Repository interface {
@@ -15,6 +17,15 @@ type Repository interface {
 	UpdateStatus(ctx context.Context, pharmacyID uuid.UUID, id string, status string) error
 	UpdateLatestSaleID(ctx context.Context, pharmacyID uuid.UUID, id string, saleID uuid.UUID) error
 	UpdateBillingInfo(ctx context.Context, pharmacyID uuid.UUID, id string, amount float64, method string, handledBy string, invoiceNo string) error
+
+	CreateAttachment(ctx context.Context, a *Attachment, uploadedBy uuid.UUID) error
+	GetAttachment(ctx context.Context, pharmacyID, id uuid.UUID) (*Attachment, error)
+	// ListAttachments returns the scans linked to the prescription, the sale, or both when both are given
+	ListAttachments(ctx context.Context, pharmacyID uuid.UUID, prescriptionID string, saleID *uuid.UUID) ([]Attachment, error)
+	UpdateAttachmentOCR(ctx context.Context, a *Attachment) error
+	LinkAttachment(ctx context.Context, pharmacyID, id uuid.UUID, prescriptionID *string, saleID *uuid.UUID) error
+	SaleExists(ctx context.Context, pharmacyID, saleID uuid.UUID) (bool, error)
+	ListCatalog(ctx context.Context, pharmacyID uuid.UUID) ([]CatalogMedicine, error)
 }
 
 type postgresRepository struct {
@@ -25,6 +36,9 @@ func NewRepository(db *sql.DB) Repository {
 	return &postgresRepository{db: db}
 }
 
+// Create saves the prescription through the shared insert that consultations
+// publish e-prescriptions with, and copies back the assigned ID and the
+// normalised item quantities
 func (r *postgresRepository) Create(ctx context.Context, p *Prescription) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -32,50 +46,73 @@ func (r *postgresRepository) Create(ctx context.Context, p *Prescription) error
 	}
 	defer tx.Rollback()
 
-	query := `
-		INSERT INTO sales_schema.prescriptions (id, pharmacy_id, token_no, patient_name, patient_phone, doctor_name, date, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`
-	_, err = tx.ExecContext(ctx, query, p.ID, p.PharmacyID, p.TokenNo, p.PatientName, p.PatientPhone, p.DoctorName, p.Date, p.Status)
+	warnings, err := json.Marshal(p.SafetyWarnings)
 	if err != nil {
 		return err
 	}
-
-	itemQuery := `
-		INSERT INTO sales_schema.prescription_items (
-			id, prescription_id, product_id, medicine_name, medicine_brand, quantity, instructions,
-			duration_days, dosage_per_day, morning, noon, night
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-	`
+	row := &shared.Prescription{
+		ID:               p.ID,
+		PharmacyID:       p.PharmacyID.String(),
+		TokenNo:          p.TokenNo,
+		PatientName:      p.PatientName,
+		PatientPhone:     p.PatientPhone,
+		DoctorName:       p.DoctorName,
+		Date:             p.Date,
+		Status:           p.Status,
+		Source:           p.Source,
+		PatientAllergies: p.PatientAllergies,
+		SafetyWarnings:   warnings,
+		OverrideReason:   p.OverrideReason,
+		OverrideBy:       p.OverrideBy,
+	}
 	for _, item := range p.Items {
-		_, err = tx.ExecContext(
-			ctx, itemQuery,
-			item.ID, p.ID, item.ProductID, item.MedicineName, item.MedicineBrand, item.Quantity, item.Instructions,
-			item.DurationDays, item.DosagePerDay, item.Morning, item.Noon, item.Night,
-		)
-		if err != nil {
-			return err
-		}
+		row.Items = append(row.Items, shared.Item{
+			ID:            item.ID.String(),
+			ProductID:     item.ProductID.String(),
+			MedicineName:  item.MedicineName,
+			MedicineBrand: item.MedicineBrand,
+			Quantity:      item.Quantity,
+			DurationDays:  item.DurationDays,
+			DosagePerDay:  item.DosagePerDay,
+			Dosage:        item.Dosage,
+			Morning:       item.Morning,
+			Noon:          item.Noon,
+			Night:         item.Night,
+			Instructions:  item.Instructions,
+		})
+	}
+	if err := shared.Insert(ctx, tx, row); err != nil {
+		return err
 	}
 
+	p.ID = row.ID
+	for i := range p.Items {
+		p.Items[i].PrescriptionID = row.ID
+		p.Items[i].Quantity = row.Items[i].Quantity
+		p.Items[i].DosagePerDay = row.Items[i].DosagePerDay
+	}
 	p.TotalMedicines = len(p.Items)
 	return tx.Commit()
 }
 
 func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID uuid.UUID, id string) (*Prescription, error) {
 	query := `
-		SELECT id, pharmacy_id, token_no, patient_name, patient_phone, doctor_name, date, status, bill_amount, payment_method, handled_by_name, latest_sale_id, invoice_number
+		SELECT id, pharmacy_id, token_no, patient_name, patient_phone, doctor_name, date, status, bill_amount, payment_method, handled_by_name, latest_sale_id, invoice_number,
+		       source, clinic_id, appointment_id, consultation_id,
+		       COALESCE(patient_allergies, ''), COALESCE(safety_warnings, '[]'::jsonb), override_reason, override_by
 		FROM sales_schema.prescriptions
 		WHERE id = $1 AND pharmacy_id = $2
 	`
 	p := &Prescription{}
+	var warnings []byte
 	var phone sql.NullString
 	var token sql.NullString
 	var patientName sql.NullString
 	var doctorName sql.NullString
 	err := r.db.QueryRowContext(ctx, query, id, pharmacyID).Scan(
 		&p.ID, &p.PharmacyID, &token, &patientName, &phone, &doctorName, &p.Date, &p.Status, &p.BillAmount, &p.PaymentMethod, &p.HandledByName, &p.LatestSaleID, &p.InvoiceNumber,
+		&p.Source, &p.ClinicID, &p.AppointmentID, &p.ConsultationID,
+		&p.PatientAllergies, &warnings, &p.OverrideReason, &p.OverrideBy,
 	)
 	p.PatientPhone = phone.String
 	p.TokenNo = token.String
@@ -88,10 +125,13 @@ func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID uuid.UUID,
 	if err != nil {
 		return nil, err
 	}
+	if err := json.Unmarshal(warnings, &p.SafetyWarnings); err != nil {
+		return nil, fmt.Errorf("invalid safety warnings: %w", err)
+	}
 
 	itemQuery := `
 		SELECT id, prescription_id, product_id, medicine_name, medicine_brand, quantity, instructions,
-		       duration_days, dosage_per_day, morning, noon, night
+		       duration_days, dosage_per_day, morning, noon, night, dosage
 		FROM sales_schema.prescription_items
 		WHERE prescription_id = $1
 	`
@@ -103,14 +143,15 @@ func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID uuid.UUID,
 
 	for rows.Next() {
 		var item PrescriptionItem
-		var instr sql.NullString
+		var instr, dosage sql.NullString
 		if err := rows.Scan(
 			&item.ID, &item.PrescriptionID, &item.ProductID, &item.MedicineName, &item.MedicineBrand, &item.Quantity, &instr,
-			&item.DurationDays, &item.DosagePerDay, &item.Morning, &item.Noon, &item.Night,
+			&item.DurationDays, &item.DosagePerDay, &item.Morning, &item.Noon, &item.Night, &dosage,
 		); err != nil {
 			return nil, err
 		}
 		item.Instructions = instr.String
+		item.Dosage = dosage.String
 		p.Items = append(p.Items, item)
 	}
 
@@ -286,3 +327,144 @@ func (r *postgresRepository) UpdateBillingInfo(ctx context.Context, pharmacyID u
 	_, err := r.db.ExecContext(ctx, query, amount, method, handledBy, invoiceNo, id, pharmacyID)
 	return err
 }
+
+const attachmentColumns = `
+	id, pharmacy_id, prescription_id, sale_id, file_path, file_type, COALESCE(original_name, ''), size_bytes,
+	COALESCE(ocr_engine, ''), ocr_status, COALESCE(ocr_text, ''), COALESCE(ocr_error, ''), proposals,
+	COALESCE(uploaded_by_name, ''), created_at, updated_at`
+
+func (r *postgresRepository) CreateAttachment(ctx context.Context, a *Attachment, uploadedBy uuid.UUID) error {
+	proposals, err := json.Marshal(a.Proposals)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO sales_schema.prescription_attachments (
+			id, pharmacy_id, prescription_id, sale_id, file_path, file_type, original_name, size_bytes,
+			ocr_engine, ocr_status, proposals, uploaded_by, uploaded_by_name, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, $14, $14)
+	`
+	_, err = r.db.ExecContext(ctx, query, a.ID, a.PharmacyID, a.PrescriptionID, a.SaleID, a.FilePath, a.FileType, a.OriginalName, a.SizeBytes,
+		a.OCREngine, a.OCRStatus, proposals, uploadedBy, a.UploadedByName, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save prescription attachment: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetAttachment(ctx context.Context, pharmacyID, id uuid.UUID) (*Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+attachmentColumns+`
+		FROM sales_schema.prescription_attachments
+		WHERE id = $1 AND pharmacy_id = $2`, id, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, fmt.Errorf("attachment not found")
+	}
+	return &attachments[0], nil
+}
+
+func (r *postgresRepository) ListAttachments(ctx context.Context, pharmacyID uuid.UUID, prescriptionID string, saleID *uuid.UUID) ([]Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+		FROM sales_schema.prescription_attachments
+		WHERE pharmacy_id = $1`
+	args := []interface{}{pharmacyID}
+	if prescriptionID != "" {
+		args = append(args, prescriptionID)
+		query += fmt.Sprintf(` AND prescription_id = $%d`, len(args))
+	}
+	if saleID != nil {
+		args = append(args, *saleID)
+		query += fmt.Sprintf(` AND sale_id = $%d`, len(args))
+	}
+	query += ` ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAttachments(rows)
+}
+
+func (r *postgresRepository) UpdateAttachmentOCR(ctx context.Context, a *Attachment) error {
+	proposals, err := json.Marshal(a.Proposals)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE sales_schema.prescription_attachments
+		SET ocr_engine = NULLIF($1, ''), ocr_status = $2, ocr_text = NULLIF($3, ''), ocr_error = NULLIF($4, ''),
+		    proposals = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6 AND pharmacy_id = $7
+	`
+	_, err = r.db.ExecContext(ctx, query, a.OCREngine, a.OCRStatus, a.OCRText, a.OCRError, proposals, a.ID, a.PharmacyID)
+	return err
+}
+
+func (r *postgresRepository) LinkAttachment(ctx context.Context, pharmacyID, id uuid.UUID, prescriptionID *string, saleID *uuid.UUID) error {
+	query := `
+		UPDATE sales_schema.prescription_attachments
+		SET prescription_id = COALESCE($1, prescription_id), sale_id = COALESCE($2, sale_id), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND pharmacy_id = $4
+	`
+	_, err := r.db.ExecContext(ctx, query, prescriptionID, saleID, id, pharmacyID)
+	return err
+}
+
+func (r *postgresRepository) SaleExists(ctx context.Context, pharmacyID, saleID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM sales_schema.sales WHERE id = $1 AND pharmacy_id = $2)`, saleID, pharmacyID).Scan(&exists)
+	return exists, err
+}
+
+func (r *postgresRepository) ListCatalog(ctx context.Context, pharmacyID uuid.UUID) ([]CatalogMedicine, error) {
+	query := `
+		SELECT id, name, COALESCE(brand_name, ''), COALESCE(dosage_form, '')
+		FROM inventory.medicines
+		WHERE pharmacy_id = $1 AND COALESCE(is_active, TRUE)
+	`
+	rows, err := r.db.QueryContext(ctx, query, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var catalog []CatalogMedicine
+	for rows.Next() {
+		var m CatalogMedicine
+		if err := rows.Scan(&m.ID, &m.Name, &m.Brand, &m.DosageForm); err != nil {
+			return nil, err
+		}
+		catalog = append(catalog, m)
+	}
+	return catalog, rows.Err()
+}
+
+func scanAttachments(rows *sql.Rows) ([]Attachment, error) {
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		var proposals []byte
+		if err := rows.Scan(
+			&a.ID, &a.PharmacyID, &a.PrescriptionID, &a.SaleID, &a.FilePath, &a.FileType, &a.OriginalName, &a.SizeBytes,
+			&a.OCREngine, &a.OCRStatus, &a.OCRText, &a.OCRError, &proposals,
+			&a.UploadedByName, &a.CreatedAt, &a.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(proposals, &a.Proposals); err != nil {
+			return nil, fmt.Errorf("invalid attachment proposals: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
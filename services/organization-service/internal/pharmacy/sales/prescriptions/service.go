@@ -3,9 +3,12 @@ package prescriptions
 import (
 	"context"
 	"fmt"
-	"math"
+	"strings"
 	"time"
 
+	"organization-service/internal/pharmacy/safety"
+	"organization-service/utils"
+
 	"github.com/google/uuid"
 )
 
@@ -13,22 +16,33 @@ type Service interface {
 	Create(ctx context.Context, pharmacyID uuid.UUID, req CreatePrescriptionRequest) (*Prescription, error)
 	Get(ctx context.Context, pharmacyID uuid.UUID, id string) (*Prescription, error)
 	List(ctx context.Context, pharmacyID uuid.UUID, limit, offset int) ([]Prescription, int, SalesHistoryStats, error)
+
+	// UploadAttachment stores a photo or PDF of a paper prescription, links it to the
+	// prescription and/or sale given, and reads it into item proposals
+	UploadAttachment(ctx context.Context, pharmacyID uuid.UUID, in UploadAttachmentInput) (*Attachment, error)
+	GetAttachment(ctx context.Context, pharmacyID, id uuid.UUID) (*Attachment, error)
+	ListAttachments(ctx context.Context, pharmacyID uuid.UUID, prescriptionID string, saleID *uuid.UUID) ([]Attachment, error)
+	LinkAttachment(ctx context.Context, pharmacyID, id uuid.UUID, req LinkAttachmentRequest) (*Attachment, error)
+	// ReprocessAttachment reads the scan again, or matches a pharmacist's transcription of it
+	ReprocessAttachment(ctx context.Context, pharmacyID, id uuid.UUID, req ReprocessAttachmentRequest) (*Attachment, error)
+	// ConfirmAttachment creates the prescription from the items the pharmacist
+	// confirmed off the scan's proposals and links the scan to it
+	ConfirmAttachment(ctx context.Context, pharmacyID, id uuid.UUID, req CreatePrescriptionRequest) (*Prescription, error)
 }
 
 type prescriptionsService struct {
-	repo Repository
+	repo   Repository
+	safety safety.Service
+	ocr    OCREngine
 }
 
-func NewService(repo Repository) Service {
-	return &prescriptionsService{repo: repo}
+func NewService(repo Repository, safetySvc safety.Service, ocr OCREngine) Service {
+	return &prescriptionsService{repo: repo, safety: safetySvc, ocr: ocr}
 }
 
 func (s *prescriptionsService) Create(ctx context.Context, pharmacyID uuid.UUID, req CreatePrescriptionRequest) (*Prescription, error) {
-	// Generate a simple human-readable ID for testing (e.g. RX-1234)
-	id := fmt.Sprintf("RX-%d", time.Now().UnixNano()/1000000)
-
+	// The ID comes from the prescription sequence when the repository saves it
 	p := &Prescription{
-		ID:           id,
 		PharmacyID:   pharmacyID,
 		TokenNo:      req.TokenNo,
 		PatientName:  req.PatientName,
@@ -36,36 +50,49 @@ func (s *prescriptionsService) Create(ctx context.Context, pharmacyID uuid.UUID,
 		DoctorName:   req.DoctorName,
 		Date:         time.Now(),
 		Status:       "PENDING",
+		Source:       SourceManual,
 	}
 
+	// Check the prescribed medicines against each other and the patient's allergies
+	productIDs := make([]uuid.UUID, 0, len(req.Items))
 	for _, item := range req.Items {
-		quantity := item.Quantity
-		dosagePerDay := item.DosagePerDay
-
-		if dosagePerDay == 0 {
-			command := item.Morning + item.Noon + item.Night
-			dosagePerDay = command
-		}
-
-		if quantity == 0 && dosagePerDay > 0 && item.DurationDays > 0 {
-			// Auto-calculate and round UP to nearest whole number
-			calc := dosagePerDay * float64(item.DurationDays)
-			quantity = int(math.Ceil(calc))
+		productIDs = append(productIDs, item.ProductID)
+	}
+	check, err := s.safety.Check(ctx, pharmacyID, safety.CheckInput{
+		Products:  productIDs,
+		Allergies: []string{req.Allergies},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := safety.RequireOverride(check, req.OverrideReason); err != nil {
+		return nil, err
+	}
+	p.PatientAllergies = strings.TrimSpace(req.Allergies)
+	p.SafetyWarnings = check.Warnings
+	if check.RequiresOverride {
+		reason := strings.TrimSpace(req.OverrideReason)
+		p.OverrideReason = &reason
+		if req.OverrideBy != "" {
+			p.OverrideBy = &req.OverrideBy
 		}
+	}
 
+	// Missing quantities and daily dosages are worked out when the items are saved
+	for _, item := range req.Items {
 		p.Items = append(p.Items, PrescriptionItem{
-			ID:             uuid.New(),
-			PrescriptionID: id,
-			ProductID:      item.ProductID,
-			MedicineName:   item.MedicineName,
-			MedicineBrand:  item.MedicineBrand,
-			Quantity:       quantity,
-			DurationDays:   item.DurationDays,
-			DosagePerDay:   dosagePerDay,
-			Morning:        item.Morning,
-			Noon:           item.Noon,
-			Night:          item.Night,
-			Instructions:   item.Instructions,
+			ID:            uuid.New(),
+			ProductID:     item.ProductID,
+			MedicineName:  item.MedicineName,
+			MedicineBrand: item.MedicineBrand,
+			Quantity:      item.Quantity,
+			DurationDays:  item.DurationDays,
+			DosagePerDay:  item.DosagePerDay,
+			Dosage:        item.Dosage,
+			Morning:       item.Morning,
+			Noon:          item.Noon,
+			Night:         item.Night,
+			Instructions:  item.Instructions,
 		})
 	}
 
@@ -77,9 +104,187 @@ func (s *prescriptionsService) Create(ctx context.Context, pharmacyID uuid.UUID,
 }
 
 func (s *prescriptionsService) Get(ctx context.Context, pharmacyID uuid.UUID, id string) (*Prescription, error) {
-	return s.repo.GetByID(ctx, pharmacyID, id)
+	p, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Attachments, err = s.repo.ListAttachments(ctx, pharmacyID, id, nil); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 func (s *prescriptionsService) List(ctx context.Context, pharmacyID uuid.UUID, limit, offset int) ([]Prescription, int, SalesHistoryStats, error) {
 	return s.repo.List(ctx, pharmacyID, limit, offset)
 }
+
+func (s *prescriptionsService) UploadAttachment(ctx context.Context, pharmacyID uuid.UUID, in UploadAttachmentInput) (*Attachment, error) {
+	a := &Attachment{
+		ID:             uuid.New(),
+		PharmacyID:     pharmacyID,
+		FileType:       FileImage,
+		OriginalName:   in.File.Filename,
+		SizeBytes:      in.File.Size,
+		OCRStatus:      OCRPending,
+		Proposals:      []ItemProposal{},
+		UploadedByName: in.UploadedByName,
+		CreatedAt:      time.Now(),
+	}
+	if in.PrescriptionID != "" {
+		if _, err := s.repo.GetByID(ctx, pharmacyID, in.PrescriptionID); err != nil {
+			return nil, err
+		}
+		a.PrescriptionID = &in.PrescriptionID
+	}
+	if in.SaleID != nil {
+		if err := s.checkSale(ctx, pharmacyID, *in.SaleID); err != nil {
+			return nil, err
+		}
+		a.SaleID = in.SaleID
+	}
+
+	file, err := in.File.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if utils.IsPDF(in.File.Filename) {
+		a.FileType = FilePDF
+		a.FilePath, err = utils.SavePDF(file, "prescriptions")
+	} else {
+		a.FilePath, err = utils.SaveOptimizedImage(file, in.File.Filename, "prescriptions")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateAttachment(ctx, a, in.UploadedBy); err != nil {
+		_ = utils.DeleteImage(a.FilePath)
+		return nil, err
+	}
+
+	s.recognize(ctx, a, "")
+	if err := s.repo.UpdateAttachmentOCR(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// recognize reads the scan's text, or takes the transcription given, and
+// proposes items from it. A failure is kept on the attachment rather than
+// failing the upload, so the pharmacist can still enter the items by hand.
+func (s *prescriptionsService) recognize(ctx context.Context, a *Attachment, transcription string) {
+	a.OCRError = ""
+	a.Proposals = []ItemProposal{}
+
+	text := strings.TrimSpace(transcription)
+	if text != "" {
+		a.OCREngine = "manual"
+	} else {
+		a.OCREngine = s.ocr.Name()
+		var err error
+		if text, err = s.ocr.Recognize(ctx, a.FilePath, a.FileType); err != nil {
+			a.OCRStatus = OCRFailed
+			a.OCRText = ""
+			a.OCRError = err.Error()
+			return
+		}
+	}
+	a.OCRText = text
+
+	catalog, err := s.repo.ListCatalog(ctx, a.PharmacyID)
+	if err != nil {
+		a.OCRStatus = OCRFailed
+		a.OCRError = fmt.Sprintf("failed to match medicines: %v", err)
+		return
+	}
+	a.Proposals = proposeItems(text, catalog)
+	a.OCRStatus = OCRCompleted
+}
+
+func (s *prescriptionsService) checkSale(ctx context.Context, pharmacyID, saleID uuid.UUID) error {
+	exists, err := s.repo.SaleExists(ctx, pharmacyID, saleID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("sale not found")
+	}
+	return nil
+}
+
+func (s *prescriptionsService) GetAttachment(ctx context.Context, pharmacyID, id uuid.UUID) (*Attachment, error) {
+	return s.repo.GetAttachment(ctx, pharmacyID, id)
+}
+
+func (s *prescriptionsService) ListAttachments(ctx context.Context, pharmacyID uuid.UUID, prescriptionID string, saleID *uuid.UUID) ([]Attachment, error) {
+	if prescriptionID == "" && saleID == nil {
+		return nil, fmt.Errorf("prescription_id or sale_id is required")
+	}
+	return s.repo.ListAttachments(ctx, pharmacyID, prescriptionID, saleID)
+}
+
+func (s *prescriptionsService) LinkAttachment(ctx context.Context, pharmacyID, id uuid.UUID, req LinkAttachmentRequest) (*Attachment, error) {
+	a, err := s.repo.GetAttachment(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var prescriptionID *string
+	if req.PrescriptionID != "" {
+		if a.PrescriptionID != nil && *a.PrescriptionID != req.PrescriptionID {
+			return nil, fmt.Errorf("attachment is already linked to prescription %s", *a.PrescriptionID)
+		}
+		if _, err := s.repo.GetByID(ctx, pharmacyID, req.PrescriptionID); err != nil {
+			return nil, err
+		}
+		prescriptionID = &req.PrescriptionID
+	}
+	if req.SaleID != nil {
+		if a.SaleID != nil && *a.SaleID != *req.SaleID {
+			return nil, fmt.Errorf("attachment is already linked to sale %s", *a.SaleID)
+		}
+		if err := s.checkSale(ctx, pharmacyID, *req.SaleID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.LinkAttachment(ctx, pharmacyID, id, prescriptionID, req.SaleID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetAttachment(ctx, pharmacyID, id)
+}
+
+func (s *prescriptionsService) ReprocessAttachment(ctx context.Context, pharmacyID, id uuid.UUID, req ReprocessAttachmentRequest) (*Attachment, error) {
+	a, err := s.repo.GetAttachment(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	s.recognize(ctx, a, req.Text)
+	if err := s.repo.UpdateAttachmentOCR(ctx, a); err != nil {
+		return nil, err
+	}
+	return s.repo.GetAttachment(ctx, pharmacyID, id)
+}
+
+func (s *prescriptionsService) ConfirmAttachment(ctx context.Context, pharmacyID, id uuid.UUID, req CreatePrescriptionRequest) (*Prescription, error) {
+	a, err := s.repo.GetAttachment(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if a.PrescriptionID != nil {
+		return nil, fmt.Errorf("attachment is already linked to prescription %s", *a.PrescriptionID)
+	}
+
+	p, err := s.Create(ctx, pharmacyID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.LinkAttachment(ctx, pharmacyID, a.ID, &p.ID, nil); err != nil {
+		return nil, err
+	}
+	a.PrescriptionID = &p.ID
+	p.Attachments = []Attachment{*a}
+	return p, nil
+}
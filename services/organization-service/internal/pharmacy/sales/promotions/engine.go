@@ -0,0 +1,184 @@
+package promotions
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+// activeAt reports whether the promotion runs at the moment, by the pharmacy's
+// (IST) calendar and clock
+func (p *Promotion) activeAt(at time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	local := at.In(clock.IST)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	if p.ValidFrom != nil && day.Before(*p.ValidFrom) {
+		return false
+	}
+	if p.ValidTo != nil && day.After(*p.ValidTo) {
+		return false
+	}
+	if len(p.DaysOfWeek) > 0 {
+		today := int(local.Weekday())
+		found := false
+		for _, d := range p.DaysOfWeek {
+			if d == today {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	clock := local.Format("15:04")
+	if p.StartTime != "" && clock < p.StartTime {
+		return false
+	}
+	if p.EndTime != "" && clock >= p.EndTime {
+		return false
+	}
+	return true
+}
+
+// evaluate works out what the running promotions give on a bill. Bundles are
+// matched first and the units they take are not discounted again by category;
+// a product gets at most one category discount and one free quantity scheme,
+// the highest priority winning. Free units are counted on all paid units.
+func evaluate(promos []Promotion, lines []CartLine, at time.Time) []Benefit {
+	products := make(map[uuid.UUID]*CartLine)
+	var order []uuid.UUID
+	for _, l := range lines {
+		if l.Quantity <= 0 {
+			continue
+		}
+		if p, ok := products[l.ProductID]; ok {
+			p.Quantity += l.Quantity
+			p.Value += l.Value
+			continue
+		}
+		line := l
+		products[l.ProductID] = &line
+		order = append(order, l.ProductID)
+	}
+
+	running := make([]Promotion, 0, len(promos))
+	for _, p := range promos {
+		if p.activeAt(at) {
+			running = append(running, p)
+		}
+	}
+	sort.SliceStable(running, func(i, j int) bool { return running[i].Priority > running[j].Priority })
+
+	unitPrice := func(id uuid.UUID) float64 {
+		p := products[id]
+		return p.Value / float64(p.Quantity)
+	}
+	remaining := make(map[uuid.UUID]int)
+	for id, p := range products {
+		remaining[id] = p.Quantity
+	}
+
+	var benefits []Benefit
+	for _, p := range running {
+		if p.Type != TypeBundle || len(p.BundleItems) == 0 {
+			continue
+		}
+		sets := math.MaxInt32
+		for _, it := range p.BundleItems {
+			if _, ok := products[it.ProductID]; !ok {
+				sets = 0
+				break
+			}
+			if n := remaining[it.ProductID] / it.Quantity; n < sets {
+				sets = n
+			}
+		}
+		if sets == 0 {
+			continue
+		}
+		var list float64
+		for _, it := range p.BundleItems {
+			list += float64(sets*it.Quantity) * unitPrice(it.ProductID)
+		}
+		saving := list - float64(sets)*p.BundlePrice
+		if saving < 0.005 {
+			continue // Already cheaper than the bundle
+		}
+		for _, it := range p.BundleItems {
+			share := float64(sets*it.Quantity) * unitPrice(it.ProductID) / list
+			benefits = append(benefits, Benefit{
+				PromotionID: p.ID,
+				Name:        p.Name,
+				Type:        p.Type,
+				ProductID:   it.ProductID,
+				Discount:    money.Round2(saving * share),
+			})
+			remaining[it.ProductID] -= sets * it.Quantity
+		}
+	}
+
+	discounted := make(map[uuid.UUID]bool)
+	for _, p := range running {
+		if p.Type != TypeCategoryDiscount {
+			continue
+		}
+		for _, id := range order {
+			if discounted[id] || remaining[id] <= 0 || !hasCategory(p.Categories, products[id].Category) {
+				continue
+			}
+			discounted[id] = true
+			benefits = append(benefits, Benefit{
+				PromotionID: p.ID,
+				Name:        p.Name,
+				Type:        p.Type,
+				ProductID:   id,
+				Discount:    money.Round2(float64(remaining[id]) * unitPrice(id) * p.DiscountPercent / 100),
+			})
+		}
+	}
+
+	freed := make(map[uuid.UUID]bool)
+	for _, p := range running {
+		if p.Type != TypeFreeQuantity || p.BuyQty <= 0 || p.FreeQty <= 0 {
+			continue
+		}
+		for _, id := range p.ProductIDs {
+			line, ok := products[id]
+			if !ok || freed[id] {
+				continue
+			}
+			if free := line.Quantity / p.BuyQty * p.FreeQty; free > 0 {
+				freed[id] = true
+				benefits = append(benefits, Benefit{
+					PromotionID:  p.ID,
+					Name:         p.Name,
+					Type:         p.Type,
+					ProductID:    id,
+					FreeQuantity: free,
+				})
+			}
+		}
+	}
+	return benefits
+}
+
+func hasCategory(categories []string, category string) bool {
+	if category == "" {
+		return false
+	}
+	for _, c := range categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
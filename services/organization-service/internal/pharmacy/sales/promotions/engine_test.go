@@ -0,0 +1,145 @@
+package promotions
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+
+	"github.com/google/uuid"
+)
+
+func TestActiveAt(t *testing.T) {
+	// Wednesday 4 June 2025, 18:30 IST
+	at := time.Date(2025, time.June, 4, 18, 30, 0, 0, clock.IST)
+	day := func(d int) *time.Time { t := time.Date(2025, time.June, d, 0, 0, 0, 0, time.UTC); return &t }
+
+	tests := []struct {
+		name  string
+		promo Promotion
+		at    time.Time
+		want  bool
+	}{
+		{"always on", Promotion{IsActive: true}, at, true},
+		{"switched off", Promotion{}, at, false},
+		{"last day", Promotion{IsActive: true, ValidFrom: day(1), ValidTo: day(4)}, at, true},
+		{"not started", Promotion{IsActive: true, ValidFrom: day(5)}, at, false},
+		{"ended", Promotion{IsActive: true, ValidTo: day(3)}, at, false},
+		{"IST date, not UTC", Promotion{IsActive: true, ValidFrom: day(5)}, time.Date(2025, time.June, 4, 19, 0, 0, 0, time.UTC), true},
+		{"on a listed weekday", Promotion{IsActive: true, DaysOfWeek: []int{0, 3}}, at, true},
+		{"not on a listed weekday", Promotion{IsActive: true, DaysOfWeek: []int{0, 6}}, at, false},
+		{"happy hour", Promotion{IsActive: true, StartTime: "18:00", EndTime: "20:00"}, at, true},
+		{"happy hour not started", Promotion{IsActive: true, StartTime: "19:00", EndTime: "20:00"}, at, false},
+		{"happy hour end is exclusive", Promotion{IsActive: true, StartTime: "17:00", EndTime: "18:30"}, at, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.promo.activeAt(tt.at); got != tt.want {
+				t.Errorf("activeAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	at := time.Date(2025, time.June, 4, 12, 0, 0, 0, clock.IST)
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	bundle := Promotion{ID: uuid.New(), Name: "Combo", Type: TypeBundle, IsActive: true, BundlePrice: 120,
+		BundleItems: []BundleItem{{ProductID: a, Quantity: 1}, {ProductID: b, Quantity: 1}}}
+	vitamins := Promotion{ID: uuid.New(), Name: "Vitamin week", Type: TypeCategoryDiscount, IsActive: true,
+		Categories: []string{"vitamins"}, DiscountPercent: 10}
+	bigger := Promotion{ID: uuid.New(), Name: "Vitamin sale", Type: TypeCategoryDiscount, IsActive: true, Priority: 5,
+		Categories: []string{"Vitamins"}, DiscountPercent: 20}
+	buy2get1 := Promotion{ID: uuid.New(), Name: "Buy 2 get 1", Type: TypeFreeQuantity, IsActive: true,
+		ProductIDs: []uuid.UUID{c}, BuyQty: 2, FreeQty: 1}
+	buy1get1 := Promotion{ID: uuid.New(), Name: "Buy 1 get 1", Type: TypeFreeQuantity, IsActive: true, Priority: 1,
+		ProductIDs: []uuid.UUID{c}, BuyQty: 1, FreeQty: 1}
+	expired := buy1get1
+	expired.IsActive = false
+
+	// A at 100 and B at 50 a unit, both vitamins; C at 10 a unit, uncategorised
+	lines := []CartLine{
+		{ProductID: a, Category: "Vitamins", Quantity: 4, Value: 400},
+		{ProductID: b, Category: "Vitamins", Quantity: 2, Value: 100},
+		{ProductID: c, Quantity: 6, Value: 60},
+	}
+
+	tests := []struct {
+		name   string
+		promos []Promotion
+		lines  []CartLine
+		want   []Benefit
+	}{
+		{
+			name:   "bundle saving split by value",
+			promos: []Promotion{bundle},
+			lines:  lines,
+			want: []Benefit{
+				{PromotionID: bundle.ID, Name: "Combo", Type: TypeBundle, ProductID: a, Discount: 40},
+				{PromotionID: bundle.ID, Name: "Combo", Type: TypeBundle, ProductID: b, Discount: 20},
+			},
+		},
+		{
+			name:   "category discount only on units outside the bundle",
+			promos: []Promotion{vitamins, bundle},
+			lines:  lines,
+			want: []Benefit{
+				{PromotionID: bundle.ID, Name: "Combo", Type: TypeBundle, ProductID: a, Discount: 40},
+				{PromotionID: bundle.ID, Name: "Combo", Type: TypeBundle, ProductID: b, Discount: 20},
+				{PromotionID: vitamins.ID, Name: "Vitamin week", Type: TypeCategoryDiscount, ProductID: a, Discount: 20},
+			},
+		},
+		{
+			name:   "higher priority category discount wins",
+			promos: []Promotion{vitamins, bigger},
+			lines:  lines,
+			want: []Benefit{
+				{PromotionID: bigger.ID, Name: "Vitamin sale", Type: TypeCategoryDiscount, ProductID: a, Discount: 80},
+				{PromotionID: bigger.ID, Name: "Vitamin sale", Type: TypeCategoryDiscount, ProductID: b, Discount: 20},
+			},
+		},
+		{
+			name:   "higher priority free scheme wins",
+			promos: []Promotion{buy2get1, buy1get1},
+			lines:  lines,
+			want:   []Benefit{{PromotionID: buy1get1.ID, Name: "Buy 1 get 1", Type: TypeFreeQuantity, ProductID: c, FreeQuantity: 6}},
+		},
+		{
+			name:   "switched off schemes are skipped",
+			promos: []Promotion{buy2get1, expired},
+			lines:  lines,
+			want:   []Benefit{{PromotionID: buy2get1.ID, Name: "Buy 2 get 1", Type: TypeFreeQuantity, ProductID: c, FreeQuantity: 3}},
+		},
+		{
+			name:   "batches of one product are counted together",
+			promos: []Promotion{buy2get1},
+			lines:  []CartLine{{ProductID: c, Quantity: 1, Value: 10}, {ProductID: c, Quantity: 1, Value: 10}},
+			want:   []Benefit{{PromotionID: buy2get1.ID, Name: "Buy 2 get 1", Type: TypeFreeQuantity, ProductID: c, FreeQuantity: 1}},
+		},
+		{
+			name:   "bundle not bought in full",
+			promos: []Promotion{bundle},
+			lines:  []CartLine{{ProductID: a, Quantity: 4, Value: 400}},
+		},
+		{
+			name:   "bundle dearer than the counter price",
+			promos: []Promotion{bundle},
+			lines:  []CartLine{{ProductID: a, Quantity: 1, Value: 60}, {ProductID: b, Quantity: 1, Value: 50}},
+		},
+		{
+			name:   "too few units for a free one",
+			promos: []Promotion{buy2get1},
+			lines:  []CartLine{{ProductID: c, Quantity: 1, Value: 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluate(tt.promos, tt.lines, at); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package promotions
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PromotionType string
+
+const (
+	// TypeFreeQuantity gives FreeQty units of a product for every BuyQty bought
+	TypeFreeQuantity PromotionType = "FREE_QTY"
+	// TypeBundle sells a set of products together for BundlePrice
+	TypeBundle PromotionType = "BUNDLE"
+	// TypeCategoryDiscount takes DiscountPercent off products in the categories
+	TypeCategoryDiscount PromotionType = "CATEGORY_DISCOUNT"
+)
+
+type BundleItem struct {
+	ProductID uuid.UUID `json:"product_id" validate:"required"`
+	Quantity  int       `json:"quantity" validate:"required,min=1"`
+}
+
+type Promotion struct {
+	ID              uuid.UUID     `json:"id"`
+	PharmacyID      uuid.UUID     `json:"pharmacy_id"`
+	Name            string        `json:"name"`
+	Type            PromotionType `json:"type"`
+	ProductIDs      []uuid.UUID   `json:"product_ids,omitempty"`
+	Categories      []string      `json:"categories,omitempty"`
+	BuyQty          int           `json:"buy_qty,omitempty"`
+	FreeQty         int           `json:"free_qty,omitempty"`
+	BundleItems     []BundleItem  `json:"bundle_items,omitempty"`
+	BundlePrice     float64       `json:"bundle_price,omitempty"` // Tax inclusive, for one set
+	DiscountPercent float64       `json:"discount_percent,omitempty"`
+	ValidFrom       *time.Time    `json:"valid_from,omitempty"`
+	ValidTo         *time.Time    `json:"valid_to,omitempty"`
+	DaysOfWeek      []int         `json:"days_of_week,omitempty"` // 0 = Sunday; empty for every day
+	StartTime       string        `json:"start_time,omitempty"`   // HH:MM IST; empty for all day
+	EndTime         string        `json:"end_time,omitempty"`
+	Priority        int           `json:"priority"` // Higher is applied first within a type
+	IsActive        bool          `json:"is_active"`
+	CreatedByName   string        `json:"created_by_name,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// CartLine is a product on the bill, across its batches, before promotions
+type CartLine struct {
+	ProductID uuid.UUID
+	Category  string
+	Quantity  int
+	Value     float64 // What the units cost after the counter's discount, tax included
+}
+
+// Benefit is what one promotion gives on one product of the bill
+type Benefit struct {
+	PromotionID  uuid.UUID
+	Name         string
+	Type         PromotionType
+	ProductID    uuid.UUID
+	Discount     float64 // Rupees off the product's lines
+	FreeQuantity int     // Units of the product given free
+}
+
+// Request Structs
+
+type PromotionRequest struct {
+	Name            string        `json:"name" validate:"required,max=100"`
+	Type            PromotionType `json:"type" validate:"required,oneof=FREE_QTY BUNDLE CATEGORY_DISCOUNT"`
+	ProductIDs      []uuid.UUID   `json:"product_ids" validate:"max=100"`
+	Categories      []string      `json:"categories" validate:"max=50,dive,required,max=100"`
+	BuyQty          int           `json:"buy_qty" validate:"min=0"`
+	FreeQty         int           `json:"free_qty" validate:"min=0"`
+	BundleItems     []BundleItem  `json:"bundle_items" validate:"max=20,dive"`
+	BundlePrice     float64       `json:"bundle_price" validate:"gte=0"`
+	DiscountPercent float64       `json:"discount_percent" validate:"gte=0,lte=100"`
+	ValidFrom       string        `json:"valid_from" validate:"omitempty,datetime=2006-01-02"`
+	ValidTo         string        `json:"valid_to" validate:"omitempty,datetime=2006-01-02"`
+	DaysOfWeek      []int         `json:"days_of_week" validate:"max=7,dive,min=0,max=6"`
+	StartTime       string        `json:"start_time" validate:"omitempty,datetime=15:04"`
+	EndTime         string        `json:"end_time" validate:"omitempty,datetime=15:04"`
+	Priority        int           `json:"priority"`
+	IsActive        *bool         `json:"is_active"` // Defaults to true
+}
@@ -0,0 +1,201 @@
+package promotions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Create(ctx context.Context, p *Promotion, userID uuid.UUID) error
+	Update(ctx context.Context, p *Promotion) error
+	GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Promotion, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, activeOnly bool, limit, offset int) ([]Promotion, int, error)
+	// ListRunnable returns active promotions whose date range has not ended; the
+	// weekday and time windows are checked by the engine
+	ListRunnable(ctx context.Context, pharmacyID uuid.UUID) ([]Promotion, error)
+	// ProductCategories maps the pharmacy's medicines to their category
+	ProductCategories(ctx context.Context, pharmacyID uuid.UUID, productIDs []uuid.UUID) (map[uuid.UUID]string, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const promotionColumns = `
+	id, pharmacy_id, name, promo_type, product_ids, categories, buy_qty, free_qty, bundle_items, bundle_price,
+	discount_percent, valid_from, valid_to, days_of_week, COALESCE(start_time, ''), COALESCE(end_time, ''),
+	priority, is_active, COALESCE(created_by_name, ''), created_at, updated_at`
+
+func (r *postgresRepository) Create(ctx context.Context, p *Promotion, userID uuid.UUID) error {
+	bundle, err := json.Marshal(p.BundleItems)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.promotions (
+			id, pharmacy_id, name, promo_type, product_ids, categories, buy_qty, free_qty, bundle_items, bundle_price,
+			discount_percent, valid_from, valid_to, days_of_week, start_time, end_time, priority, is_active,
+			created_by, created_by_name, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), NULLIF($16, ''), $17, $18, $19, $20, $21, $22)`,
+		p.ID, p.PharmacyID, p.Name, p.Type, pq.Array(uuidStrings(p.ProductIDs)), pq.Array(p.Categories), p.BuyQty, p.FreeQty,
+		bundle, p.BundlePrice, p.DiscountPercent, p.ValidFrom, p.ValidTo, pq.Array(p.DaysOfWeek), p.StartTime, p.EndTime,
+		p.Priority, p.IsActive, userID, p.CreatedByName, p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create promotion: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) Update(ctx context.Context, p *Promotion) error {
+	bundle, err := json.Marshal(p.BundleItems)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE sales_schema.promotions SET
+			name = $3, promo_type = $4, product_ids = $5, categories = $6, buy_qty = $7, free_qty = $8,
+			bundle_items = $9, bundle_price = $10, discount_percent = $11, valid_from = $12, valid_to = $13,
+			days_of_week = $14, start_time = NULLIF($15, ''), end_time = NULLIF($16, ''), priority = $17,
+			is_active = $18, updated_at = $19
+		WHERE pharmacy_id = $1 AND id = $2`,
+		p.PharmacyID, p.ID, p.Name, p.Type, pq.Array(uuidStrings(p.ProductIDs)), pq.Array(p.Categories), p.BuyQty, p.FreeQty,
+		bundle, p.BundlePrice, p.DiscountPercent, p.ValidFrom, p.ValidTo, pq.Array(p.DaysOfWeek), p.StartTime, p.EndTime,
+		p.Priority, p.IsActive, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update promotion: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Promotion, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+promotionColumns+`
+		FROM sales_schema.promotions WHERE pharmacy_id = $1 AND id = $2`, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	promos, err := scanPromotions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(promos) == 0 {
+		return nil, fmt.Errorf("promotion not found")
+	}
+	return &promos[0], nil
+}
+
+func (r *postgresRepository) List(ctx context.Context, pharmacyID uuid.UUID, activeOnly bool, limit, offset int) ([]Promotion, int, error) {
+	where := `WHERE pharmacy_id = $1`
+	if activeOnly {
+		where += ` AND is_active = TRUE AND (valid_to IS NULL OR valid_to >= CURRENT_DATE)`
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sales_schema.promotions `+where, pharmacyID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+promotionColumns+`
+		FROM sales_schema.promotions `+where+`
+		ORDER BY is_active DESC, priority DESC, created_at DESC
+		LIMIT $2 OFFSET $3`, pharmacyID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	promos, err := scanPromotions(rows)
+	return promos, total, err
+}
+
+func (r *postgresRepository) ListRunnable(ctx context.Context, pharmacyID uuid.UUID) ([]Promotion, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+promotionColumns+`
+		FROM sales_schema.promotions
+		WHERE pharmacy_id = $1 AND is_active = TRUE
+		  AND (valid_to IS NULL OR valid_to >= CURRENT_DATE - 1)
+		ORDER BY priority DESC, created_at`, pharmacyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load promotions: %w", err)
+	}
+	return scanPromotions(rows)
+}
+
+func (r *postgresRepository) ProductCategories(ctx context.Context, pharmacyID uuid.UUID, productIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	categories := make(map[uuid.UUID]string)
+	if len(productIDs) == 0 {
+		return categories, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(category, '')
+		FROM inventory.medicines
+		WHERE pharmacy_id = $1 AND id = ANY($2)`, pharmacyID, pq.Array(uuidStrings(productIDs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load medicine categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var category string
+		if err := rows.Scan(&id, &category); err != nil {
+			return nil, err
+		}
+		categories[id] = category
+	}
+	return categories, rows.Err()
+}
+
+func scanPromotions(rows *sql.Rows) ([]Promotion, error) {
+	defer rows.Close()
+
+	promos := []Promotion{}
+	for rows.Next() {
+		var p Promotion
+		var productIDs []string
+		var days pq.Int64Array
+		var bundle []byte
+		var validFrom, validTo sql.NullTime
+		if err := rows.Scan(
+			&p.ID, &p.PharmacyID, &p.Name, &p.Type, pq.Array(&productIDs), pq.Array(&p.Categories), &p.BuyQty, &p.FreeQty,
+			&bundle, &p.BundlePrice, &p.DiscountPercent, &validFrom, &validTo, &days, &p.StartTime, &p.EndTime,
+			&p.Priority, &p.IsActive, &p.CreatedByName, &p.CreatedAt, &p.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		for _, s := range productIDs {
+			if id, err := uuid.Parse(s); err == nil {
+				p.ProductIDs = append(p.ProductIDs, id)
+			}
+		}
+		for _, d := range days {
+			p.DaysOfWeek = append(p.DaysOfWeek, int(d))
+		}
+		if len(bundle) > 0 {
+			if err := json.Unmarshal(bundle, &p.BundleItems); err != nil {
+				return nil, err
+			}
+		}
+		if validFrom.Valid {
+			p.ValidFrom = &validFrom.Time
+		}
+		if validTo.Valid {
+			p.ValidTo = &validTo.Time
+		}
+		promos = append(promos, p)
+	}
+	return promos, rows.Err()
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
@@ -0,0 +1,207 @@
+package promotions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	Create(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req PromotionRequest) (*Promotion, error)
+	Update(ctx context.Context, pharmacyID, id uuid.UUID, req PromotionRequest) (*Promotion, error)
+	Deactivate(ctx context.Context, pharmacyID, id uuid.UUID) (*Promotion, error)
+	Get(ctx context.Context, pharmacyID, id uuid.UUID) (*Promotion, error)
+	List(ctx context.Context, pharmacyID uuid.UUID, activeOnly bool, page, pageSize int) ([]Promotion, int, error)
+
+	// Runnable lists the active promotions that have not ended, for counters that price bills offline
+	Runnable(ctx context.Context, pharmacyID uuid.UUID) ([]Promotion, error)
+	// Evaluate returns what the promotions running at the moment give on the bill's lines
+	Evaluate(ctx context.Context, pharmacyID uuid.UUID, lines []CartLine, at time.Time) ([]Benefit, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) Create(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req PromotionRequest) (*Promotion, error) {
+	now := time.Now()
+	p := &Promotion{
+		ID:            uuid.New(),
+		PharmacyID:    pharmacyID,
+		IsActive:      true,
+		CreatedByName: userName,
+		CreatedAt:     now,
+	}
+	if err := applyRequest(p, req); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = now
+
+	if err := s.repo.Create(ctx, p, userID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *service) Update(ctx context.Context, pharmacyID, id uuid.UUID, req PromotionRequest) (*Promotion, error) {
+	p, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRequest(p, req); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Deactivate stops a promotion for new bills; bills it was applied to keep their itemised lines
+func (s *service) Deactivate(ctx context.Context, pharmacyID, id uuid.UUID) (*Promotion, error) {
+	p, err := s.repo.GetByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	p.IsActive = false
+	p.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *service) Get(ctx context.Context, pharmacyID, id uuid.UUID) (*Promotion, error) {
+	return s.repo.GetByID(ctx, pharmacyID, id)
+}
+
+func (s *service) List(ctx context.Context, pharmacyID uuid.UUID, activeOnly bool, page, pageSize int) ([]Promotion, int, error) {
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return s.repo.List(ctx, pharmacyID, activeOnly, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) Runnable(ctx context.Context, pharmacyID uuid.UUID) ([]Promotion, error) {
+	return s.repo.ListRunnable(ctx, pharmacyID)
+}
+
+func (s *service) Evaluate(ctx context.Context, pharmacyID uuid.UUID, lines []CartLine, at time.Time) ([]Benefit, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	promos, err := s.repo.ListRunnable(ctx, pharmacyID)
+	if err != nil || len(promos) == 0 {
+		return nil, err
+	}
+
+	for _, p := range promos {
+		if p.Type != TypeCategoryDiscount {
+			continue
+		}
+		ids := make([]uuid.UUID, len(lines))
+		for i, l := range lines {
+			ids[i] = l.ProductID
+		}
+		categories, err := s.repo.ProductCategories(ctx, pharmacyID, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i := range lines {
+			lines[i].Category = categories[lines[i].ProductID]
+		}
+		break
+	}
+	return evaluate(promos, lines, at), nil
+}
+
+// applyRequest checks the rule for its type and copies it onto the promotion
+func applyRequest(p *Promotion, req PromotionRequest) error {
+	p.Name = strings.TrimSpace(req.Name)
+	p.Type = req.Type
+	p.ProductIDs = []uuid.UUID{}
+	p.Categories = []string{}
+	p.BundleItems = []BundleItem{}
+	p.BuyQty, p.FreeQty, p.BundlePrice, p.DiscountPercent = 0, 0, 0, 0
+
+	switch req.Type {
+	case TypeFreeQuantity:
+		if len(req.ProductIDs) == 0 {
+			return fmt.Errorf("a free quantity scheme needs the products it applies to")
+		}
+		if req.BuyQty < 1 || req.FreeQty < 1 {
+			return fmt.Errorf("a free quantity scheme needs buy_qty and free_qty of at least 1")
+		}
+		p.ProductIDs = req.ProductIDs
+		p.BuyQty, p.FreeQty = req.BuyQty, req.FreeQty
+	case TypeBundle:
+		seen := make(map[uuid.UUID]bool)
+		for _, it := range req.BundleItems {
+			if seen[it.ProductID] {
+				return fmt.Errorf("product %s is listed twice in the bundle", it.ProductID)
+			}
+			seen[it.ProductID] = true
+		}
+		if len(req.BundleItems) < 2 {
+			return fmt.Errorf("a bundle needs at least two products")
+		}
+		if req.BundlePrice <= 0 {
+			return fmt.Errorf("a bundle needs a bundle_price")
+		}
+		p.BundleItems = req.BundleItems
+		p.BundlePrice = req.BundlePrice
+	case TypeCategoryDiscount:
+		for _, c := range req.Categories {
+			if c = strings.TrimSpace(c); c != "" {
+				p.Categories = append(p.Categories, c)
+			}
+		}
+		if len(p.Categories) == 0 {
+			return fmt.Errorf("a category discount needs the categories it applies to")
+		}
+		if req.DiscountPercent <= 0 {
+			return fmt.Errorf("a category discount needs a discount_percent")
+		}
+		p.DiscountPercent = req.DiscountPercent
+	}
+
+	p.ValidFrom, p.ValidTo = nil, nil
+	if req.ValidFrom != "" {
+		from, _ := time.Parse("2006-01-02", req.ValidFrom)
+		p.ValidFrom = &from
+	}
+	if req.ValidTo != "" {
+		to, _ := time.Parse("2006-01-02", req.ValidTo)
+		p.ValidTo = &to
+	}
+	if p.ValidFrom != nil && p.ValidTo != nil && p.ValidTo.Before(*p.ValidFrom) {
+		return fmt.Errorf("valid_to is before valid_from")
+	}
+
+	if (req.StartTime == "") != (req.EndTime == "") {
+		return fmt.Errorf("start_time and end_time go together")
+	}
+	if req.StartTime != "" && req.EndTime <= req.StartTime {
+		return fmt.Errorf("end_time must be after start_time")
+	}
+	p.StartTime, p.EndTime = req.StartTime, req.EndTime
+
+	p.DaysOfWeek = []int{}
+	if req.DaysOfWeek != nil {
+		p.DaysOfWeek = req.DaysOfWeek
+	}
+	p.Priority = req.Priority
+	if req.IsActive != nil {
+		p.IsActive = *req.IsActive
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package promotions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepository serves the running promotions and product categories
+type fakeRepository struct {
+	Repository
+	promos     []Promotion
+	categories map[uuid.UUID]string
+	looked     int
+}
+
+func (f *fakeRepository) ListRunnable(context.Context, uuid.UUID) ([]Promotion, error) {
+	return f.promos, nil
+}
+
+func (f *fakeRepository) ProductCategories(context.Context, uuid.UUID, []uuid.UUID) (map[uuid.UUID]string, error) {
+	f.looked++
+	return f.categories, nil
+}
+
+func TestApplyRequest(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	off := false
+
+	tests := []struct {
+		name    string
+		req     PromotionRequest
+		wantErr bool
+	}{
+		{"free quantity", PromotionRequest{Type: TypeFreeQuantity, ProductIDs: []uuid.UUID{a}, BuyQty: 2, FreeQty: 1}, false},
+		{"free quantity without products", PromotionRequest{Type: TypeFreeQuantity, BuyQty: 2, FreeQty: 1}, true},
+		{"free quantity without free units", PromotionRequest{Type: TypeFreeQuantity, ProductIDs: []uuid.UUID{a}, BuyQty: 2}, true},
+		{"bundle", PromotionRequest{Type: TypeBundle, BundleItems: []BundleItem{{a, 1}, {b, 2}}, BundlePrice: 99}, false},
+		{"bundle of one", PromotionRequest{Type: TypeBundle, BundleItems: []BundleItem{{a, 2}}, BundlePrice: 99}, true},
+		{"bundle lists a product twice", PromotionRequest{Type: TypeBundle, BundleItems: []BundleItem{{a, 1}, {a, 1}}, BundlePrice: 99}, true},
+		{"bundle without a price", PromotionRequest{Type: TypeBundle, BundleItems: []BundleItem{{a, 1}, {b, 1}}}, true},
+		{"category discount", PromotionRequest{Type: TypeCategoryDiscount, Categories: []string{" Vitamins "}, DiscountPercent: 10}, false},
+		{"category discount with blank categories", PromotionRequest{Type: TypeCategoryDiscount, Categories: []string{" "}, DiscountPercent: 10}, true},
+		{"category discount without a percent", PromotionRequest{Type: TypeCategoryDiscount, Categories: []string{"Vitamins"}}, true},
+		{
+			name: "dated, happy hour, switched off",
+			req: PromotionRequest{Type: TypeFreeQuantity, ProductIDs: []uuid.UUID{a}, BuyQty: 1, FreeQty: 1,
+				ValidFrom: "2025-06-01", ValidTo: "2025-06-30", StartTime: "17:00", EndTime: "19:00", IsActive: &off},
+		},
+		{
+			name: "ends before it starts",
+			req: PromotionRequest{Type: TypeFreeQuantity, ProductIDs: []uuid.UUID{a}, BuyQty: 1, FreeQty: 1,
+				ValidFrom: "2025-06-30", ValidTo: "2025-06-01"},
+			wantErr: true,
+		},
+		{
+			name:    "start time without an end",
+			req:     PromotionRequest{Type: TypeFreeQuantity, ProductIDs: []uuid.UUID{a}, BuyQty: 1, FreeQty: 1, StartTime: "17:00"},
+			wantErr: true,
+		},
+		{
+			name:    "window ends before it starts",
+			req:     PromotionRequest{Type: TypeFreeQuantity, ProductIDs: []uuid.UUID{a}, BuyQty: 1, FreeQty: 1, StartTime: "19:00", EndTime: "17:00"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Promotion{IsActive: true, BuyQty: 9, DiscountPercent: 50}
+			err := applyRequest(p, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.req.Type != TypeFreeQuantity && p.BuyQty != 0 {
+				t.Errorf("buy_qty %d kept from the earlier type", p.BuyQty)
+			}
+			if tt.req.Type != TypeCategoryDiscount && p.DiscountPercent != 0 {
+				t.Errorf("discount_percent %.2f kept from the earlier type", p.DiscountPercent)
+			}
+			if p.IsActive != (tt.req.IsActive == nil || *tt.req.IsActive) {
+				t.Errorf("is_active = %v", p.IsActive)
+			}
+			if tt.req.Type == TypeCategoryDiscount && p.Categories[0] != "Vitamins" {
+				t.Errorf("categories = %q, want trimmed", p.Categories)
+			}
+		})
+	}
+}
+
+func TestServiceEvaluate(t *testing.T) {
+	at := time.Date(2025, time.June, 4, 12, 0, 0, 0, clock.IST)
+	a := uuid.New()
+	vitamins := Promotion{ID: uuid.New(), Type: TypeCategoryDiscount, IsActive: true, Categories: []string{"Vitamins"}, DiscountPercent: 10}
+	buy1get1 := Promotion{ID: uuid.New(), Type: TypeFreeQuantity, IsActive: true, ProductIDs: []uuid.UUID{a}, BuyQty: 1, FreeQty: 1}
+
+	tests := []struct {
+		name       string
+		promos     []Promotion
+		lines      []CartLine
+		wantLooked int
+		wantCount  int
+	}{
+		{"empty bill", []Promotion{vitamins}, nil, 0, 0},
+		{"no promotions", nil, []CartLine{{ProductID: a, Quantity: 1, Value: 100}}, 0, 0},
+		{"categories looked up for category discounts", []Promotion{vitamins}, []CartLine{{ProductID: a, Quantity: 1, Value: 100}}, 1, 1},
+		{"categories not needed", []Promotion{buy1get1}, []CartLine{{ProductID: a, Quantity: 1, Value: 100}}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{promos: tt.promos, categories: map[uuid.UUID]string{a: "Vitamins"}}
+			got, err := NewService(repo).Evaluate(context.Background(), uuid.New(), tt.lines, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo.looked != tt.wantLooked {
+				t.Errorf("categories looked up %d times, want %d", repo.looked, tt.wantLooked)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("got %d benefits, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package refills
+
+import (
+	"context"
+	"fmt"
+
+	"organization-service/internal/pharmacy/notification"
+)
+
+// Channel delivers a refill reminder to a patient. SMS goes through the
+// notification service; WhatsApp, push or email gateways plug in the same way
+// and are picked per pharmacy by name.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, r *Reminder, message string) error
+}
+
+type smsChannel struct {
+	notifier notification.NotificationService
+}
+
+func NewSMSChannel(notifier notification.NotificationService) Channel {
+	return &smsChannel{notifier: notifier}
+}
+
+func (c *smsChannel) Name() string {
+	return "SMS"
+}
+
+func (c *smsChannel) Send(ctx context.Context, r *Reminder, message string) error {
+	if r.PatientPhone == "" {
+		return fmt.Errorf("patient has no phone number")
+	}
+	return c.notifier.SendSMS(r.PatientPhone, message)
+}
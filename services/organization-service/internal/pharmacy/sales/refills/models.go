@@ -0,0 +1,151 @@
+package refills
+
+import (
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultDaysBefore = 3
+	DefaultGraceDays  = 7
+	DefaultChannel    = "SMS"
+	// ChannelNone records reminders for tracking without contacting the patient
+	ChannelNone = "NONE"
+
+	// DefaultMessageTemplate is used when a pharmacy has not set its own;
+	// {patient}, {medicines} and {date} are filled in per reminder
+	DefaultMessageTemplate = "Hi {patient}, your refill of {medicines} is due on {date}. Reply or visit us to have it ready."
+)
+
+type ReminderStatus string
+
+const (
+	ReminderPending   ReminderStatus = "PENDING"
+	ReminderConverted ReminderStatus = "CONVERTED" // The patient bought the medicines again
+	ReminderMissed    ReminderStatus = "MISSED"    // No refill within the grace period
+)
+
+type NotifyStatus string
+
+const (
+	NotifyQueued  NotifyStatus = "QUEUED"
+	NotifySent    NotifyStatus = "SENT"
+	NotifyFailed  NotifyStatus = "FAILED"
+	NotifySkipped NotifyStatus = "SKIPPED"
+)
+
+type Settings struct {
+	PharmacyID      uuid.UUID `json:"pharmacy_id"`
+	Enabled         bool      `json:"enabled"`
+	DaysBefore      int       `json:"days_before"`
+	Channel         string    `json:"channel"`
+	AutoDraft       bool      `json:"auto_draft"`
+	GraceDays       int       `json:"grace_days"` // Days after the refill date before a reminder counts as missed
+	MessageTemplate string    `json:"message_template"`
+	UpdatedByName   string    `json:"updated_by_name,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Reminder follows one recurring sale from the reminder to the refill (or its absence)
+type Reminder struct {
+	ID              uuid.UUID      `json:"id"`
+	SaleID          uuid.UUID      `json:"sale_id"`
+	InvoiceNumber   string         `json:"invoice_number"`
+	PatientID       uuid.UUID      `json:"patient_id"`
+	PatientName     string         `json:"patient_name"`
+	PatientPhone    string         `json:"patient_phone"`
+	RefillDate      time.Time      `json:"refill_date"`
+	Medicines       []string       `json:"medicines"`
+	Channel         string         `json:"channel"`
+	NotifyStatus    NotifyStatus   `json:"notify_status"`
+	NotifyError     string         `json:"notify_error,omitempty"`
+	NotifiedAt      *time.Time     `json:"notified_at,omitempty"`
+	DraftSaleID     *uuid.UUID     `json:"draft_sale_id,omitempty"`
+	Status          ReminderStatus `json:"status"`
+	ConvertedSaleID *uuid.UUID     `json:"converted_sale_id,omitempty"`
+	ConvertedAt     *time.Time     `json:"converted_at,omitempty"`
+	DaysLate        *int           `json:"days_late,omitempty"` // Negative when the patient came early
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
+// RefillItem is a line of the recurring sale to be bought again
+type RefillItem struct {
+	ProductID    uuid.UUID
+	MedicineName string
+	Quantity     int
+}
+
+// refillCandidate is a recurring sale whose refill falls within the reminder window
+type refillCandidate struct {
+	SaleID        uuid.UUID
+	InvoiceNumber string
+	PatientID     uuid.UUID
+	PatientName   string
+	PatientPhone  string
+	RefillDate    time.Time
+	Items         []RefillItem
+}
+
+// RunSummary reports what one pass of the worker did for a pharmacy
+type RunSummary struct {
+	PharmacyID   uuid.UUID `json:"pharmacy_id"`
+	Reminded     int       `json:"reminded"`
+	NotifyFailed int       `json:"notify_failed"`
+	Drafted      int       `json:"drafted"`
+	Converted    int       `json:"converted"`
+	Missed       int       `json:"missed"`
+}
+
+// AdherenceCounts summarises reminders by outcome
+type AdherenceCounts struct {
+	Reminders int `json:"reminders"`
+	Converted int `json:"converted"`
+	Missed    int `json:"missed"`
+	Pending   int `json:"pending"`
+	// ConversionRate is the percentage of settled reminders (converted or missed) that converted
+	ConversionRate float64 `json:"conversion_rate"`
+	// AvgDaysLate is across converted refills; negative when patients come early
+	AvgDaysLate float64 `json:"avg_days_late"`
+}
+
+func (a *AdherenceCounts) finish() {
+	if settled := a.Converted + a.Missed; settled > 0 {
+		a.ConversionRate = money.Round2(float64(a.Converted) * 100 / float64(settled))
+	}
+	a.AvgDaysLate = money.Round2(a.AvgDaysLate)
+}
+
+type PatientAdherence struct {
+	PatientID    uuid.UUID `json:"patient_id"`
+	PatientName  string    `json:"patient_name"`
+	PatientPhone string    `json:"patient_phone"`
+	AdherenceCounts
+}
+
+type MedicineAdherence struct {
+	ProductID    uuid.UUID `json:"product_id"`
+	MedicineName string    `json:"medicine_name"`
+	AdherenceCounts
+}
+
+type AdherenceReport struct {
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Totals    AdherenceCounts     `json:"totals"`
+	Patients  []PatientAdherence  `json:"patients"`
+	Medicines []MedicineAdherence `json:"medicines"`
+}
+
+// Request Structs
+
+type UpdateSettingsRequest struct {
+	Enabled         *bool  `json:"enabled"`
+	DaysBefore      *int   `json:"days_before" validate:"omitempty,min=0,max=30"`
+	Channel         string `json:"channel" validate:"omitempty,max=30"`
+	AutoDraft       *bool  `json:"auto_draft"`
+	GraceDays       *int   `json:"grace_days" validate:"omitempty,min=0,max=60"`
+	MessageTemplate string `json:"message_template" validate:"max=500"`
+}
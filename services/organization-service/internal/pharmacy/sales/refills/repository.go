@@ -0,0 +1,410 @@
+package refills
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	// ListPharmaciesWithRefills returns every pharmacy with recurring sales, for the worker
+	ListPharmaciesWithRefills(ctx context.Context) ([]uuid.UUID, error)
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpsertSettings(ctx context.Context, s *Settings, userID uuid.UUID) error
+
+	// ListDueRefills returns each patient's latest recurring sale whose refill date
+	// falls between notBefore and until and that has no reminder yet
+	ListDueRefills(ctx context.Context, pharmacyID uuid.UUID, notBefore, until time.Time) ([]refillCandidate, error)
+	// InsertReminder claims the sale for a reminder; false when one already exists
+	InsertReminder(ctx context.Context, pharmacyID uuid.UUID, r *Reminder) (bool, error)
+	UpdateNotify(ctx context.Context, id uuid.UUID, status NotifyStatus, notifyErr string, at time.Time) error
+	SetDraft(ctx context.Context, id, draftSaleID uuid.UUID) error
+	// ResolveConversions marks pending reminders converted where the patient has
+	// since completed a sale with any of the same medicines
+	ResolveConversions(ctx context.Context, pharmacyID uuid.UUID) (int64, error)
+	// MarkMissed closes pending reminders whose refill date is before the cutoff
+	// and returns the drafts they left behind
+	MarkMissed(ctx context.Context, pharmacyID uuid.UUID, before time.Time) (int, []uuid.UUID, error)
+	ListReminders(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Reminder, int, error)
+	PatientAdherence(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]PatientAdherence, error)
+	MedicineAdherence(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]MedicineAdherence, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) ListPharmaciesWithRefills(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT pharmacy_id FROM sales_schema.sales
+		WHERE is_recurring = TRUE AND next_refill_date IS NOT NULL
+		UNION
+		SELECT DISTINCT pharmacy_id FROM sales_schema.refill_reminders WHERE status = 'PENDING'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *postgresRepository) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	s := &Settings{PharmacyID: pharmacyID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT enabled, days_before, channel, auto_draft, grace_days, COALESCE(message_template, ''),
+		       COALESCE(updated_by_name, ''), updated_at
+		FROM sales_schema.refill_settings
+		WHERE pharmacy_id = $1
+	`, pharmacyID).Scan(&s.Enabled, &s.DaysBefore, &s.Channel, &s.AutoDraft, &s.GraceDays, &s.MessageTemplate,
+		&s.UpdatedByName, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		s.Enabled = true
+		s.DaysBefore = DefaultDaysBefore
+		s.Channel = DefaultChannel
+		s.GraceDays = DefaultGraceDays
+		s.MessageTemplate = DefaultMessageTemplate
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.MessageTemplate == "" {
+		s.MessageTemplate = DefaultMessageTemplate
+	}
+	return s, nil
+}
+
+func (r *postgresRepository) UpsertSettings(ctx context.Context, s *Settings, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.refill_settings (
+			pharmacy_id, enabled, days_before, channel, auto_draft, grace_days, message_template,
+			updated_by, updated_by_name, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)
+		ON CONFLICT (pharmacy_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			days_before = EXCLUDED.days_before,
+			channel = EXCLUDED.channel,
+			auto_draft = EXCLUDED.auto_draft,
+			grace_days = EXCLUDED.grace_days,
+			message_template = EXCLUDED.message_template,
+			updated_by = EXCLUDED.updated_by,
+			updated_by_name = EXCLUDED.updated_by_name,
+			updated_at = EXCLUDED.updated_at
+	`, s.PharmacyID, s.Enabled, s.DaysBefore, s.Channel, s.AutoDraft, s.GraceDays, s.MessageTemplate,
+		userID, s.UpdatedByName, s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save refill settings: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListDueRefills(ctx context.Context, pharmacyID uuid.UUID, notBefore, until time.Time) ([]refillCandidate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT latest.id, latest.invoice_number, latest.patient_id, latest.name, latest.phone, latest.refill_date
+		FROM (
+			SELECT DISTINCT ON (s.patient_id)
+			       s.id, COALESCE(s.invoice_number, '') AS invoice_number, s.patient_id,
+			       COALESCE(p.name, s.customer_name, '') AS name, COALESCE(p.phone, s.customer_phone, '') AS phone,
+			       s.next_refill_date::date AS refill_date
+			FROM sales_schema.sales s
+			JOIN sales_schema.patients p ON p.id = s.patient_id
+			WHERE s.pharmacy_id = $1 AND s.is_recurring = TRUE AND s.status IN ('COMPLETED', 'DISPATCHED')
+			  AND s.next_refill_date IS NOT NULL
+			ORDER BY s.patient_id, s.created_at DESC
+		) latest
+		WHERE latest.refill_date BETWEEN $2 AND $3
+		  AND NOT EXISTS (SELECT 1 FROM sales_schema.refill_reminders rem WHERE rem.sale_id = latest.id)
+		ORDER BY latest.refill_date, latest.name
+	`, pharmacyID, notBefore, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due refills: %w", err)
+	}
+
+	var candidates []refillCandidate
+	for rows.Next() {
+		var c refillCandidate
+		if err := rows.Scan(&c.SaleID, &c.InvoiceNumber, &c.PatientID, &c.PatientName, &c.PatientPhone, &c.RefillDate); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		if candidates[i].Items, err = r.listRefillItems(ctx, candidates[i].SaleID); err != nil {
+			return nil, err
+		}
+	}
+	return candidates, nil
+}
+
+// listRefillItems returns the sale's medicines with batch lines of the same product combined
+func (r *postgresRepository) listRefillItems(ctx context.Context, saleID uuid.UUID) ([]RefillItem, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT product_id, MIN(medicine_name), SUM(quantity - COALESCE(returned_quantity, 0))
+		FROM sales_schema.sale_items
+		WHERE sale_id = $1
+		GROUP BY product_id
+		HAVING SUM(quantity - COALESCE(returned_quantity, 0)) > 0
+		ORDER BY MIN(medicine_name)
+	`, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []RefillItem
+	for rows.Next() {
+		var it RefillItem
+		if err := rows.Scan(&it.ProductID, &it.MedicineName, &it.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (r *postgresRepository) InsertReminder(ctx context.Context, pharmacyID uuid.UUID, rem *Reminder) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO sales_schema.refill_reminders (
+			id, pharmacy_id, sale_id, patient_id, refill_date, channel, notify_status, status, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		ON CONFLICT (sale_id) DO NOTHING
+	`, rem.ID, pharmacyID, rem.SaleID, rem.PatientID, rem.RefillDate, rem.Channel, rem.NotifyStatus, rem.Status, rem.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record refill reminder: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *postgresRepository) UpdateNotify(ctx context.Context, id uuid.UUID, status NotifyStatus, notifyErr string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sales_schema.refill_reminders
+		SET notify_status = $1, notify_error = NULLIF($2, ''), notified_at = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, status, notifyErr, at, id)
+	return err
+}
+
+func (r *postgresRepository) SetDraft(ctx context.Context, id, draftSaleID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sales_schema.refill_reminders SET draft_sale_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, draftSaleID, id)
+	return err
+}
+
+func (r *postgresRepository) ResolveConversions(ctx context.Context, pharmacyID uuid.UUID) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		WITH conv AS (
+			SELECT rem.id AS reminder_id, c.id AS sale_id, c.created_at
+			FROM sales_schema.refill_reminders rem
+			JOIN sales_schema.sales src ON src.id = rem.sale_id
+			JOIN LATERAL (
+				SELECT n.id, n.created_at
+				FROM sales_schema.sales n
+				WHERE n.pharmacy_id = rem.pharmacy_id AND n.patient_id = rem.patient_id
+				  AND n.status IN ('COMPLETED', 'DISPATCHED') AND n.created_at > src.created_at
+				  AND EXISTS (
+				      SELECT 1
+				      FROM sales_schema.sale_items ni
+				      JOIN sales_schema.sale_items si ON si.product_id = ni.product_id
+				      WHERE ni.sale_id = n.id AND si.sale_id = rem.sale_id
+				  )
+				ORDER BY n.created_at
+				LIMIT 1
+			) c ON TRUE
+			WHERE rem.pharmacy_id = $1 AND rem.status = 'PENDING'
+		)
+		UPDATE sales_schema.refill_reminders rem
+		SET status = 'CONVERTED', converted_sale_id = conv.sale_id, converted_at = conv.created_at,
+		    days_late = timezone('Asia/Kolkata', conv.created_at)::date - rem.refill_date,
+		    updated_at = CURRENT_TIMESTAMP
+		FROM conv
+		WHERE rem.id = conv.reminder_id
+	`, pharmacyID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve refill conversions: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (r *postgresRepository) MarkMissed(ctx context.Context, pharmacyID uuid.UUID, before time.Time) (int, []uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE sales_schema.refill_reminders
+		SET status = 'MISSED', updated_at = CURRENT_TIMESTAMP
+		WHERE pharmacy_id = $1 AND status = 'PENDING' AND refill_date < $2
+		RETURNING draft_sale_id
+	`, pharmacyID, before)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to mark missed refills: %w", err)
+	}
+	defer rows.Close()
+
+	var missed int
+	var drafts []uuid.UUID
+	for rows.Next() {
+		var draftID uuid.NullUUID
+		if err := rows.Scan(&draftID); err != nil {
+			return 0, nil, err
+		}
+		missed++
+		if draftID.Valid {
+			drafts = append(drafts, draftID.UUID)
+		}
+	}
+	return missed, drafts, rows.Err()
+}
+
+func (r *postgresRepository) ListReminders(ctx context.Context, pharmacyID uuid.UUID, status string, limit, offset int) ([]Reminder, int, error) {
+	where := " WHERE rem.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND rem.status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sales_schema.refill_reminders rem"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT rem.id, rem.sale_id, COALESCE(s.invoice_number, ''), rem.patient_id, COALESCE(p.name, ''), COALESCE(p.phone, ''),
+		       rem.refill_date,
+		       ARRAY(SELECT DISTINCT si.medicine_name FROM sales_schema.sale_items si WHERE si.sale_id = rem.sale_id),
+		       rem.channel, rem.notify_status, COALESCE(rem.notify_error, ''), rem.notified_at, rem.draft_sale_id,
+		       rem.status, rem.converted_sale_id, rem.converted_at, rem.days_late, rem.created_at
+		FROM sales_schema.refill_reminders rem
+		JOIN sales_schema.sales s ON s.id = rem.sale_id
+		LEFT JOIN sales_schema.patients p ON p.id = rem.patient_id` + where +
+		fmt.Sprintf(" ORDER BY rem.refill_date DESC, rem.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		var rem Reminder
+		var medicines pq.StringArray
+		var notifiedAt, convertedAt sql.NullTime
+		var draftID, convertedID uuid.NullUUID
+		var daysLate sql.NullInt64
+		if err := rows.Scan(
+			&rem.ID, &rem.SaleID, &rem.InvoiceNumber, &rem.PatientID, &rem.PatientName, &rem.PatientPhone,
+			&rem.RefillDate, &medicines,
+			&rem.Channel, &rem.NotifyStatus, &rem.NotifyError, &notifiedAt, &draftID,
+			&rem.Status, &convertedID, &convertedAt, &daysLate, &rem.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		rem.Medicines = []string(medicines)
+		if notifiedAt.Valid {
+			rem.NotifiedAt = &notifiedAt.Time
+		}
+		if draftID.Valid {
+			rem.DraftSaleID = &draftID.UUID
+		}
+		if convertedID.Valid {
+			rem.ConvertedSaleID = &convertedID.UUID
+		}
+		if convertedAt.Valid {
+			rem.ConvertedAt = &convertedAt.Time
+		}
+		if daysLate.Valid {
+			d := int(daysLate.Int64)
+			rem.DaysLate = &d
+		}
+		reminders = append(reminders, rem)
+	}
+	return reminders, total, rows.Err()
+}
+
+const adherenceColumns = `
+	COUNT(DISTINCT rem.id),
+	COUNT(DISTINCT rem.id) FILTER (WHERE rem.status = 'CONVERTED'),
+	COUNT(DISTINCT rem.id) FILTER (WHERE rem.status = 'MISSED'),
+	COUNT(DISTINCT rem.id) FILTER (WHERE rem.status = 'PENDING'),
+	COALESCE(AVG(rem.days_late) FILTER (WHERE rem.status = 'CONVERTED'), 0)`
+
+func (r *postgresRepository) PatientAdherence(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]PatientAdherence, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rem.patient_id, COALESCE(p.name, ''), COALESCE(p.phone, ''),`+adherenceColumns+`
+		FROM sales_schema.refill_reminders rem
+		LEFT JOIN sales_schema.patients p ON p.id = rem.patient_id
+		WHERE rem.pharmacy_id = $1 AND rem.refill_date BETWEEN $2 AND $3
+		GROUP BY rem.patient_id, p.name, p.phone
+		ORDER BY COUNT(DISTINCT rem.id) FILTER (WHERE rem.status = 'MISSED') DESC, p.name
+	`, pharmacyID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load patient adherence: %w", err)
+	}
+	defer rows.Close()
+
+	patients := []PatientAdherence{}
+	for rows.Next() {
+		var a PatientAdherence
+		if err := rows.Scan(&a.PatientID, &a.PatientName, &a.PatientPhone,
+			&a.Reminders, &a.Converted, &a.Missed, &a.Pending, &a.AvgDaysLate); err != nil {
+			return nil, err
+		}
+		a.finish()
+		patients = append(patients, a)
+	}
+	return patients, rows.Err()
+}
+
+func (r *postgresRepository) MedicineAdherence(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]MedicineAdherence, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT si.product_id, MIN(si.medicine_name),`+adherenceColumns+`
+		FROM sales_schema.refill_reminders rem
+		JOIN (
+			SELECT sale_id, product_id, MIN(medicine_name) AS medicine_name
+			FROM sales_schema.sale_items
+			GROUP BY sale_id, product_id
+		) si ON si.sale_id = rem.sale_id
+		WHERE rem.pharmacy_id = $1 AND rem.refill_date BETWEEN $2 AND $3
+		GROUP BY si.product_id
+		ORDER BY COUNT(DISTINCT rem.id) DESC, MIN(si.medicine_name)
+	`, pharmacyID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load medicine adherence: %w", err)
+	}
+	defer rows.Close()
+
+	medicines := []MedicineAdherence{}
+	for rows.Next() {
+		var a MedicineAdherence
+		if err := rows.Scan(&a.ProductID, &a.MedicineName,
+			&a.Reminders, &a.Converted, &a.Missed, &a.Pending, &a.AvgDaysLate); err != nil {
+			return nil, err
+		}
+		a.finish()
+		medicines = append(medicines, a)
+	}
+	return medicines, rows.Err()
+}
@@ -0,0 +1,304 @@
+package refills
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+	"organization-service/internal/pharmacy/sales/sales"
+
+	"github.com/google/uuid"
+	"shared-scheduler"
+)
+
+type Service interface {
+	GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error)
+	UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error)
+	// Channels lists the reminder channels a pharmacy can choose from
+	Channels() []string
+	// Run settles earlier reminders and sends the ones now due for one pharmacy
+	Run(ctx context.Context, pharmacyID uuid.UUID) (*RunSummary, error)
+	ListReminders(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Reminder, int, error)
+	GetAdherence(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*AdherenceReport, error)
+	RegisterJobs(jobs *scheduler.Scheduler) // Daily reminder run
+}
+
+type service struct {
+	repo     Repository
+	salesSvc sales.Service
+	channels map[string]Channel
+}
+
+func NewService(repo Repository, salesSvc sales.Service, channels ...Channel) Service {
+	s := &service{
+		repo:     repo,
+		salesSvc: salesSvc,
+		channels: make(map[string]Channel),
+	}
+	for _, c := range channels {
+		s.channels[c.Name()] = c
+	}
+	return s
+}
+
+func (s *service) GetSettings(ctx context.Context, pharmacyID uuid.UUID) (*Settings, error) {
+	return s.repo.GetSettings(ctx, pharmacyID)
+}
+
+func (s *service) UpdateSettings(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req UpdateSettingsRequest) (*Settings, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Channel != "" {
+		channel := strings.ToUpper(req.Channel)
+		if _, ok := s.channels[channel]; !ok && channel != ChannelNone {
+			return nil, fmt.Errorf("unknown reminder channel %s; available: %s", req.Channel, strings.Join(s.Channels(), ", "))
+		}
+		settings.Channel = channel
+	}
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.DaysBefore != nil {
+		settings.DaysBefore = *req.DaysBefore
+	}
+	if req.AutoDraft != nil {
+		settings.AutoDraft = *req.AutoDraft
+	}
+	if req.GraceDays != nil {
+		settings.GraceDays = *req.GraceDays
+	}
+	if req.MessageTemplate != "" {
+		settings.MessageTemplate = req.MessageTemplate
+	}
+	settings.UpdatedByName = userName
+	settings.UpdatedAt = time.Now()
+
+	if err := s.repo.UpsertSettings(ctx, settings, userID); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *service) Channels() []string {
+	names := []string{ChannelNone}
+	for name := range s.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterJobs schedules the reminder run for every pharmacy each morning; the
+// scheduler fires it on one replica at a time. Each reminder is also claimed by
+// its sale before it is sent or drafted, so a manual run overlapping the job
+// cannot remind or draft twice.
+func (s *service) RegisterJobs(jobs *scheduler.Scheduler) {
+	jobs.Register(&scheduler.Job{
+		Name:        "pharmacy-refills",
+		Description: "Send refill reminders, auto-draft refills and close out missed refills",
+		Schedule:    scheduler.MustParseSchedule("0 9 * * *"),
+		Timeout:     30 * time.Minute,
+		Run:         s.runAll,
+	})
+}
+
+// runAll runs every pharmacy with refills due; one pharmacy failing does not stop the rest
+func (s *service) runAll(ctx context.Context, _ *sql.DB) (int64, error) {
+	pharmacyIDs, err := s.repo.ListPharmaciesWithRefills(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for _, pharmacyID := range pharmacyIDs {
+		summary, err := s.Run(ctx, pharmacyID)
+		if err != nil {
+			fmt.Printf("[Refill-Worker] Pharmacy %s: %v\n", pharmacyID, err)
+			continue
+		}
+		if summary.Reminded > 0 || summary.Converted > 0 || summary.Missed > 0 {
+			fmt.Printf("[Refill-Worker] Pharmacy %s: reminded %d (%d failed), drafted %d, converted %d, missed %d\n",
+				pharmacyID, summary.Reminded, summary.NotifyFailed, summary.Drafted, summary.Converted, summary.Missed)
+		}
+		affected += int64(summary.Reminded + summary.Drafted + summary.Converted + summary.Missed)
+	}
+	return affected, nil
+}
+
+func (s *service) Run(ctx context.Context, pharmacyID uuid.UUID) (*RunSummary, error) {
+	settings, err := s.repo.GetSettings(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	summary := &RunSummary{PharmacyID: pharmacyID}
+
+	// Settle earlier reminders first so a refill bought today is not reminded again
+	converted, err := s.repo.ResolveConversions(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	summary.Converted = int(converted)
+
+	today := clock.Today()
+	missed, drafts, err := s.repo.MarkMissed(ctx, pharmacyID, today.AddDate(0, 0, -settings.GraceDays))
+	if err != nil {
+		return nil, err
+	}
+	summary.Missed = missed
+	for _, draftID := range drafts {
+		// Already billed or discarded drafts refuse; either way nothing is left to release
+		_ = s.salesSvc.DiscardDraft(ctx, pharmacyID, draftID)
+	}
+
+	if !settings.Enabled {
+		return summary, nil
+	}
+
+	// Refills that lapsed beyond the grace period before the first run are not reminded
+	due, err := s.repo.ListDueRefills(ctx, pharmacyID, today.AddDate(0, 0, -settings.GraceDays), today.AddDate(0, 0, settings.DaysBefore))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range due {
+		if len(c.Items) == 0 {
+			continue
+		}
+		if err := s.remind(ctx, pharmacyID, settings, c, summary); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+func (s *service) remind(ctx context.Context, pharmacyID uuid.UUID, settings *Settings, c refillCandidate, summary *RunSummary) error {
+	rem := &Reminder{
+		ID:            uuid.New(),
+		SaleID:        c.SaleID,
+		InvoiceNumber: c.InvoiceNumber,
+		PatientID:     c.PatientID,
+		PatientName:   c.PatientName,
+		PatientPhone:  c.PatientPhone,
+		RefillDate:    c.RefillDate,
+		Channel:       settings.Channel,
+		NotifyStatus:  NotifyQueued,
+		Status:        ReminderPending,
+		CreatedAt:     time.Now(),
+	}
+	for _, it := range c.Items {
+		rem.Medicines = append(rem.Medicines, it.MedicineName)
+	}
+
+	claimed, err := s.repo.InsertReminder(ctx, pharmacyID, rem)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+	summary.Reminded++
+
+	// A failed send is recorded on the reminder, not retried; the counter can follow up from the list
+	status, notifyErr := NotifySkipped, ""
+	if channel, ok := s.channels[settings.Channel]; ok {
+		if err := channel.Send(ctx, rem, renderMessage(settings.MessageTemplate, rem)); err != nil {
+			status, notifyErr = NotifyFailed, err.Error()
+			summary.NotifyFailed++
+		} else {
+			status = NotifySent
+		}
+	}
+	if err := s.repo.UpdateNotify(ctx, rem.ID, status, notifyErr, time.Now()); err != nil {
+		return err
+	}
+
+	if settings.AutoDraft {
+		if draftID, err := s.draftRefill(ctx, pharmacyID, c); err != nil {
+			fmt.Printf("[Refill-Worker] Pharmacy %s: could not draft refill for sale %s: %v\n", pharmacyID, c.SaleID, err)
+		} else if draftID != uuid.Nil {
+			if err := s.repo.SetDraft(ctx, rem.ID, draftID); err != nil {
+				return err
+			}
+			summary.Drafted++
+		}
+	}
+	return nil
+}
+
+// draftRefill parks a bill with the previous sale's medicines reserved so the
+// counter only has to resume and finalize it. Lines that cannot be reserved
+// are left off; the hold lapses like any parked bill and resuming re-reserves.
+func (s *service) draftRefill(ctx context.Context, pharmacyID uuid.UUID, c refillCandidate) (uuid.UUID, error) {
+	patient, err := s.salesSvc.GetPatientByID(ctx, pharmacyID, c.PatientID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	draft, err := s.salesSvc.CreateWalkInDraft(ctx, pharmacyID, *patient)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	added := 0
+	for _, it := range c.Items {
+		if _, err := s.salesSvc.AddItemToDraft(ctx, pharmacyID, draft.ID, sales.AddItemRequest{
+			ProductID: it.ProductID,
+			Quantity:  it.Quantity,
+		}); err != nil {
+			fmt.Printf("[Refill-Worker] Refill draft %s: skipped %s: %v\n", draft.ID, it.MedicineName, err)
+			continue
+		}
+		added++
+	}
+	if added == 0 {
+		_ = s.salesSvc.DiscardDraft(ctx, pharmacyID, draft.ID)
+		return uuid.Nil, nil
+	}
+	return draft.ID, nil
+}
+
+func renderMessage(template string, rem *Reminder) string {
+	return strings.NewReplacer(
+		"{patient}", rem.PatientName,
+		"{medicines}", strings.Join(rem.Medicines, ", "),
+		"{date}", rem.RefillDate.Format("02 Jan 2006"),
+	).Replace(template)
+}
+
+func (s *service) ListReminders(ctx context.Context, pharmacyID uuid.UUID, status string, page, pageSize int) ([]Reminder, int, error) {
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return s.repo.ListReminders(ctx, pharmacyID, status, pageSize, (page-1)*pageSize)
+}
+
+func (s *service) GetAdherence(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*AdherenceReport, error) {
+	patients, err := s.repo.PatientAdherence(ctx, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	medicines, err := s.repo.MedicineAdherence(ctx, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AdherenceReport{From: from, To: to, Patients: patients, Medicines: medicines}
+	var lateDays float64
+	for _, p := range patients {
+		report.Totals.Reminders += p.Reminders
+		report.Totals.Converted += p.Converted
+		report.Totals.Missed += p.Missed
+		report.Totals.Pending += p.Pending
+		lateDays += p.AvgDaysLate * float64(p.Converted)
+	}
+	if report.Totals.Converted > 0 {
+		report.Totals.AvgDaysLate = lateDays / float64(report.Totals.Converted)
+	}
+	report.Totals.finish()
+	return report, nil
+}
@@ -0,0 +1,285 @@
+package refills
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"organization-service/internal/pharmacy/sales/sales"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepository serves settings and due refills and records what the run writes
+type fakeRepository struct {
+	Repository
+	settings  Settings
+	due       []refillCandidate
+	claimed   map[uuid.UUID]bool // Sales that already have a reminder
+	drafts    []uuid.UUID        // Left behind by missed reminders
+	reminders []*Reminder
+	notified  map[uuid.UUID]NotifyStatus
+	upserted  *Settings
+	patients  []PatientAdherence
+}
+
+func (f *fakeRepository) GetSettings(context.Context, uuid.UUID) (*Settings, error) {
+	s := f.settings
+	return &s, nil
+}
+
+func (f *fakeRepository) UpsertSettings(_ context.Context, s *Settings, _ uuid.UUID) error {
+	f.upserted = s
+	return nil
+}
+
+func (f *fakeRepository) ResolveConversions(context.Context, uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeRepository) MarkMissed(context.Context, uuid.UUID, time.Time) (int, []uuid.UUID, error) {
+	return len(f.drafts), f.drafts, nil
+}
+
+func (f *fakeRepository) ListDueRefills(context.Context, uuid.UUID, time.Time, time.Time) ([]refillCandidate, error) {
+	return f.due, nil
+}
+
+func (f *fakeRepository) InsertReminder(_ context.Context, _ uuid.UUID, r *Reminder) (bool, error) {
+	if f.claimed[r.SaleID] {
+		return false, nil
+	}
+	f.reminders = append(f.reminders, r)
+	return true, nil
+}
+
+func (f *fakeRepository) UpdateNotify(_ context.Context, id uuid.UUID, status NotifyStatus, _ string, _ time.Time) error {
+	if f.notified == nil {
+		f.notified = make(map[uuid.UUID]NotifyStatus)
+	}
+	f.notified[id] = status
+	return nil
+}
+
+func (f *fakeRepository) PatientAdherence(context.Context, uuid.UUID, time.Time, time.Time) ([]PatientAdherence, error) {
+	return f.patients, nil
+}
+
+func (f *fakeRepository) MedicineAdherence(context.Context, uuid.UUID, time.Time, time.Time) ([]MedicineAdherence, error) {
+	return nil, nil
+}
+
+// fakeChannel records messages and fails for patients without a phone
+type fakeChannel struct {
+	name string
+	sent []string
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Send(_ context.Context, r *Reminder, message string) error {
+	if r.PatientPhone == "" {
+		return errors.New("patient has no phone number")
+	}
+	c.sent = append(c.sent, message)
+	return nil
+}
+
+// fakeSales records the drafts discarded by the run
+type fakeSales struct {
+	sales.Service
+	discarded []uuid.UUID
+}
+
+func (f *fakeSales) DiscardDraft(_ context.Context, _, saleID uuid.UUID) error {
+	f.discarded = append(f.discarded, saleID)
+	return nil
+}
+
+func TestRenderMessage(t *testing.T) {
+	rem := &Reminder{
+		PatientName: "Asha",
+		Medicines:   []string{"Metformin 500", "Telma 40"},
+		RefillDate:  time.Date(2025, time.March, 7, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{DefaultMessageTemplate, "Hi Asha, your refill of Metformin 500, Telma 40 is due on 07 Mar 2025. Reply or visit us to have it ready."},
+		{"{patient}: {date}", "Asha: 07 Mar 2025"},
+		{"No placeholders", "No placeholders"},
+	}
+
+	for _, tt := range tests {
+		if got := renderMessage(tt.template, rem); got != tt.want {
+			t.Errorf("renderMessage(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateSettingsChannel(t *testing.T) {
+	tests := []struct {
+		channel string
+		want    string
+		wantErr bool
+	}{
+		{"", "SMS", false},
+		{"sms", "SMS", false},
+		{"none", ChannelNone, false},
+		{"WHATSAPP", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			repo := &fakeRepository{settings: Settings{Channel: "SMS"}}
+			svc := NewService(repo, nil, &fakeChannel{name: "SMS"})
+
+			got, err := svc.UpdateSettings(context.Background(), uuid.New(), uuid.New(), "Owner", UpdateSettingsRequest{Channel: tt.channel})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if repo.upserted != nil {
+					t.Error("settings saved with an unknown channel")
+				}
+				return
+			}
+			if got.Channel != tt.want {
+				t.Errorf("channel = %q, want %q", got.Channel, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannels(t *testing.T) {
+	svc := NewService(&fakeRepository{}, nil, &fakeChannel{name: "WHATSAPP"}, &fakeChannel{name: "SMS"})
+	if got, want := svc.Channels(), []string{"NONE", "SMS", "WHATSAPP"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Channels() = %v, want %v", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	items := []RefillItem{{ProductID: uuid.New(), MedicineName: "Metformin 500", Quantity: 30}}
+	withPhone := refillCandidate{SaleID: uuid.New(), PatientName: "Asha", PatientPhone: "9800000001", Items: items}
+	noPhone := refillCandidate{SaleID: uuid.New(), PatientName: "Ravi", Items: items}
+	noItems := refillCandidate{SaleID: uuid.New(), PatientName: "Meena", PatientPhone: "9800000002"}
+	leftDraft := uuid.New()
+
+	tests := []struct {
+		name          string
+		settings      Settings
+		due           []refillCandidate
+		claimed       map[uuid.UUID]bool
+		wantSummary   RunSummary
+		wantSent      int
+		wantNotified  []NotifyStatus
+		wantDiscarded []uuid.UUID
+	}{
+		{
+			name:          "disabled still closes out missed reminders",
+			settings:      Settings{Enabled: false, Channel: "SMS"},
+			due:           []refillCandidate{withPhone},
+			wantSummary:   RunSummary{Missed: 1},
+			wantDiscarded: []uuid.UUID{leftDraft},
+		},
+		{
+			name:          "sent and failed sends are both recorded",
+			settings:      Settings{Enabled: true, Channel: "SMS"},
+			due:           []refillCandidate{withPhone, noPhone, noItems},
+			wantSummary:   RunSummary{Missed: 1, Reminded: 2, NotifyFailed: 1},
+			wantSent:      1,
+			wantNotified:  []NotifyStatus{NotifySent, NotifyFailed},
+			wantDiscarded: []uuid.UUID{leftDraft},
+		},
+		{
+			name:          "tracking only",
+			settings:      Settings{Enabled: true, Channel: ChannelNone},
+			due:           []refillCandidate{withPhone},
+			wantSummary:   RunSummary{Missed: 1, Reminded: 1},
+			wantNotified:  []NotifyStatus{NotifySkipped},
+			wantDiscarded: []uuid.UUID{leftDraft},
+		},
+		{
+			name:          "sale already reminded by an overlapping run",
+			settings:      Settings{Enabled: true, Channel: "SMS"},
+			due:           []refillCandidate{withPhone},
+			claimed:       map[uuid.UUID]bool{withPhone.SaleID: true},
+			wantSummary:   RunSummary{Missed: 1},
+			wantDiscarded: []uuid.UUID{leftDraft},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{settings: tt.settings, due: tt.due, claimed: tt.claimed, drafts: []uuid.UUID{leftDraft}}
+			sms := &fakeChannel{name: "SMS"}
+			salesSvc := &fakeSales{}
+			svc := NewService(repo, salesSvc, sms)
+
+			pharmacyID := uuid.New()
+			summary, err := svc.Run(context.Background(), pharmacyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.wantSummary.PharmacyID = pharmacyID
+			if *summary != tt.wantSummary {
+				t.Errorf("summary = %+v, want %+v", *summary, tt.wantSummary)
+			}
+			if len(sms.sent) != tt.wantSent {
+				t.Errorf("sent %d messages, want %d", len(sms.sent), tt.wantSent)
+			}
+			var notified []NotifyStatus
+			for _, r := range repo.reminders {
+				notified = append(notified, repo.notified[r.ID])
+			}
+			if !reflect.DeepEqual(notified, tt.wantNotified) {
+				t.Errorf("notify statuses = %v, want %v", notified, tt.wantNotified)
+			}
+			if !reflect.DeepEqual(salesSvc.discarded, tt.wantDiscarded) {
+				t.Errorf("discarded drafts = %v, want %v", salesSvc.discarded, tt.wantDiscarded)
+			}
+		})
+	}
+}
+
+func TestGetAdherence(t *testing.T) {
+	tests := []struct {
+		name     string
+		patients []PatientAdherence
+		want     AdherenceCounts
+	}{
+		{"no reminders", nil, AdherenceCounts{}},
+		{
+			name: "late and early refills averaged over conversions",
+			patients: []PatientAdherence{
+				{AdherenceCounts: AdherenceCounts{Reminders: 4, Converted: 2, Missed: 1, Pending: 1, AvgDaysLate: 3}},
+				{AdherenceCounts: AdherenceCounts{Reminders: 2, Converted: 1, Missed: 1, AvgDaysLate: -2}},
+			},
+			want: AdherenceCounts{Reminders: 6, Converted: 3, Missed: 2, Pending: 1, ConversionRate: 60, AvgDaysLate: 1.33},
+		},
+		{
+			name: "only pending reminders",
+			patients: []PatientAdherence{
+				{AdherenceCounts: AdherenceCounts{Reminders: 3, Pending: 3}},
+			},
+			want: AdherenceCounts{Reminders: 3, Pending: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(&fakeRepository{patients: tt.patients}, nil)
+			report, err := svc.GetAdherence(context.Background(), uuid.New(), time.Now().AddDate(0, -1, 0), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Totals != tt.want {
+				t.Errorf("totals = %+v, want %+v", report.Totals, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package sales
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/gst"
+	"organization-service/internal/pharmacy/safety"
 	"organization-service/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -107,9 +112,20 @@ func (h *Handler) AddItem(c *gin.Context) {
 		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	if req.ProductID == uuid.Nil && req.Barcode == "" {
+		h.respondError(c, http.StatusBadRequest, "product_id or barcode is required")
+		return
+	}
+
+	_, req.OverrideBy, _ = middleware.GetUserInfo(c.Request.Context())
 
 	items, err := h.svc.AddItemToDraft(c.Request.Context(), pharmacyID, saleID, req)
 	if err != nil {
+		var overrideErr *safety.OverrideRequiredError
+		if errors.As(err, &overrideErr) {
+			safety.RespondOverrideRequired(c, overrideErr)
+			return
+		}
 		h.respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -181,8 +197,17 @@ func (h *Handler) FinalizeSale(c *gin.Context) {
 		return
 	}
 
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	req.DispensedBy, _ = uuid.Parse(userIDStr)
+	req.DispensedByName = userName
+
 	sale, err2 := h.svc.FinalizeSale(c.Request.Context(), pharmacyID, saleID, req)
 	if err2 != nil {
+		var reqErr *compliance.RequirementsError
+		if errors.As(err2, &reqErr) {
+			compliance.RespondRequirementsNotMet(c, reqErr)
+			return
+		}
 		h.respondError(c, http.StatusInternalServerError, err2.Error())
 		return
 	}
@@ -190,6 +215,173 @@ func (h *Handler) FinalizeSale(c *gin.Context) {
 	h.respondJSON(c, http.StatusOK, sale)
 }
 
+// GetCompliance reports the prescription, register and sign-off requirements for the sale
+func (h *Handler) GetCompliance(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "invalid sale id")
+		return
+	}
+
+	requirements, err := h.svc.GetCompliance(c.Request.Context(), pharmacyID, saleID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, requirements)
+}
+
+// SetPrescriber links the prescription and prescriber details required for Rx-only items
+func (h *Handler) SetPrescriber(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "invalid sale id")
+		return
+	}
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user context")
+		return
+	}
+
+	var req compliance.SetPrescriberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	details, err := h.svc.SetPrescriber(c.Request.Context(), pharmacyID, saleID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, details)
+}
+
+// SignOff records the calling pharmacist's sign-off; Schedule X sales need two different pharmacists
+func (h *Handler) SignOff(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "invalid sale id")
+		return
+	}
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid user context")
+		return
+	}
+
+	signOffs, err := h.svc.SignOff(c.Request.Context(), pharmacyID, saleID, userID, userName)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, signOffs)
+}
+
+// ListParkedBills lists unfinished drafts, most recently touched first;
+// ?include_abandoned=true also returns drafts whose stock holds lapsed
+func (h *Handler) ListParkedBills(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	limit := 25
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := strconv.Atoi(o); err == nil {
+			offset = val
+		}
+	}
+	includeAbandoned := c.Query("include_abandoned") == "true"
+
+	bills, total, err := h.svc.ListParkedBills(c.Request.Context(), pharmacyID, includeAbandoned, limit, offset)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    bills,
+		"meta": gin.H{
+			"total":  total,
+			"limit":  limit,
+			"offset": offset,
+		},
+	})
+}
+
+func (h *Handler) ResumeDraft(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	saleID, _ := uuid.Parse(c.Param("id"))
+
+	result, err := h.svc.ResumeDraft(c.Request.Context(), pharmacyID, saleID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, result)
+}
+
+func (h *Handler) DiscardDraft(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	saleID, _ := uuid.Parse(c.Param("id"))
+
+	if err := h.svc.DiscardDraft(c.Request.Context(), pharmacyID, saleID); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, gin.H{"message": "draft discarded"})
+}
+
 func (h *Handler) DispatchSale(c *gin.Context) {
 	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
 	pharmacyID, err := uuid.Parse(pharmacyIDStr)
@@ -375,6 +567,154 @@ func (h *Handler) GetPatientReturns(c *gin.Context) {
 	})
 }
 
+// GetWalletStatement returns the patient's wallet ledger, optionally limited to ?from=&to= (YYYY-MM-DD)
+func (h *Handler) GetWalletStatement(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	from, err := parseDateQuery(c, "from")
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseDateQuery(c, "to")
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statement, err := h.svc.GetWalletStatement(c.Request.Context(), pharmacyID, patientID, from, to)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, statement)
+}
+
+func parseDateQuery(c *gin.Context, key string) (*time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format", key)
+	}
+	return &t, nil
+}
+
+func (h *Handler) CollectDue(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var req CollectDueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, _ := uuid.Parse(userIDStr)
+
+	receipt, err := h.svc.CollectDue(c.Request.Context(), pharmacyID, patientID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, receipt)
+}
+
+func (h *Handler) AdjustWallet(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var req WalletAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userIDStr, userName, _ := middleware.GetUserInfo(c.Request.Context())
+	userID, _ := uuid.Parse(userIDStr)
+
+	entry, err := h.svc.AdjustWallet(c.Request.Context(), pharmacyID, patientID, userID, userName, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusCreated, entry)
+}
+
+func (h *Handler) SetCreditLimit(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var req SetCreditLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	patient, err := h.svc.SetCreditLimit(c.Request.Context(), pharmacyID, patientID, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, patient)
+}
+
 func (h *Handler) GetStats(c *gin.Context) {
 	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
 	pharmacyID, err := uuid.Parse(pharmacyIDStr)
@@ -431,6 +771,33 @@ func (h *Handler) GetStats(c *gin.Context) {
 	h.respondJSON(c, http.StatusOK, stats)
 }
 
+// GetDayCollection is the day-end cash-up: what was taken in each payment mode, change handed back and the cash expected in the drawer
+func (h *Handler) GetDayCollection(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	date := time.Now()
+	if dateStr := c.Query("date"); dateStr != "" {
+		date, err = time.ParseInLocation("2006-01-02", dateStr, time.Local)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "date must be YYYY-MM-DD")
+			return
+		}
+	}
+
+	collection, err := h.svc.GetDayCollection(c.Request.Context(), pharmacyID, date)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, collection)
+}
+
 func (h *Handler) ProcessReturn(c *gin.Context) {
 	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
 	pharmacyID, err := uuid.Parse(pharmacyIDStr)
@@ -496,6 +863,78 @@ func (h *Handler) GetReturn(c *gin.Context) {
 	h.respondJSON(c, http.StatusOK, ret)
 }
 
+// GetTaxInvoice returns the GST tax invoice of a completed sale with its HSN-wise summary
+func (h *Handler) GetTaxInvoice(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "invalid sale id")
+		return
+	}
+
+	doc, err := h.svc.GetTaxInvoice(c.Request.Context(), pharmacyID, saleID)
+	if errors.Is(err, gst.ErrDocumentNotFound) {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, doc)
+}
+
+// GetCreditNote returns the GST credit note issued for a sales return
+func (h *Handler) GetCreditNote(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+	returnID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	doc, err := h.svc.GetCreditNote(c.Request.Context(), pharmacyID, returnID)
+	if errors.Is(err, gst.ErrDocumentNotFound) {
+		h.respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, doc)
+}
+
+// BackfillTaxDocuments issues the tax invoices and credit notes missing for sales and returns made before invoicing
+func (h *Handler) BackfillTaxDocuments(c *gin.Context) {
+	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
+	pharmacyID, err := uuid.Parse(pharmacyIDStr)
+	if err != nil {
+		h.respondError(c, http.StatusUnauthorized, "invalid pharmacy context")
+		return
+	}
+
+	result, err := h.svc.BackfillTaxDocuments(c.Request.Context(), pharmacyID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(c, http.StatusOK, result)
+}
+
 func (h *Handler) GetPatientStats(c *gin.Context) {
 	pharmacyIDStr := middleware.GetPharmacyInfo(c.Request.Context())
 	pharmacyID, err := uuid.Parse(pharmacyIDStr)
@@ -1,7 +1,11 @@
 package sales
 
 import (
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/safety"
 	"organization-service/internal/pharmacy/sales/clients"
+	"organization-service/internal/pharmacy/sales/loyalty"
+	"organization-service/internal/pharmacy/sales/promotions"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +19,8 @@ const (
 	StatusCompleted  SaleStatus = "COMPLETED"
 	StatusCancelled  SaleStatus = "CANCELLED"
 	StatusDispatched SaleStatus = "DISPATCHED"
+	// StatusAbandoned marks a draft whose stock holds all lapsed; it can be resumed or discarded
+	StatusAbandoned SaleStatus = "ABANDONED"
 )
 
 type SaleType string
@@ -32,11 +38,15 @@ type Patient struct {
 	Gender       string    `json:"gender"`
 	Age          int       `json:"age"`
 	Address      string    `json:"address,omitempty"`
+	Allergies    string    `json:"allergies,omitempty"`
 	IsRecurring  bool      `json:"is_recurring"`
 	DueAmount    float64   `json:"due_amount"`
 	CreditAmount float64   `json:"credit_amount"`
+	CreditLimit  *float64  `json:"credit_limit,omitempty"` // Most the patient may owe; nil when no limit is set
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	Loyalty *loyalty.MemberSummary `json:"loyalty,omitempty"` // Points and tier, on single-patient lookups
 }
 
 type Sale struct {
@@ -63,6 +73,7 @@ type Sale struct {
 	GeneratedCredit     float64                   `json:"generated_credit"`
 	GeneratedDue        float64                   `json:"generated_due"`
 	InvoiceNumber       string                    `json:"invoice_number,omitempty"`
+	CompletedAt         *time.Time                `json:"completed_at,omitempty"`
 	CreatedAt           time.Time                 `json:"created_at"`
 	UpdatedAt           time.Time                 `json:"updated_at"`
 	Prescription        *clients.PrescriptionData `json:"prescription,omitempty"`
@@ -72,32 +83,53 @@ type Sale struct {
 	PatientDueAmount    float64                   `json:"patient_due_amount"`
 	PatientCreditAmount float64                   `json:"patient_credit_amount"`
 	CollectedAmount     float64                   `json:"collected_amount"`
+	ChangeGiven         float64                   `json:"change_given,omitempty"`
+	Payments            []Payment                 `json:"payments,omitempty"`
+	LoyaltyPoints       *loyalty.SalePoints       `json:"loyalty_points,omitempty"`
+	Promotions          []AppliedPromotion        `json:"promotions,omitempty"`
+	Compliance          *compliance.Requirements  `json:"compliance,omitempty"`
 }
 
 type SaleItem struct {
-	ID                 uuid.UUID `json:"id"`
-	SaleID             uuid.UUID `json:"sale_id"`
-	ProductID          uuid.UUID `json:"product_id"`
-	MedicineName       string    `json:"medicine_name"`
-	MedicineBrand      string    `json:"medicine_brand"`
-	BatchID            uuid.UUID `json:"batch_id"`
-	BatchNo            string    `json:"batch_no,omitempty"`
-	Quantity           int       `json:"quantity"`
-	AvailableStock     int       `json:"available_stock,omitempty"`
-	ExpiryDate         time.Time `json:"expiry_date,omitempty"`
-	MRP                float64   `json:"mrp"`
-	Price              float64   `json:"unit_price"` // This is the Unit Price from Batch
-	DiscountPercentage float64   `json:"discount_percentage"`
-	TaxPercentage      float64   `json:"tax_percentage"`
-	Subtotal           float64   `json:"subtotal"`
-	RetailDiscPerc     float64   `json:"retail_disc_perc"`
-	StaffDiscPerc      float64   `json:"staff_disc_perc"`
-	SpecialDiscPerc    float64   `json:"special_disc_perc"`
-	MaxDiscPerc        float64   `json:"max_disc_perc"`
-	ReservationID      string    `json:"reservation_id"`
-	RackNo             string    `json:"rack_no"`
-	ReturnedQuantity   int       `json:"returned_quantity"`
-	CreatedAt          time.Time `json:"created_at"`
+	ID                 uuid.UUID        `json:"id"`
+	SaleID             uuid.UUID        `json:"sale_id"`
+	ProductID          uuid.UUID        `json:"product_id"`
+	MedicineName       string           `json:"medicine_name"`
+	MedicineBrand      string           `json:"medicine_brand"`
+	BatchID            uuid.UUID        `json:"batch_id"`
+	BatchNo            string           `json:"batch_no,omitempty"`
+	Quantity           int              `json:"quantity"`
+	AvailableStock     int              `json:"available_stock,omitempty"`
+	ExpiryDate         time.Time        `json:"expiry_date,omitempty"`
+	MRP                float64          `json:"mrp"`
+	Price              float64          `json:"unit_price"` // This is the Unit Price from Batch
+	DiscountPercentage float64          `json:"discount_percentage"`
+	PromoDiscPerc      float64          `json:"promo_disc_perc,omitempty"` // Part of DiscountPercentage given by promotions
+	TaxPercentage      float64          `json:"tax_percentage"`
+	Subtotal           float64          `json:"subtotal"`
+	IsFree             bool             `json:"is_free,omitempty"` // Free units of a free quantity scheme
+	PromotionID        *uuid.UUID       `json:"promotion_id,omitempty"`
+	RetailDiscPerc     float64          `json:"retail_disc_perc"`
+	StaffDiscPerc      float64          `json:"staff_disc_perc"`
+	SpecialDiscPerc    float64          `json:"special_disc_perc"`
+	MaxDiscPerc        float64          `json:"max_disc_perc"`
+	ReservationID      string           `json:"reservation_id"`
+	RackNo             string           `json:"rack_no"`
+	ReturnedQuantity   int              `json:"returned_quantity"`
+	CreatedAt          time.Time        `json:"created_at"`
+	SafetyWarnings     []safety.Warning `json:"safety_warnings,omitempty"`
+	OverrideReason     string           `json:"override_reason,omitempty"`
+	OverrideBy         string           `json:"override_by,omitempty"`
+}
+
+// AppliedPromotion is what one promotion gave on a bill
+type AppliedPromotion struct {
+	PromotionID  uuid.UUID                `json:"promotion_id"`
+	Name         string                   `json:"name"`
+	Type         promotions.PromotionType `json:"type"`
+	Discount     float64                  `json:"discount"`
+	FreeQuantity int                      `json:"free_quantity,omitempty"`
+	Note         string                   `json:"note,omitempty"`
 }
 
 type PaymentMode string
@@ -107,6 +139,8 @@ const (
 	PayModeUPI    PaymentMode = "UPI"
 	PayModeCard   PaymentMode = "CARD"
 	PayModeCredit PaymentMode = "CREDIT"
+	// PayModeLoyalty is the part of a bill paid with loyalty points, at the pharmacy's point value
+	PayModeLoyalty PaymentMode = "LOYALTY"
 )
 
 type TransactionType string
@@ -122,10 +156,21 @@ type Payment struct {
 	ReturnID        *uuid.UUID      `json:"return_id,omitempty"`
 	TransactionType TransactionType `json:"transaction_type"`
 	Mode            PaymentMode     `json:"mode"`
-	Amount          float64         `json:"amount"`
+	Amount          float64         `json:"amount"` // Amount applied to the bill
+	Reference       string          `json:"reference,omitempty"`
+	Tendered        float64         `json:"tendered,omitempty"` // Cash handed over, when more than Amount
+	Change          float64         `json:"change,omitempty"`
 	CreatedAt       time.Time       `json:"created_at"`
 }
 
+// Tender is one part of a split payment. CREDIT puts that part on the patient's account
+// as due; LOYALTY pays that amount with the patient's points
+type Tender struct {
+	Mode      PaymentMode `json:"mode" validate:"required,oneof=CASH UPI CARD CREDIT LOYALTY"`
+	Amount    float64     `json:"amount" validate:"required,gt=0"`
+	Reference string      `json:"reference,omitempty" validate:"omitempty,max=100"` // UPI transaction id or card last 4
+}
+
 type SaleReturnStatus string
 
 const (
@@ -184,9 +229,15 @@ type CreateDraftRequest struct {
 	PrescriptionID string   `json:"prescription_id" validate:"required"`
 }
 
+// AddItemRequest adds a product FEFO-style, or a specific batch when a
+// pharmacy batch label is scanned into Barcode
 type AddItemRequest struct {
-	ProductID uuid.UUID `json:"product_id" validate:"required"`
-	Quantity  int       `json:"quantity" validate:"required,min=1"`
+	ProductID      uuid.UUID `json:"product_id" validate:"required_without=Barcode"`
+	Barcode        string    `json:"barcode"`
+	BatchID        uuid.UUID `json:"batch_id"`
+	Quantity       int       `json:"quantity" validate:"required,min=1"`
+	OverrideReason string    `json:"override_reason"` // Required to dispense despite MAJOR safety warnings
+	OverrideBy     string    `json:"-"`
 }
 
 type UpdateItemRequest struct {
@@ -194,24 +245,60 @@ type UpdateItemRequest struct {
 	DiscountPercentage *float64 `json:"discount_percentage,omitempty"`
 }
 
+// FinalizeSaleRequest settles a bill either with Tenders (split payment) or,
+// for older clients, a single PaymentMode
 type FinalizeSaleRequest struct {
-	PaymentMode  PaymentMode `json:"payment_mode" validate:"required,oneof=CASH UPI CARD"`
-	AmountPaid   float64     `json:"amount_paid" validate:"required,min=0"`
+	PaymentMode  PaymentMode `json:"payment_mode" validate:"required_without=Tenders,omitempty,oneof=CASH UPI CARD"`
+	AmountPaid   float64     `json:"amount_paid" validate:"min=0"`
+	Tenders      []Tender    `json:"tenders,omitempty" validate:"omitempty,max=6,dive"`
 	IsRecurring  bool        `json:"is_recurring"`
 	DaysSupply   int         `json:"days_supply"`
 	WalletAction string      `json:"wallet_action,omitempty"`
 	WalletAmount float64     `json:"wallet_amount,omitempty"`
+	// BuyerGSTIN makes the sale a B2B supply; PlaceOfSupply is the buyer's state code when it differs from the pharmacy's
+	BuyerGSTIN    string `json:"buyer_gstin,omitempty" validate:"omitempty,len=15,alphanum"`
+	PlaceOfSupply string `json:"place_of_supply,omitempty" validate:"omitempty,len=2,numeric"`
+	// DispensedBy/DispensedByName identify the pharmacist for the controlled drug register
+	DispensedBy     uuid.UUID `json:"-"`
+	DispensedByName string    `json:"-"`
+	// BillOnly settles the bill on its own and leaves the patient's wallet balance
+	// as it is, for bills taken at a counter that could not see the wallet
+	BillOnly bool `json:"-"`
 }
 
 type SalesStats struct {
-	DailySales        float64   `json:"daily_sales"`
-	SalesVolume       int       `json:"sales_volume"`
-	NewPatients       int       `json:"new_patients"`
-	TotalPatients     int       `json:"total_patients"`
-	RecurringPatients int       `json:"recurring_patients"`
-	RecurringSales    float64   `json:"recurring_sales"`
-	TrendAmounts      []float64 `json:"trend_amounts"`
-	TrendDates        []string  `json:"trend_dates"`
+	DailySales        float64     `json:"daily_sales"`
+	SalesVolume       int         `json:"sales_volume"`
+	NewPatients       int         `json:"new_patients"`
+	TotalPatients     int         `json:"total_patients"`
+	RecurringPatients int         `json:"recurring_patients"`
+	RecurringSales    float64     `json:"recurring_sales"`
+	TrendAmounts      []float64   `json:"trend_amounts"`
+	TrendDates        []string    `json:"trend_dates"`
+	PaymentSplit      []ModeTotal `json:"payment_split"`
+}
+
+// ModeTotal is what came in (and went back out as refunds) through one payment mode
+type ModeTotal struct {
+	Mode     PaymentMode `json:"mode"`
+	Count    int         `json:"count"`
+	Received float64     `json:"received"`
+	Refunded float64     `json:"refunded"`
+	Net      float64     `json:"net"`
+}
+
+// DayCollection is the day-end counter summary: what each mode should hold
+type DayCollection struct {
+	Date           string      `json:"date"`
+	SalesCount     int         `json:"sales_count"`
+	SalesTotal     float64     `json:"sales_total"`
+	Modes          []ModeTotal `json:"modes"`
+	ChangeGiven    float64     `json:"change_given"`
+	CashInDrawer   float64     `json:"cash_in_drawer"`  // Net cash after refunds
+	Collected      float64     `json:"collected"`       // Net of all modes except CREDIT and LOYALTY
+	OnAccount      float64     `json:"on_account"`      // Billed to patient accounts (CREDIT tenders)
+	DueCollected   float64     `json:"due_collected"`   // Patient dues paid at the counter, already in Modes
+	PointsRedeemed float64     `json:"points_redeemed"` // Paid with loyalty points (LOYALTY tenders)
 }
 type PatientStats struct {
 	TotalPatients     int `json:"total_patients"`
@@ -237,3 +324,104 @@ type RecurringRefillReportItem struct {
 	NextRefillDate *time.Time `json:"next_refill_date"`
 }
 
+// TaxBackfill counts the tax documents issued for sales and returns made before invoicing
+type TaxBackfill struct {
+	InvoicesIssued    int `json:"invoices_issued"`
+	CreditNotesIssued int `json:"credit_notes_issued"`
+}
+
+// ParkedBill is an unfinished draft a cashier can pick back up
+type ParkedBill struct {
+	SaleID         uuid.UUID  `json:"sale_id"`
+	SaleType       SaleType   `json:"sale_type"`
+	PrescriptionID string     `json:"prescription_id,omitempty"`
+	CustomerName   string     `json:"customer_name"`
+	CustomerPhone  string     `json:"customer_phone"`
+	Status         SaleStatus `json:"status"`
+	ItemCount      int        `json:"item_count"`
+	TotalAmount    float64    `json:"total_amount"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActivityAt time.Time  `json:"last_activity_at"`
+	HoldExpiresAt  *time.Time `json:"hold_expires_at,omitempty"` // Earliest live stock hold; nil once all have lapsed
+}
+
+// ResumeResult is a resumed draft plus any lines whose stock could not be held again
+type ResumeResult struct {
+	Sale         *Sale      `json:"sale"`
+	DroppedItems []SaleItem `json:"dropped_items"`
+}
+
+// WalletEntryType identifies what moved a patient's wallet balance
+type WalletEntryType string
+
+const (
+	WalletOpening        WalletEntryType = "OPENING_BALANCE"
+	WalletSaleDue        WalletEntryType = "SALE_DUE"        // Part of a bill left unpaid
+	WalletDueSettled     WalletEntryType = "DUE_SETTLED"     // Earlier due paid as part of a later bill
+	WalletSaleCredit     WalletEntryType = "SALE_CREDIT"     // Overpayment kept as store credit
+	WalletCreditRedeemed WalletEntryType = "CREDIT_REDEEMED" // Store credit spent on a bill
+	WalletReturnCredit   WalletEntryType = "RETURN_CREDIT"
+	WalletDuePayment     WalletEntryType = "DUE_PAYMENT" // Due collected at the counter without a bill
+	WalletAdjustment     WalletEntryType = "ADJUSTMENT"
+)
+
+// WalletEntry is one line of a patient's wallet ledger. Debit increases what
+// the patient owes the pharmacy, credit reduces it; a negative balance is
+// store credit held for the patient.
+type WalletEntry struct {
+	ID               uuid.UUID       `json:"id"`
+	PharmacyID       uuid.UUID       `json:"-"`
+	PatientID        uuid.UUID       `json:"patient_id"`
+	Date             time.Time       `json:"date"`
+	Type             WalletEntryType `json:"type"`
+	Debit            float64         `json:"debit"`
+	Credit           float64         `json:"credit"`
+	Balance          float64         `json:"balance"`
+	SaleID           *uuid.UUID      `json:"sale_id,omitempty"`
+	ReturnID         *uuid.UUID      `json:"return_id,omitempty"`
+	ReferenceNo      string          `json:"reference_no,omitempty"`
+	PaymentMode      PaymentMode     `json:"payment_mode,omitempty"`
+	PaymentReference string          `json:"payment_reference,omitempty"`
+	Reason           string          `json:"reason,omitempty"`
+	CreatedBy        *uuid.UUID      `json:"created_by,omitempty"`
+	CreatedByName    string          `json:"created_by_name,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type WalletStatement struct {
+	PatientID      uuid.UUID     `json:"patient_id"`
+	PatientName    string        `json:"patient_name"`
+	PatientPhone   string        `json:"patient_phone"`
+	From           *time.Time    `json:"from,omitempty"`
+	To             *time.Time    `json:"to,omitempty"`
+	BroughtForward float64       `json:"brought_forward"`
+	TotalDebit     float64       `json:"total_debit"`
+	TotalCredit    float64       `json:"total_credit"`
+	ClosingBalance float64       `json:"closing_balance"`
+	DueAmount      float64       `json:"due_amount"`
+	CreditAmount   float64       `json:"credit_amount"`
+	CreditLimit    *float64      `json:"credit_limit,omitempty"`
+	Entries        []WalletEntry `json:"entries"`
+}
+
+// CollectDueRequest records a payment against a patient's dues outside a bill;
+// anything paid beyond the dues is kept as store credit
+type CollectDueRequest struct {
+	Amount      float64     `json:"amount" validate:"required,gt=0"`
+	PaymentMode PaymentMode `json:"payment_mode" validate:"required,oneof=CASH UPI CARD"`
+	Reference   string      `json:"reference" validate:"max=100"`
+	Notes       string      `json:"notes" validate:"max=500"`
+}
+
+// WalletAdjustmentRequest corrects a balance by hand: DUE adds to what the
+// patient owes, CREDIT reduces it
+type WalletAdjustmentRequest struct {
+	Direction string  `json:"direction" validate:"required,oneof=DUE CREDIT"`
+	Amount    float64 `json:"amount" validate:"required,gt=0"`
+	Reason    string  `json:"reason" validate:"required,max=500"`
+}
+
+// SetCreditLimitRequest sets how much a patient may owe; null removes the limit
+type SetCreditLimitRequest struct {
+	CreditLimit *float64 `json:"credit_limit" validate:"omitempty,gte=0"`
+}
@@ -3,31 +3,46 @@ package sales
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"organization-service/internal/pharmacy/numbering"
+	"organization-service/internal/pharmacy/safety"
+
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Repository interface {
 	CreateSale(ctx context.Context, s *Sale) error
 	GetSaleByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Sale, error)
-	UpdateSale(ctx context.Context, s *Sale) error
+	UpdateSale(ctx context.Context, tx *sql.Tx, s *Sale) error
+	// LockSale locks the sale row inside tx and returns its current status
+	LockSale(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID) (SaleStatus, error)
+	BeginTx(ctx context.Context) (*sql.Tx, error)
 	GetLatestSaleByPrescriptionID(ctx context.Context, pharmacyID uuid.UUID, rxID string) (*Sale, error)
 
 	AddItem(ctx context.Context, item *SaleItem) error
 	GetItemByID(ctx context.Context, itemID uuid.UUID) (*SaleItem, error)
 	GetItemsBySaleID(ctx context.Context, saleID uuid.UUID) ([]SaleItem, error)
+	// GetItemsBySaleIDTx reads the sale's items inside tx, after LockSale
+	GetItemsBySaleIDTx(ctx context.Context, tx *sql.Tx, saleID uuid.UUID) ([]SaleItem, error)
 	UpdateItem(ctx context.Context, item *SaleItem) error
 	DeleteItem(ctx context.Context, itemID uuid.UUID) error
 
-	AddPayment(ctx context.Context, p *Payment) error
+	AddPayment(ctx context.Context, tx *sql.Tx, p *Payment) error
 	GetPaymentsBySaleID(ctx context.Context, saleID uuid.UUID) ([]Payment, error)
 
 	UpsertPatient(ctx context.Context, p *Patient) error
 	GetPatient(ctx context.Context, pharmacyID uuid.UUID, phone, name string) (*Patient, error)
-	UpdatePatientWallet(ctx context.Context, pharmacyID, patientID uuid.UUID, action string, amount float64) error
-	ClearPatientBalances(ctx context.Context, pharmacyID, patientID uuid.UUID) error
+	// AddWalletEntries appends ledger lines and refreshes the patient's due/credit from the ledger
+	AddWalletEntries(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID, entries []WalletEntry) error
+	// LockPatientWallet locks the patient row and returns the wallet balance (positive when owed) and credit limit
+	LockPatientWallet(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID) (float64, *float64, error)
+	ListWalletEntries(ctx context.Context, pharmacyID, patientID uuid.UUID) ([]WalletEntry, error)
+	NextReceiptNumber(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, at time.Time) (string, error)
+	SetPatientCreditLimit(ctx context.Context, pharmacyID, patientID uuid.UUID, limit *float64) error
 	GetPatientByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Patient, error)
 	SearchPatientsByPhone(ctx context.Context, pharmacyID uuid.UUID, phone string) ([]Patient, error)
 	ListPatients(ctx context.Context, pharmacyID uuid.UUID, limit, offset int, search string) ([]Patient, int, error)
@@ -36,7 +51,9 @@ type Repository interface {
 
 	GetStats(ctx context.Context, pharmacyID uuid.UUID, targetDate, startDate, endDate time.Time, granularity string) (*SalesStats, error)
 
-	CreateReturn(ctx context.Context, ret *SaleReturn, items []SaleReturnItem) error
+	// CreateReturn saves the return, numbering it from the credit note series when it has no number.
+	// With tx the return commits with the caller's transaction, otherwise on its own.
+	CreateReturn(ctx context.Context, tx *sql.Tx, ret *SaleReturn, items []SaleReturnItem) error
 	GetReturnByID(ctx context.Context, pharmacyID, id uuid.UUID) (*SaleReturn, error)
 	ListReturns(ctx context.Context, pharmacyID uuid.UUID) ([]SaleReturn, error)
 	GetReturnsBySaleID(ctx context.Context, pharmacyID, saleID uuid.UUID) ([]SaleReturn, error)
@@ -44,6 +61,19 @@ type Repository interface {
 	GetPatientStats(ctx context.Context, pharmacyID uuid.UUID) (*PatientStats, error)
 	ListSales(ctx context.Context, pharmacyID uuid.UUID, limit, offset int, startDate, endDate time.Time, paymentMode, search string) ([]Sale, int, error)
 	GetRecurringRefillsReport(ctx context.Context, pharmacyID uuid.UUID) ([]RecurringRefillReportItem, error)
+	GetDayCollection(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*DayCollection, error)
+
+	ListParkedBills(ctx context.Context, pharmacyID uuid.UUID, statuses []SaleStatus, limit, offset int) ([]ParkedBill, int, error)
+	UpdateItemReservation(ctx context.Context, itemID uuid.UUID, reservationID string) error
+	// ReplaceSalePromotions swaps the promotions itemised on a draft for the latest evaluation
+	ReplaceSalePromotions(ctx context.Context, saleID uuid.UUID, applied []AppliedPromotion) error
+	GetSalePromotions(ctx context.Context, saleID uuid.UUID) ([]AppliedPromotion, error)
+	// AbandonStaleDrafts marks open drafts with no live stock hold ABANDONED and returns how many
+	AbandonStaleDrafts(ctx context.Context) (int64, error)
+
+	// ListSalesWithoutInvoice and ListReturnsWithoutCreditNote find what was sold or returned before tax invoicing
+	ListSalesWithoutInvoice(ctx context.Context, pharmacyID uuid.UUID) ([]uuid.UUID, error)
+	ListReturnsWithoutCreditNote(ctx context.Context, pharmacyID uuid.UUID) ([]uuid.UUID, error)
 }
 
 type postgresRepository struct {
@@ -81,7 +111,7 @@ func (r *postgresRepository) GetSaleByID(ctx context.Context, pharmacyID, id uui
 		       status, gross_amount, total_amount, 
 		       total_discount, total_tax, COALESCE(invoice_number, '') as invoice_number, 
 		       is_recurring, days_supply, next_refill_date, 
-		       applied_credit, applied_due, generated_credit, generated_due, created_at, updated_at
+		       applied_credit, applied_due, generated_credit, generated_due, completed_at, created_at, updated_at
 		FROM sales_schema.sales
 		WHERE id = $1 AND pharmacy_id = $2
 	`
@@ -91,7 +121,7 @@ func (r *postgresRepository) GetSaleByID(ctx context.Context, pharmacyID, id uui
 		&s.CustomerName, &s.CustomerPhone, &s.CustomerAge, &s.CustomerGender, &s.CustomerAddress,
 		&s.Status, &s.GrossAmount, &s.TotalAmount, &s.TotalDiscount, &s.TotalTax,
 		&s.InvoiceNumber, &s.IsRecurring, &s.DaysSupply, &s.NextRefillDate,
-		&s.AppliedCredit, &s.AppliedDue, &s.GeneratedCredit, &s.GeneratedDue, &s.CreatedAt, &s.UpdatedAt,
+		&s.AppliedCredit, &s.AppliedDue, &s.GeneratedCredit, &s.GeneratedDue, &s.CompletedAt, &s.CreatedAt, &s.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("sale not found")
@@ -113,7 +143,7 @@ func (r *postgresRepository) GetLatestSaleByPrescriptionID(ctx context.Context,
 		       status, gross_amount, total_amount, 
 		       total_discount, total_tax, COALESCE(invoice_number, '') as invoice_number, 
 		       is_recurring, days_supply, next_refill_date, 
-		       applied_credit, applied_due, generated_credit, generated_due, created_at, updated_at
+		       applied_credit, applied_due, generated_credit, generated_due, completed_at, created_at, updated_at
 		FROM sales_schema.sales
 		WHERE prescription_id = $1 AND pharmacy_id = $2
 		ORDER BY created_at DESC
@@ -125,7 +155,7 @@ func (r *postgresRepository) GetLatestSaleByPrescriptionID(ctx context.Context,
 		&s.CustomerName, &s.CustomerPhone, &s.CustomerAge, &s.CustomerGender, &s.CustomerAddress,
 		&s.Status, &s.GrossAmount, &s.TotalAmount, &s.TotalDiscount, &s.TotalTax,
 		&s.InvoiceNumber, &s.IsRecurring, &s.DaysSupply, &s.NextRefillDate,
-		&s.AppliedCredit, &s.AppliedDue, &s.GeneratedCredit, &s.GeneratedDue, &s.CreatedAt, &s.UpdatedAt,
+		&s.AppliedCredit, &s.AppliedDue, &s.GeneratedCredit, &s.GeneratedDue, &s.CompletedAt, &s.CreatedAt, &s.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -136,40 +166,73 @@ func (r *postgresRepository) GetLatestSaleByPrescriptionID(ctx context.Context,
 	return s, nil
 }
 
-func (r *postgresRepository) UpdateSale(ctx context.Context, s *Sale) error {
+func (r *postgresRepository) UpdateSale(ctx context.Context, tx *sql.Tx, s *Sale) error {
 	query := `
 		UPDATE sales_schema.sales
 		SET status = $1, gross_amount = $2, total_amount = $3, total_discount = $4, total_tax = $5, 
-		    invoice_number = $6, is_recurring = $7, days_supply = $8, next_refill_date = $9, applied_credit = $10, applied_due = $11, generated_credit = $12, generated_due = $13, updated_at = $14
-		WHERE id = $15 AND pharmacy_id = $16
+		    invoice_number = $6, is_recurring = $7, days_supply = $8, next_refill_date = $9, applied_credit = $10, applied_due = $11, generated_credit = $12, generated_due = $13, completed_at = $14, updated_at = $15
+		WHERE id = $16 AND pharmacy_id = $17
 	`
 	var invNum sql.NullString
 	if s.InvoiceNumber != "" {
 		invNum = sql.NullString{String: s.InvoiceNumber, Valid: true}
 	}
 
-	_, err := r.db.ExecContext(ctx, query,
+	args := []interface{}{
 		s.Status, s.GrossAmount, s.TotalAmount, s.TotalDiscount, s.TotalTax,
-		invNum, s.IsRecurring, s.DaysSupply, s.NextRefillDate, s.AppliedCredit, s.AppliedDue, s.GeneratedCredit, s.GeneratedDue, time.Now(), s.ID, s.PharmacyID,
-	)
+		invNum, s.IsRecurring, s.DaysSupply, s.NextRefillDate, s.AppliedCredit, s.AppliedDue, s.GeneratedCredit, s.GeneratedDue, s.CompletedAt, time.Now(), s.ID, s.PharmacyID,
+	}
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, args...)
+	}
 	return err
 }
 
+func (r *postgresRepository) LockSale(ctx context.Context, tx *sql.Tx, pharmacyID, id uuid.UUID) (SaleStatus, error) {
+	var status SaleStatus
+	err := tx.QueryRowContext(ctx, `
+		SELECT status FROM sales_schema.sales
+		WHERE id = $1 AND pharmacy_id = $2
+		FOR UPDATE
+	`, id, pharmacyID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("sale not found")
+	}
+	return status, err
+}
+
+func (r *postgresRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
 func (r *postgresRepository) AddItem(ctx context.Context, i *SaleItem) error {
 	query := `
 		INSERT INTO sales_schema.sale_items (
 			id, sale_id, product_id, medicine_name, medicine_brand, batch_id, batch_no, 
 			quantity, expiry_date, mrp, price, discount_percentage, 
 			tax_percentage, subtotal, reservation_id, rack_no, created_at,
-			retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc
+			retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc,
+			safety_warnings, override_reason, override_by, promo_disc_perc, is_free, promotion_id
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NULLIF($23, ''), NULLIF($24, ''), $25, $26, $27)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	warnings := i.SafetyWarnings
+	if warnings == nil {
+		warnings = []safety.Warning{}
+	}
+	warningsJSON, err := json.Marshal(warnings)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, query,
 		i.ID, i.SaleID, i.ProductID, i.MedicineName, i.MedicineBrand, i.BatchID, i.BatchNo,
 		i.Quantity, i.ExpiryDate, i.MRP, i.Price, i.DiscountPercentage,
 		i.TaxPercentage, i.Subtotal, i.ReservationID, i.RackNo, i.CreatedAt,
 		i.RetailDiscPerc, i.StaffDiscPerc, i.SpecialDiscPerc, i.MaxDiscPerc,
+		warningsJSON, i.OverrideReason, i.OverrideBy, i.PromoDiscPerc, i.IsFree, i.PromotionID,
 	)
 	return err
 }
@@ -180,7 +243,8 @@ func (r *postgresRepository) GetItemByID(ctx context.Context, itemID uuid.UUID)
 		       quantity, expiry_date, mrp, price, 
 		       discount_percentage, tax_percentage, subtotal, 
 		       reservation_id, rack_no, created_at,
-		       retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc, returned_quantity
+		       retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc, returned_quantity,
+		       promo_disc_perc, is_free, promotion_id
 		FROM sales_schema.sale_items
 		WHERE id = $1
 	`
@@ -193,7 +257,7 @@ func (r *postgresRepository) GetItemByID(ctx context.Context, itemID uuid.UUID)
 		&i.Quantity, &expiryDate, &i.MRP, &i.Price,
 		&i.DiscountPercentage, &i.TaxPercentage, &i.Subtotal, &i.ReservationID, &i.RackNo,
 		&i.CreatedAt, &i.RetailDiscPerc, &i.StaffDiscPerc, &i.SpecialDiscPerc, &i.MaxDiscPerc,
-		&i.ReturnedQuantity,
+		&i.ReturnedQuantity, &i.PromoDiscPerc, &i.IsFree, &i.PromotionID,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("item not found")
@@ -208,16 +272,29 @@ func (r *postgresRepository) GetItemByID(ctx context.Context, itemID uuid.UUID)
 }
 
 func (r *postgresRepository) GetItemsBySaleID(ctx context.Context, saleID uuid.UUID) ([]SaleItem, error) {
+	return loadItems(ctx, r.db, saleID)
+}
+
+func (r *postgresRepository) GetItemsBySaleIDTx(ctx context.Context, tx *sql.Tx, saleID uuid.UUID) ([]SaleItem, error) {
+	return loadItems(ctx, tx, saleID)
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func loadItems(ctx context.Context, q queryer, saleID uuid.UUID) ([]SaleItem, error) {
 	query := `
 		SELECT id, sale_id, product_id, medicine_name, medicine_brand, batch_id, batch_no, 
 		       quantity, expiry_date, mrp, price, 
 		       discount_percentage, tax_percentage, subtotal, 
 		       reservation_id, rack_no, created_at,
-		       retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc, returned_quantity
+		       retail_disc_perc, staff_disc_perc, special_disc_perc, max_disc_perc, returned_quantity,
+		       promo_disc_perc, is_free, promotion_id
 		FROM sales_schema.sale_items
 		WHERE sale_id = $1
 	`
-	rows, err := r.db.QueryContext(ctx, query, saleID)
+	rows, err := q.QueryContext(ctx, query, saleID)
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +311,7 @@ func (r *postgresRepository) GetItemsBySaleID(ctx context.Context, saleID uuid.U
 			&i.Quantity, &expiryDate, &i.MRP, &i.Price,
 			&i.DiscountPercentage, &i.TaxPercentage, &i.Subtotal, &i.ReservationID, &i.RackNo,
 			&i.CreatedAt, &i.RetailDiscPerc, &i.StaffDiscPerc, &i.SpecialDiscPerc, &i.MaxDiscPerc,
-			&i.ReturnedQuantity,
+			&i.ReturnedQuantity, &i.PromoDiscPerc, &i.IsFree, &i.PromotionID,
 		); err != nil {
 			return nil, err
 		}
@@ -255,10 +332,11 @@ func (r *postgresRepository) UpdateItem(ctx context.Context, i *SaleItem) error
 	query := `
 		UPDATE sales_schema.sale_items
 		SET quantity = $1, price = $2, discount_percentage = $3, subtotal = $4,
-		    retail_disc_perc = $5, staff_disc_perc = $6, special_disc_perc = $7, max_disc_perc = $8
-		WHERE id = $9
+		    retail_disc_perc = $5, staff_disc_perc = $6, special_disc_perc = $7, max_disc_perc = $8,
+		    promo_disc_perc = $9
+		WHERE id = $10
 	`
-	_, err := r.db.ExecContext(ctx, query, i.Quantity, i.Price, i.DiscountPercentage, i.Subtotal, i.RetailDiscPerc, i.StaffDiscPerc, i.SpecialDiscPerc, i.MaxDiscPerc, i.ID)
+	_, err := r.db.ExecContext(ctx, query, i.Quantity, i.Price, i.DiscountPercentage, i.Subtotal, i.RetailDiscPerc, i.StaffDiscPerc, i.SpecialDiscPerc, i.MaxDiscPerc, i.PromoDiscPerc, i.ID)
 	return err
 }
 
@@ -268,18 +346,25 @@ func (r *postgresRepository) DeleteItem(ctx context.Context, itemID uuid.UUID) e
 	return err
 }
 
-func (r *postgresRepository) AddPayment(ctx context.Context, p *Payment) error {
+func (r *postgresRepository) AddPayment(ctx context.Context, tx *sql.Tx, p *Payment) error {
 	query := `
-		INSERT INTO sales_schema.payments (id, sale_id, return_id, transaction_type, mode, amount, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO sales_schema.payments (id, sale_id, return_id, transaction_type, mode, amount, reference, tendered_amount, change_amount, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, 0), $9, $10)
 	`
-	_, err := r.db.ExecContext(ctx, query, p.ID, p.SaleID, p.ReturnID, p.TransactionType, p.Mode, p.Amount, p.CreatedAt)
+	args := []interface{}{p.ID, p.SaleID, p.ReturnID, p.TransactionType, p.Mode, p.Amount, p.Reference, p.Tendered, p.Change, p.CreatedAt}
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, args...)
+	}
 	return err
 }
 
 func (r *postgresRepository) GetPaymentsBySaleID(ctx context.Context, saleID uuid.UUID) ([]Payment, error) {
 	query := `
-		SELECT id, sale_id, return_id, transaction_type, mode, amount, created_at
+		SELECT id, sale_id, return_id, transaction_type, mode, amount,
+		       COALESCE(reference, ''), COALESCE(tendered_amount, 0), COALESCE(change_amount, 0), created_at
 		FROM sales_schema.payments
 		WHERE sale_id = $1
 		ORDER BY created_at ASC
@@ -293,7 +378,7 @@ func (r *postgresRepository) GetPaymentsBySaleID(ctx context.Context, saleID uui
 	var payments []Payment
 	for rows.Next() {
 		var p Payment
-		if err := rows.Scan(&p.ID, &p.SaleID, &p.ReturnID, &p.TransactionType, &p.Mode, &p.Amount, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.SaleID, &p.ReturnID, &p.TransactionType, &p.Mode, &p.Amount, &p.Reference, &p.Tendered, &p.Change, &p.CreatedAt); err != nil {
 			return nil, err
 		}
 		payments = append(payments, p)
@@ -303,30 +388,31 @@ func (r *postgresRepository) GetPaymentsBySaleID(ctx context.Context, saleID uui
 
 func (r *postgresRepository) UpsertPatient(ctx context.Context, p *Patient) error {
 	query := `
-		INSERT INTO sales_schema.patients (id, pharmacy_id, name, phone, gender, age, address, is_recurring, updated_at)
-		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, ''), $8, $9)
+		INSERT INTO sales_schema.patients (id, pharmacy_id, name, phone, gender, age, address, is_recurring, updated_at, allergies)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, ''), $8, $9, NULLIF($10, ''))
 		ON CONFLICT (pharmacy_id, phone, name) DO UPDATE 
 		SET 
 			gender = COALESCE(NULLIF(EXCLUDED.gender, ''), sales_schema.patients.gender),
 			age = CASE WHEN EXCLUDED.age != 0 THEN EXCLUDED.age ELSE sales_schema.patients.age END,
 			address = COALESCE(NULLIF(EXCLUDED.address, ''), sales_schema.patients.address),
+			allergies = COALESCE(EXCLUDED.allergies, sales_schema.patients.allergies),
 			is_recurring = EXCLUDED.is_recurring OR sales_schema.patients.is_recurring,
 			updated_at = CURRENT_TIMESTAMP
 		RETURNING id
 	`
-	return r.db.QueryRowContext(ctx, query, p.ID, p.PharmacyID, p.Name, p.Phone, p.Gender, p.Age, p.Address, p.IsRecurring, time.Now()).Scan(&p.ID)
+	return r.db.QueryRowContext(ctx, query, p.ID, p.PharmacyID, p.Name, p.Phone, p.Gender, p.Age, p.Address, p.IsRecurring, time.Now(), p.Allergies).Scan(&p.ID)
 }
 
 func (r *postgresRepository) GetPatient(ctx context.Context, pharmacyID uuid.UUID, phone, name string) (*Patient, error) {
 	// Use ILIKE for case insensitive exact matching
-	query := `SELECT id, pharmacy_id, name, phone, gender, age, address, is_recurring, due_amount, credit_amount, created_at, updated_at FROM sales_schema.patients WHERE pharmacy_id = $1 AND phone = $2 AND name ILIKE $3`
+	query := `SELECT id, pharmacy_id, name, phone, gender, age, address, COALESCE(allergies, ''), is_recurring, due_amount, credit_amount, created_at, updated_at FROM sales_schema.patients WHERE pharmacy_id = $1 AND phone = $2 AND name ILIKE $3`
 	p := &Patient{}
 	var addr sql.NullString
 	var gender sql.NullString
 	var age sql.NullInt64
 
 	err := r.db.QueryRowContext(ctx, query, pharmacyID, phone, name).Scan(
-		&p.ID, &p.PharmacyID, &p.Name, &p.Phone, &gender, &age, &addr, &p.IsRecurring, &p.DueAmount, &p.CreditAmount, &p.CreatedAt, &p.UpdatedAt,
+		&p.ID, &p.PharmacyID, &p.Name, &p.Phone, &gender, &age, &addr, &p.Allergies, &p.IsRecurring, &p.DueAmount, &p.CreditAmount, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -347,24 +433,117 @@ func (r *postgresRepository) GetPatient(ctx context.Context, pharmacyID uuid.UUI
 	return p, nil
 }
 
-func (r *postgresRepository) UpdatePatientWallet(ctx context.Context, pharmacyID, patientID uuid.UUID, action string, amount float64) error {
-	var query string
-	if action == "Credit Amount" || action == "CREDIT" {
-		query = `UPDATE sales_schema.patients SET credit_amount = COALESCE(credit_amount, 0) + $1, updated_at = CURRENT_TIMESTAMP WHERE pharmacy_id = $2 AND id = $3`
-	} else if action == "Due Amount" || action == "DUE" {
-		query = `UPDATE sales_schema.patients SET due_amount = COALESCE(due_amount, 0) + $1, updated_at = CURRENT_TIMESTAMP WHERE pharmacy_id = $2 AND id = $3`
-	} else {
-		return nil
+func (r *postgresRepository) AddWalletEntries(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID, entries []WalletEntry) error {
+	exec := func(query string, args ...interface{}) error {
+		var err error
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, args...)
+		} else {
+			_, err = r.db.ExecContext(ctx, query, args...)
+		}
+		return err
 	}
 
-	_, err := r.db.ExecContext(ctx, query, amount, pharmacyID, patientID)
-	return err
+	for _, e := range entries {
+		err := exec(`
+			INSERT INTO sales_schema.patient_wallet_entries (
+				id, pharmacy_id, patient_id, entry_type, debit, credit, sale_id, return_id, reference_no,
+				payment_mode, payment_reference, reason, created_by, created_by_name, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), $13, NULLIF($14, ''), $15)`,
+			e.ID, pharmacyID, patientID, e.Type, e.Debit, e.Credit, e.SaleID, e.ReturnID, e.ReferenceNo,
+			string(e.PaymentMode), e.PaymentReference, e.Reason, e.CreatedBy, e.CreatedByName, e.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to post wallet entry: %w", err)
+		}
+	}
+
+	return exec(`
+		UPDATE sales_schema.patients p
+		SET due_amount = GREATEST(b.balance, 0), credit_amount = GREATEST(-b.balance, 0), updated_at = CURRENT_TIMESTAMP
+		FROM (
+			SELECT COALESCE(SUM(debit - credit), 0) AS balance
+			FROM sales_schema.patient_wallet_entries
+			WHERE pharmacy_id = $1 AND patient_id = $2
+		) b
+		WHERE p.pharmacy_id = $1 AND p.id = $2`, pharmacyID, patientID)
 }
 
-func (r *postgresRepository) ClearPatientBalances(ctx context.Context, pharmacyID, patientID uuid.UUID) error {
-	query := `UPDATE sales_schema.patients SET credit_amount = 0, due_amount = 0, updated_at = CURRENT_TIMESTAMP WHERE pharmacy_id = $1 AND id = $2`
-	_, err := r.db.ExecContext(ctx, query, pharmacyID, patientID)
-	return err
+func (r *postgresRepository) LockPatientWallet(ctx context.Context, tx *sql.Tx, pharmacyID, patientID uuid.UUID) (float64, *float64, error) {
+	var balance float64
+	var limit sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `
+		SELECT due_amount - credit_amount, credit_limit
+		FROM sales_schema.patients
+		WHERE pharmacy_id = $1 AND id = $2
+		FOR UPDATE`, pharmacyID, patientID).Scan(&balance, &limit)
+	if err == sql.ErrNoRows {
+		return 0, nil, fmt.Errorf("patient not found")
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if limit.Valid {
+		return balance, &limit.Float64, nil
+	}
+	return balance, nil, nil
+}
+
+func (r *postgresRepository) ListWalletEntries(ctx context.Context, pharmacyID, patientID uuid.UUID) ([]WalletEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, patient_id, timezone('Asia/Kolkata', created_at)::date, entry_type, debit, credit, sale_id, return_id,
+		       COALESCE(reference_no, ''), COALESCE(payment_mode, ''), COALESCE(payment_reference, ''), COALESCE(reason, ''),
+		       created_by, COALESCE(created_by_name, ''), created_at
+		FROM sales_schema.patient_wallet_entries
+		WHERE pharmacy_id = $1 AND patient_id = $2
+		ORDER BY created_at, id`, pharmacyID, patientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load patient wallet: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []WalletEntry
+	for rows.Next() {
+		var e WalletEntry
+		var saleID, returnID, createdBy uuid.NullUUID
+		if err := rows.Scan(
+			&e.ID, &e.PatientID, &e.Date, &e.Type, &e.Debit, &e.Credit, &saleID, &returnID,
+			&e.ReferenceNo, &e.PaymentMode, &e.PaymentReference, &e.Reason,
+			&createdBy, &e.CreatedByName, &e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if saleID.Valid {
+			e.SaleID = &saleID.UUID
+		}
+		if returnID.Valid {
+			e.ReturnID = &returnID.UUID
+		}
+		if createdBy.Valid {
+			e.CreatedBy = &createdBy.UUID
+		}
+		e.PharmacyID = pharmacyID
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// NextReceiptNumber takes the next number of the pharmacy's due receipt series
+// inside tx, the transaction that records the payment: RCT/26-27/00001
+func (r *postgresRepository) NextReceiptNumber(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, at time.Time) (string, error) {
+	return numbering.Next(ctx, tx, pharmacyID, numbering.DocDueReceipt, at)
+}
+
+func (r *postgresRepository) SetPatientCreditLimit(ctx context.Context, pharmacyID, patientID uuid.UUID, limit *float64) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE sales_schema.patients SET credit_limit = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE pharmacy_id = $2 AND id = $3`, limit, pharmacyID, patientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("patient not found")
+	}
+	return nil
 }
 
 func (r *postgresRepository) SearchPatientsByPhone(ctx context.Context, pharmacyID uuid.UUID, phone string) ([]Patient, error) {
@@ -474,14 +653,15 @@ func (r *postgresRepository) ListPatients(ctx context.Context, pharmacyID uuid.U
 }
 
 func (r *postgresRepository) GetPatientByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Patient, error) {
-	query := `SELECT id, pharmacy_id, name, phone, gender, age, address, is_recurring, due_amount, credit_amount, created_at, updated_at FROM sales_schema.patients WHERE pharmacy_id = $1 AND id = $2`
+	query := `SELECT id, pharmacy_id, name, phone, gender, age, address, COALESCE(allergies, ''), is_recurring, due_amount, credit_amount, credit_limit, created_at, updated_at FROM sales_schema.patients WHERE pharmacy_id = $1 AND id = $2`
 	p := &Patient{}
 	var addr sql.NullString
 	var gender sql.NullString
 	var age sql.NullInt64
+	var creditLimit sql.NullFloat64
 
 	err := r.db.QueryRowContext(ctx, query, pharmacyID, id).Scan(
-		&p.ID, &p.PharmacyID, &p.Name, &p.Phone, &gender, &age, &addr, &p.IsRecurring, &p.DueAmount, &p.CreditAmount, &p.CreatedAt, &p.UpdatedAt,
+		&p.ID, &p.PharmacyID, &p.Name, &p.Phone, &gender, &age, &addr, &p.Allergies, &p.IsRecurring, &p.DueAmount, &p.CreditAmount, &creditLimit, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("patient not found")
@@ -490,6 +670,9 @@ func (r *postgresRepository) GetPatientByID(ctx context.Context, pharmacyID, id
 		return nil, err
 	}
 
+	if creditLimit.Valid {
+		p.CreditLimit = &creditLimit.Float64
+	}
 	if addr.Valid {
 		p.Address = addr.String
 	}
@@ -616,12 +799,26 @@ func (r *postgresRepository) GetPatientStats(ctx context.Context, pharmacyID uui
 	return stats, nil
 }
 
-func (r *postgresRepository) CreateReturn(ctx context.Context, ret *SaleReturn, items []SaleReturnItem) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+func (r *postgresRepository) CreateReturn(ctx context.Context, tx *sql.Tx, ret *SaleReturn, items []SaleReturnItem) error {
+	if tx == nil {
+		own, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer own.Rollback()
+		if err := r.CreateReturn(ctx, own, ret, items); err != nil {
+			return err
+		}
+		return own.Commit()
+	}
+
+	// The credit note number comes from the pharmacy's series within this transaction
+	var err error
+	if ret.ReturnNumber == "" {
+		if ret.ReturnNumber, err = numbering.Next(ctx, tx, ret.PharmacyID, numbering.DocCreditNote, ret.CreatedAt); err != nil {
+			return err
+		}
 	}
-	defer tx.Rollback()
 
 	query := `
 		INSERT INTO sales_schema.sales_returns (
@@ -662,7 +859,7 @@ func (r *postgresRepository) CreateReturn(ctx context.Context, ret *SaleReturn,
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 func (r *postgresRepository) GetReturnByID(ctx context.Context, pharmacyID, id uuid.UUID) (*SaleReturn, error) {
@@ -832,6 +1029,13 @@ func (r *postgresRepository) GetStats(ctx context.Context, pharmacyID uuid.UUID,
 		return nil, err
 	}
 
+	// Payment split by mode (Filtered by queryStart and queryEnd)
+	split, err := r.modeTotals(ctx, pharmacyID, queryStart, queryEnd)
+	if err != nil {
+		return nil, err
+	}
+	stats.PaymentSplit = split
+
 	// Dynamic Sales Trend based on granularity
 	trendQuery := fmt.Sprintf(`
 		SELECT 
@@ -918,8 +1122,8 @@ func (r *postgresRepository) ListSales(ctx context.Context, pharmacyID uuid.UUID
 			COALESCE(s.customer_address, '') as customer_address, 
 			s.status, s.gross_amount, s.total_amount, s.total_discount, s.total_tax, 
 			COALESCE(s.invoice_number, '') as invoice_number, s.is_recurring, s.days_supply, s.next_refill_date, 
-			s.applied_credit, s.applied_due, s.generated_credit, s.generated_due, s.created_at, s.updated_at,
-			COALESCE((SELECT mode FROM sales_schema.payments WHERE sale_id = s.id AND transaction_type = 'PAYMENT' LIMIT 1), '') as payment_mode
+			s.applied_credit, s.applied_due, s.generated_credit, s.generated_due, s.completed_at, s.created_at, s.updated_at,
+			COALESCE((SELECT CASE WHEN COUNT(DISTINCT mode) > 1 THEN 'SPLIT' ELSE MIN(mode) END FROM sales_schema.payments WHERE sale_id = s.id AND transaction_type = 'PAYMENT'), '') as payment_mode
 		FROM sales_schema.sales s
 		WHERE s.pharmacy_id = $1 AND s.status IN ('COMPLETED', 'DISPATCHED')
 	`
@@ -964,7 +1168,7 @@ func (r *postgresRepository) ListSales(ctx context.Context, pharmacyID uuid.UUID
 			&s.CustomerName, &s.CustomerPhone, &s.CustomerAge, &s.CustomerGender, &s.CustomerAddress,
 			&s.Status, &s.GrossAmount, &s.TotalAmount, &s.TotalDiscount, &s.TotalTax,
 			&s.InvoiceNumber, &s.IsRecurring, &s.DaysSupply, &s.NextRefillDate,
-			&s.AppliedCredit, &s.AppliedDue, &s.GeneratedCredit, &s.GeneratedDue, &s.CreatedAt, &s.UpdatedAt,
+			&s.AppliedCredit, &s.AppliedDue, &s.GeneratedCredit, &s.GeneratedDue, &s.CompletedAt, &s.CreatedAt, &s.UpdatedAt,
 			&s.PaymentMode,
 		)
 		if err != nil {
@@ -1023,3 +1227,260 @@ func (r *postgresRepository) GetRecurringRefillsReport(ctx context.Context, phar
 
 	return report, nil
 }
+
+func (r *postgresRepository) ListParkedBills(ctx context.Context, pharmacyID uuid.UUID, statuses []SaleStatus, limit, offset int) ([]ParkedBill, int, error) {
+	strStatuses := make([]string, len(statuses))
+	for i, st := range statuses {
+		strStatuses[i] = string(st)
+	}
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sales_schema.sales
+		WHERE pharmacy_id = $1 AND status = ANY($2)
+	`, pharmacyID, pq.Array(strStatuses)).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Holds live in the inventory schema of the same database
+	query := `
+		SELECT s.id, s.sale_type, COALESCE(s.prescription_id, ''), COALESCE(s.customer_name, ''), COALESCE(s.customer_phone, ''),
+		       s.status, COUNT(i.id), COALESCE(s.total_amount, 0), s.created_at, s.updated_at,
+		       MIN(r.expires_at) FILTER (WHERE r.status = 'PENDING' AND r.expires_at > CURRENT_TIMESTAMP)
+		FROM sales_schema.sales s
+		LEFT JOIN sales_schema.sale_items i ON i.sale_id = s.id
+		LEFT JOIN inventory.reservations r ON r.id::text = i.reservation_id
+		WHERE s.pharmacy_id = $1 AND s.status = ANY($2)
+		GROUP BY s.id
+		ORDER BY s.updated_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := r.db.QueryContext(ctx, query, pharmacyID, pq.Array(strStatuses), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	bills := []ParkedBill{}
+	for rows.Next() {
+		var b ParkedBill
+		var holdExpires sql.NullTime
+		if err := rows.Scan(
+			&b.SaleID, &b.SaleType, &b.PrescriptionID, &b.CustomerName, &b.CustomerPhone,
+			&b.Status, &b.ItemCount, &b.TotalAmount, &b.CreatedAt, &b.LastActivityAt, &holdExpires,
+		); err != nil {
+			return nil, 0, err
+		}
+		if holdExpires.Valid {
+			b.HoldExpiresAt = &holdExpires.Time
+		}
+		bills = append(bills, b)
+	}
+	return bills, total, rows.Err()
+}
+
+func (r *postgresRepository) UpdateItemReservation(ctx context.Context, itemID uuid.UUID, reservationID string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sales_schema.sale_items SET reservation_id = $1 WHERE id = $2`, reservationID, itemID)
+	return err
+}
+
+func (r *postgresRepository) ReplaceSalePromotions(ctx context.Context, saleID uuid.UUID, applied []AppliedPromotion) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sales_schema.sale_promotions WHERE sale_id = $1`, saleID); err != nil {
+		return err
+	}
+	for _, a := range applied {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO sales_schema.sale_promotions (id, sale_id, promotion_id, name, promo_type, discount_amount, free_quantity, note)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))`,
+			uuid.New(), saleID, a.PromotionID, a.Name, a.Type, a.Discount, a.FreeQuantity, a.Note)
+		if err != nil {
+			return fmt.Errorf("failed to record applied promotion: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) GetSalePromotions(ctx context.Context, saleID uuid.UUID) ([]AppliedPromotion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT promotion_id, name, promo_type, discount_amount, free_quantity, COALESCE(note, '')
+		FROM sales_schema.sale_promotions
+		WHERE sale_id = $1
+		ORDER BY discount_amount DESC, name`, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []AppliedPromotion
+	for rows.Next() {
+		var a AppliedPromotion
+		if err := rows.Scan(&a.PromotionID, &a.Name, &a.Type, &a.Discount, &a.FreeQuantity, &a.Note); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+func (r *postgresRepository) AbandonStaleDrafts(ctx context.Context) (int64, error) {
+	// A draft is stale once none of its lines holds stock any more; drafts that
+	// never got a line are given a day before they are cleared from the parked list
+	query := `
+		UPDATE sales_schema.sales s
+		SET status = 'ABANDONED', updated_at = CURRENT_TIMESTAMP
+		WHERE s.status IN ('DRAFT', 'PENDING')
+		  AND (
+			(EXISTS (SELECT 1 FROM sales_schema.sale_items i WHERE i.sale_id = s.id)
+			 AND NOT EXISTS (
+				SELECT 1
+				FROM sales_schema.sale_items i
+				JOIN inventory.reservations r ON r.id::text = i.reservation_id
+				WHERE i.sale_id = s.id AND r.status = 'PENDING' AND r.expires_at > CURRENT_TIMESTAMP
+			 ))
+			OR (NOT EXISTS (SELECT 1 FROM sales_schema.sale_items i WHERE i.sale_id = s.id)
+			 AND s.updated_at < CURRENT_TIMESTAMP - INTERVAL '24 hours')
+		  )
+	`
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// modeTotals sums sale payments and return refunds per mode; payments are dated when taken
+func (r *postgresRepository) modeTotals(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) ([]ModeTotal, error) {
+	query := `
+		SELECT p.mode,
+		       COUNT(*) FILTER (WHERE p.transaction_type = 'PAYMENT'),
+		       COALESCE(SUM(p.amount) FILTER (WHERE p.transaction_type = 'PAYMENT'), 0),
+		       COALESCE(SUM(p.amount) FILTER (WHERE p.transaction_type = 'REFUND'), 0)
+		FROM sales_schema.payments p
+		JOIN sales_schema.sales s ON s.id = p.sale_id
+		WHERE s.pharmacy_id = $1 AND p.created_at >= $2 AND p.created_at <= $3
+		  AND (p.transaction_type = 'REFUND' OR s.status IN ('COMPLETED', 'DISPATCHED'))
+		GROUP BY p.mode
+		ORDER BY p.mode
+	`
+	rows, err := r.db.QueryContext(ctx, query, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []ModeTotal{}
+	for rows.Next() {
+		var t ModeTotal
+		if err := rows.Scan(&t.Mode, &t.Count, &t.Received, &t.Refunded); err != nil {
+			return nil, err
+		}
+		t.Net = t.Received - t.Refunded
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+func (r *postgresRepository) GetDayCollection(ctx context.Context, pharmacyID uuid.UUID, from, to time.Time) (*DayCollection, error) {
+	dc := &DayCollection{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(total_amount), 0), COUNT(*)
+		FROM sales_schema.sales
+		WHERE pharmacy_id = $1 AND status IN ('COMPLETED', 'DISPATCHED') AND created_at >= $2 AND created_at <= $3`,
+		pharmacyID, from, to).Scan(&dc.SalesTotal, &dc.SalesCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(p.change_amount), 0)
+		FROM sales_schema.payments p
+		JOIN sales_schema.sales s ON s.id = p.sale_id
+		WHERE s.pharmacy_id = $1 AND p.transaction_type = 'PAYMENT' AND p.created_at >= $2 AND p.created_at <= $3
+		  AND s.status IN ('COMPLETED', 'DISPATCHED')`,
+		pharmacyID, from, to).Scan(&dc.ChangeGiven)
+	if err != nil {
+		return nil, err
+	}
+
+	if dc.Modes, err = r.modeTotals(ctx, pharmacyID, from, to); err != nil {
+		return nil, err
+	}
+
+	// Dues collected at the counter are cash-up money too
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT payment_mode, COUNT(*), COALESCE(SUM(credit), 0)
+		FROM sales_schema.patient_wallet_entries
+		WHERE pharmacy_id = $1 AND entry_type = 'DUE_PAYMENT' AND created_at >= $2 AND created_at <= $3
+		GROUP BY payment_mode`,
+		pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mode PaymentMode
+		var count int
+		var amount float64
+		if err := rows.Scan(&mode, &count, &amount); err != nil {
+			return nil, err
+		}
+		dc.DueCollected += amount
+		merged := false
+		for i := range dc.Modes {
+			if dc.Modes[i].Mode == mode {
+				dc.Modes[i].Count += count
+				dc.Modes[i].Received += amount
+				dc.Modes[i].Net += amount
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			dc.Modes = append(dc.Modes, ModeTotal{Mode: mode, Count: count, Received: amount, Net: amount})
+		}
+	}
+	return dc, rows.Err()
+}
+
+func (r *postgresRepository) ListSalesWithoutInvoice(ctx context.Context, pharmacyID uuid.UUID) ([]uuid.UUID, error) {
+	return r.listIDs(ctx, `
+		SELECT s.id FROM sales_schema.sales s
+		WHERE s.pharmacy_id = $1 AND s.status IN ('COMPLETED', 'DISPATCHED')
+		  AND NOT EXISTS (SELECT 1 FROM sales_schema.tax_documents d WHERE d.sale_id = s.id AND d.document_type = 'INVOICE')
+		ORDER BY s.created_at
+	`, pharmacyID)
+}
+
+func (r *postgresRepository) ListReturnsWithoutCreditNote(ctx context.Context, pharmacyID uuid.UUID) ([]uuid.UUID, error) {
+	return r.listIDs(ctx, `
+		SELECT sr.id FROM sales_schema.sales_returns sr
+		WHERE sr.pharmacy_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM sales_schema.tax_documents d WHERE d.return_id = sr.id)
+		ORDER BY sr.created_at
+	`, pharmacyID)
+}
+
+func (r *postgresRepository) listIDs(ctx context.Context, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
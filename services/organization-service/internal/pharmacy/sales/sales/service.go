@@ -2,12 +2,24 @@ package sales
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"time"
 
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/gst"
+	"organization-service/internal/pharmacy/money"
+	"organization-service/internal/pharmacy/numbering"
+	"organization-service/internal/pharmacy/safety"
 	"organization-service/internal/pharmacy/sales/clients"
+	"organization-service/internal/pharmacy/sales/loyalty"
+	"organization-service/internal/pharmacy/sales/promotions"
 
 	"github.com/google/uuid"
+	"shared-scheduler"
 )
 
 type Service interface {
@@ -24,26 +36,51 @@ type Service interface {
 	ListReturns(ctx context.Context, pharmacyID uuid.UUID) ([]SaleReturn, error)
 	GetReturnDetails(ctx context.Context, pharmacyID, returnID uuid.UUID) (*SaleReturn, error)
 	GetStats(ctx context.Context, pharmacyID uuid.UUID, targetDate, startDate, endDate time.Time, granularity string) (*SalesStats, error)
+	GetDayCollection(ctx context.Context, pharmacyID uuid.UUID, date time.Time) (*DayCollection, error)
 	ListPatients(ctx context.Context, pharmacyID uuid.UUID, limit, offset int, search string) ([]Patient, int, error)
 	GetPatientStats(ctx context.Context, pharmacyID uuid.UUID) (*PatientStats, error)
 	GetPatientByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Patient, error)
 	GetPatientSales(ctx context.Context, pharmacyID, patientID uuid.UUID, limit, offset int) ([]PatientPurchase, int, error)
 	GetPatientReturns(ctx context.Context, pharmacyID, patientID uuid.UUID, limit, offset int) ([]PatientPurchase, int, error)
+	GetWalletStatement(ctx context.Context, pharmacyID, patientID uuid.UUID, from, to *time.Time) (*WalletStatement, error)
+	CollectDue(ctx context.Context, pharmacyID, patientID, userID uuid.UUID, userName string, req CollectDueRequest) (*WalletEntry, error)
+	AdjustWallet(ctx context.Context, pharmacyID, patientID, userID uuid.UUID, userName string, req WalletAdjustmentRequest) (*WalletEntry, error)
+	SetCreditLimit(ctx context.Context, pharmacyID, patientID uuid.UUID, req SetCreditLimitRequest) (*Patient, error)
 	ListSales(ctx context.Context, pharmacyID uuid.UUID, limit, offset int, startDate, endDate time.Time, paymentMode, search string) ([]Sale, int, error)
 	GetRecurringRefillsReport(ctx context.Context, pharmacyID uuid.UUID) ([]RecurringRefillReportItem, error)
+	GetCompliance(ctx context.Context, pharmacyID, saleID uuid.UUID) (*compliance.Requirements, error)
+	SetPrescriber(ctx context.Context, pharmacyID, saleID, userID uuid.UUID, userName string, req compliance.SetPrescriberRequest) (*compliance.PrescriberDetails, error)
+	SignOff(ctx context.Context, pharmacyID, saleID, userID uuid.UUID, userName string) ([]compliance.SignOff, error)
+	GetTaxInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (*gst.TaxDocument, error)
+	GetCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (*gst.TaxDocument, error)
+	BackfillTaxDocuments(ctx context.Context, pharmacyID uuid.UUID) (*TaxBackfill, error)
+	ListParkedBills(ctx context.Context, pharmacyID uuid.UUID, includeAbandoned bool, limit, offset int) ([]ParkedBill, int, error)
+	ResumeDraft(ctx context.Context, pharmacyID, saleID uuid.UUID) (*ResumeResult, error)
+	DiscardDraft(ctx context.Context, pharmacyID, saleID uuid.UUID) error
+	RegisterJobs(jobs *scheduler.Scheduler) // Marks drafts whose stock holds lapsed as abandoned
 }
 
 type salesService struct {
-	repo      Repository
-	inventory clients.InventoryClient
-	rxClient  clients.PrescriptionClient
+	repo       Repository
+	inventory  clients.InventoryClient
+	rxClient   clients.PrescriptionClient
+	safety     safety.Service
+	compliance compliance.Service
+	gst        gst.Service
+	loyalty    loyalty.Service
+	promotions promotions.Service
 }
 
-func NewService(repo Repository, inv clients.InventoryClient, rx clients.PrescriptionClient) Service {
+func NewService(repo Repository, inv clients.InventoryClient, rx clients.PrescriptionClient, safetySvc safety.Service, complianceSvc compliance.Service, gstSvc gst.Service, loyaltySvc loyalty.Service, promotionsSvc promotions.Service) Service {
 	return &salesService{
-		repo:      repo,
-		inventory: inv,
-		rxClient:  rx,
+		repo:       repo,
+		inventory:  inv,
+		rxClient:   rx,
+		safety:     safetySvc,
+		compliance: complianceSvc,
+		gst:        gstSvc,
+		loyalty:    loyaltySvc,
+		promotions: promotionsSvc,
 	}
 }
 
@@ -87,6 +124,7 @@ func (s *salesService) CreateDraft(ctx context.Context, pharmacyID uuid.UUID, rx
 		PharmacyID: pharmacyID,
 		Name:       rx.PatientName,
 		Phone:      rx.PatientPhone,
+		Allergies:  rx.Allergies,
 	}
 	if err := s.repo.UpsertPatient(ctx, &p); err != nil {
 		return nil, fmt.Errorf("failed to save patient profile: %v", err)
@@ -162,10 +200,74 @@ func (s *salesService) AddItemToDraft(ctx context.Context, pharmacyID, saleID uu
 		return nil, fmt.Errorf("cannot add items to a sale that is %s", sale.Status)
 	}
 
+	// A scanned batch label, or a batch picked by id, pins the line to that batch instead of FEFO
+	var pinned *clients.StockAvailability
+	if req.Barcode != "" {
+		pinned, err = s.inventory.ResolveLabel(ctx, pharmacyID, req.Barcode)
+		if err != nil {
+			return nil, err
+		}
+		if req.ProductID != uuid.Nil && req.ProductID != pinned.MedicineID {
+			return nil, fmt.Errorf("scanned batch %s is not of the selected product", pinned.BatchNo)
+		}
+	} else if req.BatchID != uuid.Nil {
+		available, err := s.inventory.GetAvailability(ctx, pharmacyID, req.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range available {
+			if available[i].BatchID == req.BatchID {
+				pinned = &available[i]
+				break
+			}
+		}
+		if pinned == nil {
+			return nil, fmt.Errorf("batch %s is not in stock for the selected product", req.BatchID)
+		}
+	}
+	if pinned != nil {
+		if !pinned.ExpiryDate.After(time.Now()) {
+			return nil, fmt.Errorf("batch %s of %s expired on %s", pinned.BatchNo, pinned.MedicineName, pinned.ExpiryDate.Format("2006-01-02"))
+		}
+		if pinned.Quantity < req.Quantity {
+			return nil, fmt.Errorf("%w in batch %s: %d available", clients.ErrInsufficientStock, pinned.BatchNo, pinned.Quantity)
+		}
+		req.ProductID = pinned.MedicineID
+	}
+
+	// 0. Drug interaction and allergy checks against what is already on the bill
+	check, err := s.checkItemSafety(ctx, pharmacyID, sale, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if err := safety.RequireOverride(check, req.OverrideReason); err != nil {
+		return nil, err
+	}
+	var overrideReason, overrideBy string
+	if check.RequiresOverride {
+		overrideReason, overrideBy = req.OverrideReason, req.OverrideBy
+	}
+
 	// 1. Fetch FEFO availability
-	batches, err := s.inventory.GetAvailability(ctx, pharmacyID, req.ProductID)
-	if err != nil || len(batches) == 0 {
-		return nil, fmt.Errorf("no stock available for product %s", req.ProductID)
+	var batches []clients.StockAvailability
+	if pinned != nil {
+		batches = []clients.StockAvailability{*pinned}
+	} else {
+		batches, err = s.inventory.GetAvailability(ctx, pharmacyID, req.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get stock for product %s: %v", req.ProductID, err)
+		}
+		if len(batches) == 0 {
+			return nil, fmt.Errorf("%w: no batch of product %s is in stock", clients.ErrInsufficientStock, req.ProductID)
+		}
+	}
+
+	// The patient's loyalty tier picks which batch discount applies by default
+	column := loyalty.DiscountRetail
+	if sale.PatientID != nil {
+		if c, err := s.loyalty.DiscountColumn(ctx, pharmacyID, *sale.PatientID); err == nil {
+			column = c
+		}
 	}
 
 	totalNeeded := req.Quantity
@@ -195,12 +297,12 @@ func (s *salesService) AddItemToDraft(ctx context.Context, pharmacyID, saleID uu
 				_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
 				_ = s.repo.DeleteItem(ctx, item.ID)
 			}
-			return nil, fmt.Errorf("failed to reserve stock: %v", err)
+			return nil, fmt.Errorf("failed to reserve stock: %w", err)
 		}
 
 		// Calculate Subtotal with Tax and Discount
 		mrp := batch.MRP
-		discPerc := batch.RetailDiscPerc
+		discPerc := tierDiscount(batch, column)
 		taxPerc := batch.TotalTaxPercentage
 
 		// Business Math
@@ -233,6 +335,9 @@ func (s *salesService) AddItemToDraft(ctx context.Context, pharmacyID, saleID uu
 			ReservationID:      resID,
 			RackNo:             batch.RackNo,
 			CreatedAt:          time.Now(),
+			SafetyWarnings:     check.Warnings,
+			OverrideReason:     overrideReason,
+			OverrideBy:         overrideBy,
 		}
 
 		if err := s.repo.AddItem(ctx, item); err != nil {
@@ -254,15 +359,76 @@ func (s *salesService) AddItemToDraft(ctx context.Context, pharmacyID, saleID uu
 			_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
 			_ = s.repo.DeleteItem(ctx, item.ID)
 		}
-		return nil, fmt.Errorf("insufficient stock in batch. Needed %d more", totalNeeded)
+		return nil, fmt.Errorf("%w in batch. Needed %d more", clients.ErrInsufficientStock, totalNeeded)
+	}
+
+	// A promotion that fails to evaluate leaves the bill at counter prices
+	_ = s.applyPromotions(ctx, pharmacyID, saleID)
+	for i := range createdItems {
+		if item, err := s.repo.GetItemByID(ctx, createdItems[i].ID); err == nil {
+			createdItems[i].DiscountPercentage = item.DiscountPercentage
+			createdItems[i].PromoDiscPerc = item.PromoDiscPerc
+			createdItems[i].Subtotal = item.Subtotal
+		}
 	}
 
 	// Recalculate Sale Total
 	s.updateSaleTotal(ctx, pharmacyID, saleID)
+	s.keepHoldsAlive(ctx, pharmacyID, saleID)
+	_ = s.compliance.ClearSignOffs(ctx, pharmacyID, saleID)
 
 	return createdItems, nil
 }
 
+// tierDiscount is the batch's discount for a loyalty tier's discount column
+func tierDiscount(batch clients.StockAvailability, column loyalty.DiscountColumn) float64 {
+	switch column {
+	case loyalty.DiscountSpecial:
+		return batch.SpecialDiscPerc
+	case loyalty.DiscountStaff:
+		return batch.StaffDiscPerc
+	default:
+		return batch.RetailDiscPerc
+	}
+}
+
+// checkItemSafety runs the product against the other medicines on the sale and the
+// allergies recorded for the patient and on the prescription.
+func (s *salesService) checkItemSafety(ctx context.Context, pharmacyID uuid.UUID, sale *Sale, productID uuid.UUID) (*safety.CheckResult, error) {
+	items, err := s.repo.GetItemsBySaleID(ctx, sale.ID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make([]uuid.UUID, 0, len(items))
+	for _, it := range items {
+		existing = append(existing, it.ProductID)
+	}
+
+	var allergies []string
+	if sale.PatientID != nil {
+		recorded, err := s.safety.GetPatientAllergies(ctx, pharmacyID, *sale.PatientID)
+		if err != nil {
+			return nil, err
+		}
+		allergies = append(allergies, recorded)
+	}
+	if sale.PrescriptionID != "" {
+		if rx, err := s.rxClient.GetPrescription(ctx, pharmacyID, sale.PrescriptionID); err == nil {
+			allergies = append(allergies, rx.Allergies)
+		}
+	}
+
+	check, err := s.safety.Check(ctx, pharmacyID, safety.CheckInput{
+		Products:  []uuid.UUID{productID},
+		Existing:  existing,
+		Allergies: allergies,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("drug safety check failed: %v", err)
+	}
+	return check, nil
+}
+
 func (s *salesService) UpdateItem(ctx context.Context, pharmacyID, saleID, itemID uuid.UUID, req UpdateItemRequest) error {
 	item, err := s.repo.GetItemByID(ctx, itemID)
 	if err != nil {
@@ -277,6 +443,9 @@ func (s *salesService) UpdateItem(ctx context.Context, pharmacyID, saleID, itemI
 	if sale.Status != StatusDraft && sale.Status != StatusPending {
 		return fmt.Errorf("cannot update items in a sale that is %s", sale.Status)
 	}
+	if item.IsFree {
+		return fmt.Errorf("free units follow the promotion; change the paid quantity instead")
+	}
 
 	// 1. Update reservation in Inventory Service if quantity changed
 	if item.Quantity != req.Quantity {
@@ -287,9 +456,10 @@ func (s *salesService) UpdateItem(ctx context.Context, pharmacyID, saleID, itemI
 		item.Quantity = req.Quantity
 	}
 
-	// 2. Update Discount if provided
+	// 2. Update Discount if provided; promotions are added on top again below
 	if req.DiscountPercentage != nil {
 		item.DiscountPercentage = *req.DiscountPercentage
+		item.PromoDiscPerc = 0
 	}
 
 	// 3. Recalculate Subtotal
@@ -303,7 +473,10 @@ func (s *salesService) UpdateItem(ctx context.Context, pharmacyID, saleID, itemI
 		return err
 	}
 
+	_ = s.applyPromotions(ctx, pharmacyID, saleID)
 	s.updateSaleTotal(ctx, pharmacyID, saleID)
+	s.keepHoldsAlive(ctx, pharmacyID, saleID)
+	_ = s.compliance.ClearSignOffs(ctx, pharmacyID, saleID)
 	return nil
 }
 
@@ -321,6 +494,9 @@ func (s *salesService) RemoveItem(ctx context.Context, pharmacyID, saleID, itemI
 	if err != nil {
 		return err
 	}
+	if item.IsFree {
+		return fmt.Errorf("free units follow the promotion; remove the paid item instead")
+	}
 
 	// Release reservation
 	err = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
@@ -332,7 +508,10 @@ func (s *salesService) RemoveItem(ctx context.Context, pharmacyID, saleID, itemI
 		return err
 	}
 
+	_ = s.applyPromotions(ctx, pharmacyID, saleID)
 	s.updateSaleTotal(ctx, pharmacyID, saleID)
+	s.keepHoldsAlive(ctx, pharmacyID, saleID)
+	_ = s.compliance.ClearSignOffs(ctx, pharmacyID, saleID)
 	return nil
 }
 
@@ -361,8 +540,365 @@ func (s *salesService) updateSaleTotal(ctx context.Context, pharmacyID, saleID u
 		sale.TotalAmount = total
 		sale.TotalDiscount = totalDiscount
 		sale.TotalTax = totalTax
-		_ = s.repo.UpdateSale(ctx, sale)
+		_ = s.repo.UpdateSale(ctx, nil, sale)
+	}
+}
+
+// applyPromotions re-evaluates the running promotions against the draft's lines.
+// Promotion discounts are folded into each line's discount, never past the batch
+// MaxDiscPerc, and free units are held from stock as lines of their own.
+func (s *salesService) applyPromotions(ctx context.Context, pharmacyID, saleID uuid.UUID) error {
+	items, err := s.repo.GetItemsBySaleID(ctx, saleID)
+	if err != nil {
+		return err
+	}
+
+	var paid, free []SaleItem
+	lines := make([]promotions.CartLine, 0, len(items))
+	for _, item := range items {
+		if item.IsFree {
+			free = append(free, item)
+			continue
+		}
+		paid = append(paid, item)
+		base := item.DiscountPercentage - item.PromoDiscPerc
+		lines = append(lines, promotions.CartLine{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Value:     unitPrice(item.MRP, base, item.TaxPercentage) * float64(item.Quantity),
+		})
+	}
+
+	benefits, err := s.promotions.Evaluate(ctx, pharmacyID, lines, pricingTime(ctx))
+	if err != nil {
+		return err
+	}
+
+	// 1. Spread each product's rupee discount over its lines by value
+	requested := make(map[uuid.UUID]float64)
+	for _, b := range benefits {
+		requested[b.ProductID] += b.Discount
+	}
+	productValue := make(map[uuid.UUID]float64)
+	for i, item := range paid {
+		productValue[item.ProductID] += lines[i].Value
+	}
+
+	given := make(map[uuid.UUID]float64)
+	for i := range paid {
+		item := &paid[i]
+		base := item.DiscountPercentage - item.PromoDiscPerc
+		effective := base
+		if amount := requested[item.ProductID]; amount > 0 && productValue[item.ProductID] > 0 {
+			listValue := item.MRP * (1 + item.TaxPercentage/100) * float64(item.Quantity)
+			if listValue > 0 {
+				effective = base + amount*lines[i].Value/productValue[item.ProductID]/listValue*100
+			}
+			if item.MaxDiscPerc > 0 && effective > item.MaxDiscPerc {
+				effective = math.Max(base, item.MaxDiscPerc)
+			}
+			effective = math.Min(money.Round2(effective), 100)
+		}
+
+		promo := money.Round2(effective - base)
+		given[item.ProductID] += item.MRP * (1 + item.TaxPercentage/100) * float64(item.Quantity) * promo / 100
+		if promo == item.PromoDiscPerc {
+			continue
+		}
+		item.DiscountPercentage = base + promo
+		item.PromoDiscPerc = promo
+		item.Subtotal = unitPrice(item.MRP, item.DiscountPercentage, item.TaxPercentage) * float64(item.Quantity)
+		if err := s.repo.UpdateItem(ctx, item); err != nil {
+			return err
+		}
+	}
+
+	// 2. Itemise what each promotion actually gave after the batch caps
+	var applied []AppliedPromotion
+	index := make(map[uuid.UUID]int)
+	for _, b := range benefits {
+		i, ok := index[b.PromotionID]
+		if !ok {
+			i = len(applied)
+			index[b.PromotionID] = i
+			applied = append(applied, AppliedPromotion{PromotionID: b.PromotionID, Name: b.Name, Type: b.Type})
+		}
+		if b.Discount > 0 && requested[b.ProductID] > 0 {
+			applied[i].Discount += b.Discount * given[b.ProductID] / requested[b.ProductID]
+		}
+		if b.Discount > 0 && given[b.ProductID] < requested[b.ProductID]-0.01 {
+			applied[i].Note = "capped at the batch maximum discount"
+		}
+	}
+
+	// 3. Hold the free units, re-reserving only where the entitlement changed
+	type freeKey struct{ promotionID, productID uuid.UUID }
+	held := make(map[freeKey][]SaleItem)
+	for _, item := range free {
+		if item.PromotionID == nil {
+			continue
+		}
+		k := freeKey{*item.PromotionID, item.ProductID}
+		held[k] = append(held[k], item)
+	}
+
+	for _, b := range benefits {
+		if b.FreeQuantity <= 0 {
+			continue
+		}
+		k := freeKey{b.PromotionID, b.ProductID}
+		heldQty := 0
+		for _, item := range held[k] {
+			heldQty += item.Quantity
+		}
+		if heldQty != b.FreeQuantity {
+			for _, item := range held[k] {
+				_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
+				_ = s.repo.DeleteItem(ctx, item.ID)
+			}
+			heldQty = s.reserveFreeUnits(ctx, pharmacyID, saleID, b.PromotionID, b.ProductID, b.FreeQuantity)
+		}
+		delete(held, k)
+
+		a := &applied[index[b.PromotionID]]
+		a.FreeQuantity += heldQty
+		if heldQty < b.FreeQuantity {
+			a.Note = fmt.Sprintf("only %d of %d free units in stock", heldQty, b.FreeQuantity)
+		}
+	}
+	// Free lines of schemes the bill no longer qualifies for
+	for _, items := range held {
+		for _, item := range items {
+			_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
+			_ = s.repo.DeleteItem(ctx, item.ID)
+		}
+	}
+	for _, item := range free {
+		if item.PromotionID == nil {
+			_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
+			_ = s.repo.DeleteItem(ctx, item.ID)
+		}
+	}
+
+	for i := range applied {
+		applied[i].Discount = money.Round2(applied[i].Discount)
+	}
+	return s.repo.ReplaceSalePromotions(ctx, saleID, applied)
+}
+
+type pricingTimeKey struct{}
+
+// WithPricingTime has promotions priced as at t instead of now, for bills rung
+// up at the counter earlier and synced later
+func WithPricingTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, pricingTimeKey{}, t)
+}
+
+func pricingTime(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(pricingTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// reserveFreeUnits holds up to qty free units of the product FEFO and returns how many it got
+func (s *salesService) reserveFreeUnits(ctx context.Context, pharmacyID, saleID, promotionID, productID uuid.UUID, qty int) int {
+	batches, err := s.inventory.GetAvailability(ctx, pharmacyID, productID)
+	if err != nil {
+		return 0
+	}
+
+	reserved := 0
+	for _, batch := range batches {
+		if reserved >= qty {
+			break
+		}
+		if batch.Quantity <= 0 || batch.ExpiryDate.Before(time.Now()) {
+			continue
+		}
+		take := batch.Quantity
+		if qty-reserved < take {
+			take = qty - reserved
+		}
+
+		resID, err := s.inventory.ReserveStock(ctx, pharmacyID, productID, batch.BatchID, take)
+		if err != nil {
+			continue
+		}
+		promoID := promotionID
+		item := &SaleItem{
+			ID:                 uuid.New(),
+			SaleID:             saleID,
+			ProductID:          productID,
+			MedicineName:       batch.MedicineName,
+			MedicineBrand:      batch.MedicineBrand,
+			BatchID:            batch.BatchID,
+			BatchNo:            batch.BatchNo,
+			Quantity:           take,
+			ExpiryDate:         batch.ExpiryDate,
+			MRP:                batch.MRP,
+			Price:              batch.UnitPrice,
+			DiscountPercentage: 100,
+			PromoDiscPerc:      100,
+			TaxPercentage:      batch.TotalTaxPercentage,
+			IsFree:             true,
+			PromotionID:        &promoID,
+			MaxDiscPerc:        batch.MaxDiscPerc,
+			ReservationID:      resID,
+			RackNo:             batch.RackNo,
+			CreatedAt:          time.Now(),
+		}
+		if err := s.repo.AddItem(ctx, item); err != nil {
+			_ = s.inventory.ReleaseStock(ctx, pharmacyID, resID)
+			continue
+		}
+		reserved += take
+	}
+	return reserved
+}
+
+// unitPrice is the tax inclusive price of one unit after the discount
+func unitPrice(mrp, discPerc, taxPerc float64) float64 {
+	taxable := mrp - (mrp*discPerc)/100
+	return taxable + (taxable*taxPerc)/100
+}
+
+// keepHoldsAlive treats any edit of a draft as activity and pushes its stock holds out
+func (s *salesService) keepHoldsAlive(ctx context.Context, pharmacyID, saleID uuid.UUID) {
+	items, err := s.repo.GetItemsBySaleID(ctx, saleID)
+	if err != nil {
+		return
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.ReservationID != "" {
+			ids = append(ids, item.ReservationID)
+		}
+	}
+	if len(ids) > 0 {
+		_, _ = s.inventory.ExtendReservations(ctx, pharmacyID, ids)
+	}
+}
+
+func (s *salesService) ListParkedBills(ctx context.Context, pharmacyID uuid.UUID, includeAbandoned bool, limit, offset int) ([]ParkedBill, int, error) {
+	statuses := []SaleStatus{StatusDraft, StatusPending}
+	if includeAbandoned {
+		statuses = append(statuses, StatusAbandoned)
+	}
+	return s.repo.ListParkedBills(ctx, pharmacyID, statuses, limit, offset)
+}
+
+// ResumeDraft reopens a parked or abandoned bill: live holds are extended and
+// lapsed ones are reserved again from the same batch. Lines whose stock is gone
+// are removed and returned so the cashier can re-add them
+func (s *salesService) ResumeDraft(ctx context.Context, pharmacyID, saleID uuid.UUID) (*ResumeResult, error) {
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status != StatusDraft && sale.Status != StatusPending && sale.Status != StatusAbandoned {
+		return nil, fmt.Errorf("cannot resume a sale that is %s", sale.Status)
+	}
+
+	items, err := s.repo.GetItemsBySaleID(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool)
+	var ids []string
+	for _, item := range items {
+		if item.ReservationID != "" {
+			ids = append(ids, item.ReservationID)
+		}
+	}
+	if len(ids) > 0 {
+		heldIDs, err := s.inventory.ExtendReservations(ctx, pharmacyID, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extend stock holds: %v", err)
+		}
+		for _, id := range heldIDs {
+			held[id] = true
+		}
+	}
+
+	dropped := []SaleItem{}
+	for _, item := range items {
+		if held[item.ReservationID] {
+			continue
+		}
+		if item.ReservationID != "" {
+			_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
+		}
+
+		resID, err := s.inventory.ReserveStock(ctx, pharmacyID, item.ProductID, item.BatchID, item.Quantity)
+		if err != nil {
+			if err := s.repo.DeleteItem(ctx, item.ID); err != nil {
+				return nil, err
+			}
+			dropped = append(dropped, item)
+			continue
+		}
+		if err := s.repo.UpdateItemReservation(ctx, item.ID, resID); err != nil {
+			_ = s.inventory.ReleaseStock(ctx, pharmacyID, resID)
+			return nil, err
+		}
+	}
+
+	if sale.Status == StatusAbandoned {
+		sale.Status = StatusPending
+	}
+	if err := s.repo.UpdateSale(ctx, nil, sale); err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		_ = s.applyPromotions(ctx, pharmacyID, saleID)
+		s.updateSaleTotal(ctx, pharmacyID, saleID)
+		_ = s.compliance.ClearSignOffs(ctx, pharmacyID, saleID)
+	}
+
+	detail, err := s.GetSaleWithDetails(ctx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	return &ResumeResult{Sale: detail, DroppedItems: dropped}, nil
+}
+
+// DiscardDraft cancels an unfinished bill and gives its stock back
+func (s *salesService) DiscardDraft(ctx context.Context, pharmacyID, saleID uuid.UUID) error {
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, saleID)
+	if err != nil {
+		return err
+	}
+	if sale.Status != StatusDraft && sale.Status != StatusPending && sale.Status != StatusAbandoned {
+		return fmt.Errorf("cannot discard a sale that is %s", sale.Status)
+	}
+
+	items, err := s.repo.GetItemsBySaleID(ctx, saleID)
+	if err != nil {
+		return err
+	}
+	// A hold that fails to release here still lapses on its own at expiry
+	for _, item := range items {
+		if item.ReservationID != "" {
+			_ = s.inventory.ReleaseStock(ctx, pharmacyID, item.ReservationID)
+		}
 	}
+
+	sale.Status = StatusCancelled
+	return s.repo.UpdateSale(ctx, nil, sale)
+}
+
+// RegisterJobs schedules the draft sweeper every minute, alongside the inventory hold sweeper
+func (s *salesService) RegisterJobs(jobs *scheduler.Scheduler) {
+	jobs.Register(&scheduler.Job{
+		Name:        "pharmacy-draft-sweeper",
+		Description: "Mark draft bills whose stock holds lapsed as abandoned",
+		Schedule:    scheduler.MustParseSchedule("* * * * *"),
+		Run: func(ctx context.Context, _ *sql.DB) (int64, error) {
+			return s.repo.AbandonStaleDrafts(ctx)
+		},
+	})
 }
 
 func (s *salesService) GetSaleWithDetails(ctx context.Context, pharmacyID, saleID uuid.UUID) (*Sale, error) {
@@ -402,8 +938,19 @@ func (s *salesService) GetSaleWithDetails(ctx context.Context, pharmacyID, saleI
 	// 3. Populate Payment Mode, Collected Amount & Handled By (Audit Info)
 	payments, err := s.repo.GetPaymentsBySaleID(ctx, saleID)
 	if err == nil && len(payments) > 0 {
-		sale.PaymentMode = string(payments[0].Mode)
-		sale.CollectedAmount = payments[0].Amount
+		received := make([]*Payment, 0, len(payments))
+		for i := range payments {
+			if payments[i].TransactionType != TxTypePayment {
+				continue
+			}
+			received = append(received, &payments[i])
+			if payments[i].Mode != PayModeCredit && payments[i].Mode != PayModeLoyalty {
+				sale.CollectedAmount += payments[i].Amount
+			}
+			sale.ChangeGiven += payments[i].Change
+		}
+		sale.PaymentMode = paymentModeLabel(received)
+		sale.Payments = payments
 	}
 	// For now we hardcode Pharmacist until we have a full Auth integration for this field
 	sale.HandledBy = "Pharmacist"
@@ -417,6 +964,25 @@ func (s *salesService) GetSaleWithDetails(ctx context.Context, pharmacyID, saleI
 		}
 	}
 
+	// 4b. Loyalty points the bill earned and spent
+	if sale.PatientID != nil && (sale.Status == StatusCompleted || sale.Status == StatusDispatched) {
+		if points, err := s.loyalty.GetSalePoints(ctx, pharmacyID, saleID); err == nil && (points.Earned > 0 || points.Redeemed > 0) {
+			sale.LoyaltyPoints = points
+		}
+	}
+
+	// 4c. Promotions applied on the bill
+	if applied, err := s.repo.GetSalePromotions(ctx, saleID); err == nil {
+		sale.Promotions = applied
+	}
+
+	// 5. Controlled drug requirements still open on the bill
+	if sale.Status == StatusDraft || sale.Status == StatusPending {
+		if req, err := s.evaluateCompliance(ctx, pharmacyID, sale, sale.Items); err == nil {
+			sale.Compliance = req
+		}
+	}
+
 	return sale, nil
 }
 
@@ -436,20 +1002,120 @@ func (s *salesService) FinalizeSale(ctx context.Context, pharmacyID, saleID uuid
 		return nil, fmt.Errorf("cannot finalize a sale with no items")
 	}
 
-	// 2. Confirm Stock in Inventory Service
-	for _, item := range items {
-		if item.ReservationID != "" {
-			err := s.inventory.ConfirmStock(ctx, pharmacyID, item.ReservationID)
-			if err != nil {
-				return nil, fmt.Errorf("failed to confirm stock for %s: %v", item.MedicineName, err)
-			}
-		}
+	// 1b. Rx-required items need a prescription with prescriber details; Schedule X needs two sign-offs
+	requirements, err := s.evaluateCompliance(ctx, pharmacyID, sale, items)
+	if err != nil {
+		return nil, err
+	}
+	if !requirements.Satisfied {
+		return nil, &compliance.RequirementsError{Requirements: requirements}
 	}
 
-	// 3. Generate Invoice Number
-	invoiceNo := fmt.Sprintf("INV-%s-%s", time.Now().Format("20060102"), uuid.New().String()[:8])
-	sale.InvoiceNumber = invoiceNo
-	sale.Status = StatusCompleted
+	// 1c. Adjust TotalAmount based on the patient's wallet, then settle the
+	//     bill before any stock is confirmed so a bad tender fails cleanly
+	billAmount := sale.TotalAmount // The bill alone, before the wallet is folded in
+	var walletBalance float64
+	var creditLimit *float64
+	if sale.PatientID != nil {
+		patient, err := s.repo.GetPatientByID(ctx, pharmacyID, *sale.PatientID)
+		if err == nil {
+			walletBalance = patient.DueAmount - patient.CreditAmount
+			creditLimit = patient.CreditLimit
+			if !req.BillOnly {
+				applyWalletBalance(sale, walletBalance)
+			}
+		}
+	}
+
+	payments, err := settlePayment(sale, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCreditLimit(sale, walletBalance, creditLimit); err != nil {
+		return nil, err
+	}
+
+	// 1d. Points tendered are checked against the patient's balance and the program's limits
+	var redeemAmount float64
+	var redeemPoints int
+	for _, p := range payments {
+		if p.Mode != PayModeLoyalty {
+			continue
+		}
+		redeemPoints, err = s.loyalty.QuoteRedemption(ctx, pharmacyID, *sale.PatientID, p.Amount, billAmount)
+		if err != nil {
+			return nil, err
+		}
+		redeemAmount = p.Amount
+		p.Reference = fmt.Sprintf("%d points", redeemPoints)
+	}
+
+	// 2. Confirm stock. The invoice number, payment, sale, wallet, points,
+	//    register and tax invoice writes share one transaction and land all-or-nothing; an in-process
+	//    inventory client confirms stock in it too, over HTTP each reservation
+	//    is confirmed on its own and its stock handed back if the sale does not commit
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var confirmed []clients.ReturnItemRequest
+	committed := false
+	defer func() {
+		if !committed && len(confirmed) > 0 {
+			s.returnConfirmedStock(ctx, pharmacyID, saleID, confirmed)
+		}
+	}()
+
+	// Re-check under lock so a double-submitted checkout cannot finalize twice
+	status, err := s.repo.LockSale(ctx, tx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusPending {
+		return nil, fmt.Errorf("only pending sales can be finalized, current status: %s", status)
+	}
+
+	// The bill was settled against the wallet read above; refuse if a payment landed since
+	if sale.PatientID != nil {
+		balance, _, err := s.repo.LockPatientWallet(ctx, tx, pharmacyID, *sale.PatientID)
+		if err != nil {
+			return nil, err
+		}
+		if math.Abs(balance-walletBalance) > 0.005 {
+			return nil, fmt.Errorf("the patient's balance changed while billing; reload the bill and try again")
+		}
+	}
+
+	txInventory, transactional := s.inventory.(clients.TxInventoryClient)
+
+	for _, item := range items {
+		if item.ReservationID == "" {
+			continue
+		}
+		if transactional {
+			err = txInventory.ConfirmStockTx(ctx, tx, pharmacyID, item.ReservationID)
+		} else {
+			err = s.inventory.ConfirmStock(ctx, pharmacyID, item.ReservationID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to confirm stock for %s: %v", item.MedicineName, err)
+		}
+		if !transactional {
+			confirmed = append(confirmed, clients.ReturnItemRequest{BatchID: item.BatchID, Quantity: item.Quantity, Reason: "Checkout did not complete"})
+		}
+	}
+
+	// 3. Number the invoice from the pharmacy's series; a checkout that fails hands the number back
+	invoiceNo, err := numbering.Next(ctx, tx, pharmacyID, numbering.DocSaleInvoice, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	completedAt := time.Now()
+	sale.InvoiceNumber = invoiceNo
+	sale.Status = StatusCompleted
+	sale.CompletedAt = &completedAt
 	sale.IsRecurring = req.IsRecurring
 	sale.DaysSupply = req.DaysSupply
 	if sale.IsRecurring && sale.DaysSupply > 0 {
@@ -458,71 +1124,80 @@ func (s *salesService) FinalizeSale(ctx context.Context, pharmacyID, saleID uuid
 	}
 	sale.UpdatedAt = time.Now()
 
-	// 3b. Adjust TotalAmount based on existing Patient balances
-	if sale.PatientID != nil {
-		patient, err := s.repo.GetPatientByID(ctx, pharmacyID, *sale.PatientID)
-		if err == nil {
-			// Save the snapshotted applied values into the sale
-			sale.AppliedCredit = patient.CreditAmount
-			sale.AppliedDue = patient.DueAmount
-
-			// Apply existing due and credit to the current bill
-			sale.TotalAmount = sale.TotalAmount + patient.DueAmount - patient.CreditAmount
-			if sale.TotalAmount < 0 {
-				sale.TotalAmount = 0
-			}
+	// 4. Record Payments
+	for _, payment := range payments {
+		if err := s.repo.AddPayment(ctx, tx, payment); err != nil {
+			return nil, fmt.Errorf("failed to record payment: %v", err)
 		}
 	}
 
-	var paymentAmount float64
-	var generatedCredit float64
-	var generatedDue float64
-
-	if sale.PatientID != nil && req.WalletAction != "" && req.WalletAmount > 0 {
-		collectedAmount := req.WalletAmount
-		paymentAmount = collectedAmount
+	// 5. Update Sale in DB
+	if err := s.repo.UpdateSale(ctx, tx, sale); err != nil {
+		return nil, fmt.Errorf("failed to update sale status: %v", err)
+	}
 
-		if req.WalletAction == "CREDIT" {
-			generatedCredit = collectedAmount - sale.TotalAmount
-			if generatedCredit < 0 {
-				generatedCredit = 0
-			}
-			sale.GeneratedCredit = generatedCredit
-			sale.GeneratedDue = 0.00
-		} else if req.WalletAction == "DUE" {
-			generatedDue = sale.TotalAmount - collectedAmount
-			if generatedDue < 0 {
-				generatedDue = 0
+	// 5a. Post the bill's effect on the Patient Wallet and loyalty points
+	if sale.PatientID != nil {
+		entries := saleWalletEntries(sale, req.DispensedBy, req.DispensedByName)
+		if len(entries) > 0 {
+			if err := s.repo.AddWalletEntries(ctx, tx, pharmacyID, *sale.PatientID, entries); err != nil {
+				return nil, fmt.Errorf("failed to update patient wallet: %v", err)
 			}
-			sale.GeneratedDue = generatedDue
-			sale.GeneratedCredit = 0.00
 		}
-	} else {
-		paymentAmount = sale.TotalAmount
-		sale.GeneratedCredit = 0.00
-		sale.GeneratedDue = 0.00
+
+		_, err := s.loyalty.SettleSale(ctx, tx, pharmacyID, loyalty.SaleSettlement{
+			PatientID:     *sale.PatientID,
+			SaleID:        saleID,
+			InvoiceNumber: invoiceNo,
+			BillAmount:    billAmount,
+			RedeemAmount:  redeemAmount,
+			RedeemPoints:  redeemPoints,
+			UserID:        req.DispensedBy,
+			UserName:      req.DispensedByName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to post loyalty points: %v", err)
+		}
 	}
 
-	// 4. Record Payment
-	payment := &Payment{
-		ID:              uuid.New(),
-		SaleID:          saleID,
-		TransactionType: TxTypePayment,
-		Mode:            req.PaymentMode,
-		Amount:          paymentAmount,
-		CreatedAt:       time.Now(),
+	// 5b. Enter Schedule H1/X lines in the controlled drug register
+	if len(requirements.RegisterProducts) > 0 {
+		lines := make([]compliance.DispenseLine, 0, len(items))
+		for _, item := range items {
+			lines = append(lines, compliance.DispenseLine{
+				ProductID:     item.ProductID,
+				MedicineName:  item.MedicineName,
+				MedicineBrand: item.MedicineBrand,
+				BatchID:       item.BatchID,
+				BatchNo:       item.BatchNo,
+				ExpiryDate:    item.ExpiryDate,
+				Quantity:      item.Quantity,
+			})
+		}
+		_, err := s.compliance.RecordDispense(ctx, tx, pharmacyID, compliance.DispenseInput{
+			SaleID:          saleID,
+			InvoiceNumber:   invoiceNo,
+			Patient:         s.compliancePatient(ctx, pharmacyID, sale),
+			Lines:           lines,
+			DispensedBy:     req.DispensedBy,
+			DispensedByName: req.DispensedByName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to enter the controlled drug register: %v", err)
+		}
 	}
 
-	if err := s.repo.AddPayment(ctx, payment); err != nil {
-		return nil, fmt.Errorf("failed to record payment: %v", err)
+	// 5c. Issue the GST tax invoice (HSN-wise, CGST/SGST or IGST by place of supply)
+	if _, err := s.issueTaxInvoice(ctx, tx, pharmacyID, sale, items, req.BuyerGSTIN, req.PlaceOfSupply); err != nil {
+		return nil, fmt.Errorf("failed to issue the tax invoice: %v", err)
 	}
 
-	// 5. Update Sale in DB
-	if err := s.repo.UpdateSale(ctx, sale); err != nil {
-		return nil, fmt.Errorf("failed to update sale status: %v", err)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to complete sale: %v", err)
 	}
+	committed = true
 
-	// 5b. Update Patient Recurring Status
+	// 5d. Update Patient Recurring Status
 	if req.IsRecurring && sale.PatientID != nil {
 		p := &Patient{
 			ID:          *sale.PatientID,
@@ -534,32 +1209,213 @@ func (s *salesService) FinalizeSale(ctx context.Context, pharmacyID, saleID uuid
 		_ = s.repo.UpsertPatient(ctx, p)
 	}
 
-	// 5c. Update Patient Wallet
-	if sale.PatientID != nil {
-		// First, clear the existing balances because they were applied to the current bill's TotalAmount
-		_ = s.repo.ClearPatientBalances(ctx, pharmacyID, *sale.PatientID)
-
-		// Then, update patient wallet in DB with calculated amounts
-		if req.WalletAction == "CREDIT" && generatedCredit > 0 {
-			err := s.repo.UpdatePatientWallet(ctx, pharmacyID, *sale.PatientID, "CREDIT", generatedCredit)
-			if err != nil {
-				return nil, fmt.Errorf("failed to add new patient wallet balance: %v", err)
+	// 6. Update Prescription Status
+	if sale.PrescriptionID != "" {
+		_ = s.rxClient.UpdateStatus(ctx, pharmacyID, sale.PrescriptionID, "COMPLETED")
+		_ = s.rxClient.UpdateBillingInfo(ctx, pharmacyID, sale.PrescriptionID, sale.TotalAmount, paymentModeLabel(payments), "Pharmacist", invoiceNo)
+	}
+
+	return s.GetSaleWithDetails(ctx, pharmacyID, saleID)
+}
+
+// applyWalletBalance folds the patient's wallet into the bill: an outstanding
+// due is added to it, store credit is spent on it up to the bill amount
+func applyWalletBalance(sale *Sale, balance float64) {
+	sale.AppliedDue = 0
+	sale.AppliedCredit = 0
+	if balance > 0 {
+		sale.AppliedDue = balance
+		sale.TotalAmount += balance
+	} else if balance < 0 {
+		sale.AppliedCredit = math.Min(-balance, sale.TotalAmount)
+		sale.TotalAmount -= sale.AppliedCredit
+	}
+}
+
+// checkCreditLimit refuses a bill that leaves the patient owing more than their limit
+func checkCreditLimit(sale *Sale, balance float64, limit *float64) error {
+	if limit == nil || sale.GeneratedDue <= 0 {
+		return nil
+	}
+	after := balance - sale.AppliedDue + sale.AppliedCredit + sale.GeneratedDue - sale.GeneratedCredit
+	if after > *limit+0.005 {
+		return fmt.Errorf("this bill leaves %.2f owed, above the patient's credit limit of %.2f", after, *limit)
+	}
+	return nil
+}
+
+// saleWalletEntries are the ledger lines a completed bill posts to the patient's wallet
+func saleWalletEntries(sale *Sale, userID uuid.UUID, userName string) []WalletEntry {
+	var createdBy *uuid.UUID
+	if userID != uuid.Nil {
+		createdBy = &userID
+	}
+	now := time.Now()
+	line := func(t WalletEntryType, debit, credit float64) WalletEntry {
+		return WalletEntry{
+			ID:            uuid.New(),
+			Type:          t,
+			Debit:         debit,
+			Credit:        credit,
+			SaleID:        &sale.ID,
+			ReferenceNo:   sale.InvoiceNumber,
+			CreatedBy:     createdBy,
+			CreatedByName: userName,
+			CreatedAt:     now,
+		}
+	}
+
+	var entries []WalletEntry
+	if sale.AppliedDue > 0 {
+		entries = append(entries, line(WalletDueSettled, 0, sale.AppliedDue))
+	}
+	if sale.AppliedCredit > 0 {
+		entries = append(entries, line(WalletCreditRedeemed, sale.AppliedCredit, 0))
+	}
+	if sale.GeneratedDue > 0 {
+		entries = append(entries, line(WalletSaleDue, sale.GeneratedDue, 0))
+	}
+	if sale.GeneratedCredit > 0 {
+		entries = append(entries, line(WalletSaleCredit, 0, sale.GeneratedCredit))
+	}
+	return entries
+}
+
+// settlePayment turns the checkout request into payment rows and sets the
+// credit or due the bill leaves on the patient's wallet. Without tenders the
+// single PaymentMode and wallet fields are used as older clients send them
+func settlePayment(sale *Sale, req FinalizeSaleRequest) ([]*Payment, error) {
+	sale.GeneratedCredit = 0.00
+	sale.GeneratedDue = 0.00
+
+	if len(req.Tenders) == 0 {
+		paymentAmount := sale.TotalAmount
+		if sale.PatientID != nil && req.WalletAction != "" && req.WalletAmount > 0 {
+			paymentAmount = req.WalletAmount
+			if req.WalletAction == "CREDIT" && req.WalletAmount > sale.TotalAmount {
+				sale.GeneratedCredit = req.WalletAmount - sale.TotalAmount
+			} else if req.WalletAction == "DUE" && req.WalletAmount < sale.TotalAmount {
+				sale.GeneratedDue = sale.TotalAmount - req.WalletAmount
+			}
+		}
+		return []*Payment{newPayment(sale.ID, req.PaymentMode, paymentAmount)}, nil
+	}
+
+	// Only cash can be overpaid; the excess goes back as change or, when the
+	// counter asks for it, onto the patient's wallet as store credit
+	var cash, other, onAccount float64
+	var cashTender *Tender
+	var hasCredit, hasPoints bool
+	for i, t := range req.Tenders {
+		switch t.Mode {
+		case PayModeCash:
+			if cashTender != nil {
+				return nil, fmt.Errorf("only one CASH tender is allowed per bill")
 			}
-		} else if req.WalletAction == "DUE" && generatedDue > 0 {
-			err := s.repo.UpdatePatientWallet(ctx, pharmacyID, *sale.PatientID, "DUE", generatedDue)
-			if err != nil {
-				return nil, fmt.Errorf("failed to add new patient wallet balance: %v", err)
+			cashTender = &req.Tenders[i]
+			cash = t.Amount
+		case PayModeCredit:
+			if hasCredit {
+				return nil, fmt.Errorf("only one CREDIT tender is allowed per bill")
 			}
+			if sale.PatientID == nil {
+				return nil, fmt.Errorf("a CREDIT tender needs a patient on the bill")
+			}
+			hasCredit = true
+			onAccount = t.Amount
+		case PayModeCard:
+			if t.Reference != "" && !isCardLast4(t.Reference) {
+				return nil, fmt.Errorf("card reference must be the last 4 digits of the card")
+			}
+			other += t.Amount
+		case PayModeLoyalty:
+			if hasPoints {
+				return nil, fmt.Errorf("only one LOYALTY tender is allowed per bill")
+			}
+			if sale.PatientID == nil {
+				return nil, fmt.Errorf("a LOYALTY tender needs a patient on the bill")
+			}
+			hasPoints = true
+			other += t.Amount
+		default:
+			other += t.Amount
 		}
 	}
 
-	// 6. Update Prescription Status
-	if sale.PrescriptionID != "" {
-		_ = s.rxClient.UpdateStatus(ctx, pharmacyID, sale.PrescriptionID, "COMPLETED")
-		_ = s.rxClient.UpdateBillingInfo(ctx, pharmacyID, sale.PrescriptionID, sale.TotalAmount, string(req.PaymentMode), "Pharmacist", invoiceNo)
+	const epsilon = 0.005
+	if other+onAccount > sale.TotalAmount+epsilon {
+		return nil, fmt.Errorf("UPI, CARD, CREDIT and LOYALTY tenders (%.2f) cannot exceed the bill of %.2f", other+onAccount, sale.TotalAmount)
+	}
+	excess := cash + other + onAccount - sale.TotalAmount
+	if excess < -epsilon {
+		return nil, fmt.Errorf("tenders fall short of the bill of %.2f by %.2f", sale.TotalAmount, -excess)
+	}
+	if excess < 0 {
+		excess = 0
+	}
+	if hasCredit && excess > epsilon {
+		return nil, fmt.Errorf("cash overpays the bill by %.2f while %.2f is put on account; reduce the CREDIT tender", excess, onAccount)
 	}
 
-	return s.GetSaleWithDetails(ctx, pharmacyID, saleID)
+	var change float64
+	if excess > epsilon {
+		if req.WalletAction == "CREDIT" && sale.PatientID != nil {
+			sale.GeneratedCredit = excess
+		} else {
+			change = excess
+		}
+	}
+	sale.GeneratedDue = onAccount
+
+	payments := make([]*Payment, 0, len(req.Tenders))
+	for _, t := range req.Tenders {
+		p := newPayment(sale.ID, t.Mode, t.Amount)
+		p.Reference = t.Reference
+		if t.Mode == PayModeCash {
+			p.Tendered = cashTender.Amount
+			p.Change = change
+			p.Amount = cashTender.Amount - change
+		}
+		payments = append(payments, p)
+	}
+	return payments, nil
+}
+
+func newPayment(saleID uuid.UUID, mode PaymentMode, amount float64) *Payment {
+	return &Payment{
+		ID:              uuid.New(),
+		SaleID:          saleID,
+		TransactionType: TxTypePayment,
+		Mode:            mode,
+		Amount:          amount,
+		CreatedAt:       time.Now(),
+	}
+}
+
+func isCardLast4(ref string) bool {
+	if len(ref) != 4 {
+		return false
+	}
+	for _, c := range ref {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// paymentModeLabel is the bill's single payment mode, or SPLIT when it was paid several ways
+func paymentModeLabel(payments []*Payment) string {
+	if len(payments) == 0 {
+		return ""
+	}
+	mode := payments[0].Mode
+	for _, p := range payments[1:] {
+		if p.Mode != mode {
+			return "SPLIT"
+		}
+	}
+	return string(mode)
 }
 
 func (s *salesService) DispatchSale(ctx context.Context, pharmacyID, saleID uuid.UUID) (*Sale, error) {
@@ -579,7 +1435,7 @@ func (s *salesService) DispatchSale(ctx context.Context, pharmacyID, saleID uuid
 	sale.UpdatedAt = time.Now()
 
 	// 4. Update Sale in DB
-	if err := s.repo.UpdateSale(ctx, sale); err != nil {
+	if err := s.repo.UpdateSale(ctx, nil, sale); err != nil {
 		return nil, fmt.Errorf("failed to update sale status: %v", err)
 	}
 
@@ -605,17 +1461,35 @@ func (s *salesService) ProcessReturn(ctx context.Context, pharmacyID uuid.UUID,
 		return nil, fmt.Errorf("sale not found: %w", err)
 	}
 
-	if sale.Status != StatusCompleted && sale.Status != StatusDispatched {
-		return nil, fmt.Errorf("only completed or dispatched sales can be returned")
-	}
-
 	// 1.5 Safety Check: Return Window (30 Days)
 	if time.Since(sale.CreatedAt) > 30*24*time.Hour {
 		return nil, fmt.Errorf("returns are only allowed within 30 days of the original purchase date (Sold on: %s)", sale.CreatedAt.Format("02 Jan 2006"))
 	}
 
+	if req.RefundMode == "CREDIT" && sale.PatientID == nil {
+		return nil, fmt.Errorf("cannot refund to store credit for walk-in customer with no profile")
+	}
+
+	// The return, restock, credit note, register lines, refund and points reversal
+	// share one transaction; an in-process inventory client restocks in it too,
+	// over HTTP the stock goes back just before the commit
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Re-check under lock so two returns against one sale cannot both pass the quantity check
+	status, err := s.repo.LockSale(ctx, tx, pharmacyID, req.SaleID)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusCompleted && status != StatusDispatched {
+		return nil, fmt.Errorf("only completed or dispatched sales can be returned")
+	}
+
 	// 2. Fetch original items to validate quantities
-	originalItems, err := s.repo.GetItemsBySaleID(ctx, req.SaleID)
+	originalItems, err := s.repo.GetItemsBySaleIDTx(ctx, tx, req.SaleID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch sale items: %w", err)
 	}
@@ -677,20 +1551,12 @@ func (s *salesService) ProcessReturn(ctx context.Context, pharmacyID uuid.UUID,
 		}
 	}
 
-	// 4. Update Inventory if needed
-	if len(invReturnReq) > 0 {
-		if err := s.inventory.ReturnItems(ctx, pharmacyID, invReturnReq); err != nil {
-			return nil, fmt.Errorf("failed to update inventory: %w", err)
-		}
-	}
-
-	// 5. Save Return to DB
+	// 4. Save Return to DB
 	ret := &SaleReturn{
 		ID:            returnID,
 		PharmacyID:    pharmacyID,
 		SaleID:        req.SaleID,
 		InvoiceNumber: sale.InvoiceNumber,
-		ReturnNumber:  fmt.Sprintf("RET-%s-%s", time.Now().Format("20060102"), uuid.New().String()[:8]),
 		Status:        ReturnStatusCompleted,
 		TotalRefund:   totalRefund,
 		Reason:        req.Reason,
@@ -701,22 +1567,51 @@ func (s *salesService) ProcessReturn(ctx context.Context, pharmacyID uuid.UUID,
 		Items:         returnItems,
 	}
 
-	if err := s.repo.CreateReturn(ctx, ret, returnItems); err != nil {
+	if err := s.repo.CreateReturn(ctx, tx, ret, returnItems); err != nil {
 		return nil, fmt.Errorf("failed to save return record: %w", err)
 	}
 
-	// 5.5 If RefundMode is CREDIT, update patient wallet
+	// 4.1 Issue the GST credit note against the sale's tax invoice
+	if _, err := s.issueCreditNote(ctx, tx, pharmacyID, sale, ret, itemMap); err != nil {
+		return nil, fmt.Errorf("failed to issue credit note: %w", err)
+	}
+
+	// 4.2 Returned Schedule H1/X items are entered in the register against the original dispense
+	registerLines := make([]compliance.ReturnLine, 0, len(returnItems))
+	for _, item := range returnItems {
+		registerLines = append(registerLines, compliance.ReturnLine{
+			ProductID: item.ProductID,
+			BatchID:   item.BatchID,
+			Quantity:  item.Quantity,
+		})
+	}
+	if _, err := s.compliance.RecordReturn(ctx, tx, pharmacyID, compliance.ReturnInput{
+		SaleID:       req.SaleID,
+		ReturnNumber: ret.ReturnNumber,
+		Lines:        registerLines,
+		HandledBy:    handledBy,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to enter the return in the controlled drug register: %w", err)
+	}
+
+	// 4.5 If RefundMode is CREDIT, update patient wallet
 	if req.RefundMode == "CREDIT" {
-		if sale.PatientID == nil {
-			return nil, fmt.Errorf("cannot refund to store credit for walk-in customer with no profile")
-		}
-		err := s.repo.UpdatePatientWallet(ctx, pharmacyID, *sale.PatientID, "CREDIT", totalRefund)
+		err := s.repo.AddWalletEntries(ctx, tx, pharmacyID, *sale.PatientID, []WalletEntry{{
+			ID:            uuid.New(),
+			Type:          WalletReturnCredit,
+			Credit:        totalRefund,
+			SaleID:        &sale.ID,
+			ReturnID:      &returnID,
+			ReferenceNo:   ret.ReturnNumber,
+			CreatedByName: handledBy,
+			CreatedAt:     time.Now(),
+		}})
 		if err != nil {
 			return nil, fmt.Errorf("failed to update patient wallet: %w", err)
 		}
 	}
 
-	// 6. Record Refund in Payments table
+	// 5. Record Refund in Payments table
 	refundPayment := &Payment{
 		ID:              uuid.New(),
 		SaleID:          req.SaleID,
@@ -727,10 +1622,33 @@ func (s *salesService) ProcessReturn(ctx context.Context, pharmacyID uuid.UUID,
 		CreatedAt:       time.Now(),
 	}
 
-	if err := s.repo.AddPayment(ctx, refundPayment); err != nil {
+	if err := s.repo.AddPayment(ctx, tx, refundPayment); err != nil {
 		return nil, fmt.Errorf("failed to record refund payment: %w", err)
 	}
 
+	// 6. Take back the loyalty points the returned items earned
+	if sale.PatientID != nil {
+		if _, err := s.loyalty.ReverseReturn(ctx, tx, pharmacyID, *sale.PatientID, sale.ID, returnID, ret.ReturnNumber, totalRefund, handledBy); err != nil {
+			return nil, fmt.Errorf("failed to reverse loyalty points: %w", err)
+		}
+	}
+
+	// 7. Put sellable stock back
+	if len(invReturnReq) > 0 {
+		if txInventory, ok := s.inventory.(clients.TxInventoryClient); ok {
+			err = txInventory.ReturnItemsTx(ctx, tx, pharmacyID, invReturnReq)
+		} else {
+			err = s.inventory.ReturnItems(ctx, pharmacyID, invReturnReq)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update inventory: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit return: %w", err)
+	}
+
 	return ret, nil
 }
 
@@ -738,6 +1656,31 @@ func (s *salesService) GetStats(ctx context.Context, pharmacyID uuid.UUID, targe
 	return s.repo.GetStats(ctx, pharmacyID, targetDate, startDate, endDate, granularity)
 }
 
+func (s *salesService) GetDayCollection(ctx context.Context, pharmacyID uuid.UUID, date time.Time) (*DayCollection, error) {
+	from := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	to := from.Add(24*time.Hour - time.Nanosecond)
+
+	dc, err := s.repo.GetDayCollection(ctx, pharmacyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	dc.Date = from.Format("2006-01-02")
+	for _, m := range dc.Modes {
+		switch m.Mode {
+		case PayModeCash:
+			dc.CashInDrawer = m.Net
+			dc.Collected += m.Net
+		case PayModeCredit:
+			dc.OnAccount = m.Net
+		case PayModeLoyalty:
+			dc.PointsRedeemed = m.Net
+		default:
+			dc.Collected += m.Net
+		}
+	}
+	return dc, nil
+}
+
 func (s *salesService) ListReturns(ctx context.Context, pharmacyID uuid.UUID) ([]SaleReturn, error) {
 	return s.repo.ListReturns(ctx, pharmacyID)
 }
@@ -755,7 +1698,14 @@ func (s *salesService) GetPatientStats(ctx context.Context, pharmacyID uuid.UUID
 }
 
 func (s *salesService) GetPatientByID(ctx context.Context, pharmacyID, id uuid.UUID) (*Patient, error) {
-	return s.repo.GetPatientByID(ctx, pharmacyID, id)
+	patient, err := s.repo.GetPatientByID(ctx, pharmacyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if summary, err := s.loyalty.GetSummary(ctx, pharmacyID, id); err == nil {
+		patient.Loyalty = summary
+	}
+	return patient, nil
 }
 
 func (s *salesService) GetPatientSales(ctx context.Context, pharmacyID, patientID uuid.UUID, limit, offset int) ([]PatientPurchase, int, error) {
@@ -766,6 +1716,131 @@ func (s *salesService) GetPatientReturns(ctx context.Context, pharmacyID, patien
 	return s.repo.GetPatientReturns(ctx, pharmacyID, patientID, limit, offset)
 }
 
+// GetWalletStatement runs the patient's ledger between from and to (inclusive dates);
+// earlier lines are rolled into the brought-forward balance
+func (s *salesService) GetWalletStatement(ctx context.Context, pharmacyID, patientID uuid.UUID, from, to *time.Time) (*WalletStatement, error) {
+	patient, err := s.repo.GetPatientByID(ctx, pharmacyID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.ListWalletEntries(ctx, pharmacyID, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &WalletStatement{
+		PatientID:    patientID,
+		PatientName:  patient.Name,
+		PatientPhone: patient.Phone,
+		From:         from,
+		To:           to,
+		DueAmount:    patient.DueAmount,
+		CreditAmount: patient.CreditAmount,
+		CreditLimit:  patient.CreditLimit,
+		Entries:      []WalletEntry{},
+	}
+	var end time.Time
+	if to != nil {
+		end = to.AddDate(0, 0, 1)
+	}
+	balance := 0.0
+	for _, e := range entries {
+		if to != nil && !e.Date.Before(end) {
+			break
+		}
+		balance = money.Round2(balance + e.Debit - e.Credit)
+		if from != nil && e.Date.Before(*from) {
+			st.BroughtForward = balance
+			continue
+		}
+		e.Balance = balance
+		st.TotalDebit = money.Round2(st.TotalDebit + e.Debit)
+		st.TotalCredit = money.Round2(st.TotalCredit + e.Credit)
+		st.Entries = append(st.Entries, e)
+	}
+	st.ClosingBalance = balance
+	return st, nil
+}
+
+func (s *salesService) CollectDue(ctx context.Context, pharmacyID, patientID, userID uuid.UUID, userName string, req CollectDueRequest) (*WalletEntry, error) {
+	return s.postWalletEntry(ctx, pharmacyID, patientID, func(tx *sql.Tx, balance float64) (*WalletEntry, error) {
+		if balance <= 0 {
+			return nil, fmt.Errorf("patient has no outstanding due")
+		}
+		receiptNo, err := s.repo.NextReceiptNumber(ctx, tx, pharmacyID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &WalletEntry{
+			Type:             WalletDuePayment,
+			Credit:           req.Amount,
+			ReferenceNo:      receiptNo,
+			PaymentMode:      req.PaymentMode,
+			PaymentReference: req.Reference,
+			Reason:           req.Notes,
+			CreatedBy:        &userID,
+			CreatedByName:    userName,
+		}, nil
+	})
+}
+
+func (s *salesService) AdjustWallet(ctx context.Context, pharmacyID, patientID, userID uuid.UUID, userName string, req WalletAdjustmentRequest) (*WalletEntry, error) {
+	return s.postWalletEntry(ctx, pharmacyID, patientID, func(tx *sql.Tx, balance float64) (*WalletEntry, error) {
+		e := &WalletEntry{
+			Type:          WalletAdjustment,
+			Reason:        req.Reason,
+			CreatedBy:     &userID,
+			CreatedByName: userName,
+		}
+		if req.Direction == "DUE" {
+			e.Debit = req.Amount
+		} else {
+			e.Credit = req.Amount
+		}
+		return e, nil
+	})
+}
+
+// postWalletEntry writes one ledger line under a lock on the patient so the
+// returned running balance is exact
+func (s *salesService) postWalletEntry(ctx context.Context, pharmacyID, patientID uuid.UUID, build func(tx *sql.Tx, balance float64) (*WalletEntry, error)) (*WalletEntry, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	balance, _, err := s.repo.LockPatientWallet(ctx, tx, pharmacyID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	e, err := build(tx, balance)
+	if err != nil {
+		return nil, err
+	}
+	e.ID = uuid.New()
+	e.PharmacyID = pharmacyID
+	e.PatientID = patientID
+	e.CreatedAt = time.Now()
+	e.Date = e.CreatedAt
+	e.Balance = money.Round2(balance + e.Debit - e.Credit)
+
+	if err := s.repo.AddWalletEntries(ctx, tx, pharmacyID, patientID, []WalletEntry{*e}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update patient wallet: %v", err)
+	}
+	return e, nil
+}
+
+func (s *salesService) SetCreditLimit(ctx context.Context, pharmacyID, patientID uuid.UUID, req SetCreditLimitRequest) (*Patient, error) {
+	if err := s.repo.SetPatientCreditLimit(ctx, pharmacyID, patientID, req.CreditLimit); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPatientByID(ctx, pharmacyID, patientID)
+}
+
 func (s *salesService) ListSales(ctx context.Context, pharmacyID uuid.UUID, limit, offset int, startDate, endDate time.Time, paymentMode, search string) ([]Sale, int, error) {
 	if !startDate.IsZero() && !endDate.IsZero() {
 		days := endDate.Sub(startDate).Hours() / 24
@@ -779,3 +1854,287 @@ func (s *salesService) ListSales(ctx context.Context, pharmacyID uuid.UUID, limi
 func (s *salesService) GetRecurringRefillsReport(ctx context.Context, pharmacyID uuid.UUID) ([]RecurringRefillReportItem, error) {
 	return s.repo.GetRecurringRefillsReport(ctx, pharmacyID)
 }
+
+func (s *salesService) evaluateCompliance(ctx context.Context, pharmacyID uuid.UUID, sale *Sale, items []SaleItem) (*compliance.Requirements, error) {
+	productIDs := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	return s.compliance.Evaluate(ctx, pharmacyID, sale.ID, productIDs, s.compliancePatient(ctx, pharmacyID, sale))
+}
+
+func (s *salesService) compliancePatient(ctx context.Context, pharmacyID uuid.UUID, sale *Sale) compliance.Patient {
+	p := compliance.Patient{
+		ID:      sale.PatientID,
+		Name:    sale.CustomerName,
+		Phone:   sale.CustomerPhone,
+		Address: sale.CustomerAddress,
+	}
+	if p.Address == "" && sale.PatientID != nil {
+		if patient, err := s.repo.GetPatientByID(ctx, pharmacyID, *sale.PatientID); err == nil && patient != nil {
+			p.Address = patient.Address
+		}
+	}
+	return p
+}
+
+func (s *salesService) GetCompliance(ctx context.Context, pharmacyID, saleID uuid.UUID) (*compliance.Requirements, error) {
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.GetItemsBySaleID(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	return s.evaluateCompliance(ctx, pharmacyID, sale, items)
+}
+
+func (s *salesService) SetPrescriber(ctx context.Context, pharmacyID, saleID, userID uuid.UUID, userName string, req compliance.SetPrescriberRequest) (*compliance.PrescriberDetails, error) {
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status != StatusDraft && sale.Status != StatusPending {
+		return nil, fmt.Errorf("cannot change prescriber details on a sale that is %s", sale.Status)
+	}
+
+	d := compliance.PrescriberDetails{
+		SaleID:            saleID,
+		PrescriptionRef:   req.PrescriptionRef,
+		PrescriberName:    req.PrescriberName,
+		PrescriberRegNo:   req.PrescriberRegNo,
+		PrescriberAddress: req.PrescriberAddress,
+		PatientAddress:    req.PatientAddress,
+	}
+	if req.PrescriptionDate != "" {
+		date, err := time.Parse("2006-01-02", req.PrescriptionDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prescription_date, expected YYYY-MM-DD")
+		}
+		d.PrescriptionDate = &date
+	}
+
+	// Prescription sales already link an Rx; default the reference, doctor and date from it
+	if sale.PrescriptionID != "" {
+		if d.PrescriptionRef == "" {
+			d.PrescriptionRef = sale.PrescriptionID
+		}
+		if d.PrescriberName == "" || d.PrescriptionDate == nil {
+			if rx, err := s.rxClient.GetPrescription(ctx, pharmacyID, sale.PrescriptionID); err == nil {
+				if d.PrescriberName == "" {
+					d.PrescriberName = rx.DoctorName
+				}
+				if d.PrescriptionDate == nil && !rx.Date.IsZero() {
+					date := rx.Date
+					d.PrescriptionDate = &date
+				}
+			}
+		}
+	}
+
+	return s.compliance.SavePrescriber(ctx, pharmacyID, userID, userName, d)
+}
+
+func (s *salesService) SignOff(ctx context.Context, pharmacyID, saleID, userID uuid.UUID, userName string) ([]compliance.SignOff, error) {
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status != StatusDraft && sale.Status != StatusPending {
+		return nil, fmt.Errorf("cannot sign off a sale that is %s", sale.Status)
+	}
+	return s.compliance.SignOff(ctx, pharmacyID, saleID, userID, userName)
+}
+
+// returnConfirmedStock puts back the stock an HTTP inventory client deducted for
+// a checkout that rolled back. It runs after the request may have been cancelled,
+// so it keeps the request's values but not its deadline.
+func (s *salesService) returnConfirmedStock(ctx context.Context, pharmacyID, saleID uuid.UUID, items []clients.ReturnItemRequest) {
+	if err := s.inventory.ReturnItems(context.WithoutCancel(ctx), pharmacyID, items); err != nil {
+		log.Printf("sale %s: failed to return stock confirmed before the checkout rolled back: %v", saleID, err)
+	}
+}
+
+func (s *salesService) issueTaxInvoice(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, sale *Sale, items []SaleItem, buyerGSTIN, placeOfSupply string) (*gst.TaxDocument, error) {
+	lines := make([]gst.InvoiceLine, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, gst.InvoiceLine{
+			ProductID:          item.ProductID,
+			MedicineName:       item.MedicineName,
+			BatchNo:            item.BatchNo,
+			Quantity:           item.Quantity,
+			MRP:                item.MRP,
+			DiscountPercentage: item.DiscountPercentage,
+			TaxPercentage:      item.TaxPercentage,
+		})
+	}
+	return s.gst.IssueInvoice(ctx, tx, pharmacyID, gst.InvoiceInput{
+		SaleID:        sale.ID,
+		InvoiceNo:     sale.InvoiceNumber,
+		InvoiceDate:   invoiceDate(sale),
+		BuyerName:     sale.CustomerName,
+		BuyerGSTIN:    buyerGSTIN,
+		PlaceOfSupply: placeOfSupply,
+		Lines:         lines,
+	})
+}
+
+func (s *salesService) issueCreditNote(ctx context.Context, tx *sql.Tx, pharmacyID uuid.UUID, sale *Sale, ret *SaleReturn, saleItems map[uuid.UUID]SaleItem) (*gst.TaxDocument, error) {
+	lines := make([]gst.CreditNoteLine, 0, len(ret.Items))
+	for _, item := range ret.Items {
+		lines = append(lines, gst.CreditNoteLine{
+			ProductID:     item.ProductID,
+			MedicineName:  item.MedicineName,
+			BatchNo:       item.BatchNo,
+			Quantity:      item.Quantity,
+			Amount:        item.RefundAmount,
+			TaxPercentage: saleItems[item.SaleItemID].TaxPercentage,
+		})
+	}
+	return s.gst.IssueCreditNote(ctx, tx, pharmacyID, gst.CreditNoteInput{
+		SaleID:         sale.ID,
+		ReturnID:       ret.ID,
+		CreditNoteNo:   ret.ReturnNumber,
+		CreditNoteDate: ret.CreatedAt,
+		InvoiceNo:      sale.InvoiceNumber,
+		InvoiceDate:    invoiceDate(sale),
+		BuyerName:      sale.CustomerName,
+		Lines:          lines,
+	})
+}
+
+// invoiceDate is the day the sale completed; sales finalized before completion
+// was recorded fall back to the day they were billed
+func invoiceDate(sale *Sale) time.Time {
+	if sale.CompletedAt != nil {
+		return *sale.CompletedAt
+	}
+	return sale.CreatedAt
+}
+
+// GetTaxInvoice returns the sale's tax invoice. Sales completed before invoicing
+// existed have none until BackfillTaxDocuments issues it.
+func (s *salesService) GetTaxInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (*gst.TaxDocument, error) {
+	doc, err := s.gst.GetSaleInvoice(ctx, pharmacyID, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w for sale %s", gst.ErrDocumentNotFound, saleID)
+	}
+	return doc, nil
+}
+
+// GetCreditNote returns the return's credit note. Returns made before invoicing
+// existed have none until BackfillTaxDocuments issues it.
+func (s *salesService) GetCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (*gst.TaxDocument, error) {
+	return s.gst.GetCreditNote(ctx, pharmacyID, returnID)
+}
+
+// BackfillTaxDocuments issues the tax invoices and credit notes missing for sales
+// and returns made before invoicing existed. Each document commits on its own
+// under the sale's lock, dated with the day the sale completed or the return was
+// made, so a run that stops part-way can be repeated. Sales and returns keep the
+// numbers they were billed under; gst flags those too long for GST as legacy.
+func (s *salesService) BackfillTaxDocuments(ctx context.Context, pharmacyID uuid.UUID) (*TaxBackfill, error) {
+	result := &TaxBackfill{}
+
+	saleIDs, err := s.repo.ListSalesWithoutInvoice(ctx, pharmacyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, saleID := range saleIDs {
+		issued, err := s.backfillInvoice(ctx, pharmacyID, saleID)
+		if err != nil {
+			return result, fmt.Errorf("failed to issue the tax invoice of sale %s: %w", saleID, err)
+		}
+		if issued {
+			result.InvoicesIssued++
+		}
+	}
+
+	returnIDs, err := s.repo.ListReturnsWithoutCreditNote(ctx, pharmacyID)
+	if err != nil {
+		return result, err
+	}
+	for _, returnID := range returnIDs {
+		issued, err := s.backfillCreditNote(ctx, pharmacyID, returnID)
+		if err != nil {
+			return result, fmt.Errorf("failed to issue the credit note of return %s: %w", returnID, err)
+		}
+		if issued {
+			result.CreditNotesIssued++
+		}
+	}
+	return result, nil
+}
+
+func (s *salesService) backfillInvoice(ctx context.Context, pharmacyID, saleID uuid.UUID) (bool, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Lock, then look again: a sale invoiced since the list was read is skipped
+	if _, err := s.repo.LockSale(ctx, tx, pharmacyID, saleID); err != nil {
+		return false, err
+	}
+	if doc, err := s.gst.GetSaleInvoice(ctx, pharmacyID, saleID); err != nil || doc != nil {
+		return false, err
+	}
+
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, saleID)
+	if err != nil {
+		return false, err
+	}
+	items, err := s.repo.GetItemsBySaleID(ctx, saleID)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.issueTaxInvoice(ctx, tx, pharmacyID, sale, items, "", ""); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *salesService) backfillCreditNote(ctx context.Context, pharmacyID, returnID uuid.UUID) (bool, error) {
+	ret, err := s.repo.GetReturnByID(ctx, pharmacyID, returnID)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The credit note follows the sale's invoice, so it takes the same lock
+	if _, err := s.repo.LockSale(ctx, tx, pharmacyID, ret.SaleID); err != nil {
+		return false, err
+	}
+	if _, err := s.gst.GetCreditNote(ctx, pharmacyID, returnID); err == nil {
+		return false, nil
+	} else if !errors.Is(err, gst.ErrDocumentNotFound) {
+		return false, err
+	}
+
+	sale, err := s.repo.GetSaleByID(ctx, pharmacyID, ret.SaleID)
+	if err != nil {
+		return false, err
+	}
+	items, err := s.repo.GetItemsBySaleID(ctx, ret.SaleID)
+	if err != nil {
+		return false, err
+	}
+	itemMap := make(map[uuid.UUID]SaleItem)
+	for _, item := range items {
+		itemMap[item.ID] = item
+	}
+	if _, err := s.issueCreditNote(ctx, tx, pharmacyID, sale, ret, itemMap); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
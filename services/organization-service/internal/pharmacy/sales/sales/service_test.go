@@ -0,0 +1,777 @@
+package sales
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/gst"
+	"organization-service/internal/pharmacy/sales/clients"
+	"organization-service/internal/pharmacy/sales/promotions"
+)
+
+// fakeRepository serves one sale and its items and records what is written back
+type fakeRepository struct {
+	Repository
+	sale         *Sale
+	items        []SaleItem
+	updated      *Sale
+	updatedItems []SaleItem
+	addedItems   []SaleItem
+	deleted      []uuid.UUID
+	applied      []AppliedPromotion
+	began        bool
+}
+
+func (f *fakeRepository) GetSaleByID(context.Context, uuid.UUID, uuid.UUID) (*Sale, error) {
+	s := *f.sale
+	return &s, nil
+}
+
+func (f *fakeRepository) GetItemsBySaleID(context.Context, uuid.UUID) ([]SaleItem, error) {
+	return f.items, nil
+}
+
+func (f *fakeRepository) UpdateSale(_ context.Context, _ *sql.Tx, s *Sale) error {
+	f.updated = s
+	return nil
+}
+
+func (f *fakeRepository) UpdateItem(_ context.Context, item *SaleItem) error {
+	f.updatedItems = append(f.updatedItems, *item)
+	return nil
+}
+
+func (f *fakeRepository) AddItem(_ context.Context, item *SaleItem) error {
+	f.addedItems = append(f.addedItems, *item)
+	return nil
+}
+
+func (f *fakeRepository) DeleteItem(_ context.Context, itemID uuid.UUID) error {
+	f.deleted = append(f.deleted, itemID)
+	return nil
+}
+
+func (f *fakeRepository) ReplaceSalePromotions(_ context.Context, _ uuid.UUID, applied []AppliedPromotion) error {
+	f.applied = applied
+	return nil
+}
+
+// fakeInventory serves batches to hold and records the holds taken and given back
+type fakeInventory struct {
+	clients.InventoryClient
+	available []clients.StockAvailability
+	reserved  []int
+	released  []string
+}
+
+func (f *fakeInventory) ReleaseStock(_ context.Context, _ uuid.UUID, reservationID string) error {
+	f.released = append(f.released, reservationID)
+	return nil
+}
+
+func (f *fakeInventory) GetAvailability(context.Context, uuid.UUID, uuid.UUID) ([]clients.StockAvailability, error) {
+	return f.available, nil
+}
+
+func (f *fakeInventory) ReserveStock(_ context.Context, _, _, _ uuid.UUID, quantity int) (string, error) {
+	f.reserved = append(f.reserved, quantity)
+	return "res-free", nil
+}
+
+// fakePromotions gives fixed benefits on any bill
+type fakePromotions struct {
+	promotions.Service
+	benefits []promotions.Benefit
+}
+
+func (f *fakePromotions) Evaluate(context.Context, uuid.UUID, []promotions.CartLine, time.Time) ([]promotions.Benefit, error) {
+	return f.benefits, nil
+}
+
+var errBeginTx = errors.New("transaction opened")
+
+// BeginTx stops a service at its first write, so tests see what it validated up front
+func (f *fakeRepository) BeginTx(context.Context) (*sql.Tx, error) {
+	f.began = true
+	return nil, errBeginTx
+}
+
+func TestDiscardDraft(t *testing.T) {
+	items := []SaleItem{{ReservationID: "res-1"}, {}, {ReservationID: "res-2"}}
+
+	tests := []struct {
+		status       SaleStatus
+		wantErr      bool
+		wantReleased []string
+	}{
+		{StatusDraft, false, []string{"res-1", "res-2"}},
+		{StatusPending, false, []string{"res-1", "res-2"}},
+		{StatusAbandoned, false, []string{"res-1", "res-2"}},
+		{StatusCompleted, true, nil},
+		{StatusCancelled, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			repo := &fakeRepository{sale: &Sale{ID: uuid.New(), Status: tt.status}, items: items}
+			inv := &fakeInventory{}
+			svc := &salesService{repo: repo, inventory: inv}
+
+			err := svc.DiscardDraft(context.Background(), uuid.New(), repo.sale.ID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DiscardDraft() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(inv.released, tt.wantReleased) {
+				t.Errorf("released = %v, want %v", inv.released, tt.wantReleased)
+			}
+			if !tt.wantErr && (repo.updated == nil || repo.updated.Status != StatusCancelled) {
+				t.Errorf("sale was not cancelled: %+v", repo.updated)
+			}
+			if tt.wantErr && repo.updated != nil {
+				t.Errorf("sale in status %s was updated", tt.status)
+			}
+		})
+	}
+}
+
+func TestSettlePayment(t *testing.T) {
+	patient := uuid.New()
+	cash := func(amount float64) Tender { return Tender{Mode: PayModeCash, Amount: amount} }
+	upi := func(amount float64) Tender { return Tender{Mode: PayModeUPI, Amount: amount, Reference: "UTR123"} }
+	card := func(amount float64, ref string) Tender {
+		return Tender{Mode: PayModeCard, Amount: amount, Reference: ref}
+	}
+	credit := func(amount float64) Tender { return Tender{Mode: PayModeCredit, Amount: amount} }
+	points := func(amount float64) Tender { return Tender{Mode: PayModeLoyalty, Amount: amount} }
+
+	type payment struct {
+		mode     PaymentMode
+		amount   float64
+		tendered float64
+		change   float64
+	}
+	tests := []struct {
+		name       string
+		patient    *uuid.UUID
+		req        FinalizeSaleRequest
+		want       []payment
+		wantCredit float64
+		wantDue    float64
+		wantErr    bool
+	}{
+		{
+			name: "single mode from older clients",
+			req:  FinalizeSaleRequest{PaymentMode: PayModeUPI},
+			want: []payment{{PayModeUPI, 500, 0, 0}},
+		},
+		{
+			name:    "older client leaves part of the bill due",
+			patient: &patient,
+			req:     FinalizeSaleRequest{PaymentMode: PayModeCash, WalletAction: "DUE", WalletAmount: 300},
+			want:    []payment{{PayModeCash, 300, 0, 0}},
+			wantDue: 200,
+		},
+		{
+			name:       "older client overpays into store credit",
+			patient:    &patient,
+			req:        FinalizeSaleRequest{PaymentMode: PayModeCash, WalletAction: "CREDIT", WalletAmount: 600},
+			want:       []payment{{PayModeCash, 600, 0, 0}},
+			wantCredit: 100,
+		},
+		{
+			name: "cash with change",
+			req:  FinalizeSaleRequest{Tenders: []Tender{cash(1000)}},
+			want: []payment{{PayModeCash, 500, 1000, 500}},
+		},
+		{
+			name: "cash, UPI and card",
+			req:  FinalizeSaleRequest{Tenders: []Tender{upi(200), card(100, "4242"), cash(250)}},
+			want: []payment{{PayModeUPI, 200, 0, 0}, {PayModeCard, 100, 0, 0}, {PayModeCash, 200, 250, 50}},
+		},
+		{
+			name:       "cash excess kept as store credit",
+			patient:    &patient,
+			req:        FinalizeSaleRequest{Tenders: []Tender{upi(300), cash(250)}, WalletAction: "CREDIT"},
+			want:       []payment{{PayModeUPI, 300, 0, 0}, {PayModeCash, 250, 250, 0}},
+			wantCredit: 50,
+		},
+		{
+			name:    "part on account",
+			patient: &patient,
+			req:     FinalizeSaleRequest{Tenders: []Tender{cash(150), credit(350)}},
+			want:    []payment{{PayModeCash, 150, 150, 0}, {PayModeCredit, 350, 0, 0}},
+			wantDue: 350,
+		},
+		{
+			name:    "points and UPI",
+			patient: &patient,
+			req:     FinalizeSaleRequest{Tenders: []Tender{points(50), upi(450)}},
+			want:    []payment{{PayModeLoyalty, 50, 0, 0}, {PayModeUPI, 450, 0, 0}},
+		},
+		{name: "tenders fall short", req: FinalizeSaleRequest{Tenders: []Tender{cash(200), upi(250)}}, wantErr: true},
+		{name: "UPI overpays", req: FinalizeSaleRequest{Tenders: []Tender{upi(600)}}, wantErr: true},
+		{name: "two cash tenders", req: FinalizeSaleRequest{Tenders: []Tender{cash(300), cash(200)}}, wantErr: true},
+		{name: "credit for a walk-in", req: FinalizeSaleRequest{Tenders: []Tender{credit(500)}}, wantErr: true},
+		{name: "points for a walk-in", req: FinalizeSaleRequest{Tenders: []Tender{points(50), cash(450)}}, wantErr: true},
+		{name: "card reference is not the last 4 digits", req: FinalizeSaleRequest{Tenders: []Tender{card(500, "42424")}}, wantErr: true},
+		{
+			name:    "cash overpays while putting part on account",
+			patient: &patient,
+			req:     FinalizeSaleRequest{Tenders: []Tender{cash(300), credit(300)}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sale := &Sale{ID: uuid.New(), PatientID: tt.patient, TotalAmount: 500, GeneratedCredit: 9, GeneratedDue: 9}
+			got, err := settlePayment(sale, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("settlePayment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d payments, want %d", len(got), len(tt.want))
+			}
+			for i, w := range tt.want {
+				p := got[i]
+				if p.Mode != w.mode || p.Amount != w.amount || p.Tendered != w.tendered || p.Change != w.change {
+					t.Errorf("payment[%d] = %s %.2f (tendered %.2f, change %.2f), want %s %.2f (tendered %.2f, change %.2f)",
+						i, p.Mode, p.Amount, p.Tendered, p.Change, w.mode, w.amount, w.tendered, w.change)
+				}
+			}
+			if sale.GeneratedCredit != tt.wantCredit || sale.GeneratedDue != tt.wantDue {
+				t.Errorf("generated credit/due = %.2f/%.2f, want %.2f/%.2f", sale.GeneratedCredit, sale.GeneratedDue, tt.wantCredit, tt.wantDue)
+			}
+		})
+	}
+}
+
+func TestPaymentModeLabel(t *testing.T) {
+	tests := []struct {
+		modes []PaymentMode
+		want  string
+	}{
+		{nil, ""},
+		{[]PaymentMode{PayModeUPI}, "UPI"},
+		{[]PaymentMode{PayModeCash, PayModeCash}, "CASH"},
+		{[]PaymentMode{PayModeCash, PayModeCard}, "SPLIT"},
+	}
+
+	for _, tt := range tests {
+		var payments []*Payment
+		for _, m := range tt.modes {
+			payments = append(payments, &Payment{Mode: m})
+		}
+		if got := paymentModeLabel(payments); got != tt.want {
+			t.Errorf("paymentModeLabel(%v) = %q, want %q", tt.modes, got, tt.want)
+		}
+	}
+}
+
+func TestApplyWalletBalance(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    float64
+		wantTotal  float64
+		wantDue    float64
+		wantCredit float64
+	}{
+		{"no wallet", 0, 500, 0, 0},
+		{"old due added to the bill", 120, 620, 120, 0},
+		{"credit spent on the bill", -80, 420, 0, 80},
+		{"credit larger than the bill", -700, 0, 0, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sale := &Sale{TotalAmount: 500, AppliedDue: 1, AppliedCredit: 1}
+			applyWalletBalance(sale, tt.balance)
+			if sale.TotalAmount != tt.wantTotal || sale.AppliedDue != tt.wantDue || sale.AppliedCredit != tt.wantCredit {
+				t.Errorf("total/due/credit = %.2f/%.2f/%.2f, want %.2f/%.2f/%.2f",
+					sale.TotalAmount, sale.AppliedDue, sale.AppliedCredit, tt.wantTotal, tt.wantDue, tt.wantCredit)
+			}
+		})
+	}
+}
+
+func TestCheckCreditLimit(t *testing.T) {
+	limit := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		sale    Sale
+		balance float64
+		limit   *float64
+		wantErr bool
+	}{
+		{"no limit", Sale{GeneratedDue: 5000}, 0, nil, false},
+		{"nothing new on account", Sale{}, 900, limit(500), false},
+		{"within the limit", Sale{GeneratedDue: 300}, 100, limit(500), false},
+		{"exactly the limit", Sale{GeneratedDue: 400}, 100, limit(500), false},
+		{"over the limit", Sale{GeneratedDue: 401}, 100, limit(500), true},
+		{"old due settled on this bill", Sale{AppliedDue: 300, GeneratedDue: 450}, 300, limit(500), false},
+		{"store credit spent first", Sale{AppliedCredit: 100, GeneratedDue: 550}, -100, limit(500), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCreditLimit(&tt.sale, tt.balance, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkCreditLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaleWalletEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		sale Sale
+		want []WalletEntry
+	}{
+		{"paid in full", Sale{}, nil},
+		{
+			name: "old due settled, part left on account",
+			sale: Sale{AppliedDue: 120, GeneratedDue: 200},
+			want: []WalletEntry{{Type: WalletDueSettled, Credit: 120}, {Type: WalletSaleDue, Debit: 200}},
+		},
+		{
+			name: "credit spent, change kept as credit",
+			sale: Sale{AppliedCredit: 80, GeneratedCredit: 20},
+			want: []WalletEntry{{Type: WalletCreditRedeemed, Debit: 80}, {Type: WalletSaleCredit, Credit: 20}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sale.ID = uuid.New()
+			tt.sale.InvoiceNumber = "INV/25-26/000042"
+			got := saleWalletEntries(&tt.sale, uuid.Nil, "")
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, w := range tt.want {
+				e := got[i]
+				if e.Type != w.Type || e.Debit != w.Debit || e.Credit != w.Credit {
+					t.Errorf("entry[%d] = %s %.2f/%.2f, want %s %.2f/%.2f", i, e.Type, e.Debit, e.Credit, w.Type, w.Debit, w.Credit)
+				}
+				if e.SaleID == nil || *e.SaleID != tt.sale.ID || e.ReferenceNo != tt.sale.InvoiceNumber {
+					t.Errorf("entry[%d] not tied to the bill: %+v", i, e)
+				}
+				if e.CreatedBy != nil {
+					t.Errorf("entry[%d] has creator %v for a system posting", i, e.CreatedBy)
+				}
+			}
+		})
+	}
+}
+
+// fakeWalletRepository serves one patient's ledger
+type fakeWalletRepository struct {
+	Repository
+	entries []WalletEntry
+}
+
+func (f *fakeWalletRepository) GetPatientByID(_ context.Context, _, id uuid.UUID) (*Patient, error) {
+	return &Patient{ID: id, Name: "Asha"}, nil
+}
+
+func (f *fakeWalletRepository) ListWalletEntries(context.Context, uuid.UUID, uuid.UUID) ([]WalletEntry, error) {
+	return f.entries, nil
+}
+
+func TestGetWalletStatement(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, time.June, d, 10, 0, 0, 0, time.UTC) }
+	date := func(d int) *time.Time { t := time.Date(2025, time.June, d, 0, 0, 0, 0, time.UTC); return &t }
+	ledger := []WalletEntry{
+		{Date: day(1), Type: WalletSaleDue, Debit: 300},
+		{Date: day(5), Type: WalletDuePayment, Credit: 100},
+		{Date: day(10), Type: WalletSaleDue, Debit: 50.5},
+		{Date: day(20), Type: WalletSaleCredit, Credit: 400},
+	}
+
+	tests := []struct {
+		name        string
+		from, to    *time.Time
+		wantBF      float64
+		wantDebit   float64
+		wantCredit  float64
+		wantClosing float64
+		wantLines   []float64
+	}{
+		{"whole ledger", nil, nil, 0, 350.5, 500, -149.5, []float64{300, 200, 250.5, -149.5}},
+		{"earlier lines brought forward", date(5), nil, 300, 50.5, 500, -149.5, []float64{200, 250.5, -149.5}},
+		{"later lines left out", nil, date(10), 0, 350.5, 100, 250.5, []float64{300, 200, 250.5}},
+		{"window with nothing in it", date(11), date(19), 250.5, 0, 0, 250.5, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &salesService{repo: &fakeWalletRepository{entries: ledger}}
+			st, err := svc.GetWalletStatement(context.Background(), uuid.New(), uuid.New(), tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.BroughtForward != tt.wantBF || st.TotalDebit != tt.wantDebit || st.TotalCredit != tt.wantCredit || st.ClosingBalance != tt.wantClosing {
+				t.Errorf("b/f %.2f, debit %.2f, credit %.2f, closing %.2f; want %.2f, %.2f, %.2f, %.2f",
+					st.BroughtForward, st.TotalDebit, st.TotalCredit, st.ClosingBalance, tt.wantBF, tt.wantDebit, tt.wantCredit, tt.wantClosing)
+			}
+			var lines []float64
+			for _, e := range st.Entries {
+				lines = append(lines, e.Balance)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("running balances = %v, want %v", lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestApplyPromotions(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	sale, free := uuid.New(), uuid.New()
+	heldID := uuid.New()
+	paid := func(discount, promo, maxDisc float64) SaleItem {
+		return SaleItem{ID: uuid.New(), ProductID: a, Quantity: 2, MRP: 100, DiscountPercentage: discount, PromoDiscPerc: promo, MaxDiscPerc: maxDisc}
+	}
+	held := func(qty int) SaleItem {
+		return SaleItem{ID: heldID, ProductID: b, Quantity: qty, IsFree: true, PromotionID: &free, ReservationID: "res-held"}
+	}
+	inStock := []clients.StockAvailability{{BatchID: uuid.New(), Quantity: 1, ExpiryDate: time.Now().AddDate(1, 0, 0)}}
+
+	tests := []struct {
+		name         string
+		items        []SaleItem
+		benefits     []promotions.Benefit
+		wantDiscPerc []float64 // Of each paid line written back
+		wantApplied  []AppliedPromotion
+		wantReserved []int
+		wantDeleted  []uuid.UUID
+	}{
+		{
+			name:         "discount folded into the line",
+			items:        []SaleItem{paid(5, 0, 0)},
+			benefits:     []promotions.Benefit{{PromotionID: free, Name: "Vitamin week", Discount: 19}},
+			wantDiscPerc: []float64{14.5},
+			wantApplied:  []AppliedPromotion{{PromotionID: free, Name: "Vitamin week", Discount: 19}},
+		},
+		{
+			name:         "capped at the batch maximum",
+			items:        []SaleItem{paid(5, 0, 10)},
+			benefits:     []promotions.Benefit{{PromotionID: free, Name: "Vitamin week", Discount: 19}},
+			wantDiscPerc: []float64{10},
+			wantApplied:  []AppliedPromotion{{PromotionID: free, Name: "Vitamin week", Discount: 10, Note: "capped at the batch maximum discount"}},
+		},
+		{
+			name:         "promotion no longer running",
+			items:        []SaleItem{paid(15, 10, 0)},
+			wantDiscPerc: []float64{5},
+		},
+		{
+			name:        "unchanged discount is not rewritten",
+			items:       []SaleItem{paid(14.5, 9.5, 0)},
+			benefits:    []promotions.Benefit{{PromotionID: free, Name: "Vitamin week", Discount: 19}},
+			wantApplied: []AppliedPromotion{{PromotionID: free, Name: "Vitamin week", Discount: 19}},
+		},
+		{
+			name:         "free units short of stock",
+			items:        []SaleItem{paid(0, 0, 0)},
+			benefits:     []promotions.Benefit{{PromotionID: free, Name: "Buy 1 get 1", ProductID: b, FreeQuantity: 2}},
+			wantApplied:  []AppliedPromotion{{PromotionID: free, Name: "Buy 1 get 1", FreeQuantity: 1, Note: "only 1 of 2 free units in stock"}},
+			wantReserved: []int{1},
+		},
+		{
+			name:        "free units already held",
+			items:       []SaleItem{paid(0, 0, 0), held(2)},
+			benefits:    []promotions.Benefit{{PromotionID: free, Name: "Buy 1 get 1", ProductID: b, FreeQuantity: 2}},
+			wantApplied: []AppliedPromotion{{PromotionID: free, Name: "Buy 1 get 1", FreeQuantity: 2}},
+		},
+		{
+			name:         "free entitlement changed",
+			items:        []SaleItem{paid(0, 0, 0), held(2)},
+			benefits:     []promotions.Benefit{{PromotionID: free, Name: "Buy 1 get 1", ProductID: b, FreeQuantity: 1}},
+			wantApplied:  []AppliedPromotion{{PromotionID: free, Name: "Buy 1 get 1", FreeQuantity: 1}},
+			wantReserved: []int{1},
+			wantDeleted:  []uuid.UUID{heldID},
+		},
+		{
+			name:        "bill no longer qualifies for free units",
+			items:       []SaleItem{paid(0, 0, 0), held(2)},
+			wantDeleted: []uuid.UUID{heldID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.benefits {
+				if tt.benefits[i].ProductID == uuid.Nil {
+					tt.benefits[i].ProductID = a
+				}
+			}
+			repo := &fakeRepository{items: tt.items}
+			inv := &fakeInventory{available: inStock}
+			svc := &salesService{repo: repo, inventory: inv, promotions: &fakePromotions{benefits: tt.benefits}}
+
+			if err := svc.applyPromotions(context.Background(), uuid.New(), sale); err != nil {
+				t.Fatal(err)
+			}
+			var discPerc []float64
+			for _, item := range repo.updatedItems {
+				discPerc = append(discPerc, item.DiscountPercentage)
+			}
+			if !reflect.DeepEqual(discPerc, tt.wantDiscPerc) {
+				t.Errorf("line discounts = %v, want %v", discPerc, tt.wantDiscPerc)
+			}
+			if !reflect.DeepEqual(repo.applied, tt.wantApplied) {
+				t.Errorf("applied = %+v, want %+v", repo.applied, tt.wantApplied)
+			}
+			if !reflect.DeepEqual(inv.reserved, tt.wantReserved) {
+				t.Errorf("reserved = %v, want %v", inv.reserved, tt.wantReserved)
+			}
+			if !reflect.DeepEqual(repo.deleted, tt.wantDeleted) {
+				t.Errorf("deleted = %v, want %v", repo.deleted, tt.wantDeleted)
+			}
+			for _, item := range repo.addedItems {
+				if !item.IsFree || item.DiscountPercentage != 100 || item.PromotionID == nil || *item.PromotionID != free {
+					t.Errorf("free line not marked free: %+v", item)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessReturnValidation(t *testing.T) {
+	patientID := uuid.New()
+
+	tests := []struct {
+		name      string
+		patientID *uuid.UUID
+		soldAt    time.Time
+		mode      PaymentMode
+		wantBegin bool
+	}{
+		{name: "cash refund to walk-in", soldAt: time.Now().Add(-time.Hour), mode: PayModeCash, wantBegin: true},
+		{name: "store credit to patient", patientID: &patientID, soldAt: time.Now().Add(-time.Hour), mode: PayModeCredit, wantBegin: true},
+		{name: "store credit to walk-in", soldAt: time.Now().Add(-time.Hour), mode: PayModeCredit},
+		{name: "past the return window", patientID: &patientID, soldAt: time.Now().AddDate(0, 0, -31), mode: PayModeCash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{sale: &Sale{ID: uuid.New(), Status: StatusCompleted, PatientID: tt.patientID, CreatedAt: tt.soldAt}}
+			svc := &salesService{repo: repo, inventory: &fakeInventory{}}
+
+			_, err := svc.ProcessReturn(context.Background(), uuid.New(), "Ravi", CreateReturnRequest{SaleID: repo.sale.ID, RefundMode: tt.mode})
+			if err == nil {
+				t.Fatal("ProcessReturn() succeeded against a fake without a transaction")
+			}
+			if repo.began != tt.wantBegin {
+				t.Errorf("transaction opened = %v, want %v (error %v)", repo.began, tt.wantBegin, err)
+			}
+			if tt.wantBegin && !errors.Is(err, errBeginTx) {
+				t.Errorf("ProcessReturn() error = %v, want it to stop at the transaction", err)
+			}
+		})
+	}
+}
+
+func TestInvoiceDate(t *testing.T) {
+	billed := time.Date(2026, 3, 31, 18, 0, 0, 0, time.UTC)
+	completed := time.Date(2026, 4, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		sale *Sale
+		want time.Time
+	}{
+		{"completed sale", &Sale{CreatedAt: billed, CompletedAt: &completed, UpdatedAt: completed.AddDate(0, 0, 5)}, completed},
+		{"completed before completion was recorded", &Sale{CreatedAt: billed, UpdatedAt: completed.AddDate(0, 0, 5)}, billed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invoiceDate(tt.sale); !got.Equal(tt.want) {
+				t.Errorf("invoiceDate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeGST serves the tax documents already issued
+type fakeGST struct {
+	gst.Service
+	invoice *gst.TaxDocument
+}
+
+func (f *fakeGST) GetSaleInvoice(context.Context, uuid.UUID, uuid.UUID) (*gst.TaxDocument, error) {
+	return f.invoice, nil
+}
+
+func TestGetTaxInvoice(t *testing.T) {
+	issued := &gst.TaxDocument{DocumentNo: "INV/26-27/000001"}
+
+	tests := []struct {
+		name    string
+		invoice *gst.TaxDocument
+		wantErr error
+	}{
+		{"issued at checkout", issued, nil},
+		{"sale from before invoicing", nil, gst.ErrDocumentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRepository{sale: &Sale{Status: StatusCompleted, InvoiceNumber: "INV-20250301-1a2b3c4d"}}
+			svc := &salesService{repo: repo, gst: &fakeGST{invoice: tt.invoice}}
+
+			doc, err := svc.GetTaxInvoice(context.Background(), uuid.New(), uuid.New())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetTaxInvoice() error = %v, want %v", err, tt.wantErr)
+			}
+			if doc != tt.invoice {
+				t.Errorf("GetTaxInvoice() = %v, want %v", doc, tt.invoice)
+			}
+			if repo.began || repo.updated != nil {
+				t.Error("GetTaxInvoice() wrote to the sale; it must only read")
+			}
+		})
+	}
+}
+
+// failingDB hands out transactions that begin and roll back but fail every
+// statement, so a service runs in a real *sql.Tx up to its first write
+type failingDB struct{}
+
+var errStatement = errors.New("statement failed")
+
+func (failingDB) Connect(context.Context) (driver.Conn, error) { return failingDB{}, nil }
+func (failingDB) Driver() driver.Driver                        { return failingDB{} }
+func (failingDB) Open(string) (driver.Conn, error)             { return failingDB{}, nil }
+func (failingDB) Prepare(string) (driver.Stmt, error)          { return nil, errStatement }
+func (failingDB) Close() error                                 { return nil }
+func (failingDB) Begin() (driver.Tx, error)                    { return failingDB{}, nil }
+func (failingDB) Commit() error                                { return nil }
+func (failingDB) Rollback() error                              { return nil }
+
+// fakeCheckoutRepository runs FinalizeSale against failingDB
+type fakeCheckoutRepository struct {
+	*fakeRepository
+	db *sql.DB
+}
+
+func (f *fakeCheckoutRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return f.db.BeginTx(ctx, nil)
+}
+
+func (f *fakeCheckoutRepository) LockSale(context.Context, *sql.Tx, uuid.UUID, uuid.UUID) (SaleStatus, error) {
+	return f.sale.Status, nil
+}
+
+func (f *fakeCheckoutRepository) AddPayment(context.Context, *sql.Tx, *Payment) error {
+	return errStatement
+}
+
+// fakeCheckoutInventory confirms holds over "HTTP" and records the stock handed back
+type fakeCheckoutInventory struct {
+	fakeInventory
+	confirmed []string
+	returned  []clients.ReturnItemRequest
+}
+
+func (f *fakeCheckoutInventory) ConfirmStock(_ context.Context, _ uuid.UUID, reservationID string) error {
+	f.confirmed = append(f.confirmed, reservationID)
+	return nil
+}
+
+func (f *fakeCheckoutInventory) ReturnItems(_ context.Context, _ uuid.UUID, items []clients.ReturnItemRequest) error {
+	f.returned = append(f.returned, items...)
+	return nil
+}
+
+// fakeTxCheckoutInventory confirms holds in the sale's transaction
+type fakeTxCheckoutInventory struct {
+	fakeCheckoutInventory
+}
+
+func (f *fakeTxCheckoutInventory) ConfirmStockTx(_ context.Context, _ *sql.Tx, _ uuid.UUID, reservationID string) error {
+	f.confirmed = append(f.confirmed, reservationID)
+	return nil
+}
+
+func (f *fakeTxCheckoutInventory) ReturnItemsTx(context.Context, *sql.Tx, uuid.UUID, []clients.ReturnItemRequest) error {
+	return nil
+}
+
+// fakeCompliance clears every bill
+type fakeCompliance struct {
+	compliance.Service
+}
+
+func (fakeCompliance) Evaluate(context.Context, uuid.UUID, uuid.UUID, []uuid.UUID, compliance.Patient) (*compliance.Requirements, error) {
+	return &compliance.Requirements{Satisfied: true}, nil
+}
+
+func TestFinalizeSaleRollbackReturnsConfirmedStock(t *testing.T) {
+	batchA, batchB := uuid.New(), uuid.New()
+	items := []SaleItem{
+		{ID: uuid.New(), MedicineName: "Paracetamol 500mg", BatchID: batchA, Quantity: 10, ReservationID: "res-a"},
+		{ID: uuid.New(), MedicineName: "Cetirizine 10mg", BatchID: batchB, Quantity: 5, ReservationID: "res-b"},
+	}
+
+	httpInventory := &fakeCheckoutInventory{}
+	txInventory := &fakeTxCheckoutInventory{}
+	tests := []struct {
+		name         string
+		inventory    clients.InventoryClient
+		stock        *fakeCheckoutInventory
+		wantReturned []clients.ReturnItemRequest
+	}{
+		{
+			name:      "confirmed over HTTP",
+			inventory: httpInventory,
+			stock:     httpInventory,
+			wantReturned: []clients.ReturnItemRequest{
+				{BatchID: batchA, Quantity: 10, Reason: "Checkout did not complete"},
+				{BatchID: batchB, Quantity: 5, Reason: "Checkout did not complete"},
+			},
+		},
+		{
+			name:      "confirmed in the sale's transaction",
+			inventory: txInventory,
+			stock:     &txInventory.fakeCheckoutInventory,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sql.OpenDB(failingDB{})
+			defer db.Close()
+			repo := &fakeCheckoutRepository{
+				fakeRepository: &fakeRepository{sale: &Sale{ID: uuid.New(), Status: StatusPending, TotalAmount: 150}, items: items},
+				db:             db,
+			}
+			svc := &salesService{repo: repo, inventory: tt.inventory, compliance: fakeCompliance{}}
+
+			_, err := svc.FinalizeSale(context.Background(), uuid.New(), repo.sale.ID, FinalizeSaleRequest{PaymentMode: PayModeCash})
+			if err == nil {
+				t.Fatal("FinalizeSale() succeeded against a database that fails every write")
+			}
+			if !reflect.DeepEqual(tt.stock.confirmed, []string{"res-a", "res-b"}) {
+				t.Fatalf("confirmed %v, want both holds confirmed before the failure", tt.stock.confirmed)
+			}
+			if !reflect.DeepEqual(tt.stock.returned, tt.wantReturned) {
+				t.Errorf("returned %+v, want %+v", tt.stock.returned, tt.wantReturned)
+			}
+		})
+	}
+}
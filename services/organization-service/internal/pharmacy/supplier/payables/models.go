@@ -0,0 +1,206 @@
+package payables
+
+import (
+	"time"
+
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+// EntryType identifies the document behind a supplier ledger line
+type EntryType string
+
+const (
+	EntryOpening         EntryType = "OPENING_BALANCE"
+	EntryPurchase        EntryType = "PURCHASE"
+	EntryPayment         EntryType = "PAYMENT"
+	EntryInvoicePayment  EntryType = "INVOICE_PAYMENT" // paid directly on the invoice, outside a voucher
+	EntryDebitNote       EntryType = "DEBIT_NOTE"
+	EntryDebitNoteRefund EntryType = "DEBIT_NOTE_REFUND"
+)
+
+type PaymentMode string
+
+const (
+	ModeCash         PaymentMode = "CASH"
+	ModeBankTransfer PaymentMode = "BANK_TRANSFER"
+	ModeCheque       PaymentMode = "CHEQUE"
+	ModeUPI          PaymentMode = "UPI"
+)
+
+// LedgerEntry is one line of the supplier statement. Credit increases what the
+// pharmacy owes the supplier, debit reduces it.
+type LedgerEntry struct {
+	Date        time.Time  `json:"date"`
+	Type        EntryType  `json:"type"`
+	ReferenceID *uuid.UUID `json:"reference_id,omitempty"`
+	ReferenceNo string     `json:"reference_no"`
+	Description string     `json:"description"`
+	Debit       float64    `json:"debit"`
+	Credit      float64    `json:"credit"`
+	Balance     float64    `json:"balance"`
+	createdAt   time.Time
+}
+
+type Ledger struct {
+	SupplierID     uuid.UUID     `json:"supplier_id"`
+	SupplierName   string        `json:"supplier_name"`
+	From           *time.Time    `json:"from,omitempty"`
+	To             *time.Time    `json:"to,omitempty"`
+	BroughtForward float64       `json:"brought_forward"`
+	TotalDebit     float64       `json:"total_debit"`
+	TotalCredit    float64       `json:"total_credit"`
+	ClosingBalance float64       `json:"closing_balance"`
+	Entries        []LedgerEntry `json:"entries"`
+}
+
+// OpenInvoice is a purchase with an unpaid balance and its due date from the
+// supplier's credit period
+type OpenInvoice struct {
+	PurchaseID   uuid.UUID `json:"purchase_id"`
+	SupplierID   uuid.UUID `json:"supplier_id"`
+	SupplierName string    `json:"supplier_name"`
+	InvoiceNo    string    `json:"invoice_no"`
+	PurchaseDate time.Time `json:"purchase_date"`
+	DueDate      time.Time `json:"due_date"`
+	GrandTotal   float64   `json:"grand_total"`
+	PaidAmount   float64   `json:"paid_amount"`
+	DueAmount    float64   `json:"due_amount"`
+	AgeDays      int       `json:"age_days"`
+	DaysOverdue  int       `json:"days_overdue"` // negative while not yet due
+	Overdue      bool      `json:"overdue"`
+}
+
+// AgeingBuckets splits outstanding amounts by days since the invoice date
+type AgeingBuckets struct {
+	Days0To30  float64 `json:"days_0_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Days90Plus float64 `json:"days_90_plus"`
+}
+
+func (b *AgeingBuckets) add(ageDays int, amount float64) {
+	switch {
+	case ageDays <= 30:
+		b.Days0To30 = money.Round2(b.Days0To30 + amount)
+	case ageDays <= 60:
+		b.Days31To60 = money.Round2(b.Days31To60 + amount)
+	case ageDays <= 90:
+		b.Days61To90 = money.Round2(b.Days61To90 + amount)
+	default:
+		b.Days90Plus = money.Round2(b.Days90Plus + amount)
+	}
+}
+
+// SupplierPayable is the outstanding position with one supplier. NetPayable is
+// the ledger balance: open invoices and unsettled opening balance, less debit
+// notes the supplier has not yet credited and any advance paid.
+type SupplierPayable struct {
+	SupplierID         uuid.UUID     `json:"supplier_id"`
+	SupplierName       string        `json:"supplier_name"`
+	CreditPeriodDays   int           `json:"credit_period_days"`
+	CreditLimit        float64       `json:"credit_limit"`
+	OpeningOutstanding float64       `json:"opening_outstanding"`
+	InvoiceOutstanding float64       `json:"invoice_outstanding"`
+	PendingDebitNotes  float64       `json:"pending_debit_notes"`
+	Advance            float64       `json:"advance"`
+	NetPayable         float64       `json:"net_payable"`
+	Overdue            float64       `json:"overdue"`
+	OpenInvoices       int           `json:"open_invoices"`
+	OverLimit          bool          `json:"over_limit"`
+	Ageing             AgeingBuckets `json:"ageing"`
+}
+
+type AgeingReport struct {
+	AsOf      time.Time         `json:"as_of"`
+	Suppliers []SupplierPayable `json:"suppliers"`
+	Totals    SupplierPayable   `json:"totals"`
+}
+
+type OpeningBalance struct {
+	PharmacyID    uuid.UUID `json:"pharmacy_id"`
+	SupplierID    uuid.UUID `json:"supplier_id"`
+	Amount        float64   `json:"amount"`
+	AsOfDate      time.Time `json:"as_of_date"`
+	Notes         string    `json:"notes"`
+	UpdatedBy     uuid.UUID `json:"updated_by"`
+	UpdatedByName string    `json:"updated_by_name"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type PaymentVoucher struct {
+	ID            uuid.UUID           `json:"id"`
+	PharmacyID    uuid.UUID           `json:"pharmacy_id"`
+	SupplierID    uuid.UUID           `json:"supplier_id"`
+	SupplierName  string              `json:"supplier_name"`
+	VoucherNo     string              `json:"voucher_no"`
+	PaymentDate   time.Time           `json:"payment_date"`
+	Amount        float64             `json:"amount"`
+	OnAccount     float64             `json:"on_account"` // part not allocated to any invoice
+	PaymentMode   PaymentMode         `json:"payment_mode"`
+	ReferenceNo   string              `json:"reference_no"`
+	Notes         string              `json:"notes"`
+	CreatedBy     uuid.UUID           `json:"created_by"`
+	CreatedByName string              `json:"created_by_name"`
+	CreatedAt     time.Time           `json:"created_at"`
+	Allocations   []VoucherAllocation `json:"allocations,omitempty"`
+}
+
+type VoucherAllocation struct {
+	ID         uuid.UUID `json:"id"`
+	VoucherID  uuid.UUID `json:"voucher_id"`
+	PurchaseID uuid.UUID `json:"purchase_id"`
+	InvoiceNo  string    `json:"invoice_no"`
+	Amount     float64   `json:"amount"`
+}
+
+// supplierTerms is the supplier data needed for due dates and limits
+type supplierTerms struct {
+	ID               uuid.UUID
+	Name             string
+	CreditPeriodDays int
+	CreditLimit      float64
+}
+
+// supplierPosition is the non-invoice part of a supplier's balance
+type supplierPosition struct {
+	supplierTerms
+	OpeningAmount     float64
+	OpeningDate       *time.Time
+	OnAccount         float64
+	PendingDebitNotes float64
+}
+
+// Request Structs
+
+type UpsertOpeningBalanceRequest struct {
+	Amount   float64 `json:"amount" validate:"gte=0"`
+	AsOfDate string  `json:"as_of_date" validate:"required,datetime=2006-01-02"`
+	Notes    string  `json:"notes" validate:"max=500"`
+}
+
+// CreatePaymentVoucherRequest pays a supplier. Allocations name the invoices
+// to settle; when omitted the oldest open invoices are settled first. Any
+// amount left over is kept on account against the opening balance or as an
+// advance.
+type CreatePaymentVoucherRequest struct {
+	SupplierID  uuid.UUID                  `json:"supplier_id" validate:"required"`
+	PaymentDate string                     `json:"payment_date" validate:"omitempty,datetime=2006-01-02"`
+	Amount      float64                    `json:"amount" validate:"required,gt=0"`
+	PaymentMode PaymentMode                `json:"payment_mode" validate:"required,oneof=CASH BANK_TRANSFER CHEQUE UPI"`
+	ReferenceNo string                     `json:"reference_no" validate:"max=100"`
+	Notes       string                     `json:"notes" validate:"max=500"`
+	Allocations []VoucherAllocationRequest `json:"allocations" validate:"omitempty,dive"`
+}
+
+type VoucherAllocationRequest struct {
+	PurchaseID uuid.UUID `json:"purchase_id" validate:"required"`
+	Amount     float64   `json:"amount" validate:"required,gt=0"`
+}
+
+// SupplierOutstanding is a supplier's position with the invoices behind it
+type SupplierOutstanding struct {
+	SupplierPayable
+	Invoices []OpenInvoice `json:"invoices"`
+}
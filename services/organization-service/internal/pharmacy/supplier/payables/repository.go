@@ -0,0 +1,394 @@
+package payables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"organization-service/internal/pharmacy/numbering"
+
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	GetSupplierTerms(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*supplierTerms, error)
+	// ListPositions returns opening balance, on-account payments and pending debit
+	// notes per supplier; supplierID narrows it to one supplier
+	ListPositions(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID) ([]supplierPosition, error)
+	ListOpenInvoices(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID) ([]OpenInvoice, error)
+	// ListLedgerEntries returns every ledger line of a supplier in date order, without balances
+	ListLedgerEntries(ctx context.Context, pharmacyID, supplierID uuid.UUID) ([]LedgerEntry, error)
+	GetOpeningBalance(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*OpeningBalance, error)
+	UpsertOpeningBalance(ctx context.Context, ob *OpeningBalance) error
+	CreateVoucher(ctx context.Context, v *PaymentVoucher) error
+	GetVoucher(ctx context.Context, pharmacyID, id uuid.UUID) (*PaymentVoucher, error)
+	ListVouchers(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, limit, offset int) ([]PaymentVoucher, int, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) GetSupplierTerms(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*supplierTerms, error) {
+	t := &supplierTerms{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, COALESCE(credit_period_days, 0), COALESCE(credit_limit, 0)
+		FROM supplier_schema.suppliers
+		WHERE id = $1 AND pharmacy_id = $2
+	`, supplierID, pharmacyID).Scan(&t.ID, &t.Name, &t.CreditPeriodDays, &t.CreditLimit)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("supplier not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *postgresRepository) ListPositions(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID) ([]supplierPosition, error) {
+	query := `
+		SELECT s.id, s.name, COALESCE(s.credit_period_days, 0), COALESCE(s.credit_limit, 0),
+		       COALESCE(ob.amount, 0), ob.as_of_date,
+		       COALESCE((
+		           SELECT SUM(v.amount - COALESCE((
+		               SELECT SUM(a.amount) FROM supplier_schema.payment_voucher_allocations a WHERE a.voucher_id = v.id
+		           ), 0))
+		           FROM supplier_schema.payment_vouchers v
+		           WHERE v.pharmacy_id = s.pharmacy_id AND v.supplier_id = s.id
+		       ), 0),
+		       COALESCE((
+		           SELECT SUM(d.total_amount - d.credited_amount)
+		           FROM inventory.debit_notes d
+		           WHERE d.pharmacy_id = s.pharmacy_id AND d.supplier_id = s.id
+		       ), 0)
+		FROM supplier_schema.suppliers s
+		LEFT JOIN supplier_schema.supplier_opening_balances ob ON ob.pharmacy_id = s.pharmacy_id AND ob.supplier_id = s.id
+		WHERE s.pharmacy_id = $1`
+	args := []interface{}{pharmacyID}
+	if supplierID != nil {
+		args = append(args, *supplierID)
+		query += " AND s.id = $2"
+	}
+	query += " ORDER BY s.name"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load supplier positions: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []supplierPosition
+	for rows.Next() {
+		var p supplierPosition
+		var openingDate sql.NullTime
+		if err := rows.Scan(
+			&p.ID, &p.Name, &p.CreditPeriodDays, &p.CreditLimit,
+			&p.OpeningAmount, &openingDate, &p.OnAccount, &p.PendingDebitNotes,
+		); err != nil {
+			return nil, err
+		}
+		if openingDate.Valid {
+			p.OpeningDate = &openingDate.Time
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+func (r *postgresRepository) ListOpenInvoices(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID) ([]OpenInvoice, error) {
+	query := `
+		SELECT p.id, p.supplier_id, COALESCE(s.name, ''), p.invoice_no, p.purchase_date,
+		       p.purchase_date + COALESCE(s.credit_period_days, 0),
+		       COALESCE(p.grand_total, 0), COALESCE(p.paid_amount, 0), COALESCE(p.due_amount, 0)
+		FROM inventory.purchases p
+		LEFT JOIN supplier_schema.suppliers s ON s.id = p.supplier_id
+		WHERE p.pharmacy_id = $1 AND p.due_amount > 0`
+	args := []interface{}{pharmacyID}
+	if supplierID != nil {
+		args = append(args, *supplierID)
+		query += " AND p.supplier_id = $2"
+	}
+	query += " ORDER BY p.purchase_date ASC, p.created_at ASC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list open invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []OpenInvoice
+	for rows.Next() {
+		var inv OpenInvoice
+		if err := rows.Scan(
+			&inv.PurchaseID, &inv.SupplierID, &inv.SupplierName, &inv.InvoiceNo, &inv.PurchaseDate,
+			&inv.DueDate, &inv.GrandTotal, &inv.PaidAmount, &inv.DueAmount,
+		); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
+
+// ListLedgerEntries builds the statement from the source documents. Payments
+// made directly on an invoice (stock-in payment edits) are whatever part of
+// paid_amount no voucher or debit-note set-off accounts for.
+func (r *postgresRepository) ListLedgerEntries(ctx context.Context, pharmacyID, supplierID uuid.UUID) ([]LedgerEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT ob.as_of_date, ob.updated_at, 'OPENING_BALANCE', NULL::uuid, '',
+		       COALESCE(NULLIF(ob.notes, ''), 'Opening balance'), 0::numeric, ob.amount
+		FROM supplier_schema.supplier_opening_balances ob
+		WHERE ob.pharmacy_id = $1 AND ob.supplier_id = $2 AND ob.amount > 0
+
+		UNION ALL
+		SELECT p.purchase_date, p.created_at, 'PURCHASE', p.id, p.invoice_no,
+		       'Purchase invoice', 0, COALESCE(p.grand_total, 0)
+		FROM inventory.purchases p
+		WHERE p.pharmacy_id = $1 AND p.supplier_id = $2
+
+		UNION ALL
+		SELECT v.payment_date, v.created_at, 'PAYMENT', v.id, v.voucher_no,
+		       v.payment_mode || COALESCE(' ' || NULLIF(v.reference_no, ''), ''), v.amount, 0
+		FROM supplier_schema.payment_vouchers v
+		WHERE v.pharmacy_id = $1 AND v.supplier_id = $2
+
+		UNION ALL
+		SELECT x.paid_on, x.updated_at, 'INVOICE_PAYMENT', x.id, x.invoice_no, 'Paid on invoice', x.direct, 0
+		FROM (
+			SELECT p.id, p.invoice_no, p.updated_at, timezone('Asia/Kolkata', p.updated_at)::date AS paid_on,
+			       COALESCE(p.paid_amount, 0)
+			       - COALESCE((SELECT SUM(a.amount) FROM supplier_schema.payment_voucher_allocations a WHERE a.purchase_id = p.id), 0)
+			       - COALESCE((SELECT SUM(a.amount) FROM inventory.debit_note_allocations a WHERE a.purchase_id = p.id), 0) AS direct
+			FROM inventory.purchases p
+			WHERE p.pharmacy_id = $1 AND p.supplier_id = $2
+		) x
+		WHERE x.direct > 0.005
+
+		UNION ALL
+		SELECT timezone('Asia/Kolkata', d.created_at)::date, d.created_at, 'DEBIT_NOTE', d.id, d.debit_note_no,
+		       COALESCE(NULLIF(d.reason, ''), 'Purchase return'), d.total_amount, 0
+		FROM inventory.debit_notes d
+		WHERE d.pharmacy_id = $1 AND d.supplier_id = $2
+
+		UNION ALL
+		SELECT timezone('Asia/Kolkata', c.created_at)::date, c.created_at, 'DEBIT_NOTE_REFUND', d.id, d.debit_note_no,
+		       'Refund received' || COALESCE(' against ' || c.supplier_credit_note_no, ''), 0, c.amount
+		FROM inventory.debit_note_credits c
+		JOIN inventory.debit_notes d ON d.id = c.debit_note_id
+		WHERE d.pharmacy_id = $1 AND d.supplier_id = $2 AND c.mode = 'REFUND'
+
+		ORDER BY 1, 2
+	`, pharmacyID, supplierID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load supplier ledger: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		var e LedgerEntry
+		var refID uuid.NullUUID
+		if err := rows.Scan(&e.Date, &e.createdAt, &e.Type, &refID, &e.ReferenceNo, &e.Description, &e.Debit, &e.Credit); err != nil {
+			return nil, err
+		}
+		if refID.Valid {
+			e.ReferenceID = &refID.UUID
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *postgresRepository) GetOpeningBalance(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*OpeningBalance, error) {
+	ob := &OpeningBalance{}
+	var updatedBy uuid.NullUUID
+	err := r.db.QueryRowContext(ctx, `
+		SELECT pharmacy_id, supplier_id, amount, as_of_date, COALESCE(notes, ''), updated_by,
+		       COALESCE(updated_by_name, ''), updated_at
+		FROM supplier_schema.supplier_opening_balances
+		WHERE pharmacy_id = $1 AND supplier_id = $2
+	`, pharmacyID, supplierID).Scan(
+		&ob.PharmacyID, &ob.SupplierID, &ob.Amount, &ob.AsOfDate, &ob.Notes, &updatedBy, &ob.UpdatedByName, &ob.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ob.UpdatedBy = updatedBy.UUID
+	return ob, nil
+}
+
+func (r *postgresRepository) UpsertOpeningBalance(ctx context.Context, ob *OpeningBalance) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO supplier_schema.supplier_opening_balances (
+			pharmacy_id, supplier_id, amount, as_of_date, notes, updated_by, updated_by_name, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (pharmacy_id, supplier_id) DO UPDATE SET
+			amount = EXCLUDED.amount, as_of_date = EXCLUDED.as_of_date, notes = EXCLUDED.notes,
+			updated_by = EXCLUDED.updated_by, updated_by_name = EXCLUDED.updated_by_name, updated_at = EXCLUDED.updated_at
+	`, ob.PharmacyID, ob.SupplierID, ob.Amount, ob.AsOfDate, ob.Notes, ob.UpdatedBy, ob.UpdatedByName, ob.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save opening balance: %w", err)
+	}
+
+	if err := insertSupplierLog(ctx, tx, ob.PharmacyID, ob.SupplierID, "OPENING_BALANCE", "", nil, ob.UpdatedBy, ob.UpdatedByName, ob.UpdatedAt,
+		fmt.Sprintf("Opening balance set to %.2f as of %s", ob.Amount, ob.AsOfDate.Format("2006-01-02"))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertSupplierLog records the payables event in the supplier history
+func insertSupplierLog(ctx context.Context, tx *sql.Tx, pharmacyID, supplierID uuid.UUID, action, refType string, refID *uuid.UUID, userID uuid.UUID, userName string, at time.Time, notes string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO supplier_schema.supplier_audit_logs (
+			id, pharmacy_id, supplier_id, action_type, changed_by, changed_by_name, changed_at,
+			reference_type, reference_id, notes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10)
+	`, uuid.New(), pharmacyID, supplierID, action, userID, userName, at, refType, refID, notes)
+	if err != nil {
+		return fmt.Errorf("failed to write supplier history: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) CreateVoucher(ctx context.Context, v *PaymentVoucher) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Voucher numbers come from the pharmacy's payment voucher series: PV/26-27/00001
+	if v.VoucherNo, err = numbering.Next(ctx, tx, v.PharmacyID, numbering.DocPaymentVoucher, v.CreatedAt); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO supplier_schema.payment_vouchers (
+			id, pharmacy_id, supplier_id, voucher_no, payment_date, amount, payment_mode, reference_no,
+			notes, created_by, created_by_name, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11, $12)
+	`, v.ID, v.PharmacyID, v.SupplierID, v.VoucherNo, v.PaymentDate, v.Amount, v.PaymentMode, v.ReferenceNo,
+		v.Notes, v.CreatedBy, v.CreatedByName, v.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert payment voucher: %w", err)
+	}
+
+	for _, a := range v.Allocations {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO supplier_schema.payment_voucher_allocations (id, voucher_id, purchase_id, amount, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, a.ID, v.ID, a.PurchaseID, a.Amount, v.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert voucher allocation: %w", err)
+		}
+	}
+
+	summary := fmt.Sprintf("%s paid %.2f by %s against %d invoices", v.VoucherNo, v.Amount, v.PaymentMode, len(v.Allocations))
+	if v.OnAccount > 0 {
+		summary += fmt.Sprintf(", %.2f on account", v.OnAccount)
+	}
+	if err := insertSupplierLog(ctx, tx, v.PharmacyID, v.SupplierID, "PAYMENT_VOUCHER", "PAYMENT_VOUCHER", &v.ID,
+		v.CreatedBy, v.CreatedByName, v.CreatedAt, summary); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const selectVoucher = `
+	SELECT v.id, v.pharmacy_id, v.supplier_id, COALESCE(s.name, ''), v.voucher_no, v.payment_date, v.amount,
+	       v.amount - COALESCE((SELECT SUM(a.amount) FROM supplier_schema.payment_voucher_allocations a WHERE a.voucher_id = v.id), 0),
+	       v.payment_mode, COALESCE(v.reference_no, ''), COALESCE(v.notes, ''), v.created_by,
+	       COALESCE(v.created_by_name, ''), v.created_at
+	FROM supplier_schema.payment_vouchers v
+	LEFT JOIN supplier_schema.suppliers s ON s.id = v.supplier_id
+`
+
+func scanVoucher(row interface{ Scan(...interface{}) error }) (*PaymentVoucher, error) {
+	var v PaymentVoucher
+	var createdBy uuid.NullUUID
+	if err := row.Scan(
+		&v.ID, &v.PharmacyID, &v.SupplierID, &v.SupplierName, &v.VoucherNo, &v.PaymentDate, &v.Amount,
+		&v.OnAccount, &v.PaymentMode, &v.ReferenceNo, &v.Notes, &createdBy,
+		&v.CreatedByName, &v.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	v.CreatedBy = createdBy.UUID
+	return &v, nil
+}
+
+func (r *postgresRepository) GetVoucher(ctx context.Context, pharmacyID, id uuid.UUID) (*PaymentVoucher, error) {
+	v, err := scanVoucher(r.db.QueryRowContext(ctx, selectVoucher+" WHERE v.id = $1 AND v.pharmacy_id = $2", id, pharmacyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("payment voucher not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.voucher_id, a.purchase_id, COALESCE(p.invoice_no, ''), a.amount
+		FROM supplier_schema.payment_voucher_allocations a
+		LEFT JOIN inventory.purchases p ON p.id = a.purchase_id
+		WHERE a.voucher_id = $1
+		ORDER BY p.purchase_date, p.invoice_no
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a VoucherAllocation
+		if err := rows.Scan(&a.ID, &a.VoucherID, &a.PurchaseID, &a.InvoiceNo, &a.Amount); err != nil {
+			return nil, err
+		}
+		v.Allocations = append(v.Allocations, a)
+	}
+	return v, rows.Err()
+}
+
+func (r *postgresRepository) ListVouchers(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, limit, offset int) ([]PaymentVoucher, int, error) {
+	where := " WHERE v.pharmacy_id = $1"
+	args := []interface{}{pharmacyID}
+	if supplierID != nil {
+		args = append(args, *supplierID)
+		where += fmt.Sprintf(" AND v.supplier_id = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM supplier_schema.payment_vouchers v"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := selectVoucher + where + fmt.Sprintf(" ORDER BY v.payment_date DESC, v.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var vouchers []PaymentVoucher
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		vouchers = append(vouchers, *v)
+	}
+	return vouchers, total, rows.Err()
+}
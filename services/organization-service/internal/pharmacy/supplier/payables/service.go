@@ -0,0 +1,361 @@
+package payables
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"organization-service/internal/pharmacy/clock"
+	"organization-service/internal/pharmacy/inventory/stockin"
+	"organization-service/internal/pharmacy/money"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	// GetAgeingReport returns every supplier with a balance, bucketed by invoice age
+	GetAgeingReport(ctx context.Context, pharmacyID uuid.UUID) (*AgeingReport, error)
+	GetOutstanding(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*SupplierOutstanding, error)
+	// ListDue returns open invoices that are overdue or fall due within the given days
+	ListDue(ctx context.Context, pharmacyID uuid.UUID, withinDays int) ([]OpenInvoice, error)
+	GetLedger(ctx context.Context, pharmacyID, supplierID uuid.UUID, from, to *time.Time) (*Ledger, error)
+	GetOpeningBalance(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*OpeningBalance, error)
+	SetOpeningBalance(ctx context.Context, pharmacyID, supplierID, userID uuid.UUID, userName string, req UpsertOpeningBalanceRequest) (*OpeningBalance, error)
+	// CreateVoucher records one payment and applies it to the supplier's invoices
+	// through stock-in, so purchase payment status stays the source of truth
+	CreateVoucher(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreatePaymentVoucherRequest) (*PaymentVoucher, error)
+	GetVoucher(ctx context.Context, pharmacyID, id uuid.UUID) (*PaymentVoucher, error)
+	ListVouchers(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, limit, offset int) ([]PaymentVoucher, int, error)
+}
+
+type service struct {
+	repo       Repository
+	stockInSvc stockin.Service
+}
+
+func NewService(repo Repository, stockInSvc stockin.Service) Service {
+	return &service{
+		repo:       repo,
+		stockInSvc: stockInSvc,
+	}
+}
+
+func (s *service) GetAgeingReport(ctx context.Context, pharmacyID uuid.UUID) (*AgeingReport, error) {
+	today := clock.Today()
+	positions, err := s.repo.ListPositions(ctx, pharmacyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := s.repo.ListOpenInvoices(ctx, pharmacyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	bySupplier := make(map[uuid.UUID][]OpenInvoice)
+	for _, inv := range invoices {
+		bySupplier[inv.SupplierID] = append(bySupplier[inv.SupplierID], inv)
+	}
+
+	report := &AgeingReport{AsOf: today, Suppliers: []SupplierPayable{}}
+	for _, pos := range positions {
+		p := buildPayable(pos, bySupplier[pos.ID], today)
+		if p.NetPayable == 0 && p.InvoiceOutstanding == 0 && p.PendingDebitNotes == 0 && p.Advance == 0 {
+			continue
+		}
+		report.Suppliers = append(report.Suppliers, p)
+
+		t := &report.Totals
+		t.OpeningOutstanding = money.Round2(t.OpeningOutstanding + p.OpeningOutstanding)
+		t.InvoiceOutstanding = money.Round2(t.InvoiceOutstanding + p.InvoiceOutstanding)
+		t.PendingDebitNotes = money.Round2(t.PendingDebitNotes + p.PendingDebitNotes)
+		t.Advance = money.Round2(t.Advance + p.Advance)
+		t.NetPayable = money.Round2(t.NetPayable + p.NetPayable)
+		t.Overdue = money.Round2(t.Overdue + p.Overdue)
+		t.OpenInvoices += p.OpenInvoices
+		t.Ageing.Days0To30 = money.Round2(t.Ageing.Days0To30 + p.Ageing.Days0To30)
+		t.Ageing.Days31To60 = money.Round2(t.Ageing.Days31To60 + p.Ageing.Days31To60)
+		t.Ageing.Days61To90 = money.Round2(t.Ageing.Days61To90 + p.Ageing.Days61To90)
+		t.Ageing.Days90Plus = money.Round2(t.Ageing.Days90Plus + p.Ageing.Days90Plus)
+	}
+	return report, nil
+}
+
+func (s *service) GetOutstanding(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*SupplierOutstanding, error) {
+	today := clock.Today()
+	positions, err := s.repo.ListPositions(ctx, pharmacyID, &supplierID)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, fmt.Errorf("supplier not found")
+	}
+	invoices, err := s.repo.ListOpenInvoices(ctx, pharmacyID, &supplierID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range invoices {
+		annotate(&invoices[i], today)
+	}
+	if invoices == nil {
+		invoices = []OpenInvoice{}
+	}
+	return &SupplierOutstanding{
+		SupplierPayable: buildPayable(positions[0], invoices, today),
+		Invoices:        invoices,
+	}, nil
+}
+
+// buildPayable combines a supplier's open invoices with its opening balance,
+// on-account payments and uncredited debit notes. Unallocated voucher amounts
+// settle the opening balance first; anything beyond it is an advance.
+func buildPayable(pos supplierPosition, invoices []OpenInvoice, today time.Time) SupplierPayable {
+	p := SupplierPayable{
+		SupplierID:        pos.ID,
+		SupplierName:      pos.Name,
+		CreditPeriodDays:  pos.CreditPeriodDays,
+		CreditLimit:       pos.CreditLimit,
+		PendingDebitNotes: money.Round2(pos.PendingDebitNotes),
+	}
+
+	openingLeft := money.Round2(pos.OpeningAmount - pos.OnAccount)
+	if openingLeft > 0 {
+		p.OpeningOutstanding = openingLeft
+		age := 0
+		if pos.OpeningDate != nil {
+			age = daysBetween(*pos.OpeningDate, today)
+			if today.After(pos.OpeningDate.AddDate(0, 0, pos.CreditPeriodDays)) {
+				p.Overdue = openingLeft
+			}
+		}
+		p.Ageing.add(age, openingLeft)
+	} else {
+		p.Advance = -openingLeft
+	}
+
+	for _, inv := range invoices {
+		annotate(&inv, today)
+		p.InvoiceOutstanding = money.Round2(p.InvoiceOutstanding + inv.DueAmount)
+		p.OpenInvoices++
+		if inv.Overdue {
+			p.Overdue = money.Round2(p.Overdue + inv.DueAmount)
+		}
+		p.Ageing.add(inv.AgeDays, inv.DueAmount)
+	}
+
+	p.NetPayable = money.Round2(p.OpeningOutstanding + p.InvoiceOutstanding - p.PendingDebitNotes - p.Advance)
+	p.OverLimit = p.CreditLimit > 0 && p.NetPayable > p.CreditLimit
+	return p
+}
+
+func annotate(inv *OpenInvoice, today time.Time) {
+	inv.AgeDays = daysBetween(inv.PurchaseDate, today)
+	inv.DaysOverdue = daysBetween(inv.DueDate, today)
+	inv.Overdue = inv.DaysOverdue > 0
+}
+
+func (s *service) ListDue(ctx context.Context, pharmacyID uuid.UUID, withinDays int) ([]OpenInvoice, error) {
+	today := clock.Today()
+	invoices, err := s.repo.ListOpenInvoices(ctx, pharmacyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	due := []OpenInvoice{}
+	for _, inv := range invoices {
+		annotate(&inv, today)
+		if inv.DaysOverdue >= -withinDays {
+			due = append(due, inv)
+		}
+	}
+	return due, nil
+}
+
+func (s *service) GetLedger(ctx context.Context, pharmacyID, supplierID uuid.UUID, from, to *time.Time) (*Ledger, error) {
+	terms, err := s.repo.GetSupplierTerms(ctx, pharmacyID, supplierID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.ListLedgerEntries(ctx, pharmacyID, supplierID)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &Ledger{
+		SupplierID:   supplierID,
+		SupplierName: terms.Name,
+		From:         from,
+		To:           to,
+		Entries:      []LedgerEntry{},
+	}
+	balance := 0.0
+	for _, e := range entries {
+		if to != nil && e.Date.After(*to) {
+			break
+		}
+		balance = money.Round2(balance + e.Credit - e.Debit)
+		if from != nil && e.Date.Before(*from) {
+			ledger.BroughtForward = balance
+			continue
+		}
+		e.Balance = balance
+		ledger.TotalDebit = money.Round2(ledger.TotalDebit + e.Debit)
+		ledger.TotalCredit = money.Round2(ledger.TotalCredit + e.Credit)
+		ledger.Entries = append(ledger.Entries, e)
+	}
+	ledger.ClosingBalance = balance
+	return ledger, nil
+}
+
+func (s *service) GetOpeningBalance(ctx context.Context, pharmacyID, supplierID uuid.UUID) (*OpeningBalance, error) {
+	if _, err := s.repo.GetSupplierTerms(ctx, pharmacyID, supplierID); err != nil {
+		return nil, err
+	}
+	ob, err := s.repo.GetOpeningBalance(ctx, pharmacyID, supplierID)
+	if err != nil {
+		return nil, err
+	}
+	if ob == nil {
+		return &OpeningBalance{PharmacyID: pharmacyID, SupplierID: supplierID}, nil
+	}
+	return ob, nil
+}
+
+func (s *service) SetOpeningBalance(ctx context.Context, pharmacyID, supplierID, userID uuid.UUID, userName string, req UpsertOpeningBalanceRequest) (*OpeningBalance, error) {
+	if _, err := s.repo.GetSupplierTerms(ctx, pharmacyID, supplierID); err != nil {
+		return nil, err
+	}
+	asOf, err := time.Parse("2006-01-02", req.AsOfDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid as_of_date: %w", err)
+	}
+	ob := &OpeningBalance{
+		PharmacyID:    pharmacyID,
+		SupplierID:    supplierID,
+		Amount:        money.Round2(req.Amount),
+		AsOfDate:      asOf,
+		Notes:         req.Notes,
+		UpdatedBy:     userID,
+		UpdatedByName: userName,
+		UpdatedAt:     time.Now(),
+	}
+	if err := s.repo.UpsertOpeningBalance(ctx, ob); err != nil {
+		return nil, err
+	}
+	return ob, nil
+}
+
+func (s *service) CreateVoucher(ctx context.Context, pharmacyID, userID uuid.UUID, userName string, req CreatePaymentVoucherRequest) (*PaymentVoucher, error) {
+	terms, err := s.repo.GetSupplierTerms(ctx, pharmacyID, req.SupplierID)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentDate := clock.Today()
+	if req.PaymentDate != "" {
+		if paymentDate, err = time.Parse("2006-01-02", req.PaymentDate); err != nil {
+			return nil, fmt.Errorf("invalid payment_date: %w", err)
+		}
+	}
+
+	amount := money.Round2(req.Amount)
+	allocations, err := s.planAllocations(ctx, pharmacyID, req.SupplierID, amount, req.Allocations)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &PaymentVoucher{
+		ID:            uuid.New(),
+		PharmacyID:    pharmacyID,
+		SupplierID:    req.SupplierID,
+		SupplierName:  terms.Name,
+		PaymentDate:   paymentDate,
+		Amount:        amount,
+		OnAccount:     amount,
+		PaymentMode:   req.PaymentMode,
+		ReferenceNo:   req.ReferenceNo,
+		Notes:         req.Notes,
+		CreatedBy:     userID,
+		CreatedByName: userName,
+		CreatedAt:     time.Now(),
+	}
+
+	for i := range allocations {
+		a := &allocations[i]
+		purchase, _, err := s.stockInSvc.GetStockInDetails(ctx, pharmacyID, a.PurchaseID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.stockInSvc.UpdateStockInPayment(ctx, pharmacyID, a.PurchaseID, userID, userName, stockin.UpdateStockInPaymentRequest{
+			PaidAmount: money.Round2(purchase.PaidAmount + a.Amount),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to apply %.2f to invoice %s: %w", a.Amount, a.InvoiceNo, err)
+		}
+		a.ID = uuid.New()
+		a.VoucherID = v.ID
+		v.OnAccount = money.Round2(v.OnAccount - a.Amount)
+	}
+	v.Allocations = allocations
+
+	if err := s.repo.CreateVoucher(ctx, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// planAllocations validates explicit allocations, or settles the supplier's
+// oldest open invoices first. Unlike debit-note set-offs, a voucher may leave
+// an amount on account.
+func (s *service) planAllocations(ctx context.Context, pharmacyID, supplierID uuid.UUID, amount float64, requested []VoucherAllocationRequest) ([]VoucherAllocation, error) {
+	open, err := s.repo.ListOpenInvoices(ctx, pharmacyID, &supplierID)
+	if err != nil {
+		return nil, err
+	}
+	due := make(map[uuid.UUID]OpenInvoice, len(open))
+	for _, inv := range open {
+		due[inv.PurchaseID] = inv
+	}
+
+	var allocations []VoucherAllocation
+	remaining := amount
+	if len(requested) > 0 {
+		for _, r := range requested {
+			inv, ok := due[r.PurchaseID]
+			if !ok {
+				return nil, fmt.Errorf("purchase %s is not an open invoice of this supplier", r.PurchaseID)
+			}
+			if r.Amount > inv.DueAmount+0.005 {
+				return nil, fmt.Errorf("allocation of %.2f exceeds amount due %.2f on invoice %s", r.Amount, inv.DueAmount, inv.InvoiceNo)
+			}
+			inv.DueAmount = money.Round2(inv.DueAmount - r.Amount)
+			due[r.PurchaseID] = inv
+			allocations = append(allocations, VoucherAllocation{PurchaseID: inv.PurchaseID, InvoiceNo: inv.InvoiceNo, Amount: money.Round2(r.Amount)})
+			remaining = money.Round2(remaining - r.Amount)
+		}
+		if remaining < -0.005 {
+			return nil, fmt.Errorf("allocations add up to more than the voucher amount %.2f", amount)
+		}
+		return allocations, nil
+	}
+
+	for _, inv := range open {
+		if remaining <= 0.005 {
+			break
+		}
+		part := math.Min(remaining, inv.DueAmount)
+		allocations = append(allocations, VoucherAllocation{PurchaseID: inv.PurchaseID, InvoiceNo: inv.InvoiceNo, Amount: money.Round2(part)})
+		remaining = money.Round2(remaining - part)
+	}
+	return allocations, nil
+}
+
+func (s *service) GetVoucher(ctx context.Context, pharmacyID, id uuid.UUID) (*PaymentVoucher, error) {
+	return s.repo.GetVoucher(ctx, pharmacyID, id)
+}
+
+func (s *service) ListVouchers(ctx context.Context, pharmacyID uuid.UUID, supplierID *uuid.UUID, limit, offset int) ([]PaymentVoucher, int, error) {
+	return s.repo.ListVouchers(ctx, pharmacyID, supplierID, limit, offset)
+}
+
+func daysBetween(from, to time.Time) int {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
@@ -0,0 +1,177 @@
+package payables
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var today = time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+func daysAgo(n int) time.Time { return today.AddDate(0, 0, -n) }
+
+func TestAgeingBucketsAdd(t *testing.T) {
+	tests := []struct {
+		age  int
+		want AgeingBuckets
+	}{
+		{0, AgeingBuckets{Days0To30: 100}},
+		{30, AgeingBuckets{Days0To30: 100}},
+		{31, AgeingBuckets{Days31To60: 100}},
+		{60, AgeingBuckets{Days31To60: 100}},
+		{61, AgeingBuckets{Days61To90: 100}},
+		{90, AgeingBuckets{Days61To90: 100}},
+		{91, AgeingBuckets{Days90Plus: 100}},
+	}
+
+	for _, tt := range tests {
+		var b AgeingBuckets
+		b.add(tt.age, 100)
+		if b != tt.want {
+			t.Errorf("add(%d days) = %+v, want %+v", tt.age, b, tt.want)
+		}
+	}
+}
+
+func TestBuildPayable(t *testing.T) {
+	terms := supplierTerms{ID: uuid.New(), Name: "Medline Distributors", CreditPeriodDays: 30, CreditLimit: 1000}
+	invoice := func(ageDays int, due float64) OpenInvoice {
+		return OpenInvoice{PurchaseDate: daysAgo(ageDays), DueDate: daysAgo(ageDays).AddDate(0, 0, 30), DueAmount: due}
+	}
+	openedAgo := func(n int) *time.Time { d := daysAgo(n); return &d }
+
+	tests := []struct {
+		name         string
+		pos          supplierPosition
+		invoices     []OpenInvoice
+		wantOpening  float64
+		wantAdvance  float64
+		wantNet      float64
+		wantOverdue  float64
+		wantOver     bool
+		wantAgeing   AgeingBuckets
+		wantInvoices int
+	}{
+		{
+			name: "nothing outstanding",
+			pos:  supplierPosition{supplierTerms: terms},
+		},
+		{
+			name:         "invoices age into buckets and go overdue",
+			pos:          supplierPosition{supplierTerms: terms},
+			invoices:     []OpenInvoice{invoice(10, 200), invoice(45, 300)},
+			wantNet:      500,
+			wantOverdue:  300,
+			wantAgeing:   AgeingBuckets{Days0To30: 200, Days31To60: 300},
+			wantInvoices: 2,
+		},
+		{
+			name:        "on-account payment settles the opening balance first",
+			pos:         supplierPosition{supplierTerms: terms, OpeningAmount: 500, OpeningDate: openedAgo(100), OnAccount: 200},
+			wantOpening: 300,
+			wantNet:     300,
+			wantOverdue: 300,
+			wantAgeing:  AgeingBuckets{Days90Plus: 300},
+		},
+		{
+			name:         "payment beyond the opening balance is an advance",
+			pos:          supplierPosition{supplierTerms: terms, OpeningAmount: 100, OnAccount: 250},
+			invoices:     []OpenInvoice{invoice(5, 400)},
+			wantAdvance:  150,
+			wantNet:      250,
+			wantAgeing:   AgeingBuckets{Days0To30: 400},
+			wantInvoices: 1,
+		},
+		{
+			name:         "uncredited debit notes reduce the net payable",
+			pos:          supplierPosition{supplierTerms: terms, PendingDebitNotes: 120},
+			invoices:     []OpenInvoice{invoice(5, 400)},
+			wantNet:      280,
+			wantAgeing:   AgeingBuckets{Days0To30: 400},
+			wantInvoices: 1,
+		},
+		{
+			name:         "over the credit limit",
+			pos:          supplierPosition{supplierTerms: terms},
+			invoices:     []OpenInvoice{invoice(5, 700), invoice(20, 400)},
+			wantNet:      1100,
+			wantOver:     true,
+			wantAgeing:   AgeingBuckets{Days0To30: 1100},
+			wantInvoices: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := buildPayable(tt.pos, tt.invoices, today)
+			if p.OpeningOutstanding != tt.wantOpening || p.Advance != tt.wantAdvance {
+				t.Errorf("opening/advance = %v/%v, want %v/%v", p.OpeningOutstanding, p.Advance, tt.wantOpening, tt.wantAdvance)
+			}
+			if p.NetPayable != tt.wantNet {
+				t.Errorf("NetPayable = %v, want %v", p.NetPayable, tt.wantNet)
+			}
+			if p.Overdue != tt.wantOverdue {
+				t.Errorf("Overdue = %v, want %v", p.Overdue, tt.wantOverdue)
+			}
+			if p.OverLimit != tt.wantOver {
+				t.Errorf("OverLimit = %v, want %v", p.OverLimit, tt.wantOver)
+			}
+			if p.Ageing != tt.wantAgeing {
+				t.Errorf("Ageing = %+v, want %+v", p.Ageing, tt.wantAgeing)
+			}
+			if p.OpenInvoices != tt.wantInvoices {
+				t.Errorf("OpenInvoices = %d, want %d", p.OpenInvoices, tt.wantInvoices)
+			}
+		})
+	}
+}
+
+// fakeRepository serves the supplier's open invoices, oldest first
+type fakeRepository struct {
+	Repository
+	open []OpenInvoice
+}
+
+func (f *fakeRepository) ListOpenInvoices(context.Context, uuid.UUID, *uuid.UUID) ([]OpenInvoice, error) {
+	return f.open, nil
+}
+
+func TestPlanAllocations(t *testing.T) {
+	older := OpenInvoice{PurchaseID: uuid.New(), InvoiceNo: "INV-1", DueAmount: 300}
+	newer := OpenInvoice{PurchaseID: uuid.New(), InvoiceNo: "INV-2", DueAmount: 500}
+	svc := &service{repo: &fakeRepository{open: []OpenInvoice{older, newer}}}
+
+	tests := []struct {
+		name      string
+		amount    float64
+		requested []VoucherAllocationRequest
+		want      []float64
+		wantErr   bool
+	}{
+		{"oldest invoice first", 450, nil, []float64{300, 150}, false},
+		{"excess stays on account", 1000, nil, []float64{300, 500}, false},
+		{"explicit allocation may leave an amount on account", 400, []VoucherAllocationRequest{{PurchaseID: newer.PurchaseID, Amount: 250}}, []float64{250}, false},
+		{"explicit allocations above the voucher", 200, []VoucherAllocationRequest{{PurchaseID: newer.PurchaseID, Amount: 250}}, nil, true},
+		{"explicit allocation above the amount due", 400, []VoucherAllocationRequest{{PurchaseID: older.PurchaseID, Amount: 350}}, nil, true},
+		{"invoice of another supplier", 100, []VoucherAllocationRequest{{PurchaseID: uuid.New(), Amount: 100}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.planAllocations(context.Background(), uuid.New(), uuid.New(), tt.amount, tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("planAllocations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d allocations, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, amount := range tt.want {
+				if got[i].Amount != amount {
+					t.Errorf("allocation[%d] = %.2f, want %.2f", i, got[i].Amount, amount)
+				}
+			}
+		})
+	}
+}
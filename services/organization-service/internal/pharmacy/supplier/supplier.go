@@ -85,6 +85,10 @@ type SupplierAuditLog struct {
 	ChangedBy     uuid.UUID `json:"changed_by"`
 	ChangedByName string    `json:"changed_by_name"`
 	ChangedAt     time.Time `json:"changed_at"`
+	// Set for document events such as debit notes
+	ReferenceType string     `json:"reference_type,omitempty"`
+	ReferenceID   *uuid.UUID `json:"reference_id,omitempty"`
+	Notes         string     `json:"notes,omitempty"`
 }
 
 type SupplierStats struct {
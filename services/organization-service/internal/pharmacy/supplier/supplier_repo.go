@@ -270,7 +270,8 @@ func (r *postgresSupplierRepo) CreateAuditLog(ctx context.Context, l *SupplierAu
 func (r *postgresSupplierRepo) GetHistory(ctx context.Context, supplierID, pharmacyID uuid.UUID) ([]*SupplierAuditLog, error) {
 	query := `
 		SELECT 
-			id, pharmacy_id, supplier_id, action_type, changed_by, changed_by_name, changed_at
+			id, pharmacy_id, supplier_id, action_type, changed_by, changed_by_name, changed_at,
+			COALESCE(reference_type, ''), reference_id, COALESCE(notes, '')
 		FROM supplier_schema.supplier_audit_logs
 		WHERE supplier_id = $1 AND pharmacy_id = $2
 		ORDER BY changed_at DESC
@@ -286,6 +287,7 @@ func (r *postgresSupplierRepo) GetHistory(ctx context.Context, supplierID, pharm
 		var l SupplierAuditLog
 		err := rows.Scan(
 			&l.ID, &l.PharmacyID, &l.SupplierID, &l.ActionType, &l.ChangedBy, &l.ChangedByName, &l.ChangedAt,
+			&l.ReferenceType, &l.ReferenceID, &l.Notes,
 		)
 		if err != nil {
 			return nil, err
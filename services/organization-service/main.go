@@ -6,17 +6,33 @@ import (
 	"net/http"
 	"organization-service/config"
 	"organization-service/internal/patient"
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/gst"
 	"organization-service/internal/pharmacy/inventory/batches"
+	"organization-service/internal/pharmacy/inventory/debitnotes"
+	"organization-service/internal/pharmacy/inventory/expiry"
+	"organization-service/internal/pharmacy/inventory/labels"
 	"organization-service/internal/pharmacy/inventory/ledger"
 	"organization-service/internal/pharmacy/inventory/medicines"
+	"organization-service/internal/pharmacy/inventory/purchaseorders"
+	"organization-service/internal/pharmacy/inventory/reorder"
 	"organization-service/internal/pharmacy/inventory/reservations"
 	"organization-service/internal/pharmacy/inventory/stockin"
 	"organization-service/internal/pharmacy/inventory/stockouts"
+	"organization-service/internal/pharmacy/inventory/stocktake"
+	"organization-service/internal/pharmacy/inventory/transfers"
 	"organization-service/internal/pharmacy/notification"
+	"organization-service/internal/pharmacy/numbering"
+	"organization-service/internal/pharmacy/safety"
 	"organization-service/internal/pharmacy/sales/clients"
+	"organization-service/internal/pharmacy/sales/loyalty"
+	"organization-service/internal/pharmacy/sales/offline"
 	"organization-service/internal/pharmacy/sales/prescriptions"
+	"organization-service/internal/pharmacy/sales/promotions"
+	"organization-service/internal/pharmacy/sales/refills"
 	"organization-service/internal/pharmacy/sales/sales"
 	"organization-service/internal/pharmacy/supplier"
+	"organization-service/internal/pharmacy/supplier/payables"
 	"organization-service/routes"
 	"os"
 	"os/signal"
@@ -26,6 +42,7 @@ import (
 	"organization-service/middleware"
 
 	"github.com/gin-gonic/gin"
+	"shared-scheduler"
 )
 
 func main() {
@@ -40,6 +57,14 @@ func main() {
 	// This route is outside /api to match the Kong routing configuration
 	r.Static("/uploads", "./uploads")
 
+	// Background jobs run through the shared scheduler: every replica runs it,
+	// only the advisory-lock leader fires schedules
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		loc = time.FixedZone("IST", 5*3600+30*60)
+	}
+	jobs := scheduler.New(config.DB, loc, "organization-service")
+
 	// Initialize Domain Dependencies
 	patientRepo := patient.NewPatientRepository(config.DB)
 	patientService := patient.NewPatientService(patientRepo)
@@ -62,6 +87,7 @@ func main() {
 	resSvc := reservations.NewService(resRepo, batchesRepo)
 	resHandler := reservations.NewHandler(resSvc)
 	resSvc.StartPurgeWorker(context.Background()) // Start the background reservations purge worker
+	resSvc.RegisterJobs(jobs)                     // Release stock held by idle draft bills
 
 	stockInRepo := stockin.NewRepository(config.DB)
 	stockInSvc := stockin.NewService(stockInRepo, medsRepo, batchesSvc)
@@ -71,35 +97,116 @@ func main() {
 	stockOutSvc := stockouts.NewService(stockOutRepo)
 	stockOutHandler := stockouts.NewHandler(stockOutSvc)
 
+	poRepo := purchaseorders.NewRepository(config.DB)
+	poSvc := purchaseorders.NewService(poRepo, medsRepo, stockInSvc)
+	poHandler := purchaseorders.NewHandler(poSvc)
+
+	reorderRepo := reorder.NewRepository(config.DB)
+	reorderSvc := reorder.NewService(reorderRepo, poSvc)
+	reorderHandler := reorder.NewHandler(reorderSvc)
+
+	debitNoteRepo := debitnotes.NewRepository(config.DB)
+	debitNoteSvc := debitnotes.NewService(debitNoteRepo, medsRepo, batchesRepo, stockInSvc)
+	debitNoteHandler := debitnotes.NewHandler(debitNoteSvc)
+
+	transferRepo := transfers.NewRepository(config.DB)
+	transferSvc := transfers.NewService(transferRepo, medsRepo, batchesRepo)
+	transferHandler := transfers.NewHandler(transferSvc)
+
+	stockTakeRepo := stocktake.NewRepository(config.DB)
+	stockTakeSvc := stocktake.NewService(stockTakeRepo, batchesRepo)
+	stockTakeHandler := stocktake.NewHandler(stockTakeSvc)
+
+	expiryRepo := expiry.NewRepository(config.DB)
+	expirySvc := expiry.NewService(expiryRepo, batchesRepo, debitNoteSvc, stockOutSvc)
+	expiryHandler := expiry.NewHandler(expirySvc)
+	expirySvc.RegisterJobs(jobs) // Daily quarantine, near-expiry alerts and proposals
+
+	labelsRepo := labels.NewRepository(config.DB)
+	labelsSvc := labels.NewService(labelsRepo)
+	labelsHandler := labels.NewHandler(labelsSvc)
+
 	inventoryHandlers := routes.InventoryHandlers{
-		Meds:     medsHandler,
-		Batches:  batchesHandler,
-		Ledger:   ledgerHandler,
-		StockIn:  stockInHandler,
-		StockOut: stockOutHandler,
-		Res:      resHandler,
+		Meds:           medsHandler,
+		Batches:        batchesHandler,
+		Ledger:         ledgerHandler,
+		StockIn:        stockInHandler,
+		StockOut:       stockOutHandler,
+		Res:            resHandler,
+		PurchaseOrders: poHandler,
+		Reorder:        reorderHandler,
+		DebitNotes:     debitNoteHandler,
+		Transfers:      transferHandler,
+		StockTake:      stockTakeHandler,
+		Expiry:         expiryHandler,
+		Labels:         labelsHandler,
 	}
 
 	// Initialize Pharmacy Sales dependencies
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
-	}
-	inventoryBaseURL := "http://localhost:" + port + "/api/pharmacy/inventory"
+	safetyRepo := safety.NewRepository(config.DB)
+	safetySvc := safety.NewService(safetyRepo)
+	safetyHandler := safety.NewHandler(safetySvc)
+
+	complianceRepo := compliance.NewRepository(config.DB)
+	complianceSvc := compliance.NewService(complianceRepo)
+	complianceHandler := compliance.NewHandler(complianceSvc)
 
 	rxRepo := prescriptions.NewRepository(config.DB)
-	rxSvc := prescriptions.NewService(rxRepo)
+	rxSvc := prescriptions.NewService(rxRepo, safetySvc, prescriptions.NewLocalOCREngine()) // Swap in a hosted OCR engine behind the same interface
 	rxHandler := prescriptions.NewHandler(rxSvc)
 
+	gstRepo := gst.NewRepository(config.DB)
+	gstSvc := gst.NewService(gstRepo)
+	gstHandler := gst.NewHandler(gstSvc)
+
+	numberingRepo := numbering.NewRepository(config.DB)
+	numberingSvc := numbering.NewService(numberingRepo)
+	numberingHandler := numbering.NewHandler(numberingSvc)
+
+	loyaltyRepo := loyalty.NewRepository(config.DB)
+	loyaltySvc := loyalty.NewService(loyaltyRepo)
+	loyaltySvc.RegisterJobs(jobs) // Daily expiry of lapsed points
+	loyaltyHandler := loyalty.NewHandler(loyaltySvc)
+
+	promotionsRepo := promotions.NewRepository(config.DB)
+	promotionsSvc := promotions.NewService(promotionsRepo)
+	promotionsHandler := promotions.NewHandler(promotionsSvc)
+
 	salesRepo := sales.NewRepository(config.DB)
-	invClient := clients.NewInventoryClient(inventoryBaseURL)
+	// Sales talks to inventory in-process so checkout commits in one transaction;
+	// INVENTORY_SERVICE_URL switches to the HTTP client once inventory runs separately
+	invClient := clients.NewLocalInventoryClient(batchesSvc, resSvc)
+	if inventoryURL := os.Getenv("INVENTORY_SERVICE_URL"); inventoryURL != "" {
+		invClient = clients.NewInventoryClient(inventoryURL)
+	}
 	rxClient := clients.NewLocalPrescriptionClient(rxRepo)
-	salesSvc := sales.NewService(salesRepo, invClient, rxClient)
+	salesSvc := sales.NewService(salesRepo, invClient, rxClient, safetySvc, complianceSvc, gstSvc, loyaltySvc, promotionsSvc)
+	salesSvc.RegisterJobs(jobs) // Mark drafts whose stock holds lapsed as abandoned
 	salesHandler := sales.NewHandler(salesSvc)
 
+	// Refill reminders go out through the notification service; other channels register alongside SMS
+	notifService := notification.NewNotificationService()
+	refillsRepo := refills.NewRepository(config.DB)
+	refillsSvc := refills.NewService(refillsRepo, salesSvc, refills.NewSMSChannel(notifService))
+	refillsSvc.RegisterJobs(jobs) // Daily reminders, auto-drafts and adherence tracking
+	refillsHandler := refills.NewHandler(refillsSvc)
+
+	// Counters that lost connectivity upload their bills here; they are booked through the sales flow
+	offlineRepo := offline.NewRepository(config.DB)
+	offlineSvc := offline.NewService(offlineRepo, salesSvc, promotionsSvc)
+	offlineHandler := offline.NewHandler(offlineSvc)
+
 	salesHandlers := routes.SalesHandlers{
-		Sales: salesHandler,
-		Rx:    rxHandler,
+		Sales:      salesHandler,
+		Rx:         rxHandler,
+		Safety:     safetyHandler,
+		Compliance: complianceHandler,
+		GST:        gstHandler,
+		Refills:    refillsHandler,
+		Loyalty:    loyaltyHandler,
+		Promotions: promotionsHandler,
+		Offline:    offlineHandler,
+		Numbering:  numberingHandler,
 	}
 
 	// Initialize Pharmacy Supplier dependencies
@@ -107,21 +214,36 @@ func main() {
 	supService := supplier.NewSupplierService(supRepo)
 	supHandler := supplier.NewSupplierHandler(supService)
 
+	payablesRepo := payables.NewRepository(config.DB)
+	payablesSvc := payables.NewService(payablesRepo, stockInSvc)
+	payablesHandler := payables.NewHandler(payablesSvc)
+
 	supplierHandlersBundle := routes.SupplierHandlers{
 		Supplier: supHandler,
+		Payables: payablesHandler,
 	}
 
 	// Initialize Pharmacy Notification dependencies
-	notifService := notification.NewNotificationService()
 	notifHandler := notification.NewNotificationHandler(notifService)
 
 	notificationHandlersBundle := routes.NotificationHandlers{
 		Notification: notifHandler,
 	}
 
+	if os.Getenv("SCHEDULER_ENABLED") != "false" {
+		if err := jobs.Start(context.Background()); err != nil {
+			log.Printf("⚠️ Scheduler not started: %v", err)
+		}
+	}
+
 	api := r.Group("/api")
 	routes.OrganizationRoutes(api, patientHandler, inventoryHandlers, salesHandlers, supplierHandlersBundle, notificationHandlersBundle)
 
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8081"
+	}
+
 	srv := &http.Server{
 		Addr:    "0.0.0.0:" + port,
 		Handler: r,
@@ -149,5 +271,7 @@ func main() {
 		log.Fatal("Organization service forced to shutdown:", err)
 	}
 
+	jobs.Stop()
+
 	log.Println("Organization service exited")
 }
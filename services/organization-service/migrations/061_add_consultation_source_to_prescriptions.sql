@@ -0,0 +1,21 @@
+-- Migration 061: Link pharmacy prescriptions to doctor consultations
+-- E-prescriptions published by appointment-service when a consultation is finalized
+-- land in the same pharmacy queue as manually entered prescriptions.
+
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'MANUAL';
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS clinic_id UUID;
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS appointment_id UUID;
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS consultation_id UUID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_prescriptions_consultation_id
+ON sales_schema.prescriptions(consultation_id) WHERE consultation_id IS NOT NULL;
+
+ALTER TABLE sales_schema.prescription_items ADD COLUMN IF NOT EXISTS dosage VARCHAR(100);
+
+COMMENT ON COLUMN sales_schema.prescriptions.source IS 'MANUAL (entered at the pharmacy) or CONSULTATION (e-prescription from a doctor)';
+
+-- Prescriptions entered at the pharmacy and e-prescriptions published from
+-- consultations take their IDs from one sequence (RX-000001, ...) instead of
+-- the clock, so two saved in the same millisecond cannot collide. Earlier IDs
+-- carry a 13-digit timestamp and stay clear of the sequence's range.
+CREATE SEQUENCE IF NOT EXISTS sales_schema.prescription_number_seq;
@@ -0,0 +1,45 @@
+-- Migration 062: Drug interaction and allergy checks
+-- Reference datasets for the safety rule engine plus the columns that record
+-- warnings and override reasons on prescriptions and sale items.
+
+-- Generic-to-generic interaction pairs; generics are stored lowercase with generic_a < generic_b
+CREATE TABLE IF NOT EXISTS inventory.drug_interactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    generic_a VARCHAR(255) NOT NULL,
+    generic_b VARCHAR(255) NOT NULL,
+    severity VARCHAR(20) NOT NULL CHECK (severity IN ('MINOR', 'MODERATE', 'MAJOR')),
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT drug_interactions_pair_order CHECK (generic_a < generic_b),
+    CONSTRAINT drug_interactions_pair_unique UNIQUE (generic_a, generic_b)
+);
+
+CREATE INDEX IF NOT EXISTS idx_drug_interactions_generic_b ON inventory.drug_interactions(generic_b);
+
+-- Allergy classes mapped to the ingredients that trigger them (e.g. penicillin -> amoxicillin)
+CREATE TABLE IF NOT EXISTS inventory.allergen_ingredients (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    allergen VARCHAR(255) NOT NULL,
+    ingredient VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT allergen_ingredients_unique UNIQUE (allergen, ingredient)
+);
+
+CREATE INDEX IF NOT EXISTS idx_allergen_ingredients_ingredient ON inventory.allergen_ingredients(ingredient);
+
+ALTER TABLE sales_schema.patients ADD COLUMN IF NOT EXISTS allergies TEXT;
+
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS patient_allergies TEXT;
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS safety_warnings JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS override_reason TEXT;
+ALTER TABLE sales_schema.prescriptions ADD COLUMN IF NOT EXISTS override_by VARCHAR(255);
+
+ALTER TABLE sales_schema.sale_items ADD COLUMN IF NOT EXISTS safety_warnings JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE sales_schema.sale_items ADD COLUMN IF NOT EXISTS override_reason TEXT;
+ALTER TABLE sales_schema.sale_items ADD COLUMN IF NOT EXISTS override_by VARCHAR(255);
+
+COMMENT ON TABLE inventory.drug_interactions IS 'Importable generic-to-generic interaction dataset shared by all pharmacies';
+COMMENT ON TABLE inventory.allergen_ingredients IS 'Importable allergy-to-ingredient mappings shared by all pharmacies';
+COMMENT ON COLUMN sales_schema.prescriptions.override_reason IS 'Reason given to proceed despite MAJOR safety warnings';
+COMMENT ON COLUMN sales_schema.sale_items.override_reason IS 'Reason given to dispense despite MAJOR safety warnings';
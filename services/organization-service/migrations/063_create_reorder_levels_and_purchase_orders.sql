@@ -0,0 +1,50 @@
+-- Migration 063: Reorder levels and draft purchase orders
+-- Per-medicine reorder settings drive the suggested-reorder report; accepted
+-- suggestions become draft purchase orders that are received through stock-in.
+
+ALTER TABLE inventory.medicines ADD COLUMN IF NOT EXISTS reorder_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE inventory.medicines ADD COLUMN IF NOT EXISTS reorder_quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE inventory.medicines ADD COLUMN IF NOT EXISTS lead_time_days INTEGER NOT NULL DEFAULT 7;
+ALTER TABLE inventory.medicines ADD COLUMN IF NOT EXISTS safety_stock_days INTEGER NOT NULL DEFAULT 3;
+
+CREATE TABLE IF NOT EXISTS inventory.purchase_orders (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    supplier_id UUID NOT NULL,
+    po_number VARCHAR(50) NOT NULL,
+    status VARCHAR(30) NOT NULL DEFAULT 'DRAFT',
+    source VARCHAR(20) NOT NULL DEFAULT 'MANUAL',
+    expected_date DATE,
+    total_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    notes TEXT,
+    purchase_id UUID REFERENCES inventory.purchases(id),
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT purchase_orders_number_unique UNIQUE (pharmacy_id, po_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_pharmacy_status ON inventory.purchase_orders(pharmacy_id, status);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_supplier ON inventory.purchase_orders(supplier_id);
+
+CREATE TABLE IF NOT EXISTS inventory.purchase_order_items (
+    id UUID PRIMARY KEY,
+    purchase_order_id UUID NOT NULL REFERENCES inventory.purchase_orders(id) ON DELETE CASCADE,
+    medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    expected_unit_price NUMERIC(12, 4) NOT NULL DEFAULT 0,
+    received_qty INTEGER NOT NULL DEFAULT 0,
+    line_total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_order_items_po ON inventory.purchase_order_items(purchase_order_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_items_medicine ON inventory.purchase_order_items(medicine_id);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_pharmacy_type_created ON inventory.stock_ledger(pharmacy_id, transaction_type, created_at);
+
+COMMENT ON COLUMN inventory.medicines.reorder_level IS 'Minimum stock in base units; a floor for the forecast-based reorder point';
+COMMENT ON COLUMN inventory.medicines.reorder_quantity IS 'Minimum order quantity in base units';
+COMMENT ON COLUMN inventory.medicines.lead_time_days IS 'Days between ordering and receiving from the supplier';
+COMMENT ON COLUMN inventory.purchase_order_items.quantity IS 'Ordered quantity in base units (tablets, bottles, pieces)';
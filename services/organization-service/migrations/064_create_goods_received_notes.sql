@@ -0,0 +1,48 @@
+-- Migration 064: Purchase order lifecycle and goods-received notes
+-- Orders move DRAFT -> SENT -> PARTIALLY_RECEIVED -> CLOSED (or CANCELLED).
+-- Each delivery is a goods-received note (GRN) booked through stock-in, so one
+-- order can be fulfilled by several purchases.
+
+ALTER TABLE inventory.purchase_orders ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE inventory.purchase_orders ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE inventory.purchase_orders ADD COLUMN IF NOT EXISTS close_reason TEXT;
+
+-- Single-receipt orders from the first release are fully closed orders
+UPDATE inventory.purchase_orders SET status = 'CLOSED', closed_at = COALESCE(closed_at, updated_at)
+WHERE status = 'RECEIVED';
+
+CREATE TABLE IF NOT EXISTS inventory.goods_received_notes (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    purchase_order_id UUID NOT NULL REFERENCES inventory.purchase_orders(id) ON DELETE CASCADE,
+    purchase_id UUID NOT NULL REFERENCES inventory.purchases(id),
+    grn_number VARCHAR(50) NOT NULL,
+    received_by VARCHAR(255),
+    notes TEXT,
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT goods_received_notes_number_unique UNIQUE (pharmacy_id, grn_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_grn_purchase_order ON inventory.goods_received_notes(purchase_order_id);
+
+CREATE TABLE IF NOT EXISTS inventory.goods_received_note_items (
+    id UUID PRIMARY KEY,
+    grn_id UUID NOT NULL REFERENCES inventory.goods_received_notes(id) ON DELETE CASCADE,
+    purchase_order_item_id UUID NOT NULL REFERENCES inventory.purchase_order_items(id),
+    medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    received_qty INTEGER NOT NULL,
+    billed_qty INTEGER NOT NULL DEFAULT 0,
+    unit_cost NUMERIC(12, 4) NOT NULL DEFAULT 0,
+    line_total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_grn_items_grn ON inventory.goods_received_note_items(grn_id);
+CREATE INDEX IF NOT EXISTS idx_grn_items_po_item ON inventory.goods_received_note_items(purchase_order_item_id);
+
+COMMENT ON COLUMN inventory.goods_received_note_items.received_qty IS 'Base units booked into stock, including bonus units';
+COMMENT ON COLUMN inventory.goods_received_note_items.billed_qty IS 'Base units charged on the supplier invoice (excludes bonus units)';
+COMMENT ON COLUMN inventory.goods_received_note_items.unit_cost IS 'Invoice cost per billed base unit';
+COMMENT ON COLUMN inventory.purchase_orders.purchase_id IS 'Deprecated: receipts are tracked per goods-received note';
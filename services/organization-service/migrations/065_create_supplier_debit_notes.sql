@@ -0,0 +1,69 @@
+-- Migration 065: Return-to-supplier debit notes
+-- Expired, near-expiry or damaged batches go back to the supplier on a debit
+-- note (stock leaves as PURCHASE_RETURN). Credit the supplier gives against the
+-- note is either set off against outstanding purchase invoices or refunded.
+
+CREATE TABLE IF NOT EXISTS inventory.debit_notes (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    supplier_id UUID NOT NULL REFERENCES supplier_schema.suppliers(id),
+    debit_note_no VARCHAR(50) NOT NULL,
+    status VARCHAR(30) NOT NULL DEFAULT 'ISSUED', -- ISSUED, PARTIALLY_SETTLED, SETTLED
+    reason TEXT,
+    total_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    credited_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    notes TEXT,
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT debit_notes_number_unique UNIQUE (pharmacy_id, debit_note_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_debit_notes_pharmacy_supplier ON inventory.debit_notes(pharmacy_id, supplier_id);
+
+CREATE TABLE IF NOT EXISTS inventory.debit_note_items (
+    id UUID PRIMARY KEY,
+    debit_note_id UUID NOT NULL REFERENCES inventory.debit_notes(id) ON DELETE CASCADE,
+    medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    batch_id UUID NOT NULL REFERENCES inventory.batches(id),
+    batch_no VARCHAR(100),
+    expiry_date DATE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_cost NUMERIC(12, 4) NOT NULL DEFAULT 0,
+    amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    return_reason VARCHAR(20) NOT NULL, -- EXPIRED, NEAR_EXPIRY, DAMAGED, OTHER
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_debit_note_items_note ON inventory.debit_note_items(debit_note_id);
+
+CREATE TABLE IF NOT EXISTS inventory.debit_note_credits (
+    id UUID PRIMARY KEY,
+    debit_note_id UUID NOT NULL REFERENCES inventory.debit_notes(id) ON DELETE CASCADE,
+    pharmacy_id UUID NOT NULL,
+    supplier_credit_note_no VARCHAR(100),
+    mode VARCHAR(20) NOT NULL, -- ADJUST (set off against purchases), REFUND
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_debit_note_credits_note ON inventory.debit_note_credits(debit_note_id);
+
+CREATE TABLE IF NOT EXISTS inventory.debit_note_allocations (
+    id UUID PRIMARY KEY,
+    credit_id UUID NOT NULL REFERENCES inventory.debit_note_credits(id) ON DELETE CASCADE,
+    purchase_id UUID NOT NULL REFERENCES inventory.purchases(id),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_debit_note_allocations_purchase ON inventory.debit_note_allocations(purchase_id);
+
+-- Supplier history shows documents as well as profile edits
+ALTER TABLE supplier_schema.supplier_audit_logs ALTER COLUMN action_type TYPE VARCHAR(30);
+ALTER TABLE supplier_schema.supplier_audit_logs ADD COLUMN IF NOT EXISTS reference_type VARCHAR(50);
+ALTER TABLE supplier_schema.supplier_audit_logs ADD COLUMN IF NOT EXISTS reference_id UUID;
+ALTER TABLE supplier_schema.supplier_audit_logs ADD COLUMN IF NOT EXISTS notes TEXT;
@@ -0,0 +1,46 @@
+-- Migration 066: Supplier accounts payable
+-- Opening balances carried over from before the system, and payment vouchers
+-- that settle one or more purchase invoices in a single payment. Invoice-level
+-- paid amounts stay on inventory.purchases; allocations record which voucher
+-- paid what.
+
+CREATE TABLE IF NOT EXISTS supplier_schema.supplier_opening_balances (
+    pharmacy_id UUID NOT NULL,
+    supplier_id UUID NOT NULL REFERENCES supplier_schema.suppliers(id) ON DELETE CASCADE,
+    amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    as_of_date DATE NOT NULL,
+    notes TEXT,
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (pharmacy_id, supplier_id)
+);
+
+CREATE TABLE IF NOT EXISTS supplier_schema.payment_vouchers (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    supplier_id UUID NOT NULL REFERENCES supplier_schema.suppliers(id),
+    voucher_no VARCHAR(50) NOT NULL,
+    payment_date DATE NOT NULL,
+    amount NUMERIC(15, 2) NOT NULL CHECK (amount > 0),
+    payment_mode VARCHAR(20) NOT NULL, -- CASH, BANK_TRANSFER, CHEQUE, UPI
+    reference_no VARCHAR(100),
+    notes TEXT,
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT payment_vouchers_number_unique UNIQUE (pharmacy_id, voucher_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_vouchers_pharmacy_supplier ON supplier_schema.payment_vouchers(pharmacy_id, supplier_id);
+
+CREATE TABLE IF NOT EXISTS supplier_schema.payment_voucher_allocations (
+    id UUID PRIMARY KEY,
+    voucher_id UUID NOT NULL REFERENCES supplier_schema.payment_vouchers(id) ON DELETE CASCADE,
+    purchase_id UUID NOT NULL REFERENCES inventory.purchases(id),
+    amount NUMERIC(15, 2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_voucher_allocations_voucher ON supplier_schema.payment_voucher_allocations(voucher_id);
+CREATE INDEX IF NOT EXISTS idx_payment_voucher_allocations_purchase ON supplier_schema.payment_voucher_allocations(purchase_id);
@@ -0,0 +1,69 @@
+-- Migration 067: Inter-pharmacy stock transfers
+-- Stock leaves the source batch on dispatch (TRANSFER_OUT), sits in transit, and
+-- lands at the destination on receipt (TRANSFER_IN) under the same batch
+-- number, expiry and cost. Shortages and damage found on receipt are recorded
+-- per line and resolved by the source pharmacy.
+
+CREATE TABLE IF NOT EXISTS inventory.stock_transfers (
+    id UUID PRIMARY KEY,
+    transfer_no VARCHAR(50) NOT NULL,
+    source_pharmacy_id UUID NOT NULL REFERENCES public.pharmacies(id),
+    destination_pharmacy_id UUID NOT NULL REFERENCES public.pharmacies(id),
+    status VARCHAR(30) NOT NULL DEFAULT 'IN_TRANSIT', -- IN_TRANSIT, RECEIVED, RECEIVED_WITH_DISCREPANCY, DISCREPANCY_RESOLVED, CANCELLED
+    notes TEXT,
+    total_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    received_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    discrepancy_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    dispatched_by UUID,
+    dispatched_by_name VARCHAR(255),
+    dispatched_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    received_by UUID,
+    received_by_name VARCHAR(255),
+    received_at TIMESTAMP WITH TIME ZONE,
+    receive_notes TEXT,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    cancel_reason TEXT,
+    resolution VARCHAR(30), -- WRITE_OFF, RETURN_TO_SOURCE
+    resolution_notes TEXT,
+    resolved_by UUID,
+    resolved_by_name VARCHAR(255),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT stock_transfers_number_unique UNIQUE (source_pharmacy_id, transfer_no),
+    CONSTRAINT stock_transfers_distinct_pharmacies CHECK (source_pharmacy_id <> destination_pharmacy_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_transfers_source ON inventory.stock_transfers(source_pharmacy_id, status);
+CREATE INDEX IF NOT EXISTS idx_stock_transfers_destination ON inventory.stock_transfers(destination_pharmacy_id, status);
+
+CREATE TABLE IF NOT EXISTS inventory.stock_transfer_items (
+    id UUID PRIMARY KEY,
+    transfer_id UUID NOT NULL REFERENCES inventory.stock_transfers(id) ON DELETE CASCADE,
+    source_medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    source_batch_id UUID NOT NULL REFERENCES inventory.batches(id),
+    medicine_name VARCHAR(255) NOT NULL,
+    batch_no VARCHAR(100) NOT NULL,
+    mfg_date DATE,
+    expiry_date DATE NOT NULL,
+    dispatched_qty INTEGER NOT NULL CHECK (dispatched_qty > 0),
+    unit_cost NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    mrp NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    unit_price NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    cgst_rate NUMERIC(5, 2) DEFAULT 0,
+    sgst_rate NUMERIC(5, 2) DEFAULT 0,
+    total_tax_percentage NUMERIC(5, 2) DEFAULT 0,
+    retail_disc_perc NUMERIC(5, 2) DEFAULT 0,
+    staff_disc_perc NUMERIC(5, 2) DEFAULT 0,
+    special_disc_perc NUMERIC(5, 2) DEFAULT 0,
+    max_disc_perc NUMERIC(5, 2) DEFAULT 0,
+    supplier_id UUID,
+    destination_medicine_id UUID REFERENCES inventory.medicines(id),
+    destination_batch_id UUID REFERENCES inventory.batches(id),
+    received_qty INTEGER NOT NULL DEFAULT 0,
+    damaged_qty INTEGER NOT NULL DEFAULT 0,
+    remarks TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_transfer_items_transfer ON inventory.stock_transfer_items(transfer_id);
@@ -0,0 +1,75 @@
+-- Migration 068: Physical stock-take (cycle count) sessions
+-- A session snapshots the system quantity of every in-scope batch when it is
+-- started. Counters record what is on the shelf (by rack/category, optionally
+-- by barcode scan); variances against the snapshot are reviewed and approved
+-- lines are posted to the stock ledger as ADJUSTMENT movements. Batches in an
+-- open session cannot be reserved or sold until it is posted or cancelled.
+
+CREATE TABLE IF NOT EXISTS inventory.stock_take_sessions (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL REFERENCES public.pharmacies(id),
+    session_no VARCHAR(50) NOT NULL,
+    name VARCHAR(255),
+    scope VARCHAR(20) NOT NULL DEFAULT 'ALL', -- ALL, RACK, CATEGORY
+    scope_values TEXT[] NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'IN_PROGRESS', -- IN_PROGRESS, UNDER_REVIEW, POSTED, CANCELLED
+    notes TEXT,
+    started_by UUID,
+    started_by_name VARCHAR(255),
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    posted_by UUID,
+    posted_by_name VARCHAR(255),
+    posted_at TIMESTAMP WITH TIME ZONE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    cancel_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT stock_take_sessions_number_unique UNIQUE (pharmacy_id, session_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_take_sessions_pharmacy ON inventory.stock_take_sessions(pharmacy_id, status);
+
+CREATE TABLE IF NOT EXISTS inventory.stock_take_items (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES inventory.stock_take_sessions(id) ON DELETE CASCADE,
+    pharmacy_id UUID NOT NULL REFERENCES public.pharmacies(id),
+    medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    batch_id UUID NOT NULL REFERENCES inventory.batches(id),
+    medicine_name VARCHAR(255) NOT NULL,
+    category VARCHAR(100),
+    barcode VARCHAR(100),
+    batch_no VARCHAR(100) NOT NULL,
+    rack_no VARCHAR(50),
+    expiry_date DATE,
+    unit_cost NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    mrp NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    system_qty INTEGER NOT NULL,
+    counted_qty INTEGER CHECK (counted_qty IS NULL OR counted_qty >= 0),
+    last_counted_by UUID,
+    last_counted_by_name VARCHAR(255),
+    last_counted_at TIMESTAMP WITH TIME ZONE,
+    review_status VARCHAR(20) NOT NULL DEFAULT 'PENDING', -- PENDING, APPROVED, REJECTED
+    review_reason TEXT,
+    posted_qty INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT stock_take_items_batch_unique UNIQUE (session_id, batch_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_take_items_session ON inventory.stock_take_items(session_id);
+CREATE INDEX IF NOT EXISTS idx_stock_take_items_batch ON inventory.stock_take_items(pharmacy_id, batch_id);
+
+-- Every count or scan is kept so concurrent counters can be audited
+CREATE TABLE IF NOT EXISTS inventory.stock_take_counts (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES inventory.stock_take_sessions(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES inventory.stock_take_items(id) ON DELETE CASCADE,
+    mode VARCHAR(10) NOT NULL, -- SET, ADD
+    quantity INTEGER NOT NULL,
+    counted_qty_after INTEGER NOT NULL,
+    source VARCHAR(10) NOT NULL DEFAULT 'MANUAL', -- MANUAL, SCAN
+    counted_by UUID,
+    counted_by_name VARCHAR(255),
+    counted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_take_counts_item ON inventory.stock_take_counts(item_id, counted_at);
@@ -0,0 +1,107 @@
+-- Migration 069: Expiry management
+-- A daily worker quarantines expired batches that still hold stock, raises
+-- near-expiry alerts at per-pharmacy horizons and drafts return-to-supplier or
+-- write-off proposals for a pharmacist to approve. Approval issues a debit note
+-- (supplier return) or an EXPIRED stock-out (write-off).
+
+ALTER TABLE inventory.batches ADD COLUMN IF NOT EXISTS quarantined_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE inventory.batches ADD COLUMN IF NOT EXISTS quarantine_reason VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_batches_quarantined ON inventory.batches(pharmacy_id) WHERE quarantined_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS inventory.expiry_settings (
+    pharmacy_id UUID PRIMARY KEY REFERENCES public.pharmacies(id),
+    alert_horizons INTEGER[] NOT NULL DEFAULT '{90,60,30}',
+    auto_quarantine BOOLEAN NOT NULL DEFAULT true,
+    draft_proposals BOOLEAN NOT NULL DEFAULT true,
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS inventory.expiry_alerts (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL REFERENCES public.pharmacies(id),
+    batch_id UUID NOT NULL REFERENCES inventory.batches(id) ON DELETE CASCADE,
+    medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    medicine_name VARCHAR(255) NOT NULL,
+    batch_no VARCHAR(100) NOT NULL,
+    expiry_date DATE NOT NULL,
+    horizon_days INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    stock_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'OPEN', -- OPEN, ACKNOWLEDGED
+    acknowledged_by UUID,
+    acknowledged_by_name VARCHAR(255),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT expiry_alerts_batch_horizon_unique UNIQUE (batch_id, horizon_days)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expiry_alerts_pharmacy ON inventory.expiry_alerts(pharmacy_id, status, expiry_date);
+
+CREATE TABLE IF NOT EXISTS inventory.expiry_proposals (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL REFERENCES public.pharmacies(id),
+    proposal_no VARCHAR(50) NOT NULL,
+    action VARCHAR(30) NOT NULL, -- RETURN_TO_SUPPLIER, WRITE_OFF
+    supplier_id UUID,
+    status VARCHAR(20) NOT NULL DEFAULT 'DRAFT', -- DRAFT, APPROVED, REJECTED
+    total_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    document_type VARCHAR(20), -- DEBIT_NOTE, STOCK_OUT
+    document_id UUID,
+    notes TEXT,
+    reviewed_by UUID,
+    reviewed_by_name VARCHAR(255),
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT expiry_proposals_number_unique UNIQUE (pharmacy_id, proposal_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expiry_proposals_pharmacy ON inventory.expiry_proposals(pharmacy_id, status);
+
+CREATE TABLE IF NOT EXISTS inventory.expiry_proposal_items (
+    id UUID PRIMARY KEY,
+    proposal_id UUID NOT NULL REFERENCES inventory.expiry_proposals(id) ON DELETE CASCADE,
+    batch_id UUID NOT NULL REFERENCES inventory.batches(id),
+    medicine_id UUID NOT NULL REFERENCES inventory.medicines(id),
+    medicine_name VARCHAR(255) NOT NULL,
+    unit_type VARCHAR(50),
+    batch_no VARCHAR(100) NOT NULL,
+    expiry_date DATE NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_cost NUMERIC(15, 2) NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_expiry_proposal_items_batch ON inventory.expiry_proposal_items(batch_id);
+
+-- The worker runs through the shared job scheduler, which keeps job state and
+-- run history in these tables. Appointment-service creates the same tables in
+-- its own migration 035; whichever runs first creates them.
+CREATE TABLE IF NOT EXISTS public.scheduled_jobs (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT,
+    schedule VARCHAR(100) NOT NULL,
+    is_paused BOOLEAN NOT NULL DEFAULT false,
+    last_run_at TIMESTAMPTZ,
+    last_status VARCHAR(20),
+    next_run_at TIMESTAMPTZ,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS public.scheduled_job_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL REFERENCES public.scheduled_jobs(name) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    instance_id VARCHAR(255) NOT NULL,
+    affected_rows BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_job_runs_job_started
+ON public.scheduled_job_runs(job_name, started_at DESC);
@@ -0,0 +1,75 @@
+-- Migration 070: Controlled drug dispensing compliance
+-- Prescriber details captured against a sale, pharmacist sign-offs for
+-- Schedule X dispensing and the Schedule H1/X register. Register rows are
+-- append-only: returns are recorded as RETURN entries, never by editing.
+
+CREATE TABLE IF NOT EXISTS sales_schema.sale_prescribers (
+    sale_id UUID PRIMARY KEY REFERENCES sales_schema.sales(id) ON DELETE CASCADE,
+    pharmacy_id UUID NOT NULL,
+    prescription_ref VARCHAR(100) NOT NULL,
+    prescriber_name VARCHAR(255) NOT NULL,
+    prescriber_reg_no VARCHAR(100) NOT NULL,
+    prescriber_address TEXT,
+    prescription_date DATE,
+    patient_address TEXT,
+    recorded_by UUID,
+    recorded_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sales_schema.sale_signoffs (
+    id UUID PRIMARY KEY,
+    sale_id UUID NOT NULL REFERENCES sales_schema.sales(id) ON DELETE CASCADE,
+    pharmacy_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    user_name VARCHAR(255),
+    signed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT sale_signoffs_user_unique UNIQUE (sale_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS sales_schema.controlled_drug_register (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    schedule_type VARCHAR(10) NOT NULL, -- H1, X
+    serial_no INTEGER NOT NULL,
+    entry_type VARCHAR(20) NOT NULL, -- DISPENSE, RETURN
+    entry_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    sale_id UUID NOT NULL REFERENCES sales_schema.sales(id),
+    document_no VARCHAR(100) NOT NULL, -- invoice or return number
+    medicine_id UUID NOT NULL,
+    medicine_name VARCHAR(255) NOT NULL,
+    medicine_brand VARCHAR(255),
+    batch_id UUID NOT NULL,
+    batch_no VARCHAR(100),
+    expiry_date DATE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    patient_id UUID,
+    patient_name VARCHAR(255) NOT NULL,
+    patient_phone VARCHAR(50),
+    patient_address TEXT,
+    prescriber_name VARCHAR(255) NOT NULL,
+    prescriber_reg_no VARCHAR(100) NOT NULL,
+    prescriber_address TEXT,
+    prescription_ref VARCHAR(100) NOT NULL,
+    prescription_date DATE,
+    dispensed_by UUID,
+    dispensed_by_name VARCHAR(255),
+    signed_off_by TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT controlled_drug_register_serial_unique UNIQUE (pharmacy_id, schedule_type, serial_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_controlled_drug_register_date ON sales_schema.controlled_drug_register(pharmacy_id, schedule_type, entry_date);
+CREATE INDEX IF NOT EXISTS idx_controlled_drug_register_sale ON sales_schema.controlled_drug_register(sale_id);
+
+CREATE OR REPLACE FUNCTION sales_schema.controlled_drug_register_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'controlled drug register entries cannot be modified or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_controlled_drug_register_immutable ON sales_schema.controlled_drug_register;
+CREATE TRIGGER trg_controlled_drug_register_immutable
+    BEFORE UPDATE OR DELETE ON sales_schema.controlled_drug_register
+    FOR EACH ROW EXECUTE FUNCTION sales_schema.controlled_drug_register_immutable();
@@ -0,0 +1,79 @@
+-- Migration 071: GST tax invoices and credit notes
+-- Each completed sale gets a tax invoice snapshot (HSN, taxable value and the
+-- CGST/SGST or IGST split for its place of supply); each sales return gets a
+-- credit note against that invoice. Period returns are built from these rows
+-- (outward supplies) and from purchases and debit notes (inward supplies).
+-- A tax invoice is dated with the day its sale completed, which sales now record.
+
+CREATE TABLE IF NOT EXISTS sales_schema.gst_profiles (
+    pharmacy_id UUID PRIMARY KEY,
+    gstin VARCHAR(15) NOT NULL,
+    legal_name VARCHAR(255) NOT NULL,
+    trade_name VARCHAR(255),
+    state_code VARCHAR(2) NOT NULL,
+    address TEXT,
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE sales_schema.sales ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+
+-- Sales completed before this column existed were settled when their first payment was taken
+UPDATE sales_schema.sales s
+SET completed_at = COALESCE(
+    (SELECT MIN(p.created_at) FROM sales_schema.payments p WHERE p.sale_id = s.id AND p.transaction_type = 'PAYMENT'),
+    s.created_at
+)
+WHERE s.status IN ('COMPLETED', 'DISPATCHED') AND s.completed_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS sales_schema.tax_documents (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    document_type VARCHAR(20) NOT NULL, -- INVOICE, CREDIT_NOTE
+    document_no VARCHAR(50) NOT NULL,
+    document_date DATE NOT NULL,
+    sale_id UUID NOT NULL REFERENCES sales_schema.sales(id),
+    return_id UUID REFERENCES sales_schema.sales_returns(id),
+    original_document_no VARCHAR(50),
+    original_document_date DATE,
+    seller_gstin VARCHAR(15),
+    seller_name VARCHAR(255),
+    seller_address TEXT,
+    seller_state_code VARCHAR(2),
+    buyer_name VARCHAR(255),
+    buyer_gstin VARCHAR(15),
+    place_of_supply VARCHAR(2),
+    supply_type VARCHAR(10) NOT NULL DEFAULT 'INTRA', -- INTRA, INTER
+    taxable_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    cgst_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    sgst_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    igst_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    total_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT tax_documents_number_unique UNIQUE (pharmacy_id, document_type, document_no)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tax_documents_sale_invoice ON sales_schema.tax_documents(sale_id) WHERE document_type = 'INVOICE';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tax_documents_return ON sales_schema.tax_documents(return_id) WHERE return_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_tax_documents_period ON sales_schema.tax_documents(pharmacy_id, document_date);
+
+CREATE TABLE IF NOT EXISTS sales_schema.tax_document_lines (
+    id UUID PRIMARY KEY,
+    document_id UUID NOT NULL REFERENCES sales_schema.tax_documents(id) ON DELETE CASCADE,
+    line_no INTEGER NOT NULL,
+    medicine_id UUID NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    hsn_code VARCHAR(20),
+    uqc VARCHAR(10) NOT NULL DEFAULT 'NOS',
+    batch_no VARCHAR(100),
+    quantity INTEGER NOT NULL,
+    gst_rate NUMERIC(5, 2) NOT NULL DEFAULT 0,
+    taxable_value NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    cgst_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    sgst_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    igst_amount NUMERIC(15, 2) NOT NULL DEFAULT 0,
+    total_value NUMERIC(15, 2) NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_tax_document_lines_document ON sales_schema.tax_document_lines(document_id);
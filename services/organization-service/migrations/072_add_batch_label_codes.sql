@@ -0,0 +1,8 @@
+-- Migration 072: Internal barcodes for batches
+-- Stock often arrives without a usable manufacturer barcode, so each batch gets
+-- a short internal code (PB + 10 hex digits) printed on shelf/pack labels.
+-- Codes are assigned the first time a label is printed and never change.
+
+ALTER TABLE inventory.batches ADD COLUMN IF NOT EXISTS label_code VARCHAR(20);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_batches_label_code ON inventory.batches(pharmacy_id, label_code) WHERE label_code IS NOT NULL;
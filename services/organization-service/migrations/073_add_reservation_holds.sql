@@ -0,0 +1,20 @@
+-- Migration 073: Reservation hold time and abandoned POS drafts
+-- Stock held for a draft sale lapses after the pharmacy's hold time unless
+-- the bill is touched; lapsed holds are marked EXPIRED and drafts left with
+-- no live holds become ABANDONED until a cashier resumes or discards them.
+
+CREATE TABLE IF NOT EXISTS inventory.reservation_settings (
+    pharmacy_id UUID PRIMARY KEY,
+    hold_minutes INTEGER NOT NULL DEFAULT 60,
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservations_pending_expiry
+    ON inventory.reservations(expires_at)
+    WHERE status = 'PENDING';
+
+CREATE INDEX IF NOT EXISTS idx_sales_open_drafts
+    ON sales_schema.sales(pharmacy_id, updated_at)
+    WHERE status IN ('DRAFT', 'PENDING', 'ABANDONED');
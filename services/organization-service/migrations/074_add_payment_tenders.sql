@@ -0,0 +1,12 @@
+-- Migration 074: Split / multi-tender sale payments
+-- A sale can now be settled by several payment rows (cash, UPI, card, and
+-- CREDIT for the part put on the patient's account). Each row keeps its
+-- reference (UPI transaction id, card last 4); cash rows also keep what was
+-- handed over and the change returned.
+
+ALTER TABLE sales_schema.payments ADD COLUMN IF NOT EXISTS reference VARCHAR(100);
+ALTER TABLE sales_schema.payments ADD COLUMN IF NOT EXISTS tendered_amount DECIMAL(15, 2);
+ALTER TABLE sales_schema.payments ADD COLUMN IF NOT EXISTS change_amount DECIMAL(15, 2) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_payments_sale ON sales_schema.payments(sale_id);
+CREATE INDEX IF NOT EXISTS idx_payments_created ON sales_schema.payments(created_at);
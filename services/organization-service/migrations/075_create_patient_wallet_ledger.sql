@@ -0,0 +1,53 @@
+-- Migration 075: Patient wallet ledger
+-- Every change to a pharmacy customer's balance is an append-only ledger line:
+-- dues left on bills, dues settled on later bills or collected at the counter,
+-- store credit from overpayments and returns, and manual adjustments with a
+-- reason. Debit increases what the patient owes, credit reduces it; the
+-- due_amount/credit_amount columns on patients are kept as the derived balance.
+
+ALTER TABLE sales_schema.patients ADD COLUMN IF NOT EXISTS credit_limit numeric(10,2);
+
+CREATE TABLE IF NOT EXISTS sales_schema.patient_wallet_entries (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    patient_id UUID NOT NULL REFERENCES sales_schema.patients(id),
+    entry_type VARCHAR(30) NOT NULL,
+    debit DECIMAL(15, 2) NOT NULL DEFAULT 0 CHECK (debit >= 0),
+    credit DECIMAL(15, 2) NOT NULL DEFAULT 0 CHECK (credit >= 0),
+    sale_id UUID,
+    return_id UUID,
+    reference_no VARCHAR(50),
+    payment_mode VARCHAR(20),
+    payment_reference VARCHAR(100),
+    reason TEXT,
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_patient_wallet_patient ON sales_schema.patient_wallet_entries(pharmacy_id, patient_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_patient_wallet_receipts ON sales_schema.patient_wallet_entries(pharmacy_id, created_at) WHERE entry_type = 'DUE_PAYMENT';
+
+CREATE OR REPLACE FUNCTION sales_schema.patient_wallet_entries_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'patient wallet entries cannot be modified or deleted; post an adjustment instead';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_patient_wallet_entries_immutable ON sales_schema.patient_wallet_entries;
+CREATE TRIGGER trg_patient_wallet_entries_immutable
+    BEFORE UPDATE OR DELETE ON sales_schema.patient_wallet_entries
+    FOR EACH ROW EXECUTE FUNCTION sales_schema.patient_wallet_entries_immutable();
+
+-- Carry existing scalar balances into the ledger as opening balances
+INSERT INTO sales_schema.patient_wallet_entries (id, pharmacy_id, patient_id, entry_type, debit, credit, reason, created_at)
+SELECT gen_random_uuid(), p.pharmacy_id, p.id, 'OPENING_BALANCE',
+       GREATEST(p.due_amount - p.credit_amount, 0), GREATEST(p.credit_amount - p.due_amount, 0),
+       'Balance carried over from patient wallet', CURRENT_TIMESTAMP
+FROM sales_schema.patients p
+WHERE (p.due_amount <> 0 OR p.credit_amount <> 0)
+  AND NOT EXISTS (SELECT 1 FROM sales_schema.patient_wallet_entries e WHERE e.patient_id = p.id);
+
+UPDATE sales_schema.patients
+SET due_amount = GREATEST(due_amount - credit_amount, 0), credit_amount = GREATEST(credit_amount - due_amount, 0)
+WHERE due_amount > 0 AND credit_amount > 0;
@@ -0,0 +1,42 @@
+-- Migration 076: Refill reminders for recurring pharmacy patients
+-- A daily job reminds patients a few days before a recurring sale's
+-- next_refill_date, optionally pre-creates a draft bill with the same items,
+-- and follows each reminder to CONVERTED (the patient bought the medicines
+-- again) or MISSED (nothing within the grace period) for adherence reporting.
+
+CREATE TABLE IF NOT EXISTS sales_schema.refill_settings (
+    pharmacy_id UUID PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    days_before INT NOT NULL DEFAULT 3 CHECK (days_before BETWEEN 0 AND 30),
+    channel VARCHAR(30) NOT NULL DEFAULT 'SMS',
+    auto_draft BOOLEAN NOT NULL DEFAULT FALSE,
+    grace_days INT NOT NULL DEFAULT 7 CHECK (grace_days BETWEEN 0 AND 60),
+    message_template TEXT,
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sales_schema.refill_reminders (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    sale_id UUID NOT NULL UNIQUE REFERENCES sales_schema.sales(id),
+    patient_id UUID NOT NULL REFERENCES sales_schema.patients(id),
+    refill_date DATE NOT NULL,
+    channel VARCHAR(30) NOT NULL,
+    notify_status VARCHAR(20) NOT NULL DEFAULT 'QUEUED',
+    notify_error TEXT,
+    notified_at TIMESTAMP WITH TIME ZONE,
+    draft_sale_id UUID REFERENCES sales_schema.sales(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    converted_sale_id UUID REFERENCES sales_schema.sales(id),
+    converted_at TIMESTAMP WITH TIME ZONE,
+    days_late INT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refill_reminders_pharmacy ON sales_schema.refill_reminders(pharmacy_id, refill_date);
+CREATE INDEX IF NOT EXISTS idx_refill_reminders_pending ON sales_schema.refill_reminders(pharmacy_id) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_refill_reminders_patient ON sales_schema.refill_reminders(patient_id);
+CREATE INDEX IF NOT EXISTS idx_sales_next_refill ON sales_schema.sales(pharmacy_id, next_refill_date) WHERE is_recurring = TRUE;
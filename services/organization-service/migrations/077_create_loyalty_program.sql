@@ -0,0 +1,64 @@
+-- Migration 077: Pharmacy loyalty program
+-- Patients earn points on finalized sales and spend them as a LOYALTY tender
+-- at checkout. Points are an append-only ledger per patient (earned, redeemed,
+-- reversed on returns, expired, adjusted). Tiers are set per pharmacy by spend
+-- over the last 12 months and pick which batch discount column the counter
+-- applies by default.
+
+CREATE TABLE IF NOT EXISTS sales_schema.loyalty_settings (
+    pharmacy_id UUID PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    points_per_100 DECIMAL(10, 2) NOT NULL DEFAULT 1 CHECK (points_per_100 >= 0),
+    point_value DECIMAL(10, 2) NOT NULL DEFAULT 1 CHECK (point_value > 0),
+    min_redeem_points INT NOT NULL DEFAULT 0 CHECK (min_redeem_points >= 0),
+    max_redeem_percent INT NOT NULL DEFAULT 100 CHECK (max_redeem_percent BETWEEN 1 AND 100),
+    expiry_months INT NOT NULL DEFAULT 12 CHECK (expiry_months BETWEEN 0 AND 60),
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sales_schema.loyalty_tiers (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    min_spend DECIMAL(15, 2) NOT NULL DEFAULT 0 CHECK (min_spend >= 0),
+    discount_column VARCHAR(20) NOT NULL DEFAULT 'RETAIL' CHECK (discount_column IN ('RETAIL', 'SPECIAL', 'STAFF')),
+    earn_multiplier DECIMAL(5, 2) NOT NULL DEFAULT 1 CHECK (earn_multiplier >= 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (pharmacy_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_tiers_pharmacy ON sales_schema.loyalty_tiers(pharmacy_id, min_spend);
+
+CREATE TABLE IF NOT EXISTS sales_schema.loyalty_points_entries (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    patient_id UUID NOT NULL REFERENCES sales_schema.patients(id),
+    entry_type VARCHAR(20) NOT NULL, -- EARN, REDEEM, REVERSE, EXPIRE, ADJUST
+    points INT NOT NULL CHECK (points <> 0),
+    base_amount DECIMAL(15, 2) NOT NULL DEFAULT 0, -- Bill amount points were earned on, or rupee value redeemed
+    sale_id UUID REFERENCES sales_schema.sales(id),
+    return_id UUID,
+    reference_no VARCHAR(50),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    reason TEXT,
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_points_patient ON sales_schema.loyalty_points_entries(pharmacy_id, patient_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_loyalty_points_sale ON sales_schema.loyalty_points_entries(sale_id) WHERE sale_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_loyalty_points_expiry ON sales_schema.loyalty_points_entries(pharmacy_id, expires_at) WHERE points > 0 AND expires_at IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION sales_schema.loyalty_points_entries_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'loyalty points entries cannot be modified or deleted; post an adjustment instead';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_loyalty_points_entries_immutable ON sales_schema.loyalty_points_entries;
+CREATE TRIGGER trg_loyalty_points_entries_immutable
+    BEFORE UPDATE OR DELETE ON sales_schema.loyalty_points_entries
+    FOR EACH ROW EXECUTE FUNCTION sales_schema.loyalty_points_entries_immutable();
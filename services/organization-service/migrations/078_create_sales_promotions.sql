@@ -0,0 +1,52 @@
+-- Migration 078: Promotions for pharmacy sales
+-- Rule-based schemes evaluated whenever a bill's items change: free quantity
+-- (buy X get Y, with the free units reserved from stock like any line),
+-- bundle pricing and category discounts, each within optional date, weekday
+-- and time-of-day windows. Discounts stay within the batch max_disc_perc.
+-- The promotions applied to a bill are itemised in sale_promotions.
+
+CREATE TABLE IF NOT EXISTS sales_schema.promotions (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    promo_type VARCHAR(30) NOT NULL CHECK (promo_type IN ('FREE_QTY', 'BUNDLE', 'CATEGORY_DISCOUNT')),
+    product_ids UUID[] NOT NULL DEFAULT '{}',
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    buy_qty INT NOT NULL DEFAULT 0,
+    free_qty INT NOT NULL DEFAULT 0,
+    bundle_items JSONB NOT NULL DEFAULT '[]',
+    bundle_price DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    discount_percent DECIMAL(5, 2) NOT NULL DEFAULT 0 CHECK (discount_percent BETWEEN 0 AND 100),
+    valid_from DATE,
+    valid_to DATE,
+    days_of_week INT[] NOT NULL DEFAULT '{}', -- 0 = Sunday; empty for every day
+    start_time VARCHAR(5), -- HH:MM, IST
+    end_time VARCHAR(5),
+    priority INT NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID,
+    created_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotions_pharmacy_active ON sales_schema.promotions(pharmacy_id, is_active);
+
+-- Promotion share of a line's discount, so the counter's own discount can be recovered
+ALTER TABLE sales_schema.sale_items ADD COLUMN IF NOT EXISTS promo_disc_perc DECIMAL(5, 2) NOT NULL DEFAULT 0;
+ALTER TABLE sales_schema.sale_items ADD COLUMN IF NOT EXISTS is_free BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sales_schema.sale_items ADD COLUMN IF NOT EXISTS promotion_id UUID;
+
+CREATE TABLE IF NOT EXISTS sales_schema.sale_promotions (
+    id UUID PRIMARY KEY,
+    sale_id UUID NOT NULL REFERENCES sales_schema.sales(id) ON DELETE CASCADE,
+    promotion_id UUID NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    promo_type VARCHAR(30) NOT NULL,
+    discount_amount DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    free_quantity INT NOT NULL DEFAULT 0,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_promotions_sale ON sales_schema.sale_promotions(sale_id);
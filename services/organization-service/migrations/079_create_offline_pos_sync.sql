@@ -0,0 +1,39 @@
+-- Migration 079: Offline-first POS sync
+-- Counters that lose connectivity bill from a local catalog and stock snapshot
+-- (refreshed with delta tokens) and upload the bills once back online. Each
+-- bill carries a client-generated id, so a replayed upload returns the stored
+-- outcome instead of billing twice. Bills that can no longer be booked, such as
+-- ones that oversell the stock left, are kept as REJECTED for the report.
+
+CREATE TABLE IF NOT EXISTS sales_schema.offline_bills (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    client_bill_id VARCHAR(64) NOT NULL,
+    device_id VARCHAR(64) NOT NULL,
+    upload_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PROCESSING' CHECK (status IN ('PROCESSING', 'RECONCILED', 'REJECTED')),
+    sale_id UUID REFERENCES sales_schema.sales(id),
+    invoice_number VARCHAR(50),
+    billed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    customer_name VARCHAR(255),
+    customer_phone VARCHAR(20),
+    client_total DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    server_total DECIMAL(15, 2),
+    payload JSONB NOT NULL,
+    conflicts JSONB NOT NULL DEFAULT '[]',
+    reject_reason TEXT,
+    attempts INT NOT NULL DEFAULT 1,
+    uploaded_by UUID,
+    uploaded_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_offline_bills_client UNIQUE (pharmacy_id, client_bill_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_offline_bills_pharmacy ON sales_schema.offline_bills(pharmacy_id, billed_at);
+CREATE INDEX IF NOT EXISTS idx_offline_bills_status ON sales_schema.offline_bills(pharmacy_id, status);
+
+-- Delta snapshots pick up catalog and stock rows changed since the token's time
+CREATE INDEX IF NOT EXISTS idx_medicines_pharmacy_updated ON inventory.medicines(pharmacy_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_batches_pharmacy_updated ON inventory.batches(pharmacy_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_reservations_pharmacy_updated ON inventory.reservations(pharmacy_id, updated_at);
@@ -0,0 +1,30 @@
+-- Migration 080: Prescription images and PDFs
+-- Paper prescriptions handed over at the counter are photographed or scanned
+-- and kept against the prescription and/or the sale they were dispensed on.
+-- Each upload is read by the configured OCR engine; the recognised text and
+-- the catalog medicines matched in it are stored as proposals that the
+-- pharmacist confirms into a prescription.
+
+CREATE TABLE IF NOT EXISTS sales_schema.prescription_attachments (
+    id UUID PRIMARY KEY,
+    pharmacy_id UUID NOT NULL,
+    prescription_id VARCHAR(50) REFERENCES sales_schema.prescriptions(id),
+    sale_id UUID REFERENCES sales_schema.sales(id),
+    file_path VARCHAR(500) NOT NULL,
+    file_type VARCHAR(10) NOT NULL CHECK (file_type IN ('IMAGE', 'PDF')),
+    original_name VARCHAR(255),
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    ocr_engine VARCHAR(50),
+    ocr_status VARCHAR(20) NOT NULL DEFAULT 'PENDING' CHECK (ocr_status IN ('PENDING', 'COMPLETED', 'FAILED')),
+    ocr_text TEXT,
+    ocr_error TEXT,
+    proposals JSONB NOT NULL DEFAULT '[]',
+    uploaded_by UUID,
+    uploaded_by_name VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_prescription_attachments_rx ON sales_schema.prescription_attachments(prescription_id) WHERE prescription_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_prescription_attachments_sale ON sales_schema.prescription_attachments(sale_id) WHERE sale_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_prescription_attachments_pharmacy ON sales_schema.prescription_attachments(pharmacy_id, created_at);
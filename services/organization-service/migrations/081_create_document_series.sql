@@ -0,0 +1,48 @@
+-- Migration 081: Sequential document numbering
+-- Sale invoices, return credit notes, due receipts, stock-outs, purchase
+-- orders, goods received notes, debit notes, payment vouchers, stock transfers,
+-- stock-take sessions and expiry proposals are numbered from per-pharmacy
+-- series instead of per-day numbers. A series sets the
+-- prefix, whether numbering restarts each financial year (April to March) and
+-- the zero-padding; pharmacies without a row use the built-in defaults.
+-- Counters are bumped inside the transaction that saves the document, so a
+-- rolled-back document hands its number back and the series has no gaps.
+
+CREATE TABLE IF NOT EXISTS sales_schema.document_series (
+    pharmacy_id UUID NOT NULL,
+    document_type VARCHAR(30) NOT NULL CHECK (document_type IN (
+        'SALE_INVOICE', 'CREDIT_NOTE', 'DUE_RECEIPT', 'STOCK_OUT', 'PURCHASE_ORDER', 'GOODS_RECEIPT',
+        'DEBIT_NOTE', 'PAYMENT_VOUCHER', 'STOCK_TRANSFER', 'STOCK_TAKE', 'EXPIRY_PROPOSAL'
+    )),
+    prefix VARCHAR(10) NOT NULL DEFAULT '',
+    reset_policy VARCHAR(20) NOT NULL DEFAULT 'FINANCIAL_YEAR' CHECK (reset_policy IN ('FINANCIAL_YEAR', 'NEVER')),
+    padding INT NOT NULL DEFAULT 5 CHECK (padding BETWEEN 1 AND 10),
+    updated_by UUID,
+    updated_by_name VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (pharmacy_id, document_type)
+);
+
+-- period is the financial year (2026-27) for series that reset, ALL otherwise
+CREATE TABLE IF NOT EXISTS sales_schema.document_series_counters (
+    pharmacy_id UUID NOT NULL,
+    document_type VARCHAR(30) NOT NULL,
+    period VARCHAR(10) NOT NULL,
+    last_number INT NOT NULL DEFAULT 0 CHECK (last_number >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (pharmacy_id, document_type, period)
+);
+
+ALTER TABLE inventory.stock_outs ADD COLUMN IF NOT EXISTS stock_out_no VARCHAR(30);
+CREATE INDEX IF NOT EXISTS idx_stock_outs_number ON inventory.stock_outs(pharmacy_id, stock_out_no);
+
+-- Series are per pharmacy, so two pharmacies both issue INV/26-27/00001;
+-- invoice and return numbers are unique within a pharmacy rather than globally
+ALTER TABLE sales_schema.sales DROP CONSTRAINT IF EXISTS sales_invoice_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_sales_pharmacy_invoice_number ON sales_schema.sales(pharmacy_id, invoice_number) WHERE invoice_number IS NOT NULL;
+ALTER TABLE sales_schema.sales_returns DROP CONSTRAINT IF EXISTS sales_returns_return_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_sales_returns_pharmacy_return_number ON sales_schema.sales_returns(pharmacy_id, return_number);
+
+-- Sales and returns numbered before the series keep their number on the tax
+-- documents backfilled for them; numbers too long for GST are flagged as legacy
+ALTER TABLE sales_schema.tax_documents ADD COLUMN IF NOT EXISTS legacy_number BOOLEAN NOT NULL DEFAULT FALSE;
@@ -4,16 +4,32 @@ import (
 	"organization-service/config"
 	"organization-service/controllers"
 	"organization-service/internal/patient"
+	"organization-service/internal/pharmacy/compliance"
+	"organization-service/internal/pharmacy/gst"
 	"organization-service/internal/pharmacy/inventory/batches"
+	"organization-service/internal/pharmacy/inventory/debitnotes"
+	"organization-service/internal/pharmacy/inventory/expiry"
+	"organization-service/internal/pharmacy/inventory/labels"
 	"organization-service/internal/pharmacy/inventory/ledger"
 	"organization-service/internal/pharmacy/inventory/medicines"
+	"organization-service/internal/pharmacy/inventory/purchaseorders"
+	"organization-service/internal/pharmacy/inventory/reorder"
 	"organization-service/internal/pharmacy/inventory/reservations"
 	"organization-service/internal/pharmacy/inventory/stockin"
 	"organization-service/internal/pharmacy/inventory/stockouts"
+	"organization-service/internal/pharmacy/inventory/stocktake"
+	"organization-service/internal/pharmacy/inventory/transfers"
+	"organization-service/internal/pharmacy/safety"
+	"organization-service/internal/pharmacy/sales/loyalty"
+	"organization-service/internal/pharmacy/sales/offline"
 	"organization-service/internal/pharmacy/sales/prescriptions"
+	"organization-service/internal/pharmacy/sales/promotions"
+	"organization-service/internal/pharmacy/sales/refills"
 	"organization-service/internal/pharmacy/sales/sales"
 	"organization-service/internal/pharmacy/notification"
+	"organization-service/internal/pharmacy/numbering"
 	"organization-service/internal/pharmacy/supplier"
+	"organization-service/internal/pharmacy/supplier/payables"
 	"organization-service/internal/pharmacy/dashboard"
 	"organization-service/middleware"
 
@@ -21,21 +37,37 @@ import (
 )
 
 type InventoryHandlers struct {
-	Meds     *medicines.Handler
-	Batches  *batches.Handler
-	Ledger   *ledger.Handler
-	StockIn  *stockin.Handler
-	StockOut *stockouts.Handler
-	Res      *reservations.Handler
+	Meds           *medicines.Handler
+	Batches        *batches.Handler
+	Ledger         *ledger.Handler
+	StockIn        *stockin.Handler
+	StockOut       *stockouts.Handler
+	Res            *reservations.Handler
+	PurchaseOrders *purchaseorders.Handler
+	Reorder        *reorder.Handler
+	DebitNotes     *debitnotes.Handler
+	Transfers      *transfers.Handler
+	StockTake      *stocktake.Handler
+	Expiry         *expiry.Handler
+	Labels         *labels.Handler
 }
 
 type SalesHandlers struct {
-	Sales *sales.Handler
-	Rx    *prescriptions.Handler
+	Sales      *sales.Handler
+	Rx         *prescriptions.Handler
+	Safety     *safety.Handler
+	Compliance *compliance.Handler
+	GST        *gst.Handler
+	Refills    *refills.Handler
+	Loyalty    *loyalty.Handler
+	Promotions *promotions.Handler
+	Offline    *offline.Handler
+	Numbering  *numbering.Handler
 }
 
 type SupplierHandlers struct {
 	Supplier *supplier.SupplierHandler
+	Payables *payables.Handler
 }
 
 type NotificationHandlers struct {
@@ -208,6 +240,16 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		consultationFees.PUT("", middleware.RequireRole(config.DB, "super_admin", "clinic_admin", "doctor"), controllers.UpdateConsultationFees)
 	}
 
+	// Follow-up Policies (validity, free visits and fees per clinic/department/doctor)
+	followUpPolicies := rg.Group("/followup-policies")
+	{
+		followUpPolicies.GET("", middleware.RequireRole(config.DB, "super_admin", "clinic_admin", "receptionist", "doctor"), controllers.ListFollowUpPolicies)
+		followUpPolicies.GET("/resolve", middleware.RequireRole(config.DB, "super_admin", "clinic_admin", "receptionist", "doctor"), controllers.ResolveFollowUpPolicy)
+		followUpPolicies.POST("", middleware.RequireRole(config.DB, "super_admin", "clinic_admin"), controllers.CreateFollowUpPolicy)
+		followUpPolicies.PUT("/:id", middleware.RequireRole(config.DB, "super_admin", "clinic_admin"), controllers.UpdateFollowUpPolicy)
+		followUpPolicies.DELETE("/:id", middleware.RequireRole(config.DB, "super_admin", "clinic_admin"), controllers.DeleteFollowUpPolicy)
+	}
+
 	// External Services
 	services := rg.Group("/services")
 	{
@@ -402,6 +444,7 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		b.GET("", inventoryHandlers.Batches.List)
 		b.GET("/sellable", inventoryHandlers.Batches.ListSellable)
 		b.GET("/stats", inventoryHandlers.Batches.GetStats)
+		b.GET("/resolve", inventoryHandlers.Batches.Resolve)
 		b.POST("/return", inventoryHandlers.Batches.ProcessReturn)
 		b.GET("/:id/history", inventoryHandlers.Batches.GetHistory)
 		b.PUT("/:id", inventoryHandlers.Batches.Update)
@@ -435,10 +478,102 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		so.GET("/:id/history", inventoryHandlers.StockOut.GetHistory)
 	}
 
+	// Pharmacy Inventory - Purchase Orders
+	po := rg.Group("/pharmacy/inventory/purchase-orders")
+	{
+		po.POST("", inventoryHandlers.PurchaseOrders.Create)
+		po.GET("", inventoryHandlers.PurchaseOrders.List)
+		po.GET("/:id", inventoryHandlers.PurchaseOrders.GetByID)
+		po.PUT("/:id", inventoryHandlers.PurchaseOrders.Update)
+		po.POST("/:id/send", inventoryHandlers.PurchaseOrders.Send)
+		po.POST("/:id/receive", inventoryHandlers.PurchaseOrders.Receive)
+		po.POST("/:id/close", inventoryHandlers.PurchaseOrders.Close)
+		po.POST("/:id/cancel", inventoryHandlers.PurchaseOrders.Cancel)
+		po.GET("/:id/grns", inventoryHandlers.PurchaseOrders.ListGRNs)
+		po.GET("/:id/variance", inventoryHandlers.PurchaseOrders.GetVariance)
+		po.GET("/:id/export", inventoryHandlers.PurchaseOrders.Export)
+	}
+
+	// Pharmacy Inventory - Supplier returns (debit notes)
+	dn := rg.Group("/pharmacy/inventory/debit-notes")
+	{
+		dn.GET("/candidates", inventoryHandlers.DebitNotes.ListCandidates)
+		dn.POST("", inventoryHandlers.DebitNotes.Create)
+		dn.GET("", inventoryHandlers.DebitNotes.List)
+		dn.GET("/:id", inventoryHandlers.DebitNotes.GetByID)
+		dn.POST("/:id/credits", inventoryHandlers.DebitNotes.RecordCredit)
+	}
+
+	// Pharmacy Inventory - Inter-pharmacy stock transfers
+	tr := rg.Group("/pharmacy/inventory/transfers")
+	{
+		tr.GET("/destinations", inventoryHandlers.Transfers.ListDestinations)
+		tr.POST("", inventoryHandlers.Transfers.Dispatch)
+		tr.GET("", inventoryHandlers.Transfers.List)
+		tr.GET("/:id", inventoryHandlers.Transfers.GetByID)
+		tr.POST("/:id/receive", inventoryHandlers.Transfers.Receive)
+		tr.POST("/:id/cancel", inventoryHandlers.Transfers.Cancel)
+		tr.POST("/:id/resolve", inventoryHandlers.Transfers.ResolveDiscrepancy)
+	}
+
+	// Pharmacy Inventory - Stock-take (cycle count) sessions
+	st := rg.Group("/pharmacy/inventory/stock-takes")
+	{
+		st.POST("", inventoryHandlers.StockTake.Start)
+		st.GET("", inventoryHandlers.StockTake.List)
+		st.GET("/:id", inventoryHandlers.StockTake.GetByID)
+		st.GET("/:id/report", inventoryHandlers.StockTake.GetReport)
+		st.POST("/:id/scan", inventoryHandlers.StockTake.Scan)
+		st.POST("/:id/items/:itemId/count", inventoryHandlers.StockTake.Count)
+		st.GET("/:id/items/:itemId/history", inventoryHandlers.StockTake.GetItemHistory)
+		st.POST("/:id/complete", inventoryHandlers.StockTake.Complete)
+		st.POST("/:id/reopen", inventoryHandlers.StockTake.Reopen)
+		st.POST("/:id/review", inventoryHandlers.StockTake.Review)
+		st.POST("/:id/post", inventoryHandlers.StockTake.Post)
+		st.POST("/:id/cancel", inventoryHandlers.StockTake.Cancel)
+	}
+
+	// Pharmacy Inventory - Expiry quarantine, alerts and return/write-off proposals
+	ex := rg.Group("/pharmacy/inventory/expiry")
+	{
+		ex.GET("/settings", inventoryHandlers.Expiry.GetSettings)
+		ex.PUT("/settings", inventoryHandlers.Expiry.UpdateSettings)
+		ex.POST("/run", inventoryHandlers.Expiry.Run)
+		ex.GET("/alerts", inventoryHandlers.Expiry.ListAlerts)
+		ex.POST("/alerts/:id/acknowledge", inventoryHandlers.Expiry.AcknowledgeAlert)
+		ex.GET("/quarantine", inventoryHandlers.Expiry.ListQuarantined)
+		ex.GET("/proposals", inventoryHandlers.Expiry.ListProposals)
+		ex.GET("/proposals/:id", inventoryHandlers.Expiry.GetProposal)
+		ex.POST("/proposals/:id/approve", inventoryHandlers.Expiry.ApproveProposal)
+		ex.POST("/proposals/:id/reject", inventoryHandlers.Expiry.RejectProposal)
+	}
+
+	// Pharmacy Inventory - Batch, purchase and rack labels
+	lb := rg.Group("/pharmacy/inventory/labels")
+	{
+		lb.POST("/batches", inventoryHandlers.Labels.BatchLabels)
+		lb.POST("/purchases/:id", inventoryHandlers.Labels.PurchaseLabels)
+		lb.GET("/racks", inventoryHandlers.Labels.ListRacks)
+		lb.POST("/racks", inventoryHandlers.Labels.RackLabels)
+	}
+
+	// Pharmacy Inventory - Reorder suggestions and demand forecast
+	ro := rg.Group("/pharmacy/inventory/reorder")
+	{
+		ro.GET("/suggestions", inventoryHandlers.Reorder.GetSuggestions)
+		ro.POST("/purchase-orders", inventoryHandlers.Reorder.CreatePurchaseOrders)
+		ro.GET("/forecast/:medicineId", inventoryHandlers.Reorder.GetForecast)
+		ro.GET("/settings/:medicineId", inventoryHandlers.Reorder.GetSettings)
+		ro.PUT("/settings/:medicineId", inventoryHandlers.Reorder.UpdateSettings)
+	}
+
 	// Pharmacy Inventory - Reservations
 	resGroup := rg.Group("/pharmacy/inventory/reservations")
 	{
 		resGroup.POST("", inventoryHandlers.Res.Create)
+		resGroup.GET("/settings", inventoryHandlers.Res.GetSettings)
+		resGroup.PUT("/settings", inventoryHandlers.Res.UpdateSettings)
+		resGroup.POST("/extend", inventoryHandlers.Res.Extend)
 		resGroup.PUT("/:id", inventoryHandlers.Res.Update)
 		resGroup.POST("/:id/confirm", inventoryHandlers.Res.Confirm)
 		resGroup.POST("/:id/cancel", inventoryHandlers.Res.Cancel)
@@ -448,6 +583,7 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 	sGroup := rg.Group("/pharmacy/sales")
 	{
 		sGroup.GET("/stats", salesHandlers.Sales.GetStats)
+		sGroup.GET("/collections", salesHandlers.Sales.GetDayCollection)
 		sGroup.GET("/reports/recurring-refills", salesHandlers.Sales.GetRecurringRefillsReport)
 		sGroup.GET("/patients/stats", salesHandlers.Sales.GetPatientStats)
 		sGroup.GET("/patients", salesHandlers.Sales.ListPatients)
@@ -455,7 +591,12 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		sGroup.GET("/patients/:id", salesHandlers.Sales.GetPatientByID)
 		sGroup.GET("/patients/:id/sales", salesHandlers.Sales.GetPatientSales)
 		sGroup.GET("/patients/:id/returns", salesHandlers.Sales.GetPatientReturns)
+		sGroup.GET("/patients/:id/statement", salesHandlers.Sales.GetWalletStatement)
+		sGroup.POST("/patients/:id/payments", salesHandlers.Sales.CollectDue)
+		sGroup.POST("/patients/:id/adjustments", salesHandlers.Sales.AdjustWallet)
+		sGroup.PUT("/patients/:id/credit-limit", salesHandlers.Sales.SetCreditLimit)
 		sGroup.GET("", salesHandlers.Sales.ListSales)
+		sGroup.GET("/parked", salesHandlers.Sales.ListParkedBills)
 		sGroup.GET("/:id", salesHandlers.Sales.GetSale)
 		sGroup.POST("/draft/:rxId", salesHandlers.Sales.CreateDraft)
 		sGroup.POST("/walk-in", salesHandlers.Sales.CreateWalkInDraft)
@@ -464,6 +605,13 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		sGroup.DELETE("/:id/items/:itemId", salesHandlers.Sales.RemoveItem)
 		sGroup.POST("/:id/finalize", salesHandlers.Sales.FinalizeSale)
 		sGroup.POST("/:id/dispatch", salesHandlers.Sales.DispatchSale)
+		sGroup.POST("/:id/resume", salesHandlers.Sales.ResumeDraft)
+		sGroup.POST("/:id/discard", salesHandlers.Sales.DiscardDraft)
+		sGroup.GET("/:id/compliance", salesHandlers.Sales.GetCompliance)
+		sGroup.PUT("/:id/prescriber", salesHandlers.Sales.SetPrescriber)
+		sGroup.POST("/:id/sign-off", salesHandlers.Sales.SignOff)
+		sGroup.GET("/:id/tax-invoice", salesHandlers.Sales.GetTaxInvoice)
+		sGroup.POST("/tax-documents/backfill", middleware.RequireRole(config.DB, "super_admin", "pharmacy_admin"), salesHandlers.Sales.BackfillTaxDocuments)
 	}
 
 	// Pharmacy Sales - Returns
@@ -472,6 +620,71 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		rGroup.POST("", salesHandlers.Sales.ProcessReturn)
 		rGroup.GET("", salesHandlers.Sales.ListReturns)
 		rGroup.GET("/:id", salesHandlers.Sales.GetReturn)
+		rGroup.GET("/:id/credit-note", salesHandlers.Sales.GetCreditNote)
+	}
+
+	// Pharmacy Sales - Refill reminders, auto-drafted refills and adherence
+	refillGroup := rg.Group("/pharmacy/sales/refills")
+	{
+		refillGroup.GET("/settings", salesHandlers.Refills.GetSettings)
+		refillGroup.PUT("/settings", salesHandlers.Refills.UpdateSettings)
+		refillGroup.POST("/run", salesHandlers.Refills.Run)
+		refillGroup.GET("/reminders", salesHandlers.Refills.ListReminders)
+		refillGroup.GET("/adherence", salesHandlers.Refills.GetAdherence)
+	}
+
+	// Pharmacy Sales - Loyalty program, tiers and member points
+	loyaltyGroup := rg.Group("/pharmacy/sales/loyalty")
+	{
+		loyaltyGroup.GET("/settings", salesHandlers.Loyalty.GetSettings)
+		loyaltyGroup.PUT("/settings", salesHandlers.Loyalty.UpdateSettings)
+		loyaltyGroup.POST("/expire", salesHandlers.Loyalty.Expire)
+		loyaltyGroup.GET("/members/:patientId", salesHandlers.Loyalty.GetMember)
+		loyaltyGroup.GET("/members/:patientId/entries", salesHandlers.Loyalty.ListEntries)
+		loyaltyGroup.POST("/members/:patientId/adjustments", salesHandlers.Loyalty.Adjust)
+	}
+
+	// Pharmacy Sales - Promotions applied as the bill changes
+	promoGroup := rg.Group("/pharmacy/sales/promotions")
+	{
+		promoGroup.GET("", salesHandlers.Promotions.List)
+		promoGroup.POST("", salesHandlers.Promotions.Create)
+		promoGroup.GET("/:id", salesHandlers.Promotions.Get)
+		promoGroup.PUT("/:id", salesHandlers.Promotions.Update)
+		promoGroup.DELETE("/:id", salesHandlers.Promotions.Deactivate)
+	}
+
+	// Pharmacy Sales - Offline counter sync: snapshots down, bills up
+	offlineGroup := rg.Group("/pharmacy/sales/offline")
+	{
+		offlineGroup.GET("/snapshot", salesHandlers.Offline.GetSnapshot)
+		offlineGroup.POST("/bills", salesHandlers.Offline.Upload)
+		offlineGroup.GET("/bills", salesHandlers.Offline.ListBills)
+		offlineGroup.GET("/report", salesHandlers.Offline.GetReport)
+	}
+
+	// Pharmacy Sales - Schedule H1/X controlled drug register
+	cdGroup := rg.Group("/pharmacy/sales/controlled-register")
+	{
+		cdGroup.GET("", salesHandlers.Compliance.ListRegister)
+		cdGroup.GET("/export", salesHandlers.Compliance.ExportRegister)
+	}
+
+	// Pharmacy GST - registration profile and period returns
+	gstGroup := rg.Group("/pharmacy/gst")
+	{
+		gstGroup.GET("/profile", salesHandlers.GST.GetProfile)
+		gstGroup.PUT("/profile", salesHandlers.GST.UpdateProfile)
+		gstGroup.GET("/outward", salesHandlers.GST.Outward)
+		gstGroup.GET("/inward", salesHandlers.GST.Inward)
+	}
+
+	// Pharmacy document numbering - invoice, credit note, stock-out and purchase series
+	seriesGroup := rg.Group("/pharmacy/numbering/series")
+	{
+		seriesGroup.GET("", salesHandlers.Numbering.ListSeries)
+		seriesGroup.PUT("/:type", salesHandlers.Numbering.UpdateSeries)
+		seriesGroup.POST("/:type/seed", salesHandlers.Numbering.SeedSeries)
 	}
 
 	// Pharmacy Sales - Prescriptions
@@ -480,6 +693,25 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		rxGroup.GET("", salesHandlers.Rx.List)
 		rxGroup.GET("/:id", salesHandlers.Rx.Get)
 		rxGroup.POST("", salesHandlers.Rx.Create)
+
+		// Photos and PDFs of paper prescriptions, read into item proposals
+		rxGroup.POST("/attachments", salesHandlers.Rx.UploadAttachment)
+		rxGroup.GET("/attachments", salesHandlers.Rx.ListAttachments)
+		rxGroup.GET("/attachments/:attachmentId", salesHandlers.Rx.GetAttachment)
+		rxGroup.GET("/attachments/:attachmentId/file", salesHandlers.Rx.GetAttachmentFile)
+		rxGroup.PUT("/attachments/:attachmentId/link", salesHandlers.Rx.LinkAttachment)
+		rxGroup.POST("/attachments/:attachmentId/reprocess", salesHandlers.Rx.ReprocessAttachment)
+		rxGroup.POST("/attachments/:attachmentId/confirm", salesHandlers.Rx.ConfirmAttachment)
+	}
+
+	// Pharmacy Drug Safety - interaction and allergy rules
+	safetyGroup := rg.Group("/pharmacy/safety")
+	{
+		safetyGroup.POST("/check", salesHandlers.Safety.Check)
+		safetyGroup.GET("/interactions", salesHandlers.Safety.ListInteractions)
+		safetyGroup.POST("/interactions/import", middleware.RequireRole(config.DB, "super_admin", "pharmacy_admin"), salesHandlers.Safety.ImportInteractions)
+		safetyGroup.GET("/allergens", salesHandlers.Safety.ListAllergens)
+		safetyGroup.POST("/allergens/import", middleware.RequireRole(config.DB, "super_admin", "pharmacy_admin"), salesHandlers.Safety.ImportAllergens)
 	}
 
 	// Pharmacy Supplier
@@ -491,6 +723,17 @@ func OrganizationRoutes(rg *gin.RouterGroup, patientHandler *patient.PatientHand
 		supGroup.GET("/:id", supplierHandlers.Supplier.GetOne)
 		supGroup.PUT("/:id", supplierHandlers.Supplier.Update)
 		supGroup.GET("/:id/history", supplierHandlers.Supplier.GetHistory)
+
+		// Accounts payable
+		supGroup.GET("/payables/ageing", supplierHandlers.Payables.GetAgeingReport)
+		supGroup.GET("/payables/due", supplierHandlers.Payables.ListDue)
+		supGroup.POST("/payables/vouchers", supplierHandlers.Payables.CreateVoucher)
+		supGroup.GET("/payables/vouchers", supplierHandlers.Payables.ListVouchers)
+		supGroup.GET("/payables/vouchers/:id", supplierHandlers.Payables.GetVoucher)
+		supGroup.GET("/:id/ledger", supplierHandlers.Payables.GetLedger)
+		supGroup.GET("/:id/outstanding", supplierHandlers.Payables.GetOutstanding)
+		supGroup.GET("/:id/opening-balance", supplierHandlers.Payables.GetOpeningBalance)
+		supGroup.PUT("/:id/opening-balance", supplierHandlers.Payables.SetOpeningBalance)
 	}
 
 	// Pharmacy Notification
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const MaxDocumentSize = 10 * 1024 * 1024 // 10MB
+
+// ValidateDocument checks an uploaded scan: a JPG/PNG within the image limit, or a PDF
+func ValidateDocument(fileHeader *multipart.FileHeader) error {
+	if strings.ToLower(filepath.Ext(fileHeader.Filename)) != ".pdf" {
+		return ValidateImage(fileHeader)
+	}
+	if fileHeader.Size > MaxDocumentSize {
+		return errors.New("file size exceeds 10MB limit")
+	}
+	return nil
+}
+
+// IsPDF reports whether the upload is a PDF by its extension
+func IsPDF(filename string) bool {
+	return strings.ToLower(filepath.Ext(filename)) == ".pdf"
+}
+
+// SavePDF stores an uploaded PDF as is; PDFs are not re-encoded like images.
+// Returns the relative path to the saved file
+func SavePDF(file multipart.File, subDir string) (string, error) {
+	uploadPath := filepath.Join("uploads", subDir)
+	if err := os.MkdirAll(uploadPath, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("failed to seek file: %w", err)
+	}
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(file, header); err != nil || !bytes.Equal(header, []byte("%PDF-")) {
+		return "", errors.New("invalid PDF content")
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	newFilename := fmt.Sprintf("%s_%d.pdf", uuid.New().String(), time.Now().Unix())
+	dstPath := filepath.Join(uploadPath, newFilename)
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, io.LimitReader(file, MaxDocumentSize)); err != nil {
+		return "", fmt.Errorf("failed to save PDF: %w", err)
+	}
+
+	return dstPath, nil
+}
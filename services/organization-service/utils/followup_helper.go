@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"time"
+
+	"shared-followup"
 )
 
 // FollowUpHelper provides helper functions for querying follow-up data
@@ -173,35 +177,30 @@ func (fh *FollowUpHelper) GetExpiredFollowUps(clinicPatientID, clinicID string)
 
 // CheckFollowUpEligibility checks if patient has active follow-up with specific doctor+department
 func (fh *FollowUpHelper) CheckFollowUpEligibility(clinicPatientID, clinicID, doctorID string, departmentID *string) (bool, bool, string, error) {
-	query := `
-		SELECT id, is_free, valid_until
-		FROM follow_ups
-		WHERE clinic_patient_id = $1
-		  AND clinic_id = $2
-		  AND doctor_id = $3
-		  AND status = 'active'
-		  AND valid_until >= CURRENT_DATE
-	`
-
-	args := []interface{}{clinicPatientID, clinicID, doctorID}
-
-	if departmentID != nil {
-		query += ` AND department_id = $4`
-		args = append(args, *departmentID)
-	} else {
-		query += ` AND department_id IS NULL`
+	decision, err := fh.EvaluateFollowUp(context.Background(), clinicPatientID, clinicID, doctorID, departmentID)
+	if err != nil {
+		return false, false, "", err
 	}
 
-	query += ` ORDER BY created_at DESC LIMIT 1`
+	return decision.IsFree, decision.Eligible, decision.Message, nil
+}
 
-	var followUpID string
-	var isFree bool
-	var validUntil time.Time
+// EvaluateFollowUp applies the clinic's follow-up policy (shared with appointment-service)
+// to the patient's latest follow-up window with the doctor+department
+func (fh *FollowUpHelper) EvaluateFollowUp(ctx context.Context, clinicPatientID, clinicID, doctorID string, departmentID *string) (followup.Decision, error) {
+	policy, err := followup.LoadPolicy(ctx, fh.DB, clinicID, doctorID, departmentID)
+	if err != nil {
+		log.Printf("⚠️ Warning: Using default follow-up policy: %v", err)
+	}
 
-	err := fh.DB.QueryRow(query, args...).Scan(&followUpID, &isFree, &validUntil)
+	req := followup.Request{Policy: policy, Now: time.Now()}
+	req.Latest, req.LatestAnyDepartment, err = followup.LoadWindows(ctx, fh.DB, clinicPatientID, clinicID, doctorID, departmentID)
+	if err != nil {
+		return followup.Decision{}, fmt.Errorf("failed to check follow-up eligibility: %w", err)
+	}
 
-	if err == sql.ErrNoRows {
-		// No active follow-up - check if patient has any previous appointment
+	if req.Window() == nil {
+		// No follow-up window - check if patient has any previous appointment
 		checkQuery := `
 			SELECT EXISTS(
 				SELECT 1 FROM appointments
@@ -221,29 +220,11 @@ func (fh *FollowUpHelper) CheckFollowUpEligibility(clinicPatientID, clinicID, do
 
 		checkQuery += `)`
 
-		var hasPrevious bool
-		err = fh.DB.QueryRow(checkQuery, checkArgs...).Scan(&hasPrevious)
+		err = fh.DB.QueryRowContext(ctx, checkQuery, checkArgs...).Scan(&req.HasPreviousVisit)
 		if err != nil {
-			return false, false, "", fmt.Errorf("failed to check previous appointments: %w", err)
-		}
-
-		if hasPrevious {
-			return false, true, "Follow-up available (payment required)", nil
+			return followup.Decision{}, fmt.Errorf("failed to check previous appointments: %w", err)
 		}
-
-		return false, false, "No previous appointment found", nil
-	}
-
-	if err != nil {
-		return false, false, "", fmt.Errorf("failed to check follow-up eligibility: %w", err)
-	}
-
-	// Active follow-up found
-	daysRemaining := int(time.Until(validUntil).Hours() / 24)
-	if isFree {
-		return true, true, fmt.Sprintf("Free follow-up available (%d days remaining)", daysRemaining), nil
 	}
 
-	return false, true, "Follow-up available (payment required)", nil
+	return followup.Evaluate(req), nil
 }
-
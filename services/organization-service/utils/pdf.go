@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDFFont selects one of the standard Type1 fonts every PDF reader ships with
+type PDFFont string
+
+const (
+	FontRegular PDFFont = "F1" // Helvetica
+	FontBold    PDFFont = "F2" // Helvetica-Bold
+	FontMono    PDFFont = "F3" // Courier, for column-aligned tables
+)
+
+const (
+	pdfPageWidth  = 595.0 // A4 in points
+	pdfPageHeight = 842.0
+	pdfMargin     = 40.0
+)
+
+// PDFDocument is a minimal text-only PDF writer for printable documents such as
+// purchase orders and invoices. Lines flow top to bottom and break onto new A4 pages.
+type PDFDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func NewPDFDocument() *PDFDocument {
+	d := &PDFDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *PDFDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+func (d *PDFDocument) ensureSpace(height float64) {
+	if d.y-height < pdfMargin {
+		d.newPage()
+	}
+}
+
+// Text writes one line at the left margin
+func (d *PDFDocument) Text(font PDFFont, size float64, text string) {
+	d.TextAt(font, size, 0, text)
+}
+
+// TextAt writes one line indented by x points from the left margin
+func (d *PDFDocument) TextAt(font PDFFont, size, x float64, text string) {
+	lineHeight := size * 1.35
+	d.ensureSpace(lineHeight)
+	d.y -= lineHeight
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, pdfMargin+x, d.y, pdfEscape(text))
+}
+
+// Gap adds vertical space
+func (d *PDFDocument) Gap(height float64) {
+	d.ensureSpace(height)
+	d.y -= height
+}
+
+// Rule draws a horizontal line across the printable width
+func (d *PDFDocument) Rule() {
+	d.Gap(4)
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0.5 w %.2f %.2f m %.2f %.2f l S\n",
+		pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+	d.Gap(2)
+}
+
+// Bytes renders the document
+func (d *PDFDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Object layout: 1 catalog, 2 pages, 3-5 fonts, then a page + content pair per page
+	const firstPageObj = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPageObj+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape keeps text within the standard fonts' character set
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '₹':
+			b.WriteString("Rs.")
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
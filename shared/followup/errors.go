@@ -0,0 +1,17 @@
+package followup
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxValidityDays keeps windows inside the follow_ups date check constraint:
+// a window may end at most 90 days out, and since appointments can be booked
+// up to 30 days ahead the window itself can last no more than 90 - 30 = 60 days.
+const MaxValidityDays = 60
+
+var (
+	ErrInvalidValidityDays  = fmt.Errorf("validity_days must be between 1 and %d", MaxValidityDays)
+	ErrInvalidFreeVisits    = errors.New("free_visits cannot be negative")
+	ErrInvalidDiscountedFee = errors.New("discounted_fee cannot be negative")
+)
@@ -0,0 +1,182 @@
+package followup
+
+import (
+	"fmt"
+	"time"
+)
+
+// Consultation types that take part in follow-up tracking.
+const (
+	TypeClinicVisit       = "clinic_visit"
+	TypeVideoConsultation = "video_consultation"
+	TypeFollowUpClinic    = "follow-up-via-clinic"
+	TypeFollowUpVideo     = "follow-up-via-video"
+)
+
+// Follow-up record statuses (follow_ups.status).
+const (
+	StatusActive  = "active"
+	StatusUsed    = "used"
+	StatusExpired = "expired"
+	StatusRenewed = "renewed"
+)
+
+// Window is the latest follow-up record for a patient with a doctor+department.
+type Window struct {
+	ID              string // follow_ups.id, the record to consume a free visit from
+	Status          string
+	ValidUntil      time.Time
+	FreeVisitsTotal int
+	FreeVisitsUsed  int
+}
+
+// FreeVisitsLeft returns how many free visits remain in the window.
+func (w Window) FreeVisitsLeft() int {
+	if left := w.FreeVisitsTotal - w.FreeVisitsUsed; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Request carries everything the evaluator needs to decide eligibility.
+type Request struct {
+	Policy              Policy
+	Latest              *Window // latest window in the requested department; nil when there is none
+	LatestAnyDepartment *Window // latest window with the doctor in any department; nil when there is none
+	HasPreviousVisit    bool    // any completed/confirmed regular visit with the doctor
+	ViaVideo            bool    // the follow-up is requested as a video consultation
+	Now                 time.Time
+}
+
+// Window returns the follow-up window the request is judged against. Under a
+// cross-department policy a visit in any department resets the doctor's
+// window, so the doctor's most recent window applies wherever it was opened.
+func (r Request) Window() *Window {
+	if r.Policy.CrossDepartmentReset && r.LatestAnyDepartment != nil {
+		return r.LatestAnyDepartment
+	}
+	return r.Latest
+}
+
+// Decision is the outcome of evaluating a follow-up request.
+type Decision struct {
+	Eligible       bool       `json:"eligible"`
+	IsFree         bool       `json:"is_free"`
+	IsDiscounted   bool       `json:"is_discounted"`
+	DiscountedFee  *float64   `json:"discounted_fee,omitempty"`
+	FreeVisitsLeft int        `json:"free_visits_left"`
+	DaysRemaining  int        `json:"days_remaining"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	Message        string     `json:"message"`
+}
+
+// Evaluate applies the policy to the patient's follow-up state.
+func Evaluate(req Request) Decision {
+	p := req.Policy
+
+	if w := req.Window(); w != nil && w.Status != StatusRenewed {
+		open := w.Status != StatusExpired && IsOpen(w.ValidUntil, req.Now)
+
+		if open {
+			validUntil := w.ValidUntil
+			d := Decision{
+				Eligible:       true,
+				FreeVisitsLeft: w.FreeVisitsLeft(),
+				DaysRemaining:  DaysRemaining(w.ValidUntil, req.Now),
+				ValidUntil:     &validUntil,
+			}
+
+			switch {
+			case req.ViaVideo && !p.VideoCounts:
+				d.Message = "Video follow-ups are not covered by the free follow-up policy. This follow-up requires payment."
+			case w.Status == StatusActive && d.FreeVisitsLeft > 0:
+				d.IsFree = true
+				d.Message = fmt.Sprintf("Free follow-up available (%d days remaining)", d.DaysRemaining)
+			case p.DiscountedFee != nil:
+				d.IsDiscounted = true
+				d.DiscountedFee = p.DiscountedFee
+				d.Message = fmt.Sprintf("Free follow-up already used. Discounted follow-up fee applies (%d days remaining)", d.DaysRemaining)
+			default:
+				d.Message = "Free follow-up already used. This follow-up requires payment."
+			}
+			return d
+		}
+
+		if w.Status == StatusUsed {
+			return Decision{Eligible: true, Message: "Free follow-up already used. This follow-up requires payment."}
+		}
+		return Decision{Eligible: true, Message: "Free follow-up expired. This follow-up requires payment."}
+	}
+
+	if req.HasPreviousVisit {
+		return Decision{Eligible: true, Message: "Follow-up available (payment required)"}
+	}
+
+	return Decision{Message: "No previous appointment found with this doctor"}
+}
+
+// Fee returns the amount to charge for a follow-up given the decision and the
+// doctor's regular fee.
+func (d Decision) Fee(regularFee *float64) float64 {
+	switch {
+	case d.IsFree:
+		return 0
+	case d.IsDiscounted && d.DiscountedFee != nil:
+		return *d.DiscountedFee
+	case regularFee != nil:
+		return *regularFee
+	default:
+		return 0
+	}
+}
+
+// GrantsWindow reports whether an appointment of this consultation type opens
+// a new follow-up window under the policy.
+func GrantsWindow(p Policy, consultationType string) bool {
+	switch consultationType {
+	case TypeClinicVisit:
+		return true
+	case TypeVideoConsultation:
+		return p.VideoCounts
+	default:
+		return false
+	}
+}
+
+// IsFollowUpType reports whether the consultation type is a follow-up visit.
+func IsFollowUpType(consultationType string) bool {
+	return consultationType == TypeFollowUpClinic || consultationType == TypeFollowUpVideo
+}
+
+// WindowFor returns the validity window granted by an appointment on the given date.
+func WindowFor(p Policy, appointmentDate time.Time) (time.Time, time.Time) {
+	from := dateOf(appointmentDate)
+	return from, from.AddDate(0, 0, p.ValidityDays)
+}
+
+// Consume records one free visit against the window and reports whether the
+// window has no free visits left afterwards.
+func Consume(w Window) (used int, exhausted bool) {
+	used = w.FreeVisitsUsed + 1
+	return used, used >= w.FreeVisitsTotal
+}
+
+// IsOpen reports whether a window ending on validUntil (inclusive) is still open.
+func IsOpen(validUntil, now time.Time) bool {
+	return !dateOf(validUntil).Before(dateOf(now))
+}
+
+// DaysRemaining returns the whole days left until validUntil, never negative.
+func DaysRemaining(validUntil, now time.Time) int {
+	days := int(dateOf(validUntil).Sub(dateOf(now)).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// dateOf drops the time of day, keeping the calendar date as seen in t's location.
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,352 @@
+package followup
+
+import (
+	"testing"
+	"time"
+)
+
+func strPtr(s string) *string     { return &s }
+func floatPtr(f float64) *float64 { return &f }
+
+func TestResolve(t *testing.T) {
+	clinic := "clinic-1"
+	cardio := strPtr("dept-cardio")
+	ortho := strPtr("dept-ortho")
+
+	clinicWide := Policy{ID: strPtr("p-clinic"), ClinicID: clinic, ValidityDays: 7, IsActive: true}
+	deptPolicy := Policy{ID: strPtr("p-dept"), ClinicID: clinic, DepartmentID: cardio, ValidityDays: 10, IsActive: true}
+	doctorPolicy := Policy{ID: strPtr("p-doc"), ClinicID: clinic, DoctorID: strPtr("doc-1"), ValidityDays: 14, IsActive: true}
+	doctorDeptPolicy := Policy{ID: strPtr("p-doc-dept"), ClinicID: clinic, DoctorID: strPtr("doc-1"), DepartmentID: cardio, ValidityDays: 21, IsActive: true}
+	inactive := Policy{ID: strPtr("p-off"), ClinicID: clinic, DoctorID: strPtr("doc-2"), ValidityDays: 30, IsActive: false}
+	otherClinic := Policy{ID: strPtr("p-other"), ClinicID: "clinic-2", ValidityDays: 3, IsActive: true}
+
+	all := []Policy{clinicWide, deptPolicy, doctorPolicy, doctorDeptPolicy, inactive, otherClinic}
+
+	tests := []struct {
+		name       string
+		doctorID   string
+		department *string
+		candidates []Policy
+		wantID     *string
+		wantScope  string
+		wantDays   int
+	}{
+		{"no policies falls back to default", "doc-1", cardio, nil, nil, ScopeDefault, DefaultValidityDays},
+		{"other clinic ignored", "doc-1", nil, []Policy{otherClinic}, nil, ScopeDefault, DefaultValidityDays},
+		{"clinic wide", "doc-9", nil, all, clinicWide.ID, ScopeClinic, 7},
+		{"department beats clinic", "doc-9", cardio, all, deptPolicy.ID, ScopeDepartment, 10},
+		{"department policy needs matching department", "doc-9", ortho, all, clinicWide.ID, ScopeClinic, 7},
+		{"doctor beats department", "doc-1", ortho, all, doctorPolicy.ID, ScopeDoctor, 14},
+		{"doctor+department beats doctor", "doc-1", cardio, all, doctorDeptPolicy.ID, ScopeDoctorDepartment, 21},
+		{"inactive policy skipped", "doc-2", nil, all, clinicWide.ID, ScopeClinic, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resolve(clinic, tt.doctorID, tt.department, tt.candidates)
+			if (got.ID == nil) != (tt.wantID == nil) || (got.ID != nil && *got.ID != *tt.wantID) {
+				t.Fatalf("Resolve() id = %v, want %v", got.ID, tt.wantID)
+			}
+			if got.Scope() != tt.wantScope {
+				t.Errorf("Scope() = %q, want %q", got.Scope(), tt.wantScope)
+			}
+			if got.ValidityDays != tt.wantDays {
+				t.Errorf("ValidityDays = %d, want %d", got.ValidityDays, tt.wantDays)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	inThreeDays := time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	yesterday := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	standard := DefaultPolicy("clinic-1")
+	discounted := standard
+	discounted.FreeVisits = 2
+	discounted.DiscountedFee = floatPtr(150)
+	noVideo := standard
+	noVideo.VideoCounts = false
+
+	tests := []struct {
+		name         string
+		req          Request
+		wantEligible bool
+		wantFree     bool
+		wantDiscount bool
+		wantLeft     int
+		wantDays     int
+		wantMessage  string
+	}{
+		{
+			name:        "no history",
+			req:         Request{Policy: standard, Now: now},
+			wantMessage: "No previous appointment found with this doctor",
+		},
+		{
+			name:         "previous visit without window is paid",
+			req:          Request{Policy: standard, HasPreviousVisit: true, Now: now},
+			wantEligible: true,
+			wantMessage:  "Follow-up available (payment required)",
+		},
+		{
+			name:         "active window is free",
+			req:          Request{Policy: standard, Latest: &Window{Status: StatusActive, ValidUntil: inThreeDays, FreeVisitsTotal: 1}, Now: now},
+			wantEligible: true, wantFree: true, wantLeft: 1, wantDays: 3,
+			wantMessage: "Free follow-up available (3 days remaining)",
+		},
+		{
+			name:         "window closing today is still free",
+			req:          Request{Policy: standard, Latest: &Window{Status: StatusActive, ValidUntil: today, FreeVisitsTotal: 1}, Now: now},
+			wantEligible: true, wantFree: true, wantLeft: 1, wantDays: 0,
+			wantMessage: "Free follow-up available (0 days remaining)",
+		},
+		{
+			name:         "second of two free visits",
+			req:          Request{Policy: discounted, Latest: &Window{Status: StatusActive, ValidUntil: inThreeDays, FreeVisitsTotal: 2, FreeVisitsUsed: 1}, Now: now},
+			wantEligible: true, wantFree: true, wantLeft: 1, wantDays: 3,
+			wantMessage: "Free follow-up available (3 days remaining)",
+		},
+		{
+			name:         "free visits used with discount inside window",
+			req:          Request{Policy: discounted, Latest: &Window{Status: StatusUsed, ValidUntil: inThreeDays, FreeVisitsTotal: 2, FreeVisitsUsed: 2}, Now: now},
+			wantEligible: true, wantDiscount: true, wantDays: 3,
+			wantMessage: "Free follow-up already used. Discounted follow-up fee applies (3 days remaining)",
+		},
+		{
+			name:         "free visit used without discount",
+			req:          Request{Policy: standard, Latest: &Window{Status: StatusUsed, ValidUntil: inThreeDays, FreeVisitsTotal: 1, FreeVisitsUsed: 1}, Now: now},
+			wantEligible: true, wantDays: 3,
+			wantMessage: "Free follow-up already used. This follow-up requires payment.",
+		},
+		{
+			name:         "used window after expiry",
+			req:          Request{Policy: discounted, Latest: &Window{Status: StatusUsed, ValidUntil: yesterday, FreeVisitsTotal: 2, FreeVisitsUsed: 2}, Now: now},
+			wantEligible: true,
+			wantMessage:  "Free follow-up already used. This follow-up requires payment.",
+		},
+		{
+			name:         "active but past validity counts as expired",
+			req:          Request{Policy: standard, Latest: &Window{Status: StatusActive, ValidUntil: yesterday, FreeVisitsTotal: 1}, Now: now},
+			wantEligible: true,
+			wantMessage:  "Free follow-up expired. This follow-up requires payment.",
+		},
+		{
+			name:         "expired window",
+			req:          Request{Policy: standard, Latest: &Window{Status: StatusExpired, ValidUntil: yesterday, FreeVisitsTotal: 1}, Now: now},
+			wantEligible: true,
+			wantMessage:  "Free follow-up expired. This follow-up requires payment.",
+		},
+		{
+			name:         "video follow-up not covered",
+			req:          Request{Policy: noVideo, Latest: &Window{Status: StatusActive, ValidUntil: inThreeDays, FreeVisitsTotal: 1}, ViaVideo: true, Now: now},
+			wantEligible: true, wantLeft: 1, wantDays: 3,
+			wantMessage: "Video follow-ups are not covered by the free follow-up policy. This follow-up requires payment.",
+		},
+		{
+			name:        "renewed record falls back to visit history",
+			req:         Request{Policy: standard, Latest: &Window{Status: StatusRenewed, ValidUntil: inThreeDays, FreeVisitsTotal: 1}, Now: now},
+			wantMessage: "No previous appointment found with this doctor",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Evaluate(tt.req)
+			if got.Eligible != tt.wantEligible {
+				t.Errorf("Eligible = %v, want %v", got.Eligible, tt.wantEligible)
+			}
+			if got.IsFree != tt.wantFree {
+				t.Errorf("IsFree = %v, want %v", got.IsFree, tt.wantFree)
+			}
+			if got.IsDiscounted != tt.wantDiscount {
+				t.Errorf("IsDiscounted = %v, want %v", got.IsDiscounted, tt.wantDiscount)
+			}
+			if got.FreeVisitsLeft != tt.wantLeft {
+				t.Errorf("FreeVisitsLeft = %d, want %d", got.FreeVisitsLeft, tt.wantLeft)
+			}
+			if got.DaysRemaining != tt.wantDays {
+				t.Errorf("DaysRemaining = %d, want %d", got.DaysRemaining, tt.wantDays)
+			}
+			if got.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", got.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestEvaluateCrossDepartment(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	inThreeDays := time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)
+	yesterday := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	perDepartment := DefaultPolicy("clinic-1")
+	crossDepartment := perDepartment
+	crossDepartment.CrossDepartmentReset = true
+
+	here := &Window{ID: "fu-here", Status: StatusExpired, ValidUntil: yesterday, FreeVisitsTotal: 1}
+	renewedHere := &Window{ID: "fu-here", Status: StatusRenewed, ValidUntil: inThreeDays, FreeVisitsTotal: 1}
+	elsewhere := &Window{ID: "fu-elsewhere", Status: StatusActive, ValidUntil: inThreeDays, FreeVisitsTotal: 1}
+
+	tests := []struct {
+		name        string
+		req         Request
+		wantWindow  string
+		wantFree    bool
+		wantMessage string
+	}{
+		{
+			name:        "per-department policy ignores other departments",
+			req:         Request{Policy: perDepartment, Latest: here, LatestAnyDepartment: elsewhere, Now: now},
+			wantWindow:  "fu-here",
+			wantMessage: "Free follow-up expired. This follow-up requires payment.",
+		},
+		{
+			name:        "per-department policy without a window here",
+			req:         Request{Policy: perDepartment, LatestAnyDepartment: elsewhere, HasPreviousVisit: true, Now: now},
+			wantMessage: "Follow-up available (payment required)",
+		},
+		{
+			name:        "cross-department policy uses the doctor's latest window",
+			req:         Request{Policy: crossDepartment, Latest: here, LatestAnyDepartment: elsewhere, Now: now},
+			wantWindow:  "fu-elsewhere",
+			wantFree:    true,
+			wantMessage: "Free follow-up available (3 days remaining)",
+		},
+		{
+			name:        "cross-department policy over a window renewed from another department",
+			req:         Request{Policy: crossDepartment, Latest: renewedHere, LatestAnyDepartment: elsewhere, Now: now},
+			wantWindow:  "fu-elsewhere",
+			wantFree:    true,
+			wantMessage: "Free follow-up available (3 days remaining)",
+		},
+		{
+			name:        "cross-department policy with the latest window here",
+			req:         Request{Policy: crossDepartment, Latest: here, LatestAnyDepartment: here, Now: now},
+			wantWindow:  "fu-here",
+			wantMessage: "Free follow-up expired. This follow-up requires payment.",
+		},
+		{
+			name:        "cross-department policy falls back to the department window",
+			req:         Request{Policy: crossDepartment, Latest: here, Now: now},
+			wantWindow:  "fu-here",
+			wantMessage: "Free follow-up expired. This follow-up requires payment.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotWindow := ""
+			if w := tt.req.Window(); w != nil {
+				gotWindow = w.ID
+			}
+			if gotWindow != tt.wantWindow {
+				t.Errorf("Window() = %q, want %q", gotWindow, tt.wantWindow)
+			}
+			got := Evaluate(tt.req)
+			if got.IsFree != tt.wantFree {
+				t.Errorf("IsFree = %v, want %v", got.IsFree, tt.wantFree)
+			}
+			if got.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", got.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDecisionFee(t *testing.T) {
+	regular := floatPtr(300)
+
+	tests := []struct {
+		name     string
+		decision Decision
+		regular  *float64
+		want     float64
+	}{
+		{"free", Decision{IsFree: true}, regular, 0},
+		{"discounted", Decision{IsDiscounted: true, DiscountedFee: floatPtr(120)}, regular, 120},
+		{"regular", Decision{Eligible: true}, regular, 300},
+		{"no fee configured", Decision{Eligible: true}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.decision.Fee(tt.regular); got != tt.want {
+				t.Errorf("Fee() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrantsWindow(t *testing.T) {
+	withVideo := DefaultPolicy("clinic-1")
+	withoutVideo := withVideo
+	withoutVideo.VideoCounts = false
+
+	tests := []struct {
+		name             string
+		policy           Policy
+		consultationType string
+		want             bool
+	}{
+		{"clinic visit", withoutVideo, TypeClinicVisit, true},
+		{"video counts", withVideo, TypeVideoConsultation, true},
+		{"video excluded", withoutVideo, TypeVideoConsultation, false},
+		{"follow-up never grants", withVideo, TypeFollowUpClinic, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GrantsWindow(tt.policy, tt.consultationType); got != tt.want {
+				t.Errorf("GrantsWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowForAndConsume(t *testing.T) {
+	p := DefaultPolicy("clinic-1")
+	p.ValidityDays = 7
+	p.FreeVisits = 2
+
+	from, until := WindowFor(p, time.Date(2026, 1, 28, 18, 45, 0, 0, time.UTC))
+	if want := time.Date(2026, 1, 28, 0, 0, 0, 0, time.UTC); !from.Equal(want) {
+		t.Errorf("from = %v, want %v", from, want)
+	}
+	if want := time.Date(2026, 2, 4, 0, 0, 0, 0, time.UTC); !until.Equal(want) {
+		t.Errorf("until = %v, want %v", until, want)
+	}
+
+	used, exhausted := Consume(Window{FreeVisitsTotal: 2})
+	if used != 1 || exhausted {
+		t.Errorf("first Consume() = (%d, %v), want (1, false)", used, exhausted)
+	}
+	used, exhausted = Consume(Window{FreeVisitsTotal: 2, FreeVisitsUsed: 1})
+	if used != 2 || !exhausted {
+		t.Errorf("second Consume() = (%d, %v), want (2, true)", used, exhausted)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   error
+	}{
+		{"default is valid", DefaultPolicy("c"), nil},
+		{"zero validity", Policy{ValidityDays: 0, FreeVisits: 1}, ErrInvalidValidityDays},
+		{"too long", Policy{ValidityDays: MaxValidityDays + 1, FreeVisits: 1}, ErrInvalidValidityDays},
+		{"negative free visits", Policy{ValidityDays: 5, FreeVisits: -1}, ErrInvalidFreeVisits},
+		{"negative discount", Policy{ValidityDays: 5, DiscountedFee: floatPtr(-1)}, ErrInvalidDiscountedFee},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Validate(); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module shared-followup
+
+go 1.21
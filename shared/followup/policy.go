@@ -0,0 +1,122 @@
+package followup
+
+import "time"
+
+// Policy describes how follow-up eligibility is granted and consumed.
+// A policy can be defined for a whole clinic, for a department, for a doctor,
+// or for a doctor within a specific department. The most specific active
+// policy wins (see Resolve).
+type Policy struct {
+	ID                   *string   `json:"id,omitempty"`
+	ClinicID             string    `json:"clinic_id"`
+	DepartmentID         *string   `json:"department_id,omitempty"`
+	DoctorID             *string   `json:"doctor_id,omitempty"`
+	ValidityDays         int       `json:"validity_days"`
+	FreeVisits           int       `json:"free_visits"`
+	DiscountedFee        *float64  `json:"discounted_fee,omitempty"` // Fee once free visits are used up (nil = regular follow-up fee)
+	VideoCounts          bool      `json:"video_counts"`             // Video consultations grant and consume follow-ups
+	CrossDepartmentReset bool      `json:"cross_department_reset"`   // A visit with the doctor in any department resets the window
+	IsActive             bool      `json:"is_active"`
+	CreatedAt            time.Time `json:"created_at,omitempty"`
+	UpdatedAt            time.Time `json:"updated_at,omitempty"`
+}
+
+// Scope levels, from least to most specific.
+const (
+	ScopeDefault          = "default"
+	ScopeClinic           = "clinic"
+	ScopeDepartment       = "department"
+	ScopeDoctor           = "doctor"
+	ScopeDoctorDepartment = "doctor_department"
+)
+
+// DefaultValidityDays and DefaultFreeVisits keep the behaviour the system had
+// before policies were configurable: one free follow-up valid for 5 days.
+const (
+	DefaultValidityDays = 5
+	DefaultFreeVisits   = 1
+)
+
+// DefaultPolicy returns the policy used when a clinic has not configured one.
+func DefaultPolicy(clinicID string) Policy {
+	return Policy{
+		ClinicID:     clinicID,
+		ValidityDays: DefaultValidityDays,
+		FreeVisits:   DefaultFreeVisits,
+		VideoCounts:  true,
+		IsActive:     true,
+	}
+}
+
+// Scope reports which level the policy is defined at.
+func (p Policy) Scope() string {
+	switch {
+	case p.ID == nil:
+		return ScopeDefault
+	case p.DoctorID != nil && p.DepartmentID != nil:
+		return ScopeDoctorDepartment
+	case p.DoctorID != nil:
+		return ScopeDoctor
+	case p.DepartmentID != nil:
+		return ScopeDepartment
+	default:
+		return ScopeClinic
+	}
+}
+
+// specificity ranks a policy for the given doctor+department, or returns -1
+// if the policy does not apply to them.
+func (p Policy) specificity(doctorID string, departmentID *string) int {
+	if !p.IsActive {
+		return -1
+	}
+	if p.DoctorID != nil && *p.DoctorID != doctorID {
+		return -1
+	}
+	if p.DepartmentID != nil && (departmentID == nil || *p.DepartmentID != *departmentID) {
+		return -1
+	}
+
+	rank := 0
+	if p.DepartmentID != nil {
+		rank++
+	}
+	if p.DoctorID != nil {
+		rank += 2
+	}
+	return rank
+}
+
+// Resolve picks the most specific policy for a doctor+department out of the
+// clinic's policies: doctor+department, then doctor, then department, then
+// clinic-wide. Falls back to DefaultPolicy when nothing matches.
+func Resolve(clinicID, doctorID string, departmentID *string, candidates []Policy) Policy {
+	best := -1
+	resolved := DefaultPolicy(clinicID)
+
+	for _, p := range candidates {
+		if p.ClinicID != clinicID {
+			continue
+		}
+		if rank := p.specificity(doctorID, departmentID); rank > best {
+			best = rank
+			resolved = p
+		}
+	}
+
+	return resolved
+}
+
+// Validate checks the policy values are usable.
+func (p Policy) Validate() error {
+	if p.ValidityDays < 1 || p.ValidityDays > MaxValidityDays {
+		return ErrInvalidValidityDays
+	}
+	if p.FreeVisits < 0 {
+		return ErrInvalidFreeVisits
+	}
+	if p.DiscountedFee != nil && *p.DiscountedFee < 0 {
+		return ErrInvalidDiscountedFee
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package followup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// PolicyColumns is the column list ScanPolicy expects, for callers building
+// their own queries against follow_up_policies.
+const PolicyColumns = `
+	id, clinic_id, department_id, doctor_id, validity_days, free_visits,
+	discounted_fee, video_counts, cross_department_reset, is_active, created_at, updated_at
+`
+
+// ScanPolicy reads a row selected with the standard policy columns.
+func ScanPolicy(scan func(dest ...interface{}) error) (Policy, error) {
+	var p Policy
+	var id string
+	err := scan(
+		&id, &p.ClinicID, &p.DepartmentID, &p.DoctorID, &p.ValidityDays, &p.FreeVisits,
+		&p.DiscountedFee, &p.VideoCounts, &p.CrossDepartmentReset, &p.IsActive, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return Policy{}, err
+	}
+	p.ID = &id
+	return p, nil
+}
+
+// LoadPolicy fetches the candidate policies for a doctor+department in a
+// clinic and resolves the one that applies.
+func LoadPolicy(ctx context.Context, q Querier, clinicID, doctorID string, departmentID *string) (Policy, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+PolicyColumns+`
+		FROM follow_up_policies
+		WHERE clinic_id = $1
+		  AND is_active = true
+		  AND (doctor_id IS NULL OR doctor_id = $2)
+		  AND (department_id IS NULL OR department_id = $3)
+	`, clinicID, doctorID, departmentID)
+	if err != nil {
+		return DefaultPolicy(clinicID), fmt.Errorf("failed to load follow-up policies: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := make([]Policy, 0, 4)
+	for rows.Next() {
+		p, err := ScanPolicy(rows.Scan)
+		if err != nil {
+			return DefaultPolicy(clinicID), fmt.Errorf("failed to scan follow-up policy: %w", err)
+		}
+		candidates = append(candidates, p)
+	}
+	if err := rows.Err(); err != nil {
+		return DefaultPolicy(clinicID), fmt.Errorf("failed to read follow-up policies: %w", err)
+	}
+
+	return Resolve(clinicID, doctorID, departmentID, candidates), nil
+}
+
+// LoadWindows fetches the patient's latest follow-up window with the doctor in
+// the department (a nil department matching windows without one) and the
+// latest in any department, ready for Request.Latest and LatestAnyDepartment.
+func LoadWindows(ctx context.Context, q Querier, clinicPatientID, clinicID, doctorID string, departmentID *string) (latest, latestAnyDepartment *Window, err error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, status, valid_until, free_visits_total, free_visits_used,
+		       department_id IS NOT DISTINCT FROM $4::uuid
+		FROM follow_ups
+		WHERE clinic_patient_id = $1
+		  AND clinic_id = $2
+		  AND doctor_id = $3
+		ORDER BY created_at DESC
+	`, clinicPatientID, clinicID, doctorID, departmentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load follow-up windows: %w", err)
+	}
+	defer rows.Close()
+
+	for latest == nil && rows.Next() {
+		var w Window
+		var sameDepartment bool
+		if err := rows.Scan(&w.ID, &w.Status, &w.ValidUntil, &w.FreeVisitsTotal, &w.FreeVisitsUsed, &sameDepartment); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan follow-up window: %w", err)
+		}
+		if latestAnyDepartment == nil {
+			latestAnyDepartment = &w
+		}
+		if sameDepartment {
+			latest = &w
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read follow-up windows: %w", err)
+	}
+	return latest, latestAnyDepartment, nil
+}
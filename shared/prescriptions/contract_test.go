@@ -0,0 +1,215 @@
+package prescriptions
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// contract is every organization-service table and column this package reads
+// or writes. appointment-service reaches them through this package, so a
+// migration that drops or renames one of them breaks e-prescription publishing.
+var contract = map[string][]string{
+	"pharmacies":            {"id", "clinic_id", "is_active", "created_at"},
+	"clinic_pharmacy_links": {"id", "clinic_id", "pharmacy_id", "is_active", "created_at"},
+	"inventory.medicines":   {"id", "pharmacy_id", "name", "brand_name", "is_active", "updated_at"},
+	"sales_schema.prescriptions": {
+		"id", "pharmacy_id", "token_no", "patient_name", "patient_phone", "doctor_name", "date", "status", "source",
+		"clinic_id", "appointment_id", "consultation_id",
+		"patient_allergies", "safety_warnings", "override_reason", "override_by",
+	},
+	"sales_schema.prescription_items": {
+		"id", "prescription_id", "product_id", "medicine_name", "medicine_brand", "quantity", "instructions",
+		"duration_days", "dosage_per_day", "morning", "noon", "night", "dosage",
+	},
+}
+
+var contractSequences = []string{"sales_schema.prescription_number_seq"}
+
+const migrationsDir = "../../services/organization-service/migrations"
+
+var (
+	createTable    = regexp.MustCompile(`^create table (?:if not exists )?(\S+)\s*\((.*)\)$`)
+	alterTable     = regexp.MustCompile(`^alter table (?:if exists )?(?:only )?(\S+) (.*)$`)
+	addColumn      = regexp.MustCompile(`^add (?:column )?(?:if not exists )?(\w+)`)
+	dropColumn     = regexp.MustCompile(`^drop (?:column )?(?:if exists )?(\w+)`)
+	renameColumn   = regexp.MustCompile(`^rename (?:column )?(\w+) to (\w+)`)
+	createSequence = regexp.MustCompile(`^create sequence (?:if not exists )?(\S+)`)
+	lineComment    = regexp.MustCompile(`--[^\n]*`)
+	space          = regexp.MustCompile(`\s+`)
+)
+
+// schema replays organization-service's up migrations in file order and
+// returns the columns of every table and the sequences they create
+func schema(t *testing.T) (map[string]map[string]bool, map[string]bool) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found in %s: %v", migrationsDir, err)
+	}
+	sort.Strings(files)
+
+	tables := make(map[string]map[string]bool)
+	sequences := make(map[string]bool)
+	for _, f := range files {
+		if strings.HasSuffix(f, ".down.sql") {
+			continue
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql := lineComment.ReplaceAllString(string(b), "")
+		for _, stmt := range strings.Split(sql, ";") {
+			stmt = strings.ToLower(strings.TrimSpace(space.ReplaceAllString(stmt, " ")))
+			if m := createTable.FindStringSubmatch(stmt); m != nil {
+				name := tableName(m[1])
+				if tables[name] == nil {
+					tables[name] = make(map[string]bool)
+				}
+				for _, def := range splitTopLevel(m[2]) {
+					col := strings.Fields(def)[0]
+					switch col {
+					case "primary", "unique", "foreign", "constraint", "check":
+						continue
+					}
+					tables[name][col] = true
+				}
+				continue
+			}
+			if m := alterTable.FindStringSubmatch(stmt); m != nil {
+				cols := tables[tableName(m[1])]
+				if cols == nil {
+					continue
+				}
+				for _, action := range splitTopLevel(m[2]) {
+					if a := renameColumn.FindStringSubmatch(action); a != nil {
+						delete(cols, a[1])
+						cols[a[2]] = true
+					} else if a := dropColumn.FindStringSubmatch(action); a != nil && a[1] != "constraint" {
+						delete(cols, a[1])
+					} else if a := addColumn.FindStringSubmatch(action); a != nil && a[1] != "constraint" {
+						cols[a[1]] = true
+					}
+				}
+				continue
+			}
+			if m := createSequence.FindStringSubmatch(stmt); m != nil {
+				sequences[m[1]] = true
+			}
+		}
+	}
+	return tables, sequences
+}
+
+func tableName(name string) string {
+	return strings.TrimPrefix(name, "public.")
+}
+
+// splitTopLevel splits a column list or ALTER action list on the commas
+// outside parentheses
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+func TestContractMatchesMigrations(t *testing.T) {
+	tables, sequences := schema(t)
+
+	for table, cols := range contract {
+		defined := tables[table]
+		if defined == nil {
+			t.Errorf("organization-service migrations no longer create %s", table)
+			continue
+		}
+		for _, col := range cols {
+			if !defined[col] {
+				t.Errorf("%s.%s is used by e-prescription publishing but missing from organization-service migrations", table, col)
+			}
+		}
+	}
+	for _, seq := range contractSequences {
+		if !sequences[seq] {
+			t.Errorf("organization-service migrations no longer create sequence %s", seq)
+		}
+	}
+}
+
+var (
+	insertInto = regexp.MustCompile(`(?is)insert into (\S+) \((.*?)\)`)
+	fromTable  = regexp.MustCompile(`(?i)\b(?:from|join) ([a-z_]+(?:\.[a-z_]+)?)`)
+	sequenceOf = regexp.MustCompile(`nextval\('([^']+)'\)`)
+)
+
+// TestQueriesStayInContract keeps the SQL in this package to the tables and
+// columns listed in contract, so the contract cannot silently fall behind
+func TestQueriesStayInContract(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			query, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			for _, m := range fromTable.FindAllStringSubmatch(query, -1) {
+				if _, ok := contract[m[1]]; !ok {
+					t.Errorf("%s: query reads %s, which is not in the contract", fset.Position(lit.Pos()), m[1])
+				}
+			}
+			for _, m := range insertInto.FindAllStringSubmatch(query, -1) {
+				allowed := make(map[string]bool)
+				for _, c := range contract[m[1]] {
+					allowed[c] = true
+				}
+				for _, col := range strings.Split(m[2], ",") {
+					if col = strings.TrimSpace(col); !allowed[col] {
+						t.Errorf("%s: insert writes %s.%s, which is not in the contract", fset.Position(lit.Pos()), m[1], col)
+					}
+				}
+			}
+			for _, m := range sequenceOf.FindAllStringSubmatch(query, -1) {
+				found := false
+				for _, seq := range contractSequences {
+					found = found || seq == m[1]
+				}
+				if !found {
+					t.Errorf("%s: query draws on sequence %s, which is not in the contract", fset.Position(lit.Pos()), m[1])
+				}
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module shared-prescriptions
+
+go 1.21
@@ -0,0 +1,160 @@
+// Package prescriptions owns how prescriptions enter the pharmacy queue
+// (sales_schema.prescriptions). organization-service saves the ones entered
+// at the pharmacy and appointment-service publishes e-prescriptions from
+// finalized consultations; both go through Insert so the IDs, columns and
+// item quantities follow one set of rules.
+//
+// The tables are organization-service's, but appointment-service writes them
+// in the same database when it publishes, and reads the pharmacy links and
+// catalog to route and match the lines. That is a contract between the two
+// services: the tables, columns and sequence this package touches are listed
+// in contract_test.go, which checks them against organization-service's
+// migrations and checks the queries here against the list. A migration that
+// changes one of them must keep appointment-service publishing.
+package prescriptions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Prescription sources (sales_schema.prescriptions.source).
+const (
+	SourceManual       = "MANUAL"       // entered at the pharmacy
+	SourceConsultation = "CONSULTATION" // e-prescription from a doctor's consultation
+)
+
+// StatusPending is the status prescriptions enter the queue with.
+const StatusPending = "PENDING"
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Prescription is a prescription header with its items, as stored in the queue.
+type Prescription struct {
+	ID               string // assigned by Insert when empty
+	PharmacyID       string
+	TokenNo          string
+	PatientName      string
+	PatientPhone     string
+	DoctorName       string
+	Date             time.Time
+	Status           string
+	Source           string
+	ClinicID         *string
+	AppointmentID    *string
+	ConsultationID   *string
+	PatientAllergies string
+	SafetyWarnings   json.RawMessage // nil stores no warnings
+	OverrideReason   *string
+	OverrideBy       *string
+	Items            []Item
+}
+
+// Item is one prescribed medicine, matched to a product in the pharmacy's catalog.
+type Item struct {
+	ID            string // generated by the database when empty
+	ProductID     string
+	MedicineName  string
+	MedicineBrand string
+	Quantity      int
+	DurationDays  int
+	DosagePerDay  float64
+	Dosage        string
+	Morning       float64
+	Noon          float64
+	Night         float64
+	Instructions  string
+}
+
+// Normalise fills in what the prescriber left out: the daily dosage from the
+// morning/noon/night split, and the quantity for the course rounded up to
+// whole units.
+func (it *Item) Normalise() {
+	if it.DosagePerDay == 0 {
+		it.DosagePerDay = it.Morning + it.Noon + it.Night
+	}
+	if it.Quantity == 0 && it.DosagePerDay > 0 && it.DurationDays > 0 {
+		it.Quantity = int(math.Ceil(it.DosagePerDay * float64(it.DurationDays)))
+	}
+}
+
+// FormatID renders a prescription number as its ID.
+func FormatID(n int64) string {
+	return fmt.Sprintf("RX-%06d", n)
+}
+
+// NextID takes the next prescription ID from the shared sequence, so IDs stay
+// unique however many counters and consultations publish at once.
+func NextID(ctx context.Context, q Querier) (string, error) {
+	var n int64
+	if err := q.QueryRowContext(ctx, `SELECT nextval('sales_schema.prescription_number_seq')`).Scan(&n); err != nil {
+		return "", fmt.Errorf("failed to allocate prescription id: %w", err)
+	}
+	return FormatID(n), nil
+}
+
+// Insert saves the prescription and its items, assigning the ID when it has
+// none and normalising each item. Run it inside the caller's transaction so
+// the prescription lands with whatever else the caller writes.
+func Insert(ctx context.Context, q Querier, p *Prescription) error {
+	if p.ID == "" {
+		id, err := NextID(ctx, q)
+		if err != nil {
+			return err
+		}
+		p.ID = id
+	}
+	if p.Status == "" {
+		p.Status = StatusPending
+	}
+	if p.Source == "" {
+		p.Source = SourceManual
+	}
+	if p.Date.IsZero() {
+		p.Date = time.Now()
+	}
+	warnings := p.SafetyWarnings
+	if warnings == nil {
+		warnings = json.RawMessage("[]")
+	}
+
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO sales_schema.prescriptions (
+			id, pharmacy_id, token_no, patient_name, patient_phone, doctor_name, date, status, source,
+			clinic_id, appointment_id, consultation_id,
+			patient_allergies, safety_warnings, override_reason, override_by
+		)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, NULLIF($13, ''), $14, $15, $16)
+	`, p.ID, p.PharmacyID, p.TokenNo, p.PatientName, p.PatientPhone, p.DoctorName, p.Date, p.Status, p.Source,
+		p.ClinicID, p.AppointmentID, p.ConsultationID,
+		p.PatientAllergies, []byte(warnings), p.OverrideReason, p.OverrideBy)
+	if err != nil {
+		return fmt.Errorf("failed to insert prescription: %w", err)
+	}
+
+	for i := range p.Items {
+		it := &p.Items[i]
+		it.Normalise()
+		err := q.QueryRowContext(ctx, `
+			INSERT INTO sales_schema.prescription_items (
+				id, prescription_id, product_id, medicine_name, medicine_brand, quantity, instructions,
+				duration_days, dosage_per_day, morning, noon, night, dosage
+			)
+			VALUES (COALESCE(NULLIF($1, '')::uuid, uuid_generate_v4()), $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, $11, $12, NULLIF($13, ''))
+			RETURNING id
+		`, it.ID, p.ID, it.ProductID, it.MedicineName, it.MedicineBrand, it.Quantity, it.Instructions,
+			it.DurationDays, it.DosagePerDay, it.Morning, it.Noon, it.Night, it.Dosage).Scan(&it.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert prescription item: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package prescriptions
+
+import "testing"
+
+func TestItemNormalise(t *testing.T) {
+	tests := []struct {
+		name         string
+		item         Item
+		wantDosage   float64
+		wantQuantity int
+	}{
+		{"dosage from the daily split", Item{Morning: 1, Noon: 0.5, Night: 1, DurationDays: 5}, 2.5, 13},
+		{"explicit dosage kept", Item{DosagePerDay: 3, Morning: 1, DurationDays: 2}, 3, 6},
+		{"explicit quantity kept", Item{Morning: 1, Night: 1, DurationDays: 5, Quantity: 4}, 2, 4},
+		{"half tablet rounds up", Item{Night: 0.5, DurationDays: 3}, 0.5, 2},
+		{"no duration leaves quantity", Item{Morning: 1}, 1, 0},
+		{"no dosage leaves quantity", Item{DurationDays: 7}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := tt.item
+			it.Normalise()
+			if it.DosagePerDay != tt.wantDosage {
+				t.Errorf("DosagePerDay = %v, want %v", it.DosagePerDay, tt.wantDosage)
+			}
+			if it.Quantity != tt.wantQuantity {
+				t.Errorf("Quantity = %d, want %d", it.Quantity, tt.wantQuantity)
+			}
+		})
+	}
+}
+
+func TestFormatID(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{1, "RX-000001"},
+		{123456, "RX-123456"},
+		{1234567, "RX-1234567"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatID(tt.n); got != tt.want {
+			t.Errorf("FormatID(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package prescriptions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ResolvePharmacy returns the pharmacy that receives a clinic's
+// e-prescriptions: the requested one when it is active and linked to the
+// clinic (or the clinic's own), otherwise the clinic's first active linked
+// pharmacy. ok is false when no pharmacy qualifies.
+func ResolvePharmacy(ctx context.Context, q Querier, clinicID string, pharmacyID *string) (id string, ok bool, err error) {
+	err = q.QueryRowContext(ctx, `
+		SELECT p.id
+		FROM pharmacies p
+		LEFT JOIN clinic_pharmacy_links l ON l.pharmacy_id = p.id AND l.clinic_id = $1 AND l.is_active = true
+		WHERE p.is_active = true
+		  AND (l.id IS NOT NULL OR p.clinic_id = $1)
+		  AND ($2::uuid IS NULL OR p.id = $2)
+		ORDER BY l.created_at NULLS LAST, p.created_at
+		LIMIT 1
+	`, clinicID, pharmacyID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve linked pharmacy: %w", err)
+	}
+	return id, true, nil
+}
+
+// MatchProduct finds the catalog medicine a prescribed line refers to: the
+// given medicine when the prescriber picked one from the catalog, otherwise
+// the active medicine with the same name (and brand, when given). ok is false
+// when the pharmacy does not stock it.
+func MatchProduct(ctx context.Context, q Querier, pharmacyID string, medicineID *string, name string, brand *string) (productID string, ok bool, err error) {
+	err = q.QueryRowContext(ctx, `
+		SELECT id FROM inventory.medicines
+		WHERE pharmacy_id = $1 AND is_active = true
+		  AND (
+		      ($2::uuid IS NOT NULL AND id = $2)
+		      OR ($2::uuid IS NULL AND LOWER(name) = LOWER($3)
+		          AND ($4::text IS NULL OR LOWER(COALESCE(brand_name, '')) = LOWER($4)))
+		  )
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, pharmacyID, medicineID, name, brand).Scan(&productID)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to match medicine with pharmacy inventory: %w", err)
+	}
+	return productID, true, nil
+}
@@ -0,0 +1,3 @@
+module shared-scheduler
+
+go 1.21
@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"every minute", "* * * * *", false},
+		{"lists ranges and steps", "0,30 8-18/2 1-15 */3 1-5", false},
+		{"alias", "@daily", false},
+		{"surrounding space", "  @hourly ", false},
+		{"sunday as seven", "0 0 * * 7", false},
+		{"too few fields", "0 0 * *", true},
+		{"too many fields", "0 0 * * * *", true},
+		{"minute out of range", "60 * * * *", true},
+		{"hour out of range", "0 24 * * *", true},
+		{"day of month zero", "0 0 0 * *", true},
+		{"backwards range", "0 10-8 * * *", true},
+		{"zero step", "*/0 * * * *", true},
+		{"not a number", "x * * * *", true},
+		{"unknown alias", "@yearly", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if err == nil && s.String() == "" {
+				t.Errorf("String() is empty for %q", tt.expr)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	// Tuesday 10 March 2026, 15:30:20
+	now := time.Date(2026, 3, 10, 15, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute skips the current minute", "* * * * *", now, time.Date(2026, 3, 10, 15, 31, 0, 0, time.UTC)},
+		{"exactly on a match moves on", "30 15 * * *", time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC), time.Date(2026, 3, 11, 15, 30, 0, 0, time.UTC)},
+		{"later today", "0 18 * * *", now, time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC)},
+		{"daily rolls to tomorrow", "@daily", now, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"hourly", "@hourly", now, time.Date(2026, 3, 10, 16, 0, 0, 0, time.UTC)},
+		{"step minutes", "*/15 * * * *", now, time.Date(2026, 3, 10, 15, 45, 0, 0, time.UTC)},
+		{"next weekday", "0 9 * * 1-5", now, time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"sunday as seven", "0 0 * * 7", now, time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"monthly crosses the month", "@monthly", now, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"month end crosses the year", "0 0 1 1 *", now, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"either day field matches", "0 0 20 * 5", now, time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", now, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"impossible date", "0 0 31 2 *", now, time.Time{}},
+		{"evaluated in the caller's location", "10 0 * * *", now.In(ist), time.Date(2026, 3, 11, 0, 10, 0, 0, ist)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MustParseSchedule(tt.expr).Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
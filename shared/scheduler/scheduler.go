@@ -0,0 +1,499 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// =====================================================
+// IN-PROCESS JOB SCHEDULER
+// Every replica runs a Scheduler, but only the replica holding the
+// Postgres advisory leader lock fires scheduled jobs. Each run also takes
+// a per-job advisory lock, so a manual trigger can never overlap a
+// scheduled run of the same job on another replica.
+// Job state (pause flag, next run) lives in scheduled_jobs and every run
+// is recorded in scheduled_job_runs.
+// Services sharing a database elect their leaders separately: the leader
+// and job locks are named after the service that runs the scheduler.
+// =====================================================
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+
+	defaultTickInterval = 30 * time.Second
+	defaultJobTimeout   = 5 * time.Minute
+)
+
+var (
+	ErrJobNotFound = errors.New("scheduled job not found")
+	ErrJobRunning  = errors.New("scheduled job is already running")
+)
+
+// JobFunc performs the work of a job and reports how many rows it affected
+type JobFunc func(ctx context.Context, db *sql.DB) (int64, error)
+
+// Job is a named unit of work run on a cron schedule
+type Job struct {
+	Name        string
+	Description string
+	Schedule    *Schedule
+	Timeout     time.Duration
+	Run         JobFunc
+}
+
+// JobState is a job definition merged with its persisted state
+type JobState struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Schedule    string     `json:"schedule"`
+	IsPaused    bool       `json:"is_paused"`
+	LastRunAt   *time.Time `json:"last_run_at"`
+	LastStatus  *string    `json:"last_status"`
+	NextRunAt   *time.Time `json:"next_run_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// JobRun is one entry of a job's run history
+type JobRun struct {
+	ID           int64      `json:"id"`
+	JobName      string     `json:"job_name"`
+	Trigger      string     `json:"trigger"`
+	Status       string     `json:"status"`
+	InstanceID   string     `json:"instance_id"`
+	AffectedRows int64      `json:"affected_rows"`
+	Error        *string    `json:"error"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+}
+
+// Scheduler fires registered jobs on their schedules while it holds leadership
+type Scheduler struct {
+	db         *sql.DB
+	service    string
+	loc        *time.Location
+	instanceID string
+	interval   time.Duration
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	leader *sql.Conn
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a scheduler for service; schedules are evaluated in loc
+func New(db *sql.DB, loc *time.Location, service string) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		db:         db,
+		service:    service,
+		loc:        loc,
+		instanceID: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		interval:   defaultTickInterval,
+		jobs:       make(map[string]*Job),
+	}
+}
+
+// Register adds a job; must be called before Start
+func (s *Scheduler) Register(job *Job) {
+	if job.Timeout == 0 {
+		job.Timeout = defaultJobTimeout
+	}
+	s.mu.Lock()
+	s.jobs[job.Name] = job
+	s.mu.Unlock()
+}
+
+// Start persists job definitions and launches the scheduling loop
+func (s *Scheduler) Start(ctx context.Context) error {
+	for _, job := range s.sortedJobs() {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO scheduled_jobs (name, description, schedule)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE
+			SET description = EXCLUDED.description,
+			    schedule = EXCLUDED.schedule,
+			    next_run_at = CASE WHEN scheduled_jobs.schedule = EXCLUDED.schedule
+			                       THEN scheduled_jobs.next_run_at ELSE NULL END,
+			    updated_at = CURRENT_TIMESTAMP
+		`, job.Name, job.Description, job.Schedule.String())
+		if err != nil {
+			return fmt.Errorf("failed to register job %s: %w", job.Name, err)
+		}
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go s.loop(loopCtx)
+	log.Printf("🕒 Scheduler started with %d job(s) (instance %s)", len(s.jobs), s.instanceID)
+	return nil
+}
+
+// Stop ends the scheduling loop, waits for in-flight scheduled runs and releases leadership
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.releaseLeadership()
+	log.Println("🕒 Scheduler stopped")
+}
+
+// IsLeader reports whether this instance currently fires scheduled jobs
+func (s *Scheduler) IsLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leader != nil
+}
+
+// InstanceID identifies this replica in run history
+func (s *Scheduler) InstanceID() string {
+	return s.instanceID
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.tick(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	if !s.acquireLeadership(ctx) {
+		return
+	}
+
+	now := time.Now().In(s.loc)
+	for _, job := range s.sortedJobs() {
+		var isPaused bool
+		var nextRunAt sql.NullTime
+		err := s.db.QueryRowContext(ctx, `
+			SELECT is_paused, next_run_at FROM scheduled_jobs WHERE name = $1
+		`, job.Name).Scan(&isPaused, &nextRunAt)
+		if err != nil {
+			log.Printf("⚠️ Scheduler: failed to load state for %s: %v", job.Name, err)
+			continue
+		}
+		if isPaused {
+			continue
+		}
+
+		if !nextRunAt.Valid {
+			s.setNextRun(ctx, job, now)
+			continue
+		}
+		if now.Before(nextRunAt.Time) {
+			continue
+		}
+
+		if _, err := s.execute(ctx, job, TriggerSchedule); err != nil && !errors.Is(err, ErrJobRunning) {
+			log.Printf("❌ Scheduler: job %s failed: %v", job.Name, err)
+		}
+	}
+}
+
+// acquireLeadership holds a session-level advisory lock on a dedicated connection.
+// If the connection drops, Postgres releases the lock and another replica takes over.
+func (s *Scheduler) acquireLeadership(ctx context.Context) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leader != nil {
+		if err := s.leader.PingContext(ctx); err == nil {
+			return true
+		}
+		log.Printf("⚠️ Scheduler: lost leader connection on %s", s.instanceID)
+		s.leader.Close()
+		s.leader = nil
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, s.leaderLockKey()).Scan(&acquired); err != nil || !acquired {
+		conn.Close()
+		return false
+	}
+
+	s.leader = conn
+	log.Printf("👑 Scheduler: %s is now the leader", s.instanceID)
+	return true
+}
+
+func (s *Scheduler) releaseLeadership() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leader == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.leader.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, s.leaderLockKey())
+	s.leader.Close()
+	s.leader = nil
+}
+
+// Trigger runs a job immediately on this instance, regardless of leadership or pause state
+func (s *Scheduler) Trigger(ctx context.Context, name string) (*JobRun, error) {
+	job := s.job(name)
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return s.execute(ctx, job, TriggerManual)
+}
+
+// execute runs a job under its advisory lock and records the run
+func (s *Scheduler) execute(ctx context.Context, job *Job, trigger string) (*JobRun, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	key := lockKey(s.service + ":job:" + job.Name)
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrJobRunning
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+
+	// A scheduled run may have been completed by a previous leader between our read and the lock
+	if trigger == TriggerSchedule {
+		var nextRunAt sql.NullTime
+		if err := conn.QueryRowContext(ctx, `SELECT next_run_at FROM scheduled_jobs WHERE name = $1`, job.Name).Scan(&nextRunAt); err != nil {
+			return nil, err
+		}
+		if nextRunAt.Valid && time.Now().Before(nextRunAt.Time) {
+			return nil, nil
+		}
+	}
+
+	run := &JobRun{
+		JobName:    job.Name,
+		Trigger:    trigger,
+		Status:     RunStatusRunning,
+		InstanceID: s.instanceID,
+	}
+	err = conn.QueryRowContext(ctx, `
+		INSERT INTO scheduled_job_runs (job_name, trigger, status, instance_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, started_at
+	`, run.JobName, run.Trigger, run.Status, run.InstanceID).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record job run: %w", err)
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	affected, runErr := job.Run(jobCtx, s.db)
+	cancel()
+
+	run.AffectedRows = affected
+	run.Status = RunStatusSucceeded
+	if runErr != nil {
+		run.Status = RunStatusFailed
+		msg := runErr.Error()
+		run.Error = &msg
+	}
+
+	// Record the outcome even if the caller's context is gone
+	finishCtx, finishCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer finishCancel()
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if _, err := conn.ExecContext(finishCtx, `
+		UPDATE scheduled_job_runs
+		SET status = $1, affected_rows = $2, error = $3, finished_at = $4
+		WHERE id = $5
+	`, run.Status, run.AffectedRows, run.Error, finishedAt, run.ID); err != nil {
+		log.Printf("⚠️ Scheduler: failed to record outcome of %s run %d: %v", job.Name, run.ID, err)
+	}
+
+	next := job.Schedule.Next(finishedAt.In(s.loc))
+	if _, err := conn.ExecContext(finishCtx, `
+		UPDATE scheduled_jobs
+		SET last_run_at = $1, last_status = $2,
+		    next_run_at = CASE WHEN $3 = 'schedule' OR next_run_at IS NULL THEN $4 ELSE next_run_at END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE name = $5
+	`, finishedAt, run.Status, trigger, nullableTime(next), job.Name); err != nil {
+		log.Printf("⚠️ Scheduler: failed to update state of %s: %v", job.Name, err)
+	}
+
+	if runErr != nil {
+		return run, runErr
+	}
+	if affected > 0 {
+		log.Printf("✅ Scheduler: %s (%s) affected %d row(s)", job.Name, trigger, affected)
+	}
+	return run, nil
+}
+
+func (s *Scheduler) setNextRun(ctx context.Context, job *Job, from time.Time) {
+	next := job.Schedule.Next(from)
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE scheduled_jobs SET next_run_at = $1, updated_at = CURRENT_TIMESTAMP WHERE name = $2
+	`, nullableTime(next), job.Name); err != nil {
+		log.Printf("⚠️ Scheduler: failed to schedule %s: %v", job.Name, err)
+	}
+}
+
+// SetPaused pauses or resumes scheduled runs of a job across all replicas
+func (s *Scheduler) SetPaused(ctx context.Context, name string, paused bool) (*JobState, error) {
+	job := s.job(name)
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+
+	// Resuming recomputes the next run so missed slots are not fired in a burst
+	var next interface{}
+	if !paused {
+		next = nullableTime(job.Schedule.Next(time.Now().In(s.loc)))
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE scheduled_jobs
+		SET is_paused = $1,
+		    next_run_at = CASE WHEN $1 THEN next_run_at ELSE $2 END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE name = $3
+	`, paused, next, name); err != nil {
+		return nil, err
+	}
+
+	return s.State(ctx, name)
+}
+
+// State returns the persisted state of one job
+func (s *Scheduler) State(ctx context.Context, name string) (*JobState, error) {
+	job := s.job(name)
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+
+	st := JobState{Name: job.Name, Description: job.Description, Schedule: job.Schedule.String()}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT is_paused, last_run_at, last_status, next_run_at, updated_at
+		FROM scheduled_jobs WHERE name = $1
+	`, name).Scan(&st.IsPaused, &st.LastRunAt, &st.LastStatus, &st.NextRunAt, &st.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// States returns the persisted state of every registered job
+func (s *Scheduler) States(ctx context.Context) ([]JobState, error) {
+	states := make([]JobState, 0, len(s.jobs))
+	for _, job := range s.sortedJobs() {
+		st, err := s.State(ctx, job.Name)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, *st)
+	}
+	return states, nil
+}
+
+// Runs returns the most recent runs of a job, newest first
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int) ([]JobRun, error) {
+	if s.job(name) == nil {
+		return nil, ErrJobNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, job_name, trigger, status, instance_id, affected_rows, error, started_at, finished_at
+		FROM scheduled_job_runs
+		WHERE job_name = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]JobRun, 0)
+	for rows.Next() {
+		var r JobRun
+		if err := rows.Scan(&r.ID, &r.JobName, &r.Trigger, &r.Status, &r.InstanceID,
+			&r.AffectedRows, &r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+func (s *Scheduler) job(name string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[name]
+}
+
+func (s *Scheduler) sortedJobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+func (s *Scheduler) leaderLockKey() int64 {
+	return lockKey(s.service + ":scheduler:leader")
+}
+
+// lockKey maps a lock name onto the bigint key space of pg advisory locks
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}